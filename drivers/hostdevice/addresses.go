@@ -0,0 +1,59 @@
+package main
+
+import (
+	"net"
+	"strings"
+
+	"github.com/vishvananda/netlink"
+	resourceapi "k8s.io/api/resource/v1"
+	"k8s.io/klog/v2"
+)
+
+// addAddressAttributes publishes the global addresses of the host interface
+// link, so claims can select the devices already connected to a subnet:
+//   - ip-addresses, the comma separated list of addresses in CIDR notation,
+//     truncated to the addresses that fit in an attribute.
+//   - ipv4-subnet and ipv6-subnet, the subnet of the first address of each
+//     family, e.g. 192.168.5.0/24.
+//
+// Devices without addresses do not publish them.
+func addAddressAttributes(device *resourceapi.Device, link netlink.Link) {
+	addrs, err := netlink.AddrList(link, netlink.FAMILY_ALL)
+	if err != nil {
+		klog.V(2).Infof("failed to get addresses of %s: %v", link.Attrs().Name, err)
+		return
+	}
+	setAddressAttributes(device, addrs)
+}
+
+func setAddressAttributes(device *resourceapi.Device, addrs []netlink.Addr) {
+	var addresses []string
+	length := 0
+	subnets := map[resourceapi.QualifiedName]string{}
+	for _, addr := range addrs {
+		if addr.IPNet == nil || addr.Scope != int(netlink.SCOPE_UNIVERSE) {
+			continue
+		}
+		address := addr.IPNet.String()
+		if length+len(address) <= resourceapi.DeviceAttributeMaxValueLength {
+			addresses = append(addresses, address)
+			length += len(address) + 1
+		}
+		family := resourceapi.QualifiedName("ipv6-subnet")
+		if addr.IP.To4() != nil {
+			family = "ipv4-subnet"
+		}
+		if _, ok := subnets[family]; !ok {
+			subnet := net.IPNet{IP: addr.IP.Mask(addr.Mask), Mask: addr.Mask}
+			subnets[family] = subnet.String()
+		}
+	}
+	if len(addresses) == 0 {
+		return
+	}
+	value := strings.Join(addresses, ",")
+	device.Attributes["ip-addresses"] = resourceapi.DeviceAttribute{StringValue: &value}
+	for name, subnet := range subnets {
+		device.Attributes[name] = resourceapi.DeviceAttribute{StringValue: &subnet}
+	}
+}
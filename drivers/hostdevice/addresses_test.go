@@ -0,0 +1,95 @@
+package main
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/vishvananda/netlink"
+	resourceapi "k8s.io/api/resource/v1"
+)
+
+func newAddr(t *testing.T, cidr string, scope netlink.Scope) netlink.Addr {
+	t.Helper()
+	ip, ipnet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		t.Fatalf("invalid test address %s: %v", cidr, err)
+	}
+	ipnet.IP = ip
+	return netlink.Addr{IPNet: ipnet, Scope: int(scope)}
+}
+
+func Test_setAddressAttributes(t *testing.T) {
+	tests := []struct {
+		name  string
+		addrs []string
+		link  []string
+		want  map[resourceapi.QualifiedName]string
+	}{
+		{
+			name: "no addresses",
+			want: map[resourceapi.QualifiedName]string{},
+		},
+		{
+			name: "only link local",
+			link: []string{"fe80::1/64"},
+			want: map[resourceapi.QualifiedName]string{},
+		},
+		{
+			name:  "dual stack",
+			addrs: []string{"192.168.5.10/24", "192.168.6.10/24", "2001:db8::10/64"},
+			link:  []string{"fe80::1/64"},
+			want: map[resourceapi.QualifiedName]string{
+				"ip-addresses": "192.168.5.10/24,192.168.6.10/24,2001:db8::10/64",
+				"ipv4-subnet":  "192.168.5.0/24",
+				"ipv6-subnet":  "2001:db8::/64",
+			},
+		},
+		{
+			name: "truncated list",
+			addrs: []string{
+				"2001:db8:1111:2222:3333:4444:5555:1/64",
+				"2001:db8:1111:2222:3333:4444:5555:2/64",
+				"192.168.5.10/24",
+			},
+			want: map[resourceapi.QualifiedName]string{
+				"ip-addresses": "2001:db8:1111:2222:3333:4444:5555:1/64,192.168.5.10/24",
+				"ipv4-subnet":  "192.168.5.0/24",
+				"ipv6-subnet":  "2001:db8:1111:2222::/64",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var addrs []netlink.Addr
+			for _, cidr := range tt.addrs {
+				addrs = append(addrs, newAddr(t, cidr, netlink.SCOPE_UNIVERSE))
+			}
+			for _, cidr := range tt.link {
+				addrs = append(addrs, newAddr(t, cidr, netlink.SCOPE_LINK))
+			}
+			device := resourceapi.Device{Name: "eth1", Attributes: map[resourceapi.QualifiedName]resourceapi.DeviceAttribute{}}
+			setAddressAttributes(&device, addrs)
+
+			if len(device.Attributes) != len(tt.want) {
+				t.Errorf("expected attributes %v, got %v", tt.want, device.Attributes)
+			}
+			for name, want := range tt.want {
+				attr, ok := device.Attributes[name]
+				if !ok || attr.StringValue == nil {
+					t.Errorf("missing attribute %s", name)
+					continue
+				}
+				if *attr.StringValue != want {
+					t.Errorf("attribute %s = %q, want %q", name, *attr.StringValue, want)
+				}
+				if len(*attr.StringValue) > resourceapi.DeviceAttributeMaxValueLength {
+					t.Errorf("attribute %s is too long: %q", name, *attr.StringValue)
+				}
+			}
+			if value := device.Attributes["ip-addresses"].StringValue; value != nil && strings.HasSuffix(*value, ",") {
+				t.Errorf("unexpected trailing separator in %q", *value)
+			}
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+// parseAllowlist returns the interface names of a comma separated list and
+// of the JSON array in the file at path, if any.
+func parseAllowlist(value string, path string) (sets.Set[string], error) {
+	allowlist := sets.New[string]()
+	for _, entry := range strings.Split(value, ",") {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			allowlist.Insert(entry)
+		}
+	}
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read device allowlist %s: %w", path, err)
+		}
+		var names []string
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&names); err != nil {
+			return nil, fmt.Errorf("failed to decode device allowlist %s: %w", path, err)
+		}
+		allowlist.Insert(names...)
+	}
+	for name := range allowlist {
+		if !validInterfaceName(name) {
+			return nil, fmt.Errorf("invalid interface name %q in the device allowlist", name)
+		}
+	}
+	return allowlist, nil
+}
+
+// validInterfaceName returns true if the kernel accepts the interface name.
+func validInterfaceName(name string) bool {
+	return len(name) > 0 && len(name) < 16 && name != "." && name != ".." &&
+		!strings.ContainsAny(name, "/: \t\n")
+}
+
+// isAllowed returns true if the interface can be published and moved into
+// pods, all of them when there is no allowlist.
+func (k *NetworkDriver) isAllowed(name string) bool {
+	return k.allowlist == nil || k.allowlist.Has(name)
+}
+
+// validateAllowlist returns an error if an entry of the allowlist is not an
+// interface of the host, so a typo does not leave the node without devices
+// unnoticed. The devices attached to pods in the checkpoint are not on the
+// host and are accepted.
+func (k *NetworkDriver) validateAllowlist() error {
+	if k.allowlist == nil {
+		return nil
+	}
+	k.mu.Lock()
+	attached := sets.New[string]()
+	for _, devices := range k.sharedState.PreparedData {
+		for _, device := range devices {
+			if device.State != DeviceStateDetached {
+				attached.Insert(device.DeviceName)
+			}
+		}
+	}
+	k.mu.Unlock()
+	var unknown []string
+	for _, name := range sets.List(k.allowlist) {
+		if !attached.Has(name) && !k.host.hostLinkExists(name) {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) > 0 {
+		return fmt.Errorf("device allowlist entries %v are not interfaces of the host", unknown)
+	}
+	return nil
+}
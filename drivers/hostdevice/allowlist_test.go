@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	resourceapi "k8s.io/api/resource/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func Test_parseAllowlist(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		content string
+		want    []string
+		wantErr bool
+	}{
+		{name: "flag", value: "eth1, eth2,", want: []string{"eth1", "eth2"}},
+		{name: "file", content: `["eth2", "eth3"]`, want: []string{"eth2", "eth3"}},
+		{name: "flag and file", value: "eth1,eth2", content: `["eth2", "eth3"]`, want: []string{"eth1", "eth2", "eth3"}},
+		{name: "invalid name", value: "eth1:0", wantErr: true},
+		{name: "name too long", content: `["interfacename016"]`, wantErr: true},
+		{name: "invalid json", content: `{"eth1": true}`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var path string
+			if tt.content != "" {
+				path = filepath.Join(t.TempDir(), "allowlist.json")
+				if err := os.WriteFile(path, []byte(tt.content), 0600); err != nil {
+					t.Fatal(err)
+				}
+			}
+			got, err := parseAllowlist(tt.value, path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseAllowlist() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !got.Equal(sets.New(tt.want...)) {
+				t.Errorf("parseAllowlist() = %v, want %v", sets.List(got), tt.want)
+			}
+		})
+	}
+}
+
+func Test_validateAllowlist(t *testing.T) {
+	k := NewNetworkDriver(driverName, "node1", fake.NewClientset())
+	k.host.hostLinkExists = func(ifName string) bool { return ifName == "eth1" }
+
+	if err := k.validateAllowlist(); err != nil {
+		t.Errorf("unexpected error without allowlist: %v", err)
+	}
+	k.allowlist = sets.New("eth1", "eth2")
+	if err := k.validateAllowlist(); err == nil || !strings.Contains(err.Error(), "eth2") {
+		t.Errorf("expected error for the missing eth2, got %v", err)
+	}
+	// the devices in the pods are not on the host after a restart
+	k.sharedState.PreparedData["claim-uid"] = []PreparedDevice{{DeviceName: "eth2", State: DeviceStateAttached}}
+	if err := k.validateAllowlist(); err != nil {
+		t.Errorf("unexpected error with eth2 attached to a pod: %v", err)
+	}
+}
+
+func Test_prepareDevice_allowlist(t *testing.T) {
+	k := NewNetworkDriver(driverName, "node1", fake.NewClientset())
+	k.checkpointPath = ""
+	k.allowlist = sets.New("eth2")
+
+	claim := newClaimWithConfig()
+	claim.Name = "claim"
+	claim.UID = "claim-uid"
+	results, err := k.PrepareResourceClaims(context.Background(), []*resourceapi.ResourceClaim{claim})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := results[claim.UID].Err; err == nil || !strings.Contains(err.Error(), "allowlist") {
+		t.Fatalf("expected eth1 outside the allowlist to be refused, got %v", err)
+	}
+	if _, ok := k.sharedState.PreparedData[claim.UID]; ok {
+		t.Errorf("refused claim must not be prepared")
+	}
+
+	k.allowlist = sets.New("eth1")
+	results, err = k.PrepareResourceClaims(context.Background(), []*resourceapi.ResourceClaim{claim})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := results[claim.UID].Err; err != nil {
+		t.Errorf("unexpected error preparing an allowed device: %v", err)
+	}
+}
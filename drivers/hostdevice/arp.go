@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// arpSysctls are the IPv4 settings modified by the ARP configuration.
+var arpSysctls = []string{"arp_announce", "arp_ignore"}
+
+// ARPConfig configures the ARP behavior of the interface, for pods with
+// multiple interfaces on the same network where the kernel would otherwise
+// answer and announce the addresses of one interface through the others.
+type ARPConfig struct {
+	// Announce restricts the source address of the ARP requests: 0 any
+	// local address, 1 an address in the subnet of the target, 2 the best
+	// address of the interface.
+	Announce int `json:"announce,omitempty"`
+	// Ignore restricts the ARP requests answered: 0 any local address, 1
+	// only addresses of the interface, 2 also in the subnet of the sender,
+	// 3 not host scoped addresses, 8 none.
+	Ignore int `json:"ignore,omitempty"`
+}
+
+func (c ARPConfig) validate() error {
+	if c.Announce < 0 || c.Announce > 2 {
+		return fmt.Errorf("invalid announce %d, must be 0, 1 or 2", c.Announce)
+	}
+	switch c.Ignore {
+	case 0, 1, 2, 3, 8:
+	default:
+		return fmt.Errorf("invalid ignore %d, must be 0, 1, 2, 3 or 8", c.Ignore)
+	}
+	return nil
+}
+
+// sysctls returns the interface settings of the configuration.
+func (c ARPConfig) sysctls() map[string]string {
+	return map[string]string{
+		"arp_announce": strconv.Itoa(c.Announce),
+		"arp_ignore":   strconv.Itoa(c.Ignore),
+	}
+}
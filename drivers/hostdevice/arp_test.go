@@ -0,0 +1,48 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestARPConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  ARPConfig
+		want    map[string]string
+		wantErr bool
+	}{
+		{
+			name:   "multi-homed",
+			config: ARPConfig{Announce: 2, Ignore: 1},
+			want:   map[string]string{"arp_announce": "2", "arp_ignore": "1"},
+		},
+		{
+			name:   "defaults",
+			config: ARPConfig{},
+			want:   map[string]string{"arp_announce": "0", "arp_ignore": "0"},
+		},
+		{
+			name:   "ignore all",
+			config: ARPConfig{Ignore: 8},
+			want:   map[string]string{"arp_announce": "0", "arp_ignore": "8"},
+		},
+		{name: "invalid announce", config: ARPConfig{Announce: 3}, wantErr: true},
+		{name: "negative announce", config: ARPConfig{Announce: -1}, wantErr: true},
+		{name: "reserved ignore", config: ARPConfig{Ignore: 4}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.validate()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got := tt.config.sysctls(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("sysctls() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
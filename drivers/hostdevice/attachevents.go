@@ -0,0 +1,25 @@
+package main
+
+import (
+	"github.com/containerd/nri/pkg/api"
+	v1 "k8s.io/api/core/v1"
+)
+
+const (
+	// attachFailedReason is the reason of the events of the devices that
+	// could not be attached to the pod.
+	attachFailedReason = "NetworkDeviceAttachFailed"
+	// attachedReason is the reason of the events of the devices attached to
+	// the pod.
+	attachedReason = "NetworkDeviceAttached"
+)
+
+// recordAttach emits an event on the pod with the outcome of the attachment
+// of the device, so the pod owner sees it in kubectl describe pod.
+func (k *NetworkDriver) recordAttach(pod *api.PodSandbox, device PreparedDevice, err error) {
+	if err != nil {
+		k.recordPodEvent(pod, v1.EventTypeWarning, attachFailedReason, "Node %s: failed to attach device %s: %v", k.nodeName, device.DeviceName, err)
+		return
+	}
+	k.recordPodEvent(pod, v1.EventTypeNormal, attachedReason, "Node %s: device %s attached as %s", k.nodeName, device.DeviceName, device.podInterface())
+}
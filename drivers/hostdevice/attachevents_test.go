@@ -0,0 +1,57 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/vishvananda/netlink"
+	resourceapi "k8s.io/api/resource/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+
+	kndnet "github.com/aojea/kubernetes-network-drivers/pkg/net"
+)
+
+func Test_configureDeviceForPod_events(t *testing.T) {
+	tests := []struct {
+		name      string
+		attachErr error
+		wantEvent string
+	}{
+		{
+			name:      "attached",
+			wantEvent: "Normal NetworkDeviceAttached Node node1: device eth1 attached as net1",
+		},
+		{
+			name:      "attach failed",
+			attachErr: errors.New("device busy"),
+			wantEvent: "Warning NetworkDeviceAttachFailed Node node1: failed to attach device eth1: device busy",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k := NewNetworkDriver(driverName, "node1", fake.NewClientset())
+			k.host.attachNetdev = func(hostIfName string, containerNsPath string, newAttr netlink.LinkAttrs, addresses []*net.IPNet, opts ...kndnet.AttachOption) (*resourceapi.NetworkDeviceData, error) {
+				return nil, tt.attachErr
+			}
+
+			recorder := record.NewFakeRecorder(10)
+			k.eventRecorder = recorder
+			device := PreparedDevice{DeviceName: "eth1", Config: DeviceConfig{InterfaceName: "net1"}}
+			err := k.configureDeviceForPod(AllocatedDevice{Name: "eth1"}, "/run/netns/pod", newTestSandbox("/run/netns/pod"), device)
+			if !errors.Is(err, tt.attachErr) {
+				t.Fatalf("expected error %v, got %v", tt.attachErr, err)
+			}
+
+			var event string
+			select {
+			case event = <-recorder.Events:
+			default:
+			}
+			if event != tt.wantEvent {
+				t.Errorf("expected event %q, got %q", tt.wantEvent, event)
+			}
+		})
+	}
+}
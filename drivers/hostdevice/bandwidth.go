@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/containerd/nri/pkg/api"
+	"github.com/prometheus/client_golang/prometheus"
+	v1 "k8s.io/api/core/v1"
+	resourceapi "k8s.io/api/resource/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+)
+
+// bandwidthExceededReason is the reason of the events of the claims denied
+// because they would oversubscribe the bandwidth of a device.
+const bandwidthExceededReason = "BandwidthOversubscribed"
+
+var (
+	committedBandwidth = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "knd_committed_bandwidth_bits_per_second",
+		Help: "Sum of the egress rates of the devices prepared for the pods per physical device.",
+	}, []string{"device"})
+	bandwidthCapacity = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "knd_bandwidth_capacity_bits_per_second",
+		Help: "Link speed of the physical devices with committed bandwidth.",
+	}, []string{"device"})
+)
+
+func init() {
+	prometheus.MustRegister(committedBandwidth)
+	prometheus.MustRegister(bandwidthCapacity)
+}
+
+// egressRate returns the egress rate of the device in the pod, the one of
+// the device configuration or else the default of the pod QoS class.
+func (k *NetworkDriver) egressRate(device PreparedDevice, pod *api.PodSandbox) *resource.Quantity {
+	if device.Config.EgressRate != nil {
+		return device.Config.EgressRate
+	}
+	if defaults, ok := k.qosDefaults[podQOSClass(pod)]; ok {
+		return defaults.EgressRate
+	}
+	return nil
+}
+
+// bandwidthDevice returns the physical device whose bandwidth the device
+// shares, the parent of a macvlan slot or the allocated device of a virtual
+// function or a child interface.
+func (d PreparedDevice) bandwidthDevice() string {
+	if d.MacvlanParent != "" {
+		return d.MacvlanParent
+	}
+	return d.DeviceName
+}
+
+// committedEgressRate returns the egress rate the device commits, the one
+// applied when it was attached to the pod, the default of the pod QoS class
+// included, or else the one of its configuration.
+func (d PreparedDevice) committedEgressRate() *resource.Quantity {
+	if d.EgressRate != nil {
+		return d.EgressRate
+	}
+	return d.Config.EgressRate
+}
+
+// deviceBandwidth returns the egress rates in bits per second committed by
+// the prepared devices per physical device. The claim with the given UID and
+// the devices returned by a pod stop are not included. The accounting is
+// derived from the prepared data, so it is persisted with it in the
+// checkpoint. The caller must hold k.mu.
+func (k *NetworkDriver) deviceBandwidth(claimUID types.UID) map[string]int64 {
+	committed := map[string]int64{}
+	for uid, devices := range k.sharedState.PreparedData {
+		if uid == claimUID {
+			continue
+		}
+		for _, device := range devices {
+			rate := device.committedEgressRate()
+			if rate == nil || device.State == DeviceStateDetached {
+				continue
+			}
+			committed[device.bandwidthDevice()] += rate.Value()
+		}
+	}
+	return committed
+}
+
+// checkBandwidth returns an error if preparing the devices of the claim would
+// commit more than the oversubscription factor times the link speed of a
+// physical device. Devices with an unknown speed are not limited. The QoS
+// class defaults are only known once the pod runs, they are committed then.
+// The caller must hold k.mu.
+func (k *NetworkDriver) checkBandwidth(claim *resourceapi.ResourceClaim, devices []PreparedDevice) error {
+	if k.bandwidthOversubscription <= 0 {
+		return nil
+	}
+	requested := map[string]int64{}
+	for _, device := range devices {
+		if device.Config.EgressRate != nil {
+			requested[device.bandwidthDevice()] += device.Config.EgressRate.Value()
+		}
+	}
+	if len(requested) == 0 {
+		return nil
+	}
+	committed := k.deviceBandwidth(claim.UID)
+	names := make([]string, 0, len(requested))
+	for name := range requested {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		speed, err := k.host.linkSpeed(name)
+		if err != nil || speed <= 0 {
+			klog.V(2).Infof("Speed of device %s unknown, not limiting its bandwidth: %v", name, err)
+			continue
+		}
+		limit := float64(speed) * 1e6 * k.bandwidthOversubscription
+		if float64(committed[name]+requested[name]) > limit {
+			return fmt.Errorf("device %s bandwidth oversubscribed: %s committed, claim %s requests %s, limit %s (%d Mbps x %g)",
+				name, bitsPerSecond(committed[name]), claim.Name, bitsPerSecond(requested[name]), bitsPerSecond(int64(limit)), speed, k.bandwidthOversubscription)
+		}
+	}
+	return nil
+}
+
+// bitsPerSecond formats a rate with the quantity notation of the configuration.
+func bitsPerSecond(rate int64) string {
+	return resource.NewQuantity(rate, resource.DecimalSI).String()
+}
+
+// updateBandwidthMetrics recomputes the committed bandwidth and the capacity
+// of the physical devices. The caller must hold k.mu.
+func (k *NetworkDriver) updateBandwidthMetrics() {
+	committedBandwidth.Reset()
+	bandwidthCapacity.Reset()
+	for name, rate := range k.deviceBandwidth("") {
+		committedBandwidth.WithLabelValues(name).Set(float64(rate))
+		if speed, err := k.host.linkSpeed(name); err == nil && speed > 0 {
+			bandwidthCapacity.WithLabelValues(name).Set(float64(speed) * 1e6)
+		}
+	}
+}
+
+// recordBandwidthExceeded emits a warning event on the claim denied by the bandwidth limit.
+func (k *NetworkDriver) recordBandwidthExceeded(claim *resourceapi.ResourceClaim, err error) {
+	if k.eventRecorder == nil {
+		return
+	}
+	k.eventRecorder.Eventf(claim, v1.EventTypeWarning, bandwidthExceededReason, "Node %s: %v", k.nodeName, err)
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/containerd/nri/pkg/api"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	v1 "k8s.io/api/core/v1"
+	resourceapi "k8s.io/api/resource/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/dynamic-resource-allocation/kubeletplugin"
+)
+
+func Test_checkBandwidth(t *testing.T) {
+	k := NewNetworkDriver(driverName, "node1", fake.NewClientset())
+	k.host.linkSpeed = func(ifName string) (int, error) {
+		if ifName == "eth1" {
+			return 1000, nil
+		}
+		return -1, fmt.Errorf("no speed for %s", ifName)
+	}
+
+	k.checkpointPath = ""
+	k.bandwidthOversubscription = 1.5
+	recorder := record.NewFakeRecorder(10)
+	k.eventRecorder = recorder
+
+	prepare := func(name, rate string) error {
+		t.Helper()
+		claim := newClaimWithConfig(opaqueConfig(driverName, nil, `{"egressRate":"`+rate+`"}`))
+		claim.Namespace = "default"
+		claim.Name = name
+		claim.UID = types.UID(name)
+		results, err := k.PrepareResourceClaims(context.Background(), []*resourceapi.ResourceClaim{claim})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return results[claim.UID].Err
+	}
+
+	if err := prepare("first", "1G"); err != nil {
+		t.Fatalf("unexpected error preparing the first claim: %v", err)
+	}
+	// preparing the same claim again does not commit its rate twice
+	if err := prepare("first", "1G"); err != nil {
+		t.Fatalf("unexpected error preparing the first claim again: %v", err)
+	}
+	if err := prepare("second", "600M"); err == nil {
+		t.Fatalf("expected the second claim to oversubscribe the device")
+	}
+	if _, ok := k.sharedState.PreparedData["second"]; ok {
+		t.Errorf("denied claim must not be prepared")
+	}
+	select {
+	case event := <-recorder.Events:
+		if !strings.Contains(event, bandwidthExceededReason) {
+			t.Errorf("unexpected event %q", event)
+		}
+	default:
+		t.Errorf("expected a %s event", bandwidthExceededReason)
+	}
+	if err := prepare("second", "500M"); err != nil {
+		t.Fatalf("unexpected error preparing up to the limit: %v", err)
+	}
+
+	k.mu.Lock()
+	k.updateDeviceStateMetrics()
+	k.mu.Unlock()
+	if got := testutil.ToFloat64(committedBandwidth.WithLabelValues("eth1")); got != 1.5e9 {
+		t.Errorf("expected 1.5e9 bps committed, got %g", got)
+	}
+	if got := testutil.ToFloat64(bandwidthCapacity.WithLabelValues("eth1")); got != 1e9 {
+		t.Errorf("expected 1e9 bps capacity, got %g", got)
+	}
+
+	// the devices returned to the host do not commit bandwidth
+	k.mu.Lock()
+	k.sharedState.PreparedData["second"][0].State = DeviceStateDetached
+	k.mu.Unlock()
+	if err := prepare("third", "500M"); err != nil {
+		t.Fatalf("unexpected error after detaching the second claim: %v", err)
+	}
+
+	// releasing a claim frees its bandwidth
+	if _, err := k.UnprepareResourceClaims(context.Background(), []kubeletplugin.NamespacedObject{{UID: "first"}}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := prepare("fourth", "1G"); err != nil {
+		t.Fatalf("unexpected error after releasing the first claim: %v", err)
+	}
+
+	// devices with an unknown speed are not limited
+	k.host.linkSpeed = func(string) (int, error) { return -1, fmt.Errorf("unknown") }
+	if err := prepare("fifth", "100G"); err != nil {
+		t.Fatalf("unexpected error with an unknown speed: %v", err)
+	}
+}
+
+func Test_checkBandwidthMacvlanSlots(t *testing.T) {
+	k := NewNetworkDriver(driverName, "node1", fake.NewClientset())
+	k.host.linkSpeed = func(ifName string) (int, error) {
+		if ifName == "eth1" {
+			return 1000, nil
+		}
+		return -1, fmt.Errorf("no speed for %s", ifName)
+	}
+
+	k.checkpointPath = ""
+	k.bandwidthOversubscription = 1
+	slot := func(name, rate string) PreparedDevice {
+		quantity := resource.MustParse(rate)
+		return PreparedDevice{DeviceName: name, MacvlanParent: "eth1", Config: DeviceConfig{EgressRate: &quantity}}
+	}
+	k.sharedState.PreparedData["first"] = []PreparedDevice{slot("eth1-mvlan0", "600M")}
+
+	claim := &resourceapi.ResourceClaim{ObjectMeta: metav1.ObjectMeta{Name: "second", UID: "second"}}
+	// the slots share the speed of their parent
+	if err := k.checkBandwidth(claim, []PreparedDevice{slot("eth1-mvlan1", "500M")}); err == nil {
+		t.Errorf("expected the second slot to oversubscribe the parent")
+	}
+	if err := k.checkBandwidth(claim, []PreparedDevice{slot("eth1-mvlan1", "400M")}); err != nil {
+		t.Errorf("unexpected error up to the speed of the parent: %v", err)
+	}
+
+	k.mu.Lock()
+	k.updateBandwidthMetrics()
+	k.mu.Unlock()
+	if got := testutil.ToFloat64(committedBandwidth.WithLabelValues("eth1")); got != 6e8 {
+		t.Errorf("expected 6e8 bps committed on the parent, got %g", got)
+	}
+}
+
+func Test_deviceBandwidthQoSDefaults(t *testing.T) {
+	k := NewNetworkDriver(driverName, "node1", fake.NewClientset())
+	k.checkpointPath = ""
+	defaultRate, configRate := resource.MustParse("100M"), resource.MustParse("1G")
+	k.qosDefaults = map[v1.PodQOSClass]QoSDefaults{v1.PodQOSBestEffort: {EgressRate: &defaultRate}}
+	pod := &api.PodSandbox{Linux: &api.LinuxPodSandbox{CgroupParent: "/kubepods/besteffort/pod1"}}
+
+	devices := []PreparedDevice{
+		{DeviceName: "eth1"},
+		{DeviceName: "eth2", Config: DeviceConfig{EgressRate: &configRate}},
+	}
+	// the default of the QoS class is only known once the pod runs
+	k.sharedState.PreparedData["claim"] = devices
+	if got := k.deviceBandwidth(""); got["eth1"] != 0 || got["eth2"] != 1e9 {
+		t.Errorf("unexpected bandwidth before the pod runs: %v", got)
+	}
+	for i := range devices {
+		devices[i].EgressRate = k.egressRate(devices[i], pod)
+	}
+	if got := k.deviceBandwidth(""); got["eth1"] != 1e8 || got["eth2"] != 1e9 {
+		t.Errorf("unexpected bandwidth once the pod runs: %v", got)
+	}
+}
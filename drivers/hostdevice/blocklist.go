@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"net"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+)
+
+// deviceBlocklistAnnotation is the node annotation with the comma separated
+// names or MAC addresses of the interfaces that must never be published.
+const deviceBlocklistAnnotation = "hostdevice.k8s.io/device-blocklist"
+
+// parseBlocklist returns the interface names and the normalized MAC
+// addresses of the blocklist, and the entries that look like invalid MACs.
+func parseBlocklist(value string) (sets.Set[string], []string) {
+	blocklist := sets.New[string]()
+	var invalid []string
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		// interface names cannot contain colons
+		if strings.Contains(entry, ":") {
+			mac, err := net.ParseMAC(entry)
+			if err != nil {
+				invalid = append(invalid, entry)
+				continue
+			}
+			entry = mac.String()
+		}
+		blocklist.Insert(entry)
+	}
+	return blocklist, invalid
+}
+
+// isBlocked returns true if the interface is in the node blocklist.
+func (k *NetworkDriver) isBlocked(name string, mac string) bool {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return k.blocklist.Has(name) || (mac != "" && k.blocklist.Has(mac))
+}
+
+// setBlocklist updates the blocklist from the node annotation and requests
+// a new publication if it changed.
+func (k *NetworkDriver) setBlocklist(node *v1.Node) {
+	blocklist, invalid := parseBlocklist(node.Annotations[deviceBlocklistAnnotation])
+	if len(invalid) > 0 {
+		klog.Warningf("Ignoring invalid entries %v in the %s annotation of node %s", invalid, deviceBlocklistAnnotation, node.Name)
+	}
+	k.mu.Lock()
+	changed := !blocklist.Equal(k.blocklist)
+	k.blocklist = blocklist
+	k.mu.Unlock()
+	if !changed {
+		return
+	}
+	klog.Infof("Device blocklist of node %s changed to %v", node.Name, sets.List(blocklist))
+	k.logUnknownBlocklistEntries(blocklist)
+	k.requestRepublish()
+}
+
+// logUnknownBlocklistEntries logs the entries that do not match any interface.
+func (k *NetworkDriver) logUnknownBlocklistEntries(blocklist sets.Set[string]) {
+	interfaces, err := net.Interfaces()
+	if err != nil {
+		return
+	}
+	known := sets.New[string]()
+	for _, iface := range interfaces {
+		known.Insert(iface.Name)
+		if len(iface.HardwareAddr) > 0 {
+			known.Insert(iface.HardwareAddr.String())
+		}
+	}
+	if unknown := blocklist.Difference(known); unknown.Len() > 0 {
+		klog.Warningf("Device blocklist entries %v do not match any interface", sets.List(unknown))
+	}
+}
+
+// watchNodeBlocklist keeps the blocklist in sync with the node annotation.
+func (k *NetworkDriver) watchNodeBlocklist(ctx context.Context) error {
+	factory := informers.NewSharedInformerFactoryWithOptions(k.kubeClient, 0,
+		informers.WithTweakListOptions(func(options *metav1.ListOptions) {
+			options.FieldSelector = fields.OneTermEqualSelector("metadata.name", k.nodeName).String()
+		}))
+	nodeInformer := factory.Core().V1().Nodes().Informer()
+	_, err := nodeInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			if node, ok := obj.(*v1.Node); ok && node.Name == k.nodeName {
+				k.setBlocklist(node)
+			}
+		},
+		UpdateFunc: func(_, obj interface{}) {
+			if node, ok := obj.(*v1.Node); ok && node.Name == k.nodeName {
+				k.setBlocklist(node)
+			}
+		},
+	})
+	if err != nil {
+		return err
+	}
+	factory.Start(ctx.Done())
+	return nil
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func Test_parseBlocklist(t *testing.T) {
+	blocklist, invalid := parseBlocklist(" eth1, AA:BB:CC:DD:EE:FF,,eth2 ,zz:zz")
+	if want := sets.New("eth1", "eth2", "aa:bb:cc:dd:ee:ff"); !blocklist.Equal(want) {
+		t.Errorf("parseBlocklist() = %v, want %v", sets.List(blocklist), sets.List(want))
+	}
+	if len(invalid) != 1 || invalid[0] != "zz:zz" {
+		t.Errorf("expected invalid entry zz:zz, got %v", invalid)
+	}
+}
+
+func Test_watchNodeBlocklist(t *testing.T) {
+	node := &v1.Node{ObjectMeta: metav1.ObjectMeta{
+		Name:        "node1",
+		Annotations: map[string]string{deviceBlocklistAnnotation: "eth1"},
+	}}
+	client := fake.NewClientset(node)
+	k := NewNetworkDriver(driverName, "node1", client)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := k.watchNodeBlocklist(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	waitForRepublish := func() {
+		t.Helper()
+		select {
+		case <-k.republish:
+		case <-time.After(wait.ForeverTestTimeout):
+			t.Fatalf("expected a publication after the blocklist changed")
+		}
+	}
+	waitForRepublish()
+	if !k.isBlocked("eth1", "") || k.isBlocked("eth2", "aa:bb:cc:dd:ee:ff") {
+		t.Errorf("unexpected blocklist %v", sets.List(k.blocklist))
+	}
+
+	node = node.DeepCopy()
+	node.Annotations[deviceBlocklistAnnotation] = "aa:bb:cc:dd:ee:ff"
+	if _, err := client.CoreV1().Nodes().Update(ctx, node, metav1.UpdateOptions{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	waitForRepublish()
+	if k.isBlocked("eth1", "") || !k.isBlocked("eth2", "aa:bb:cc:dd:ee:ff") {
+		t.Errorf("unexpected blocklist %v", sets.List(k.blocklist))
+	}
+}
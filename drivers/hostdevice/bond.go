@@ -0,0 +1,220 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"time"
+
+	"github.com/containerd/nri/pkg/api"
+	"github.com/vishvananda/netlink"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+
+	kndnet "github.com/aojea/kubernetes-network-drivers/pkg/net"
+)
+
+const (
+	// defaultBondName is the name of the bond in the pod if none is configured.
+	defaultBondName = "bond0"
+	// defaultBondMode is the bonding mode if none is configured.
+	defaultBondMode = "802.3ad"
+)
+
+// BondConfig bonds devices of the claim in the pod, for redundancy.
+type BondConfig struct {
+	// Name is the name of the bond interface in the pod, bond0 by default.
+	Name string `json:"name,omitempty"`
+	// Mode is the bonding mode, e.g. active-backup, 802.3ad by default.
+	Mode string `json:"mode,omitempty"`
+	// Members are the allocated devices of the claim enslaved to the bond.
+	Members []string `json:"members"`
+}
+
+// name returns the name of the bond interface in the pod.
+func (c BondConfig) name() string {
+	if c.Name != "" {
+		return c.Name
+	}
+	return defaultBondName
+}
+
+// mode returns the bonding mode of the bond.
+func (c BondConfig) mode() netlink.BondMode {
+	if c.Mode != "" {
+		return netlink.StringToBondMode(c.Mode)
+	}
+	return netlink.StringToBondMode(defaultBondMode)
+}
+
+func (c BondConfig) validate() error {
+	if c.Name != "" && !validInterfaceName(c.Name) {
+		return fmt.Errorf("invalid name %q", c.Name)
+	}
+	if c.mode() == netlink.BOND_MODE_UNKNOWN {
+		return fmt.Errorf("invalid mode %q, must be balance-rr, active-backup, balance-xor, broadcast, 802.3ad, balance-tlb or balance-alb", c.Mode)
+	}
+	if len(c.Members) < 2 {
+		return fmt.Errorf("a bond needs at least 2 members, got %d", len(c.Members))
+	}
+	for i, member := range c.Members {
+		if !validInterfaceName(member) {
+			return fmt.Errorf("invalid member %q", member)
+		}
+		if slices.Contains(c.Members[:i], member) {
+			return fmt.Errorf("duplicate member %s", member)
+		}
+	}
+	return nil
+}
+
+// interfaceSettings returns the settings of the configuration that apply to a
+// single interface, a bond or a bridge is only configured with the ips and
+// the routes.
+func (c DeviceConfig) interfaceSettings() []string {
+	var names []string
+	for _, setting := range []struct {
+		name string
+		set  bool
+	}{
+		{"bringUpContainer", c.BringUpContainer != ""},
+		{"interfaceName", c.InterfaceName != ""},
+		{"readinessPath", c.ReadinessPath != ""},
+		{"policyRouting", c.PolicyRouting != nil},
+		{"network", c.Network != nil},
+		{"child", c.childType() != ""},
+		{"ipv6Privacy", c.IPv6Privacy != nil},
+		{"arp", c.ARP != nil},
+		{"hopLimit", c.HopLimit != 0},
+		{"sysctls", len(c.Sysctls) > 0},
+		{"permanentMAC", c.PermanentMAC},
+		{"hardwareTimestamping", c.HardwareTimestamping != nil},
+		{"ethtool", c.Ethtool != nil},
+		{"multicast", c.Multicast != nil},
+		{"ssm", c.SSM != nil},
+		{"mtu", c.MTU != 0},
+		{"clampMTU", c.ClampMTU},
+		{"drain", c.Drain != nil},
+	} {
+		if setting.set {
+			names = append(names, setting.name)
+		}
+	}
+	return names
+}
+
+// checkBonds returns an error if the members of a bond are not all devices of
+// the claim with the same bond, the bond is created with all of them.
+func checkBonds(devices []PreparedDevice) error {
+	seen := map[string]*BondConfig{}
+	for _, device := range devices {
+		bond := device.Config.Bond
+		if bond == nil {
+			continue
+		}
+		if !slices.Contains(bond.Members, device.DeviceName) {
+			return fmt.Errorf("device %s is not a member of bond %s", device.DeviceName, bond.name())
+		}
+		if other, ok := seen[bond.name()]; ok && !reflect.DeepEqual(other, bond) {
+			return fmt.Errorf("bonds with members %v and %v have the same name %s", other.Members, bond.Members, bond.name())
+		}
+		seen[bond.name()] = bond
+		for _, member := range bond.Members {
+			if _, ok := findPreparedDevice(devices, member); !ok {
+				return fmt.Errorf("member %s of bond %s is not allocated to the claim", member, bond.name())
+			}
+		}
+	}
+	return nil
+}
+
+// bondHostInterfaces returns the host interfaces of the members of the bond.
+func bondHostInterfaces(preparedData []PreparedDevice, bond BondConfig) []string {
+	names := make([]string, 0, len(bond.Members))
+	for _, member := range bond.Members {
+		device, _ := findPreparedDevice(preparedData, member)
+		names = append(names, device.hostInterface())
+	}
+	return names
+}
+
+// configureBondForPod moves the members of the bond into the pod's namespace
+// and bonds them there with the ips and the routes of the configuration.
+func (k *NetworkDriver) configureBondForPod(networkNamespace string, podSandbox *api.PodSandbox, preparedData []PreparedDevice, bond BondConfig) (err error) {
+	start := time.Now()
+	defer func() {
+		for _, member := range bond.Members {
+			device, _ := findPreparedDevice(preparedData, member)
+			k.observeAttach(device, start, err)
+			k.recordAttach(podSandbox, device, err)
+		}
+	}()
+	// the configuration is the same for all the members
+	config, _ := findPreparedDevice(preparedData, bond.Members[0])
+	members := bondHostInterfaces(preparedData, bond)
+	bondName := bond.name()
+
+	klog.Infof("Moving devices %v to pod %s/%s network namespace %s as bond %q",
+		members, podSandbox.Namespace, podSandbox.Name, networkNamespace, bondName)
+	if len(config.Addresses) > 0 {
+		klog.Infof("Setting addresses %v on bond %q", config.Addresses, bondName)
+	}
+	opts := []kndnet.AttachOption{
+		kndnet.WithLinkUpRetries(k.linkUpRetries),
+		kndnet.WithNamespaceRetries(k.namespaceRetries),
+		kndnet.WithOwner(k.driverName),
+		kndnet.WithDADTimeout(k.dadTimeout),
+		kndnet.WithBondMode(bond.mode()),
+	}
+	if err := k.host.attachBond(networkNamespace, members, netlink.LinkAttrs{Name: bondName}, config.Addresses, opts...); err != nil {
+		return err
+	}
+	if err := kndnet.NsAddRoutes(networkNamespace, bondName, config.Config.Routes); err != nil {
+		return err
+	}
+	if rate := k.egressRate(config, podSandbox); rate != nil {
+		klog.Infof("Limiting egress rate of bond %q in %s pod %s/%s to %s bps",
+			bondName, podQOSClass(podSandbox), podSandbox.Namespace, podSandbox.Name, rate.String())
+		if err := kndnet.NsSetEgressRateLimit(networkNamespace, bondName, uint64(rate.Value())); err != nil {
+			return err
+		}
+	}
+	for _, member := range bond.Members {
+		k.deviceErrors.reset(types.UID(podSandbox.Uid), member)
+	}
+	return nil
+}
+
+// cleanupBondForPod releases the members of the bond and moves them back to
+// the host namespace, the bond is deleted.
+func (k *NetworkDriver) cleanupBondForPod(networkNamespace string, podSandbox *api.PodSandbox, devices []AllocatedDevice, preparedData []PreparedDevice, bond BondConfig) (err error) {
+	start := time.Now()
+	defer func() {
+		for _, member := range bond.Members {
+			device, _ := findPreparedDevice(preparedData, member)
+			k.observeDetach(device, start, err)
+		}
+	}()
+	members := bondHostInterfaces(preparedData, bond)
+	klog.Infof("Moving devices %v of bond %q from pod %s/%s back to host namespace",
+		members, bond.name(), podSandbox.Namespace, podSandbox.Name)
+
+	err = k.host.detachBond(networkNamespace, bond.name(), members, kndnet.WithDetachNamespaceRetries(k.namespaceRetries))
+	if errors.Is(err, kndnet.ErrNamespaceGone) {
+		// the kernel deleted the bond and returned the members to the host
+		klog.Infof("Network namespace %s of pod %s/%s is gone, recovering devices %v on the host",
+			networkNamespace, podSandbox.Namespace, podSandbox.Name, members)
+		for i, member := range bond.Members {
+			device := AllocatedDevice{Name: member}
+			if j := slices.IndexFunc(devices, func(d AllocatedDevice) bool { return d.Name == member }); j >= 0 {
+				device = devices[j]
+			}
+			if err := k.restoreDevice(device, members[i]); err != nil {
+				klog.Warningf("Device %q of pod %s/%s not recovered on the host: %v", members[i], podSandbox.Namespace, podSandbox.Name, err)
+			}
+		}
+		return nil
+	}
+	return err
+}
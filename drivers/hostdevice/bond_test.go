@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/vishvananda/netlink"
+	resourceapi "k8s.io/api/resource/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	kndnet "github.com/aojea/kubernetes-network-drivers/pkg/net"
+)
+
+func Test_parseDeviceConfig_bond(t *testing.T) {
+	tests := []struct {
+		name    string
+		params  string
+		want    *BondConfig
+		wantErr string
+	}{
+		{
+			name:   "default name and mode",
+			params: `{"bond":{"members":["eth1","eth2"]},"ips":["192.168.5.10/24"]}`,
+			want:   &BondConfig{Members: []string{"eth1", "eth2"}},
+		},
+		{
+			name:   "active backup",
+			params: `{"bond":{"name":"ha0","mode":"active-backup","members":["eth1","eth2"]}}`,
+			want:   &BondConfig{Name: "ha0", Mode: "active-backup", Members: []string{"eth1", "eth2"}},
+		},
+		{
+			name:    "invalid mode",
+			params:  `{"bond":{"mode":"lacp","members":["eth1","eth2"]}}`,
+			wantErr: "invalid mode",
+		},
+		{
+			name:    "single member",
+			params:  `{"bond":{"members":["eth1"]}}`,
+			wantErr: "at least 2 members",
+		},
+		{
+			name:    "duplicate member",
+			params:  `{"bond":{"members":["eth1","eth1"]}}`,
+			wantErr: "duplicate member",
+		},
+		{
+			name:    "interface settings",
+			params:  `{"bond":{"members":["eth1","eth2"]},"interfaceName":"net1","mtu":9000}`,
+			wantErr: "bond and interfaceName, mtu are mutually exclusive",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := parseDeviceConfig(driverName, newClaimWithConfig(opaqueConfig(driverName, nil, tt.params)), "nic")
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(config.Bond, tt.want) {
+				t.Errorf("expected bond %+v, got %+v", tt.want, config.Bond)
+			}
+		})
+	}
+}
+
+func Test_PrepareResourceClaims_bond(t *testing.T) {
+	k := NewNetworkDriver(driverName, "node1", fake.NewClientset())
+	k.checkpointPath = ""
+	bond := opaqueConfig(driverName, nil, `{"bond":{"members":["eth1","eth2"]}}`)
+
+	claim := newClaimWithDevices("bond-uid", "eth1", "eth2")
+	claim.Status.Allocation.Devices.Config = []resourceapi.DeviceAllocationConfiguration{bond}
+	results, err := k.PrepareResourceClaims(context.Background(), []*resourceapi.ResourceClaim{claim})
+	if err != nil || results[claim.UID].Err != nil {
+		t.Fatalf("unexpected error: %v %v", err, results[claim.UID].Err)
+	}
+
+	// all the members must be allocated to the claim, and only them
+	for _, devices := range [][]string{{"eth1"}, {"eth1", "eth2", "eth3"}} {
+		claim := newClaimWithDevices("partial-uid", devices...)
+		claim.Status.Allocation.Devices.Config = []resourceapi.DeviceAllocationConfiguration{bond}
+		results, err := k.PrepareResourceClaims(context.Background(), []*resourceapi.ResourceClaim{claim})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if err := results[claim.UID].Err; err == nil || !strings.Contains(err.Error(), "bond0") {
+			t.Errorf("expected the bond of devices %v to fail, got %v", devices, err)
+		}
+	}
+}
+
+func Test_RunPodSandbox_bond(t *testing.T) {
+	var steps []string
+	k := NewNetworkDriver(driverName, "node1", fake.NewClientset())
+	k.host.attachBond = func(containerNsPath string, members []string, bondAttr netlink.LinkAttrs, addresses []*net.IPNet, opts ...kndnet.AttachOption) error {
+		steps = append(steps, fmt.Sprintf("attach %v as %s with %v", members, bondAttr.Name, addresses))
+		return nil
+	}
+	k.host.detachBond = func(containerNsPath string, bondName string, members []string, opts ...kndnet.DetachOption) error {
+		steps = append(steps, fmt.Sprintf("detach %v from %s", members, bondName))
+		return nil
+	}
+
+	k.checkpointPath = ""
+	k.detachVerifyTimeout = 0
+	addresses, _ := parseIPs([]string{"192.168.5.10/24"})
+	bond := &BondConfig{Members: []string{"eth1", "eth2"}}
+	k.sharedState.PodDeviceConfig["pod-uid"] = []AllocatedDevice{{Name: "eth2"}, {Name: "eth1"}}
+	k.sharedState.PreparedData["pod-uid"] = []PreparedDevice{
+		{DeviceName: "eth1", Addresses: addresses, Config: DeviceConfig{Bond: bond}},
+		{DeviceName: "eth2", Addresses: addresses, Config: DeviceConfig{Bond: bond}},
+	}
+
+	if err := k.RunPodSandbox(context.Background(), newTestSandbox("/run/netns/pod")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, device := range k.sharedState.PreparedData["pod-uid"] {
+		if device.State != DeviceStateAttached {
+			t.Errorf("expected device %s attached, got %s", device.DeviceName, device.State)
+		}
+	}
+	if err := k.StopPodSandbox(context.Background(), newTestSandbox("/run/netns/pod")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// the members are attached and detached together, once
+	want := []string{
+		"attach [eth1 eth2] as bond0 with [192.168.5.10/24]",
+		"detach [eth1 eth2] from bond0",
+	}
+	if !reflect.DeepEqual(steps, want) {
+		t.Errorf("expected %v, got %v", want, steps)
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"errors"
+
+	"github.com/containerd/nri/pkg/api"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+
+	kndnet "github.com/aojea/kubernetes-network-drivers/pkg/net"
+)
+
+// defaultBridgeName is the name of the bridge in the pod if none is configured.
+const defaultBridgeName = "br0"
+
+// bridgeName returns the name of the bridge in the pod of the bridge mode.
+func (c DeviceConfig) bridgeName() string {
+	if c.BridgeName != "" {
+		return c.BridgeName
+	}
+	return defaultBridgeName
+}
+
+// configureBridgeForPod moves the device into the pod's namespace and
+// enslaves it to the bridge there, configured with the ips and the routes.
+func (k *NetworkDriver) configureBridgeForPod(device AllocatedDevice, networkNamespace string, podSandbox *api.PodSandbox, preparedData PreparedDevice) error {
+	hostDeviceName := preparedData.hostInterface()
+	bridgeName := preparedData.Config.bridgeName()
+
+	klog.Infof("Moving device %q to pod %s/%s network namespace %s on bridge %q",
+		hostDeviceName, podSandbox.Namespace, podSandbox.Name, networkNamespace, bridgeName)
+	if len(preparedData.Addresses) > 0 {
+		klog.Infof("Setting addresses %v on bridge %q", preparedData.Addresses, bridgeName)
+	}
+	opts := []kndnet.AttachOption{
+		kndnet.WithLinkUpRetries(k.linkUpRetries),
+		kndnet.WithNamespaceRetries(k.namespaceRetries),
+		kndnet.WithOwner(k.driverName),
+		kndnet.WithDADTimeout(k.dadTimeout),
+	}
+	if err := k.host.attachBridge(networkNamespace, hostDeviceName, bridgeName, preparedData.Addresses, opts...); err != nil {
+		return err
+	}
+	if err := kndnet.NsAddRoutes(networkNamespace, bridgeName, preparedData.Config.Routes); err != nil {
+		return err
+	}
+	// the traffic bridged between the ports in the pod is not limited
+	if rate := k.egressRate(preparedData, podSandbox); rate != nil {
+		klog.Infof("Limiting egress rate of device %q in %s pod %s/%s to %s bps",
+			hostDeviceName, podQOSClass(podSandbox), podSandbox.Namespace, podSandbox.Name, rate.String())
+		if err := kndnet.NsSetEgressRateLimit(networkNamespace, hostDeviceName, uint64(rate.Value())); err != nil {
+			return err
+		}
+	}
+	k.deviceErrors.reset(types.UID(podSandbox.Uid), device.Name)
+	return nil
+}
+
+// cleanupBridgeForPod removes the device from the bridge and moves it back to
+// the host namespace, the bridge is deleted once it has no ports.
+func (k *NetworkDriver) cleanupBridgeForPod(device AllocatedDevice, networkNamespace string, podSandbox *api.PodSandbox, preparedData PreparedDevice) error {
+	hostDeviceName := preparedData.hostInterface()
+	bridgeName := preparedData.Config.bridgeName()
+
+	err := k.host.detachBridge(networkNamespace, hostDeviceName, bridgeName, kndnet.WithDetachNamespaceRetries(k.namespaceRetries))
+	if errors.Is(err, kndnet.ErrNamespaceGone) {
+		// the kernel deleted the bridge and returned the device to the host
+		klog.Infof("Network namespace %s of pod %s/%s is gone, recovering device %q on the host",
+			networkNamespace, podSandbox.Namespace, podSandbox.Name, hostDeviceName)
+		if err := k.restoreDevice(device, hostDeviceName); err != nil {
+			klog.Warningf("Device %q of pod %s/%s not recovered on the host: %v", hostDeviceName, podSandbox.Namespace, podSandbox.Name, err)
+		}
+		return nil
+	}
+	return err
+}
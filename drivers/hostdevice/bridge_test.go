@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+
+	"k8s.io/client-go/kubernetes/fake"
+
+	kndnet "github.com/aojea/kubernetes-network-drivers/pkg/net"
+)
+
+func Test_parseDeviceConfig_bridge(t *testing.T) {
+	tests := []struct {
+		name       string
+		params     string
+		wantBridge string
+		wantErr    string
+	}{
+		{
+			name:       "default bridge name",
+			params:     `{"mode":"bridge","ips":["192.168.5.10/24"]}`,
+			wantBridge: "br0",
+		},
+		{
+			name:       "bridge name",
+			params:     `{"mode":"bridge","bridgeName":"uplink0"}`,
+			wantBridge: "uplink0",
+		},
+		{
+			name:    "bridge name without mode",
+			params:  `{"bridgeName":"uplink0"}`,
+			wantErr: "bridgeName requires mode bridge",
+		},
+		{
+			name:    "invalid bridge name",
+			params:  `{"mode":"bridge","bridgeName":"a/b"}`,
+			wantErr: "invalid bridgeName",
+		},
+		{
+			name:    "child",
+			params:  `{"mode":"bridge","child":{"type":"macvlan"}}`,
+			wantErr: "mode bridge and child are mutually exclusive",
+		},
+		{
+			name:    "interface settings",
+			params:  `{"mode":"bridge","interfaceName":"net1","mtu":9000}`,
+			wantErr: "mode bridge and interfaceName, mtu are mutually exclusive",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := parseDeviceConfig(driverName, newClaimWithConfig(opaqueConfig(driverName, nil, tt.params)), "nic")
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := config.bridgeName(); got != tt.wantBridge {
+				t.Errorf("expected bridge %s, got %s", tt.wantBridge, got)
+			}
+		})
+	}
+}
+
+func Test_RunPodSandbox_bridge(t *testing.T) {
+	var steps []string
+	k := NewNetworkDriver(driverName, "node1", fake.NewClientset())
+	k.host.attachBridge = func(containerNsPath string, uplink string, bridgeName string, addresses []*net.IPNet, opts ...kndnet.AttachOption) error {
+		steps = append(steps, fmt.Sprintf("attach %s to %s with %v", uplink, bridgeName, addresses))
+		return nil
+	}
+	k.host.detachBridge = func(containerNsPath string, uplink string, bridgeName string, opts ...kndnet.DetachOption) error {
+		steps = append(steps, fmt.Sprintf("detach %s from %s", uplink, bridgeName))
+		return nil
+	}
+
+	k.checkpointPath = ""
+	k.detachVerifyTimeout = 0
+	addresses, _ := parseIPs([]string{"192.168.5.10/24"})
+	k.sharedState.PodDeviceConfig["pod-uid"] = []AllocatedDevice{{Name: "eth1"}}
+	k.sharedState.PreparedData["pod-uid"] = []PreparedDevice{
+		{DeviceName: "eth1", Addresses: addresses, Config: DeviceConfig{Mode: AttachModeBridge, BridgeName: "uplink0"}},
+	}
+
+	if err := k.RunPodSandbox(context.Background(), newTestSandbox("/run/netns/pod")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if state := k.sharedState.PreparedData["pod-uid"][0].State; state != DeviceStateAttached {
+		t.Errorf("expected device attached, got %s", state)
+	}
+	if err := k.StopPodSandbox(context.Background(), newTestSandbox("/run/netns/pod")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []string{
+		"attach eth1 to uplink0 with [192.168.5.10/24]",
+		"detach eth1 from uplink0",
+	}
+	if !reflect.DeepEqual(steps, want) {
+		t.Errorf("expected %v, got %v", want, steps)
+	}
+}
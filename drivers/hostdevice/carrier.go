@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/containerd/nri/pkg/api"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// carrierTimeout is how long a device brought up in a pod has to get a
+	// carrier before it is reported, the link negotiation takes some seconds.
+	carrierTimeout = 30 * time.Second
+	// carrierInterval is how often the carrier of the device is checked.
+	carrierInterval = time.Second
+	// noCarrierReason is the reason of the events of the devices without carrier.
+	noCarrierReason = "DeviceNoCarrier"
+)
+
+// watchCarrier reports a device brought up in the pod that does not get a
+// carrier within timeout. The bring up never waits for it, a device without
+// cable or whose peer is down is still delivered up. Devices configured with
+// carrierDownOK, e.g. bond or team members whose carrier is managed in the
+// pod, are only logged.
+func (k *NetworkDriver) watchCarrier(ctx context.Context, pod *api.PodSandbox, device PreparedDevice, networkNamespace string, ifName string, timeout time.Duration) {
+	err := wait.PollUntilContextTimeout(ctx, carrierInterval, timeout, true, func(context.Context) (bool, error) {
+		info, err := k.host.nsLinkInfo(networkNamespace, ifName)
+		if err != nil {
+			// the pod is gone
+			return false, err
+		}
+		return info.Carrier, nil
+	})
+	if err == nil {
+		klog.V(2).Infof("Device %q of pod %s/%s has carrier", ifName, pod.Namespace, pod.Name)
+		return
+	}
+	if !wait.Interrupted(err) {
+		klog.V(2).Infof("Stopped watching the carrier of device %q of pod %s/%s: %v", ifName, pod.Namespace, pod.Name, err)
+		return
+	}
+	if device.Config.CarrierDownOK {
+		klog.Infof("Device %q of pod %s/%s is up without carrier, allowed by carrierDownOK", ifName, pod.Namespace, pod.Name)
+		return
+	}
+	klog.Warningf("Device %q of pod %s/%s has no carrier after %v", ifName, pod.Namespace, pod.Name, timeout)
+	k.recordPodEvent(pod, v1.EventTypeWarning, noCarrierReason, "Node %s: device %s is up without carrier after %v", k.nodeName, ifName, timeout)
+}
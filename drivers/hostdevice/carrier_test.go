@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/containerd/nri/pkg/api"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+
+	kndnet "github.com/aojea/kubernetes-network-drivers/pkg/net"
+)
+
+func Test_watchCarrier(t *testing.T) {
+	tests := []struct {
+		name          string
+		carrier       bool
+		err           error
+		carrierDownOK bool
+		wantEvent     string
+	}{
+		{name: "carrier", carrier: true},
+		{
+			name:      "no carrier",
+			wantEvent: "Warning DeviceNoCarrier Node node1: device eth1 is up without carrier after 10ms",
+		},
+		{name: "no carrier allowed", carrierDownOK: true},
+		{name: "pod gone", err: errors.New("namespace not found")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k := NewNetworkDriver(driverName, "node1", fake.NewClientset())
+			k.host.nsLinkInfo = func(containerNsPath string, ifName string) (*kndnet.LinkInfo, error) {
+				if tt.err != nil {
+					return nil, tt.err
+				}
+				return &kndnet.LinkInfo{Carrier: tt.carrier}, nil
+			}
+
+			recorder := record.NewFakeRecorder(10)
+			k.eventRecorder = recorder
+			pod := &api.PodSandbox{Namespace: "ns", Name: "pod", Uid: "pod-uid"}
+			device := PreparedDevice{DeviceName: "eth1", Config: DeviceConfig{CarrierDownOK: tt.carrierDownOK}}
+			k.watchCarrier(context.Background(), pod, device, "/run/netns/test", "eth1", 10*time.Millisecond)
+
+			var event string
+			select {
+			case event = <-recorder.Events:
+			default:
+			}
+			if event != tt.wantEvent {
+				t.Errorf("expected event %q, got %q", tt.wantEvent, event)
+			}
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+)
+
+const checkpointFile = "state.json"
+
+// saveCheckpoint persists the shared state to disk so it survives driver
+// restarts. The caller must hold k.mu.
+func (k *NetworkDriver) saveCheckpoint() error {
+	if k.checkpointPath == "" {
+		return nil
+	}
+	data, err := json.Marshal(k.sharedState)
+	if err != nil {
+		return fmt.Errorf("failed to encode checkpoint: %w", err)
+	}
+	// write to a temporary file and rename it to avoid leaving a
+	// truncated checkpoint behind if the driver dies mid-write
+	tmp := k.checkpointPath + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write checkpoint %s: %w", tmp, err)
+	}
+	if err := os.Rename(tmp, k.checkpointPath); err != nil {
+		return fmt.Errorf("failed to write checkpoint %s: %w", k.checkpointPath, err)
+	}
+	return nil
+}
+
+// loadCheckpoint restores the shared state persisted by a previous instance
+// of the driver. A missing checkpoint is not an error.
+func (k *NetworkDriver) loadCheckpoint() error {
+	if k.checkpointPath == "" {
+		return nil
+	}
+	data, err := os.ReadFile(k.checkpointPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to read checkpoint %s: %w", k.checkpointPath, err)
+	}
+
+	state := &SharedState{}
+	if err := json.Unmarshal(data, state); err != nil {
+		return fmt.Errorf("failed to decode checkpoint %s: %w", k.checkpointPath, err)
+	}
+	if state.PodDeviceConfig == nil {
+		state.PodDeviceConfig = make(map[types.UID][]AllocatedDevice)
+	}
+	if state.PreparedData == nil {
+		state.PreparedData = make(map[types.UID][]PreparedDevice)
+	}
+	if state.PodNames == nil {
+		state.PodNames = make(map[types.UID]types.NamespacedName)
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.sharedState = state
+	k.checkpointLoaded = true
+	k.updateDeviceStateMetrics()
+	klog.Infof("Restored state for %d pods from checkpoint %s", len(state.PodDeviceConfig), k.checkpointPath)
+	return nil
+}
+
+// defaultCheckpointPath returns the checkpoint location inside the plugin data directory.
+func defaultCheckpointPath(pluginPath string) string {
+	return filepath.Join(pluginPath, checkpointFile)
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	resourceapi "k8s.io/api/resource/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func Test_checkpoint(t *testing.T) {
+	path := filepath.Join(t.TempDir(), checkpointFile)
+	k := NewNetworkDriver(driverName, "node1", fake.NewClientset())
+	k.checkpointPath = path
+
+	// a missing checkpoint is a fresh start
+	if err := k.loadCheckpoint(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(k.sharedState.PodDeviceConfig) != 0 {
+		t.Fatalf("expected an empty state, got %+v", k.sharedState)
+	}
+
+	addresses, _ := parseIPs([]string{"192.168.5.10/24"})
+	k.sharedState.PodDeviceConfig["pod-uid"] = []AllocatedDevice{
+		{Name: "eth1", NetworkNamespace: "/var/lib/kubelet/pods/pod-uid/volumes/vrf", SandboxNamespace: "/run/netns/pod", PodInterface: "net1"},
+	}
+	k.sharedState.PreparedData["pod-uid"] = []PreparedDevice{{
+		DeviceName:  "eth1",
+		Claim:       types.NamespacedName{Namespace: "default", Name: "claim"},
+		PoolName:    "node1",
+		Config:      DeviceConfig{InterfaceName: "net1", PolicyRouting: &PolicyRoutingConfig{}},
+		Addresses:   addresses,
+		PolicyTable: 1000,
+		NetworkData: &resourceapi.NetworkDeviceData{InterfaceName: "net1", IPs: []string{"192.168.5.10/24"}},
+		State:       DeviceStateAttached,
+	}}
+	k.sharedState.PodNames["pod-uid"] = types.NamespacedName{Namespace: "default", Name: "pod"}
+	k.mu.Lock()
+	err := k.saveCheckpoint()
+	k.mu.Unlock()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+		t.Errorf("expected no temporary checkpoint left, got %v", err)
+	}
+
+	// a new instance of the driver finds the devices moved by the previous one
+	restored := NewNetworkDriver(driverName, "node1", fake.NewClientset())
+	restored.checkpointPath = path
+	if err := restored.loadCheckpoint(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(restored.sharedState, k.sharedState) {
+		t.Errorf("expected state %+v, got %+v", k.sharedState, restored.sharedState)
+	}
+
+	if err := os.WriteFile(path, []byte("{"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := restored.loadCheckpoint(); err == nil {
+		t.Errorf("expected an error for a corrupted checkpoint")
+	}
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+
+	"github.com/containerd/nri/pkg/api"
+	v1 "k8s.io/api/core/v1"
+	resourceapi "k8s.io/api/resource/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+
+	kndnet "github.com/aojea/kubernetes-network-drivers/pkg/net"
+)
+
+// claimDeletedReason is the reason of the events of the devices whose claim
+// was deleted while the pod was running.
+const claimDeletedReason = "ClaimDeleted"
+
+// ClaimDeletionMode defines what happens to the devices of a running pod
+// when their ResourceClaim is deleted.
+type ClaimDeletionMode string
+
+const (
+	// ClaimDeletionKeep leaves the devices in the pod until it stops.
+	ClaimDeletionKeep ClaimDeletionMode = "keep"
+	// ClaimDeletionRestore returns the devices to the host right away.
+	ClaimDeletionRestore ClaimDeletionMode = "restore"
+)
+
+// errPodBusy is returned when the claim deletion of a pod being run or
+// stopped is handled, it is retried later.
+var errPodBusy = errors.New("pod is being run or stopped")
+
+// claimDeletion is the deletion of a claim with devices attached to a pod,
+// queued until the devices of the pod are handled.
+type claimDeletion struct {
+	claim  types.NamespacedName
+	podUID types.UID
+}
+
+// watchClaimDeletions reacts to the deletion of the claims of the devices
+// attached to the pods of the node. The claims are not bound to a node,
+// they are watched in all the namespaces but only their metadata is cached.
+func (k *NetworkDriver) watchClaimDeletions(ctx context.Context) error {
+	factory := informers.NewSharedInformerFactoryWithOptions(k.kubeClient, 0, informers.WithTransform(claimMetadata))
+	if err := k.addClaimDeletionHandler(factory.Resource().V1().ResourceClaims().Informer()); err != nil {
+		return err
+	}
+	factory.Start(ctx.Done())
+	go k.runClaimDeletions(ctx)
+	return nil
+}
+
+// claimMetadata strips the claims to the metadata the deletion handler uses.
+func claimMetadata(obj interface{}) (interface{}, error) {
+	claim, ok := obj.(*resourceapi.ResourceClaim)
+	if !ok {
+		return obj, nil
+	}
+	return &resourceapi.ResourceClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:         claim.Namespace,
+			Name:              claim.Name,
+			UID:               claim.UID,
+			ResourceVersion:   claim.ResourceVersion,
+			DeletionTimestamp: claim.DeletionTimestamp,
+		},
+	}, nil
+}
+
+// addClaimDeletionHandler queues the claims of the informer once, when
+// they are marked for deletion or, if that was missed, when they are gone.
+func (k *NetworkDriver) addClaimDeletionHandler(informer cache.SharedIndexInformer) error {
+	_, err := informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		UpdateFunc: func(oldObj, obj interface{}) {
+			old, ok := oldObj.(*resourceapi.ResourceClaim)
+			if !ok {
+				return
+			}
+			if claim, ok := obj.(*resourceapi.ResourceClaim); ok && old.DeletionTimestamp == nil && claim.DeletionTimestamp != nil {
+				k.queueClaimDeletion(types.NamespacedName{Namespace: claim.Namespace, Name: claim.Name})
+			}
+		},
+		DeleteFunc: func(obj interface{}) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			if claim, ok := obj.(*resourceapi.ResourceClaim); ok && claim.DeletionTimestamp == nil {
+				k.queueClaimDeletion(types.NamespacedName{Namespace: claim.Namespace, Name: claim.Name})
+			}
+		},
+	})
+	return err
+}
+
+// queueClaimDeletion queues the deletion of the claim for each pod with
+// devices of the claim attached.
+func (k *NetworkDriver) queueClaimDeletion(claim types.NamespacedName) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	for podUID := range k.sharedState.PodNames {
+		if len(k.attachedClaimDevices(podUID, claim)) > 0 {
+			k.claimDeletions.Add(claimDeletion{claim: claim, podUID: podUID})
+		}
+	}
+}
+
+// runClaimDeletions handles the queued claim deletions until ctx is done,
+// the ones of the pods being run or stopped are retried with a backoff.
+func (k *NetworkDriver) runClaimDeletions(ctx context.Context) {
+	go func() {
+		<-ctx.Done()
+		k.claimDeletions.ShutDown()
+	}()
+	for {
+		item, shutdown := k.claimDeletions.Get()
+		if shutdown {
+			return
+		}
+		if err := k.handleClaimDeletion(ctx, item); err != nil {
+			klog.Infof("Retrying the deletion of claim %s for pod %s: %v", item.claim, item.podUID, err)
+			k.claimDeletions.AddRateLimited(item)
+		} else {
+			k.claimDeletions.Forget(item)
+		}
+		k.claimDeletions.Done(item)
+	}
+}
+
+// attachedClaimDevices returns the devices of the claim attached to the pod.
+// The caller must hold k.mu.
+func (k *NetworkDriver) attachedClaimDevices(podUID types.UID, claim types.NamespacedName) []AllocatedDevice {
+	preparedData := k.sharedState.PreparedData[podUID]
+	var devices []AllocatedDevice
+	for _, device := range k.sharedState.PodDeviceConfig[podUID] {
+		if prepared, ok := findPreparedDevice(preparedData, device.Name); ok && prepared.Claim == claim && prepared.State == DeviceStateAttached {
+			devices = append(devices, device)
+		}
+	}
+	return devices
+}
+
+// handleClaimDeletion keeps or restores, depending on the claim deletion
+// mode, the devices of the deleted claim attached to the pod. It returns
+// errPodBusy if the pod is being run or stopped, and an error if some of the
+// devices were not returned to the host, the ones returned are detached.
+func (k *NetworkDriver) handleClaimDeletion(ctx context.Context, item claimDeletion) error {
+	// the pod lock is taken before the driver lock
+	unlock, ok := k.podLocks.tryLock(item.podUID)
+	if !ok {
+		return errPodBusy
+	}
+	defer unlock()
+
+	k.mu.Lock()
+	podName, ok := k.sharedState.PodNames[item.podUID]
+	devices := k.attachedClaimDevices(item.podUID, item.claim)
+	preparedData := slices.Clone(k.sharedState.PreparedData[item.podUID])
+	k.mu.Unlock()
+	if !ok || len(devices) == 0 {
+		return nil
+	}
+	pod := &api.PodSandbox{Uid: string(item.podUID), Namespace: podName.Namespace, Name: podName.Name}
+	if k.claimDeletionMode != ClaimDeletionRestore {
+		for _, device := range devices {
+			klog.Infof("Claim %s of device %s deleted, keeping it in pod %s until it stops", item.claim, device.Name, podName)
+			k.recordPodEvent(pod, v1.EventTypeWarning, claimDeletedReason, "Node %s: claim %s deleted, device %s is kept in the pod until it stops", k.nodeName, item.claim, device.Name)
+		}
+		return nil
+	}
+
+	// the devices are moved without the driver lock, the pod lock keeps
+	// the other operations on this pod out
+	networkNamespace := devices[0].sandboxNamespace()
+	parents, err := kndnet.NsLinkParents(networkNamespace)
+	if err != nil {
+		klog.Infof("failed to get the interface dependencies of pod %s: %v", podName, err)
+	}
+	klog.Infof("Claim %s deleted, returning its %d devices from pod %s to the host", item.claim, len(devices), podName)
+	notDetached, err := k.cleanupPodDevices(ctx, pod, networkNamespace, devices, preparedData, parents)
+	restored := sets.New[string]()
+	for _, device := range devices {
+		if notDetached.Has(device.Name) {
+			continue
+		}
+		restored.Insert(device.Name)
+		if prepared, _ := findPreparedDevice(preparedData, device.Name); prepared.NetworkData != nil {
+			k.reportNetworkData(ctx, item.podUID, prepared, nil)
+		}
+		k.recordPodEvent(pod, v1.EventTypeNormal, claimDeletedReason, "Node %s: claim %s deleted, device %s returned to the host", k.nodeName, item.claim, device.Name)
+	}
+	if notDetached.Len() > 0 {
+		klog.Errorf("failed to restore %d devices of deleted claim %s: %v", notDetached.Len(), item.claim, err)
+		k.recordPodEvent(pod, v1.EventTypeWarning, claimDeletedReason, "Node %s: claim %s deleted, failed to return devices %s to the host: %v", k.nodeName, item.claim, strings.Join(sets.List(notDetached), ", "), err)
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	preparedData = k.sharedState.PreparedData[item.podUID]
+	k.sharedState.PodDeviceConfig[item.podUID] = slices.DeleteFunc(k.sharedState.PodDeviceConfig[item.podUID], func(device AllocatedDevice) bool {
+		if i := preparedDeviceIndex(preparedData, device.Name); i >= 0 && restored.Has(device.Name) && preparedData[i].Claim == item.claim && preparedData[i].State == DeviceStateAttached {
+			preparedData[i].State = DeviceStateDetached
+			return true
+		}
+		return false
+	})
+	k.updatePodStatusAnnotation(item.podUID)
+	k.updateDeviceStateMetrics()
+	if err := k.saveCheckpoint(); err != nil {
+		klog.Errorf("failed to save checkpoint: %v", err)
+	}
+	if k.reserveDevices {
+		k.requestRepublish()
+	}
+	if notDetached.Len() > 0 {
+		// the devices left in the pod are retried with a backoff
+		return err
+	}
+	return nil
+}
+
+// preparedDeviceIndex returns the index of the device in the prepared data, or -1.
+func preparedDeviceIndex(preparedData []PreparedDevice, deviceName string) int {
+	for i := range preparedData {
+		if preparedData[i].DeviceName == deviceName {
+			return i
+		}
+	}
+	return -1
+}
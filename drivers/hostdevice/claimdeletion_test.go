@@ -0,0 +1,222 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	resourceapi "k8s.io/api/resource/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+
+	kndnet "github.com/aojea/kubernetes-network-drivers/pkg/net"
+)
+
+// fakeClaimListWatch lists the claims and watches them through a fake
+// watcher, without the initial events of the watch list semantics.
+type fakeClaimListWatch struct {
+	*cache.ListWatch
+}
+
+func (fakeClaimListWatch) IsWatchListSemanticsUnSupported() bool { return true }
+
+// newFakeClaimInformer returns an informer of the claims fed by watcher.
+func newFakeClaimInformer(watcher *watch.FakeWatcher, claims ...resourceapi.ResourceClaim) cache.SharedIndexInformer {
+	lw := fakeClaimListWatch{&cache.ListWatch{
+		ListWithContextFunc: func(context.Context, metav1.ListOptions) (runtime.Object, error) {
+			return &resourceapi.ResourceClaimList{Items: claims}, nil
+		},
+		WatchFuncWithContext: func(context.Context, metav1.ListOptions) (watch.Interface, error) {
+			return watcher, nil
+		},
+	}}
+	return cache.NewSharedIndexInformer(lw, &resourceapi.ResourceClaim{}, 0, cache.Indexers{})
+}
+
+func Test_handleClaimDeletion(t *testing.T) {
+	tests := []struct {
+		name         string
+		mode         ClaimDeletionMode
+		wantDetached []string
+		wantDevices  []string
+		wantEvent    string
+	}{
+		{
+			name:        "keep",
+			mode:        ClaimDeletionKeep,
+			wantDevices: []string{"eth1", "eth2"},
+			wantEvent:   "Warning ClaimDeleted Node node1: claim default/claim1 deleted, device eth1 is kept in the pod until it stops",
+		},
+		{
+			name:         "restore",
+			mode:         ClaimDeletionRestore,
+			wantDetached: []string{"eth1"},
+			wantDevices:  []string{"eth2"},
+			wantEvent:    "Normal ClaimDeleted Node node1: claim default/claim1 deleted, device eth1 returned to the host",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			var detached []string
+			k := NewNetworkDriver(driverName, "node1", fake.NewClientset())
+			k.host.detachNetdev = func(containerNsPath string, devName string, outName string, opts ...kndnet.DetachOption) error {
+				mu.Lock()
+				defer mu.Unlock()
+				detached = append(detached, devName)
+				return nil
+			}
+
+			k.checkpointPath = ""
+			k.claimDeletionMode = tt.mode
+			recorder := record.NewFakeRecorder(10)
+			k.eventRecorder = recorder
+			k.sharedState.PodDeviceConfig["pod-uid"] = []AllocatedDevice{
+				{Name: "eth1", NetworkNamespace: "/var/run/netns/test"},
+				{Name: "eth2", NetworkNamespace: "/var/run/netns/test"},
+			}
+			k.sharedState.PreparedData["pod-uid"] = []PreparedDevice{
+				{DeviceName: "eth1", Claim: types.NamespacedName{Namespace: "default", Name: "claim1"}, State: DeviceStateAttached},
+				{DeviceName: "eth2", Claim: types.NamespacedName{Namespace: "default", Name: "claim2"}, State: DeviceStateAttached},
+			}
+			k.sharedState.PodNames["pod-uid"] = types.NamespacedName{Namespace: "default", Name: "pod"}
+
+			claim := resourceapi.ResourceClaim{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "claim1", UID: "claim-uid"}}
+			watcher := watch.NewFake()
+			informer := newFakeClaimInformer(watcher, claim)
+			if err := k.addClaimDeletionHandler(informer); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go informer.Run(ctx.Done())
+			go k.runClaimDeletions(ctx)
+			if !cache.WaitForCacheSync(ctx.Done(), informer.HasSynced) {
+				t.Fatal("informer did not sync")
+			}
+
+			watcher.Delete(&claim)
+
+			var event string
+			select {
+			case event = <-recorder.Events:
+			case <-time.After(wait.ForeverTestTimeout):
+				t.Fatal("no event for the claim deletion")
+			}
+			if event != tt.wantEvent {
+				t.Errorf("expected event %q, got %q", tt.wantEvent, event)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			if strings.Join(detached, ",") != strings.Join(tt.wantDetached, ",") {
+				t.Errorf("expected detached devices %v, got %v", tt.wantDetached, detached)
+			}
+			k.mu.Lock()
+			defer k.mu.Unlock()
+			var devices []string
+			for _, device := range k.sharedState.PodDeviceConfig["pod-uid"] {
+				devices = append(devices, device.Name)
+			}
+			if strings.Join(devices, ",") != strings.Join(tt.wantDevices, ",") {
+				t.Errorf("expected pod devices %v, got %v", tt.wantDevices, devices)
+			}
+			if tt.mode == ClaimDeletionRestore && k.sharedState.PreparedData["pod-uid"][0].State != DeviceStateDetached {
+				t.Errorf("expected restored device to be detached, got %s", k.sharedState.PreparedData["pod-uid"][0].State)
+			}
+		})
+	}
+}
+
+func Test_handleClaimDeletion_podBusy(t *testing.T) {
+	var detached []string
+	k := NewNetworkDriver(driverName, "node1", fake.NewClientset())
+	k.host.detachNetdev = func(containerNsPath string, devName string, outName string, opts ...kndnet.DetachOption) error {
+		detached = append(detached, devName)
+		return nil
+	}
+
+	k.checkpointPath = ""
+	k.claimDeletionMode = ClaimDeletionRestore
+	k.eventRecorder = record.NewFakeRecorder(10)
+	k.sharedState.PodDeviceConfig["pod-uid"] = []AllocatedDevice{{Name: "eth1", NetworkNamespace: "/var/run/netns/test"}}
+	k.sharedState.PreparedData["pod-uid"] = []PreparedDevice{
+		{DeviceName: "eth1", Claim: types.NamespacedName{Namespace: "default", Name: "claim1"}, State: DeviceStateAttached},
+	}
+	k.sharedState.PodNames["pod-uid"] = types.NamespacedName{Namespace: "default", Name: "pod"}
+	item := claimDeletion{claim: types.NamespacedName{Namespace: "default", Name: "claim1"}, podUID: "pod-uid"}
+
+	// the pod is being stopped, the deletion is retried
+	unlock := k.podLocks.lock("pod-uid")
+	if err := k.handleClaimDeletion(context.Background(), item); !errors.Is(err, errPodBusy) {
+		t.Fatalf("expected errPodBusy, got %v", err)
+	}
+	unlock()
+	if len(detached) != 0 {
+		t.Fatalf("expected no device detached while the pod is busy, got %v", detached)
+	}
+
+	if err := k.handleClaimDeletion(context.Background(), item); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if strings.Join(detached, ",") != "eth1" {
+		t.Errorf("expected eth1 detached, got %v", detached)
+	}
+	if len(k.sharedState.PodDeviceConfig["pod-uid"]) != 0 || k.sharedState.PreparedData["pod-uid"][0].State != DeviceStateDetached {
+		t.Errorf("expected the device of the deleted claim detached, got %+v", k.sharedState.PreparedData["pod-uid"])
+	}
+}
+
+func Test_handleClaimDeletion_partial(t *testing.T) {
+	failing := "eth2"
+	k := NewNetworkDriver(driverName, "node1", fake.NewClientset())
+	k.host.detachNetdev = func(containerNsPath string, devName string, outName string, opts ...kndnet.DetachOption) error {
+		if devName == failing {
+			return errors.New("device busy")
+		}
+		return nil
+	}
+
+	k.checkpointPath = ""
+	k.claimDeletionMode = ClaimDeletionRestore
+	k.eventRecorder = record.NewFakeRecorder(10)
+	claim := types.NamespacedName{Namespace: "default", Name: "claim1"}
+	k.sharedState.PodDeviceConfig["pod-uid"] = []AllocatedDevice{
+		{Name: "eth1", NetworkNamespace: "/var/run/netns/test"},
+		{Name: "eth2", NetworkNamespace: "/var/run/netns/test"},
+	}
+	k.sharedState.PreparedData["pod-uid"] = []PreparedDevice{
+		{DeviceName: "eth1", Claim: claim, State: DeviceStateAttached},
+		{DeviceName: "eth2", Claim: claim, State: DeviceStateAttached},
+	}
+	k.sharedState.PodNames["pod-uid"] = types.NamespacedName{Namespace: "default", Name: "pod"}
+	item := claimDeletion{claim: claim, podUID: "pod-uid"}
+
+	// the restored device is detached, the other one is retried
+	if err := k.handleClaimDeletion(context.Background(), item); err == nil || !strings.Contains(err.Error(), "device busy") {
+		t.Fatalf("expected the error of the device left in the pod, got %v", err)
+	}
+	if devices := k.sharedState.PodDeviceConfig["pod-uid"]; len(devices) != 1 || devices[0].Name != "eth2" {
+		t.Errorf("expected only eth2 left in the pod, got %+v", devices)
+	}
+	if got := k.sharedState.PreparedData["pod-uid"]; got[0].State != DeviceStateDetached || got[1].State != DeviceStateAttached {
+		t.Errorf("expected eth1 detached and eth2 attached, got %+v", got)
+	}
+
+	failing = ""
+	if err := k.handleClaimDeletion(context.Background(), item); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(k.sharedState.PodDeviceConfig["pod-uid"]) != 0 || k.sharedState.PreparedData["pod-uid"][1].State != DeviceStateDetached {
+		t.Errorf("expected the devices of the deleted claim detached, got %+v", k.sharedState.PreparedData["pod-uid"])
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"slices"
+)
+
+// cleanupOrder returns the indexes of the devices in the order they must be
+// detached. Devices are detached in reverse of the attach order, sorted by
+// their configured cleanup order, and a device is never detached before the
+// devices that depend on it, so children are removed before their parents.
+// parents maps an interface to the interface it depends on.
+func cleanupOrder(devices []AllocatedDevice, preparedData []PreparedDevice, parents map[string]string) []int {
+	order := make([]int, 0, len(devices))
+	for i := len(devices) - 1; i >= 0; i-- {
+		order = append(order, i)
+	}
+	priority := func(i int) int {
+		preparedDevice, _ := findPreparedDevice(preparedData, devices[i].Name)
+		return preparedDevice.Config.CleanupOrder
+	}
+	slices.SortStableFunc(order, func(a, b int) int {
+		return priority(a) - priority(b)
+	})
+
+	// pick the first device without pending dependents on each round,
+	// falling back to the first one if there is a cycle
+	hasPendingChildren := func(name string) bool {
+		for _, i := range order {
+			if parents[devices[i].Name] == name {
+				return true
+			}
+		}
+		return false
+	}
+	result := make([]int, 0, len(order))
+	for len(order) > 0 {
+		next := 0
+		for j, i := range order {
+			if !hasPendingChildren(devices[i].Name) {
+				next = j
+				break
+			}
+		}
+		result = append(result, order[next])
+		order = slices.Delete(order, next, next+1)
+	}
+	return result
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_cleanupOrder(t *testing.T) {
+	devices := []AllocatedDevice{{Name: "vrf0"}, {Name: "eth1"}, {Name: "eth2"}, {Name: "eth3"}}
+	tests := []struct {
+		name         string
+		preparedData []PreparedDevice
+		parents      map[string]string
+		want         []string
+	}{
+		{
+			name: "reverse of attach order",
+			want: []string{"eth3", "eth2", "eth1", "vrf0"},
+		},
+		{
+			name: "configured order",
+			preparedData: []PreparedDevice{
+				{DeviceName: "vrf0", Config: DeviceConfig{CleanupOrder: -1}},
+				{DeviceName: "eth2", Config: DeviceConfig{CleanupOrder: 1}},
+			},
+			want: []string{"vrf0", "eth3", "eth1", "eth2"},
+		},
+		{
+			name: "children before parents",
+			// the vrf is attached first and would be detached last anyway,
+			// ask for it first to check the dependencies win
+			preparedData: []PreparedDevice{
+				{DeviceName: "vrf0", Config: DeviceConfig{CleanupOrder: -1}},
+			},
+			parents: map[string]string{"eth1": "vrf0", "eth3": "vrf0"},
+			want:    []string{"eth3", "eth2", "eth1", "vrf0"},
+		},
+		{
+			name:    "chained dependencies",
+			parents: map[string]string{"eth3": "eth1", "eth1": "vrf0", "lo": "vrf0"},
+			want:    []string{"eth3", "eth2", "eth1", "vrf0"},
+		},
+		{
+			name:    "cycle",
+			parents: map[string]string{"eth1": "eth2", "eth2": "eth1"},
+			want:    []string{"eth3", "vrf0", "eth2", "eth1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, i := range cleanupOrder(devices, tt.preparedData, tt.parents) {
+				got = append(got, devices[i].Name)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("cleanupOrder() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,448 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+
+	resourceapi "k8s.io/api/resource/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog/v2"
+
+	kndnet "github.com/aojea/kubernetes-network-drivers/pkg/net"
+)
+
+// DeviceConfig is the configuration that can be passed to the driver as
+// opaque parameters in the ResourceClaim or the DeviceClass.
+type DeviceConfig struct {
+	// BringUpContainer is the name of the pod container whose start triggers
+	// the bring up of the interface. The device is still moved into the pod
+	// network namespace when the sandbox is created, but it is kept down until
+	// the container starts. If empty, the interface is brought up with the sandbox.
+	BringUpContainer string `json:"bringUpContainer,omitempty"`
+	// InterfaceName is the name of the interface in the pod, e.g. net1, the
+	// host name is kept if empty and restored when the device is detached.
+	InterfaceName string `json:"interfaceName,omitempty"`
+	// NetworkNamespace is the path, relative to the pod directory of the
+	// kubelet, of another network namespace of the pod to move the device
+	// into instead of the sandbox one, e.g. bind mounted on a volume of the
+	// pod. It must exist when the pod sandbox is created.
+	NetworkNamespace string `json:"networkNamespace,omitempty"`
+	// ReadinessPath is the directory mounted in the containers of the pod
+	// where an empty file named after the interface is created once it is
+	// fully configured, so applications can wait for it before binding.
+	ReadinessPath string `json:"readinessPath,omitempty"`
+	// IPs are the addresses in CIDR notation, e.g. 192.168.5.10/24, set on
+	// the interface when it is moved into the pod.
+	IPs []string `json:"ips,omitempty"`
+	// Routes are installed through the interface once it is up.
+	Routes []kndnet.RouteConfig `json:"routes,omitempty"`
+	// PolicyRouting routes the traffic from the addresses of the interface
+	// through it with a dedicated table, for secondary interfaces.
+	PolicyRouting *PolicyRoutingConfig `json:"policyRouting,omitempty"`
+	// CleanupOrder sorts the detach of the devices of a pod, lower values are
+	// detached first. Devices with the same value are detached in reverse of
+	// their attach order, e.g. a VRF master can be restored last by giving
+	// it a higher value than its members.
+	CleanupOrder int `json:"cleanupOrder,omitempty"`
+	// Network is the complete addressing and routing configuration of the
+	// interface, applied as a whole once the device is moved and removed
+	// in reverse before it is detached.
+	Network *kndnet.NetworkConfig `json:"network,omitempty"`
+	// SriovVF moves a free virtual function of the allocated SR-IOV physical
+	// function into the pod instead of the physical function itself.
+	SriovVF bool `json:"sriovVF,omitempty"`
+	// Mode is how the device is attached to the pod, move by default. The
+	// macvlan and ipvlan modes are a shorthand for a child of that type.
+	Mode AttachMode `json:"mode,omitempty"`
+	// BridgeName is the name of the bridge in the pod the device is enslaved
+	// to in the bridge mode, br0 by default.
+	BridgeName string `json:"bridgeName,omitempty"`
+	// Child creates a virtual interface on top of the device in the pod
+	// instead of moving the device, so it can be shared by multiple pods.
+	Child *ChildConfig `json:"child,omitempty"`
+	// IPVlanMode is the mode of the ipvlan child, l2, l3 or l3s, l2 by default.
+	IPVlanMode IPVlanMode `json:"ipvlanMode,omitempty"`
+	// VLAN is the 802.1Q VLAN id of an interface created on top of the device
+	// and moved into the pod instead of the device, named <device>.<vlan> by
+	// default. It is deleted when the pod stops.
+	VLAN int `json:"vlan,omitempty"`
+	// IPv6Privacy enables the IPv6 privacy extensions on the interface.
+	IPv6Privacy *IPv6PrivacyConfig `json:"ipv6Privacy,omitempty"`
+	// ARP configures the ARP announce and ignore settings of the interface.
+	ARP *ARPConfig `json:"arp,omitempty"`
+	// HopLimit is the default IPv6 hop limit of the packets sent through the
+	// interface, it is restored to the namespace default when the device is
+	// detached.
+	HopLimit int `json:"hopLimit,omitempty"`
+	// Sysctls are the interface scoped sysctls, e.g.
+	// net.ipv4.conf.<interface>.rp_filter, written in the pod once the
+	// interface is up. They must be of the interface in the pod, the network
+	// namespace wide settings are rejected. They are restored to the
+	// namespace defaults when the device is detached.
+	Sysctls map[string]string `json:"sysctls,omitempty"`
+	// PermanentMAC sets the permanent (burned-in) MAC address of the device
+	// on the interface moved into the pod, the current address is restored
+	// when the device is returned to the host.
+	PermanentMAC bool `json:"permanentMAC,omitempty"`
+	// HardwareTimestamping configures the hardware timestamping of the
+	// interface moved into the pod, for PTP, the previous configuration is
+	// restored when the device is returned to the host.
+	HardwareTimestamping *kndnet.HardwareTimestamping `json:"hardwareTimestamping,omitempty"`
+	// Ethtool sets the offload features and the ring sizes of the interface
+	// before it is brought up in the pod, the previous ones are restored when
+	// the device is returned to the host.
+	Ethtool *kndnet.EthtoolConfig `json:"ethtool,omitempty"`
+	// Multicast routes multicast groups through the interface once it is up.
+	Multicast *kndnet.MulticastConfig `json:"multicast,omitempty"`
+	// SSM joins source-specific multicast channels on the interface once it is up.
+	SSM *kndnet.SSMConfig `json:"ssm,omitempty"`
+	// MTU is set on the interface moved into the pod, it must not be above
+	// the max-mtu of the device. The previous MTU is restored when the
+	// device is returned to the host.
+	MTU int `json:"mtu,omitempty"`
+	// ClampMTU sets the MTU of all the devices of the claim with it to the
+	// lowest of their MTUs, configured or current, when the claim is prepared.
+	ClampMTU bool `json:"clampMTU,omitempty"`
+	// EgressRate is the maximum egress rate of the interface in bits per
+	// second, e.g. "1G", overriding the default of the pod QoS class. It is
+	// committed on the allocated device when the claim is prepared.
+	EgressRate *resource.Quantity `json:"egressRate,omitempty"`
+	// CarrierDownOK declares that the interface is expected to be up without
+	// carrier in the pod, e.g. a bond or team member, so it is not reported
+	// with a warning event when it gets none.
+	CarrierDownOK bool `json:"carrierDownOK,omitempty"`
+	// Drain removes the routes through the interface and sets it down, after
+	// a delay, before the device is returned to the host.
+	Drain *DrainConfig `json:"drain,omitempty"`
+	// NUMA is the NUMA node the device should be on, checked on prepare.
+	NUMA *NUMAConfig `json:"numa,omitempty"`
+	// Bond enslaves the device with the other members of the bond to a bond
+	// interface created in the pod, configured with the ips and the routes.
+	Bond *BondConfig `json:"bond,omitempty"`
+}
+
+// AttachMode defines how the device is attached to the pod.
+type AttachMode string
+
+const (
+	// AttachModeMove moves the device into the pod network namespace.
+	AttachModeMove AttachMode = "move"
+	// AttachModeMacvlan creates a macvlan child of the device in the pod,
+	// the device stays in the host namespace.
+	AttachModeMacvlan AttachMode = "macvlan"
+	// AttachModeIPVlan creates an ipvlan child of the device in the pod,
+	// the device stays in the host namespace.
+	AttachModeIPVlan AttachMode = "ipvlan"
+	// AttachModeBridge moves the device into the pod network namespace and
+	// enslaves it to a bridge there, which gets the ips and the routes.
+	AttachModeBridge AttachMode = "bridge"
+)
+
+// ChildConfig is the virtual interface created on top of the device.
+type ChildConfig struct {
+	// Type is the virtual interface type, macvlan or ipvlan.
+	Type string `json:"type"`
+	// Uplink is the host interface used as parent when the device cannot
+	// host the virtual interface, e.g. because it is a bond slave.
+	Uplink string `json:"uplink,omitempty"`
+}
+
+// childType returns the type of the virtual interface created on top of the
+// device, from the child or the mode, empty if the device is moved.
+func (c DeviceConfig) childType() string {
+	if c.Child != nil {
+		return c.Child.Type
+	}
+	if c.VLAN != 0 {
+		return "vlan"
+	}
+	if c.Mode == AttachModeMacvlan || c.Mode == AttachModeIPVlan {
+		return string(c.Mode)
+	}
+	return ""
+}
+
+// selectUplink returns the parent of the child interface, the device if it
+// can host it or the configured uplink otherwise. canHost reports why an
+// interface cannot be the parent of a child type.
+func selectUplink(device string, child ChildConfig, canHost func(ifName, childType string) error) (string, error) {
+	err := canHost(device, child.Type)
+	if err == nil {
+		return device, nil
+	}
+	if child.Uplink == "" {
+		return "", err
+	}
+	klog.Infof("Device %s cannot host a %s, falling back to uplink %s: %v", device, child.Type, child.Uplink, err)
+	if uplinkErr := canHost(child.Uplink, child.Type); uplinkErr != nil {
+		return "", fmt.Errorf("neither device %s nor uplink %s can host a %s: %w", device, child.Uplink, child.Type, errors.Join(err, uplinkErr))
+	}
+	return child.Uplink, nil
+}
+
+// parseDeviceConfig merges the opaque configurations for this driver that
+// apply to the given request. Configurations are applied in order, so the
+// claim configuration overrides the one from the class.
+func parseDeviceConfig(driverName string, claim *resourceapi.ResourceClaim, request string) (DeviceConfig, error) {
+	config := DeviceConfig{}
+	if claim.Status.Allocation == nil {
+		return config, nil
+	}
+	for _, c := range claim.Status.Allocation.Devices.Config {
+		if c.Opaque == nil || c.Opaque.Driver != driverName {
+			continue
+		}
+		if !configAppliesToRequest(c.Requests, request) {
+			continue
+		}
+		if len(c.Opaque.Parameters.Raw) == 0 {
+			continue
+		}
+		decoder := json.NewDecoder(bytes.NewReader(c.Opaque.Parameters.Raw))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&config); err != nil {
+			return DeviceConfig{}, fmt.Errorf("invalid configuration for claim %s request %s: %w", claim.Name, request, err)
+		}
+	}
+	if err := config.validate(); err != nil {
+		return DeviceConfig{}, fmt.Errorf("invalid configuration for claim %s request %s: %w", claim.Name, request, err)
+	}
+	// the child modes and the VLANs are attached and cleaned up as the child
+	// interfaces
+	if childType := config.childType(); config.Child == nil && childType != "" {
+		config.Child = &ChildConfig{Type: childType}
+	}
+	return config, nil
+}
+
+// parseIPs parses the addresses of the interface, keeping the host part.
+func parseIPs(ips []string) ([]*net.IPNet, error) {
+	seen := sets.New[string]()
+	var addresses []*net.IPNet
+	for _, ip := range ips {
+		addr, prefix, err := net.ParseCIDR(ip)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ip %q, must be an address in CIDR notation: %w", ip, err)
+		}
+		if addr.IsUnspecified() || addr.IsLoopback() || addr.IsMulticast() {
+			return nil, fmt.Errorf("invalid ip %s, must be a unicast address", ip)
+		}
+		if seen.Has(addr.String()) {
+			return nil, fmt.Errorf("duplicate ip %s", addr)
+		}
+		seen.Insert(addr.String())
+		addresses = append(addresses, &net.IPNet{IP: addr, Mask: prefix.Mask})
+	}
+	return addresses, nil
+}
+
+// validate checks the configuration so invalid claims fail on prepare
+// instead of when the pod sandbox is created.
+func (c DeviceConfig) validate() error {
+	if c.InterfaceName != "" && !validInterfaceName(c.InterfaceName) {
+		return fmt.Errorf("invalid interfaceName %q", c.InterfaceName)
+	}
+	if c.NetworkNamespace != "" {
+		if err := validatePodNamespacePath(c.NetworkNamespace); err != nil {
+			return err
+		}
+	}
+	if c.ReadinessPath != "" {
+		if err := validateReadinessPath(c.ReadinessPath); err != nil {
+			return err
+		}
+	}
+	if len(c.IPs) > 0 {
+		if c.Network != nil {
+			return fmt.Errorf("ips and network are mutually exclusive, set the addresses in the network configuration")
+		}
+		if _, err := parseIPs(c.IPs); err != nil {
+			return err
+		}
+	}
+	for _, route := range c.Routes {
+		if err := route.Validate(); err != nil {
+			return err
+		}
+	}
+	switch c.Mode {
+	case "", AttachModeMacvlan, AttachModeIPVlan:
+		if c.Mode != "" && c.Child != nil && c.Child.Type != string(c.Mode) {
+			return fmt.Errorf("invalid mode %s for a %s child, they must match", c.Mode, c.Child.Type)
+		}
+	case AttachModeMove, AttachModeBridge:
+		if c.Child != nil {
+			return fmt.Errorf("mode %s and child are mutually exclusive, the child interface is created on top of the device", c.Mode)
+		}
+	default:
+		return fmt.Errorf("invalid mode %q, must be %s, %s, %s or %s", c.Mode, AttachModeMove, AttachModeMacvlan, AttachModeIPVlan, AttachModeBridge)
+	}
+	if c.Child != nil {
+		switch c.Child.Type {
+		case "macvlan", "ipvlan":
+		default:
+			return fmt.Errorf("invalid child type %q, must be macvlan or ipvlan", c.Child.Type)
+		}
+	}
+	if c.VLAN != 0 {
+		if c.VLAN < kndnet.MinVlanID || c.VLAN > kndnet.MaxVlanID {
+			return fmt.Errorf("invalid vlan %d, must be between %d and %d", c.VLAN, kndnet.MinVlanID, kndnet.MaxVlanID)
+		}
+		if c.Child != nil || c.Mode == AttachModeMacvlan || c.Mode == AttachModeIPVlan {
+			return fmt.Errorf("vlan and child are mutually exclusive, the vlan interface is moved into the pod")
+		}
+	}
+	if c.IPVlanMode != "" {
+		if c.childType() != "ipvlan" {
+			return fmt.Errorf("ipvlanMode requires an ipvlan child")
+		}
+		if err := c.IPVlanMode.validate(); err != nil {
+			return err
+		}
+	}
+	isChild := c.childType() != ""
+	if c.PermanentMAC && isChild {
+		return fmt.Errorf("permanentMAC and child are mutually exclusive, the child interface has its own address")
+	}
+	if c.MTU != 0 {
+		if isChild {
+			return fmt.Errorf("mtu and child are mutually exclusive, the child interface inherits the mtu of its parent")
+		}
+		if c.MTU < kndnet.MinMTU || c.MTU > kndnet.MaxMTU {
+			return fmt.Errorf("invalid mtu %d, must be between %d and %d", c.MTU, kndnet.MinMTU, kndnet.MaxMTU)
+		}
+	}
+	if c.ClampMTU && isChild {
+		return fmt.Errorf("clampMTU and child are mutually exclusive, the child interface inherits the mtu of its parent")
+	}
+	if c.HardwareTimestamping != nil {
+		if isChild {
+			return fmt.Errorf("hardwareTimestamping and child are mutually exclusive, the hardware clock is not shared")
+		}
+		if err := c.HardwareTimestamping.Validate(); err != nil {
+			return fmt.Errorf("invalid hardwareTimestamping: %w", err)
+		}
+	}
+	if c.Ethtool != nil {
+		if err := c.Ethtool.Validate(); err != nil {
+			return fmt.Errorf("invalid ethtool: %w", err)
+		}
+	}
+	if c.ARP != nil {
+		if err := c.ARP.validate(); err != nil {
+			return fmt.Errorf("invalid arp: %w", err)
+		}
+	}
+	if c.EgressRate != nil && c.EgressRate.Sign() <= 0 {
+		return fmt.Errorf("invalid egressRate %s, must be greater than 0", c.EgressRate.String())
+	}
+	if c.HopLimit != 0 {
+		if err := validateHopLimit(c.HopLimit); err != nil {
+			return err
+		}
+	}
+	if err := validateSysctls(c.Sysctls); err != nil {
+		return fmt.Errorf("invalid sysctls: %w", err)
+	}
+	if c.Multicast != nil {
+		if err := c.Multicast.Validate(); err != nil {
+			return fmt.Errorf("invalid multicast: %w", err)
+		}
+	}
+	if c.SSM != nil {
+		if err := c.SSM.Validate(); err != nil {
+			return fmt.Errorf("invalid ssm: %w", err)
+		}
+	}
+	if c.Drain != nil {
+		if err := c.Drain.validate(); err != nil {
+			return fmt.Errorf("invalid drain: %w", err)
+		}
+	}
+	if c.NUMA != nil {
+		if err := c.NUMA.validate(); err != nil {
+			return fmt.Errorf("invalid numa: %w", err)
+		}
+	}
+	if c.IPv6Privacy != nil {
+		if err := c.IPv6Privacy.validate(); err != nil {
+			return fmt.Errorf("invalid ipv6Privacy: %w", err)
+		}
+	}
+	if c.PolicyRouting != nil {
+		if c.Network != nil {
+			return fmt.Errorf("policyRouting and network are mutually exclusive, use network.tables and network.rules instead")
+		}
+		if err := c.PolicyRouting.validate(); err != nil {
+			return fmt.Errorf("invalid policyRouting: %w", err)
+		}
+	}
+	if c.Bond != nil {
+		if err := c.Bond.validate(); err != nil {
+			return fmt.Errorf("invalid bond: %w", err)
+		}
+		if settings := c.interfaceSettings(); len(settings) > 0 {
+			return fmt.Errorf("bond and %s are mutually exclusive, only the ips and the routes configure the bond", strings.Join(settings, ", "))
+		}
+	}
+	if c.BridgeName != "" {
+		if c.Mode != AttachModeBridge {
+			return fmt.Errorf("bridgeName requires mode %s", AttachModeBridge)
+		}
+		if !validInterfaceName(c.BridgeName) {
+			return fmt.Errorf("invalid bridgeName %q", c.BridgeName)
+		}
+	}
+	if c.Mode == AttachModeBridge {
+		if c.Bond != nil {
+			return fmt.Errorf("mode %s and bond are mutually exclusive, the members of a bond are moved into the pod", c.Mode)
+		}
+		if settings := c.interfaceSettings(); len(settings) > 0 {
+			return fmt.Errorf("mode %s and %s are mutually exclusive, only the ips and the routes configure the bridge", c.Mode, strings.Join(settings, ", "))
+		}
+	}
+	if c.Network != nil {
+		if len(c.Routes) > 0 {
+			return fmt.Errorf("routes and network are mutually exclusive, use network.routes instead")
+		}
+		if err := c.Network.Validate(); err != nil {
+			return fmt.Errorf("invalid network: %w", err)
+		}
+	}
+	return nil
+}
+
+// checkInterfaceNames returns an error if several devices of a claim are
+// renamed to the same interface in the pod, e.g. a request for more than
+// one device with an interfaceName.
+func checkInterfaceNames(devices []PreparedDevice) error {
+	seen := map[string]string{}
+	for _, device := range devices {
+		name := device.Config.InterfaceName
+		if name == "" {
+			continue
+		}
+		if other, ok := seen[name]; ok {
+			return fmt.Errorf("devices %s and %s have the same interfaceName %s", other, device.DeviceName, name)
+		}
+		seen[name] = device.DeviceName
+	}
+	return nil
+}
+
+// configAppliesToRequest returns true if a configuration scoped to requests
+// applies to request, a configuration without requests applies to all of them.
+func configAppliesToRequest(requests []string, request string) bool {
+	if len(requests) == 0 {
+		return true
+	}
+	// references to the main request apply to all its subrequests
+	mainRequest, _, _ := strings.Cut(request, "/")
+	return slices.Contains(requests, request) || slices.Contains(requests, mainRequest)
+}
@@ -0,0 +1,570 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	resourceapi "k8s.io/api/resource/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	kndnet "github.com/aojea/kubernetes-network-drivers/pkg/net"
+)
+
+func newClaimWithConfig(configs ...resourceapi.DeviceAllocationConfiguration) *resourceapi.ResourceClaim {
+	return &resourceapi.ResourceClaim{
+		Status: resourceapi.ResourceClaimStatus{
+			Allocation: &resourceapi.AllocationResult{
+				Devices: resourceapi.DeviceAllocationResult{
+					Results: []resourceapi.DeviceRequestAllocationResult{{Request: "nic", Driver: driverName, Device: "eth1"}},
+					Config:  configs,
+				},
+			},
+		},
+	}
+}
+
+func opaqueConfig(driver string, requests []string, params string) resourceapi.DeviceAllocationConfiguration {
+	return resourceapi.DeviceAllocationConfiguration{
+		Requests: requests,
+		DeviceConfiguration: resourceapi.DeviceConfiguration{
+			Opaque: &resourceapi.OpaqueDeviceConfiguration{
+				Driver:     driver,
+				Parameters: runtime.RawExtension{Raw: []byte(params)},
+			},
+		},
+	}
+}
+
+func Test_parseDeviceConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		claim   *resourceapi.ResourceClaim
+		request string
+		want    DeviceConfig
+		wantErr bool
+	}{
+		{
+			name:    "no config",
+			claim:   newClaimWithConfig(),
+			request: "nic",
+		},
+		{
+			name:    "bring up container",
+			claim:   newClaimWithConfig(opaqueConfig(driverName, nil, `{"bringUpContainer":"app"}`)),
+			request: "nic",
+			want:    DeviceConfig{BringUpContainer: "app"},
+		},
+		{
+			name:    "other driver is ignored",
+			claim:   newClaimWithConfig(opaqueConfig("other.k8s.io", nil, `{"bringUpContainer":"app"}`)),
+			request: "nic",
+		},
+		{
+			name:    "other request is ignored",
+			claim:   newClaimWithConfig(opaqueConfig(driverName, []string{"other"}, `{"bringUpContainer":"app"}`)),
+			request: "nic",
+		},
+		{
+			name:    "main request applies to subrequest",
+			claim:   newClaimWithConfig(opaqueConfig(driverName, []string{"nic"}, `{"bringUpContainer":"app"}`)),
+			request: "nic/fast",
+			want:    DeviceConfig{BringUpContainer: "app"},
+		},
+		{
+			name: "claim config overrides class config",
+			claim: newClaimWithConfig(
+				opaqueConfig(driverName, nil, `{"bringUpContainer":"app"}`),
+				opaqueConfig(driverName, []string{"nic"}, `{"bringUpContainer":"sidecar"}`),
+			),
+			request: "nic",
+			want:    DeviceConfig{BringUpContainer: "sidecar"},
+		},
+		{
+			name:    "routes",
+			claim:   newClaimWithConfig(opaqueConfig(driverName, nil, `{"routes":[{"dst":"0.0.0.0/0","gw":"192.168.5.1","src":"192.168.5.10"}]}`)),
+			request: "nic",
+			want:    DeviceConfig{Routes: []kndnet.RouteConfig{{Dst: "0.0.0.0/0", Gw: "192.168.5.1", Src: "192.168.5.10"}}},
+		},
+		{
+			name:    "invalid route source",
+			claim:   newClaimWithConfig(opaqueConfig(driverName, nil, `{"routes":[{"dst":"0.0.0.0/0","src":"192.168.5"}]}`)),
+			request: "nic",
+			wantErr: true,
+		},
+		{
+			name:    "network",
+			claim:   newClaimWithConfig(opaqueConfig(driverName, nil, `{"network":{"addresses":["192.168.5.10/24"],"tables":[{"id":100,"routes":[{"dst":"0.0.0.0/0","gw":"192.168.5.1"}]}],"rules":[{"priority":100,"from":"192.168.5.10/32","table":100}]}}`)),
+			request: "nic",
+			want: DeviceConfig{Network: &kndnet.NetworkConfig{
+				Addresses: []string{"192.168.5.10/24"},
+				Tables:    []kndnet.RouteTable{{ID: 100, Routes: []kndnet.RouteConfig{{Dst: "0.0.0.0/0", Gw: "192.168.5.1"}}}},
+				Rules:     []kndnet.RuleConfig{{Priority: 100, From: "192.168.5.10/32", Table: 100}},
+			}},
+		},
+		{
+			name:    "network rule with undefined table",
+			claim:   newClaimWithConfig(opaqueConfig(driverName, nil, `{"network":{"rules":[{"priority":100,"from":"192.168.5.10/32","table":100}]}}`)),
+			request: "nic",
+			wantErr: true,
+		},
+		{
+			name:    "network and routes",
+			claim:   newClaimWithConfig(opaqueConfig(driverName, nil, `{"routes":[{"dst":"10.0.0.0/8"}],"network":{"addresses":["192.168.5.10/24"]}}`)),
+			request: "nic",
+			wantErr: true,
+		},
+		{
+			name:    "child",
+			claim:   newClaimWithConfig(opaqueConfig(driverName, nil, `{"child":{"type":"macvlan","uplink":"bond0"}}`)),
+			request: "nic",
+			want:    DeviceConfig{Child: &ChildConfig{Type: "macvlan", Uplink: "bond0"}},
+		},
+		{
+			name:    "invalid child type",
+			claim:   newClaimWithConfig(opaqueConfig(driverName, nil, `{"child":{"type":"veth"}}`)),
+			request: "nic",
+			wantErr: true,
+		},
+		{
+			name:    "mode move",
+			claim:   newClaimWithConfig(opaqueConfig(driverName, nil, `{"mode":"move"}`)),
+			request: "nic",
+			want:    DeviceConfig{Mode: AttachModeMove},
+		},
+		{
+			name:    "mode macvlan with ips",
+			claim:   newClaimWithConfig(opaqueConfig(driverName, nil, `{"mode":"macvlan","ips":["192.168.5.10/24"]}`)),
+			request: "nic",
+			want:    DeviceConfig{Mode: AttachModeMacvlan, IPs: []string{"192.168.5.10/24"}, Child: &ChildConfig{Type: "macvlan"}},
+		},
+		{
+			name:    "mode ipvlan with uplink",
+			claim:   newClaimWithConfig(opaqueConfig(driverName, nil, `{"mode":"ipvlan","child":{"type":"ipvlan","uplink":"bond0"}}`)),
+			request: "nic",
+			want:    DeviceConfig{Mode: AttachModeIPVlan, Child: &ChildConfig{Type: "ipvlan", Uplink: "bond0"}},
+		},
+		{
+			name:    "mode ipvlan l3 with ips",
+			claim:   newClaimWithConfig(opaqueConfig(driverName, nil, `{"mode":"ipvlan","ipvlanMode":"l3","ips":["192.168.5.10/24"]}`)),
+			request: "nic",
+			want:    DeviceConfig{Mode: AttachModeIPVlan, IPVlanMode: IPVlanModeL3, IPs: []string{"192.168.5.10/24"}, Child: &ChildConfig{Type: "ipvlan"}},
+		},
+		{
+			name:    "invalid ipvlan mode",
+			claim:   newClaimWithConfig(opaqueConfig(driverName, nil, `{"mode":"ipvlan","ipvlanMode":"l4"}`)),
+			request: "nic",
+			wantErr: true,
+		},
+		{
+			name:    "ipvlan mode without ipvlan child",
+			claim:   newClaimWithConfig(opaqueConfig(driverName, nil, `{"mode":"macvlan","ipvlanMode":"l3"}`)),
+			request: "nic",
+			wantErr: true,
+		},
+		{
+			name:    "mode and child type mismatch",
+			claim:   newClaimWithConfig(opaqueConfig(driverName, nil, `{"mode":"macvlan","child":{"type":"ipvlan"}}`)),
+			request: "nic",
+			wantErr: true,
+		},
+		{
+			name:    "mode move and child",
+			claim:   newClaimWithConfig(opaqueConfig(driverName, nil, `{"mode":"move","child":{"type":"macvlan"}}`)),
+			request: "nic",
+			wantErr: true,
+		},
+		{
+			name:    "mode macvlan and mtu",
+			claim:   newClaimWithConfig(opaqueConfig(driverName, nil, `{"mode":"macvlan","mtu":9000}`)),
+			request: "nic",
+			wantErr: true,
+		},
+		{
+			name:    "vlan",
+			claim:   newClaimWithConfig(opaqueConfig(driverName, nil, `{"vlan":100,"ips":["192.168.5.10/24"]}`)),
+			request: "nic",
+			want:    DeviceConfig{VLAN: 100, IPs: []string{"192.168.5.10/24"}, Child: &ChildConfig{Type: "vlan"}},
+		},
+		{
+			name:    "invalid vlan",
+			claim:   newClaimWithConfig(opaqueConfig(driverName, nil, `{"vlan":4095}`)),
+			request: "nic",
+			wantErr: true,
+		},
+		{
+			name:    "vlan and child",
+			claim:   newClaimWithConfig(opaqueConfig(driverName, nil, `{"vlan":100,"mode":"macvlan"}`)),
+			request: "nic",
+			wantErr: true,
+		},
+		{
+			name:    "vlan child type",
+			claim:   newClaimWithConfig(opaqueConfig(driverName, nil, `{"child":{"type":"vlan"}}`)),
+			request: "nic",
+			wantErr: true,
+		},
+		{
+			name:    "ethtool",
+			claim:   newClaimWithConfig(opaqueConfig(driverName, nil, `{"ethtool":{"features":{"tx-checksum-ip-generic":false},"rxRing":4096}}`)),
+			request: "nic",
+			want:    DeviceConfig{Ethtool: &kndnet.EthtoolConfig{Features: map[string]bool{"tx-checksum-ip-generic": false}, RxRing: 4096}},
+		},
+		{
+			name:    "empty ethtool",
+			claim:   newClaimWithConfig(opaqueConfig(driverName, nil, `{"ethtool":{}}`)),
+			request: "nic",
+			wantErr: true,
+		},
+		{
+			name:    "invalid mode",
+			claim:   newClaimWithConfig(opaqueConfig(driverName, nil, `{"mode":"veth"}`)),
+			request: "nic",
+			wantErr: true,
+		},
+		{
+			name:    "permanent mac",
+			claim:   newClaimWithConfig(opaqueConfig(driverName, nil, `{"permanentMAC":true}`)),
+			request: "nic",
+			want:    DeviceConfig{PermanentMAC: true},
+		},
+		{
+			name:    "permanent mac and child",
+			claim:   newClaimWithConfig(opaqueConfig(driverName, nil, `{"permanentMAC":true,"child":{"type":"macvlan"}}`)),
+			request: "nic",
+			wantErr: true,
+		},
+		{
+			name:    "hardware timestamping",
+			claim:   newClaimWithConfig(opaqueConfig(driverName, nil, `{"hardwareTimestamping":{"txType":"on","rxFilter":"ptpv2-event"}}`)),
+			request: "nic",
+			want:    DeviceConfig{HardwareTimestamping: &kndnet.HardwareTimestamping{TxType: "on", RxFilter: "ptpv2-event"}},
+		},
+		{
+			name:    "invalid hardware timestamping filter",
+			claim:   newClaimWithConfig(opaqueConfig(driverName, nil, `{"hardwareTimestamping":{"txType":"on","rxFilter":"ptp"}}`)),
+			request: "nic",
+			wantErr: true,
+		},
+		{
+			name:    "hardware timestamping and child",
+			claim:   newClaimWithConfig(opaqueConfig(driverName, nil, `{"hardwareTimestamping":{"txType":"on","rxFilter":"all"},"child":{"type":"macvlan"}}`)),
+			request: "nic",
+			wantErr: true,
+		},
+		{
+			name:    "multicast",
+			claim:   newClaimWithConfig(opaqueConfig(driverName, nil, `{"multicast":{"groups":["239.1.1.0/24","ff3e::/32"]}}`)),
+			request: "nic",
+			want:    DeviceConfig{Multicast: &kndnet.MulticastConfig{Groups: []string{"239.1.1.0/24", "ff3e::/32"}}},
+		},
+		{
+			name:    "multicast unicast group",
+			claim:   newClaimWithConfig(opaqueConfig(driverName, nil, `{"multicast":{"groups":["10.0.0.0/8"]}}`)),
+			request: "nic",
+			wantErr: true,
+		},
+		{
+			name:    "arp",
+			claim:   newClaimWithConfig(opaqueConfig(driverName, nil, `{"arp":{"announce":2,"ignore":1}}`)),
+			request: "nic",
+			want:    DeviceConfig{ARP: &ARPConfig{Announce: 2, Ignore: 1}},
+		},
+		{
+			name:    "invalid arp ignore",
+			claim:   newClaimWithConfig(opaqueConfig(driverName, nil, `{"arp":{"ignore":5}}`)),
+			request: "nic",
+			wantErr: true,
+		},
+		{
+			name:    "mtu",
+			claim:   newClaimWithConfig(opaqueConfig(driverName, nil, `{"mtu":9000}`)),
+			request: "nic",
+			want:    DeviceConfig{MTU: 9000},
+		},
+		{
+			name:    "invalid mtu",
+			claim:   newClaimWithConfig(opaqueConfig(driverName, nil, `{"mtu":70000}`)),
+			request: "nic",
+			wantErr: true,
+		},
+		{
+			name:    "mtu with child",
+			claim:   newClaimWithConfig(opaqueConfig(driverName, nil, `{"mtu":9000,"child":{"type":"macvlan"}}`)),
+			request: "nic",
+			wantErr: true,
+		},
+		{
+			name:    "numa",
+			claim:   newClaimWithConfig(opaqueConfig(driverName, nil, `{"numa":{"node":1,"policy":"strict"}}`)),
+			request: "nic",
+			want:    DeviceConfig{NUMA: &NUMAConfig{Node: 1, Policy: NUMAPolicyStrict}},
+		},
+		{
+			name:    "invalid numa policy",
+			claim:   newClaimWithConfig(opaqueConfig(driverName, nil, `{"numa":{"node":1,"policy":"required"}}`)),
+			request: "nic",
+			wantErr: true,
+		},
+		{
+			name:    "negative numa node",
+			claim:   newClaimWithConfig(opaqueConfig(driverName, nil, `{"numa":{"node":-1}}`)),
+			request: "nic",
+			wantErr: true,
+		},
+		{
+			name:    "carrier down ok",
+			claim:   newClaimWithConfig(opaqueConfig(driverName, nil, `{"carrierDownOK":true}`)),
+			request: "nic",
+			want:    DeviceConfig{CarrierDownOK: true},
+		},
+		{
+			name:    "policy routing",
+			claim:   newClaimWithConfig(opaqueConfig(driverName, nil, `{"policyRouting":{"table":100}}`)),
+			request: "nic",
+			want:    DeviceConfig{PolicyRouting: &PolicyRoutingConfig{Table: 100}},
+		},
+		{
+			name:    "policy routing reserved table",
+			claim:   newClaimWithConfig(opaqueConfig(driverName, nil, `{"policyRouting":{"table":254}}`)),
+			request: "nic",
+			wantErr: true,
+		},
+		{
+			name:    "policy routing fwmark",
+			claim:   newClaimWithConfig(opaqueConfig(driverName, nil, `{"policyRouting":{"fwmark":{"mark":16,"mask":255}}}`)),
+			request: "nic",
+			want:    DeviceConfig{PolicyRouting: &PolicyRoutingConfig{FwMark: &kndnet.FwMark{Mark: 16, Mask: 255}}},
+		},
+		{
+			name:    "policy routing fwmark outside of the mask",
+			claim:   newClaimWithConfig(opaqueConfig(driverName, nil, `{"policyRouting":{"fwmark":{"mark":256,"mask":255}}}`)),
+			request: "nic",
+			wantErr: true,
+		},
+		{
+			name:    "policy routing fwmark 0",
+			claim:   newClaimWithConfig(opaqueConfig(driverName, nil, `{"policyRouting":{"fwmark":{"mark":0}}}`)),
+			request: "nic",
+			wantErr: true,
+		},
+		{
+			name:    "policy routing with network",
+			claim:   newClaimWithConfig(opaqueConfig(driverName, nil, `{"policyRouting":{},"network":{"addresses":["192.168.5.10/24"]}}`)),
+			request: "nic",
+			wantErr: true,
+		},
+		{
+			name:    "ips",
+			claim:   newClaimWithConfig(opaqueConfig(driverName, nil, `{"ips":["192.168.5.10/24","fd00::10/64"]}`)),
+			request: "nic",
+			want:    DeviceConfig{IPs: []string{"192.168.5.10/24", "fd00::10/64"}},
+		},
+		{
+			name:    "invalid ip",
+			claim:   newClaimWithConfig(opaqueConfig(driverName, nil, `{"ips":["192.168.5.10"]}`)),
+			request: "nic",
+			wantErr: true,
+		},
+		{
+			name:    "duplicate ip",
+			claim:   newClaimWithConfig(opaqueConfig(driverName, nil, `{"ips":["192.168.5.10/24","192.168.5.10/32"]}`)),
+			request: "nic",
+			wantErr: true,
+		},
+		{
+			name:    "ips with network",
+			claim:   newClaimWithConfig(opaqueConfig(driverName, nil, `{"ips":["192.168.5.10/24"],"network":{"addresses":["192.168.5.10/24"]}}`)),
+			request: "nic",
+			wantErr: true,
+		},
+		{
+			name:    "interface name",
+			claim:   newClaimWithConfig(opaqueConfig(driverName, nil, `{"interfaceName":"net1"}`)),
+			request: "nic",
+			want:    DeviceConfig{InterfaceName: "net1"},
+		},
+		{
+			name:    "invalid interface name",
+			claim:   newClaimWithConfig(opaqueConfig(driverName, nil, `{"interfaceName":"net/1"}`)),
+			request: "nic",
+			wantErr: true,
+		},
+		{
+			name:    "interface name too long",
+			claim:   newClaimWithConfig(opaqueConfig(driverName, nil, `{"interfaceName":"secondary-network"}`)),
+			request: "nic",
+			wantErr: true,
+		},
+		{
+			name:    "network namespace",
+			claim:   newClaimWithConfig(opaqueConfig(driverName, nil, `{"networkNamespace":"volumes/kubernetes.io~empty-dir/netns/vrf"}`)),
+			request: "nic",
+			want:    DeviceConfig{NetworkNamespace: "volumes/kubernetes.io~empty-dir/netns/vrf"},
+		},
+		{
+			name:    "absolute network namespace",
+			claim:   newClaimWithConfig(opaqueConfig(driverName, nil, `{"networkNamespace":"/var/run/netns/host"}`)),
+			request: "nic",
+			wantErr: true,
+		},
+		{
+			name:    "network namespace outside of the pod",
+			claim:   newClaimWithConfig(opaqueConfig(driverName, nil, `{"networkNamespace":"volumes/../../other-pod/netns"}`)),
+			request: "nic",
+			wantErr: true,
+		},
+		{
+			name:    "readiness path",
+			claim:   newClaimWithConfig(opaqueConfig(driverName, nil, `{"readinessPath":"/run/knd"}`)),
+			request: "nic",
+			want:    DeviceConfig{ReadinessPath: "/run/knd"},
+		},
+		{
+			name:    "relative readiness path",
+			claim:   newClaimWithConfig(opaqueConfig(driverName, nil, `{"readinessPath":"run/knd"}`)),
+			request: "nic",
+			wantErr: true,
+		},
+		{
+			name:    "root readiness path",
+			claim:   newClaimWithConfig(opaqueConfig(driverName, nil, `{"readinessPath":"/"}`)),
+			request: "nic",
+			wantErr: true,
+		},
+		{
+			name:    "ssm",
+			claim:   newClaimWithConfig(opaqueConfig(driverName, nil, `{"ssm":{"joins":[{"source":"192.0.2.10","group":"232.1.1.1"}]}}`)),
+			request: "nic",
+			want:    DeviceConfig{SSM: &kndnet.SSMConfig{Joins: []kndnet.SourceGroup{{Source: "192.0.2.10", Group: "232.1.1.1"}}}},
+		},
+		{
+			name:    "invalid ssm source",
+			claim:   newClaimWithConfig(opaqueConfig(driverName, nil, `{"ssm":{"joins":[{"source":"232.1.1.2","group":"232.1.1.1"}]}}`)),
+			request: "nic",
+			wantErr: true,
+		},
+		{
+			name:    "egress rate",
+			claim:   newClaimWithConfig(opaqueConfig(driverName, nil, `{"egressRate":"1G"}`)),
+			request: "nic",
+			want:    DeviceConfig{EgressRate: pointer(resource.MustParse("1G"))},
+		},
+		{
+			name:    "zero egress rate",
+			claim:   newClaimWithConfig(opaqueConfig(driverName, nil, `{"egressRate":"0"}`)),
+			request: "nic",
+			wantErr: true,
+		},
+		{
+			name:    "hop limit",
+			claim:   newClaimWithConfig(opaqueConfig(driverName, nil, `{"hopLimit":128}`)),
+			request: "nic",
+			want:    DeviceConfig{HopLimit: 128},
+		},
+		{
+			name:    "invalid hop limit",
+			claim:   newClaimWithConfig(opaqueConfig(driverName, nil, `{"hopLimit":256}`)),
+			request: "nic",
+			wantErr: true,
+		},
+		{
+			name:    "negative hop limit",
+			claim:   newClaimWithConfig(opaqueConfig(driverName, nil, `{"hopLimit":-1}`)),
+			request: "nic",
+			wantErr: true,
+		},
+		{
+			name:    "sysctls",
+			claim:   newClaimWithConfig(opaqueConfig(driverName, nil, `{"interfaceName":"net1","sysctls":{"net.ipv4.conf.net1.rp_filter":"2"}}`)),
+			request: "nic",
+			want:    DeviceConfig{InterfaceName: "net1", Sysctls: map[string]string{"net.ipv4.conf.net1.rp_filter": "2"}},
+		},
+		{
+			name:    "global sysctl",
+			claim:   newClaimWithConfig(opaqueConfig(driverName, nil, `{"sysctls":{"net.ipv4.ip_forward":"1"}}`)),
+			request: "nic",
+			wantErr: true,
+		},
+		{
+			name:    "sysctl of all the interfaces",
+			claim:   newClaimWithConfig(opaqueConfig(driverName, nil, `{"sysctls":{"net.ipv4.conf.all.rp_filter":"2"}}`)),
+			request: "nic",
+			wantErr: true,
+		},
+		{
+			name:    "sysctl without value",
+			claim:   newClaimWithConfig(opaqueConfig(driverName, nil, `{"sysctls":{"net.ipv4.conf.net1.rp_filter":""}}`)),
+			request: "nic",
+			wantErr: true,
+		},
+		{
+			name:    "drain",
+			claim:   newClaimWithConfig(opaqueConfig(driverName, nil, `{"drain":{"delay":"500ms"}}`)),
+			request: "nic",
+			want:    DeviceConfig{Drain: &DrainConfig{Delay: metav1.Duration{Duration: 500 * time.Millisecond}}},
+		},
+		{
+			name:    "drain delay too long",
+			claim:   newClaimWithConfig(opaqueConfig(driverName, nil, `{"drain":{"delay":"1m"}}`)),
+			request: "nic",
+			wantErr: true,
+		},
+		{
+			name:    "unknown field",
+			claim:   newClaimWithConfig(opaqueConfig(driverName, nil, `{"bringUpContainers":"app"}`)),
+			request: "nic",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseDeviceConfig(driverName, tt.claim, tt.request)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseDeviceConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseDeviceConfig() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_selectUplink(t *testing.T) {
+	// eth1 is a bond slave, bond0 can host children and eth2 does not exist
+	canHost := func(ifName, childType string) error {
+		switch ifName {
+		case "bond0":
+			return nil
+		case "eth1":
+			return fmt.Errorf("interface %s is enslaved to another interface and cannot host a %s", ifName, childType)
+		}
+		return fmt.Errorf("link not found for interface %s", ifName)
+	}
+	tests := []struct {
+		name    string
+		device  string
+		child   ChildConfig
+		want    string
+		wantErr bool
+	}{
+		{name: "device hosts the child", device: "bond0", child: ChildConfig{Type: "macvlan", Uplink: "eth2"}, want: "bond0"},
+		{name: "fallback to uplink", device: "eth1", child: ChildConfig{Type: "macvlan", Uplink: "bond0"}, want: "bond0"},
+		{name: "no uplink", device: "eth1", child: ChildConfig{Type: "ipvlan"}, wantErr: true},
+		{name: "neither works", device: "eth1", child: ChildConfig{Type: "ipvlan", Uplink: "eth2"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := selectUplink(tt.device, tt.child, canHost)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("selectUplink() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("selectUplink() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
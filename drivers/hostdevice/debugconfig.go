@@ -0,0 +1,216 @@
+package main
+
+import (
+	"flag"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+// redacted replaces the secret values in the effective configuration.
+const redacted = "REDACTED"
+
+// secretFlagWords are the words of the flag names whose values are secrets,
+// the flags pointing to a file with the secret are not redacted.
+var secretFlagWords = []string{"token", "key", "password", "secret"}
+
+// EffectiveConfig is the configuration the driver is running with, the
+// resolved flags and the defaults not exposed as flags.
+type EffectiveConfig struct {
+	// Flags are the values of all the command line flags, set or default.
+	Flags map[string]string `json:"flags"`
+	// Driver is the configuration resolved from the flags.
+	Driver DriverConfig `json:"driver"`
+}
+
+// DriverConfig is the resolved configuration of the driver.
+type DriverConfig struct {
+	DriverName        string `json:"driverName"`
+	NodeName          string `json:"nodeName"`
+	NRIPluginName     string `json:"nriPluginName"`
+	NRIPluginIndex    string `json:"nriPluginIndex"`
+	PublishInterval   string `json:"publishInterval"`
+	ForcePublishAfter string `json:"forcePublishAfter"`
+	ReconcileInterval string `json:"reconcileInterval"`
+	// IgnoredInterfacePrefixes are never published, nor the loopback and the down interfaces.
+	IgnoredInterfacePrefixes []string `json:"ignoredInterfacePrefixes"`
+	// Blocklist are the interface names and MACs of the node blocklist annotation.
+	Blocklist             []string                       `json:"blocklist"`
+	AllowedDevices        []string                       `json:"allowedDevices,omitempty"`
+	InterfaceInclude      []string                       `json:"interfaceInclude,omitempty"`
+	InterfaceExclude      []string                       `json:"interfaceExclude,omitempty"`
+	ReservedInterfaces    []string                       `json:"reservedInterfaces,omitempty"`
+	AllowDefaultRouteLink bool                           `json:"allowDefaultRouteInterface"`
+	AllocationPolicy      AllocationPolicy               `json:"allocationPolicy"`
+	DeviceGrouping        DeviceGrouping                 `json:"deviceGrouping"`
+	DeviceGroups          map[string]string              `json:"deviceGroups,omitempty"`
+	PrepareFailureMode    PrepareFailureMode             `json:"prepareFailureMode"`
+	LinkUpFailureMode     LinkUpFailureMode              `json:"linkUpFailureMode"`
+	LinkUpRetries         int                            `json:"linkUpRetries"`
+	NamespaceRetries      int                            `json:"namespaceRetries"`
+	DADTimeout            string                         `json:"dadTimeout"`
+	MaxConcurrentNetnsOps int                            `json:"maxConcurrentNetnsOps"`
+	InitialPublishRetries int                            `json:"initialPublishRetries"`
+	DetachVerifyTimeout   string                         `json:"detachVerifyTimeout"`
+	BootSettleDelay       string                         `json:"bootSettleDelay"`
+	ClaimDeletionMode     ClaimDeletionMode              `json:"claimDeletionMode"`
+	CleanupChildren       bool                           `json:"cleanupOrphanedInterfaces"`
+	ReserveDevices        bool                           `json:"reservePreparedDevices"`
+	WatchLinks            bool                           `json:"watchLinks"`
+	MacvlanSlots          int                            `json:"macvlanSlots"`
+	StatusAnnotation      bool                           `json:"statusAnnotation"`
+	UtilizationInterval   string                         `json:"utilizationInterval"`
+	UtilizationAnnotation bool                           `json:"utilizationAnnotation"`
+	ErrorRateThreshold    float64                        `json:"errorRateThreshold"`
+	ErrorSampleInterval   string                         `json:"errorSampleInterval"`
+	SriovCreateVFs        bool                           `json:"sriovCreateVFs"`
+	SriovCleanupVFs       bool                           `json:"sriovCleanupVFs"`
+	SriovOnDemand         bool                           `json:"sriovOnDemandVFs"`
+	QoSDefaults           map[v1.PodQOSClass]QoSDefaults `json:"qosDefaults,omitempty"`
+	NamespaceQuotas       map[string]int                 `json:"namespaceQuotas,omitempty"`
+	DefaultNamespaceQuota int                            `json:"defaultNamespaceQuota"`
+	BandwidthFactor       float64                        `json:"bandwidthOversubscription"`
+	PreserveDNSRoutes     bool                           `json:"preserveDNSRoutes"`
+	ClusterDNS            []string                       `json:"clusterDNS"`
+	Webhook               *WebhookConfig                 `json:"webhook,omitempty"`
+	TeardownHook          string                         `json:"teardownHook,omitempty"`
+	TeardownHookTimeout   string                         `json:"teardownHookTimeout,omitempty"`
+}
+
+// WebhookConfig is the resolved configuration of the device event webhook.
+type WebhookConfig struct {
+	URL      string `json:"url"`
+	Token    string `json:"token,omitempty"`
+	Blocking bool   `json:"blocking"`
+	Timeout  string `json:"timeout"`
+}
+
+// effectiveConfig returns the configuration of the driver with the values of
+// the flags in fs. The secrets are redacted.
+func (k *NetworkDriver) effectiveConfig(fs *flag.FlagSet) EffectiveConfig {
+	config := EffectiveConfig{Flags: map[string]string{}}
+	fs.VisitAll(func(f *flag.Flag) {
+		config.Flags[f.Name] = redactFlag(f.Name, f.Value.String())
+	})
+
+	k.mu.Lock()
+	blocklist := k.blocklist.UnsortedList()
+	reservedInterfaces := sets.List(k.reservedInterfaces)
+	k.mu.Unlock()
+	slices.Sort(blocklist)
+
+	config.Driver = DriverConfig{
+		DriverName:               k.driverName,
+		NodeName:                 k.nodeName,
+		NRIPluginName:            k.nriPluginName,
+		NRIPluginIndex:           k.nriPluginIndex,
+		PublishInterval:          k.publishInterval.String(),
+		ForcePublishAfter:        k.forcePublishAfter.String(),
+		ReconcileInterval:        k.reconcileInterval.String(),
+		IgnoredInterfacePrefixes: ignoredInterfacePrefixes,
+		Blocklist:                blocklist,
+		AllowedDevices:           sets.List(k.allowlist),
+		InterfaceInclude:         k.interfaceFilter.include,
+		InterfaceExclude:         k.interfaceFilter.exclude,
+		ReservedInterfaces:       reservedInterfaces,
+		AllowDefaultRouteLink:    k.allowDefaultRouteInterface,
+		AllocationPolicy:         k.allocationPolicy,
+		DeviceGrouping:           k.deviceGrouping,
+		DeviceGroups:             k.deviceGroups,
+		PrepareFailureMode:       k.failureMode,
+		LinkUpFailureMode:        k.linkUpFailureMode,
+		LinkUpRetries:            k.linkUpRetries,
+		NamespaceRetries:         k.namespaceRetries,
+		DADTimeout:               k.dadTimeout.String(),
+		MaxConcurrentNetnsOps:    k.maxNetnsOps,
+		InitialPublishRetries:    k.initialPublishRetries,
+		DetachVerifyTimeout:      k.detachVerifyTimeout.String(),
+		BootSettleDelay:          k.bootSettleDelay.String(),
+		ClaimDeletionMode:        k.claimDeletionMode,
+		CleanupChildren:          k.cleanupChildren,
+		ReserveDevices:           k.reserveDevices,
+		WatchLinks:               k.watchLinks,
+		MacvlanSlots:             k.macvlanSlots,
+		StatusAnnotation:         k.statusAnnotation,
+		UtilizationInterval:      k.utilizationInterval.String(),
+		UtilizationAnnotation:    k.utilizationAnnotation,
+		ErrorRateThreshold:       k.errorRateThreshold,
+		ErrorSampleInterval:      k.errorSampleInterval.String(),
+		SriovCreateVFs:           k.sriovCreateVFs,
+		SriovCleanupVFs:          k.sriovCleanupVFs,
+		SriovOnDemand:            k.sriovOnDemand,
+		QoSDefaults:              k.qosDefaults,
+		NamespaceQuotas:          k.namespaceQuotas,
+		DefaultNamespaceQuota:    k.defaultNamespaceQuota,
+		BandwidthFactor:          k.bandwidthOversubscription,
+		PreserveDNSRoutes:        k.preserveDNS,
+		ClusterDNS:               []string{},
+	}
+	for _, ip := range k.clusterDNS {
+		config.Driver.ClusterDNS = append(config.Driver.ClusterDNS, ip.String())
+	}
+	if k.webhook != nil {
+		config.Driver.Webhook = &WebhookConfig{
+			URL:      redactURL(k.webhook.url),
+			Blocking: k.webhook.blocking,
+			Timeout:  k.webhook.client.Timeout.String(),
+		}
+		if k.webhook.token != "" {
+			config.Driver.Webhook.Token = redacted
+		}
+	}
+	if k.teardownHook != nil {
+		config.Driver.TeardownHook = k.teardownHook.path
+		config.Driver.TeardownHookTimeout = k.teardownHook.timeout.String()
+	}
+	return config
+}
+
+// redactFlag hides the value of the flags holding secrets and the
+// credentials of the URLs.
+func redactFlag(name, value string) string {
+	if value == "" {
+		return value
+	}
+	if strings.HasSuffix(name, "-file") || strings.HasSuffix(name, "-path") {
+		return value
+	}
+	for _, word := range strings.Split(name, "-") {
+		if slices.Contains(secretFlagWords, word) {
+			return redacted
+		}
+	}
+	if strings.Contains(value, "://") {
+		return redactURL(value)
+	}
+	return value
+}
+
+// redactURL hides the user information and the query, that may carry
+// credentials, of rawURL.
+func redactURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return redacted
+	}
+	if u.User != nil {
+		u.User = url.User(redacted)
+	}
+	if u.RawQuery != "" {
+		u.RawQuery = redacted
+	}
+	return u.String()
+}
+
+// debugConfigHandler serves the effective configuration at GET /debug/config.
+func (k *NetworkDriver) debugConfigHandler(fs *flag.FlagSet) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /debug/config", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, k.effectiveConfig(fs))
+	})
+	return mux
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/vishvananda/netlink"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog/v2"
+)
+
+// defaultRouteInterfaces returns the names of the host interfaces that carry
+// the default route of the node: the interfaces of the default routes, the
+// interfaces a VLAN, macvlan or ipvlan with the default route is created on,
+// and the members of a bond or bridge with the default route. Moving any of
+// them into a pod cuts the node off.
+func defaultRouteInterfaces(links []netlink.Link, indexes []int) sets.Set[string] {
+	byIndex := map[int]netlink.Link{}
+	for _, link := range links {
+		byIndex[link.Attrs().Index] = link
+	}
+	carrying := sets.New(indexes...)
+	for changed := true; changed; {
+		changed = false
+		for _, link := range links {
+			attrs := link.Attrs()
+			var add int
+			switch {
+			case carrying.Has(attrs.Index) && isStackedLink(link) && attrs.ParentIndex > 0:
+				add = attrs.ParentIndex
+			case !carrying.Has(attrs.Index) && attrs.MasterIndex > 0 && carrying.Has(attrs.MasterIndex):
+				add = attrs.Index
+			}
+			if add != 0 && !carrying.Has(add) {
+				carrying.Insert(add)
+				changed = true
+			}
+		}
+	}
+	names := sets.New[string]()
+	for index := range carrying {
+		if link, ok := byIndex[index]; ok {
+			names.Insert(link.Attrs().Name)
+		}
+	}
+	return names
+}
+
+// isStackedLink returns true if the link is created on top of a lower
+// interface of the same namespace, its parent.
+func isStackedLink(link netlink.Link) bool {
+	switch link.Type() {
+	case "vlan", "macvlan", "ipvlan":
+		return true
+	}
+	return false
+}
+
+// skippedDefaultRouteInterfaces returns the host interfaces carrying the
+// default route, which are not published unless allowed. A warning is logged
+// the first time each of them is skipped so the operators know why it is
+// missing from the published devices.
+func (k *NetworkDriver) skippedDefaultRouteInterfaces(links []netlink.Link) (sets.Set[string], error) {
+	if k.allowDefaultRouteInterface {
+		return nil, nil
+	}
+	indexes, err := k.host.defaultRouteLinks()
+	if err != nil {
+		return nil, fmt.Errorf("failed to find the interfaces with the default route: %w", err)
+	}
+	names := defaultRouteInterfaces(links, indexes)
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	for name := range names.Difference(k.defaultRouteSkipped) {
+		klog.Warningf("Not publishing device %s, it carries the default route of the node, use --allow-default-route-interface to publish it", name)
+	}
+	k.defaultRouteSkipped = names
+	return names, nil
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/vishvananda/netlink"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func Test_defaultRouteInterfaces(t *testing.T) {
+	links := []netlink.Link{
+		&netlink.Device{LinkAttrs: netlink.LinkAttrs{Index: 2, Name: "eth0", MasterIndex: 10}},
+		&netlink.Device{LinkAttrs: netlink.LinkAttrs{Index: 3, Name: "eth1", MasterIndex: 10}},
+		&netlink.Device{LinkAttrs: netlink.LinkAttrs{Index: 4, Name: "eth2"}},
+		&netlink.Device{LinkAttrs: netlink.LinkAttrs{Index: 5, Name: "eth3"}},
+		&netlink.Bond{LinkAttrs: netlink.LinkAttrs{Index: 10, Name: "bond0"}},
+		&netlink.Vlan{LinkAttrs: netlink.LinkAttrs{Index: 11, Name: "bond0.100", ParentIndex: 10}},
+		&netlink.Vlan{LinkAttrs: netlink.LinkAttrs{Index: 12, Name: "eth2.200", ParentIndex: 4}},
+		// the peer of a veth is not its lower interface
+		&netlink.Veth{LinkAttrs: netlink.LinkAttrs{Index: 13, Name: "veth0", ParentIndex: 5}},
+	}
+	tests := []struct {
+		name    string
+		indexes []int
+		want    []string
+	}{
+		{name: "no default route", want: []string{}},
+		{name: "physical interface", indexes: []int{4}, want: []string{"eth2"}},
+		{name: "bond members", indexes: []int{10}, want: []string{"bond0", "eth0", "eth1"}},
+		{name: "vlan on a bond", indexes: []int{11}, want: []string{"bond0", "bond0.100", "eth0", "eth1"}},
+		{name: "multipath", indexes: []int{4, 12}, want: []string{"eth2", "eth2.200"}},
+		{name: "veth", indexes: []int{13}, want: []string{"veth0"}},
+		{name: "unknown index", indexes: []int{99}, want: []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := sets.List(defaultRouteInterfaces(links, tt.indexes))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func Test_skippedDefaultRouteInterfaces(t *testing.T) {
+	var routeErr error
+	k := NewNetworkDriver(driverName, "node1", fake.NewClientset())
+	k.host.defaultRouteLinks = func() ([]int, error) {
+		return []int{2}, routeErr
+	}
+	links := []netlink.Link{
+		&netlink.Device{LinkAttrs: netlink.LinkAttrs{Index: 2, Name: "eth0"}},
+		&netlink.Device{LinkAttrs: netlink.LinkAttrs{Index: 3, Name: "eth1"}},
+	}
+
+	skipped, err := k.skippedDefaultRouteInterfaces(links)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := sets.List(skipped); !reflect.DeepEqual(got, []string{"eth0"}) {
+		t.Errorf("expected eth0 to be skipped, got %v", got)
+	}
+	if !k.defaultRouteSkipped.Has("eth0") {
+		t.Errorf("expected eth0 to be recorded as skipped")
+	}
+
+	// the interfaces are not published if the default route is unknown
+	routeErr = errors.New("netlink failure")
+	if _, err := k.skippedDefaultRouteInterfaces(links); err == nil {
+		t.Errorf("expected an error when the routes cannot be listed")
+	}
+
+	k.allowDefaultRouteInterface = true
+	skipped, err = k.skippedDefaultRouteInterfaces(links)
+	if err != nil || skipped.Len() != 0 {
+		t.Errorf("expected nothing skipped when allowed, got %v %v", skipped, err)
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/containerd/nri/pkg/api"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// defaultErrorSampleInterval is how often the error counters of the
+	// devices are sampled by default.
+	defaultErrorSampleInterval = 30 * time.Second
+	// deviceErrorsReason is the reason of the events of the devices whose
+	// errors or drops are above the threshold.
+	deviceErrorsReason = "DeviceErrorsExceeded"
+)
+
+// errorSample is a snapshot of the error and drop counters of a device.
+type errorSample struct {
+	errors uint64
+	drops  uint64
+	time   time.Time
+	// exceeded is true while the rates are above the threshold, so a
+	// degrading device is reported once and again only after it recovers.
+	exceeded bool
+}
+
+// deviceErrorSamples are the last error samples of the attached devices, by
+// pod and device.
+type deviceErrorSamples struct {
+	mu      sync.Mutex
+	samples map[string]errorSample
+}
+
+func errorSampleKey(podUID types.UID, device string) string {
+	return string(podUID) + "/" + device
+}
+
+// reset forgets the sample of a device, the next sample is the baseline of
+// the newly attached device.
+func (s *deviceErrorSamples) reset(podUID types.UID, device string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.samples, errorSampleKey(podUID, device))
+}
+
+// watchDeviceErrors periodically samples the error and drop counters of the
+// devices attached to pods and emits an event on the pod when their rate is
+// above the threshold, a sign of a degrading device or link.
+func (k *NetworkDriver) watchDeviceErrors(ctx context.Context) {
+	ticker := time.NewTicker(k.errorSampleInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			k.sampleDeviceErrorsOnce(now)
+		}
+	}
+}
+
+// sampleDeviceErrorsOnce takes a new sample of the attached devices and
+// reports the ones whose errors or drops per second since the previous one
+// are above the threshold.
+func (k *NetworkDriver) sampleDeviceErrorsOnce(now time.Time) {
+	type target struct {
+		pod       *api.PodSandbox
+		device    string
+		namespace string
+		ifName    string
+	}
+	var targets []target
+	k.mu.Lock()
+	for podUID, devices := range k.sharedState.PodDeviceConfig {
+		name := k.sharedState.PodNames[podUID]
+		for _, device := range devices {
+			prepared, ok := findPreparedDevice(k.sharedState.PreparedData[podUID], device.Name)
+			if !ok || prepared.State != DeviceStateAttached || device.NetworkNamespace == "" {
+				continue
+			}
+			targets = append(targets, target{
+				pod:       &api.PodSandbox{Uid: string(podUID), Namespace: name.Namespace, Name: name.Name},
+				device:    device.Name,
+				namespace: device.NetworkNamespace,
+				ifName:    prepared.podInterface(),
+			})
+		}
+	}
+	k.mu.Unlock()
+
+	k.deviceErrors.mu.Lock()
+	defer k.deviceErrors.mu.Unlock()
+	if k.deviceErrors.samples == nil {
+		k.deviceErrors.samples = map[string]errorSample{}
+	}
+	sampled := map[string]bool{}
+	for _, t := range targets {
+		stats, err := k.host.linkStatistics(t.namespace, t.ifName)
+		if err != nil {
+			klog.V(4).Infof("failed to sample the errors of device %s of pod %s/%s: %v", t.device, t.pod.Namespace, t.pod.Name, err)
+			continue
+		}
+		key := errorSampleKey(types.UID(t.pod.Uid), t.device)
+		cur := errorSample{
+			errors: stats.RxErrors + stats.TxErrors,
+			drops:  stats.RxDropped + stats.TxDropped,
+			time:   now,
+		}
+		prev, ok := k.deviceErrors.samples[key]
+		sampled[key] = true
+		elapsed := cur.time.Sub(prev.time).Seconds()
+		// the first sample is the baseline, as a reset of the counters
+		if !ok || elapsed <= 0 || cur.errors < prev.errors || cur.drops < prev.drops {
+			k.deviceErrors.samples[key] = cur
+			continue
+		}
+		errorRate := float64(cur.errors-prev.errors) / elapsed
+		dropRate := float64(cur.drops-prev.drops) / elapsed
+		cur.exceeded = errorRate > k.errorRateThreshold || dropRate > k.errorRateThreshold
+		k.deviceErrors.samples[key] = cur
+		if !cur.exceeded {
+			if prev.exceeded {
+				klog.Infof("Errors of device %s of pod %s/%s are below the threshold again", t.device, t.pod.Namespace, t.pod.Name)
+			}
+			continue
+		}
+		if prev.exceeded {
+			continue
+		}
+		klog.Warningf("Device %s of pod %s/%s has %.1f errors/s and %.1f drops/s", t.device, t.pod.Namespace, t.pod.Name, errorRate, dropRate)
+		k.recordPodEvent(t.pod, v1.EventTypeWarning, deviceErrorsReason,
+			"Node %s: device %s has %.1f errors/s and %.1f drops/s, above the threshold of %g/s", k.nodeName, t.device, errorRate, dropRate, k.errorRateThreshold)
+	}
+	for key := range k.deviceErrors.samples {
+		if !sampled[key] {
+			delete(k.deviceErrors.samples, key)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/vishvananda/netlink"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+)
+
+func Test_sampleDeviceErrorsOnce(t *testing.T) {
+	var stats netlink.LinkStatistics
+	var sampled []string
+	k := NewNetworkDriver(driverName, "node1", fake.NewClientset())
+	k.host.linkStatistics = func(containerNsPath string, ifName string) (*netlink.LinkStatistics, error) {
+		sampled = append(sampled, containerNsPath+" "+ifName)
+		s := stats
+		return &s, nil
+	}
+
+	recorder := record.NewFakeRecorder(10)
+	k.eventRecorder = recorder
+	k.errorRateThreshold = 1
+	k.sharedState.PodNames["pod-uid"] = types.NamespacedName{Namespace: "ns", Name: "pod"}
+	k.sharedState.PodDeviceConfig["pod-uid"] = []AllocatedDevice{
+		{Name: "eth1", NetworkNamespace: "/run/netns/pod"},
+		{Name: "eth2", NetworkNamespace: "/run/netns/pod"},
+	}
+	k.sharedState.PreparedData["pod-uid"] = []PreparedDevice{
+		{DeviceName: "eth1", State: DeviceStateAttached, Config: DeviceConfig{InterfaceName: "net1"}},
+		// not attached yet
+		{DeviceName: "eth2"},
+	}
+
+	start := time.Now()
+	steps := []struct {
+		name      string
+		errors    uint64
+		drops     uint64
+		at        time.Duration
+		wantEvent string
+	}{
+		{name: "baseline", errors: 1000, drops: 1000},
+		{name: "below the threshold", errors: 1010, drops: 1010, at: 10 * time.Second},
+		{
+			name:      "errors above the threshold",
+			errors:    1110,
+			drops:     1010,
+			at:        20 * time.Second,
+			wantEvent: "Warning DeviceErrorsExceeded Node node1: device eth1 has 10.0 errors/s and 0.0 drops/s, above the threshold of 1/s",
+		},
+		{name: "still above the threshold", errors: 1210, drops: 1210, at: 30 * time.Second},
+		{name: "recovered", errors: 1210, drops: 1210, at: 40 * time.Second},
+		{
+			name:      "drops above the threshold",
+			errors:    1210,
+			drops:     1260,
+			at:        50 * time.Second,
+			wantEvent: "Warning DeviceErrorsExceeded Node node1: device eth1 has 0.0 errors/s and 5.0 drops/s, above the threshold of 1/s",
+		},
+		{name: "counters reset", errors: 0, drops: 0, at: 60 * time.Second},
+		{name: "after the reset", errors: 5, drops: 5, at: 70 * time.Second},
+	}
+	for _, step := range steps {
+		stats.RxErrors, stats.TxErrors = step.errors/2, step.errors-step.errors/2
+		stats.RxDropped, stats.TxDropped = step.drops, 0
+		k.sampleDeviceErrorsOnce(start.Add(step.at))
+		var event string
+		select {
+		case event = <-recorder.Events:
+		default:
+		}
+		if event != step.wantEvent {
+			t.Errorf("%s: expected event %q, got %q", step.name, step.wantEvent, event)
+		}
+	}
+	if len(sampled) != len(steps) || sampled[0] != "/run/netns/pod net1" {
+		t.Errorf("expected only the attached device to be sampled in the pod, got %v", sampled)
+	}
+
+	// a device attached again starts from a new baseline
+	stats.RxErrors, stats.TxErrors, stats.RxDropped = 0, 0, 0
+	k.sampleDeviceErrorsOnce(start.Add(80 * time.Second))
+	k.deviceErrors.reset("pod-uid", "eth1")
+	stats.RxErrors = 1000
+	k.sampleDeviceErrorsOnce(start.Add(90 * time.Second))
+	select {
+	case event := <-recorder.Events:
+		t.Errorf("expected no event after the reset, got %q", event)
+	default:
+	}
+
+	// the samples of the devices no longer attached are dropped
+	delete(k.sharedState.PodDeviceConfig, "pod-uid")
+	k.sampleDeviceErrorsOnce(start.Add(100 * time.Second))
+	if len(k.deviceErrors.samples) != 0 {
+		t.Errorf("expected no samples left, got %v", k.deviceErrors.samples)
+	}
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/vishvananda/netlink"
+	v1 "k8s.io/api/core/v1"
+	resourceapi "k8s.io/api/resource/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	kndnet "github.com/aojea/kubernetes-network-drivers/pkg/net"
+)
+
+const (
+	// deviceGroupAttribute is the attribute with the group of the device, so a
+	// claim can request all the devices of a group with a matchAttribute constraint.
+	deviceGroupAttribute resourceapi.QualifiedName = "group"
+	// partialGroupReason is the reason of the events of the claims refused
+	// because they allocate only some of the devices of a group.
+	partialGroupReason = "PartialDeviceGroup"
+)
+
+// DeviceGrouping defines how the devices that must be allocated together,
+// like the ports of a dual-port card used for redundancy, are grouped.
+type DeviceGrouping string
+
+const (
+	// DeviceGroupingNone does not group the devices.
+	DeviceGroupingNone DeviceGrouping = "none"
+	// DeviceGroupingPCI groups the physical functions of the same PCI device,
+	// the ports of a card.
+	DeviceGroupingPCI DeviceGrouping = "pci"
+	// DeviceGroupingConfig groups the interfaces listed in the device groups file.
+	DeviceGroupingConfig DeviceGrouping = "config"
+)
+
+// parseDeviceGrouping validates the device grouping name.
+func parseDeviceGrouping(grouping string) (DeviceGrouping, error) {
+	switch DeviceGrouping(grouping) {
+	case DeviceGroupingNone, DeviceGroupingPCI, DeviceGroupingConfig:
+		return DeviceGrouping(grouping), nil
+	}
+	return "", fmt.Errorf("invalid device grouping %q, must be %s, %s or %s", grouping, DeviceGroupingNone, DeviceGroupingPCI, DeviceGroupingConfig)
+}
+
+// loadDeviceGroups reads the JSON object at path mapping the group names to
+// the interfaces in them, and returns the group of each interface.
+func loadDeviceGroups(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read device groups %s: %w", path, err)
+	}
+	var groups map[string][]string
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&groups); err != nil {
+		return nil, fmt.Errorf("failed to decode device groups %s: %w", path, err)
+	}
+	byInterface := map[string]string{}
+	for group, names := range groups {
+		if group == "" {
+			return nil, fmt.Errorf("device group without name")
+		}
+		if len(names) == 0 {
+			return nil, fmt.Errorf("device group %s has no interfaces", group)
+		}
+		for _, name := range names {
+			if !validInterfaceName(name) {
+				return nil, fmt.Errorf("invalid interface name %q in device group %s", name, group)
+			}
+			if other, ok := byInterface[name]; ok {
+				return nil, fmt.Errorf("interface %s is in device groups %s and %s", name, other, group)
+			}
+			byInterface[name] = group
+		}
+	}
+	return byInterface, nil
+}
+
+// pciSlot returns the PCI device, domain:bus:device, of the physical function
+// backing ifName, the ports of a card share it. The virtual functions and the
+// interfaces not backed by a PCI device are not in any slot.
+func pciSlot(ifName string) (string, error) {
+	if _, err := kndnet.PhysfnPCIAddress(ifName); err == nil {
+		return "", fmt.Errorf("interface %s is a virtual function", ifName)
+	}
+	address, err := kndnet.PCIAddress(ifName)
+	if err != nil {
+		return "", err
+	}
+	address, err = normalizePCIAddress(address)
+	if err != nil {
+		return "", err
+	}
+	return address[:strings.LastIndex(address, ".")], nil
+}
+
+// hostInterfaces returns the names of the interfaces of the host namespace.
+func hostInterfaces() ([]string, error) {
+	links, err := netlink.LinkList()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list network interfaces: %w", err)
+	}
+	names := make([]string, 0, len(links))
+	for _, link := range links {
+		names = append(names, link.Attrs().Name)
+	}
+	return names, nil
+}
+
+// deviceGroupOf returns the group of the device, empty if it is not in any.
+func (k *NetworkDriver) deviceGroupOf(deviceName string) string {
+	switch k.deviceGrouping {
+	case DeviceGroupingPCI:
+		slot, err := k.host.pciSlot(deviceName)
+		if err != nil {
+			return ""
+		}
+		return slot
+	case DeviceGroupingConfig:
+		return k.deviceGroups[deviceName]
+	}
+	return ""
+}
+
+// addGroupAttribute publishes the group of the device, devices not in any
+// group are not modified.
+func (k *NetworkDriver) addGroupAttribute(device *resourceapi.Device) {
+	group := k.deviceGroupOf(device.Name)
+	if group == "" {
+		return
+	}
+	device.Attributes[deviceGroupAttribute] = resourceapi.DeviceAttribute{StringValue: &group}
+}
+
+// groupMembers returns the devices of the group, the ones on the host and
+// the ones prepared for claims, that may be in the pods.
+func (k *NetworkDriver) groupMembers(group string) (sets.Set[string], error) {
+	members := sets.New[string]()
+	k.mu.Lock()
+	for _, devices := range k.sharedState.PreparedData {
+		for _, device := range devices {
+			if device.Group == group {
+				members.Insert(device.DeviceName)
+			}
+		}
+	}
+	k.mu.Unlock()
+	if k.deviceGrouping == DeviceGroupingConfig {
+		for name, g := range k.deviceGroups {
+			if g == group && k.host.hostLinkExists(name) {
+				members.Insert(name)
+			}
+		}
+		return members, nil
+	}
+	names, err := k.host.hostInterfaces()
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		if k.deviceGroupOf(name) == group {
+			members.Insert(name)
+		}
+	}
+	return members, nil
+}
+
+// checkDeviceGroups returns an error if the claim is allocated some of the
+// devices of a group but not all of them, the devices of a group are only
+// prepared together.
+func (k *NetworkDriver) checkDeviceGroups(claim *resourceapi.ResourceClaim) error {
+	if k.deviceGrouping == DeviceGroupingNone || claim.Status.Allocation == nil {
+		return nil
+	}
+	allocated := sets.New[string]()
+	groups := sets.New[string]()
+	for _, result := range claim.Status.Allocation.Devices.Results {
+		if result.Driver != k.driverName {
+			continue
+		}
+		allocated.Insert(result.Device)
+		if group := k.deviceGroupOf(result.Device); group != "" {
+			groups.Insert(group)
+		}
+	}
+	for _, group := range sets.List(groups) {
+		members, err := k.groupMembers(group)
+		if err != nil {
+			return fmt.Errorf("failed to get the devices of group %s: %w", group, err)
+		}
+		if missing := members.Difference(allocated); missing.Len() > 0 {
+			return fmt.Errorf("claim %s/%s is allocated %v of device group %s without %v, the devices of a group must be allocated together",
+				claim.Namespace, claim.Name, sets.List(members.Intersection(allocated)), group, sets.List(missing))
+		}
+	}
+	return nil
+}
+
+// recordPartialGroup emits a warning event on the claim refused for allocating part of a group.
+func (k *NetworkDriver) recordPartialGroup(claim *resourceapi.ResourceClaim, err error) {
+	if k.eventRecorder == nil {
+		return
+	}
+	k.eventRecorder.Eventf(claim, v1.EventTypeWarning, partialGroupReason, "Node %s: %v", k.nodeName, err)
+}
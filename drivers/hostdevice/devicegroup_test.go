@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	resourceapi "k8s.io/api/resource/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+)
+
+func Test_loadDeviceGroups(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    map[string]string
+		wantErr bool
+	}{
+		{name: "groups", content: `{"card0":["eth1","eth2"],"card1":["eth3"]}`, want: map[string]string{"eth1": "card0", "eth2": "card0", "eth3": "card1"}},
+		{name: "interface in two groups", content: `{"card0":["eth1","eth2"],"card1":["eth2"]}`, wantErr: true},
+		{name: "empty group", content: `{"card0":[]}`, wantErr: true},
+		{name: "invalid name", content: `{"card0":["eth1:0"]}`, wantErr: true},
+		{name: "invalid json", content: `["eth1"]`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "groups.json")
+			if err := os.WriteFile(path, []byte(tt.content), 0600); err != nil {
+				t.Fatal(err)
+			}
+			got, err := loadDeviceGroups(path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("loadDeviceGroups() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("loadDeviceGroups() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// newClaimWithDevices returns a claim allocated the devices.
+func newClaimWithDevices(uid types.UID, devices ...string) *resourceapi.ResourceClaim {
+	claim := newClaimWithConfig()
+	claim.Namespace, claim.Name, claim.UID = "default", string(uid), uid
+	claim.Status.Allocation.Devices.Results = nil
+	for _, device := range devices {
+		claim.Status.Allocation.Devices.Results = append(claim.Status.Allocation.Devices.Results,
+			resourceapi.DeviceRequestAllocationResult{Request: "nic", Driver: driverName, Device: device})
+	}
+	return claim
+}
+
+func Test_PrepareResourceClaims_deviceGroups(t *testing.T) {
+	k := NewNetworkDriver(driverName, "node1", fake.NewClientset())
+	k.host.hostLinkExists = func(ifName string) bool { return ifName != "eth4" }
+
+	k.checkpointPath = ""
+	recorder := record.NewFakeRecorder(10)
+	k.eventRecorder = recorder
+	k.deviceGrouping = DeviceGroupingConfig
+	// eth4 is not on the host, the group is allocated without it
+	k.deviceGroups = map[string]string{"eth1": "card0", "eth2": "card0", "eth3": "card1", "eth4": "card1"}
+
+	claim := newClaimWithDevices("partial", "eth1")
+	results, err := k.PrepareResourceClaims(context.Background(), []*resourceapi.ResourceClaim{claim})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := results[claim.UID].Err; err == nil || !strings.Contains(err.Error(), "without [eth2]") {
+		t.Errorf("expected a partial group error, got %v", err)
+	}
+	if _, ok := k.sharedState.PreparedData[claim.UID]; ok {
+		t.Errorf("expected the partial claim not to be prepared")
+	}
+	select {
+	case event := <-recorder.Events:
+		if !strings.HasPrefix(event, "Warning "+partialGroupReason) {
+			t.Errorf("unexpected event %q", event)
+		}
+	default:
+		t.Errorf("expected an event for the partial group")
+	}
+
+	claim = newClaimWithDevices("group", "eth1", "eth2", "eth3")
+	results, err = k.PrepareResourceClaims(context.Background(), []*resourceapi.ResourceClaim{claim})
+	if err != nil || results[claim.UID].Err != nil {
+		t.Fatalf("unexpected error: %v %v", err, results[claim.UID].Err)
+	}
+	var groups []string
+	for _, device := range k.sharedState.PreparedData[claim.UID] {
+		groups = append(groups, device.DeviceName+"="+device.Group)
+	}
+	if want := []string{"eth1=card0", "eth2=card0", "eth3=card1"}; !reflect.DeepEqual(groups, want) {
+		t.Errorf("expected prepared groups %v, got %v", want, groups)
+	}
+}
+
+func Test_checkDeviceGroups_pci(t *testing.T) {
+	slots := map[string]string{"eth1": "0000:3b:00", "eth2": "0000:3b:00", "eth3": "0000:5e:00"}
+	k := NewNetworkDriver(driverName, "node1", fake.NewClientset())
+	k.host.pciSlot = func(ifName string) (string, error) {
+		if slot, ok := slots[ifName]; ok {
+			return slot, nil
+		}
+		return "", fmt.Errorf("interface %s is not a PCI device", ifName)
+	}
+	// eth2 is attached to a pod
+	k.host.hostInterfaces = func() ([]string, error) { return []string{"lo", "eth1", "eth3", "veth0"}, nil }
+
+	k.deviceGrouping = DeviceGroupingPCI
+	k.sharedState.PreparedData["pod-uid"] = []PreparedDevice{{DeviceName: "eth2", Group: "0000:3b:00", State: DeviceStateAttached}}
+
+	if err := k.checkDeviceGroups(newClaimWithDevices("claim", "eth1")); err == nil || !strings.Contains(err.Error(), "without [eth2]") {
+		t.Errorf("expected a partial group error, got %v", err)
+	}
+	if err := k.checkDeviceGroups(newClaimWithDevices("claim", "eth3")); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	// devices not backed by a PCI device are not grouped
+	if err := k.checkDeviceGroups(newClaimWithDevices("claim", "veth0")); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	k.deviceGrouping = DeviceGroupingNone
+	if err := k.checkDeviceGroups(newClaimWithDevices("claim", "eth1")); err != nil {
+		t.Errorf("unexpected error without grouping: %v", err)
+	}
+}
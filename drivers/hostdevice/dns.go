@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog/v2"
+
+	kndnet "github.com/aojea/kubernetes-network-drivers/pkg/net"
+)
+
+const (
+	// clusterDNSNamespace and clusterDNSService are the Service of the cluster
+	// DNS discovered when --cluster-dns is not set.
+	clusterDNSNamespace = "kube-system"
+	clusterDNSService   = "kube-dns"
+)
+
+// parseClusterDNS parses the comma separated list of the cluster DNS IPs.
+func parseClusterDNS(value string) ([]net.IP, error) {
+	var ips []net.IP
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		ip := net.ParseIP(entry)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid cluster DNS IP %q", entry)
+		}
+		ips = append(ips, ip)
+	}
+	return ips, nil
+}
+
+// discoverClusterDNS returns the cluster IPs of the cluster DNS Service.
+func discoverClusterDNS(ctx context.Context, client kubernetes.Interface) ([]net.IP, error) {
+	svc, err := client.CoreV1().Services(clusterDNSNamespace).Get(ctx, clusterDNSService, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the cluster DNS Service %s/%s: %w", clusterDNSNamespace, clusterDNSService, err)
+	}
+	clusterIPs := svc.Spec.ClusterIPs
+	if len(clusterIPs) == 0 && svc.Spec.ClusterIP != "" {
+		clusterIPs = []string{svc.Spec.ClusterIP}
+	}
+	var ips []net.IP
+	for _, clusterIP := range clusterIPs {
+		if ip := net.ParseIP(clusterIP); ip != nil {
+			ips = append(ips, ip)
+		}
+	}
+	if len(ips) == 0 {
+		return nil, fmt.Errorf("the cluster DNS Service %s/%s has no cluster IPs", clusterDNSNamespace, clusterDNSService)
+	}
+	return ips, nil
+}
+
+// hasDefaultRoute returns true if the configuration installs a default route
+// in the main table through the interface.
+func hasDefaultRoute(config DeviceConfig) bool {
+	routes := config.Routes
+	if config.Network != nil {
+		routes = config.Network.Routes
+	}
+	for _, route := range routes {
+		_, dst, err := net.ParseCIDR(route.Dst)
+		if err != nil {
+			continue
+		}
+		if ones, _ := dst.Mask.Size(); ones == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// preserveDNSRoutes keeps the cluster DNS reachable through the pod primary
+// interface when the device installs a new default route, the pod DNS is
+// configured by the kubelet and only reachable through the cluster network.
+// It must run before the routes of the device are installed.
+func (k *NetworkDriver) preserveDNSRoutes(networkNamespace string, ifName string, config DeviceConfig) error {
+	if !k.preserveDNS || len(k.clusterDNS) == 0 || !hasDefaultRoute(config) {
+		return nil
+	}
+	klog.Infof("Preserving the routes to the cluster DNS %v before installing the default route through device %q", k.clusterDNS, ifName)
+	if err := kndnet.NsPreserveRoutes(networkNamespace, k.clusterDNS); err != nil {
+		return fmt.Errorf("failed to preserve the routes to the cluster DNS: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	kndnet "github.com/aojea/kubernetes-network-drivers/pkg/net"
+)
+
+func Test_parseClusterDNS(t *testing.T) {
+	got, err := parseClusterDNS("10.96.0.10, fd00:10:96::a")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []net.IP{net.ParseIP("10.96.0.10"), net.ParseIP("fd00:10:96::a")}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseClusterDNS() = %v, want %v", got, want)
+	}
+	if got, err := parseClusterDNS(""); err != nil || len(got) != 0 {
+		t.Errorf("parseClusterDNS(\"\") = %v, %v, want empty", got, err)
+	}
+	if _, err := parseClusterDNS("10.96.0"); err == nil {
+		t.Errorf("expected error for an invalid IP")
+	}
+}
+
+func Test_discoverClusterDNS(t *testing.T) {
+	if _, err := discoverClusterDNS(context.Background(), fake.NewClientset()); err == nil {
+		t.Errorf("expected error without the cluster DNS Service")
+	}
+
+	client := fake.NewClientset(&v1.Service{
+		ObjectMeta: metav1.ObjectMeta{Namespace: clusterDNSNamespace, Name: clusterDNSService},
+		Spec:       v1.ServiceSpec{ClusterIP: "10.96.0.10", ClusterIPs: []string{"10.96.0.10", "fd00:10:96::a"}},
+	})
+	got, err := discoverClusterDNS(context.Background(), client)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []net.IP{net.ParseIP("10.96.0.10"), net.ParseIP("fd00:10:96::a")}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("discoverClusterDNS() = %v, want %v", got, want)
+	}
+}
+
+func Test_hasDefaultRoute(t *testing.T) {
+	tests := []struct {
+		name   string
+		config DeviceConfig
+		want   bool
+	}{
+		{name: "no routes"},
+		{name: "specific route", config: DeviceConfig{Routes: []kndnet.RouteConfig{{Dst: "10.0.0.0/8", Gw: "192.168.5.1"}}}},
+		{name: "default route", config: DeviceConfig{Routes: []kndnet.RouteConfig{{Dst: "0.0.0.0/0", Gw: "192.168.5.1"}}}, want: true},
+		{name: "ipv6 default route", config: DeviceConfig{Routes: []kndnet.RouteConfig{{Dst: "::/0", Gw: "fd00::1"}}}, want: true},
+		{
+			name:   "network default route",
+			config: DeviceConfig{Network: &kndnet.NetworkConfig{Routes: []kndnet.RouteConfig{{Dst: "0.0.0.0/0", Gw: "192.168.5.1"}}}},
+			want:   true,
+		},
+		{
+			name: "default route in a custom table",
+			config: DeviceConfig{Network: &kndnet.NetworkConfig{
+				Tables: []kndnet.RouteTable{{ID: 100, Routes: []kndnet.RouteConfig{{Dst: "0.0.0.0/0", Gw: "192.168.5.1"}}}},
+			}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := hasDefaultRoute(tt.config); got != tt.want {
+				t.Errorf("hasDefaultRoute() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_preserveDNSRoutes_disabled(t *testing.T) {
+	config := DeviceConfig{Routes: []kndnet.RouteConfig{{Dst: "0.0.0.0/0", Gw: "192.168.5.1"}}}
+	// the namespace does not exist, any attempt to preserve the routes fails
+	k := &NetworkDriver{preserveDNS: false, clusterDNS: []net.IP{net.ParseIP("10.96.0.10")}}
+	if err := k.preserveDNSRoutes("/run/netns/missing", "eth1", config); err != nil {
+		t.Errorf("unexpected error with the preservation disabled: %v", err)
+	}
+	k = &NetworkDriver{preserveDNS: true}
+	if err := k.preserveDNSRoutes("/run/netns/missing", "eth1", config); err != nil {
+		t.Errorf("unexpected error without cluster DNS: %v", err)
+	}
+	k = &NetworkDriver{preserveDNS: true, clusterDNS: []net.IP{net.ParseIP("10.96.0.10")}}
+	if err := k.preserveDNSRoutes("/run/netns/missing", "eth1", DeviceConfig{}); err != nil {
+		t.Errorf("unexpected error without default route: %v", err)
+	}
+	if err := k.preserveDNSRoutes("/run/netns/missing", "eth1", config); err == nil {
+		t.Errorf("expected error preserving the routes in a missing namespace")
+	}
+}
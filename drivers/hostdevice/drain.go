@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+)
+
+// maxDrainDelay bounds the drain delay, the pod stop is blocked while the
+// devices are drained.
+const maxDrainDelay = 10 * time.Second
+
+// DrainConfig stops the traffic of the interface before it is returned to the
+// host, so the applications see their connections fail over instead of the
+// interface disappearing under them.
+type DrainConfig struct {
+	// Delay is how long to wait after the routes through the interface are
+	// removed before setting it down, e.g. 500ms.
+	Delay metav1.Duration `json:"delay,omitempty"`
+}
+
+func (c DrainConfig) validate() error {
+	if c.Delay.Duration < 0 || c.Delay.Duration > maxDrainDelay {
+		return fmt.Errorf("invalid delay %s, must be between 0 and %s", c.Delay.Duration, maxDrainDelay)
+	}
+	return nil
+}
+
+// drainDevice removes the routes through the interface ifName in the
+// namespace networkNamespace, waits for the drain delay and sets it down. A
+// failure does not stop the teardown, the device is returned anyway.
+func (k *NetworkDriver) drainDevice(networkNamespace string, ifName string, config DrainConfig) {
+	klog.V(2).Infof("Draining device %s for %s", ifName, config.Delay.Duration)
+	if err := k.host.flushRoutes(networkNamespace, ifName); err != nil {
+		klog.Errorf("failed to remove the routes of device %s: %v", ifName, err)
+	}
+	if config.Delay.Duration > 0 {
+		k.host.sleep(config.Delay.Duration)
+	}
+	if err := k.host.setLinkDown(networkNamespace, ifName); err != nil {
+		klog.Errorf("failed to set down device %s: %v", ifName, err)
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/containerd/nri/pkg/api"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	kndnet "github.com/aojea/kubernetes-network-drivers/pkg/net"
+)
+
+func Test_cleanupDeviceForPod_drain(t *testing.T) {
+	var steps []string
+	k := NewNetworkDriver(driverName, "node1", fake.NewClientset())
+	k.host.flushRoutes = func(containerNsPath string, ifName string) error {
+		steps = append(steps, "flush "+ifName)
+		// a failed step does not stop the teardown
+		return errors.New("boom")
+	}
+	k.host.sleep = func(d time.Duration) {
+		steps = append(steps, fmt.Sprintf("sleep %s", d))
+	}
+	k.host.setLinkDown = func(containerNsPath string, ifName string) error {
+		steps = append(steps, "down "+ifName)
+		return nil
+	}
+	k.host.detachNetdev = func(containerNsPath string, devName string, outName string, opts ...kndnet.DetachOption) error {
+		steps = append(steps, "detach "+devName)
+		return nil
+	}
+
+	pod := &api.PodSandbox{Namespace: "ns", Name: "pod", Uid: "pod-uid"}
+	tests := []struct {
+		name  string
+		drain *DrainConfig
+		want  []string
+	}{
+		{
+			name: "no drain",
+			want: []string{"detach eth1"},
+		},
+		{
+			name:  "drain without delay",
+			drain: &DrainConfig{},
+			want:  []string{"flush eth1", "down eth1", "detach eth1"},
+		},
+		{
+			name:  "drain",
+			drain: &DrainConfig{Delay: metav1.Duration{Duration: 500 * time.Millisecond}},
+			want:  []string{"flush eth1", "sleep 500ms", "down eth1", "detach eth1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			steps = nil
+			device := PreparedDevice{DeviceName: "eth1", Config: DeviceConfig{Drain: tt.drain}}
+			if err := k.cleanupDeviceForPod(AllocatedDevice{Name: "eth1"}, "/var/run/netns/test", pod, device); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(steps, tt.want) {
+				t.Errorf("expected teardown %v, got %v", tt.want, steps)
+			}
+		})
+	}
+}
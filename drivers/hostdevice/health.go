@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+)
+
+// unhealthySubsystems returns the reason of each subsystem of the driver that
+// failed for good, so a liveness probe restarts it, empty while the process
+// can still recover by itself.
+func (k *NetworkDriver) unhealthySubsystems() []string {
+	var unhealthy []string
+	if k.nriFailed.Load() {
+		unhealthy = append(unhealthy, fmt.Sprintf("nri: plugin failed to restart after %d attempts", maxAttempts))
+	}
+	return unhealthy
+}
+
+// notReadySubsystems returns the reason of each subsystem of the driver not
+// ready yet, empty if all of them are ready. started is set once the driver
+// started.
+func (k *NetworkDriver) notReadySubsystems(started *atomic.Bool) []string {
+	var notReady []string
+	if !started.Load() {
+		notReady = append(notReady, "driver: not started")
+	}
+	if k.draRegistered == nil || !k.draRegistered() {
+		notReady = append(notReady, "dra: plugin not registered with the kubelet")
+	}
+	if !k.nriConnected.Load() {
+		notReady = append(notReady, "nri: plugin not connected to the runtime")
+	}
+	if !k.isReady() {
+		notReady = append(notReady, "resourceslices: devices not published")
+	}
+	return notReady
+}
+
+// healthzHandler serves /healthz, the liveness of the driver, 503 with a line
+// for each subsystem that failed for good.
+func (k *NetworkDriver) healthzHandler() http.Handler {
+	return subsystemsHandler(k.unhealthySubsystems)
+}
+
+// readyzHandler serves /readyz, the readiness of the driver, 503 with a line
+// for each subsystem not ready until the devices are published and the
+// plugins are registered with the kubelet and the runtime.
+func (k *NetworkDriver) readyzHandler(started *atomic.Bool) http.Handler {
+	return subsystemsHandler(func() []string { return k.notReadySubsystems(started) })
+}
+
+// subsystemsHandler answers 503 with the failures of check, one per line, or
+// 200 with ok if there are none.
+func subsystemsHandler(check func() []string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		if failures := check(); len(failures) > 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			fmt.Fprintln(w, strings.Join(failures, "\n"))
+			return
+		}
+		fmt.Fprintln(w, "ok")
+	})
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func Test_readyzHandler(t *testing.T) {
+	tests := []struct {
+		name          string
+		started       bool
+		draRegistered bool
+		nriConnected  bool
+		published     bool
+		wantStatus    int
+		wantBody      []string
+	}{
+		{
+			name:    "ready",
+			started: true, draRegistered: true, nriConnected: true, published: true,
+			wantStatus: http.StatusOK,
+			wantBody:   []string{"ok"},
+		},
+		{
+			name:    "nri disconnected",
+			started: true, draRegistered: true, published: true,
+			wantStatus: http.StatusServiceUnavailable,
+			wantBody:   []string{"nri: plugin not connected to the runtime"},
+		},
+		{
+			name:    "dra unregistered",
+			started: true, nriConnected: true, published: true,
+			wantStatus: http.StatusServiceUnavailable,
+			wantBody:   []string{"dra: plugin not registered with the kubelet"},
+		},
+		{
+			name:       "starting",
+			wantStatus: http.StatusServiceUnavailable,
+			wantBody: []string{
+				"driver: not started",
+				"dra: plugin not registered with the kubelet",
+				"nri: plugin not connected to the runtime",
+				"resourceslices: devices not published",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k := NewNetworkDriver(driverName, "node1", fake.NewClientset())
+			var started atomic.Bool
+			started.Store(tt.started)
+			k.draRegistered = func() bool { return tt.draRegistered }
+			k.nriConnected.Store(tt.nriConnected)
+			k.published.Store(tt.published)
+
+			rec := httptest.NewRecorder()
+			k.readyzHandler(&started).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+			if rec.Code != tt.wantStatus {
+				t.Errorf("expected status %d, got %d", tt.wantStatus, rec.Code)
+			}
+			body, _ := io.ReadAll(rec.Body)
+			if got := strings.Split(strings.TrimSpace(string(body)), "\n"); strings.Join(got, "\n") != strings.Join(tt.wantBody, "\n") {
+				t.Errorf("expected body %q, got %q", tt.wantBody, got)
+			}
+		})
+	}
+}
+
+func Test_healthzHandler(t *testing.T) {
+	k := NewNetworkDriver(driverName, "node1", fake.NewClientset())
+	// the driver is alive while it is not ready yet
+	rec := httptest.NewRecorder()
+	k.healthzHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("expected status %d before the driver is ready, got %d", http.StatusOK, rec.Code)
+	}
+
+	k.nriFailed.Store(true)
+	rec = httptest.NewRecorder()
+	k.healthzHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected status %d after the NRI plugin failed, got %d", http.StatusServiceUnavailable, rec.Code)
+	}
+	if body := rec.Body.String(); !strings.HasPrefix(body, "nri: plugin failed to restart") {
+		t.Errorf("expected the NRI failure in the body, got %q", body)
+	}
+}
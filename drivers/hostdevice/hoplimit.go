@@ -0,0 +1,23 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// hopLimitSysctl is the IPv6 setting modified by the hop limit configuration.
+// IPv4 has no per interface equivalent, net.ipv4.ip_default_ttl applies to
+// the whole network namespace.
+const hopLimitSysctl = "hop_limit"
+
+func validateHopLimit(hopLimit int) error {
+	if hopLimit < 1 || hopLimit > 255 {
+		return fmt.Errorf("invalid hopLimit %d, must be between 1 and 255", hopLimit)
+	}
+	return nil
+}
+
+// hopLimitSysctls returns the interface settings of the hop limit.
+func hopLimitSysctls(hopLimit int) map[string]string {
+	return map[string]string{hopLimitSysctl: strconv.Itoa(hopLimit)}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"net"
+	"time"
+
+	"github.com/vishvananda/netlink"
+	resourceapi "k8s.io/api/resource/v1"
+
+	kndnet "github.com/aojea/kubernetes-network-drivers/pkg/net"
+)
+
+// hostOps are the operations of the driver on the network interfaces and the
+// devices of the node and of the pods, tests replace them with fakes.
+type hostOps struct {
+	// attachNetdev moves a device to the pod namespace.
+	attachNetdev func(hostIfName string, containerNsPath string, newAttr netlink.LinkAttrs, addresses []*net.IPNet, opts ...kndnet.AttachOption) (*resourceapi.NetworkDeviceData, error)
+	// detachNetdev returns a device to the host namespace.
+	detachNetdev func(containerNsPath string, devName string, outName string, opts ...kndnet.DetachOption) error
+	// restoreNetdev recovers a device returned by the kernel to the host
+	// namespace.
+	restoreNetdev func(devName string, outName string, opts ...kndnet.DetachOption) error
+	// attachBond moves the members of a bond to the pod namespace and
+	// detachBond returns them to the host namespace.
+	attachBond func(containerNsPath string, members []string, bondAttr netlink.LinkAttrs, addresses []*net.IPNet, opts ...kndnet.AttachOption) error
+	detachBond func(containerNsPath string, bondName string, members []string, opts ...kndnet.DetachOption) error
+	// attachBridge moves a device to the pod namespace and enslaves it to a
+	// bridge there and detachBridge returns it to the host namespace.
+	attachBridge func(containerNsPath string, uplink string, bridgeName string, addresses []*net.IPNet, opts ...kndnet.AttachOption) error
+	detachBridge func(containerNsPath string, uplink string, bridgeName string, opts ...kndnet.DetachOption) error
+	// flushRoutes, setLinkDown and sleep are the steps of the drain of a
+	// device.
+	flushRoutes func(containerNsPath string, ifName string) error
+	setLinkDown func(containerNsPath string, ifName string) error
+	sleep       func(d time.Duration)
+	// addPolicyRouting and removePolicyRouting program the source based
+	// routing of a device.
+	addPolicyRouting    func(containerNsPath string, ifName string, srcIPs []net.IP, tableID int, opts ...kndnet.PolicyRoutingOption) error
+	removePolicyRouting func(containerNsPath string, tableID int) error
+	// joinSourceGroups joins the source-specific multicast channels of a
+	// device in the pod.
+	joinSourceGroups func(containerNsPath string, ifName string, config kndnet.SSMConfig) (*kndnet.SourceGroupMemberships, error)
+	// nsLinkInfo reads the live configuration of an attached interface.
+	nsLinkInfo func(containerNsPath string, ifName string) (*kndnet.LinkInfo, error)
+	// linkStatistics reads the counters of an attached interface.
+	linkStatistics func(containerNsPath string, ifName string) (*netlink.LinkStatistics, error)
+	// hostLinkExists returns true if the interface is in the host namespace.
+	hostLinkExists func(ifName string) bool
+	// hostInterfaces returns the names of the interfaces of the host namespace.
+	hostInterfaces func() ([]string, error)
+	// linkByName looks up a host interface.
+	linkByName func(name string) (netlink.Link, error)
+	// linkSpeed reads the speed in Mbps of a host interface.
+	linkSpeed func(ifName string) (int, error)
+	// linkOperState reads the operational state of a host interface.
+	linkOperState func(ifName string) (string, error)
+	// linkMaxMTU and linkMTU read the maximum and the current MTU of a host
+	// interface.
+	linkMaxMTU func(ifName string) (int, error)
+	linkMTU    func(ifName string) (int, error)
+	// defaultRouteLinks returns the indexes of the host interfaces with a
+	// default route.
+	defaultRouteLinks func() ([]int, error)
+	// linkSubscribe and addrSubscribe subscribe to the link and address
+	// changes of the host.
+	linkSubscribe func(ch chan<- netlink.LinkUpdate, done <-chan struct{}, options netlink.LinkSubscribeOptions) error
+	addrSubscribe func(ch chan<- netlink.AddrUpdate, done <-chan struct{}, options netlink.AddrSubscribeOptions) error
+	// pciAddress, kernelDriver and numaNode read the PCI device backing a
+	// host interface.
+	pciAddress   func(ifName string) (string, error)
+	kernelDriver func(ifName string) (string, error)
+	numaNode     func(ifName string) (int, error)
+	// pciVendorID and pciDeviceID read the PCI ids of a host interface.
+	pciVendorID func(ifName string) (string, error)
+	pciDeviceID func(ifName string) (string, error)
+	// pciSlot returns the card of a host interface.
+	pciSlot func(ifName string) (string, error)
+	// stableDeviceID returns the identity of a host interface.
+	stableDeviceID func(ifName string) string
+	// sriovTotalVFs and sriovNumVFs read the SR-IOV virtual function counts
+	// and rdmaDevices the RDMA devices of a host interface.
+	sriovTotalVFs func(ifName string) (int, error)
+	sriovNumVFs   func(ifName string) (int, error)
+	rdmaDevices   func(ifName string) ([]string, error)
+	// timestampingInfo reads the timestamping capabilities of a host
+	// interface.
+	timestampingInfo func(ifName string) (kndnet.TimestampingInfo, error)
+	// hardwareTimestamping reads the hardware timestamping configuration of a
+	// host interface and nsSetHardwareTimestamping sets it on an interface in
+	// a pod.
+	hardwareTimestamping      func(ifName string) (kndnet.HardwareTimestamping, error)
+	nsSetHardwareTimestamping func(containerNsPath string, ifName string, config kndnet.HardwareTimestamping) error
+	// ethtoolSettings reads the current state of the ethtool settings of a
+	// host interface, to restore them later.
+	ethtoolSettings func(ifName string, config kndnet.EthtoolConfig) (kndnet.EthtoolConfig, error)
+	// isNetworkNamespace returns an error if the path is not a network
+	// namespace mount.
+	isNetworkNamespace func(path string) error
+	// hostUptime returns the time since the node booted.
+	hostUptime func() (time.Duration, error)
+}
+
+// newHostOps returns the operations on the node.
+func newHostOps() hostOps {
+	return hostOps{
+		attachNetdev:              kndnet.NsAttachNetdev,
+		detachNetdev:              kndnet.NsDetachNetdev,
+		restoreNetdev:             kndnet.RestoreNetdev,
+		attachBond:                kndnet.NsAttachBond,
+		detachBond:                kndnet.NsDetachBond,
+		attachBridge:              kndnet.NsAttachBridge,
+		detachBridge:              kndnet.NsDetachBridge,
+		flushRoutes:               kndnet.NsFlushRoutes,
+		setLinkDown:               kndnet.NsSetLinkDown,
+		sleep:                     time.Sleep,
+		addPolicyRouting:          kndnet.NsAddPolicyRouting,
+		removePolicyRouting:       kndnet.NsRemovePolicyRouting,
+		joinSourceGroups:          kndnet.NsJoinSourceGroups,
+		nsLinkInfo:                kndnet.NsLinkInfo,
+		linkStatistics:            kndnet.NsLinkStatistics,
+		hostLinkExists:            hostLinkExists,
+		hostInterfaces:            hostInterfaces,
+		linkByName:                netlink.LinkByName,
+		linkSpeed:                 kndnet.LinkSpeed,
+		linkOperState:             kndnet.LinkOperState,
+		linkMaxMTU:                kndnet.LinkMaxMTU,
+		linkMTU:                   kndnet.LinkMTU,
+		defaultRouteLinks:         kndnet.DefaultRouteLinks,
+		linkSubscribe:             netlink.LinkSubscribeWithOptions,
+		addrSubscribe:             netlink.AddrSubscribeWithOptions,
+		pciAddress:                kndnet.PCIAddress,
+		kernelDriver:              kndnet.KernelDriver,
+		numaNode:                  kndnet.NUMANode,
+		pciVendorID:               kndnet.PCIVendorID,
+		pciDeviceID:               kndnet.PCIDeviceID,
+		pciSlot:                   pciSlot,
+		stableDeviceID:            stableDeviceID,
+		sriovTotalVFs:             kndnet.SriovTotalVFs,
+		sriovNumVFs:               kndnet.SriovNumVFs,
+		rdmaDevices:               kndnet.RDMADevices,
+		timestampingInfo:          kndnet.GetTimestampingInfo,
+		hardwareTimestamping:      kndnet.GetHardwareTimestamping,
+		nsSetHardwareTimestamping: kndnet.NsSetHardwareTimestamping,
+		ethtoolSettings:           kndnet.GetEthtool,
+		isNetworkNamespace:        isNetworkNamespace,
+		hostUptime:                hostUptime,
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/vishvananda/netlink"
+	resourceapi "k8s.io/api/resource/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/klog/v2"
+
+	kndnet "github.com/aojea/kubernetes-network-drivers/pkg/net"
+)
+
+// DeviceIdentity is the mapping of the names a device attached to a pod goes
+// by, reported in the data of the device status of its claim so the device
+// can be traced from its published attributes to the interface in the pod.
+type DeviceIdentity struct {
+	// StableID is the PCI address of the device backing the host interface,
+	// or its MAC address if it is not a PCI device, as published.
+	StableID string `json:"stableID,omitempty"`
+	// KernelName is the name of the host interface moved into the pod or,
+	// for child interfaces, the interface they were created on.
+	KernelName string `json:"kernelName"`
+	// PodInterfaceName is the name of the interface in the pod.
+	PodInterfaceName string `json:"podInterfaceName"`
+}
+
+// stableDeviceID returns the identity of the host interface ifName that does
+// not change with its kernel name, it must be read before the interface is
+// moved out of the host namespace.
+func stableDeviceID(ifName string) string {
+	if address, err := kndnet.PCIAddress(ifName); err == nil {
+		if normalized, err := normalizePCIAddress(address); err == nil {
+			return normalized
+		}
+	}
+	link, err := netlink.LinkByName(ifName)
+	if err != nil || len(link.Attrs().HardwareAddr) == 0 {
+		return ""
+	}
+	return link.Attrs().HardwareAddr.String()
+}
+
+// reportDeviceIdentity records the identity of the device in the data of its
+// status in the claim. Failures are logged, the device is attached anyway.
+func (k *NetworkDriver) reportDeviceIdentity(ctx context.Context, device PreparedDevice, identity DeviceIdentity) {
+	klog.V(2).Infof("Device %s of claim %s is %s, %s on the host and %s in the pod",
+		device.DeviceName, device.Claim, identity.StableID, identity.KernelName, identity.PodInterfaceName)
+	raw, err := json.Marshal(identity)
+	if err != nil {
+		klog.Errorf("failed to encode the identity of device %s: %v", device.DeviceName, err)
+		return
+	}
+	err = k.updateClaimDeviceStatus(ctx, device, func(status *resourceapi.AllocatedDeviceStatus) {
+		status.Data = &runtime.RawExtension{Raw: raw}
+	})
+	if err != nil {
+		klog.Errorf("failed to report the identity of device %s: %v", device.DeviceName, err)
+	}
+}
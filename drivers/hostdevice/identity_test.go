@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"testing"
+
+	"github.com/vishvananda/netlink"
+	resourceapi "k8s.io/api/resource/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+
+	kndnet "github.com/aojea/kubernetes-network-drivers/pkg/net"
+)
+
+func Test_configureDeviceForPod_identity(t *testing.T) {
+	claim := &resourceapi.ResourceClaim{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "claim"}}
+	client := fake.NewClientset(claim)
+	k := NewNetworkDriver(driverName, "node1", client)
+	k.host.attachNetdev = func(hostIfName string, containerNsPath string, newAttr netlink.LinkAttrs, addresses []*net.IPNet, opts ...kndnet.AttachOption) (*resourceapi.NetworkDeviceData, error) {
+		return nil, nil
+	}
+	k.host.stableDeviceID = func(ifName string) string {
+		if ifName == "eth0v1" {
+			return "0000:3b:02.1"
+		}
+		return ""
+	}
+
+	// the virtual function eth0v1 of the allocated physical function eth0 is moved
+	device := PreparedDevice{
+		Claim:         types.NamespacedName{Namespace: "default", Name: "claim"},
+		PoolName:      "node1",
+		DeviceName:    "eth0",
+		InterfaceName: "eth0v1",
+	}
+	if err := k.configureDeviceForPod(AllocatedDevice{Name: "eth0"}, "/run/netns/pod", newTestSandbox("/run/netns/pod"), device); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got, err := client.ResourceV1().ResourceClaims("default").Get(context.Background(), "claim", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(got.Status.Devices) != 1 || got.Status.Devices[0].Device != "eth0" || got.Status.Devices[0].Data == nil {
+		t.Fatalf("expected the status of device eth0, got %+v", got.Status.Devices)
+	}
+	var identity DeviceIdentity
+	if err := json.Unmarshal(got.Status.Devices[0].Data.Raw, &identity); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := DeviceIdentity{StableID: "0000:3b:02.1", KernelName: "eth0v1", PodInterfaceName: "eth0v1"}
+	if identity != want {
+		t.Errorf("expected identity %+v, got %+v", want, identity)
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// interfaceFilter selects the host interfaces that are published by their
+// name, with regular expressions matched against the whole name. The
+// excluded interfaces are never published, and when there are include
+// patterns only the interfaces matching one of them are.
+type interfaceFilter struct {
+	include   []string
+	exclude   []string
+	includeRE []*regexp.Regexp
+	excludeRE []*regexp.Regexp
+}
+
+// newInterfaceFilter returns the filter of the comma separated include and
+// exclude patterns.
+func newInterfaceFilter(include, exclude string) (interfaceFilter, error) {
+	var f interfaceFilter
+	var err error
+	if f.include, f.includeRE, err = parseInterfacePatterns(include); err != nil {
+		return f, fmt.Errorf("invalid interface include pattern: %w", err)
+	}
+	if f.exclude, f.excludeRE, err = parseInterfacePatterns(exclude); err != nil {
+		return f, fmt.Errorf("invalid interface exclude pattern: %w", err)
+	}
+	return f, nil
+}
+
+// parseInterfacePatterns returns the patterns of a comma separated list and
+// their expressions anchored to match the whole interface name.
+func parseInterfacePatterns(value string) ([]string, []*regexp.Regexp, error) {
+	var patterns []string
+	var expressions []*regexp.Regexp
+	for _, pattern := range strings.Split(value, ",") {
+		if pattern = strings.TrimSpace(pattern); pattern == "" {
+			continue
+		}
+		re, err := regexp.Compile("^(?:" + pattern + ")$")
+		if err != nil {
+			return nil, nil, fmt.Errorf("%q: %w", pattern, err)
+		}
+		patterns = append(patterns, pattern)
+		expressions = append(expressions, re)
+	}
+	return patterns, expressions, nil
+}
+
+// matches returns true if the interface can be published, the exclude
+// patterns take precedence over the include ones.
+func (f interfaceFilter) matches(name string) bool {
+	match := func(re *regexp.Regexp) bool { return re.MatchString(name) }
+	if slices.ContainsFunc(f.excludeRE, match) {
+		return false
+	}
+	return len(f.includeRE) == 0 || slices.ContainsFunc(f.includeRE, match)
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"testing"
+)
+
+func Test_interfaceFilter(t *testing.T) {
+	tests := []struct {
+		name    string
+		include string
+		exclude string
+		want    map[string]bool
+		wantErr bool
+	}{
+		{
+			name: "no patterns",
+			want: map[string]bool{"eth0": true, "ens1f0": true},
+		},
+		{
+			name:    "include",
+			include: "ens.*, enp.*",
+			want:    map[string]bool{"ens1f0": true, "enp3s0": true, "eth0": false, "xens1": false},
+		},
+		{
+			name:    "exclude",
+			exclude: "eno1",
+			want:    map[string]bool{"eno1": false, "eno12": true, "ens1f0": true},
+		},
+		{
+			name:    "exclude takes precedence over an overlapping include",
+			include: "en.*",
+			exclude: "eno[0-9]+,ens1f[0-9]+v[0-9]+",
+			want:    map[string]bool{"eno1": false, "ens1f0": true, "ens1f0v1": false, "enp3s0": true, "eth0": false},
+		},
+		{
+			name:    "same pattern included and excluded",
+			include: "ens1f0",
+			exclude: "ens1f0",
+			want:    map[string]bool{"ens1f0": false},
+		},
+		{
+			name:    "invalid include",
+			include: "ens(",
+			wantErr: true,
+		},
+		{
+			name:    "invalid exclude",
+			exclude: "[",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := newInterfaceFilter(tt.include, tt.exclude)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("newInterfaceFilter() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			for name, want := range tt.want {
+				if got := f.matches(name); got != want {
+					t.Errorf("matches(%q) = %v, want %v", name, got, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"time"
+
+	resourceapi "k8s.io/api/resource/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
+
+	kndnet "github.com/aojea/kubernetes-network-drivers/pkg/net"
+)
+
+const (
+	// temporaryAddressTimeout is how long to wait for the temporary addresses to be generated.
+	temporaryAddressTimeout = 2 * time.Minute
+)
+
+// ipv6PrivacySysctls are the IPv6 settings modified by the privacy
+// extensions, the kernel spells prefered with a single r.
+var ipv6PrivacySysctls = []string{"use_tempaddr", "temp_valid_lft", "temp_prefered_lft"}
+
+// IPv6PrivacyConfig configures the IPv6 privacy extensions (RFC 8981), the
+// temporary addresses generated from the advertised prefixes.
+type IPv6PrivacyConfig struct {
+	// UseTempAddr is 1 to generate temporary addresses, or 2 to also prefer
+	// them over the public ones as source addresses.
+	UseTempAddr int `json:"useTempAddr"`
+	// TempValidLifetime is the maximum lifetime in seconds of the temporary
+	// addresses, the kernel default is used if 0.
+	TempValidLifetime int `json:"tempValidLifetime,omitempty"`
+	// TempPreferredLifetime is the time in seconds the temporary addresses
+	// are preferred before a new one is generated, the kernel default is used if 0.
+	TempPreferredLifetime int `json:"tempPreferredLifetime,omitempty"`
+}
+
+func (c IPv6PrivacyConfig) validate() error {
+	if c.UseTempAddr != 1 && c.UseTempAddr != 2 {
+		return fmt.Errorf("invalid useTempAddr %d, must be 1 or 2", c.UseTempAddr)
+	}
+	if c.TempValidLifetime < 0 || c.TempPreferredLifetime < 0 {
+		return fmt.Errorf("lifetimes must not be negative")
+	}
+	if c.TempValidLifetime > 0 && c.TempPreferredLifetime > c.TempValidLifetime {
+		return fmt.Errorf("tempPreferredLifetime %d is greater than tempValidLifetime %d", c.TempPreferredLifetime, c.TempValidLifetime)
+	}
+	return nil
+}
+
+// sysctls returns the interface settings of the configuration.
+func (c IPv6PrivacyConfig) sysctls() map[string]string {
+	values := map[string]string{"use_tempaddr": strconv.Itoa(c.UseTempAddr)}
+	if c.TempValidLifetime > 0 {
+		values["temp_valid_lft"] = strconv.Itoa(c.TempValidLifetime)
+	}
+	if c.TempPreferredLifetime > 0 {
+		values["temp_prefered_lft"] = strconv.Itoa(c.TempPreferredLifetime)
+	}
+	return values
+}
+
+// reportTemporaryAddresses waits for the temporary addresses of the
+// interface and reports them in the device status of the claim.
+func (k *NetworkDriver) reportTemporaryAddresses(ctx context.Context, device PreparedDevice, networkNamespace string, ifName string) {
+	var addresses []string
+	err := wait.PollUntilContextTimeout(ctx, time.Second, temporaryAddressTimeout, false, func(context.Context) (bool, error) {
+		var err error
+		addresses, err = kndnet.NsTemporaryAddresses(networkNamespace, ifName)
+		if err != nil {
+			// the pod is gone
+			return false, err
+		}
+		return len(addresses) > 0, nil
+	})
+	if err != nil {
+		klog.V(2).Infof("No temporary addresses reported for device %s of claim %s: %v", ifName, device.Claim, err)
+		return
+	}
+	// the addresses are added to the ones reported on attach
+	err = k.updateClaimDeviceStatus(ctx, device, func(status *resourceapi.AllocatedDeviceStatus) {
+		if status.NetworkData == nil {
+			status.NetworkData = &resourceapi.NetworkDeviceData{InterfaceName: ifName}
+		}
+		for _, address := range addresses {
+			if !slices.Contains(status.NetworkData.IPs, address) {
+				status.NetworkData.IPs = append(status.NetworkData.IPs, address)
+			}
+		}
+	})
+	if err != nil {
+		klog.Errorf("failed to report temporary addresses of device %s: %v", ifName, err)
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestIPv6PrivacyConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  IPv6PrivacyConfig
+		want    map[string]string
+		wantErr bool
+	}{
+		{
+			name:   "temporary addresses",
+			config: IPv6PrivacyConfig{UseTempAddr: 1},
+			want:   map[string]string{"use_tempaddr": "1"},
+		},
+		{
+			name:   "preferred with lifetimes",
+			config: IPv6PrivacyConfig{UseTempAddr: 2, TempValidLifetime: 86400, TempPreferredLifetime: 3600},
+			want:   map[string]string{"use_tempaddr": "2", "temp_valid_lft": "86400", "temp_prefered_lft": "3600"},
+		},
+		{name: "disabled", config: IPv6PrivacyConfig{UseTempAddr: 0}, wantErr: true},
+		{name: "negative lifetime", config: IPv6PrivacyConfig{UseTempAddr: 1, TempValidLifetime: -1}, wantErr: true},
+		{name: "preferred longer than valid", config: IPv6PrivacyConfig{UseTempAddr: 1, TempValidLifetime: 60, TempPreferredLifetime: 120}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.validate()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got := tt.config.sysctls(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("sysctls() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/vishvananda/netlink"
+	resourceapi "k8s.io/api/resource/v1"
+
+	kndnet "github.com/aojea/kubernetes-network-drivers/pkg/net"
+)
+
+// IPVlanMode is the mode of the ipvlan interfaces created on top of the device.
+type IPVlanMode string
+
+const (
+	// IPVlanModeL2 switches the packets on the parent by MAC address, the
+	// default. The pod gets the neighbor discovery and the multicast.
+	IPVlanModeL2 IPVlanMode = "l2"
+	// IPVlanModeL3 routes the packets on the parent by IP address, without
+	// broadcast nor multicast, for fabrics that scale by routing.
+	IPVlanModeL3 IPVlanMode = "l3"
+	// IPVlanModeL3S is l3 with the packets going through the netfilter hooks
+	// of the host namespace.
+	IPVlanModeL3S IPVlanMode = "l3s"
+)
+
+func (m IPVlanMode) validate() error {
+	switch m {
+	case "", IPVlanModeL2, IPVlanModeL3, IPVlanModeL3S:
+		return nil
+	}
+	return fmt.Errorf("invalid ipvlanMode %q, must be %s, %s or %s", m, IPVlanModeL2, IPVlanModeL3, IPVlanModeL3S)
+}
+
+// netlinkMode returns the netlink ipvlan mode, l2 by default.
+func (m IPVlanMode) netlinkMode() netlink.IPVlanMode {
+	switch m {
+	case IPVlanModeL3:
+		return netlink.IPVLAN_MODE_L3
+	case IPVlanModeL3S:
+		return netlink.IPVLAN_MODE_L3S
+	}
+	return netlink.IPVLAN_MODE_L2
+}
+
+// addIPVlanAttribute publishes whether the device can be the parent of an
+// ipvlan interface, so the claims with the ipvlan mode can select it.
+func addIPVlanAttribute(device *resourceapi.Device, link netlink.Link) {
+	supported := kndnet.SupportsIPVlan(link)
+	device.Attributes["supports-ipvlan"] = resourceapi.DeviceAttribute{BoolValue: &supported}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/vishvananda/netlink"
+	resourceapi "k8s.io/api/resource/v1"
+)
+
+func Test_IPVlanMode_netlinkMode(t *testing.T) {
+	tests := map[IPVlanMode]netlink.IPVlanMode{
+		"":            netlink.IPVLAN_MODE_L2,
+		IPVlanModeL2:  netlink.IPVLAN_MODE_L2,
+		IPVlanModeL3:  netlink.IPVLAN_MODE_L3,
+		IPVlanModeL3S: netlink.IPVLAN_MODE_L3S,
+	}
+	for mode, want := range tests {
+		if got := mode.netlinkMode(); got != want {
+			t.Errorf("expected netlink mode %v for %q, got %v", want, mode, got)
+		}
+	}
+}
+
+func Test_addIPVlanAttribute(t *testing.T) {
+	tests := []struct {
+		name string
+		link netlink.Link
+		want bool
+	}{
+		{name: "ethernet", link: &netlink.Device{LinkAttrs: netlink.LinkAttrs{Name: "eth0", EncapType: "ether"}}, want: true},
+		{name: "bond member", link: &netlink.Device{LinkAttrs: netlink.LinkAttrs{Name: "eth1", EncapType: "ether", MasterIndex: 5}}},
+		{name: "infiniband", link: &netlink.Device{LinkAttrs: netlink.LinkAttrs{Name: "ib0", EncapType: "infiniband"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			device := resourceapi.Device{Attributes: map[resourceapi.QualifiedName]resourceapi.DeviceAttribute{}}
+			addIPVlanAttribute(&device, tt.link)
+			got := device.Attributes["supports-ipvlan"].BoolValue
+			if got == nil || *got != tt.want {
+				t.Errorf("expected supports-ipvlan %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
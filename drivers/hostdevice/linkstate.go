@@ -0,0 +1,26 @@
+package main
+
+import (
+	resourceapi "k8s.io/api/resource/v1"
+	"k8s.io/klog/v2"
+)
+
+// addLinkAttributes publishes the link speed and the operational state of the
+// host interface ifName, so claims can select the devices by bandwidth. The
+// speed is omitted when it is unknown, e.g. for virtual interfaces or without
+// carrier.
+func (k *NetworkDriver) addLinkAttributes(device *resourceapi.Device, ifName string) {
+	speed, err := k.host.linkSpeed(ifName)
+	if err != nil {
+		klog.V(2).Infof("failed to get the link speed of %s: %v", ifName, err)
+	} else if speed > 0 {
+		value := int64(speed)
+		device.Attributes["link-speed-mbps"] = resourceapi.DeviceAttribute{IntValue: &value}
+	}
+	state, err := k.host.linkOperState(ifName)
+	if err != nil {
+		klog.V(2).Infof("failed to get the operational state of %s: %v", ifName, err)
+		return
+	}
+	device.Attributes["oper-state"] = resourceapi.DeviceAttribute{StringValue: &state}
+}
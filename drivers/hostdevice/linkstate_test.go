@@ -0,0 +1,61 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	resourceapi "k8s.io/api/resource/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func Test_addLinkAttributes(t *testing.T) {
+	speeds := map[string]int{"eth0": 25000, "dummy0": -1}
+	states := map[string]string{"eth0": "up", "dummy0": "unknown"}
+	k := NewNetworkDriver(driverName, "node1", fake.NewClientset())
+	k.host.linkSpeed = func(ifName string) (int, error) {
+		speed, ok := speeds[ifName]
+		if !ok {
+			return -1, errors.New("no such interface")
+		}
+		return speed, nil
+	}
+	k.host.linkOperState = func(ifName string) (string, error) {
+		state, ok := states[ifName]
+		if !ok {
+			return "", errors.New("no such interface")
+		}
+		return state, nil
+	}
+
+	// the zero values are the attributes not published
+	tests := []struct {
+		ifName    string
+		wantSpeed int64
+		wantState string
+	}{
+		{ifName: "eth0", wantSpeed: 25000, wantState: "up"},
+		// the unknown speed of the virtual interfaces is not published
+		{ifName: "dummy0", wantState: "unknown"},
+		{ifName: "missing0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ifName, func(t *testing.T) {
+			device := resourceapi.Device{Name: tt.ifName, Attributes: map[resourceapi.QualifiedName]resourceapi.DeviceAttribute{}}
+			k.addLinkAttributes(&device, tt.ifName)
+			var speed int64
+			if v := device.Attributes["link-speed-mbps"].IntValue; v != nil {
+				speed = *v
+			}
+			if speed != tt.wantSpeed {
+				t.Errorf("unexpected link-speed-mbps %d, want %d", speed, tt.wantSpeed)
+			}
+			var state string
+			if v := device.Attributes["oper-state"].StringValue; v != nil {
+				state = *v
+			}
+			if state != tt.wantState {
+				t.Errorf("unexpected oper-state %q, want %q", state, tt.wantState)
+			}
+		})
+	}
+}
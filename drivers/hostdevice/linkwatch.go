@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/vishvananda/netlink"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// linkWatchCheckInterval is how often the devices are discovered between
+	// the publications while the link changes are watched, in case one is
+	// missed.
+	linkWatchCheckInterval = 30 * time.Second
+	// linkResubscribeDelay is the wait before subscribing again to the link
+	// changes after the netlink socket failed.
+	linkResubscribeDelay = time.Second
+)
+
+// errSubscriptionClosed is returned when netlink closes a subscription, on a
+// failure of its socket.
+var errSubscriptionClosed = errors.New("netlink subscription closed")
+
+// notifyLinkChange asks for a check of the devices, without blocking if one
+// is already pending.
+func (k *NetworkDriver) notifyLinkChange() {
+	select {
+	case k.linkChanges <- struct{}{}:
+	default:
+	}
+}
+
+// watchLinkChanges notifies the link and address changes of the host until
+// the context is done, subscribing again when the subscription fails.
+func (k *NetworkDriver) watchLinkChanges(ctx context.Context) {
+	for {
+		err := k.subscribeLinkChanges(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		klog.Errorf("Watching the link changes failed, subscribing again in %s: %v", linkResubscribeDelay, err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(linkResubscribeDelay):
+		}
+		// the changes meanwhile were missed
+		k.notifyLinkChange()
+	}
+}
+
+// subscribeLinkChanges notifies the link and address changes until the
+// context is done or a subscription is closed.
+func (k *NetworkDriver) subscribeLinkChanges(ctx context.Context) error {
+	done := make(chan struct{})
+	defer close(done)
+	onError := func(err error) {
+		select {
+		case <-done:
+		default:
+			klog.Warningf("Error watching the link changes: %v", err)
+		}
+	}
+
+	links := make(chan netlink.LinkUpdate, 16)
+	if err := k.host.linkSubscribe(links, done, netlink.LinkSubscribeOptions{ErrorCallback: onError}); err != nil {
+		return err
+	}
+	defer drainUpdates(links)
+	addrs := make(chan netlink.AddrUpdate, 16)
+	if err := k.host.addrSubscribe(addrs, done, netlink.AddrSubscribeOptions{ErrorCallback: onError}); err != nil {
+		return err
+	}
+	defer drainUpdates(addrs)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case update, ok := <-links:
+			if !ok {
+				return errSubscriptionClosed
+			}
+			klog.V(4).Infof("Link %s changed", update.Attrs().Name)
+			k.notifyLinkChange()
+		case update, ok := <-addrs:
+			if !ok {
+				return errSubscriptionClosed
+			}
+			klog.V(4).Infof("Address %s of link index %d changed", update.LinkAddress.String(), update.LinkIndex)
+			k.notifyLinkChange()
+		}
+	}
+}
+
+// drainUpdates reads the updates of a subscription until netlink closes the
+// channel, once its socket is closed, so it does not block sending the
+// pending ones.
+func drainUpdates[T any](updates <-chan T) {
+	go func() {
+		for range updates {
+		}
+	}()
+}
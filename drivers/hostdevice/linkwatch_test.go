@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/vishvananda/netlink"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// linkSubscription is a subscription of the fake linkSubscribe, closing fail
+// closes it like a failure of the netlink socket.
+type linkSubscription struct {
+	updates chan<- netlink.LinkUpdate
+	fail    chan struct{}
+}
+
+func Test_watchLinkChanges(t *testing.T) {
+	subscriptions := make(chan linkSubscription, 2)
+	k := NewNetworkDriver(driverName, "node1", fake.NewClientset())
+	k.host.linkSubscribe = func(ch chan<- netlink.LinkUpdate, done <-chan struct{}, options netlink.LinkSubscribeOptions) error {
+		subscription := linkSubscription{updates: ch, fail: make(chan struct{})}
+		go func() {
+			select {
+			case <-done:
+			case <-subscription.fail:
+			}
+			close(ch)
+		}()
+		subscriptions <- subscription
+		return nil
+	}
+	addrs := make(chan chan<- netlink.AddrUpdate, 2)
+	k.host.addrSubscribe = func(ch chan<- netlink.AddrUpdate, done <-chan struct{}, options netlink.AddrSubscribeOptions) error {
+		go func() {
+			<-done
+			close(ch)
+		}()
+		addrs <- ch
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go k.watchLinkChanges(ctx)
+
+	waitForChange := func(what string) {
+		t.Helper()
+		select {
+		case <-k.linkChanges:
+		case <-time.After(wait.ForeverTestTimeout):
+			t.Fatalf("expected a device check after %s", what)
+		}
+	}
+	subscription := <-subscriptions
+	subscription.updates <- netlink.LinkUpdate{Link: &netlink.Dummy{LinkAttrs: netlink.LinkAttrs{Name: "eth1"}}}
+	waitForChange("a link change")
+	(<-addrs) <- netlink.AddrUpdate{LinkIndex: 2}
+	waitForChange("an address change")
+
+	// the subscription is established again after a failure
+	close(subscription.fail)
+	select {
+	case subscription = <-subscriptions:
+	case <-time.After(wait.ForeverTestTimeout):
+		t.Fatalf("expected a new subscription after a failure")
+	}
+	<-addrs
+	waitForChange("a new subscription")
+	subscription.updates <- netlink.LinkUpdate{Link: &netlink.Dummy{LinkAttrs: netlink.LinkAttrs{Name: "eth2"}}}
+	waitForChange("a link change on the new subscription")
+}
+
+func Test_publishResources_linkChanges(t *testing.T) {
+	publisher := &countingPublisher{published: make(chan struct{}, 10)}
+	k := NewNetworkDriver(driverName, "node1", fake.NewClientset())
+	k.publisher = publisher
+	k.publishInterval = time.Hour
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go k.publishResources(ctx)
+	select {
+	case <-publisher.published:
+	case <-time.After(wait.ForeverTestTimeout):
+		t.Fatalf("devices not published on start")
+	}
+
+	// the devices are published only if the link change modified them
+	k.notifyLinkChange()
+	select {
+	case <-publisher.published:
+		t.Fatalf("unchanged devices published after a link change")
+	case <-time.After(100 * time.Millisecond):
+	}
+	k.mu.Lock()
+	k.lastDevicesHash = "stale"
+	k.mu.Unlock()
+	k.notifyLinkChange()
+	select {
+	case <-publisher.published:
+	case <-time.After(wait.ForeverTestTimeout):
+		t.Fatalf("changed devices not published after a link change")
+	}
+}
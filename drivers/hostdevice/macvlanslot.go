@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/vishvananda/netlink"
+	resourceapi "k8s.io/api/resource/v1"
+
+	kndnet "github.com/aojea/kubernetes-network-drivers/pkg/net"
+)
+
+// macvlanSlotSuffix separates the host interface from the index in the name
+// of its macvlan slots, <interface>-mvlan<i>.
+const macvlanSlotSuffix = "-mvlan"
+
+// macvlanSlotName returns the name of the macvlan slot i of the host
+// interface parent.
+func macvlanSlotName(parent string, i int) string {
+	return parent + macvlanSlotSuffix + strconv.Itoa(i)
+}
+
+// macvlanSlotDevices returns the macvlan slots published for the host
+// interface link, none if it cannot host a macvlan. Every slot is a device
+// that gets a macvlan child of the interface, so several pods can share it.
+func (k *NetworkDriver) macvlanSlotDevices(link netlink.Link) []resourceapi.Device {
+	if k.macvlanSlots == 0 || !kndnet.SupportsMacvlan(link) {
+		return nil
+	}
+	parent := link.Attrs().Name
+	devices := make([]resourceapi.Device, 0, k.macvlanSlots)
+	for i := range k.macvlanSlots {
+		slot := int64(i)
+		devices = append(devices, resourceapi.Device{
+			Name: macvlanSlotName(parent, i),
+			Attributes: map[resourceapi.QualifiedName]resourceapi.DeviceAttribute{
+				"parent-interface": {StringValue: &parent},
+				"macvlan-slot":     {IntValue: &slot},
+			},
+		})
+	}
+	return devices
+}
+
+// macvlanSlotParent returns the host interface of the macvlan slot name, from
+// the parent-interface attribute of the published device or, before the
+// first publication, from its name. The caller must hold k.mu.
+func (k *NetworkDriver) macvlanSlotParent(name string) (string, bool) {
+	if k.macvlanSlots == 0 {
+		return "", false
+	}
+	for _, device := range k.lastDevices {
+		if device.Name != name {
+			continue
+		}
+		if parent := device.Attributes["parent-interface"].StringValue; parent != nil {
+			return *parent, true
+		}
+		return "", false
+	}
+	i := strings.LastIndex(name, macvlanSlotSuffix)
+	if i < 0 {
+		return "", false
+	}
+	parent := name[:i]
+	slot, err := strconv.Atoi(name[i+len(macvlanSlotSuffix):])
+	if err != nil || slot < 0 || slot >= k.macvlanSlots || macvlanSlotName(parent, slot) != name || !validInterfaceName(parent) {
+		return "", false
+	}
+	return parent, true
+}
+
+// prepareMacvlanSlot sets the device up as the macvlan slot of the host
+// interface parent, a macvlan child of it is created in the pod. It returns
+// an error if the configuration does not attach it as a macvlan.
+func prepareMacvlanSlot(device *PreparedDevice, parent string) error {
+	config := device.Config
+	if config.SriovVF || config.Bond != nil || config.Mode == AttachModeMove || config.Mode == AttachModeBridge || (config.childType() != "" && config.childType() != "macvlan") {
+		return fmt.Errorf("device %s is a macvlan slot of %s, it can only be attached as a macvlan", device.DeviceName, parent)
+	}
+	if config.Child == nil {
+		config.Child = &ChildConfig{Type: "macvlan"}
+	}
+	// the settings of the moved devices are not valid for a child
+	if err := config.validate(); err != nil {
+		return fmt.Errorf("device %s is a macvlan slot of %s: %w", device.DeviceName, parent, err)
+	}
+	device.Config = config
+	device.MacvlanParent = parent
+	return nil
+}
+
+// checkMacvlanSlots returns an error if the device is moved into a pod while
+// a macvlan slot of its host interface is prepared, or is a macvlan slot of a
+// host interface prepared to be moved, the macvlan children need their parent
+// on the host. The caller must hold k.mu.
+func (k *NetworkDriver) checkMacvlanSlots(device PreparedDevice) error {
+	moved := func(d PreparedDevice) bool {
+		return d.Config.childType() == "" && !d.Config.SriovVF
+	}
+	for _, preparedData := range k.sharedState.PreparedData {
+		for _, other := range preparedData {
+			if other.State == DeviceStateDetached {
+				continue
+			}
+			if device.MacvlanParent != "" && other.DeviceName == device.MacvlanParent && moved(other) {
+				return fmt.Errorf("device %s is a macvlan slot of %s, prepared to be moved for claim %s", device.DeviceName, device.MacvlanParent, other.Claim)
+			}
+			if moved(device) && other.MacvlanParent == device.DeviceName {
+				return fmt.Errorf("device %s has the macvlan slot %s prepared for claim %s, it cannot be moved", device.DeviceName, other.DeviceName, other.Claim)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/vishvananda/netlink"
+	resourceapi "k8s.io/api/resource/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func Test_macvlanSlotDevices(t *testing.T) {
+	k := NewNetworkDriver(driverName, "node1", fake.NewClientset())
+	eth1 := &netlink.Device{LinkAttrs: netlink.LinkAttrs{Name: "eth1", EncapType: "ether"}}
+	if slots := k.macvlanSlotDevices(eth1); len(slots) != 0 {
+		t.Errorf("expected no slots by default, got %d", len(slots))
+	}
+
+	k.macvlanSlots = 2
+	slots := k.macvlanSlotDevices(eth1)
+	if len(slots) != 2 {
+		t.Fatalf("expected 2 slots, got %d", len(slots))
+	}
+	for i, slot := range slots {
+		if want := fmt.Sprintf("eth1-mvlan%d", i); slot.Name != want {
+			t.Errorf("expected slot %s, got %s", want, slot.Name)
+		}
+		if parent := slot.Attributes["parent-interface"].StringValue; parent == nil || *parent != "eth1" {
+			t.Errorf("unexpected parent-interface %v of slot %s", parent, slot.Name)
+		}
+		if index := slot.Attributes["macvlan-slot"].IntValue; index == nil || *index != int64(i) {
+			t.Errorf("unexpected macvlan-slot %v of slot %s", index, slot.Name)
+		}
+	}
+
+	// the kernel refuses a macvlan on a bond member
+	member := &netlink.Device{LinkAttrs: netlink.LinkAttrs{Name: "eth2", EncapType: "ether", MasterIndex: 5}}
+	if slots := k.macvlanSlotDevices(member); len(slots) != 0 {
+		t.Errorf("expected no slots for a bond member, got %d", len(slots))
+	}
+}
+
+func Test_macvlanSlotParent(t *testing.T) {
+	k := NewNetworkDriver(driverName, "node1", fake.NewClientset())
+	if _, ok := k.macvlanSlotParent("eth1-mvlan0"); ok {
+		t.Errorf("expected no slots by default")
+	}
+
+	k.macvlanSlots = 2
+	parent := "ens1f0"
+	k.lastDevices = []resourceapi.Device{
+		{Name: "slot-a", Attributes: map[resourceapi.QualifiedName]resourceapi.DeviceAttribute{"parent-interface": {StringValue: &parent}}},
+		{Name: "eth3-mvlan0"},
+	}
+	tests := []struct {
+		name       string
+		wantParent string
+		wantSlot   bool
+	}{
+		// the attribute of the published device wins
+		{name: "slot-a", wantParent: "ens1f0", wantSlot: true},
+		{name: "eth3-mvlan0"},
+		// before the first publication the name is parsed
+		{name: "eth1-mvlan1", wantParent: "eth1", wantSlot: true},
+		{name: "eth1-mvlan2"},
+		{name: "eth1-mvlan01"},
+		{name: "eth1-mvlanx"},
+		{name: "eth1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parent, ok := k.macvlanSlotParent(tt.name)
+			if ok != tt.wantSlot || parent != tt.wantParent {
+				t.Errorf("macvlanSlotParent(%s) = %q, %v, want %q, %v", tt.name, parent, ok, tt.wantParent, tt.wantSlot)
+			}
+		})
+	}
+}
+
+func Test_PrepareResourceClaims_macvlanSlot(t *testing.T) {
+	k := NewNetworkDriver(driverName, "node1", fake.NewClientset())
+	k.checkpointPath = ""
+	k.macvlanSlots = 2
+
+	claim := newClaimWithDevices("slot-uid", "eth1-mvlan0", "eth1-mvlan1")
+	claim.Status.Allocation.Devices.Config = []resourceapi.DeviceAllocationConfiguration{
+		opaqueConfig(driverName, nil, `{"ips":["192.168.5.10/24"],"interfaceName":"net1"}`),
+	}
+	results, err := k.PrepareResourceClaims(context.Background(), []*resourceapi.ResourceClaim{claim})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// both slots get the same interface name in the pod
+	if err := results[claim.UID].Err; err == nil || !strings.Contains(err.Error(), "net1") {
+		t.Errorf("expected the interface names to collide, got %v", err)
+	}
+
+	claim = newClaimWithDevices("slot-uid", "eth1-mvlan0")
+	claim.Status.Allocation.Devices.Config = []resourceapi.DeviceAllocationConfiguration{
+		opaqueConfig(driverName, nil, `{"ips":["192.168.5.10/24"],"interfaceName":"net1"}`),
+	}
+	results, err = k.PrepareResourceClaims(context.Background(), []*resourceapi.ResourceClaim{claim})
+	if err != nil || results[claim.UID].Err != nil {
+		t.Fatalf("unexpected error: %v %v", err, results[claim.UID].Err)
+	}
+	device := k.sharedState.PreparedData[claim.UID][0]
+	if device.Config.Child == nil || device.Config.Child.Type != "macvlan" {
+		t.Errorf("expected a macvlan child, got %+v", device.Config.Child)
+	}
+	if device.hostInterface() != "eth1" || device.podInterface() != "net1" {
+		t.Errorf("expected a macvlan net1 on eth1, got %s on %s", device.podInterface(), device.hostInterface())
+	}
+
+	tests := []struct {
+		name    string
+		device  string
+		params  string
+		wantErr string
+	}{
+		{
+			name:    "moved slot",
+			device:  "eth1-mvlan1",
+			params:  `{"mode":"move"}`,
+			wantErr: "it can only be attached as a macvlan",
+		},
+		{
+			name:    "setting of a moved device",
+			device:  "eth1-mvlan1",
+			params:  `{"permanentMAC":true}`,
+			wantErr: "permanentMAC and child are mutually exclusive",
+		},
+		{
+			name:    "parent with a slot prepared",
+			device:  "eth1",
+			params:  `{}`,
+			wantErr: "has the macvlan slot eth1-mvlan0 prepared",
+		},
+		{
+			name:   "parent with a slot prepared as a child",
+			device: "eth1",
+			params: `{"mode":"macvlan"}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claim := newClaimWithDevices("other-uid", tt.device)
+			claim.Status.Allocation.Devices.Config = []resourceapi.DeviceAllocationConfiguration{opaqueConfig(driverName, nil, tt.params)}
+			results, err := k.PrepareResourceClaims(context.Background(), []*resourceapi.ResourceClaim{claim})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			err = results[claim.UID].Err
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				k.mu.Lock()
+				delete(k.sharedState.PreparedData, claim.UID)
+				k.mu.Unlock()
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected error %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func Test_deviceSlices(t *testing.T) {
+	if got := deviceSlices(nil); len(got) != 1 || len(got[0].Devices) != 0 {
+		t.Errorf("expected a single empty slice, got %v", got)
+	}
+	devices := make([]resourceapi.Device, resourceapi.ResourceSliceMaxDevices+2)
+	got := deviceSlices(devices)
+	if len(got) != 2 || len(got[0].Devices) != resourceapi.ResourceSliceMaxDevices || len(got[1].Devices) != 2 {
+		t.Errorf("expected the devices split in slices of %d, got %d slices", resourceapi.ResourceSliceMaxDevices, len(got))
+	}
+}
@@ -2,6 +2,10 @@ package main
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"net"
@@ -10,6 +14,7 @@ import (
 	"os/signal"
 	"path/filepath"
 	"runtime/debug"
+	"slices"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -21,13 +26,20 @@ import (
 	"github.com/vishvananda/netlink"
 	"golang.org/x/sys/unix"
 
+	v1 "k8s.io/api/core/v1"
 	resourceapi "k8s.io/api/resource/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
 	nodeutil "k8s.io/component-helpers/node/util"
 	"k8s.io/dynamic-resource-allocation/kubeletplugin"
 	"k8s.io/dynamic-resource-allocation/resourceslice"
@@ -42,6 +54,115 @@ type AllocatedDevice struct {
 	Attributes map[string]string
 	PoolName   string
 	Request    string
+	// NetworkNamespace is the pod network namespace the device was moved into.
+	NetworkNamespace string
+	// SandboxNamespace is the network namespace of the pod sandbox the
+	// device was attached for, set only when the device was moved into
+	// another network namespace of the pod.
+	SandboxNamespace string `json:",omitempty"`
+	// PodInterface is the name of the interface in the pod when the device
+	// was renamed, recorded to restore it if the pod is gone.
+	PodInterface string `json:",omitempty"`
+	// SpeedMbps is the link speed reported by the host before the device was moved.
+	SpeedMbps int
+	// HardwareAddr is the MAC address of the device before it was moved,
+	// recorded to be restored when the permanent MAC is set in the pod.
+	HardwareAddr string
+	// HardwareTimestamping is the hardware timestamping configuration of the
+	// device before it was moved, recorded to be restored when the pod
+	// configures it.
+	HardwareTimestamping *kndnet.HardwareTimestamping
+	// MTU is the MTU of the device before it was moved, recorded to be
+	// restored when the pod sets another one.
+	MTU int
+	// Ethtool are the features and ring sizes of the device before it was
+	// moved, recorded to be restored when the pod configures them.
+	Ethtool *kndnet.EthtoolConfig `json:",omitempty"`
+	// BroughtUp is set once a device brought up with a container was
+	// brought up, the restarts of the container do not configure it again.
+	BroughtUp bool `json:",omitempty"`
+}
+
+// DeviceState is the stage of the lifecycle a prepared device is in.
+type DeviceState string
+
+const (
+	// DeviceStatePrepared devices have been prepared but the pod sandbox has not run yet.
+	DeviceStatePrepared DeviceState = "prepared"
+	// DeviceStateAttached devices have been moved into the pod network namespace.
+	DeviceStateAttached DeviceState = "attached"
+	// DeviceStateDetached devices have been returned to the host but not unprepared yet.
+	DeviceStateDetached DeviceState = "detached"
+)
+
+// PrepareFailureMode defines how a claim with multiple devices is prepared
+// when some of its devices fail.
+type PrepareFailureMode string
+
+const (
+	// PrepareAllOrNothing fails the whole claim if any of its devices fails.
+	PrepareAllOrNothing PrepareFailureMode = "all-or-nothing"
+	// PrepareBestEffort prepares the claim with the devices that succeeded.
+	PrepareBestEffort PrepareFailureMode = "best-effort"
+)
+
+// devicePrepareFailedReason is the reason of the events of the devices of a
+// claim that failed to prepare.
+const devicePrepareFailedReason = "DevicePrepareFailed"
+
+// LinkUpFailureMode defines how a device returned to the host on pod stop
+// that cannot be set up again is handled.
+type LinkUpFailureMode string
+
+const (
+	// LinkUpFailureWarn considers the device detached and emits a warning.
+	LinkUpFailureWarn LinkUpFailureMode = "warn"
+	// LinkUpFailureRetry keeps the device attached so it is restored again
+	// when the pod sandbox is removed or reconciled.
+	LinkUpFailureRetry LinkUpFailureMode = "retry"
+)
+
+// PreparedDevice is the data computed for an allocated device by the PrepareDevice hook.
+type PreparedDevice struct {
+	// DeviceName is the name of the device on the host.
+	DeviceName string
+	// InterfaceName is the host interface moved into the pod when it is not
+	// the device itself, like a virtual function of an SR-IOV device.
+	InterfaceName string
+	// MacvlanParent is the host interface the macvlan child of a macvlan
+	// slot is created on.
+	MacvlanParent string `json:",omitempty"`
+	// Claim is the namespace and name of the claim the device was prepared for.
+	Claim types.NamespacedName
+	// PoolName is the pool the device was allocated from.
+	PoolName string
+	// Group is the device group the device was prepared in, if any.
+	Group string
+	// Request is the claim request the device was allocated for.
+	Request string
+	// Config is the driver configuration for the device.
+	Config DeviceConfig
+	// Addresses are the parsed ips of the configuration set on the interface.
+	Addresses []*net.IPNet
+	// PolicyTable is the routing table of the policy routing of the device
+	// in the pod, allocated when the pod sandbox is run.
+	PolicyTable int
+	// NetworkData is the interface of the device in the pod, with its MAC
+	// and addresses, reported in the device status of the claim while the
+	// device is attached.
+	NetworkData *resourceapi.NetworkDeviceData `json:",omitempty"`
+	// EgressRate is the egress rate applied to the device in the pod, the
+	// one of the configuration or the default of the pod QoS class, recorded
+	// when the pod sandbox is run.
+	EgressRate *resource.Quantity `json:",omitempty"`
+	// Consumers are the UIDs of the pods the claim was reserved for when the
+	// device was prepared, the sandbox of one of them gets the device.
+	Consumers []types.UID `json:",omitempty"`
+	// Attributes are the attributes of the published device when it was
+	// prepared, reported with the device of the pod.
+	Attributes map[string]string `json:",omitempty"`
+	// State is the current stage of the device lifecycle.
+	State DeviceState
 }
 
 // SharedState is the data that is shared between the DRA and NRI hooks.
@@ -50,14 +171,41 @@ type SharedState struct {
 	// PodDeviceConfig maps a pod's UID to the devices that have been allocated to it.
 	PodDeviceConfig map[types.UID][]AllocatedDevice
 	// PreparedData maps a pod's UID to the data that was returned by the PrepareDevice hook.
-	PreparedData map[types.UID]interface{}
+	PreparedData map[types.UID][]PreparedDevice
+	// PodNames maps a pod's UID to its namespace and name.
+	PodNames map[types.UID]types.NamespacedName
 }
 
 const (
 	maxAttempts        = 10
 	stabilityThreshold = 5 * time.Minute
+
+	defaultReconcileInterval = 1 * time.Minute
+	// defaultPublishInterval is how often the devices are published by default.
+	defaultPublishInterval = 30 * time.Second
+	// defaultForcePublishAfter is how long the same devices are not
+	// published again by default.
+	defaultForcePublishAfter = 10 * time.Minute
+	// defaultDADTimeout is how long the IPv6 addresses of a device brought
+	// up in a pod can run the duplicate address detection by default.
+	defaultDADTimeout = 5 * time.Second
+	// deviceCheckInterval is how often the devices are discovered between
+	// the publications, to publish the changes right away.
+	deviceCheckInterval = 5 * time.Second
+	// defaultNRIPluginIndex orders the NRI plugin among the plugins of the
+	// runtime by default.
+	defaultNRIPluginIndex = "10"
 )
 
+// ignoredInterfacePrefixes are the prefixes of the host virtual interfaces,
+// the pod ends of the veth pairs and the bridges, that are never published.
+var ignoredInterfacePrefixes = []string{"veth", "docker", "cni"}
+
+// resourcePublisher publishes the devices of the node in ResourceSlices.
+type resourcePublisher interface {
+	PublishResources(ctx context.Context, resources resourceslice.DriverResources) error
+}
+
 // NetworkDriver manages the lifecycle of the DRA and NRI plugins.
 type NetworkDriver struct {
 	driverName string
@@ -65,9 +213,176 @@ type NetworkDriver struct {
 	kubeClient kubernetes.Interface
 	draPlugin  *kubeletplugin.Helper
 	nriPlugin  stub.Stub
+	publisher  resourcePublisher
+	// host are the operations on the interfaces and the devices of the node.
+	host hostOps
+	// nriPluginName and nriPluginIndex register the NRI plugin, the index
+	// orders it among the plugins of the runtime.
+	nriPluginName  string
+	nriPluginIndex string
+	// lastDevices are the devices of the last publication, lastDevicesHash
+	// their content hash and publishStatus the outcome of the publications,
+	// guarded by mu.
+	lastDevices     []resourceapi.Device
+	lastDevicesHash string
+	publishStatus   PublishStatus
+	// published is set after the first successful publication of the devices.
+	published atomic.Bool
+	// nriConnected is set while the NRI plugin is registered with the runtime.
+	nriConnected atomic.Bool
+	// nriFailed is set once the NRI plugin failed to restart after
+	// maxAttempts, so the liveness probe restarts the driver.
+	nriFailed atomic.Bool
+	// draRegistered returns whether the DRA plugin is registered with the
+	// kubelet, nil until it is started.
+	draRegistered func() bool
+	// initialPublishRetries is how many times the first publication is
+	// retried with backoff when the driver starts, 0 disables the retries.
+	initialPublishRetries int
+	// initialPublishBackoff is the wait before the first retry of the first
+	// publication, it doubles with each attempt up to the publish interval.
+	initialPublishBackoff time.Duration
 
 	mu          sync.Mutex
 	sharedState *SharedState
+	// sourceGroups are the source-specific multicast memberships of the devices of the pods.
+	sourceGroups sourceGroupJoins
+	// podLocks serialize the sandbox operations of each pod.
+	podLocks podLocks
+
+	// checkpointPath is the file where the shared state is persisted.
+	checkpointPath string
+	// checkpointLoaded is true when the state was restored from the
+	// checkpoint, otherwise it is rebuilt from the claims on synchronize.
+	checkpointLoaded bool
+	// podsDir is the kubelet directory with the pod directories the
+	// network namespaces of the device configurations are relative to.
+	podsDir string
+	// procDir and cgroupDir are the mount points of the proc and the cgroup
+	// v2 filesystems of the host, and netnsPinDir the directory of the named
+	// network namespaces of the host.
+	procDir     string
+	cgroupDir   string
+	netnsPinDir string
+	// readinessDir is the directory with the readiness markers of the pods.
+	readinessDir string
+	// reconcileInterval is how often the state of orphaned pods is reconciled.
+	reconcileInterval time.Duration
+	// publishInterval is how often the devices are published, and
+	// forcePublishAfter how long the publication is skipped while they do
+	// not change, 0 never skips it.
+	publishInterval   time.Duration
+	forcePublishAfter time.Duration
+	// cleanupChildren removes the child interfaces leaked by a previous instance on startup.
+	cleanupChildren bool
+	// qosDefaults are the device settings applied to the pods of each QoS class.
+	qosDefaults map[v1.PodQOSClass]QoSDefaults
+	// failureMode defines how claims with multiple devices handle partial failures.
+	failureMode PrepareFailureMode
+	// linkUpFailureMode defines how devices that fail to come back up on detach are handled.
+	linkUpFailureMode LinkUpFailureMode
+	// utilizationInterval is how often the device counters are sampled, 0 disables it.
+	utilizationInterval time.Duration
+	// utilizationAnnotation records the device utilization in the pod annotations.
+	utilizationAnnotation bool
+	// errorRateThreshold are the errors or drops per second of a device in a
+	// pod reported with an event, 0 disables the monitoring.
+	errorRateThreshold float64
+	// errorSampleInterval is how often the error counters of the devices are sampled.
+	errorSampleInterval time.Duration
+	// deviceErrors are the last error samples of the devices in pods.
+	deviceErrors deviceErrorSamples
+	// allocationPolicy is the order the devices are published in.
+	allocationPolicy AllocationPolicy
+	// deviceGrouping defines the devices that are only allocated together.
+	deviceGrouping DeviceGrouping
+	// deviceGroups maps the interfaces to their group with the config grouping.
+	deviceGroups map[string]string
+	// webhook is notified of the device events, nil disables it.
+	webhook *webhook
+	// teardownHook is run after each device of a pod is returned to the
+	// host, nil disables it.
+	teardownHook *teardownHook
+	// linkUpRetries is how many times the bring up of a moved device is retried.
+	linkUpRetries int
+	// namespaceRetries is how many times opening a pod network namespace not ready yet is retried.
+	namespaceRetries int
+	// dadTimeout is how long to wait for the IPv6 addresses of a device
+	// brought up in a pod to leave the tentative state, 0 does not wait.
+	dadTimeout time.Duration
+	// netnsOps limits the devices attached and detached at the same time, nil is unlimited.
+	netnsOps *netnsLimiter
+	// maxNetnsOps is the limit of netnsOps, for the effective configuration.
+	maxNetnsOps int
+	// sriovCreateVFs creates the virtual functions of the SR-IOV physical functions on start.
+	sriovCreateVFs bool
+	// sriovCleanupVFs removes the virtual functions created by the driver on stop.
+	sriovCleanupVFs bool
+	// sriovEnabledPFs are the physical functions whose virtual functions were created by the driver.
+	sriovEnabledPFs sets.Set[string]
+	// sriovOnDemand creates virtual functions when a claim needs one and there are no free ones.
+	sriovOnDemand bool
+	// sriovLocks serialize the virtual function allocation per physical function.
+	sriovLocks sync.Map
+	// sriovReserved are the virtual functions allocated by claims being prepared.
+	sriovReserved sets.Set[string]
+	// blocklist are the interface names and MACs that are never published.
+	blocklist sets.Set[string]
+	// interfaceFilter are the patterns of the interface names that are published.
+	interfaceFilter interfaceFilter
+	// reservedInterfacesFile lists the interface names that are never
+	// published, reloaded on SIGHUP.
+	reservedInterfacesFile string
+	// reservedInterfaces are the interface names of reservedInterfacesFile.
+	reservedInterfaces sets.Set[string]
+	// allowDefaultRouteInterface publishes the interfaces carrying the
+	// default route of the node, skipped otherwise.
+	allowDefaultRouteInterface bool
+	// defaultRouteSkipped are the interfaces last skipped because they carry
+	// the default route, to warn once about each of them.
+	defaultRouteSkipped sets.Set[string]
+	// allowlist are the only interface names that can be published and
+	// moved into pods, nil allows all of them.
+	allowlist sets.Set[string]
+	// republish triggers a publication before the next period.
+	republish chan struct{}
+	// watchLinks checks the devices on the link and address changes of the
+	// host instead of polling them.
+	watchLinks bool
+	// linkChanges triggers a check of the devices after a link change.
+	linkChanges chan struct{}
+	// reserveDevices withholds the prepared devices from the published ones.
+	reserveDevices bool
+	// macvlanSlots is the number of macvlan slots published per host
+	// interface that can host a macvlan.
+	macvlanSlots int
+	// namespaceQuotas are the maximum number of devices per namespace.
+	namespaceQuotas map[string]int
+	// defaultNamespaceQuota limits the namespaces without a quota, 0 is unlimited.
+	defaultNamespaceQuota int
+	// statusAnnotation records the network status of the pods in their annotations.
+	statusAnnotation bool
+	// preserveDNS pins the routes to the cluster DNS before a device
+	// installs a default route in a pod.
+	preserveDNS bool
+	// clusterDNS are the cluster DNS IPs whose routes are preserved.
+	clusterDNS []net.IP
+	// detachVerifyTimeout is how long to wait for a detached device to
+	// reappear on the host, 0 disables the verification.
+	detachVerifyTimeout time.Duration
+	// bandwidthOversubscription is how many times the link speed of a device
+	// the egress rates of its prepared devices can add up to, 0 is unlimited.
+	bandwidthOversubscription float64
+	// claimDeletionMode defines what happens to the devices of a running pod whose claim is deleted.
+	claimDeletionMode ClaimDeletionMode
+	// claimDeletions are the deletions of the claims of the running pods
+	// waiting to be handled.
+	claimDeletions workqueue.TypedRateLimitingInterface[claimDeletion]
+	// bootSettleDelay is how long after the node boot the devices are first published.
+	bootSettleDelay time.Duration
+	// eventRecorder emits the events of the claims and pods, nil until the driver starts.
+	eventBroadcaster record.EventBroadcaster
+	eventRecorder    record.EventRecorder
 }
 
 // NewNetworkDriver creates a new NetworkDriver instance.
@@ -76,10 +391,42 @@ func NewNetworkDriver(driverName, nodeName string, kubeClient kubernetes.Interfa
 		driverName: driverName,
 		nodeName:   nodeName,
 		kubeClient: kubeClient,
+		host:       newHostOps(),
 		sharedState: &SharedState{
 			PodDeviceConfig: make(map[types.UID][]AllocatedDevice),
-			PreparedData:    make(map[types.UID]interface{}),
+			PreparedData:    make(map[types.UID][]PreparedDevice),
+			PodNames:        make(map[types.UID]types.NamespacedName),
 		},
+		nriPluginName:     driverName,
+		nriPluginIndex:    defaultNRIPluginIndex,
+		checkpointPath:    defaultCheckpointPath(filepath.Join(kubeletplugin.KubeletPluginsDir, driverName)),
+		podsDir:           defaultPodsDir,
+		procDir:           "/proc",
+		cgroupDir:         "/sys/fs/cgroup",
+		netnsPinDir:       "/var/run/netns",
+		readinessDir:      filepath.Join(kubeletplugin.KubeletPluginsDir, driverName, readinessDirName),
+		reconcileInterval: defaultReconcileInterval,
+		publishInterval:   defaultPublishInterval,
+		forcePublishAfter: defaultForcePublishAfter,
+		cleanupChildren:   true,
+		failureMode:       PrepareAllOrNothing,
+		linkUpFailureMode: LinkUpFailureWarn,
+		claimDeletionMode: ClaimDeletionKeep,
+		allocationPolicy:  AllocationPolicyNone,
+		deviceGrouping:    DeviceGroupingNone,
+		linkUpRetries:     kndnet.DefaultLinkUpRetries,
+		namespaceRetries:  kndnet.DefaultNamespaceRetries,
+		dadTimeout:        defaultDADTimeout,
+		sriovEnabledPFs:   sets.New[string](),
+		sriovOnDemand:     true,
+		sriovReserved:     sets.New[string](),
+		blocklist:         sets.New[string](),
+		republish:         make(chan struct{}, 1),
+		watchLinks:        true,
+		linkChanges:       make(chan struct{}, 1),
+		claimDeletions: workqueue.NewTypedRateLimitingQueueWithConfig(workqueue.DefaultTypedControllerRateLimiter[claimDeletion](),
+			workqueue.TypedRateLimitingQueueConfig[claimDeletion]{Name: "claim-deletions"}),
+		initialPublishBackoff: defaultInitialPublishBackoff,
 	}
 }
 
@@ -90,6 +437,31 @@ func (k *NetworkDriver) Start(ctx context.Context) error {
 		return fmt.Errorf("failed to create plugin path %s: %w", driverPluginPath, err)
 	}
 
+	if err := k.loadCheckpoint(); err != nil {
+		return err
+	}
+	if err := k.validateAllowlist(); err != nil {
+		return err
+	}
+
+	k.eventBroadcaster = record.NewBroadcaster(record.WithContext(ctx))
+	k.eventBroadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: k.kubeClient.CoreV1().Events("")})
+	k.eventRecorder = k.eventBroadcaster.NewRecorder(scheme.Scheme, v1.EventSource{Component: k.driverName, Host: k.nodeName})
+
+	if k.preserveDNS && len(k.clusterDNS) == 0 {
+		clusterDNS, err := discoverClusterDNS(ctx, k.kubeClient)
+		if err != nil {
+			klog.Warningf("The routes to the cluster DNS will not be preserved, set --cluster-dns: %v", err)
+		}
+		k.clusterDNS = clusterDNS
+	}
+
+	if k.cleanupChildren {
+		if err := k.cleanupOrphanedChildren(ctx); err != nil {
+			klog.Errorf("failed to cleanup orphaned interfaces: %v", err)
+		}
+	}
+
 	kubeletOptions := []kubeletplugin.Option{
 		kubeletplugin.DriverName(k.driverName),
 		kubeletplugin.NodeName(k.nodeName),
@@ -100,18 +472,25 @@ func (k *NetworkDriver) Start(ctx context.Context) error {
 		return fmt.Errorf("start kubelet plugin: %w", err)
 	}
 	k.draPlugin = draHelper
+	k.publisher = draHelper
+	k.draRegistered = func() bool {
+		status := draHelper.RegistrationStatus()
+		return status != nil && status.PluginRegistered
+	}
 
 	if err := wait.PollUntilContextTimeout(ctx, 1*time.Second, 30*time.Second, true, func(context.Context) (bool, error) {
-		status := k.draPlugin.RegistrationStatus()
-		return status != nil && status.PluginRegistered, nil
+		return k.draRegistered(), nil
 	}); err != nil {
 		return err
 	}
 
 	nriOptions := []stub.Option{
-		stub.WithPluginName(k.driverName),
-		stub.WithPluginIdx("10"),
-		stub.WithOnClose(func() { klog.Infof("%s NRI plugin closed", k.driverName) }),
+		stub.WithPluginName(k.nriPluginName),
+		stub.WithPluginIdx(k.nriPluginIndex),
+		stub.WithOnClose(func() {
+			k.nriConnected.Store(false)
+			klog.Infof("%s NRI plugin closed", k.nriPluginName)
+		}),
 	}
 	nriStub, err := stub.New(k, nriOptions...)
 	if err != nil {
@@ -119,8 +498,35 @@ func (k *NetworkDriver) Start(ctx context.Context) error {
 	}
 	k.nriPlugin = nriStub
 
+	// virtual functions must exist before they can be published and allocated
+	if k.sriovCreateVFs {
+		if err := k.enableSriovVFs(); err != nil {
+			klog.Errorf("failed to enable SR-IOV virtual functions: %v", err)
+		}
+	}
+
+	if k.reservedInterfacesFile != "" {
+		k.watchReservedInterfaces(ctx)
+	}
+	if err := k.watchNodeBlocklist(ctx); err != nil {
+		return fmt.Errorf("failed to watch node %s: %w", k.nodeName, err)
+	}
+	if err := k.watchClaimDeletions(ctx); err != nil {
+		return fmt.Errorf("failed to watch resource claims: %w", err)
+	}
+
 	go k.runNRIPlugin(ctx)
+	if k.watchLinks {
+		go k.watchLinkChanges(ctx)
+	}
 	go k.publishResources(ctx)
+	go k.reconcileOrphanedPods(ctx)
+	if k.utilizationInterval > 0 {
+		go k.sampleUtilization(ctx)
+	}
+	if k.errorRateThreshold > 0 {
+		go k.watchDeviceErrors(ctx)
+	}
 
 	return nil
 }
@@ -134,6 +540,12 @@ func (k *NetworkDriver) Stop() {
 	if k.draPlugin != nil {
 		k.draPlugin.Stop()
 	}
+	if k.sriovCleanupVFs {
+		k.disableSriovVFs()
+	}
+	if k.eventBroadcaster != nil {
+		k.eventBroadcaster.Shutdown()
+	}
 	klog.Info("Network driver plugin stopped.")
 }
 
@@ -142,19 +554,71 @@ func (k *NetworkDriver) PrepareResourceClaims(ctx context.Context, claims []*res
 	klog.V(2).Infof("PrepareResourceClaims called for %d claims", len(claims))
 	results := make(map[types.UID]kubeletplugin.PrepareResult)
 	for _, claim := range claims {
+		// the kubelet prepares the claims of the running pods again when it restarts
+		k.mu.Lock()
+		assigned := k.assignedDevices(types.NamespacedName{Namespace: claim.Namespace, Name: claim.Name})
+		k.mu.Unlock()
+		if len(assigned) > 0 {
+			klog.V(2).Infof("Claim %s/%s is already assigned to a pod", claim.Namespace, claim.Name)
+			results[claim.UID] = prepareResult(assigned)
+			continue
+		}
+		if err := k.checkDeviceGroups(claim); err != nil {
+			klog.Warningf("Failed to prepare claim %s/%s: %v", claim.Namespace, claim.Name, err)
+			k.recordPartialGroup(claim, err)
+			results[claim.UID] = kubeletplugin.PrepareResult{Err: err}
+			continue
+		}
 		preparedData, err := k.prepareDevice(ctx, claim)
 		if err != nil {
 			results[claim.UID] = kubeletplugin.PrepareResult{Err: err}
 			continue
 		}
 		k.mu.Lock()
+		if err := k.checkNamespaceQuota(claim, len(preparedData)); err != nil {
+			k.releaseSriovVFs(preparedData)
+			k.mu.Unlock()
+			klog.Warningf("Failed to prepare claim %s/%s: %v", claim.Namespace, claim.Name, err)
+			k.recordQuotaExceeded(claim, err)
+			results[claim.UID] = kubeletplugin.PrepareResult{Err: err}
+			continue
+		}
+		if err := k.checkBandwidth(claim, preparedData); err != nil {
+			k.releaseSriovVFs(preparedData)
+			k.mu.Unlock()
+			klog.Warningf("Failed to prepare claim %s/%s: %v", claim.Namespace, claim.Name, err)
+			k.recordBandwidthExceeded(claim, err)
+			results[claim.UID] = kubeletplugin.PrepareResult{Err: err}
+			continue
+		}
 		k.sharedState.PreparedData[claim.UID] = preparedData
+		k.releaseSriovVFs(preparedData)
+		k.updateDeviceStateMetrics()
+		if err := k.saveCheckpoint(); err != nil {
+			klog.Errorf("failed to save checkpoint: %v", err)
+		}
+		if k.reserveDevices {
+			k.requestRepublish()
+		}
 		k.mu.Unlock()
-		results[claim.UID] = kubeletplugin.PrepareResult{}
+		results[claim.UID] = prepareResult(preparedData)
 	}
 	return results, nil
 }
 
+// prepareResult returns the devices prepared for a claim to the kubelet.
+func prepareResult(preparedData []PreparedDevice) kubeletplugin.PrepareResult {
+	result := kubeletplugin.PrepareResult{}
+	for _, device := range preparedData {
+		result.Devices = append(result.Devices, kubeletplugin.Device{
+			Requests:   []string{device.Request},
+			PoolName:   device.PoolName,
+			DeviceName: device.DeviceName,
+		})
+	}
+	return result
+}
+
 func (k *NetworkDriver) UnprepareResourceClaims(ctx context.Context, claims []kubeletplugin.NamespacedObject) (map[types.UID]error, error) {
 	klog.V(2).Infof("UnprepareResourceClaims called for %d claims", len(claims))
 	errors := make(map[types.UID]error)
@@ -164,39 +628,240 @@ func (k *NetworkDriver) UnprepareResourceClaims(ctx context.Context, claims []ku
 		}
 		k.mu.Lock()
 		delete(k.sharedState.PreparedData, claim.UID)
+		k.releaseClaimDevices(claim)
+		k.updateDeviceStateMetrics()
+		if err := k.saveCheckpoint(); err != nil {
+			klog.Errorf("failed to save checkpoint: %v", err)
+		}
+		if k.reserveDevices {
+			k.requestRepublish()
+		}
 		k.mu.Unlock()
 	}
 	return errors, nil
 }
 
 // HandleError is called for errors encountered in the background.
+// The ResourceSlice controller reports its publishing errors here as recoverable.
 func (k *NetworkDriver) HandleError(ctx context.Context, err error, msg string) {
+	if errors.Is(err, kubeletplugin.ErrRecoverable) {
+		resourcePublishTotal.WithLabelValues(publishErrorReason(err)).Inc()
+		k.recordPublishError(fmt.Errorf("%s: %w", msg, err))
+	}
 	runtime.HandleError(fmt.Errorf("%s: %w", msg, err))
 }
 
 // NRI handler implementation
 func (k *NetworkDriver) Synchronize(ctx context.Context, pods []*api.PodSandbox, containers []*api.Container) ([]*api.ContainerUpdate, error) {
-	klog.V(2).Info("Synchronize called")
+	klog.V(2).Infof("Synchronize called for %d pods", len(pods))
+	k.synchronize(ctx, pods)
 	return nil, nil
 }
 
 // RunPodSandbox is called when a pod is created by the Container Runtime.
-func (k *NetworkDriver) RunPodSandbox(ctx context.Context, pod *api.PodSandbox) error {
+func (k *NetworkDriver) RunPodSandbox(ctx context.Context, pod *api.PodSandbox) (err error) {
 	klog.V(2).Infof("RunPodSandbox called for pod %s/%s", pod.Namespace, pod.Name)
+	start := time.Now()
+	defer func() { k.observeRunPodSandbox(start, err) }()
+	unlock := k.podLocks.lock(types.UID(pod.Uid))
+	defer unlock()
+	return k.runPodSandbox(ctx, pod)
+}
+
+// runPodSandbox attaches the devices of the pod to its sandbox. The caller
+// must hold the pod lock and not k.mu.
+func (k *NetworkDriver) runPodSandbox(ctx context.Context, pod *api.PodSandbox) error {
 	podUID := types.UID(pod.Uid)
-	networkNamespace := getNetworkNamespace(pod)
+	networkNamespace := k.getNetworkNamespace(pod)
 	if networkNamespace == "" {
 		return fmt.Errorf("pod %s/%s has no network namespace", pod.Namespace, pod.Name)
 	}
 
+	if err := k.resolvePodDevices(ctx, pod); err != nil {
+		return err
+	}
 	k.mu.Lock()
-	defer k.mu.Unlock()
 
 	devices := k.sharedState.PodDeviceConfig[podUID]
 	preparedData := k.sharedState.PreparedData[podUID]
 
+	// a device still attached to another namespace belongs to a previous
+	// sandbox of the pod that was not stopped yet, moving it here would
+	// leave the stop of that sandbox restoring it from under this one
+	for _, device := range devices {
+		prepared, _ := findPreparedDevice(preparedData, device.Name)
+		if prepared.State == DeviceStateAttached && device.sandboxNamespace() != "" && device.sandboxNamespace() != networkNamespace {
+			k.mu.Unlock()
+			return fmt.Errorf("device %s of pod %s/%s is still attached to network namespace %s of a previous sandbox",
+				device.Name, pod.Namespace, pod.Name, device.sandboxNamespace())
+		}
+	}
+
+	// the devices targeting another network namespace of the pod are only
+	// moved if it is there, otherwise the sandbox fails and is retried
+	targets := make(map[string]string)
+	for _, device := range devices {
+		prepared, _ := findPreparedDevice(preparedData, device.Name)
+		if prepared.Config.NetworkNamespace == "" || prepared.State == DeviceStateAttached {
+			continue
+		}
+		target, err := k.resolvePodNetworkNamespace(podUID, prepared.Config.NetworkNamespace)
+		if err != nil {
+			k.mu.Unlock()
+			return fmt.Errorf("device %s of pod %s/%s: %w", device.Name, pod.Namespace, pod.Name, err)
+		}
+		targets[device.Name] = target
+	}
+
+	// record the namespace so the devices can be restored even if the
+	// pod is deleted while the driver is not running
+	for i := range devices {
+		if prepared, ok := findPreparedDevice(preparedData, devices[i].Name); ok {
+			devices[i].PodInterface = prepared.Config.InterfaceName
+			// a device moved again into a new sandbox is brought up again
+			if prepared.State != DeviceStateAttached {
+				devices[i].BroughtUp = false
+			}
+		}
+		if target, ok := targets[devices[i].Name]; ok {
+			devices[i].NetworkNamespace = target
+			devices[i].SandboxNamespace = networkNamespace
+		} else if devices[i].SandboxNamespace != networkNamespace {
+			devices[i].NetworkNamespace = networkNamespace
+			devices[i].SandboxNamespace = ""
+		}
+		// the speed is only available from the host sysfs
+		if speed, err := k.host.linkSpeed(devices[i].Name); err == nil {
+			devices[i].SpeedMbps = speed
+		}
+		if prepared, ok := findPreparedDevice(preparedData, devices[i].Name); ok && prepared.Config.PermanentMAC && devices[i].HardwareAddr == "" {
+			if link, err := k.host.linkByName(prepared.hostInterface()); err == nil {
+				devices[i].HardwareAddr = link.Attrs().HardwareAddr.String()
+			}
+		}
+		if prepared, ok := findPreparedDevice(preparedData, devices[i].Name); ok && prepared.Config.MTU != 0 && devices[i].MTU == 0 {
+			if mtu, err := k.host.linkMTU(prepared.hostInterface()); err == nil {
+				devices[i].MTU = mtu
+			}
+		}
+		if prepared, ok := findPreparedDevice(preparedData, devices[i].Name); ok && prepared.Config.HardwareTimestamping != nil && devices[i].HardwareTimestamping == nil {
+			if config, err := k.host.hardwareTimestamping(prepared.hostInterface()); err == nil {
+				devices[i].HardwareTimestamping = &config
+			}
+		}
+		if prepared, ok := findPreparedDevice(preparedData, devices[i].Name); ok && prepared.Config.Child == nil && devices[i].Ethtool == nil {
+			if ethtool := k.ethtoolConfig(prepared, pod); ethtool != nil {
+				if config, err := k.host.ethtoolSettings(prepared.hostInterface(), *ethtool); err == nil {
+					devices[i].Ethtool = &config
+				} else {
+					klog.Warningf("failed to record the ethtool settings of device %s, they will not be restored: %v", prepared.hostInterface(), err)
+				}
+			}
+		}
+	}
+	// the default rate of the QoS class is committed once the pod is known
+	for i := range preparedData {
+		preparedData[i].EgressRate = k.egressRate(preparedData[i], pod)
+	}
+	k.sharedState.PodNames[podUID] = types.NamespacedName{Namespace: pod.Namespace, Name: pod.Name}
+	if err := k.allocatePolicyTables(podUID); err != nil {
+		k.mu.Unlock()
+		return fmt.Errorf("pod %s/%s: %w", pod.Namespace, pod.Name, err)
+	}
+	if err := k.saveCheckpoint(); err != nil {
+		klog.Errorf("failed to save checkpoint: %v", err)
+	}
+	// a repeated run of the same sandbox does not move the devices again
+	var pending []AllocatedDevice
 	for _, device := range devices {
-		if err := k.configureDeviceForPod(device, networkNamespace, pod, preparedData); err != nil {
+		if prepared, _ := findPreparedDevice(preparedData, device.Name); prepared.State == DeviceStateAttached {
+			klog.V(2).Infof("Device %q is already attached to pod %s/%s", device.Name, pod.Namespace, pod.Name)
+			continue
+		}
+		pending = append(pending, device)
+	}
+	preparedData = slices.Clone(preparedData)
+	k.mu.Unlock()
+
+	// the devices are moved without the driver lock, the pod lock keeps
+	// the other operations on this pod out
+	for _, device := range pending {
+		preparedDevice, _ := findPreparedDevice(preparedData, device.Name)
+		bond := preparedDevice.Config.Bond
+		// the members of a bond are attached together with its first member
+		if bond != nil && device.Name != bond.Members[0] {
+			continue
+		}
+		release := k.netnsOps.acquire()
+		var err error
+		if bond != nil {
+			err = k.configureBondForPod(device.NetworkNamespace, pod, preparedData, *bond)
+		} else {
+			err = k.configureDeviceForPod(device, device.NetworkNamespace, pod, preparedDevice)
+		}
+		release()
+		if err != nil {
+			return err
+		}
+	}
+	if len(pending) > 0 {
+		k.mu.Lock()
+		k.setDeviceState(podUID, DeviceStateAttached)
+		k.updatePodStatusAnnotation(podUID)
+		k.mu.Unlock()
+	}
+	return k.notifyDeviceEvent(ctx, newDeviceEvent(DeviceEventAttach, k.nodeName, pod, networkNamespace, pending))
+}
+
+// StartContainer is called when a container is started by the Container Runtime.
+// Devices configured to be brought up with a container are set up here.
+func (k *NetworkDriver) StartContainer(ctx context.Context, pod *api.PodSandbox, ctr *api.Container) error {
+	klog.V(2).Infof("StartContainer called for container %s in pod %s/%s", ctr.Name, pod.Namespace, pod.Name)
+	podUID := types.UID(pod.Uid)
+
+	unlock := k.podLocks.lock(podUID)
+	defer unlock()
+	k.mu.Lock()
+	preparedData := slices.Clone(k.sharedState.PreparedData[podUID])
+	var pending []AllocatedDevice
+	for _, device := range k.sharedState.PodDeviceConfig[podUID] {
+		preparedDevice, ok := findPreparedDevice(preparedData, device.Name)
+		if !ok || preparedDevice.Config.BringUpContainer == "" || preparedDevice.Config.BringUpContainer != ctr.Name || preparedDevice.State != DeviceStateAttached {
+			continue
+		}
+		// a restart of the container does not configure the device again
+		if device.BroughtUp {
+			klog.V(2).Infof("Device %q of pod %s/%s is already up", device.Name, pod.Namespace, pod.Name)
+			continue
+		}
+		pending = append(pending, device)
+	}
+	k.mu.Unlock()
+
+	// the devices are brought up without the driver lock, the pod lock
+	// keeps the other operations on this pod out
+	for _, device := range pending {
+		preparedDevice, _ := findPreparedDevice(preparedData, device.Name)
+		podInterfaceName := preparedDevice.podInterface()
+		klog.Infof("Bringing up device %q in pod %s/%s on start of container %s",
+			podInterfaceName, pod.Namespace, pod.Name, ctr.Name)
+		release := k.netnsOps.acquire()
+		err := k.bringUpDevice(pod, device, device.NetworkNamespace, preparedDevice, true)
+		release()
+		if err != nil {
+			return fmt.Errorf("failed to bring up device %s for container %s: %w", podInterfaceName, ctr.Name, err)
+		}
+		k.mu.Lock()
+		for i := range k.sharedState.PodDeviceConfig[podUID] {
+			if k.sharedState.PodDeviceConfig[podUID][i].Name == device.Name {
+				k.sharedState.PodDeviceConfig[podUID][i].BroughtUp = true
+			}
+		}
+		if err := k.saveCheckpoint(); err != nil {
+			klog.Errorf("failed to save checkpoint: %v", err)
+		}
+		k.mu.Unlock()
+		if err := k.writeReadinessMarker(podUID, preparedDevice); err != nil {
 			return err
 		}
 	}
@@ -207,33 +872,229 @@ func (k *NetworkDriver) RunPodSandbox(ctx context.Context, pod *api.PodSandbox)
 func (k *NetworkDriver) StopPodSandbox(ctx context.Context, pod *api.PodSandbox) error {
 	klog.V(2).Infof("StopPodSandbox called for pod %s/%s", pod.Namespace, pod.Name)
 	podUID := types.UID(pod.Uid)
-	networkNamespace := getNetworkNamespace(pod)
+	networkNamespace := k.getNetworkNamespace(pod)
 
+	unlock := k.podLocks.lock(podUID)
+	defer unlock()
 	k.mu.Lock()
-	defer k.mu.Unlock()
-
-	devices := k.sharedState.PodDeviceConfig[podUID]
-	preparedData := k.sharedState.PreparedData[podUID]
 
+	devices := slices.Clone(k.sharedState.PodDeviceConfig[podUID])
+	preparedData := slices.Clone(k.sharedState.PreparedData[podUID])
+	// the devices were moved meanwhile to the namespace of a newer sandbox
+	// of the pod, they are restored when that one stops
 	for _, device := range devices {
-		if err := k.cleanupDeviceForPod(device, networkNamespace, pod, preparedData); err != nil {
+		if networkNamespace != "" && device.sandboxNamespace() != "" && device.sandboxNamespace() != networkNamespace {
+			k.mu.Unlock()
+			klog.Infof("Device %q of pod %s/%s is attached to network namespace %s of a newer sandbox, not restoring it",
+				device.Name, pod.Namespace, pod.Name, device.sandboxNamespace())
+			return nil
+		}
+	}
+	k.mu.Unlock()
+
+	var parents map[string]string
+	if networkNamespace != "" {
+		var err error
+		parents, err = kndnet.NsLinkParents(networkNamespace)
+		if err != nil {
+			klog.Infof("failed to get the interface dependencies of pod %s/%s: %v", pod.Namespace, pod.Name, err)
+		}
+	}
+
+	// the devices are moved without the driver lock, the pod lock keeps
+	// the other operations on this pod out
+	notDetached, cleanupErr := k.cleanupPodDevices(ctx, pod, networkNamespace, devices, preparedData, parents)
+	if len(devices) > 0 && notDetached.Len() == 0 {
+		// the interfaces are no longer in the pod
+		for _, device := range preparedData {
+			if device.NetworkData != nil {
+				k.reportNetworkData(ctx, podUID, device, nil)
+			}
+		}
+		k.mu.Lock()
+		k.setDeviceState(podUID, DeviceStateDetached)
+		k.updatePodStatusAnnotation(podUID)
+		if k.reserveDevices {
+			k.requestRepublish()
+		}
+		k.mu.Unlock()
+	}
+	// the pod is stopping regardless, a failed notification must not block it
+	if err := k.notifyDeviceEvent(ctx, newDeviceEvent(DeviceEventDetach, k.nodeName, pod, networkNamespace, devices)); err != nil {
+		klog.Errorf("failed to notify detach of pod %s/%s: %v", pod.Namespace, pod.Name, err)
+	}
+	return cleanupErr
+}
+
+// cleanupPodDevices returns all the devices of a pod to the host, a failure
+// of one device does not stop the cleanup of the others. It returns the names
+// of the devices that were not detached and the combined errors of the
+// devices that failed.
+func (k *NetworkDriver) cleanupPodDevices(ctx context.Context, pod *api.PodSandbox, networkNamespace string, devices []AllocatedDevice, preparedData []PreparedDevice, parents map[string]string) (sets.Set[string], error) {
+	notDetached := sets.New[string]()
+	var errs []error
+	bonds := sets.New[string]()
+	failedBonds := sets.New[string]()
+	for _, i := range cleanupOrder(devices, preparedData, parents) {
+		device := devices[i]
+		preparedDevice, _ := findPreparedDevice(preparedData, device.Name)
+		var err error
+		if bond := preparedDevice.Config.Bond; bond != nil {
+			// the members of a bond are detached together with the first one
+			if !bonds.Has(bond.name()) {
+				bonds.Insert(bond.name())
+				release := k.netnsOps.acquire()
+				err = k.cleanupBondForPod(device.podNamespace(networkNamespace), pod, devices, preparedData, *bond)
+				release()
+				if err != nil && !errors.Is(err, kndnet.ErrLinkDown) {
+					failedBonds.Insert(bond.name())
+				}
+			} else if failedBonds.Has(bond.name()) {
+				notDetached.Insert(device.Name)
+				continue
+			}
+		} else {
+			release := k.netnsOps.acquire()
+			err = k.cleanupDeviceForPod(device, device.podNamespace(networkNamespace), pod, preparedDevice)
+			release()
+		}
+		if errors.Is(err, kndnet.ErrLinkDown) {
+			// the device is back on the host, only its bring up failed
+			klog.Warningf("Device %s of pod %s/%s returned to the host down: %v", device.Name, pod.Namespace, pod.Name, err)
+			k.recordDeviceDown(pod, err)
+			errs = append(errs, fmt.Errorf("device %s: %w", device.Name, err))
+			if k.linkUpFailureMode == LinkUpFailureRetry {
+				notDetached.Insert(device.Name)
+			}
+			k.runTeardownHook(ctx, pod, networkNamespace, device)
+			continue
+		}
+		if err != nil {
 			klog.Errorf("failed to cleanup device %s for pod %s: %v", device.Name, pod.Name, err)
+			errs = append(errs, fmt.Errorf("device %s: %w", device.Name, err))
+			notDetached.Insert(device.Name)
+			continue
+		}
+		if err := k.verifyRestored(ctx, pod, device, preparedDevice); err != nil {
+			klog.Errorf("failed to verify device %s of pod %s: %v", device.Name, pod.Name, err)
+			errs = append(errs, fmt.Errorf("device %s: %w", device.Name, err))
+			notDetached.Insert(device.Name)
 		}
+		// the device left the pod, even if it did not reappear on the host
+		k.runTeardownHook(ctx, pod, networkNamespace, device)
 	}
-	return nil
+	if len(errs) > 0 {
+		return notDetached, fmt.Errorf("failed to cleanup %d of %d devices of pod %s/%s: %w",
+			len(errs), len(devices), pod.Namespace, pod.Name, errors.Join(errs...))
+	}
+	return notDetached, nil
 }
 
 // RemovePodSandbox is called when a pod is removed by the Container Runtime.
 func (k *NetworkDriver) RemovePodSandbox(ctx context.Context, pod *api.PodSandbox) error {
 	klog.V(2).Infof("RemovePodSandbox called for pod %s/%s", pod.Namespace, pod.Name)
 	podUID := types.UID(pod.Uid)
+	unlock := k.podLocks.lock(podUID)
+	defer unlock()
+	k.mu.Lock()
+	devices := slices.Clone(k.sharedState.PodDeviceConfig[podUID])
+	preparedData := slices.Clone(k.sharedState.PreparedData[podUID])
+	k.mu.Unlock()
+
+	k.sourceGroups.leavePod(podUID)
+	// pods evicted or killed abruptly can be removed without a clean
+	// StopPodSandbox, restore their devices before forgetting them. The
+	// devices are restored without the driver lock, the pod lock keeps the
+	// other operations on this pod out
+	for _, device := range devices {
+		preparedDevice, ok := findPreparedDevice(preparedData, device.Name)
+		// child interfaces are destroyed with the namespace and their parent stays on the host
+		if ok && (preparedDevice.State == DeviceStateDetached || preparedDevice.Config.Child != nil) {
+			continue
+		}
+		ifName := device.Name
+		if ok {
+			ifName = preparedDevice.hostInterface()
+		}
+		klog.Infof("Restoring device %q of pod %s/%s removed without being stopped", ifName, pod.Namespace, pod.Name)
+		release := k.netnsOps.acquire()
+		err := k.restoreDevice(device, ifName)
+		release()
+		if err != nil {
+			klog.Errorf("failed to restore device %s of pod %s/%s: %v", ifName, pod.Namespace, pod.Name, err)
+		}
+	}
+
+	if err := os.RemoveAll(k.podReadinessDir(podUID)); err != nil {
+		klog.Errorf("failed to remove the readiness markers of pod %s/%s: %v", pod.Namespace, pod.Name, err)
+	}
+	if pin, err := k.pinnedNamespacePath(pod.Id); err == nil {
+		if err := k.unpinNetworkNamespace(pin); err != nil {
+			klog.Errorf("pod %s/%s: %v", pod.Namespace, pod.Name, err)
+		}
+	}
 	k.mu.Lock()
 	defer k.mu.Unlock()
 	delete(k.sharedState.PodDeviceConfig, podUID)
 	delete(k.sharedState.PreparedData, podUID)
+	delete(k.sharedState.PodNames, podUID)
+	k.updateDeviceStateMetrics()
+	if err := k.saveCheckpoint(); err != nil {
+		klog.Errorf("failed to save checkpoint: %v", err)
+	}
 	return nil
 }
 
+// setDeviceState records a transition of the prepared device lifecycle.
+// The caller must hold k.mu.
+func (k *NetworkDriver) setDeviceState(uid types.UID, state DeviceState) {
+	preparedData, ok := k.sharedState.PreparedData[uid]
+	if !ok {
+		return
+	}
+	for i := range preparedData {
+		klog.V(4).Infof("Device %q transitioned from %s to %s", preparedData[i].DeviceName, preparedData[i].State, state)
+		preparedData[i].State = state
+	}
+	k.updateDeviceStateMetrics()
+	if err := k.saveCheckpoint(); err != nil {
+		klog.Errorf("failed to save checkpoint: %v", err)
+	}
+}
+
+// hostInterface returns the name of the host interface moved into the pod.
+func (d PreparedDevice) hostInterface() string {
+	if d.MacvlanParent != "" {
+		return d.MacvlanParent
+	}
+	if d.InterfaceName != "" {
+		return d.InterfaceName
+	}
+	return d.DeviceName
+}
+
+// podInterface returns the name of the interface of the device in the pod,
+// the configured one, the one of its VLAN or the host one.
+func (d PreparedDevice) podInterface() string {
+	if d.Config.InterfaceName != "" {
+		return d.Config.InterfaceName
+	}
+	if d.Config.VLAN != 0 {
+		return fmt.Sprintf("%s.%d", d.hostInterface(), d.Config.VLAN)
+	}
+	return d.hostInterface()
+}
+
+// findPreparedDevice returns the prepared data of the device with the given name.
+func findPreparedDevice(preparedData []PreparedDevice, name string) (PreparedDevice, bool) {
+	for _, device := range preparedData {
+		if device.DeviceName == name {
+			return device, true
+		}
+	}
+	return PreparedDevice{}, false
+}
+
 // Helper functions
 // runNRIPlugin starts the NRI plugin and keeps it running, it also
 // deals with the restart logic in case of failure.
@@ -241,8 +1102,14 @@ func (k *NetworkDriver) runNRIPlugin(ctx context.Context) {
 	attempt := 0
 	for attempt < maxAttempts {
 		startTime := time.Now()
-		if err := k.nriPlugin.Run(ctx); err != nil {
+		// the plugin is registered once started, until the connection closes
+		if err := k.nriPlugin.Start(ctx); err != nil {
 			klog.Errorf("NRI plugin failed: %v", err)
+		} else {
+			k.nriConnected.Store(true)
+			k.nriPlugin.Wait()
+			k.nriConnected.Store(false)
+			klog.Errorf("NRI plugin disconnected from the runtime")
 		}
 
 		// if the plugin was stable for a while, reset the backoff counter
@@ -259,43 +1126,196 @@ func (k *NetworkDriver) runNRIPlugin(ctx context.Context) {
 			klog.Infof("Restarting NRI plugin (attempt %d/%d)", attempt, maxAttempts)
 		}
 	}
-	klog.Fatalf("NRI plugin failed to restart after %d attempts", maxAttempts)
+	k.nriFailed.Store(true)
+	klog.Errorf("NRI plugin failed to restart after %d attempts", maxAttempts)
 }
 
 // publishResources publishes the available devices to the DRA plugin.
 func (k *NetworkDriver) publishResources(ctx context.Context) {
-	ticker := time.NewTicker(5 * time.Second)
+	if !k.waitBootSettle(ctx) {
+		return
+	}
+	// the republish requests and link changes received meanwhile are
+	// served by this one
+	select {
+	case <-k.republish:
+	default:
+	}
+	select {
+	case <-k.linkChanges:
+	default:
+	}
+	k.initialPublish(ctx)
+	ticker := time.NewTicker(k.publishInterval)
 	defer ticker.Stop()
+	// the devices are checked between the publications only if they are
+	// published less often, and less often if the link changes report them
+	checkInterval := deviceCheckInterval
+	if k.watchLinks {
+		checkInterval = linkWatchCheckInterval
+	}
+	var check <-chan time.Time
+	if k.publishInterval > checkInterval {
+		checkTicker := time.NewTicker(checkInterval)
+		defer checkTicker.Stop()
+		check = checkTicker.C
+	}
 	for {
 		select {
 		case <-ctx.Done():
 			return
 		case <-ticker.C:
-			devices, err := k.getDevices()
-			if err != nil {
-				klog.Errorf("failed to get devices: %v", err)
-				continue
-			}
-			resources := resourceslice.DriverResources{
-				Pools: map[string]resourceslice.Pool{
-					k.nodeName: {Slices: []resourceslice.Slice{{Devices: devices}}},
-				},
+			k.publishOnce(ctx)
+		case <-check:
+			if k.devicesChanged() {
+				k.publishOnce(ctx)
 			}
-			if err := k.draPlugin.PublishResources(ctx, resources); err != nil {
-				klog.Errorf("failed to publish resources: %v", err)
+		case <-k.linkChanges:
+			if k.devicesChanged() {
+				k.publishOnce(ctx)
 			}
+		case <-k.republish:
+			k.publishOnce(ctx)
 		}
 	}
 }
 
-// getNetworkNamespace returns the network namespace path for a pod from the NRI PodSandbox.
-func getNetworkNamespace(pod *api.PodSandbox) string {
+// devicesHash returns the content hash of the devices, they are discovered
+// in a stable order and their attributes are encoded sorted.
+func devicesHash(devices []resourceapi.Device) string {
+	data, err := json.Marshal(devices)
+	if err != nil {
+		// never for the devices, publish them
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// devicesChanged discovers the devices and returns true if they differ from
+// the last published ones.
+func (k *NetworkDriver) devicesChanged() bool {
+	devices, err := k.getDevices()
+	if err != nil {
+		klog.V(2).Infof("failed to check the devices: %v", err)
+		return false
+	}
+	hash := devicesHash(devices)
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if hash == k.lastDevicesHash {
+		return false
+	}
+	klog.V(2).Infof("Devices changed since the last publication, publishing them")
+	return true
+}
+
+// recordPublishError records the last failure of the publication for the
+// node report.
+func (k *NetworkDriver) recordPublishError(err error) {
+	now := time.Now()
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.publishStatus.LastError = err.Error()
+	k.publishStatus.LastErrorTime = &now
+}
+
+// skipPublish returns true if the devices with the content hash were already
+// published, less than the max interval ago. They are published again after
+// it even if unchanged, to recover from the updates lost on the way to the
+// ResourceSlice.
+func (k *NetworkDriver) skipPublish(hash string, now time.Time) bool {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.forcePublishAfter <= 0 || !k.published.Load() || hash == "" || hash != k.lastDevicesHash {
+		return false
+	}
+	last := k.publishStatus.LastPublished
+	return last != nil && now.Sub(*last) < k.forcePublishAfter
+}
+
+// deviceSlices splits the devices in the slices of the pool, a ResourceSlice
+// holds at most ResourceSliceMaxDevices devices, e.g. with the macvlan slots.
+// Without devices the pool has a single empty slice.
+func deviceSlices(devices []resourceapi.Device) []resourceslice.Slice {
+	if len(devices) == 0 {
+		return []resourceslice.Slice{{}}
+	}
+	var result []resourceslice.Slice
+	for chunk := range slices.Chunk(devices, resourceapi.ResourceSliceMaxDevices) {
+		result = append(result, resourceslice.Slice{Devices: chunk})
+	}
+	return result
+}
+
+// publishOnce discovers the devices and publishes them, unless they did not
+// change since the last publication.
+func (k *NetworkDriver) publishOnce(ctx context.Context) error {
+	devices, err := k.getDevices()
+	if err != nil {
+		klog.Errorf("failed to get devices: %v", err)
+		k.recordPublishError(err)
+		return err
+	}
+	hash := devicesHash(devices)
+	if k.skipPublish(hash, time.Now()) {
+		resourcePublishSkipped.Inc()
+		return nil
+	}
+	resources := resourceslice.DriverResources{
+		Pools: map[string]resourceslice.Pool{
+			k.nodeName: {Slices: deviceSlices(devices)},
+		},
+	}
+	if err := k.publisher.PublishResources(ctx, resources); err != nil {
+		klog.Errorf("failed to publish resources: %v", err)
+		resourcePublishTotal.WithLabelValues(publishErrorReason(err)).Inc()
+		k.recordPublishError(err)
+		return err
+	}
+	now := time.Now()
+	k.mu.Lock()
+	// the ResourceSlice controller does not write to the apiserver if
+	// the devices did not change, account it as a no-op
+	if k.published.Load() && hash != "" && hash == k.lastDevicesHash {
+		resourcePublishTotal.WithLabelValues(publishReasonUnchanged).Inc()
+	} else {
+		resourcePublishTotal.WithLabelValues(publishReasonPublished).Inc()
+	}
+	k.lastDevices = devices
+	k.lastDevicesHash = hash
+	k.publishStatus.LastPublished = &now
+	k.mu.Unlock()
+	publishedDevices.WithLabelValues(k.nodeName).Set(float64(len(devices)))
+	k.published.Store(true)
+	return nil
+}
+
+// getNetworkNamespace returns the network namespace path for a pod from the NRI PodSandbox,
+// or from its init process if the runtime does not report it.
+func (k *NetworkDriver) getNetworkNamespace(pod *api.PodSandbox) string {
 	for _, ns := range pod.Linux.GetNamespaces() {
 		if ns.Type == "network" {
 			return ns.Path
 		}
 	}
-	return ""
+	// some runtimes do not report the namespaces of the sandbox, the one of
+	// its init process is pinned the first time so the later hooks and the
+	// checkpoint do not depend on its pid
+	if pin, err := k.pinnedNamespacePath(pod.Id); err == nil && k.host.isNetworkNamespace(pin) == nil {
+		return pin
+	}
+	path, err := k.getNetworkNamespaceFallback(pod)
+	if err != nil {
+		klog.V(4).Infof("Pod %s/%s has no network namespace: %v", pod.Namespace, pod.Name, err)
+		return ""
+	}
+	pin, err := k.pinNetworkNamespace(pod.Id, path)
+	if err != nil {
+		klog.Errorf("Pod %s/%s: %v", pod.Namespace, pod.Name, err)
+		return ""
+	}
+	return pin
 }
 
 // getDevices discovers all physical network interfaces on the host.
@@ -305,7 +1325,17 @@ func (k *NetworkDriver) getDevices() ([]resourceapi.Device, error) {
 		return nil, fmt.Errorf("failed to list network interfaces: %w", err)
 	}
 
+	skipped, err := k.skippedDefaultRouteInterfaces(links)
+	if err != nil {
+		return nil, err
+	}
+
+	k.mu.Lock()
+	reserved := k.reservedDevices()
+	k.mu.Unlock()
+
 	var devices []resourceapi.Device
+	groups := map[string]string{}
 	for _, link := range links {
 		attrs := link.Attrs()
 
@@ -313,35 +1343,226 @@ func (k *NetworkDriver) getDevices() ([]resourceapi.Device, error) {
 		if attrs.Flags&net.FlagLoopback != 0 || attrs.Flags&net.FlagUp == 0 {
 			continue
 		}
-		if strings.HasPrefix(attrs.Name, "veth") || strings.HasPrefix(attrs.Name, "docker") || strings.HasPrefix(attrs.Name, "cni") {
+		if slices.ContainsFunc(ignoredInterfacePrefixes, func(prefix string) bool { return strings.HasPrefix(attrs.Name, prefix) }) {
 			continue
 		}
-
-		device := resourceapi.Device{
-			Name: attrs.Name,
-			Attributes: map[resourceapi.QualifiedName]resourceapi.DeviceAttribute{
-				"interface-name": {StringValue: &attrs.Name},
-				"mac-address":    {StringValue: func() *string { s := attrs.HardwareAddr.String(); return &s }()},
+		if skipped.Has(attrs.Name) {
+			klog.V(4).Infof("Skipping device with the default route: %s", attrs.Name)
+			continue
+		}
+		if !k.interfaceFilter.matches(attrs.Name) {
+			klog.V(4).Infof("Skipping device filtered by the interface patterns: %s", attrs.Name)
+			continue
+		}
+		if !k.isAllowed(attrs.Name) {
+			klog.V(2).Infof("Skipping device not in the allowlist: %s", attrs.Name)
+			continue
+		}
+		if k.isBlocked(attrs.Name, attrs.HardwareAddr.String()) {
+			klog.V(2).Infof("Skipping blocklisted device: %s", attrs.Name)
+			continue
+		}
+		if k.isReservedInterface(attrs.Name) {
+			klog.V(2).Infof("Skipping device in the reserved interfaces file: %s", attrs.Name)
+			continue
+		}
+		if reserved.Has(attrs.Name) {
+			klog.V(2).Infof("Skipping reserved device: %s", attrs.Name)
+			continue
+		}
+
+		device := resourceapi.Device{
+			Name: attrs.Name,
+			Attributes: map[resourceapi.QualifiedName]resourceapi.DeviceAttribute{
+				"interface-name": {StringValue: &attrs.Name},
+				"mac-address":    {StringValue: func() *string { s := attrs.HardwareAddr.String(); return &s }()},
 			},
 		}
+		k.addSriovAttributes(&device, attrs.Name)
+		addAddressAttributes(&device, link)
+		addIPVlanAttribute(&device, link)
+		k.addTimestampingAttributes(&device, attrs.Name)
+		k.addPCIAttributes(&device, attrs.Name)
+		k.addRDMAAttribute(&device, attrs.Name)
+		k.addGroupAttribute(&device)
+		k.addMTUAttributes(&device, attrs.Name)
+		k.addLinkAttributes(&device, attrs.Name)
+		normalizeAttributes(&device)
 		devices = append(devices, device)
+		groups[attrs.Name] = deviceGroup(attrs.Name)
 		klog.V(2).Infof("Discovered device: %s", attrs.Name)
+		for _, slot := range k.macvlanSlotDevices(link) {
+			if reserved.Has(slot.Name) {
+				klog.V(2).Infof("Skipping reserved device: %s", slot.Name)
+				continue
+			}
+			devices = append(devices, slot)
+			groups[slot.Name] = groups[attrs.Name]
+		}
 	}
-	return devices, nil
+	return orderDevices(devices, groups, k.allocationPolicy), nil
 }
 
-// prepareDevice extracts the target interface name from the claim.
-func (k *NetworkDriver) prepareDevice(ctx context.Context, claim *resourceapi.ResourceClaim) (interface{}, error) {
+// prepareDevice extracts the target interface names and their configuration from the claim.
+// If some of the devices fail the claim fails or is prepared with the remaining devices
+// depending on the failure mode.
+func (k *NetworkDriver) prepareDevice(ctx context.Context, claim *resourceapi.ResourceClaim) ([]PreparedDevice, error) {
 	if claim.Status.Allocation == nil || len(claim.Status.Allocation.Devices.Results) == 0 {
 		return nil, fmt.Errorf("claim %s has no allocated devices", claim.Name)
 	}
 
-	// For this simple driver, we just need the name of the device to move.
-	// The device name is the primary information we need for ConfigureDeviceForPod.
-	deviceName := claim.Status.Allocation.Devices.Results[0].Device
-	klog.Infof("Preparing device %q for claim %s", deviceName, claim.Name)
+	var prepared []PreparedDevice
+	var misaligned []numaPlacement
+	var errs []error
+	for _, result := range claim.Status.Allocation.Devices.Results {
+		if result.Driver != k.driverName {
+			continue
+		}
+		// For this simple driver, we just need the name of the device to move.
+		// The device name is the primary information we need for ConfigureDeviceForPod.
+		deviceName := result.Device
+		klog.Infof("Preparing device %q for claim %s", deviceName, claim.Name)
+		k.mu.Lock()
+		parent, isSlot := k.macvlanSlotParent(deviceName)
+		attributes := k.publishedAttributes(deviceName)
+		k.mu.Unlock()
+		// the macvlan slots are allowed with their host interface
+		if !k.isAllowed(deviceName) && !(isSlot && k.isAllowed(parent)) {
+			klog.Warningf("Refusing to prepare device %q for claim %s, it is not in the device allowlist", deviceName, claim.Name)
+			errs = append(errs, fmt.Errorf("device %s is not in the device allowlist", deviceName))
+			continue
+		}
 
-	return deviceName, nil
+		config, err := parseDeviceConfig(k.driverName, claim, result.Request)
+		if err != nil {
+			klog.Warningf("Failed to prepare device %q for claim %s: %v", deviceName, claim.Name, err)
+			errs = append(errs, fmt.Errorf("device %s: %w", deviceName, err))
+			continue
+		}
+		preparedDevice := PreparedDevice{
+			Claim:      types.NamespacedName{Namespace: claim.Namespace, Name: claim.Name},
+			DeviceName: deviceName,
+			PoolName:   result.Pool,
+			Group:      k.deviceGroupOf(deviceName),
+			Request:    result.Request,
+			Config:     config,
+			Consumers:  claimConsumers(claim),
+			Attributes: attributes,
+			State:      DeviceStatePrepared,
+		}
+		// validated with the configuration
+		preparedDevice.Addresses, _ = parseIPs(config.IPs)
+		if isSlot {
+			if err := prepareMacvlanSlot(&preparedDevice, parent); err != nil {
+				klog.Warningf("Failed to prepare device %q for claim %s: %v", deviceName, claim.Name, err)
+				errs = append(errs, err)
+				continue
+			}
+		}
+		k.mu.Lock()
+		err = k.checkMacvlanSlots(preparedDevice)
+		k.mu.Unlock()
+		if err != nil {
+			klog.Warningf("Failed to prepare device %q for claim %s: %v", deviceName, claim.Name, err)
+			errs = append(errs, err)
+			continue
+		}
+		if config.SriovVF {
+			vf, err := k.allocateSriovVF(ctx, deviceName)
+			if err != nil {
+				klog.Warningf("Failed to prepare device %q for claim %s: %v", deviceName, claim.Name, err)
+				errs = append(errs, fmt.Errorf("device %s: %w", deviceName, err))
+				continue
+			}
+			klog.Infof("Allocated virtual function %q of device %q for claim %s", vf, deviceName, claim.Name)
+			preparedDevice.InterfaceName = vf
+		}
+		if config.MTU != 0 {
+			if err := k.checkMTU(preparedDevice.hostInterface(), config.MTU); err != nil {
+				klog.Warningf("Failed to prepare device %q for claim %s: %v", deviceName, claim.Name, err)
+				errs = append(errs, fmt.Errorf("device %s: %w", deviceName, err))
+				k.mu.Lock()
+				k.releaseSriovVFs([]PreparedDevice{preparedDevice})
+				k.mu.Unlock()
+				continue
+			}
+		}
+		if err := checkSysctls(preparedDevice); err != nil {
+			klog.Warningf("Failed to prepare device %q for claim %s: %v", deviceName, claim.Name, err)
+			errs = append(errs, err)
+			k.mu.Lock()
+			k.releaseSriovVFs([]PreparedDevice{preparedDevice})
+			k.mu.Unlock()
+			continue
+		}
+		if config.NUMA != nil {
+			node, err := k.checkNUMA(preparedDevice.hostInterface(), *config.NUMA)
+			if err != nil {
+				klog.Warningf("Failed to prepare device %q for claim %s: %v", deviceName, claim.Name, err)
+				errs = append(errs, fmt.Errorf("device %s: %w", deviceName, err))
+				k.mu.Lock()
+				k.releaseSriovVFs([]PreparedDevice{preparedDevice})
+				k.mu.Unlock()
+				continue
+			}
+			if node != config.NUMA.Node {
+				misaligned = append(misaligned, numaPlacement{device: deviceName, request: result.Request, node: node, want: config.NUMA.Node})
+			}
+		}
+		prepared = append(prepared, preparedDevice)
+	}
+
+	if len(errs) > 0 {
+		if k.failureMode != PrepareBestEffort || len(prepared) == 0 {
+			k.mu.Lock()
+			k.releaseSriovVFs(prepared)
+			k.mu.Unlock()
+			k.recordDevicePrepareFailed(claim, errs, "the claim is not prepared")
+			return nil, fmt.Errorf("failed to prepare %d of %d devices for claim %s: %w",
+				len(errs), len(errs)+len(prepared), claim.Name, errors.Join(errs...))
+		}
+		klog.Warningf("Claim %s prepared with %d of %d devices: %v",
+			claim.Name, len(prepared), len(errs)+len(prepared), errors.Join(errs...))
+		k.recordDevicePrepareFailed(claim, errs, fmt.Sprintf("the claim is prepared with %d of %d devices", len(prepared), len(errs)+len(prepared)))
+	}
+	if len(prepared) == 0 {
+		return nil, fmt.Errorf("claim %s has no devices allocated by driver %s", claim.Name, k.driverName)
+	}
+	if err := checkInterfaceNames(prepared); err != nil {
+		k.mu.Lock()
+		k.releaseSriovVFs(prepared)
+		k.mu.Unlock()
+		return nil, fmt.Errorf("failed to prepare claim %s: %w", claim.Name, err)
+	}
+	if err := checkBonds(prepared); err != nil {
+		k.mu.Lock()
+		k.releaseSriovVFs(prepared)
+		k.mu.Unlock()
+		return nil, fmt.Errorf("failed to prepare claim %s: %w", claim.Name, err)
+	}
+	mtu, err := k.clampMTUs(prepared)
+	if err != nil {
+		k.mu.Lock()
+		k.releaseSriovVFs(prepared)
+		k.mu.Unlock()
+		return nil, fmt.Errorf("failed to prepare claim %s: %w", claim.Name, err)
+	}
+	if mtu != 0 {
+		k.recordMTUClamped(claim, prepared, mtu)
+	}
+	k.recordNUMAMisaligned(claim, misaligned)
+	return prepared, nil
+}
+
+// recordDevicePrepareFailed emits a warning event on the claim for each of
+// its devices that failed to prepare, with the outcome of the claim.
+func (k *NetworkDriver) recordDevicePrepareFailed(claim *resourceapi.ResourceClaim, errs []error, outcome string) {
+	if k.eventRecorder == nil {
+		return
+	}
+	for _, err := range errs {
+		k.eventRecorder.Eventf(claim, v1.EventTypeWarning, devicePrepareFailedReason, "Node %s: %v, %s", k.nodeName, err, outcome)
+	}
 }
 
 // unprepareDevice is a no-op for this simple driver.
@@ -351,37 +1572,368 @@ func (k *NetworkDriver) unprepareDevice(ctx context.Context, claim kubeletplugin
 }
 
 // configureDeviceForPod moves the allocated network device into the pod's namespace.
-func (k *NetworkDriver) configureDeviceForPod(device AllocatedDevice, networkNamespace string, podSandbox *api.PodSandbox, preparedData interface{}) error {
-	hostDeviceName, ok := preparedData.(string)
-	if !ok {
-		return fmt.Errorf("invalid prepared data type: expected string, got %T", preparedData)
+func (k *NetworkDriver) configureDeviceForPod(device AllocatedDevice, networkNamespace string, podSandbox *api.PodSandbox, preparedData PreparedDevice) (err error) {
+	start := time.Now()
+	defer func() {
+		k.observeAttach(preparedData, start, err)
+		k.recordAttach(podSandbox, preparedData, err)
+	}()
+	hostDeviceName := preparedData.hostInterface()
+	if hostDeviceName == "" {
+		return fmt.Errorf("no prepared data for device %s", device.Name)
+	}
+	if preparedData.Config.Mode == AttachModeBridge {
+		return k.configureBridgeForPod(device, networkNamespace, podSandbox, preparedData)
 	}
 
 	// The device name inside the pod will be the same as on the host.
-	podInterfaceName := hostDeviceName
+	podInterfaceName := preparedData.podInterface()
 
-	klog.Infof("Moving device %q to pod %s/%s network namespace %s as %q",
-		hostDeviceName, podSandbox.Namespace, podSandbox.Name, networkNamespace, podInterfaceName)
+	opts := []kndnet.AttachOption{
+		kndnet.WithLinkUpRetries(k.linkUpRetries),
+		kndnet.WithNamespaceRetries(k.namespaceRetries),
+		kndnet.WithOwner(k.driverName),
+		kndnet.WithDADTimeout(k.dadTimeout),
+	}
+	linkDown := false
+	if preparedData.Config.BringUpContainer != "" {
+		// the interface is brought up by StartContainer
+		klog.Infof("Device %q will be brought up when container %s starts", podInterfaceName, preparedData.Config.BringUpContainer)
+		linkDown = true
+	} else if preparedData.Config.Network != nil || preparedData.Config.IPv6Privacy != nil || preparedData.Config.ARP != nil || preparedData.Config.HopLimit != 0 || k.ethtoolConfig(preparedData, podSandbox) != nil {
+		// the addresses, the IP and the ethtool settings are configured
+		// before the interface is brought up
+		linkDown = true
+	}
+	if linkDown {
+		opts = append(opts, kndnet.WithLinkDown())
+	}
 
-	// Here we use the plumbing library to do the actual work.
-	_, err := kndnet.NsAttachNetdev(hostDeviceName, networkNamespace, netlink.LinkAttrs{Name: podInterfaceName}, nil)
-	return err
+	identity := DeviceIdentity{KernelName: hostDeviceName, PodInterfaceName: podInterfaceName}
+	var networkData *resourceapi.NetworkDeviceData
+	if child := preparedData.Config.Child; child != nil {
+		uplink, err := selectUplink(hostDeviceName, *child, kndnet.CanHostChild)
+		if err != nil {
+			return err
+		}
+		identity.KernelName = uplink
+		identity.StableID = k.host.stableDeviceID(uplink)
+		klog.Infof("Creating %s %q on device %q in pod %s/%s network namespace %s",
+			child.Type, podInterfaceName, uplink, podSandbox.Namespace, podSandbox.Name, networkNamespace)
+		attrs := netlink.LinkAttrs{Name: podInterfaceName, Alias: kndnet.ChildAlias(podSandbox.Uid)}
+		if len(preparedData.Addresses) > 0 {
+			klog.Infof("Setting addresses %v on device %q", preparedData.Addresses, podInterfaceName)
+		}
+		switch child.Type {
+		case "vlan":
+			err = kndnet.NsAttachVlan(uplink, preparedData.Config.VLAN, networkNamespace, attrs, preparedData.Addresses)
+		case "ipvlan":
+			err = kndnet.NsAttachIpvlan(uplink, networkNamespace, preparedData.Config.IPVlanMode.netlinkMode(), attrs, preparedData.Addresses)
+		default:
+			err = kndnet.NsAttachMacvlan(uplink, networkNamespace, attrs, preparedData.Addresses)
+		}
+		if err != nil {
+			return err
+		}
+		networkData = k.childNetworkData(networkNamespace, podInterfaceName, preparedData.Addresses)
+	} else {
+		klog.Infof("Moving device %q to pod %s/%s network namespace %s as %q",
+			hostDeviceName, podSandbox.Namespace, podSandbox.Name, networkNamespace, podInterfaceName)
+		attrs := netlink.LinkAttrs{Name: podInterfaceName}
+		if preparedData.Config.PermanentMAC {
+			mac, err := kndnet.PermanentHardwareAddr(hostDeviceName)
+			if err != nil {
+				return err
+			}
+			klog.Infof("Setting the permanent address %s on device %q", mac, hostDeviceName)
+			attrs.HardwareAddr = mac
+		}
+		if preparedData.Config.MTU != 0 {
+			klog.Infof("Setting mtu %d on device %q", preparedData.Config.MTU, hostDeviceName)
+			attrs.MTU = preparedData.Config.MTU
+		}
+		if timestamping := preparedData.Config.HardwareTimestamping; timestamping != nil {
+			if err := k.checkTimestamping(hostDeviceName, *timestamping); err != nil {
+				return err
+			}
+		}
+		// the interface is not in the host namespace once moved
+		identity.StableID = k.host.stableDeviceID(hostDeviceName)
+		// Here we use the plumbing library to do the actual work.
+		if len(preparedData.Addresses) > 0 {
+			klog.Infof("Setting addresses %v on device %q", preparedData.Addresses, podInterfaceName)
+		}
+		data, err := k.host.attachNetdev(hostDeviceName, networkNamespace, attrs, preparedData.Addresses, opts...)
+		if err != nil {
+			return err
+		}
+		networkData = data
+	}
+
+	if timestamping := preparedData.Config.HardwareTimestamping; timestamping != nil {
+		klog.Infof("Setting hardware timestamping %s/%s on device %q", timestamping.TxType, timestamping.RxFilter, podInterfaceName)
+		if err := k.host.nsSetHardwareTimestamping(networkNamespace, podInterfaceName, *timestamping); err != nil {
+			return err
+		}
+	}
+
+	if ethtool := k.ethtoolConfig(preparedData, podSandbox); ethtool != nil {
+		unchanged, err := kndnet.NsSetEthtool(networkNamespace, podInterfaceName, *ethtool)
+		if err != nil {
+			return err
+		}
+		if len(unchanged) > 0 {
+			klog.Warningf("Features %v of device %q in pod %s/%s could not be changed, they may be fixed on the device",
+				unchanged, podInterfaceName, podSandbox.Namespace, podSandbox.Name)
+		}
+	}
+
+	if arp := preparedData.Config.ARP; arp != nil {
+		if err := kndnet.NsSetIPv4Conf(networkNamespace, podInterfaceName, arp.sysctls()); err != nil {
+			return err
+		}
+	}
+
+	if hopLimit := preparedData.Config.HopLimit; hopLimit != 0 {
+		if err := kndnet.NsSetIPv6Conf(networkNamespace, podInterfaceName, hopLimitSysctls(hopLimit)); err != nil {
+			return err
+		}
+	}
+
+	if privacy := preparedData.Config.IPv6Privacy; privacy != nil {
+		if err := kndnet.NsSetIPv6Conf(networkNamespace, podInterfaceName, privacy.sysctls()); err != nil {
+			return err
+		}
+		// temporary addresses are generated once a router advertisement arrives
+		go k.reportTemporaryAddresses(context.Background(), preparedData, networkNamespace, podInterfaceName)
+	}
+
+	// routes need the interface up, if the bring up is deferred they are added by StartContainer
+	if preparedData.Config.BringUpContainer == "" {
+		// child interfaces are created down
+		if err := k.bringUpDevice(podSandbox, device, networkNamespace, preparedData, linkDown || preparedData.Config.Child != nil); err != nil {
+			return err
+		}
+	}
+
+	if rate := k.egressRate(preparedData, podSandbox); rate != nil {
+		klog.Infof("Limiting egress rate of device %q in %s pod %s/%s to %s bps",
+			podInterfaceName, podQOSClass(podSandbox), podSandbox.Namespace, podSandbox.Name, rate.String())
+		if err := kndnet.NsSetEgressRateLimit(networkNamespace, podInterfaceName, uint64(rate.Value())); err != nil {
+			return err
+		}
+	}
+	if preparedData.Config.BringUpContainer == "" {
+		if err := k.writeReadinessMarker(types.UID(podSandbox.Uid), preparedData); err != nil {
+			return err
+		}
+	}
+	// the counters of a moved device are not reset, the next sample is the baseline
+	k.deviceErrors.reset(types.UID(podSandbox.Uid), device.Name)
+	if networkData != nil {
+		k.reportNetworkData(context.Background(), types.UID(podSandbox.Uid), preparedData, networkData)
+	}
+	k.reportDeviceIdentity(context.Background(), preparedData, identity)
+	return nil
+}
+
+// bringUpDevice brings up the interface of the device in the pod, setting it
+// up if setUp unless the network configuration does, and configures what
+// needs it up: the routes, the sysctls, the policy routing and the multicast
+// routes and groups. The carrier of the interface is watched afterwards.
+func (k *NetworkDriver) bringUpDevice(podSandbox *api.PodSandbox, device AllocatedDevice, networkNamespace string, preparedData PreparedDevice, setUp bool) error {
+	podInterfaceName := preparedData.podInterface()
+	if err := k.preserveDNSRoutes(networkNamespace, podInterfaceName, preparedData.Config); err != nil {
+		return err
+	}
+	if preparedData.Config.Network != nil {
+		if err := kndnet.NsApplyNetworkConfig(networkNamespace, podInterfaceName, *preparedData.Config.Network); err != nil {
+			return err
+		}
+		if err := kndnet.NsWaitDAD(networkNamespace, podInterfaceName, k.dadTimeout); err != nil {
+			return err
+		}
+	} else {
+		if setUp {
+			if err := kndnet.NsSetLinkUp(networkNamespace, podInterfaceName); err != nil {
+				return err
+			}
+			if err := kndnet.NsWaitDAD(networkNamespace, podInterfaceName, k.dadTimeout); err != nil {
+				return err
+			}
+		}
+		if err := kndnet.NsAddRoutes(networkNamespace, podInterfaceName, preparedData.Config.Routes); err != nil {
+			return err
+		}
+	}
+	if sysctls := preparedData.Config.Sysctls; len(sysctls) > 0 {
+		if err := kndnet.NsSetSysctls(networkNamespace, sysctls); err != nil {
+			return err
+		}
+	}
+	if preparedData.PolicyTable != 0 {
+		if err := k.applyPolicyRouting(networkNamespace, podInterfaceName, preparedData); err != nil {
+			return err
+		}
+	}
+	if multicast := preparedData.Config.Multicast; multicast != nil {
+		if err := kndnet.NsAddMulticastRoutes(networkNamespace, podInterfaceName, *multicast); err != nil {
+			return err
+		}
+	}
+	if ssm := preparedData.Config.SSM; ssm != nil {
+		if err := k.joinSourceGroups(types.UID(podSandbox.Uid), device.Name, networkNamespace, podInterfaceName, *ssm); err != nil {
+			return err
+		}
+	}
+	go k.watchCarrier(context.Background(), podSandbox, preparedData, networkNamespace, podInterfaceName, carrierTimeout)
+	return nil
+}
+
+// childNetworkData returns the network data of a child interface created
+// with addresses, nil without them as it has no static configuration.
+func (k *NetworkDriver) childNetworkData(networkNamespace string, ifName string, addresses []*net.IPNet) *resourceapi.NetworkDeviceData {
+	if len(addresses) == 0 {
+		return nil
+	}
+	networkData := &resourceapi.NetworkDeviceData{InterfaceName: ifName}
+	if info, err := k.host.nsLinkInfo(networkNamespace, ifName); err == nil {
+		networkData.HardwareAddress = info.HardwareAddr
+	}
+	for _, address := range addresses {
+		networkData.IPs = append(networkData.IPs, address.String())
+	}
+	return networkData
 }
 
 // cleanupDeviceForPod moves the network device back to the host namespace.
-func (k *NetworkDriver) cleanupDeviceForPod(device AllocatedDevice, networkNamespace string, podSandbox *api.PodSandbox, preparedData interface{}) error {
-	hostDeviceName, ok := preparedData.(string)
-	if !ok {
-		return fmt.Errorf("invalid prepared data type: expected string, got %T", preparedData)
+func (k *NetworkDriver) cleanupDeviceForPod(device AllocatedDevice, networkNamespace string, podSandbox *api.PodSandbox, preparedData PreparedDevice) (err error) {
+	start := time.Now()
+	defer func() { k.observeDetach(preparedData, start, err) }()
+	hostDeviceName := preparedData.hostInterface()
+	if hostDeviceName == "" {
+		return fmt.Errorf("no prepared data for device %s", device.Name)
 	}
 
-	podInterfaceName := hostDeviceName
+	podInterfaceName := preparedData.podInterface()
 
 	klog.Infof("Moving device %q from pod %s/%s back to host namespace",
 		podInterfaceName, podSandbox.Namespace, podSandbox.Name)
 
+	// the applications must not use the interface from now on
+	k.removeReadinessMarker(types.UID(podSandbox.Uid), preparedData)
+
+	// the sockets of the memberships must not outlive the device in the pod
+	if preparedData.Config.SSM != nil {
+		k.sourceGroups.leave(types.UID(podSandbox.Uid), device.Name)
+	}
+
+	// stop the traffic before anything else is removed from the device
+	if preparedData.Config.Drain != nil {
+		k.drainDevice(networkNamespace, podInterfaceName, *preparedData.Config.Drain)
+	}
+
+	// the qdisc moves with the device, do not leave the rate limit on the host
+	if k.egressRate(preparedData, podSandbox) != nil {
+		if err := kndnet.NsDeleteEgressRateLimit(networkNamespace, podInterfaceName); err != nil {
+			klog.Errorf("failed to remove rate limit from device %s: %v", podInterfaceName, err)
+		}
+	}
+
+	if preparedData.Config.IPv6Privacy != nil {
+		if err := kndnet.NsResetIPv6Conf(networkNamespace, podInterfaceName, ipv6PrivacySysctls); err != nil {
+			klog.Errorf("failed to restore the IPv6 settings of device %s: %v", podInterfaceName, err)
+		}
+	}
+
+	if preparedData.Config.HopLimit != 0 {
+		if err := kndnet.NsResetIPv6Conf(networkNamespace, podInterfaceName, []string{hopLimitSysctl}); err != nil {
+			klog.Errorf("failed to restore the hop limit of device %s: %v", podInterfaceName, err)
+		}
+	}
+
+	if sysctls := preparedData.Config.Sysctls; len(sysctls) > 0 {
+		if err := kndnet.NsResetSysctls(networkNamespace, sysctlNames(sysctls)); err != nil {
+			klog.Errorf("failed to restore the sysctls of device %s: %v", podInterfaceName, err)
+		}
+	}
+
+	if multicast := preparedData.Config.Multicast; multicast != nil {
+		if err := kndnet.NsDeleteMulticastRoutes(networkNamespace, podInterfaceName, *multicast); err != nil {
+			klog.Errorf("failed to remove multicast routes from device %s: %v", podInterfaceName, err)
+		}
+	}
+
+	if preparedData.Config.ARP != nil {
+		if err := kndnet.NsResetIPv4Conf(networkNamespace, podInterfaceName, arpSysctls); err != nil {
+			klog.Errorf("failed to restore the ARP settings of device %s: %v", podInterfaceName, err)
+		}
+	}
+
+	// rules are not bound to the device, remove the configuration in
+	// reverse so nothing is left pointing to it
+	if preparedData.PolicyTable != 0 {
+		if err := k.host.removePolicyRouting(networkNamespace, preparedData.PolicyTable); err != nil {
+			klog.Errorf("failed to remove policy routing from device %s: %v", podInterfaceName, err)
+		}
+	}
+	if preparedData.Config.Network != nil {
+		if err := kndnet.NsRemoveNetworkConfig(networkNamespace, podInterfaceName, *preparedData.Config.Network); err != nil {
+			klog.Errorf("failed to remove network configuration from device %s: %v", podInterfaceName, err)
+		}
+	}
+
+	if preparedData.Config.Mode == AttachModeBridge {
+		return k.cleanupBridgeForPod(device, networkNamespace, podSandbox, preparedData)
+	}
+
+	// the parent never left the host, only the child has to be removed
+	if preparedData.Config.Child != nil {
+		err := kndnet.NsDeleteChildNetdev(networkNamespace, podInterfaceName)
+		if errors.Is(err, kndnet.ErrNamespaceGone) {
+			klog.Infof("Network namespace %s of pod %s/%s is gone with device %q", networkNamespace, podSandbox.Namespace, podSandbox.Name, podInterfaceName)
+			return nil
+		}
+		return err
+	}
+
+	if preparedData.Config.HardwareTimestamping != nil {
+		if err := restoreTimestamping(device, func(config kndnet.HardwareTimestamping) error {
+			return k.host.nsSetHardwareTimestamping(networkNamespace, podInterfaceName, config)
+		}); err != nil {
+			klog.Errorf("failed to restore the hardware timestamping of device %s: %v", podInterfaceName, err)
+		}
+	}
+
+	if k.ethtoolConfig(preparedData, podSandbox) != nil && device.Ethtool != nil {
+		if _, err := kndnet.NsSetEthtool(networkNamespace, podInterfaceName, *device.Ethtool); err != nil {
+			klog.Errorf("failed to restore the ethtool settings of device %s: %v", podInterfaceName, err)
+		}
+	}
+
 	// Use the plumbing library to move the device back.
-	return kndnet.NsDetachNetdev(networkNamespace, podInterfaceName, hostDeviceName)
+	err = k.host.detachNetdev(networkNamespace, podInterfaceName, hostDeviceName, kndnet.WithDetachNamespaceRetries(k.namespaceRetries), device.originalAttrs())
+	if errors.Is(err, kndnet.ErrNamespaceGone) {
+		// the kernel returned the device to the host when the namespace was
+		// destroyed, or it is lost, there is nothing left to detach
+		klog.Infof("Network namespace %s of pod %s/%s is gone, recovering device %q on the host",
+			networkNamespace, podSandbox.Namespace, podSandbox.Name, hostDeviceName)
+		if err := k.restoreDevice(device, hostDeviceName); err != nil {
+			klog.Warningf("Device %q of pod %s/%s not recovered on the host: %v", hostDeviceName, podSandbox.Namespace, podSandbox.Name, err)
+		}
+		return nil
+	}
+	return err
+}
+
+// originalAttrs returns the option of the detach setting back the MTU and
+// the MAC address the device had before it was moved, if they were recorded.
+func (d AllocatedDevice) originalAttrs() kndnet.DetachOption {
+	mac, err := net.ParseMAC(d.HardwareAddr)
+	if err != nil && d.HardwareAddr != "" {
+		klog.Errorf("invalid recorded address %q of device %s, not restoring it: %v", d.HardwareAddr, d.Name, err)
+	}
+	return kndnet.WithOriginalAttrs(d.MTU, mac)
 }
 
 //================================================================
@@ -393,29 +1945,124 @@ const (
 )
 
 var (
-	hostnameOverride string
-	kubeconfig       string
-	bindAddress      string
-	ready            atomic.Bool
+	hostnameOverride      string
+	nriPluginName         string
+	nriPluginIndex        string
+	kubeconfig            string
+	bindAddress           string
+	reconcileInterval     time.Duration
+	publishInterval       time.Duration
+	forcePublishAfter     time.Duration
+	cleanupChildren       bool
+	qosConfigFile         string
+	failureMode           string
+	linkUpFailureMode     string
+	utilizationInterval   time.Duration
+	utilizationAnnotation bool
+	errorRateThreshold    float64
+	errorSampleInterval   time.Duration
+	allocationPolicy      string
+	deviceGrouping        string
+	deviceGroupsFile      string
+	webhookURL            string
+	webhookTokenFile      string
+	webhookTimeout        time.Duration
+	webhookBlocking       bool
+	teardownHookPath      string
+	teardownHookTimeout   time.Duration
+	linkUpRetries         int
+	namespaceRetries      int
+	dadTimeout            time.Duration
+	maxNetnsOps           int
+	sriovCreateVFs        bool
+	sriovCleanupVFs       bool
+	sriovOnDemand         bool
+	namespaceQuotaFile    string
+	allowedDevices        string
+	allowedDevicesFile    string
+	interfaceInclude      string
+	interfaceExclude      string
+	reservedIfacesFile    string
+	allowDefaultRouteLink bool
+	namespaceQuota        int
+	detachVerifyTimeout   time.Duration
+	statusAnnotation      bool
+	reserveDevices        bool
+	watchLinks            bool
+	macvlanSlots          int
+	clusterDNS            string
+	preserveDNSRoutes     bool
+	claimDeletionMode     string
+	bootSettleDelay       time.Duration
+	bandwidthFactor       float64
+	initialPublishRetries int
+	podsDir               string
+	ready                 atomic.Bool
 )
 
 func init() {
 	flag.StringVar(&kubeconfig, "kubeconfig", "", "absolute path to the kubeconfig file")
-	flag.StringVar(&bindAddress, "bind-address", ":9177", "The IP address and port for the metrics and healthz server to serve on")
+	flag.StringVar(&bindAddress, "bind-address", ":9177", "The IP address and port for the metrics, healthz and readyz server to serve on")
 	flag.StringVar(&hostnameOverride, "hostname-override", "", "If non-empty, will be used as the name of the Node is running on.")
+	flag.StringVar(&nriPluginName, "nri-plugin-name", "", "Name of the NRI plugin registered with the runtime, the driver name if empty. Must be unique among the plugins of the node.")
+	flag.StringVar(&nriPluginIndex, "nri-plugin-index", defaultNRIPluginIndex, "Two digit index of the NRI plugin, it orders the plugin among the plugins of the runtime. Must be unique among the plugins of the node.")
+	flag.DurationVar(&publishInterval, "publish-interval", defaultPublishInterval, "How often to publish the devices in the ResourceSlice, the changes are also published right away, see --watch-links.")
+	flag.DurationVar(&forcePublishAfter, "force-publish-after", defaultForcePublishAfter, "How long to skip the publication of unchanged devices before publishing them again anyway, 0 publishes them every publish interval.")
+	flag.DurationVar(&reconcileInterval, "reconcile-interval", defaultReconcileInterval, "How often to restore the devices of pods that no longer exist on the node.")
+	flag.BoolVar(&cleanupChildren, "cleanup-orphaned-interfaces", true, "Remove on startup the vlan, macvlan and ipvlan interfaces created by the driver that are not associated to any running pod.")
+	flag.StringVar(&qosConfigFile, "qos-config", "", "Path to a JSON file mapping pod QoS classes (Guaranteed, Burstable, BestEffort) to default device settings.")
+	flag.StringVar(&failureMode, "prepare-failure-mode", string(PrepareAllOrNothing), "How to prepare a claim when some of its devices fail: all-or-nothing fails the whole claim, best-effort prepares the devices that succeeded.")
+	flag.StringVar(&linkUpFailureMode, "detach-link-up-failure", string(LinkUpFailureWarn), "How to handle a device returned to the host on pod stop that cannot be set up: warn considers it detached and emits a warning, retry restores it again when the pod is removed.")
+	flag.DurationVar(&utilizationInterval, "utilization-interval", 0, "How often to sample the counters of the devices attached to pods to report their utilization, 0 disables the sampling.")
+	flag.BoolVar(&utilizationAnnotation, "utilization-annotation", false, "Record the utilization of the devices in the "+deviceUtilizationAnnotation+" pod annotation, requires --utilization-interval.")
+	flag.Float64Var(&errorRateThreshold, "error-rate-threshold", 0, "Errors or drops per second of a device attached to a pod above which a warning event is emitted on the pod, 0 disables the monitoring.")
+	flag.DurationVar(&errorSampleInterval, "error-sample-interval", defaultErrorSampleInterval, "How often to sample the error and drop counters of the devices attached to pods, requires --error-rate-threshold.")
+	flag.StringVar(&allocationPolicy, "allocation-policy", string(AllocationPolicyNone), "Preference among equivalent free devices: none keeps the discovery order, fill packs allocations onto the fewest physical functions, spread balances them across physical functions.")
+	flag.StringVar(&deviceGrouping, "device-grouping", string(DeviceGroupingNone), "Devices that are only allocated together, published with the same group attribute: none does not group them, pci groups the physical functions of the same PCI device, like the ports of a card, config groups the interfaces of --device-groups-config.")
+	flag.StringVar(&deviceGroupsFile, "device-groups-config", "", "Path to a JSON file mapping group names to the host interfaces in them, required by --device-grouping=config.")
+	flag.StringVar(&webhookURL, "webhook-url", "", "If non-empty, URL the device attach and detach events are posted to.")
+	flag.StringVar(&webhookTokenFile, "webhook-token-file", "", "Path to a file with the shared token sent as bearer token to the webhook.")
+	flag.DurationVar(&webhookTimeout, "webhook-timeout", defaultWebhookTimeout, "Timeout of each webhook request.")
+	flag.BoolVar(&webhookBlocking, "webhook-blocking", false, "Wait for the webhook to accept the attach event before starting the pod, failing the pod sandbox if it does not.")
+	flag.StringVar(&teardownHookPath, "teardown-hook", "", "If non-empty, absolute path of an executable run after each device of a pod is returned to the host, with the detach event as JSON on its standard input.")
+	flag.DurationVar(&teardownHookTimeout, "teardown-hook-timeout", defaultTeardownHookTimeout, "Timeout of each run of the teardown hook, it is killed after it.")
+	flag.IntVar(&linkUpRetries, "link-up-retries", kndnet.DefaultLinkUpRetries, "How many times to retry the bring up of a device moved into a pod on transient errors, 0 disables the retries.")
+	flag.IntVar(&namespaceRetries, "netns-retries", kndnet.DefaultNamespaceRetries, "How many times to retry opening the network namespace of a pod while the runtime is still setting it up, with an exponential backoff from 50ms, 0 disables the retries.")
+	flag.DurationVar(&dadTimeout, "dad-timeout", defaultDADTimeout, "How long to wait for the IPv6 addresses of a device brought up in a pod to complete the duplicate address detection, failing the pod sandbox after it, 0 does not wait.")
+	flag.IntVar(&maxNetnsOps, "max-concurrent-netns-ops", 0, "Maximum number of devices attached to or detached from pods at the same time across all the pods, the others wait for their turn, 0 is unlimited.")
+	flag.BoolVar(&sriovCreateVFs, "sriov-create-vfs", false, "Create on startup all the virtual functions of the SR-IOV physical functions that have none, so they can be allocated.")
+	flag.BoolVar(&sriovCleanupVFs, "sriov-cleanup-vfs", false, "Remove on stop the virtual functions created by --sriov-create-vfs, otherwise they are left for the next instance.")
+	flag.BoolVar(&sriovOnDemand, "sriov-on-demand-vfs", true, "Create a virtual function when a claim requests one from a physical function without free ones, disable it on clusters that pre-provision the virtual functions.")
+	flag.StringVar(&allowedDevices, "allowed-devices", "", "Comma separated names of the only host interfaces that can be published and moved into pods, all of them if neither this nor --allowed-devices-config are set.")
+	flag.StringVar(&allowedDevicesFile, "allowed-devices-config", "", "Path to a JSON array with names of host interfaces that can be published and moved into pods, added to --allowed-devices.")
+	flag.StringVar(&interfaceInclude, "interface-include", "", "Comma separated regular expressions matched against the whole name of the host interfaces, only the matching ones are published, e.g. ens.*,enp.*. All of them if empty.")
+	flag.StringVar(&interfaceExclude, "interface-exclude", "", "Comma separated regular expressions matched against the whole name of the host interfaces that are never published, taking precedence over --interface-include.")
+	flag.StringVar(&reservedIfacesFile, "reserved-interfaces-file", "", "Path to a YAML or JSON list of host interface names that are never published, e.g. the storage network NICs. It is reloaded on SIGHUP.")
+	flag.BoolVar(&allowDefaultRouteLink, "allow-default-route-interface", false, "Publish the host interfaces carrying the default route of the node, e.g. the only interface of single-NIC nodes. Moving one of them into a pod cuts the node off.")
+	flag.StringVar(&namespaceQuotaFile, "namespace-quota-config", "", "Path to a JSON file mapping namespaces to the maximum number of devices their pods can hold on the node.")
+	flag.IntVar(&namespaceQuota, "default-namespace-quota", 0, "Maximum number of devices the pods of a namespace not listed in --namespace-quota-config can hold on the node, 0 is unlimited.")
+	flag.DurationVar(&detachVerifyTimeout, "detach-verify-timeout", 0, "How long to wait for a device returned to the host on pod stop to reappear with its name, restoring it again if it does not, 0 disables the verification.")
+	flag.BoolVar(&statusAnnotation, "status-annotation", false, "Record the configuration applied to the devices of a pod in the "+podNetworkStatusAnnotation+" pod annotation on attach and detach.")
+	flag.IntVar(&macvlanSlots, "macvlan-slots", 0, "Number of macvlan slots published per host interface that can host a macvlan, as <interface>-mvlan<i> devices, so as many pods can each get a macvlan child of the same interface. 0 publishes none.")
+	flag.BoolVar(&watchLinks, "watch-links", true, "Publish the device changes as soon as netlink reports a link or address change of the host, the devices are still checked every 30s in case one is missed. Otherwise they are checked every 5s.")
+	flag.BoolVar(&reserveDevices, "reserve-prepared-devices", false, "Withhold the devices prepared for a claim from the published devices until they are unprepared or returned by a pod stop, reducing double allocations before the next publication.")
+	flag.StringVar(&clusterDNS, "cluster-dns", "", "Comma separated list of the cluster DNS IPs, if empty they are discovered from the "+clusterDNSNamespace+"/"+clusterDNSService+" Service.")
+	flag.BoolVar(&preserveDNSRoutes, "preserve-dns-routes", true, "Keep the cluster DNS reachable through the pod primary interface when a device installs a default route in the pod.")
+	flag.Float64Var(&bandwidthFactor, "bandwidth-oversubscription", 0, "How many times the link speed of a device the egressRate of the virtual functions and child interfaces prepared on it can add up to, claims exceeding it fail to prepare, 0 does not limit it.")
+	flag.DurationVar(&bootSettleDelay, "boot-settle-delay", 0, "How long after the node boot to wait before the first publication of the devices, so the interfaces still appearing or being renamed are not published, 0 publishes right away.")
+	flag.IntVar(&initialPublishRetries, "initial-publish-retries", defaultInitialPublishRetries, "How many times to retry the first publication of the devices on startup with an exponential backoff from 500ms, the driver is not ready until it succeeds, 0 disables the retries.")
+	flag.StringVar(&podsDir, "pods-dir", defaultPodsDir, "Directory of the kubelet with the pod directories, the networkNamespace of the device configurations is relative to the directory of the pod in it.")
+	flag.StringVar(&claimDeletionMode, "claim-deletion-mode", string(ClaimDeletionKeep), "What to do with the devices of a running pod when their ResourceClaim is deleted: keep leaves them in the pod until it stops, restore returns them to the host right away.")
 	klog.InitFlags(nil)
-	flag.Parse()
 }
 
 func main() {
+	flag.Parse()
 	printVersion()
 
 	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, unix.SIGTERM)
 	defer cancel()
 
-	// Set up healthz and metrics endpoints
-	setupHTTPServer()
-
 	// Set up Kubernetes client
 	clientset, err := newClientset()
 	if err != nil {
@@ -430,6 +2077,168 @@ func main() {
 	// 1. Create the plugin
 	plugin := NewNetworkDriver(driverName, nodeName, clientset)
 
+	// Set up healthz, metrics, status and debug endpoints
+	setupHTTPServer(plugin)
+
+	// the runtime only reports a bad index when the plugin registers
+	if err := api.CheckPluginIndex(nriPluginIndex); err != nil {
+		klog.Fatalf("Invalid NRI plugin index: %v", err)
+	}
+	plugin.nriPluginIndex = nriPluginIndex
+	if nriPluginName != "" {
+		plugin.nriPluginName = nriPluginName
+	}
+	plugin.reconcileInterval = reconcileInterval
+	if publishInterval <= 0 {
+		klog.Fatalf("Invalid publish interval %v, must be positive", publishInterval)
+	}
+	plugin.publishInterval = publishInterval
+	if forcePublishAfter < 0 {
+		klog.Fatalf("Invalid force publish after %v, must not be negative", forcePublishAfter)
+	}
+	plugin.forcePublishAfter = forcePublishAfter
+	plugin.cleanupChildren = cleanupChildren
+	plugin.utilizationInterval = utilizationInterval
+	plugin.utilizationAnnotation = utilizationAnnotation
+	if errorRateThreshold < 0 {
+		klog.Fatalf("Invalid error rate threshold %g, must be 0 or greater", errorRateThreshold)
+	}
+	if errorRateThreshold > 0 && errorSampleInterval <= 0 {
+		klog.Fatalf("Invalid error sample interval %v, must be greater than 0", errorSampleInterval)
+	}
+	plugin.errorRateThreshold = errorRateThreshold
+	plugin.errorSampleInterval = errorSampleInterval
+	plugin.detachVerifyTimeout = detachVerifyTimeout
+	plugin.bootSettleDelay = bootSettleDelay
+	if bandwidthFactor < 0 {
+		klog.Fatalf("Invalid bandwidth oversubscription %g, must be 0 or greater", bandwidthFactor)
+	}
+	plugin.bandwidthOversubscription = bandwidthFactor
+	plugin.statusAnnotation = statusAnnotation
+	plugin.reserveDevices = reserveDevices
+	plugin.watchLinks = watchLinks
+	if macvlanSlots < 0 {
+		klog.Fatalf("Invalid macvlan slots %d, must be 0 or greater", macvlanSlots)
+	}
+	plugin.macvlanSlots = macvlanSlots
+	plugin.preserveDNS = preserveDNSRoutes
+	plugin.clusterDNS, err = parseClusterDNS(clusterDNS)
+	if err != nil {
+		klog.Fatalf("Invalid cluster DNS: %v", err)
+	}
+	if linkUpRetries < 0 {
+		klog.Fatalf("Invalid link up retries %d, must be 0 or greater", linkUpRetries)
+	}
+	if namespaceRetries < 0 {
+		klog.Fatalf("Invalid network namespace retries %d, must be 0 or greater", namespaceRetries)
+	}
+	if initialPublishRetries < 0 {
+		klog.Fatalf("Invalid initial publish retries %d, must be 0 or greater", initialPublishRetries)
+	}
+	plugin.initialPublishRetries = initialPublishRetries
+	if !filepath.IsAbs(podsDir) {
+		klog.Fatalf("Invalid pods directory %q, must be an absolute path", podsDir)
+	}
+	plugin.podsDir = podsDir
+	plugin.linkUpRetries = linkUpRetries
+	plugin.namespaceRetries = namespaceRetries
+	if dadTimeout < 0 {
+		klog.Fatalf("Invalid DAD timeout %v, must not be negative", dadTimeout)
+	}
+	plugin.dadTimeout = dadTimeout
+	if maxNetnsOps < 0 {
+		klog.Fatalf("Invalid maximum concurrent netns operations %d, must be 0 or greater", maxNetnsOps)
+	}
+	plugin.maxNetnsOps = maxNetnsOps
+	plugin.netnsOps = newNetnsLimiter(maxNetnsOps)
+	plugin.sriovCreateVFs = sriovCreateVFs
+	plugin.sriovCleanupVFs = sriovCleanupVFs
+	plugin.sriovOnDemand = sriovOnDemand
+	plugin.allocationPolicy, err = parseAllocationPolicy(allocationPolicy)
+	if err != nil {
+		klog.Fatalf("Invalid allocation policy: %v", err)
+	}
+	plugin.deviceGrouping, err = parseDeviceGrouping(deviceGrouping)
+	if err != nil {
+		klog.Fatalf("Invalid device grouping: %v", err)
+	}
+	if (plugin.deviceGrouping == DeviceGroupingConfig) != (deviceGroupsFile != "") {
+		klog.Fatalf("--device-groups-config must be set if and only if --device-grouping is %s", DeviceGroupingConfig)
+	}
+	if deviceGroupsFile != "" {
+		plugin.deviceGroups, err = loadDeviceGroups(deviceGroupsFile)
+		if err != nil {
+			klog.Fatalf("Invalid device groups: %v", err)
+		}
+	}
+	switch PrepareFailureMode(failureMode) {
+	case PrepareAllOrNothing, PrepareBestEffort:
+		plugin.failureMode = PrepareFailureMode(failureMode)
+	default:
+		klog.Fatalf("Invalid prepare failure mode %q, must be %s or %s", failureMode, PrepareAllOrNothing, PrepareBestEffort)
+	}
+	switch LinkUpFailureMode(linkUpFailureMode) {
+	case LinkUpFailureWarn, LinkUpFailureRetry:
+		plugin.linkUpFailureMode = LinkUpFailureMode(linkUpFailureMode)
+	default:
+		klog.Fatalf("Invalid detach link up failure mode %q, must be %s or %s", linkUpFailureMode, LinkUpFailureWarn, LinkUpFailureRetry)
+	}
+	switch ClaimDeletionMode(claimDeletionMode) {
+	case ClaimDeletionKeep, ClaimDeletionRestore:
+		plugin.claimDeletionMode = ClaimDeletionMode(claimDeletionMode)
+	default:
+		klog.Fatalf("Invalid claim deletion mode %q, must be %s or %s", claimDeletionMode, ClaimDeletionKeep, ClaimDeletionRestore)
+	}
+	if webhookURL != "" {
+		plugin.webhook, err = newWebhook(webhookURL, webhookTokenFile, webhookTimeout, webhookBlocking)
+		if err != nil {
+			klog.Fatalf("Invalid webhook configuration: %v", err)
+		}
+	}
+	if teardownHookPath != "" {
+		plugin.teardownHook, err = newTeardownHook(teardownHookPath, teardownHookTimeout)
+		if err != nil {
+			klog.Fatalf("Invalid teardown hook: %v", err)
+		}
+	}
+	if qosConfigFile != "" {
+		plugin.qosDefaults, err = loadQoSConfig(qosConfigFile)
+		if err != nil {
+			klog.Fatalf("Invalid QoS configuration: %v", err)
+		}
+	}
+	if namespaceQuota < 0 {
+		klog.Fatalf("Invalid default namespace quota %d, must be 0 or greater", namespaceQuota)
+	}
+	plugin.defaultNamespaceQuota = namespaceQuota
+	if namespaceQuotaFile != "" {
+		plugin.namespaceQuotas, err = loadNamespaceQuotas(namespaceQuotaFile)
+		if err != nil {
+			klog.Fatalf("Invalid namespace quotas: %v", err)
+		}
+	}
+
+	if allowedDevices != "" || allowedDevicesFile != "" {
+		plugin.allowlist, err = parseAllowlist(allowedDevices, allowedDevicesFile)
+		if err != nil {
+			klog.Fatalf("Invalid device allowlist: %v", err)
+		}
+	}
+
+	plugin.interfaceFilter, err = newInterfaceFilter(interfaceInclude, interfaceExclude)
+	if err != nil {
+		klog.Fatalf("Invalid interface filter: %v", err)
+	}
+	plugin.allowDefaultRouteInterface = allowDefaultRouteLink
+
+	if reservedIfacesFile != "" {
+		plugin.reservedInterfaces, err = loadReservedInterfaces(reservedIfacesFile)
+		if err != nil {
+			klog.Fatalf("Invalid reserved interfaces: %v", err)
+		}
+		plugin.reservedInterfacesFile = reservedIfacesFile
+	}
+
 	// 2. Start the plugin
 	if err := plugin.Start(ctx); err != nil {
 		klog.Fatalf("Driver failed to start: %v", err)
@@ -444,16 +2253,15 @@ func main() {
 	klog.Info("Driver shutting down")
 }
 
-func setupHTTPServer() {
+func setupHTTPServer(plugin *NetworkDriver) {
 	mux := http.NewServeMux()
-	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
-		if ready.Load() {
-			w.WriteHeader(http.StatusOK)
-		} else {
-			w.WriteHeader(http.StatusServiceUnavailable)
-		}
-	})
+	mux.Handle("/healthz", plugin.healthzHandler())
+	mux.Handle("/readyz", plugin.readyzHandler(&ready))
 	mux.Handle("/metrics", promhttp.Handler())
+	mux.Handle("/status/", plugin.podStatusHandler())
+	mux.Handle("/status/node", plugin.nodeReportHandler())
+	mux.Handle("/debug/", plugin.debugConfigHandler(flag.CommandLine))
+	mux.Handle("/simulate/", plugin.simulateHandler())
 	server := &http.Server{Addr: bindAddress, Handler: mux, ReadHeaderTimeout: 5 * time.Second}
 
 	go func() {
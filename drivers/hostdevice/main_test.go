@@ -0,0 +1,416 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/containerd/nri/pkg/api"
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+	resourceapi "k8s.io/api/resource/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+
+	kndnet "github.com/aojea/kubernetes-network-drivers/pkg/net"
+)
+
+func Test_StartContainer(t *testing.T) {
+	k := NewNetworkDriver(driverName, "node1", fake.NewClientset())
+	k.checkpointPath = ""
+	k.sharedState.PodDeviceConfig["pod-uid"] = []AllocatedDevice{{Name: "eth1", NetworkNamespace: "/run/netns/does-not-exist"}}
+	k.sharedState.PreparedData["pod-uid"] = []PreparedDevice{{DeviceName: "eth1", Config: DeviceConfig{BringUpContainer: "app"}, State: DeviceStateAttached}}
+	pod := &api.PodSandbox{Uid: "pod-uid", Name: "pod", Namespace: "default"}
+
+	// other containers must not touch the device
+	if err := k.StartContainer(context.Background(), pod, &api.Container{Name: "init"}); err != nil {
+		t.Fatalf("unexpected error for non matching container: %v", err)
+	}
+	// the configured container triggers the bring up, that fails because
+	// the network namespace does not exist
+	if err := k.StartContainer(context.Background(), pod, &api.Container{Name: "app"}); err == nil {
+		t.Fatalf("expected bring up to be attempted for container app")
+	}
+	// a restart of the container does not bring up the device again
+	k.sharedState.PodDeviceConfig["pod-uid"][0].BroughtUp = true
+	if err := k.StartContainer(context.Background(), pod, &api.Container{Name: "app"}); err != nil {
+		t.Fatalf("unexpected error for a device already brought up: %v", err)
+	}
+}
+
+func Test_PrepareResourceClaims_failureMode(t *testing.T) {
+	newClaim := func() *resourceapi.ResourceClaim {
+		claim := newClaimWithConfig(opaqueConfig(driverName, []string{"bad"}, `{"routes":[{"dst":"invalid"}]}`))
+		claim.Name = "claim"
+		claim.UID = "claim-uid"
+		claim.Status.Allocation.Devices.Results = []resourceapi.DeviceRequestAllocationResult{
+			{Request: "good", Driver: driverName, Pool: "node1", Device: "eth1"},
+			{Request: "bad", Driver: driverName, Pool: "node1", Device: "eth2"},
+			{Request: "other", Driver: "other.k8s.io", Pool: "node1", Device: "gpu0"},
+		}
+		return claim
+	}
+
+	tests := []struct {
+		name        string
+		mode        PrepareFailureMode
+		wantErr     bool
+		wantDevices []string
+		wantEvent   string
+	}{
+		{name: "all-or-nothing", mode: PrepareAllOrNothing, wantErr: true, wantEvent: "the claim is not prepared"},
+		{name: "best-effort", mode: PrepareBestEffort, wantDevices: []string{"eth1"}, wantEvent: "the claim is prepared with 1 of 2 devices"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k := NewNetworkDriver(driverName, "node1", fake.NewClientset())
+			k.checkpointPath = ""
+			k.failureMode = tt.mode
+			recorder := record.NewFakeRecorder(10)
+			k.eventRecorder = recorder
+			claim := newClaim()
+
+			results, err := k.PrepareResourceClaims(context.Background(), []*resourceapi.ResourceClaim{claim})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			result := results[claim.UID]
+			if (result.Err != nil) != tt.wantErr {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, result.Err)
+			}
+
+			var gotDevices []string
+			for _, device := range result.Devices {
+				gotDevices = append(gotDevices, device.DeviceName)
+			}
+			if !reflect.DeepEqual(gotDevices, tt.wantDevices) {
+				t.Errorf("expected prepared devices %v, got %v", tt.wantDevices, gotDevices)
+			}
+			if got := len(k.sharedState.PreparedData[claim.UID]); got != len(tt.wantDevices) {
+				t.Errorf("expected %d devices in the prepared data, got %d", len(tt.wantDevices), got)
+			}
+			// the failed device is reported on the claim
+			select {
+			case event := <-recorder.Events:
+				if !strings.HasPrefix(event, "Warning DevicePrepareFailed Node node1: device eth2: ") || !strings.HasSuffix(event, tt.wantEvent) {
+					t.Errorf("unexpected event %q", event)
+				}
+			default:
+				t.Errorf("expected an event for the failed device")
+			}
+		})
+	}
+}
+
+func Test_RemovePodSandbox_withoutStop(t *testing.T) {
+	var restored []string
+	k := NewNetworkDriver(driverName, "node1", fake.NewClientset())
+	k.host.restoreNetdev = func(devName, outName string, opts ...kndnet.DetachOption) error {
+		restored = append(restored, devName)
+		return nil
+	}
+
+	k.checkpointPath = ""
+	// the network namespace is gone, the kernel returned the devices to the host
+	k.sharedState.PodDeviceConfig["evicted-uid"] = []AllocatedDevice{
+		{Name: "eth1", NetworkNamespace: "/run/netns/does-not-exist"},
+		{Name: "pf0", NetworkNamespace: "/run/netns/does-not-exist"},
+	}
+	k.sharedState.PreparedData["evicted-uid"] = []PreparedDevice{
+		{DeviceName: "eth1", State: DeviceStateAttached},
+		{DeviceName: "pf0", InterfaceName: "eth5", State: DeviceStateAttached},
+	}
+	k.sharedState.PodDeviceConfig["stopped-uid"] = []AllocatedDevice{{Name: "eth2", NetworkNamespace: "/run/netns/does-not-exist"}}
+	k.sharedState.PreparedData["stopped-uid"] = []PreparedDevice{{DeviceName: "eth2", State: DeviceStateDetached}}
+
+	if err := k.RemovePodSandbox(context.Background(), &api.PodSandbox{Uid: "evicted-uid", Name: "evicted", Namespace: "default"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := []string{"eth1", "eth5"}; !reflect.DeepEqual(restored, want) {
+		t.Errorf("expected devices %v restored, got %v", want, restored)
+	}
+	if _, ok := k.sharedState.PreparedData["evicted-uid"]; ok {
+		t.Errorf("expected state of removed pod to be deleted")
+	}
+
+	// devices cleanly detached by StopPodSandbox are not restored again
+	restored = nil
+	if err := k.RemovePodSandbox(context.Background(), &api.PodSandbox{Uid: "stopped-uid", Name: "stopped", Namespace: "default"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(restored) != 0 {
+		t.Errorf("unexpected restore of detached devices %v", restored)
+	}
+}
+
+func Test_StopPodSandbox_namespaceGone(t *testing.T) {
+	var restored []string
+	k := NewNetworkDriver(driverName, "node1", fake.NewClientset())
+	k.host.restoreNetdev = func(devName, outName string, opts ...kndnet.DetachOption) error {
+		if devName == "eth2" {
+			return fmt.Errorf("link not found for interface %s on the host namespace", devName)
+		}
+		restored = append(restored, devName)
+		return nil
+	}
+
+	k.checkpointPath = ""
+	k.detachVerifyTimeout = 0
+	netns := "/run/netns/does-not-exist"
+	// eth1 was returned to the host by the kernel, eth2 is lost and the
+	// macvlan child was deleted with the namespace
+	k.sharedState.PodDeviceConfig["pod-uid"] = []AllocatedDevice{
+		{Name: "eth1", NetworkNamespace: netns},
+		{Name: "eth2", NetworkNamespace: netns},
+		{Name: "eth3", NetworkNamespace: netns},
+	}
+	k.sharedState.PreparedData["pod-uid"] = []PreparedDevice{
+		{DeviceName: "eth1", State: DeviceStateAttached},
+		{DeviceName: "eth2", State: DeviceStateAttached},
+		{DeviceName: "eth3", State: DeviceStateAttached, Config: DeviceConfig{Child: &ChildConfig{Type: "macvlan"}}},
+	}
+	pod := &api.PodSandbox{Uid: "pod-uid", Name: "pod", Namespace: "default", Linux: &api.LinuxPodSandbox{
+		Namespaces: []*api.LinuxNamespace{{Type: "network", Path: netns}},
+	}}
+
+	if err := k.StopPodSandbox(context.Background(), pod); err != nil {
+		t.Fatalf("expected the cleanup of a deleted namespace to succeed, got %v", err)
+	}
+	if want := []string{"eth1"}; !reflect.DeepEqual(restored, want) {
+		t.Errorf("expected devices %v recovered on the host, got %v", want, restored)
+	}
+	for _, device := range k.sharedState.PreparedData["pod-uid"] {
+		if device.State != DeviceStateDetached {
+			t.Errorf("expected device %s detached, got %s", device.DeviceName, device.State)
+		}
+	}
+}
+
+func Test_StopPodSandbox_linkUpFailure(t *testing.T) {
+	for _, mode := range []LinkUpFailureMode{LinkUpFailureWarn, LinkUpFailureRetry} {
+		t.Run(string(mode), func(t *testing.T) {
+			var detached []string
+			k := NewNetworkDriver(driverName, "node1", fake.NewClientset())
+			k.host.detachNetdev = func(containerNsPath string, devName string, outName string, opts ...kndnet.DetachOption) error {
+				detached = append(detached, devName)
+				if devName == "eth2" {
+					return fmt.Errorf("%w: failed to set %q up: %w", kndnet.ErrLinkDown, devName, unix.EIO)
+				}
+				return nil
+			}
+
+			k.checkpointPath = ""
+			k.linkUpFailureMode = mode
+			recorder := record.NewFakeRecorder(10)
+			k.eventRecorder = recorder
+			k.sharedState.PodDeviceConfig["pod-uid"] = []AllocatedDevice{{Name: "eth1"}, {Name: "eth2"}}
+			k.sharedState.PreparedData["pod-uid"] = []PreparedDevice{
+				{DeviceName: "eth1", State: DeviceStateAttached},
+				{DeviceName: "eth2", State: DeviceStateAttached},
+			}
+
+			err := k.StopPodSandbox(context.Background(), &api.PodSandbox{Uid: "pod-uid", Name: "pod", Namespace: "default"})
+			if !errors.Is(err, kndnet.ErrLinkDown) {
+				t.Fatalf("expected the bring up failure to be returned, got %v", err)
+			}
+			// devices are detached in reverse, the failure of eth2 does not
+			// stop the cleanup of eth1
+			if want := []string{"eth2", "eth1"}; !reflect.DeepEqual(detached, want) {
+				t.Errorf("expected devices %v detached, got %v", want, detached)
+			}
+			select {
+			case event := <-recorder.Events:
+				if !strings.Contains(event, deviceDownReason) {
+					t.Errorf("unexpected event %q", event)
+				}
+			default:
+				t.Errorf("expected a %s event", deviceDownReason)
+			}
+
+			wantState := DeviceStateDetached
+			if mode == LinkUpFailureRetry {
+				wantState = DeviceStateAttached
+			}
+			if got := k.sharedState.PreparedData["pod-uid"][0].State; got != wantState {
+				t.Errorf("expected state %s, got %s", wantState, got)
+			}
+		})
+	}
+}
+
+func Test_PrepareResourceClaims_ips(t *testing.T) {
+	var got []*net.IPNet
+	k := NewNetworkDriver(driverName, "node1", fake.NewClientset())
+	k.host.attachNetdev = func(hostIfName string, containerNsPath string, newAttr netlink.LinkAttrs, addresses []*net.IPNet, opts ...kndnet.AttachOption) (*resourceapi.NetworkDeviceData, error) {
+		got = addresses
+		return nil, nil
+	}
+
+	k.checkpointPath = ""
+	claim := newClaimWithConfig(opaqueConfig(driverName, nil, `{"ips":["192.168.5.10/24","fd00::10/64"]}`))
+	claim.UID = "claim-uid"
+	results, err := k.PrepareResourceClaims(context.Background(), []*resourceapi.ResourceClaim{claim})
+	if err != nil || results[claim.UID].Err != nil {
+		t.Fatalf("unexpected error: %v %v", err, results[claim.UID].Err)
+	}
+	preparedData := k.sharedState.PreparedData[claim.UID]
+	if err := k.configureDeviceForPod(AllocatedDevice{Name: "eth1"}, "/run/netns/pod", newTestSandbox("/run/netns/pod"), preparedData[0]); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var addresses []string
+	for _, address := range got {
+		addresses = append(addresses, address.String())
+	}
+	if want := []string{"192.168.5.10/24", "fd00::10/64"}; !reflect.DeepEqual(addresses, want) {
+		t.Errorf("expected addresses %v, got %v", want, addresses)
+	}
+
+	// malformed addresses fail the claim on prepare
+	claim = newClaimWithConfig(opaqueConfig(driverName, nil, `{"ips":["192.168.5.10"]}`))
+	claim.UID = "invalid-uid"
+	results, err = k.PrepareResourceClaims(context.Background(), []*resourceapi.ResourceClaim{claim})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := results[claim.UID].Err; err == nil || !strings.Contains(err.Error(), "CIDR") {
+		t.Errorf("expected an invalid ip error, got %v", err)
+	}
+}
+
+func Test_PrepareResourceClaims_multipleDevices(t *testing.T) {
+	var attached []string
+	k := NewNetworkDriver(driverName, "node1", fake.NewClientset())
+	k.host.attachNetdev = func(hostIfName string, containerNsPath string, newAttr netlink.LinkAttrs, addresses []*net.IPNet, opts ...kndnet.AttachOption) (*resourceapi.NetworkDeviceData, error) {
+		attached = append(attached, hostIfName)
+		return nil, nil
+	}
+
+	k.checkpointPath = ""
+	// a single request of two devices, e.g. the members of a bond
+	claim := newClaimWithConfig()
+	claim.UID = "claim-uid"
+	claim.Status.Allocation.Devices.Results = []resourceapi.DeviceRequestAllocationResult{
+		{Request: "nic", Driver: driverName, Pool: "node1", Device: "eth1"},
+		{Request: "nic", Driver: driverName, Pool: "node1", Device: "eth2"},
+	}
+	results, err := k.PrepareResourceClaims(context.Background(), []*resourceapi.ResourceClaim{claim})
+	if err != nil || results[claim.UID].Err != nil {
+		t.Fatalf("unexpected error: %v %v", err, results[claim.UID].Err)
+	}
+	if got := len(results[claim.UID].Devices); got != 2 {
+		t.Errorf("expected 2 prepared devices, got %d", got)
+	}
+	for _, device := range k.sharedState.PreparedData[claim.UID] {
+		if err := k.configureDeviceForPod(AllocatedDevice{Name: device.DeviceName}, "/run/netns/pod", newTestSandbox("/run/netns/pod"), device); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if want := []string{"eth1", "eth2"}; !reflect.DeepEqual(attached, want) {
+		t.Errorf("expected devices %v attached, got %v", want, attached)
+	}
+}
+
+func Test_podSandbox_interfaceName(t *testing.T) {
+	var steps []string
+	k := NewNetworkDriver(driverName, "node1", fake.NewClientset())
+	k.host.attachNetdev = func(hostIfName string, containerNsPath string, newAttr netlink.LinkAttrs, addresses []*net.IPNet, opts ...kndnet.AttachOption) (*resourceapi.NetworkDeviceData, error) {
+		steps = append(steps, fmt.Sprintf("attach %s as %s", hostIfName, newAttr.Name))
+		return nil, nil
+	}
+	k.host.detachNetdev = func(containerNsPath string, devName string, outName string, opts ...kndnet.DetachOption) error {
+		steps = append(steps, fmt.Sprintf("detach %s as %s", devName, outName))
+		return nil
+	}
+
+	k.checkpointPath = ""
+	claim := newClaimWithConfig(opaqueConfig(driverName, nil, `{"interfaceName":"net1"}`))
+	claim.UID = "claim-uid"
+	results, err := k.PrepareResourceClaims(context.Background(), []*resourceapi.ResourceClaim{claim})
+	if err != nil || results[claim.UID].Err != nil {
+		t.Fatalf("unexpected error: %v %v", err, results[claim.UID].Err)
+	}
+	k.sharedState.PodDeviceConfig["pod-uid"] = []AllocatedDevice{{Name: "eth1"}}
+	k.sharedState.PreparedData["pod-uid"] = k.sharedState.PreparedData[claim.UID]
+	if err := k.RunPodSandbox(context.Background(), newTestSandbox("/run/netns/pod")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := k.sharedState.PodDeviceConfig["pod-uid"][0].PodInterface; got != "net1" {
+		t.Errorf("expected the pod interface to be recorded, got %q", got)
+	}
+	if err := k.StopPodSandbox(context.Background(), newTestSandbox("/run/netns/pod")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := []string{"attach eth1 as net1", "detach net1 as eth1"}; !reflect.DeepEqual(steps, want) {
+		t.Errorf("expected %v, got %v", want, steps)
+	}
+
+	// the devices of a claim cannot take the same name
+	claim = newClaimWithDevices("duplicate-uid", "eth1", "eth2")
+	claim.Status.Allocation.Devices.Config = []resourceapi.DeviceAllocationConfiguration{opaqueConfig(driverName, nil, `{"interfaceName":"net1"}`)}
+	results, err = k.PrepareResourceClaims(context.Background(), []*resourceapi.ResourceClaim{claim})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := results[claim.UID].Err; err == nil || !strings.Contains(err.Error(), "same interfaceName") {
+		t.Errorf("expected a duplicate interface name error, got %v", err)
+	}
+}
+
+func Test_devicesHash(t *testing.T) {
+	devices := []resourceapi.Device{newSimulatedDevice("eth1", 0, true, 8), newSimulatedDevice("eth2", 1, false, 0)}
+	hash := devicesHash(devices)
+	if hash == "" || hash != devicesHash([]resourceapi.Device{newSimulatedDevice("eth1", 0, true, 8), newSimulatedDevice("eth2", 1, false, 0)}) {
+		t.Errorf("expected the same hash for the same devices")
+	}
+	changed := []resourceapi.Device{newSimulatedDevice("eth1", 0, true, 8), newSimulatedDevice("eth2", 0, false, 0)}
+	if devicesHash(changed) == hash {
+		t.Errorf("expected a different hash for a changed attribute")
+	}
+	if devicesHash(devices[:1]) == hash {
+		t.Errorf("expected a different hash for a removed device")
+	}
+}
+
+func Test_devicesChanged(t *testing.T) {
+	k := NewNetworkDriver(driverName, "node1", fake.NewClientset())
+	k.publisher = &fakePublisher{}
+	if !k.devicesChanged() {
+		t.Errorf("expected the devices to be changed before the first publication")
+	}
+	if err := k.publishOnce(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if k.devicesChanged() {
+		t.Errorf("expected the devices unchanged after the publication")
+	}
+	k.mu.Lock()
+	k.lastDevicesHash = "stale"
+	k.mu.Unlock()
+	if !k.devicesChanged() {
+		t.Errorf("expected the devices to be changed from a different publication")
+	}
+}
+
+func Test_PreparedDevice_podInterface(t *testing.T) {
+	tests := []struct {
+		name   string
+		device PreparedDevice
+		want   string
+	}{
+		{name: "host name", device: PreparedDevice{DeviceName: "eth1"}, want: "eth1"},
+		{name: "configured name", device: PreparedDevice{DeviceName: "eth1", Config: DeviceConfig{InterfaceName: "net1", VLAN: 100}}, want: "net1"},
+		{name: "vlan", device: PreparedDevice{DeviceName: "eth1", Config: DeviceConfig{VLAN: 100}}, want: "eth1.100"},
+		{name: "vlan on a virtual function", device: PreparedDevice{DeviceName: "eth1", InterfaceName: "eth1v0", Config: DeviceConfig{VLAN: 100}}, want: "eth1v0.100"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.device.podInterface(); got != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
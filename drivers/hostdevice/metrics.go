@@ -0,0 +1,237 @@
+package main
+
+import (
+	"errors"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	kndnet "github.com/aojea/kubernetes-network-drivers/pkg/net"
+)
+
+// reasons of the resource publish outcomes
+const (
+	publishReasonPublished = "published"
+	publishReasonUnchanged = "unchanged"
+	publishReasonAPIError  = "api-error"
+	publishReasonThrottled = "throttled"
+)
+
+var (
+	devicesByState = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "knd_devices",
+		Help: "Number of devices handled by the driver per state, prepared devices have not been attached to the pod yet.",
+	}, []string{"state"})
+
+	allocatedDevices = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "knd_allocated_devices",
+		Help: "Number of devices allocated to claims prepared on the node per pool, attached to a pod or not.",
+	}, []string{"pool"})
+
+	publishedDevices = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "knd_published_devices",
+		Help: "Number of devices in the last publication per pool.",
+	}, []string{"pool"})
+
+	resourcePublishTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "knd_resource_publish_total",
+		Help: "Number of ResourceSlice publications per reason: published, unchanged (healthy no-op), api-error or throttled.",
+	}, []string{"reason"})
+
+	resourcePublishSkipped = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "knd_resource_publish_skipped_total",
+		Help: "Number of ResourceSlice publications skipped because the devices did not change.",
+	})
+
+	deviceAttachTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "knd_device_attach_total",
+		Help: "Number of device attaches to pods per driver and result, success or error.",
+	}, []string{"driver", "result"})
+
+	deviceDetachTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "knd_device_detach_total",
+		Help: "Number of device detaches from pods per driver and result, success or error.",
+	}, []string{"driver", "result"})
+
+	deviceAttachErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "knd_device_attach_errors_total",
+		Help: "Number of failed device attaches per driver and result, the kind of failure: link-down, namespace-gone, device-owned, netlink or error.",
+	}, []string{"driver", "result"})
+
+	deviceAttachDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "knd_device_attach_duration_seconds",
+		Help:    "Time to attach a device to a pod per driver, mode (move, vf, macvlan, ipvlan) and result.",
+		Buckets: prometheus.ExponentialBuckets(0.005, 2, 12),
+	}, []string{"driver", "mode", "result"})
+
+	deviceDetachDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "knd_device_detach_duration_seconds",
+		Help:    "Time to detach a device from a pod per driver, mode (move, vf, macvlan, ipvlan) and result.",
+		Buckets: prometheus.ExponentialBuckets(0.005, 2, 12),
+	}, []string{"driver", "mode", "result"})
+
+	podSandboxRunDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "knd_pod_sandbox_run_duration_seconds",
+		Help:    "Time to run a pod sandbox per driver and result, with the lookup of the claims of the pod and the attach of its devices.",
+		Buckets: prometheus.ExponentialBuckets(0.005, 2, 12),
+	}, []string{"driver", "result"})
+
+	podClaimLookups = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "knd_pod_claim_lookups_total",
+		Help: "Number of API requests to the pod and its claims to assign the prepared claims to a pod sandbox per driver.",
+	}, []string{"driver"})
+
+	deviceThroughput = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "knd_device_throughput_bits_per_second",
+		Help: "Throughput of the devices attached to pods per direction, sampled inside the pod network namespace.",
+	}, []string{"device", "direction"})
+
+	deviceUtilization = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "knd_device_utilization_ratio",
+		Help: "Fraction of the link speed used by the devices attached to pods per direction.",
+	}, []string{"device", "direction"})
+
+	netnsOperationsQueued = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "knd_netns_operations_queued",
+		Help: "Number of device attach and detach operations waiting for a slot of --max-concurrent-netns-ops.",
+	})
+
+	netnsHandlesOpen = prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "knd_netns_handles_open",
+		Help: "Number of network namespace handles opened by the driver and not closed yet.",
+	}, func() float64 {
+		namespaces, _ := kndnet.OpenHandles()
+		return float64(namespaces)
+	})
+
+	netlinkSocketsOpen = prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "knd_netlink_sockets_open",
+		Help: "Number of netlink sockets opened by the driver and not closed yet.",
+	}, func() float64 {
+		_, sockets := kndnet.OpenHandles()
+		return float64(sockets)
+	})
+)
+
+func init() {
+	prometheus.MustRegister(devicesByState)
+	prometheus.MustRegister(allocatedDevices)
+	prometheus.MustRegister(publishedDevices)
+	prometheus.MustRegister(resourcePublishTotal)
+	prometheus.MustRegister(resourcePublishSkipped)
+	prometheus.MustRegister(deviceAttachTotal)
+	prometheus.MustRegister(deviceDetachTotal)
+	prometheus.MustRegister(deviceAttachErrors)
+	prometheus.MustRegister(deviceAttachDuration)
+	prometheus.MustRegister(deviceDetachDuration)
+	prometheus.MustRegister(podSandboxRunDuration)
+	prometheus.MustRegister(podClaimLookups)
+	prometheus.MustRegister(deviceThroughput)
+	prometheus.MustRegister(deviceUtilization)
+	prometheus.MustRegister(netnsOperationsQueued)
+	prometheus.MustRegister(netnsHandlesOpen)
+	prometheus.MustRegister(netlinkSocketsOpen)
+}
+
+// updateDeviceStateMetrics recomputes the number of devices in each state,
+// the devices allocated per pool and the bandwidth committed by them.
+// The caller must hold k.mu.
+func (k *NetworkDriver) updateDeviceStateMetrics() {
+	counts := map[DeviceState]int{
+		DeviceStatePrepared: 0,
+		DeviceStateAttached: 0,
+		DeviceStateDetached: 0,
+	}
+	// the child interfaces of several claims share their device
+	pools := map[string]sets.Set[string]{k.nodeName: sets.New[string]()}
+	for _, preparedData := range k.sharedState.PreparedData {
+		for _, device := range preparedData {
+			counts[device.State]++
+			if pools[device.PoolName] == nil {
+				pools[device.PoolName] = sets.New[string]()
+			}
+			pools[device.PoolName].Insert(device.DeviceName)
+		}
+	}
+	for state, count := range counts {
+		devicesByState.WithLabelValues(string(state)).Set(float64(count))
+	}
+	allocatedDevices.Reset()
+	for pool, devices := range pools {
+		allocatedDevices.WithLabelValues(pool).Set(float64(devices.Len()))
+	}
+	// the committed bandwidth changes with the same transitions
+	k.updateBandwidthMetrics()
+}
+
+// publishErrorReason classifies a resource publishing error.
+func publishErrorReason(err error) string {
+	if apierrors.IsTooManyRequests(err) {
+		return publishReasonThrottled
+	}
+	return publishReasonAPIError
+}
+
+// deviceMode returns how the device is delivered to the pod.
+func deviceMode(device PreparedDevice) string {
+	switch {
+	case device.Config.Child != nil:
+		return device.Config.Child.Type
+	case device.Config.Mode == AttachModeBridge:
+		return string(AttachModeBridge)
+	case device.InterfaceName != "":
+		return "vf"
+	}
+	return "move"
+}
+
+// operationResult is the result label of an attach or detach.
+func operationResult(err error) string {
+	if err != nil {
+		return "error"
+	}
+	return "success"
+}
+
+// attachErrorResult classifies the failure of an attach.
+func attachErrorResult(err error) string {
+	var nlErr *kndnet.NetlinkError
+	switch {
+	case errors.Is(err, kndnet.ErrLinkDown):
+		return "link-down"
+	case errors.Is(err, kndnet.ErrNamespaceGone):
+		return "namespace-gone"
+	case errors.Is(err, kndnet.ErrDeviceOwned):
+		return "device-owned"
+	case errors.As(err, &nlErr):
+		return "netlink"
+	}
+	return "error"
+}
+
+// observeAttach records the outcome and the time since start of an attach
+// of the device.
+func (k *NetworkDriver) observeAttach(device PreparedDevice, start time.Time, err error) {
+	result := operationResult(err)
+	deviceAttachTotal.WithLabelValues(k.driverName, result).Inc()
+	if err != nil {
+		deviceAttachErrors.WithLabelValues(k.driverName, attachErrorResult(err)).Inc()
+	}
+	deviceAttachDuration.WithLabelValues(k.driverName, deviceMode(device), result).Observe(time.Since(start).Seconds())
+}
+
+// observeRunPodSandbox records the outcome and the time since start of a
+// run of a pod sandbox.
+func (k *NetworkDriver) observeRunPodSandbox(start time.Time, err error) {
+	podSandboxRunDuration.WithLabelValues(k.driverName, operationResult(err)).Observe(time.Since(start).Seconds())
+}
+
+// observeDetach records the outcome and the time since start of a detach of
+// the device.
+func (k *NetworkDriver) observeDetach(device PreparedDevice, start time.Time, err error) {
+	result := operationResult(err)
+	deviceDetachTotal.WithLabelValues(k.driverName, result).Inc()
+	deviceDetachDuration.WithLabelValues(k.driverName, deviceMode(device), result).Observe(time.Since(start).Seconds())
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/containerd/nri/pkg/api"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"golang.org/x/sys/unix"
+	resourceapi "k8s.io/api/resource/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/dynamic-resource-allocation/kubeletplugin"
+	"k8s.io/dynamic-resource-allocation/resourceslice"
+
+	kndnet "github.com/aojea/kubernetes-network-drivers/pkg/net"
+)
+
+func Test_deviceStateMetrics(t *testing.T) {
+	k := NewNetworkDriver(driverName, "node1", fake.NewClientset())
+	k.checkpointPath = ""
+
+	claim := newClaimWithConfig()
+	claim.Name = "claim"
+	claim.UID = "claim-uid"
+	claim.Status.Allocation.Devices.Results[0].Pool = "node1"
+	allocatedDevices.Reset()
+	results, err := k.PrepareResourceClaims(context.Background(), []*resourceapi.ResourceClaim{claim})
+	if err != nil || results[claim.UID].Err != nil {
+		t.Fatalf("unexpected error preparing claim: %v %v", err, results[claim.UID].Err)
+	}
+
+	assertStates := func(prepared, attached, detached float64) {
+		t.Helper()
+		for state, want := range map[DeviceState]float64{
+			DeviceStatePrepared: prepared,
+			DeviceStateAttached: attached,
+			DeviceStateDetached: detached,
+		} {
+			if got := testutil.ToFloat64(devicesByState.WithLabelValues(string(state))); got != want {
+				t.Errorf("expected %v devices in state %s, got %v", want, state, got)
+			}
+		}
+	}
+	assertStates(1, 0, 0)
+
+	k.mu.Lock()
+	k.setDeviceState(claim.UID, DeviceStateAttached)
+	k.mu.Unlock()
+	assertStates(0, 1, 0)
+
+	k.mu.Lock()
+	k.setDeviceState(claim.UID, DeviceStateDetached)
+	k.mu.Unlock()
+	assertStates(0, 0, 1)
+	// the device is allocated to the claim until it is unprepared
+	if got := testutil.ToFloat64(allocatedDevices.WithLabelValues("node1")); got != 1 {
+		t.Errorf("expected 1 allocated device, got %v", got)
+	}
+
+	if _, err := k.UnprepareResourceClaims(context.Background(), []kubeletplugin.NamespacedObject{{UID: claim.UID}}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	assertStates(0, 0, 0)
+	if got := testutil.ToFloat64(allocatedDevices.WithLabelValues("node1")); got != 0 {
+		t.Errorf("expected no allocated devices, got %v", got)
+	}
+}
+
+type fakePublisher struct {
+	err error
+}
+
+func (f *fakePublisher) PublishResources(ctx context.Context, resources resourceslice.DriverResources) error {
+	return f.err
+}
+
+func Test_resourcePublishMetrics(t *testing.T) {
+	resourcePublishTotal.Reset()
+	skipped := testutil.ToFloat64(resourcePublishSkipped)
+	publisher := &fakePublisher{}
+	k := NewNetworkDriver(driverName, "node1", fake.NewClientset())
+	k.publisher = publisher
+
+	assertReasons := func(published, unchanged, apiError, throttled float64) {
+		t.Helper()
+		for reason, want := range map[string]float64{
+			publishReasonPublished: published,
+			publishReasonUnchanged: unchanged,
+			publishReasonAPIError:  apiError,
+			publishReasonThrottled: throttled,
+		} {
+			if got := testutil.ToFloat64(resourcePublishTotal.WithLabelValues(reason)); got != want {
+				t.Errorf("expected %v publications with reason %s, got %v", want, reason, got)
+			}
+		}
+	}
+
+	k.publishOnce(context.Background())
+	assertReasons(1, 0, 0, 0)
+	if got, want := testutil.ToFloat64(publishedDevices.WithLabelValues("node1")), float64(len(k.lastDevices)); got != want {
+		t.Errorf("expected %v published devices, got %v", want, got)
+	}
+
+	// the unchanged devices are not published again until the max interval
+	k.publishOnce(context.Background())
+	assertReasons(1, 0, 0, 0)
+	if got := testutil.ToFloat64(resourcePublishSkipped) - skipped; got != 1 {
+		t.Errorf("expected 1 skipped publication, got %v", got)
+	}
+	stale := time.Now().Add(-k.forcePublishAfter)
+	k.publishStatus.LastPublished = &stale
+	k.publishOnce(context.Background())
+	assertReasons(1, 1, 0, 0)
+
+	publisher.err = errors.New("publisher stopped")
+	k.publishStatus.LastPublished = &stale
+	k.publishOnce(context.Background())
+	assertReasons(1, 1, 1, 0)
+
+	// errors from the ResourceSlice controller are reported asynchronously
+	throttled := apierrors.NewTooManyRequests("slow down", 1)
+	k.HandleError(context.Background(), fmt.Errorf("%w: %w", kubeletplugin.ErrRecoverable, throttled), "update ResourceSlice")
+	assertReasons(1, 1, 1, 1)
+
+	k.HandleError(context.Background(), fmt.Errorf("%w: %w", kubeletplugin.ErrRecoverable, apierrors.NewInternalError(errors.New("boom"))), "update ResourceSlice")
+	assertReasons(1, 1, 2, 1)
+}
+
+func Test_deviceOperationMetrics(t *testing.T) {
+	for _, vec := range []interface{ Reset() }{deviceAttachTotal, deviceDetachTotal, deviceAttachErrors, deviceAttachDuration, deviceDetachDuration} {
+		vec.Reset()
+	}
+	registry := prometheus.NewPedanticRegistry()
+	registry.MustRegister(deviceAttachDuration, deviceDetachDuration)
+
+	k := NewNetworkDriver(driverName, "node1", fake.NewClientset())
+	k.namespaceRetries = 0
+	pod := &api.PodSandbox{Namespace: "ns", Name: "pod", Uid: "pod-uid"}
+	// a file that is not a namespace, the detach from a namespace that is
+	// gone succeeds
+	netns := filepath.Join(t.TempDir(), "netns")
+	if err := os.WriteFile(netns, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	devices := []PreparedDevice{
+		{DeviceName: "knd-missing0"},
+		{DeviceName: "knd-missing1", InterfaceName: "knd-missing1v0"},
+		{DeviceName: "knd-missing2", Config: DeviceConfig{Child: &ChildConfig{Type: "macvlan"}}},
+		{DeviceName: "knd-missing3", Config: DeviceConfig{Child: &ChildConfig{Type: "ipvlan"}}},
+	}
+	for _, device := range devices {
+		allocated := AllocatedDevice{Name: device.DeviceName}
+		if err := k.configureDeviceForPod(allocated, netns, pod, device); err == nil {
+			t.Errorf("expected error attaching missing device %s", device.DeviceName)
+		}
+		if err := k.cleanupDeviceForPod(allocated, netns, pod, device); err == nil {
+			t.Errorf("expected error detaching missing device %s", device.DeviceName)
+		}
+	}
+
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("unexpected error gathering metrics: %v", err)
+	}
+	want := map[string]uint64{}
+	for _, mode := range []string{"move", "vf", "macvlan", "ipvlan"} {
+		want[driverName+"/"+mode+"/error"] = 1
+	}
+	for _, family := range families {
+		got := map[string]uint64{}
+		for _, metric := range family.GetMetric() {
+			labels := map[string]string{}
+			for _, label := range metric.GetLabel() {
+				labels[label.GetName()] = label.GetValue()
+			}
+			got[labels["driver"]+"/"+labels["mode"]+"/"+labels["result"]] = metric.GetHistogram().GetSampleCount()
+		}
+		if fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("%s: expected observations %v, got %v", family.GetName(), want, got)
+		}
+	}
+	if len(families) != 2 {
+		t.Errorf("expected the attach and detach histograms, got %d families", len(families))
+	}
+
+	for name, counter := range map[string]prometheus.Counter{
+		"attach error":   deviceAttachTotal.WithLabelValues(driverName, "error"),
+		"attach success": deviceAttachTotal.WithLabelValues(driverName, "success"),
+		"detach error":   deviceDetachTotal.WithLabelValues(driverName, "error"),
+	} {
+		want := float64(len(devices))
+		if name == "attach success" {
+			want = 0
+		}
+		if got := testutil.ToFloat64(counter); got != want {
+			t.Errorf("%s: expected %v, got %v", name, want, got)
+		}
+	}
+	// every failed attach is counted once with the kind of its failure
+	errorCount := 0.0
+	for _, result := range []string{"link-down", "namespace-gone", "device-owned", "netlink", "error"} {
+		errorCount += testutil.ToFloat64(deviceAttachErrors.WithLabelValues(driverName, result))
+	}
+	if errorCount != float64(len(devices)) {
+		t.Errorf("expected %d attach errors, got %v", len(devices), errorCount)
+	}
+}
+
+func Test_attachErrorResult(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{err: fmt.Errorf("%w: failed to set eth1 up", kndnet.ErrLinkDown), want: "link-down"},
+		{err: fmt.Errorf("attach eth1: %w", kndnet.ErrNamespaceGone), want: "namespace-gone"},
+		{err: fmt.Errorf("attach eth1: %w", kndnet.ErrDeviceOwned), want: "device-owned"},
+		{err: fmt.Errorf("attach eth1: %w", &kndnet.NetlinkError{Errno: unix.EBUSY, Err: unix.EBUSY}), want: "netlink"},
+		{err: errors.New("no prepared data"), want: "error"},
+	}
+	for _, tt := range tests {
+		if got := attachErrorResult(tt.err); got != tt.want {
+			t.Errorf("%v: expected %s, got %s", tt.err, tt.want, got)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	resourceapi "k8s.io/api/resource/v1"
+	"k8s.io/klog/v2"
+)
+
+// mtuClampedReason is the reason of the events of the claims whose devices
+// MTU was clamped.
+const mtuClampedReason = "MTUClamped"
+
+// addMTUAttributes publishes the max-mtu of the host interface ifName, so
+// claims that need jumbo frames only select the devices that support them.
+func (k *NetworkDriver) addMTUAttributes(device *resourceapi.Device, ifName string) {
+	maxMTU, err := k.host.linkMaxMTU(ifName)
+	if err != nil {
+		klog.V(2).Infof("failed to get the maximum MTU of %s: %v", ifName, err)
+		return
+	}
+	value := int64(maxMTU)
+	device.Attributes["max-mtu"] = resourceapi.DeviceAttribute{IntValue: &value}
+}
+
+// checkMTU returns an error if the host interface ifName does not support mtu.
+func (k *NetworkDriver) checkMTU(ifName string, mtu int) error {
+	maxMTU, err := k.host.linkMaxMTU(ifName)
+	if err != nil {
+		return err
+	}
+	if mtu > maxMTU {
+		return fmt.Errorf("mtu %d is above the maximum mtu %d of device %s", mtu, maxMTU, ifName)
+	}
+	return nil
+}
+
+// clampMTUs sets the MTU of the devices of a claim with clampMTU to the
+// lowest of their MTUs, the configured one or the current one of the host
+// interface, so the traffic between them is not black-holed. It returns the
+// clamped MTU, 0 if none of the devices is clamped.
+func (k *NetworkDriver) clampMTUs(devices []PreparedDevice) (int, error) {
+	lowest := 0
+	for _, device := range devices {
+		if !device.Config.ClampMTU {
+			continue
+		}
+		mtu := device.Config.MTU
+		if mtu == 0 {
+			var err error
+			mtu, err = k.host.linkMTU(device.hostInterface())
+			if err != nil {
+				return 0, fmt.Errorf("failed to get the mtu of device %s to clamp it: %w", device.DeviceName, err)
+			}
+		}
+		if lowest == 0 || mtu < lowest {
+			lowest = mtu
+		}
+	}
+	for i := range devices {
+		if devices[i].Config.ClampMTU {
+			devices[i].Config.MTU = lowest
+		}
+	}
+	return lowest, nil
+}
+
+// recordMTUClamped emits an event on the claim with the MTU its devices were clamped to.
+func (k *NetworkDriver) recordMTUClamped(claim *resourceapi.ResourceClaim, devices []PreparedDevice, mtu int) {
+	var names []string
+	for _, device := range devices {
+		if device.Config.ClampMTU {
+			names = append(names, device.DeviceName)
+		}
+	}
+	klog.Infof("Clamping the mtu of devices %v of claim %s/%s to %d", names, claim.Namespace, claim.Name, mtu)
+	if k.eventRecorder == nil {
+		return
+	}
+	k.eventRecorder.Eventf(claim, v1.EventTypeNormal, mtuClampedReason, "Node %s: mtu of devices %s clamped to %d", k.nodeName, strings.Join(names, ", "), mtu)
+}
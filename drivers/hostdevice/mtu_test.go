@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/vishvananda/netlink"
+	resourceapi "k8s.io/api/resource/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+
+	kndnet "github.com/aojea/kubernetes-network-drivers/pkg/net"
+)
+
+func fakeLinkMaxMTU(k *NetworkDriver, maxMTUs map[string]int) {
+	k.host.linkMaxMTU = func(ifName string) (int, error) {
+		maxMTU, ok := maxMTUs[ifName]
+		if !ok {
+			return 0, errors.New("no such interface")
+		}
+		return maxMTU, nil
+	}
+}
+
+func Test_addMTUAttributes(t *testing.T) {
+	k := NewNetworkDriver(driverName, "node1", fake.NewClientset())
+	fakeLinkMaxMTU(k, map[string]int{"eth0": 9216})
+
+	device := resourceapi.Device{Name: "eth0", Attributes: map[resourceapi.QualifiedName]resourceapi.DeviceAttribute{}}
+	k.addMTUAttributes(&device, "eth0")
+	if v := device.Attributes["max-mtu"].IntValue; v == nil || *v != 9216 {
+		t.Errorf("unexpected max-mtu %v", device.Attributes["max-mtu"])
+	}
+
+	device = resourceapi.Device{Name: "eth1", Attributes: map[resourceapi.QualifiedName]resourceapi.DeviceAttribute{}}
+	k.addMTUAttributes(&device, "eth1")
+	if _, ok := device.Attributes["max-mtu"]; ok {
+		t.Errorf("unexpected max-mtu for a device without maximum")
+	}
+}
+
+func Test_PrepareResourceClaims_mtu(t *testing.T) {
+	tests := []struct {
+		name    string
+		device  string
+		mtu     string
+		wantErr string
+	}{
+		{name: "jumbo capable", device: "eth1", mtu: `{"mtu":9000}`},
+		{name: "not jumbo capable", device: "eth2", mtu: `{"mtu":9000}`, wantErr: "mtu 9000 is above the maximum mtu 1500 of device eth2"},
+		{name: "unknown maximum", device: "eth3", mtu: `{"mtu":9000}`, wantErr: "no such interface"},
+		{name: "no mtu", device: "eth3", mtu: `{}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k := NewNetworkDriver(driverName, "node1", fake.NewClientset())
+			fakeLinkMaxMTU(k, map[string]int{"eth1": 9216, "eth2": 1500})
+			k.checkpointPath = ""
+			claim := newClaimWithConfig(opaqueConfig(driverName, nil, tt.mtu))
+			claim.Name = "claim"
+			claim.UID = "claim-uid"
+			claim.Status.Allocation.Devices.Results[0].Device = tt.device
+
+			results, err := k.PrepareResourceClaims(context.Background(), []*resourceapi.ResourceClaim{claim})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			err = results[claim.UID].Err
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected error %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func Test_PrepareResourceClaims_clampMTU(t *testing.T) {
+	k := NewNetworkDriver(driverName, "node1", fake.NewClientset())
+	fakeLinkMaxMTU(k, map[string]int{"eth1": 9216, "eth2": 9216, "eth3": 1500, "eth4": 9216})
+	k.host.linkMTU = func(ifName string) (int, error) {
+		return map[string]int{"eth1": 9000, "eth2": 9000, "eth3": 1500, "eth4": 9000}[ifName], nil
+	}
+
+	k.checkpointPath = ""
+	recorder := record.NewFakeRecorder(10)
+	k.eventRecorder = recorder
+	// eth2 is configured with 8000, eth3 has 1500 and eth4 is not clamped
+	claim := newClaimWithDevices("claim", "eth1", "eth2", "eth3", "eth4")
+	claim.Status.Allocation.Devices.Results[1].Request = "jumbo"
+	claim.Status.Allocation.Devices.Results[3].Request = "other"
+	claim.Status.Allocation.Devices.Config = []resourceapi.DeviceAllocationConfiguration{
+		opaqueConfig(driverName, []string{"nic"}, `{"clampMTU":true}`),
+		opaqueConfig(driverName, []string{"jumbo"}, `{"clampMTU":true,"mtu":8000}`),
+	}
+
+	results, err := k.PrepareResourceClaims(context.Background(), []*resourceapi.ResourceClaim{claim})
+	if err != nil || results[claim.UID].Err != nil {
+		t.Fatalf("unexpected error: %v %v", err, results[claim.UID].Err)
+	}
+	want := map[string]int{"eth1": 1500, "eth2": 1500, "eth3": 1500, "eth4": 0}
+	for _, device := range k.sharedState.PreparedData[claim.UID] {
+		if device.Config.MTU != want[device.DeviceName] {
+			t.Errorf("expected mtu %d on device %s, got %d", want[device.DeviceName], device.DeviceName, device.Config.MTU)
+		}
+	}
+	select {
+	case event := <-recorder.Events:
+		if want := "Normal MTUClamped Node node1: mtu of devices eth1, eth2, eth3 clamped to 1500"; event != want {
+			t.Errorf("expected event %q, got %q", want, event)
+		}
+	default:
+		t.Errorf("expected an event for the clamped mtu")
+	}
+}
+
+func Test_configureDeviceForPod_mtu(t *testing.T) {
+	var got netlink.LinkAttrs
+	k := NewNetworkDriver(driverName, "node1", fake.NewClientset())
+	k.host.attachNetdev = func(hostIfName string, containerNsPath string, newAttr netlink.LinkAttrs, addresses []*net.IPNet, opts ...kndnet.AttachOption) (*resourceapi.NetworkDeviceData, error) {
+		got = newAttr
+		return nil, nil
+	}
+
+	device := PreparedDevice{DeviceName: "eth1", Config: DeviceConfig{MTU: 9000}}
+	if err := k.configureDeviceForPod(AllocatedDevice{Name: "eth1"}, "/run/netns/pod", newTestSandbox("/run/netns/pod"), device); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got.Name != "eth1" || got.MTU != 9000 {
+		t.Errorf("expected eth1 to be moved with mtu 9000, got %s with mtu %d", got.Name, got.MTU)
+	}
+}
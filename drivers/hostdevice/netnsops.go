@@ -0,0 +1,30 @@
+package main
+
+// netnsLimiter bounds how many devices are attached to or detached from
+// pods at the same time across all the pods, so a burst of pod churn on a
+// dense node queues on the driver instead of piling up on the netlink
+// subsystem. A nil limiter does not limit them.
+type netnsLimiter struct {
+	slots chan struct{}
+}
+
+// newNetnsLimiter returns a limiter running up to limit operations at the
+// same time, nil if limit is 0 or lower.
+func newNetnsLimiter(limit int) *netnsLimiter {
+	if limit <= 0 {
+		return nil
+	}
+	return &netnsLimiter{slots: make(chan struct{}, limit)}
+}
+
+// acquire waits for a free slot and returns the function releasing it. The
+// caller must not hold k.mu, an operation holding a slot may take it.
+func (l *netnsLimiter) acquire() func() {
+	if l == nil {
+		return func() {}
+	}
+	netnsOperationsQueued.Inc()
+	l.slots <- struct{}{}
+	netnsOperationsQueued.Dec()
+	return func() { <-l.slots }
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/containerd/nri/pkg/api"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/vishvananda/netlink"
+	resourceapi "k8s.io/api/resource/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+
+	kndnet "github.com/aojea/kubernetes-network-drivers/pkg/net"
+)
+
+func Test_netnsLimiter(t *testing.T) {
+	const limit, pods = 2, 6
+	var mu sync.Mutex
+	running, maxRunning := 0, 0
+	track := func() {
+		mu.Lock()
+		running++
+		maxRunning = max(maxRunning, running)
+		mu.Unlock()
+		time.Sleep(20 * time.Millisecond)
+		mu.Lock()
+		running--
+		mu.Unlock()
+	}
+	k := NewNetworkDriver(driverName, "node1", fake.NewClientset())
+	k.host.attachNetdev = func(hostIfName string, containerNsPath string, newAttr netlink.LinkAttrs, addresses []*net.IPNet, opts ...kndnet.AttachOption) (*resourceapi.NetworkDeviceData, error) {
+		track()
+		return nil, nil
+	}
+	k.host.detachNetdev = func(containerNsPath string, devName string, outName string, opts ...kndnet.DetachOption) error {
+		track()
+		return nil
+	}
+
+	k.checkpointPath = ""
+	k.netnsOps = newNetnsLimiter(limit)
+	var sandboxes []*api.PodSandbox
+	for i := range pods {
+		pod := newTestSandbox(fmt.Sprintf("/run/netns/pod%d", i))
+		pod.Uid = fmt.Sprintf("pod%d-uid", i)
+		pod.Name = fmt.Sprintf("pod%d", i)
+		device := fmt.Sprintf("eth%d", i)
+		k.sharedState.PodDeviceConfig[types.UID(pod.Uid)] = []AllocatedDevice{{Name: device}}
+		k.sharedState.PreparedData[types.UID(pod.Uid)] = []PreparedDevice{{DeviceName: device}}
+		sandboxes = append(sandboxes, pod)
+	}
+
+	for _, hook := range []func(context.Context, *api.PodSandbox) error{k.RunPodSandbox, k.StopPodSandbox} {
+		maxRunning = 0
+		var wg sync.WaitGroup
+		errs := make(chan error, pods)
+		for _, pod := range sandboxes {
+			wg.Go(func() { errs <- hook(context.Background(), pod) })
+		}
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			// the operations beyond the limit wait instead of failing
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		}
+		if maxRunning != limit {
+			t.Errorf("expected %d operations running at the same time, got %d", limit, maxRunning)
+		}
+	}
+	if got := testutil.ToFloat64(netnsOperationsQueued); got != 0 {
+		t.Errorf("expected no operations queued, got %v", got)
+	}
+}
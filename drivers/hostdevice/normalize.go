@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+
+	resourceapi "k8s.io/api/resource/v1"
+	"k8s.io/klog/v2"
+)
+
+// rawAttributeSuffix is appended to the name of the attributes whose
+// published value was normalized, to keep the value reported by the system.
+const rawAttributeSuffix = "-raw"
+
+// pciAddressRegexp matches a PCI address with an optional domain, e.g.
+// 0000:3b:00.1 or 3b:00.1, in any case.
+var pciAddressRegexp = regexp.MustCompile(`^(?:([0-9a-fA-F]{1,8}):)?([0-9a-fA-F]{1,2}):([0-9a-fA-F]{1,2})\.([0-7])$`)
+
+// attributeNormalizers are the attributes published in a canonical form, so
+// CEL selectors compare them with a plain string equality.
+var attributeNormalizers = map[resourceapi.QualifiedName]func(string) (string, error){
+	"mac-address": normalizeMAC,
+	"pci-address": normalizePCIAddress,
+}
+
+// normalizeMAC returns the MAC address in lowercase colon separated form,
+// e.g. 0a:1b:2c:3d:4e:5f, from any of the forms accepted by net.ParseMAC.
+func normalizeMAC(value string) (string, error) {
+	mac, err := net.ParseMAC(strings.TrimSpace(value))
+	if err != nil {
+		return "", err
+	}
+	return mac.String(), nil
+}
+
+// normalizePCIAddress returns the PCI address in the lowercase form used by
+// sysfs, domain:bus:device.function with a 4 digit domain, e.g. 0000:3b:00.1.
+// Addresses without domain are in domain 0. Domains wider than 16 bits, like
+// the ones of the Intel VMD controllers, keep their digits.
+func normalizePCIAddress(value string) (string, error) {
+	m := pciAddressRegexp.FindStringSubmatch(strings.TrimSpace(value))
+	if m == nil {
+		return "", fmt.Errorf("invalid PCI address %q", value)
+	}
+	domain := uint64(0)
+	if m[1] != "" {
+		domain, _ = strconv.ParseUint(m[1], 16, 32)
+	}
+	bus, _ := strconv.ParseUint(m[2], 16, 8)
+	device, _ := strconv.ParseUint(m[3], 16, 8)
+	if device > 0x1f {
+		return "", fmt.Errorf("invalid PCI address %q, device %#x is greater than 0x1f", value, device)
+	}
+	return fmt.Sprintf("%04x:%02x:%02x.%s", domain, bus, device, m[4]), nil
+}
+
+// addPCIAttributes publishes the PCI address, the vendor and device ids, the
+// kernel driver and the NUMA node of the device backing the host interface
+// ifName, interfaces not backed by a PCI device are not modified.
+func (k *NetworkDriver) addPCIAttributes(device *resourceapi.Device, ifName string) {
+	address, err := k.host.pciAddress(ifName)
+	if err != nil {
+		return
+	}
+	if !pciAddressRegexp.MatchString(address) {
+		klog.V(4).Infof("Interface %s is backed by the non PCI device %s", ifName, address)
+		return
+	}
+	device.Attributes["pci-address"] = resourceapi.DeviceAttribute{StringValue: &address}
+	if vendor, err := k.host.pciVendorID(ifName); err == nil {
+		device.Attributes["pci-vendor-id"] = resourceapi.DeviceAttribute{StringValue: &vendor}
+	}
+	if id, err := k.host.pciDeviceID(ifName); err == nil {
+		device.Attributes["pci-device-id"] = resourceapi.DeviceAttribute{StringValue: &id}
+	}
+	if driver, err := k.host.kernelDriver(ifName); err == nil {
+		device.Attributes["kernel-driver"] = resourceapi.DeviceAttribute{StringValue: &driver}
+	}
+	// -1 on platforms without NUMA information
+	if node, err := k.host.numaNode(ifName); err == nil && node >= 0 {
+		numa := int64(node)
+		device.Attributes["numa-node"] = resourceapi.DeviceAttribute{IntValue: &numa}
+	}
+}
+
+// normalizeAttributes rewrites the attributes with a canonical form. If the
+// value changes the original value is kept in the attribute with the raw
+// suffix, values that cannot be normalized are published as they are.
+func normalizeAttributes(device *resourceapi.Device) {
+	for name, normalize := range attributeNormalizers {
+		attribute, ok := device.Attributes[name]
+		if !ok || attribute.StringValue == nil {
+			continue
+		}
+		raw := *attribute.StringValue
+		normalized, err := normalize(raw)
+		if err != nil {
+			klog.V(2).Infof("Publishing attribute %s of device %s as is: %v", name, device.Name, err)
+			continue
+		}
+		if normalized == raw {
+			continue
+		}
+		device.Attributes[name] = resourceapi.DeviceAttribute{StringValue: &normalized}
+		device.Attributes[name+rawAttributeSuffix] = resourceapi.DeviceAttribute{StringValue: &raw}
+	}
+}
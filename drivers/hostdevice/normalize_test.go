@@ -0,0 +1,170 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	resourceapi "k8s.io/api/resource/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func Test_normalizeMAC(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{value: "0a:1b:2c:3d:4e:5f", want: "0a:1b:2c:3d:4e:5f"},
+		{value: "0A:1B:2C:3D:4E:5F", want: "0a:1b:2c:3d:4e:5f"},
+		{value: "0A-1B-2C-3D-4E-5F", want: "0a:1b:2c:3d:4e:5f"},
+		{value: "0a1b.2c3d.4e5f", want: "0a:1b:2c:3d:4e:5f"},
+		{value: " 0a:1b:2c:3d:4e:5f\n", want: "0a:1b:2c:3d:4e:5f"},
+		{value: "00:00:00:00:fe:80:00:00:00:00:00:00:02:00:5E:10:00:00:00:01", want: "00:00:00:00:fe:80:00:00:00:00:00:00:02:00:5e:10:00:00:00:01"},
+		{value: "0a:1b:2c:3d:4e", wantErr: true},
+		{value: "a:b:c:d:e:f", wantErr: true},
+		{value: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := normalizeMAC(tt.value)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("normalizeMAC(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("normalizeMAC(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
+
+func Test_normalizePCIAddress(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{value: "0000:3b:00.1", want: "0000:3b:00.1"},
+		{value: "0000:3B:00.1", want: "0000:3b:00.1"},
+		{value: "3b:00.1", want: "0000:3b:00.1"},
+		{value: "0:3b:0.1", want: "0000:3b:00.1"},
+		{value: "1:0:1f.7", want: "0001:00:1f.7"},
+		{value: "10000:e1:00.0", want: "10000:e1:00.0"},
+		{value: "0000:3b:20.0", wantErr: true},
+		{value: "0000:3b:00.8", wantErr: true},
+		{value: "0000:3b:00", wantErr: true},
+		{value: "0000:13b:00.0", wantErr: true},
+		{value: "virtio0", wantErr: true},
+		{value: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := normalizePCIAddress(tt.value)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("normalizePCIAddress(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("normalizePCIAddress(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
+
+func Test_normalizeAttributes(t *testing.T) {
+	str := func(s string) *string { return &s }
+	device := resourceapi.Device{
+		Name: "eth1",
+		Attributes: map[resourceapi.QualifiedName]resourceapi.DeviceAttribute{
+			"interface-name": {StringValue: str("ETH1")},
+			"mac-address":    {StringValue: str("0A:1B:2C:3D:4E:5F")},
+			"pci-address":    {StringValue: str("0000:3b:00.1")},
+		},
+	}
+	normalizeAttributes(&device)
+	want := map[resourceapi.QualifiedName]string{
+		// interface names are case sensitive
+		"interface-name":  "ETH1",
+		"mac-address":     "0a:1b:2c:3d:4e:5f",
+		"mac-address-raw": "0A:1B:2C:3D:4E:5F",
+		"pci-address":     "0000:3b:00.1",
+	}
+	if len(device.Attributes) != len(want) {
+		t.Errorf("got attributes %v, want %v", device.Attributes, want)
+	}
+	for name, value := range want {
+		if got := device.Attributes[name].StringValue; got == nil || *got != value {
+			t.Errorf("attribute %s = %v, want %s", name, got, value)
+		}
+	}
+
+	// invalid values are published as they are
+	device = resourceapi.Device{
+		Name:       "ib0",
+		Attributes: map[resourceapi.QualifiedName]resourceapi.DeviceAttribute{"mac-address": {StringValue: str("")}},
+	}
+	normalizeAttributes(&device)
+	if len(device.Attributes) != 1 || *device.Attributes["mac-address"].StringValue != "" {
+		t.Errorf("unexpected attributes %v", device.Attributes)
+	}
+}
+
+func Test_addPCIAttributes(t *testing.T) {
+	k := NewNetworkDriver(driverName, "node1", fake.NewClientset())
+	k.host.pciAddress = func(ifName string) (string, error) {
+		switch ifName {
+		case "eth0", "eth1":
+			return "0000:3b:00." + ifName[3:], nil
+		case "vmbus0":
+			return "6045bd7b-3b7a-4a2e-a1f0-6a2b8d1c6e0f", nil
+		}
+		return "", errors.New("not backed by a device")
+	}
+	k.host.pciVendorID = func(ifName string) (string, error) { return "15b3", nil }
+	k.host.pciDeviceID = func(ifName string) (string, error) {
+		if ifName == "eth1" {
+			return "", errors.New("no device id")
+		}
+		return "101d", nil
+	}
+	k.host.kernelDriver = func(ifName string) (string, error) { return "mlx5_core", nil }
+	k.host.numaNode = func(ifName string) (int, error) {
+		if ifName == "eth1" {
+			return -1, nil
+		}
+		return 1, nil
+	}
+	str := func(s string) *string { return &s }
+	node := int64(1)
+
+	tests := []struct {
+		ifName string
+		want   map[resourceapi.QualifiedName]resourceapi.DeviceAttribute
+	}{
+		{
+			ifName: "eth0",
+			want: map[resourceapi.QualifiedName]resourceapi.DeviceAttribute{
+				"pci-address":   {StringValue: str("0000:3b:00.0")},
+				"pci-vendor-id": {StringValue: str("15b3")},
+				"pci-device-id": {StringValue: str("101d")},
+				"kernel-driver": {StringValue: str("mlx5_core")},
+				"numa-node":     {IntValue: &node},
+			},
+		},
+		{
+			// the platform does not report the NUMA node
+			ifName: "eth1",
+			want: map[resourceapi.QualifiedName]resourceapi.DeviceAttribute{
+				"pci-address":   {StringValue: str("0000:3b:00.1")},
+				"pci-vendor-id": {StringValue: str("15b3")},
+				"kernel-driver": {StringValue: str("mlx5_core")},
+			},
+		},
+		{ifName: "vmbus0", want: map[resourceapi.QualifiedName]resourceapi.DeviceAttribute{}},
+		{ifName: "dummy0", want: map[resourceapi.QualifiedName]resourceapi.DeviceAttribute{}},
+	}
+	for _, tt := range tests {
+		device := resourceapi.Device{Name: tt.ifName, Attributes: map[resourceapi.QualifiedName]resourceapi.DeviceAttribute{}}
+		k.addPCIAttributes(&device, tt.ifName)
+		if !reflect.DeepEqual(device.Attributes, tt.want) {
+			t.Errorf("addPCIAttributes(%s) = %v, want %v", tt.ifName, device.Attributes, tt.want)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+
+	v1 "k8s.io/api/core/v1"
+	resourceapi "k8s.io/api/resource/v1"
+	"k8s.io/klog/v2"
+)
+
+// numaMisalignedReason is the reason of the events of the claims prepared
+// with a device on another NUMA node than the requested one.
+const numaMisalignedReason = "NUMAMisaligned"
+
+// NUMAPolicy defines how strictly the device must be on the requested NUMA node.
+type NUMAPolicy string
+
+const (
+	// NUMAPolicyStrict refuses to prepare a device on another NUMA node.
+	NUMAPolicyStrict NUMAPolicy = "strict"
+	// NUMAPolicyPreferred prepares a device on another NUMA node and emits
+	// an event on the claim about the suboptimal placement.
+	NUMAPolicyPreferred NUMAPolicy = "preferred"
+)
+
+// NUMAConfig is the NUMA node the device should be on, the one of the CPUs
+// of the workload.
+type NUMAConfig struct {
+	// Node is the NUMA node of the device.
+	Node int `json:"node"`
+	// Policy is strict or preferred, preferred by default.
+	Policy NUMAPolicy `json:"policy,omitempty"`
+}
+
+func (c NUMAConfig) validate() error {
+	if c.Node < 0 {
+		return fmt.Errorf("invalid node %d, must not be negative", c.Node)
+	}
+	switch c.Policy {
+	case "", NUMAPolicyStrict, NUMAPolicyPreferred:
+		return nil
+	}
+	return fmt.Errorf("invalid policy %q, must be %s or %s", c.Policy, NUMAPolicyStrict, NUMAPolicyPreferred)
+}
+
+// checkNUMA returns the NUMA node of the host interface ifName, -1 if it is
+// unknown, and an error if it is not the configured one and the policy is
+// strict.
+func (k *NetworkDriver) checkNUMA(ifName string, config NUMAConfig) (int, error) {
+	node, err := k.host.numaNode(ifName)
+	if err != nil {
+		klog.V(2).Infof("failed to get the numa node of %s: %v", ifName, err)
+		node = -1
+	}
+	if node == config.Node || config.Policy != NUMAPolicyStrict {
+		return node, nil
+	}
+	if node < 0 {
+		return node, fmt.Errorf("numa node of device %s is unknown, numa node %d is required", ifName, config.Node)
+	}
+	return node, fmt.Errorf("device %s is on numa node %d, numa node %d is required", ifName, node, config.Node)
+}
+
+// numaPlacement is a device prepared on another NUMA node than the requested one.
+type numaPlacement struct {
+	device  string
+	request string
+	node    int
+	want    int
+}
+
+// recordNUMAMisaligned emits an event on the claim for each device prepared
+// on another NUMA node with the preferred policy.
+func (k *NetworkDriver) recordNUMAMisaligned(claim *resourceapi.ResourceClaim, placements []numaPlacement) {
+	for _, p := range placements {
+		node := fmt.Sprint(p.node)
+		if p.node < 0 {
+			node = "unknown"
+		}
+		klog.Warningf("Device %s of claim %s/%s request %s is on numa node %s instead of %d", p.device, claim.Namespace, claim.Name, p.request, node, p.want)
+		if k.eventRecorder == nil {
+			continue
+		}
+		k.eventRecorder.Eventf(claim, v1.EventTypeWarning, numaMisalignedReason,
+			"Node %s: device %s of request %s is on numa node %s instead of %d", k.nodeName, p.device, p.request, node, p.want)
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	resourceapi "k8s.io/api/resource/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+)
+
+func Test_PrepareResourceClaims_numa(t *testing.T) {
+	tests := []struct {
+		name         string
+		device       string
+		config       string
+		wantErr      string
+		wantEvent    string
+		wantPrepared bool
+	}{
+		{
+			name:         "strict aligned",
+			device:       "eth1",
+			config:       `{"numa":{"node":0,"policy":"strict"}}`,
+			wantPrepared: true,
+		},
+		{
+			name:      "strict on another node",
+			device:    "eth2",
+			config:    `{"numa":{"node":0,"policy":"strict"}}`,
+			wantErr:   "device eth2 is on numa node 1, numa node 0 is required",
+			wantEvent: "Warning DevicePrepareFailed Node node1: device eth2: device eth2 is on numa node 1, numa node 0 is required, the claim is not prepared",
+		},
+		{
+			name:      "strict with an unknown node",
+			device:    "eth3",
+			config:    `{"numa":{"node":0,"policy":"strict"}}`,
+			wantErr:   "numa node of device eth3 is unknown",
+			wantEvent: "Warning DevicePrepareFailed Node node1: device eth3: numa node of device eth3 is unknown, numa node 0 is required, the claim is not prepared",
+		},
+		{
+			name:         "preferred aligned",
+			device:       "eth2",
+			config:       `{"numa":{"node":1,"policy":"preferred"}}`,
+			wantPrepared: true,
+		},
+		{
+			name:         "preferred on another node",
+			device:       "eth2",
+			config:       `{"numa":{"node":0}}`,
+			wantEvent:    "Warning NUMAMisaligned Node node1: device eth2 of request nic is on numa node 1 instead of 0",
+			wantPrepared: true,
+		},
+		{
+			name:         "preferred with an unknown node",
+			device:       "eth3",
+			config:       `{"numa":{"node":0,"policy":"preferred"}}`,
+			wantEvent:    "Warning NUMAMisaligned Node node1: device eth3 of request nic is on numa node unknown instead of 0",
+			wantPrepared: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k := NewNetworkDriver(driverName, "node1", fake.NewClientset())
+			k.host.numaNode = func(ifName string) (int, error) {
+				return map[string]int{"eth1": 0, "eth2": 1, "eth3": -1}[ifName], nil
+			}
+			k.checkpointPath = ""
+			recorder := record.NewFakeRecorder(10)
+			k.eventRecorder = recorder
+			claim := newClaimWithDevices("claim", tt.device)
+			claim.Status.Allocation.Devices.Config = []resourceapi.DeviceAllocationConfiguration{
+				opaqueConfig(driverName, nil, tt.config),
+			}
+
+			results, err := k.PrepareResourceClaims(context.Background(), []*resourceapi.ResourceClaim{claim})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			result := results[claim.UID]
+			if tt.wantErr != "" {
+				if result.Err == nil || !strings.Contains(result.Err.Error(), tt.wantErr) {
+					t.Errorf("expected error containing %q, got %v", tt.wantErr, result.Err)
+				}
+			} else if result.Err != nil {
+				t.Errorf("unexpected error: %v", result.Err)
+			}
+			if got := len(k.sharedState.PreparedData[claim.UID]) > 0; got != tt.wantPrepared {
+				t.Errorf("expected prepared %v, got %v", tt.wantPrepared, got)
+			}
+			var event string
+			select {
+			case event = <-recorder.Events:
+			default:
+			}
+			if event != tt.wantEvent {
+				t.Errorf("expected event %q, got %q", tt.wantEvent, event)
+			}
+		})
+	}
+}
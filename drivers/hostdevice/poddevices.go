@@ -0,0 +1,233 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+
+	"github.com/containerd/nri/pkg/api"
+	resourceapi "k8s.io/api/resource/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/dynamic-resource-allocation/kubeletplugin"
+	"k8s.io/klog/v2"
+)
+
+// unassignedClaims returns the UIDs of the prepared claims whose devices are
+// not assigned to a pod yet, they are keyed by the claim UID until the
+// sandbox of their pod runs. The caller must hold k.mu.
+func (k *NetworkDriver) unassignedClaims() []types.UID {
+	var claims []types.UID
+	for uid := range k.sharedState.PreparedData {
+		if _, ok := k.sharedState.PodDeviceConfig[uid]; ok {
+			continue
+		}
+		if _, ok := k.sharedState.PodNames[uid]; ok {
+			continue
+		}
+		claims = append(claims, uid)
+	}
+	return claims
+}
+
+// sharedClaimReason is the reason of the events of the pods whose claims are
+// reserved for other pods too.
+const sharedClaimReason = "SharedClaimRejected"
+
+// claimConsumers returns the UIDs of the pods the claim is reserved for.
+func claimConsumers(claim *resourceapi.ResourceClaim) []types.UID {
+	var consumers []types.UID
+	for _, ref := range claim.Status.ReservedFor {
+		if ref.Resource == "pods" && ref.APIGroup == "" {
+			consumers = append(consumers, ref.UID)
+		}
+	}
+	return consumers
+}
+
+// resolvePodDevices assigns to the pod the devices of the prepared claims it
+// references. The kubelet prepares the claims before the sandbox runs but
+// does not tell which pod they are for, the claims record the pods they are
+// reserved for when prepared and their devices are moved from the claim UID
+// to the pod UID. Only the claims prepared without their consumers, by a
+// previous version of the driver, are looked up in the status of the pod, so
+// the pods of the node are not looked up while there are none.
+// The devices can only be moved into one network namespace, the claims
+// reserved for several pods are rejected and none of them gets their devices.
+// The caller must hold the pod lock and not k.mu.
+func (k *NetworkDriver) resolvePodDevices(ctx context.Context, pod *api.PodSandbox) error {
+	podUID := types.UID(pod.Uid)
+	k.mu.Lock()
+	_, resolved := k.sharedState.PodDeviceConfig[podUID]
+	var claimUIDs []types.UID
+	var shared []types.NamespacedName
+	lookup := false
+	for _, uid := range k.unassignedClaims() {
+		prepared := k.sharedState.PreparedData[uid]
+		if len(prepared) == 0 || len(prepared[0].Consumers) == 0 {
+			lookup = true
+			continue
+		}
+		if !slices.Contains(prepared[0].Consumers, podUID) {
+			continue
+		}
+		if len(prepared[0].Consumers) > 1 {
+			shared = append(shared, prepared[0].Claim)
+			continue
+		}
+		claimUIDs = append(claimUIDs, uid)
+	}
+	k.mu.Unlock()
+	if resolved {
+		return nil
+	}
+	if lookup {
+		uids, sharedClaims, err := k.lookupPodClaims(ctx, pod)
+		if err != nil {
+			return err
+		}
+		claimUIDs = append(claimUIDs, uids...)
+		shared = append(shared, sharedClaims...)
+	}
+	if len(shared) > 0 {
+		err := fmt.Errorf("claims %v of pod %s/%s are reserved for other pods too, their devices can only be attached to one pod", shared, pod.Namespace, pod.Name)
+		k.recordPodWarning(pod, sharedClaimReason, err)
+		return err
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	var devices []AllocatedDevice
+	var preparedData []PreparedDevice
+	for _, claimUID := range claimUIDs {
+		prepared, ok := k.sharedState.PreparedData[claimUID]
+		if !ok {
+			continue
+		}
+		for _, device := range prepared {
+			klog.Infof("Assigning device %q of claim %s to pod %s/%s", device.DeviceName, device.Claim, pod.Namespace, pod.Name)
+			devices = append(devices, AllocatedDevice{
+				Name:       device.DeviceName,
+				Attributes: maps.Clone(device.Attributes),
+				PoolName:   device.PoolName,
+				Request:    device.Request,
+			})
+		}
+		preparedData = append(preparedData, prepared...)
+		delete(k.sharedState.PreparedData, claimUID)
+	}
+	if len(devices) == 0 {
+		return nil
+	}
+	k.sharedState.PodDeviceConfig[podUID] = devices
+	k.sharedState.PreparedData[podUID] = preparedData
+	k.sharedState.PodNames[podUID] = types.NamespacedName{Namespace: pod.Namespace, Name: pod.Name}
+	if err := k.saveCheckpoint(); err != nil {
+		klog.Errorf("failed to save checkpoint: %v", err)
+	}
+	return nil
+}
+
+// lookupPodClaims returns the UIDs of the claims of the pod status reserved
+// for the pod only, and the names of the ones reserved for other pods too.
+func (k *NetworkDriver) lookupPodClaims(ctx context.Context, pod *api.PodSandbox) ([]types.UID, []types.NamespacedName, error) {
+	podUID := types.UID(pod.Uid)
+	podClaimLookups.WithLabelValues(k.driverName).Inc()
+	apiPod, err := k.kubeClient.CoreV1().Pods(pod.Namespace).Get(ctx, pod.Name, metav1.GetOptions{})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get pod %s/%s: %w", pod.Namespace, pod.Name, err)
+	}
+	if apiPod.UID != podUID {
+		return nil, nil, fmt.Errorf("pod %s/%s has UID %s, expected %s", pod.Namespace, pod.Name, apiPod.UID, podUID)
+	}
+	var claimUIDs []types.UID
+	var shared []types.NamespacedName
+	for _, status := range apiPod.Status.ResourceClaimStatuses {
+		if status.ResourceClaimName == nil {
+			continue
+		}
+		podClaimLookups.WithLabelValues(k.driverName).Inc()
+		claim, err := k.kubeClient.ResourceV1().ResourceClaims(pod.Namespace).Get(ctx, *status.ResourceClaimName, metav1.GetOptions{})
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to get claim %s/%s of pod %s: %w", pod.Namespace, *status.ResourceClaimName, pod.Name, err)
+		}
+		consumers := claimConsumers(claim)
+		if !slices.Contains(consumers, podUID) {
+			klog.V(2).Infof("Claim %s/%s is not reserved for pod %s/%s", claim.Namespace, claim.Name, pod.Namespace, pod.Name)
+			continue
+		}
+		if len(consumers) > 1 {
+			shared = append(shared, types.NamespacedName{Namespace: claim.Namespace, Name: claim.Name})
+			continue
+		}
+		claimUIDs = append(claimUIDs, claim.UID)
+	}
+	return claimUIDs, shared, nil
+}
+
+// assignedDevices returns the devices of the claim assigned to a pod. The
+// caller must hold k.mu.
+func (k *NetworkDriver) assignedDevices(claim types.NamespacedName) []PreparedDevice {
+	var devices []PreparedDevice
+	for podUID, preparedData := range k.sharedState.PreparedData {
+		if _, ok := k.sharedState.PodNames[podUID]; !ok {
+			continue
+		}
+		for _, device := range preparedData {
+			if device.Claim == claim {
+				devices = append(devices, device)
+			}
+		}
+	}
+	return devices
+}
+
+// releaseClaimDevices forgets the devices of an unprepared claim assigned to
+// a pod, unless they are still attached to it and must be restored when it
+// stops. The caller must hold k.mu.
+func (k *NetworkDriver) releaseClaimDevices(claim kubeletplugin.NamespacedObject) {
+	name := types.NamespacedName{Namespace: claim.Namespace, Name: claim.Name}
+	for podUID, preparedData := range k.sharedState.PreparedData {
+		if _, ok := k.sharedState.PodNames[podUID]; !ok {
+			continue
+		}
+		released := func(device PreparedDevice) bool {
+			return device.Claim == name && device.State != DeviceStateAttached
+		}
+		if !slices.ContainsFunc(preparedData, released) {
+			continue
+		}
+		k.sharedState.PodDeviceConfig[podUID] = slices.DeleteFunc(k.sharedState.PodDeviceConfig[podUID], func(device AllocatedDevice) bool {
+			prepared, ok := findPreparedDevice(preparedData, device.Name)
+			return ok && released(prepared)
+		})
+		k.sharedState.PreparedData[podUID] = slices.DeleteFunc(preparedData, released)
+	}
+}
+
+// publishedAttributes returns the attributes of the last publication of the
+// device name as strings. The caller must hold k.mu.
+func (k *NetworkDriver) publishedAttributes(name string) map[string]string {
+	for _, device := range k.lastDevices {
+		if device.Name != name {
+			continue
+		}
+		attributes := map[string]string{}
+		for attr, value := range device.Attributes {
+			switch {
+			case value.StringValue != nil:
+				attributes[string(attr)] = *value.StringValue
+			case value.IntValue != nil:
+				attributes[string(attr)] = strconv.FormatInt(*value.IntValue, 10)
+			case value.BoolValue != nil:
+				attributes[string(attr)] = strconv.FormatBool(*value.BoolValue)
+			case value.VersionValue != nil:
+				attributes[string(attr)] = *value.VersionValue
+			}
+		}
+		return attributes
+	}
+	return nil
+}
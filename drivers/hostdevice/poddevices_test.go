@@ -0,0 +1,228 @@
+package main
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/containerd/nri/pkg/api"
+	"github.com/vishvananda/netlink"
+	v1 "k8s.io/api/core/v1"
+	resourceapi "k8s.io/api/resource/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/dynamic-resource-allocation/kubeletplugin"
+
+	kndnet "github.com/aojea/kubernetes-network-drivers/pkg/net"
+)
+
+func Test_resolvePodDevices(t *testing.T) {
+	attached := map[string]string{}
+	claim := newClaimWithConfig()
+	claim.ObjectMeta = metav1.ObjectMeta{Namespace: "default", Name: "claim1", UID: "claim-uid"}
+	claim.Status.ReservedFor = []resourceapi.ResourceClaimConsumerReference{{Resource: "pods", Name: "pod", UID: "pod-uid"}}
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "pod", UID: "pod-uid"},
+		Status: v1.PodStatus{
+			ResourceClaimStatuses: []v1.PodResourceClaimStatus{{Name: "nic", ResourceClaimName: pointer("claim1")}},
+		},
+	}
+	other := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "other", UID: "other-uid"}}
+	client := fake.NewClientset(claim, pod, other)
+	k := NewNetworkDriver(driverName, "node1", client)
+	k.host.attachNetdev = func(hostIfName string, containerNsPath string, newAttr netlink.LinkAttrs, addresses []*net.IPNet, opts ...kndnet.AttachOption) (*resourceapi.NetworkDeviceData, error) {
+		attached[hostIfName] = containerNsPath
+		return nil, nil
+	}
+	k.host.detachNetdev = func(containerNsPath string, devName string, outName string, opts ...kndnet.DetachOption) error {
+		delete(attached, devName)
+		return nil
+	}
+	k.checkpointPath = ""
+	speed := int64(25000)
+	k.lastDevices = []resourceapi.Device{{
+		Name: "eth1",
+		Attributes: map[resourceapi.QualifiedName]resourceapi.DeviceAttribute{
+			"pci-address":     {StringValue: pointer("0000:01:00.0")},
+			"link-speed-mbps": {IntValue: &speed},
+		},
+	}}
+
+	results, err := k.PrepareResourceClaims(context.Background(), []*resourceapi.ResourceClaim{claim})
+	if err != nil || results[claim.UID].Err != nil {
+		t.Fatalf("unexpected error preparing the claim: %v %v", err, results[claim.UID].Err)
+	}
+
+	// a pod without claims of the driver gets no devices
+	otherSandbox := newTestSandbox("/run/netns/other")
+	otherSandbox.Uid, otherSandbox.Name = "other-uid", "other"
+	if err := k.RunPodSandbox(context.Background(), otherSandbox); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := k.sharedState.PreparedData["claim-uid"]; !ok {
+		t.Fatalf("expected the claim to stay unassigned")
+	}
+
+	sandbox := newTestSandbox("/run/netns/pod")
+	if err := k.RunPodSandbox(context.Background(), sandbox); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if attached["eth1"] != "/run/netns/pod" {
+		t.Errorf("expected eth1 attached to the pod, got %v", attached)
+	}
+	if _, ok := k.sharedState.PreparedData["claim-uid"]; ok {
+		t.Errorf("expected the prepared data to be assigned to the pod")
+	}
+	devices := k.sharedState.PodDeviceConfig["pod-uid"]
+	if len(devices) != 1 || devices[0].Name != "eth1" || devices[0].NetworkNamespace != "/run/netns/pod" {
+		t.Errorf("unexpected pod devices %+v", devices)
+	}
+	if want := map[string]string{"pci-address": "0000:01:00.0", "link-speed-mbps": "25000"}; len(devices) == 1 && !reflect.DeepEqual(devices[0].Attributes, want) {
+		t.Errorf("expected the published attributes %v, got %v", want, devices[0].Attributes)
+	}
+	if got := k.sharedState.PreparedData["pod-uid"][0].State; got != DeviceStateAttached {
+		t.Errorf("expected device attached, got %s", got)
+	}
+	// the consumers recorded when the claim was prepared assign it
+	for _, action := range client.Actions() {
+		if action.GetResource().Resource == "pods" {
+			t.Errorf("expected the pods not looked up to run the sandboxes, got %v", action)
+		}
+	}
+
+	// the kubelet prepares the claim again after a restart
+	results, err = k.PrepareResourceClaims(context.Background(), []*resourceapi.ResourceClaim{claim})
+	if err != nil || results[claim.UID].Err != nil || len(results[claim.UID].Devices) != 1 {
+		t.Fatalf("unexpected result preparing the assigned claim: %v %+v", err, results[claim.UID])
+	}
+	if _, ok := k.sharedState.PreparedData["claim-uid"]; ok {
+		t.Errorf("expected the assigned claim not to be prepared again")
+	}
+
+	// the claim of a running pod is unprepared after it stops
+	if _, err := k.UnprepareResourceClaims(context.Background(), []kubeletplugin.NamespacedObject{{NamespacedName: types.NamespacedName{Namespace: "default", Name: "claim1"}, UID: claim.UID}}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(k.sharedState.PreparedData["pod-uid"]) != 1 {
+		t.Fatalf("attached device forgotten before the pod stops")
+	}
+	if err := k.StopPodSandbox(context.Background(), sandbox); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := attached["eth1"]; ok {
+		t.Errorf("expected eth1 returned to the host")
+	}
+	if _, err := k.UnprepareResourceClaims(context.Background(), []kubeletplugin.NamespacedObject{{NamespacedName: types.NamespacedName{Namespace: "default", Name: "claim1"}, UID: claim.UID}}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(k.sharedState.PodDeviceConfig["pod-uid"]) != 0 || len(k.sharedState.PreparedData["pod-uid"]) != 0 {
+		t.Errorf("expected the devices of the unprepared claim to be released")
+	}
+}
+
+func Test_resolvePodDevices_lookup(t *testing.T) {
+	claim := &resourceapi.ResourceClaim{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "claim1", UID: "claim-uid"},
+		Status: resourceapi.ResourceClaimStatus{
+			ReservedFor: []resourceapi.ResourceClaimConsumerReference{{Resource: "pods", Name: "pod", UID: "pod-uid"}},
+		},
+	}
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "pod", UID: "pod-uid"},
+		Status: v1.PodStatus{
+			ResourceClaimStatuses: []v1.PodResourceClaimStatus{{Name: "nic", ResourceClaimName: pointer("claim1")}},
+		},
+	}
+	k := NewNetworkDriver(driverName, "node1", fake.NewClientset(claim, pod))
+	k.checkpointPath = ""
+	// restored from a checkpoint without the consumers of the claim
+	k.sharedState.PreparedData["claim-uid"] = []PreparedDevice{{DeviceName: "eth1", Claim: types.NamespacedName{Namespace: "default", Name: "claim1"}, State: DeviceStatePrepared}}
+	k.sharedState.PreparedData["claim2-uid"] = []PreparedDevice{{DeviceName: "eth2", Consumers: []types.UID{"pod-uid"}, State: DeviceStatePrepared}}
+
+	if err := k.resolvePodDevices(context.Background(), &api.PodSandbox{Uid: "pod-uid", Namespace: "default", Name: "pod"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	devices := k.sharedState.PodDeviceConfig["pod-uid"]
+	if len(devices) != 2 || devices[0].Name != "eth2" || devices[1].Name != "eth1" {
+		t.Errorf("unexpected pod devices %+v", devices)
+	}
+	if len(k.unassignedClaims()) != 0 {
+		t.Errorf("expected the claims assigned, got %v", k.unassignedClaims())
+	}
+}
+
+func Test_resolvePodDevices_apiError(t *testing.T) {
+	k := NewNetworkDriver(driverName, "node1", fake.NewClientset())
+	k.checkpointPath = ""
+	k.sharedState.PreparedData["claim-uid"] = []PreparedDevice{{DeviceName: "eth1", State: DeviceStatePrepared}}
+	// the pod would run without its devices
+	if err := k.resolvePodDevices(context.Background(), &api.PodSandbox{Uid: "pod-uid", Namespace: "default", Name: "pod"}); err == nil {
+		t.Errorf("expected error when the pod cannot be looked up")
+	}
+}
+
+func Test_resolvePodDevices_sharedClaim(t *testing.T) {
+	shared := []resourceapi.ResourceClaimConsumerReference{
+		{Resource: "pods", Name: "pod", UID: "pod-uid"},
+		{Resource: "pods", Name: "other", UID: "other-uid"},
+	}
+	claim2 := &resourceapi.ResourceClaim{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "claim2", UID: "claim2-uid"},
+		Status:     resourceapi.ResourceClaimStatus{ReservedFor: shared},
+	}
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "pod", UID: "pod-uid"},
+		Status: v1.PodStatus{
+			ResourceClaimStatuses: []v1.PodResourceClaimStatus{{Name: "nic", ResourceClaimName: pointer("claim2")}},
+		},
+	}
+	other := pod.DeepCopy()
+	other.Name, other.UID = "other", "other-uid"
+	tests := []struct {
+		name     string
+		prepared []PreparedDevice
+	}{
+		{
+			name:     "recorded consumers",
+			prepared: []PreparedDevice{{DeviceName: "eth1", Claim: types.NamespacedName{Namespace: "default", Name: "claim1"}, Consumers: []types.UID{"pod-uid", "other-uid"}, State: DeviceStatePrepared}},
+		},
+		{
+			// restored from a checkpoint without the consumers of the claim
+			name:     "looked up consumers",
+			prepared: []PreparedDevice{{DeviceName: "eth1", Claim: types.NamespacedName{Namespace: "default", Name: "claim2"}, State: DeviceStatePrepared}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k := NewNetworkDriver(driverName, "node1", fake.NewClientset(claim2, pod, other))
+			k.checkpointPath = ""
+			recorder := record.NewFakeRecorder(10)
+			k.eventRecorder = recorder
+			k.sharedState.PreparedData["claim2-uid"] = tt.prepared
+
+			for _, sandbox := range []*api.PodSandbox{
+				{Uid: "pod-uid", Namespace: "default", Name: "pod"},
+				{Uid: "other-uid", Namespace: "default", Name: "other"},
+			} {
+				if err := k.resolvePodDevices(context.Background(), sandbox); err == nil {
+					t.Errorf("expected the shared claim rejected for pod %s", sandbox.Name)
+				}
+				select {
+				case event := <-recorder.Events:
+					if !strings.HasPrefix(event, "Warning "+sharedClaimReason) {
+						t.Errorf("unexpected event %q", event)
+					}
+				default:
+					t.Errorf("expected an event for pod %s", sandbox.Name)
+				}
+			}
+			if len(k.sharedState.PodDeviceConfig) != 0 || len(k.unassignedClaims()) != 1 {
+				t.Errorf("expected the shared claim not assigned, got %+v", k.sharedState.PodDeviceConfig)
+			}
+		})
+	}
+}
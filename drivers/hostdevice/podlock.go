@@ -0,0 +1,76 @@
+package main
+
+import (
+	"sync"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// podLocks serialize the operations on the devices of each pod. The sandbox
+// of a pod deleted and recreated quickly can be stopped and run at the same
+// time for the same UID, and the devices are moved without holding the
+// driver lock so the other pods are not blocked meanwhile. They must be
+// acquired before the driver lock.
+type podLocks struct {
+	mu    sync.Mutex
+	locks map[types.UID]*podLock
+}
+
+type podLock struct {
+	sync.Mutex
+	// refs are the holders and waiters of the lock, it is forgotten when
+	// there are none so the locks of the deleted pods are not leaked.
+	refs int
+}
+
+// acquire returns the lock of the pod with a reference taken.
+func (l *podLocks) acquire(podUID types.UID) *podLock {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.locks == nil {
+		l.locks = make(map[types.UID]*podLock)
+	}
+	lock, ok := l.locks[podUID]
+	if !ok {
+		lock = &podLock{}
+		l.locks[podUID] = lock
+	}
+	lock.refs++
+	return lock
+}
+
+// release drops a reference to the lock of the pod.
+func (l *podLocks) release(podUID types.UID, lock *podLock) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	lock.refs--
+	if lock.refs == 0 {
+		delete(l.locks, podUID)
+	}
+}
+
+// lock blocks until the pod is not being operated on and returns the
+// function that unlocks it.
+func (l *podLocks) lock(podUID types.UID) func() {
+	lock := l.acquire(podUID)
+	lock.Lock()
+	return func() {
+		lock.Unlock()
+		l.release(podUID, lock)
+	}
+}
+
+// tryLock locks the pod if it is not being operated on, it is used by the
+// background tasks that must not wait for the pod while holding the driver
+// lock.
+func (l *podLocks) tryLock(podUID types.UID) (func(), bool) {
+	lock := l.acquire(podUID)
+	if !lock.TryLock() {
+		l.release(podUID, lock)
+		return nil, false
+	}
+	return func() {
+		lock.Unlock()
+		l.release(podUID, lock)
+	}, true
+}
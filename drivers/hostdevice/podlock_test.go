@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/containerd/nri/pkg/api"
+	"github.com/vishvananda/netlink"
+	resourceapi "k8s.io/api/resource/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes/fake"
+
+	kndnet "github.com/aojea/kubernetes-network-drivers/pkg/net"
+)
+
+func newTestSandbox(networkNamespace string) *api.PodSandbox {
+	return &api.PodSandbox{
+		Uid:       "pod-uid",
+		Name:      "pod",
+		Namespace: "default",
+		Linux: &api.LinuxPodSandbox{
+			Namespaces: []*api.LinuxNamespace{{Type: "network", Path: networkNamespace}},
+		},
+	}
+}
+
+func Test_podSandbox_concurrentStopAndRun(t *testing.T) {
+	var mu sync.Mutex
+	var steps []string
+	detaching := make(chan struct{})
+	release := make(chan struct{})
+	k := NewNetworkDriver(driverName, "node1", fake.NewClientset())
+	k.host.detachNetdev = func(containerNsPath string, devName string, outName string, opts ...kndnet.DetachOption) error {
+		mu.Lock()
+		steps = append(steps, "detach "+devName+" from "+containerNsPath)
+		first := len(steps) == 1
+		mu.Unlock()
+		if first {
+			close(detaching)
+			<-release
+		}
+		return nil
+	}
+	k.host.attachNetdev = func(hostIfName string, containerNsPath string, newAttr netlink.LinkAttrs, addresses []*net.IPNet, opts ...kndnet.AttachOption) (*resourceapi.NetworkDeviceData, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		steps = append(steps, "attach "+hostIfName+" to "+containerNsPath)
+		return nil, nil
+	}
+
+	k.checkpointPath = ""
+	k.sharedState.PodDeviceConfig["pod-uid"] = []AllocatedDevice{{Name: "eth1", NetworkNamespace: "/run/netns/old"}}
+	k.sharedState.PreparedData["pod-uid"] = []PreparedDevice{{DeviceName: "eth1", State: DeviceStateAttached}}
+
+	// the old sandbox is stopped while the new one is run
+	stopErr := make(chan error, 1)
+	go func() { stopErr <- k.StopPodSandbox(context.Background(), newTestSandbox("/run/netns/old")) }()
+	<-detaching
+	runErr := make(chan error, 1)
+	go func() { runErr <- k.RunPodSandbox(context.Background(), newTestSandbox("/run/netns/new")) }()
+
+	select {
+	case err := <-runErr:
+		t.Fatalf("run completed while the stop was restoring the device: %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+	// the other pods are not blocked by the device being moved
+	if !k.mu.TryLock() {
+		t.Fatalf("driver lock held while the device is moved")
+	}
+	k.mu.Unlock()
+
+	close(release)
+	for name, errCh := range map[string]chan error{"stop": stopErr, "run": runErr} {
+		select {
+		case err := <-errCh:
+			if err != nil {
+				t.Fatalf("unexpected %s error: %v", name, err)
+			}
+		case <-time.After(wait.ForeverTestTimeout):
+			t.Fatalf("%s did not complete", name)
+		}
+	}
+	want := []string{"detach eth1 from /run/netns/old", "attach eth1 to /run/netns/new"}
+	if !reflect.DeepEqual(steps, want) {
+		t.Errorf("expected %v, got %v", want, steps)
+	}
+	if got := k.sharedState.PodDeviceConfig["pod-uid"][0].NetworkNamespace; got != "/run/netns/new" {
+		t.Errorf("expected device in the new sandbox, got %s", got)
+	}
+	if got := k.sharedState.PreparedData["pod-uid"][0].State; got != DeviceStateAttached {
+		t.Errorf("expected device attached, got %s", got)
+	}
+
+	// a late stop of the old sandbox does not restore the device of the new one
+	steps = nil
+	if err := k.StopPodSandbox(context.Background(), newTestSandbox("/run/netns/old")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// a repeated run of the new sandbox does not move it again
+	if err := k.RunPodSandbox(context.Background(), newTestSandbox("/run/netns/new")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(steps) != 0 {
+		t.Errorf("unexpected device operations %v", steps)
+	}
+	// a run can not take the device while the new sandbox has it
+	if err := k.RunPodSandbox(context.Background(), newTestSandbox("/run/netns/other")); err == nil {
+		t.Errorf("expected error running a sandbox while the device is attached to another one")
+	}
+
+	if len(k.podLocks.locks) != 0 {
+		t.Errorf("expected the pod locks to be released, got %d", len(k.podLocks.locks))
+	}
+}
+
+func Test_podLocks_tryLock(t *testing.T) {
+	var locks podLocks
+	unlock := locks.lock("pod-uid")
+	if _, ok := locks.tryLock("pod-uid"); ok {
+		t.Fatalf("expected the locked pod not to be locked again")
+	}
+	unlockOther, ok := locks.tryLock("other-uid")
+	if !ok {
+		t.Fatalf("expected other pods to be lockable")
+	}
+	unlockOther()
+	unlock()
+	if len(locks.locks) != 0 {
+		t.Errorf("expected the pod locks to be released, got %d", len(locks.locks))
+	}
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/containerd/nri/pkg/api"
+	"golang.org/x/sys/unix"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// defaultPodsDir is the directory of the kubelet with the pod directories by
+// default.
+const defaultPodsDir = "/var/lib/kubelet/pods"
+
+// isNetworkNamespace returns an error if the path is not a network namespace
+// mount.
+func isNetworkNamespace(path string) error {
+	var stat unix.Statfs_t
+	if err := unix.Statfs(path, &stat); err != nil {
+		return err
+	}
+	if stat.Type != unix.NSFS_MAGIC {
+		return fmt.Errorf("%s is not a namespace mount", path)
+	}
+	return nil
+}
+
+// validatePodNamespacePath returns an error if the path of a network
+// namespace of the pod is not relative to the pod directory or leaves it.
+func validatePodNamespacePath(path string) error {
+	if !filepath.IsLocal(path) {
+		return fmt.Errorf("network namespace %q must be a path relative to the pod directory without ..", path)
+	}
+	return nil
+}
+
+// resolvePodNetworkNamespace returns the path on the node of the network
+// namespace at path relative to the directory of the pod in the pods directory. The
+// symlinks are resolved so a path inside the pod directory cannot point to
+// a namespace of another pod or of the host, and the target must already
+// be a network namespace.
+func (k *NetworkDriver) resolvePodNetworkNamespace(podUID types.UID, path string) (string, error) {
+	if err := validatePodNamespacePath(path); err != nil {
+		return "", err
+	}
+	podDir, err := filepath.EvalSymlinks(filepath.Join(k.podsDir, string(podUID)))
+	if err != nil {
+		return "", fmt.Errorf("pod directory: %w", err)
+	}
+	target, err := filepath.EvalSymlinks(filepath.Join(podDir, path))
+	if err != nil {
+		return "", fmt.Errorf("network namespace %q: %w", path, err)
+	}
+	if !strings.HasPrefix(target, podDir+string(filepath.Separator)) {
+		return "", fmt.Errorf("network namespace %q resolves to %s outside of the pod directory", path, target)
+	}
+	if err := k.host.isNetworkNamespace(target); err != nil {
+		return "", fmt.Errorf("network namespace %q: %w", path, err)
+	}
+	return target, nil
+}
+
+// sandboxNamespace returns the network namespace of the sandbox the device
+// was attached for, the one it was moved into unless it targets another
+// namespace of the pod.
+func (d AllocatedDevice) sandboxNamespace() string {
+	if d.SandboxNamespace != "" {
+		return d.SandboxNamespace
+	}
+	return d.NetworkNamespace
+}
+
+// podNamespace returns the network namespace the device is in inside the
+// sandbox with network namespace sandboxNamespace.
+func (d AllocatedDevice) podNamespace(sandboxNamespace string) string {
+	if d.SandboxNamespace != "" {
+		return d.NetworkNamespace
+	}
+	return sandboxNamespace
+}
+
+// getNetworkNamespaceFallback returns the network namespace of the sandbox
+// from its init process, for the runtimes that do not report it in
+// pod.Linux.Namespaces. The process is the pid of the sandbox or else the
+// first process of its cgroup. A sandbox in the network namespace of the host
+// has no namespace of its own.
+func (k *NetworkDriver) getNetworkNamespaceFallback(pod *api.PodSandbox) (string, error) {
+	pid := int(pod.GetPid())
+	if pid == 0 {
+		cgroupsPath := pod.GetLinux().GetCgroupsPath()
+		if cgroupsPath == "" {
+			return "", errors.New("no pid nor cgroup reported for the sandbox")
+		}
+		var err error
+		if pid, err = cgroupInitPid(k.sandboxCgroupDir(cgroupsPath)); err != nil {
+			return "", err
+		}
+	}
+	path := filepath.Join(k.procDir, strconv.Itoa(pid), "ns", "net")
+	if err := k.host.isNetworkNamespace(path); err != nil {
+		return "", fmt.Errorf("network namespace of pid %d: %w", pid, err)
+	}
+	nsInfo, err := os.Stat(path)
+	if err != nil {
+		return "", fmt.Errorf("network namespace of pid %d: %w", pid, err)
+	}
+	hostInfo, err := os.Stat(filepath.Join(k.procDir, "self", "ns", "net"))
+	if err != nil {
+		return "", fmt.Errorf("host network namespace: %w", err)
+	}
+	if os.SameFile(nsInfo, hostInfo) {
+		return "", fmt.Errorf("pid %d is in the host network namespace", pid)
+	}
+	return path, nil
+}
+
+// pinnedNamespacePath returns the path in netnsPinDir the network namespace of
+// the sandbox with id sandboxID is pinned on.
+func (k *NetworkDriver) pinnedNamespacePath(sandboxID string) (string, error) {
+	if sandboxID == "" || filepath.Base(sandboxID) != sandboxID || strings.HasPrefix(sandboxID, ".") {
+		return "", fmt.Errorf("invalid sandbox id %q", sandboxID)
+	}
+	return filepath.Join(k.netnsPinDir, "knd-"+sandboxID), nil
+}
+
+// pinNetworkNamespace bind mounts the network namespace at path, of the init
+// process of the sandbox with id sandboxID, on a file of netnsPinDir and
+// returns it. Unlike the path in /proc the mount keeps referring to the same
+// namespace once the process exits and its pid is reused, and it survives the
+// restarts of the driver. A namespace already pinned for the sandbox is
+// returned as is.
+func (k *NetworkDriver) pinNetworkNamespace(sandboxID, path string) (string, error) {
+	pin, err := k.pinnedNamespacePath(sandboxID)
+	if err != nil {
+		return "", err
+	}
+	if err := k.host.isNetworkNamespace(pin); err == nil {
+		return pin, nil
+	}
+	if err := os.MkdirAll(k.netnsPinDir, 0o755); err != nil {
+		return "", err
+	}
+	f, err := os.OpenFile(pin, os.O_RDONLY|os.O_CREATE, 0o444)
+	if err != nil {
+		return "", err
+	}
+	f.Close()
+	if err := unix.Mount(path, pin, "none", unix.MS_BIND, ""); err != nil {
+		os.Remove(pin)
+		return "", fmt.Errorf("failed to pin network namespace %s on %s: %w", path, pin, err)
+	}
+	return pin, nil
+}
+
+// unpinNetworkNamespace releases the network namespace at path if it was
+// pinned by the driver, the namespaces reported by the runtime are not.
+func (k *NetworkDriver) unpinNetworkNamespace(path string) error {
+	if filepath.Dir(path) != k.netnsPinDir || !strings.HasPrefix(filepath.Base(path), "knd-") {
+		return nil
+	}
+	if err := unix.Unmount(path, unix.MNT_DETACH); err != nil && !errors.Is(err, unix.EINVAL) && !errors.Is(err, unix.ENOENT) {
+		return fmt.Errorf("failed to unpin network namespace %s: %w", path, err)
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to unpin network namespace %s: %w", path, err)
+	}
+	return nil
+}
+
+// sandboxCgroupDir returns the directory in cgroupDir of the cgroups path of
+// a sandbox, either a path with the cgroupfs driver or slice:prefix:name with
+// the systemd driver, e.g. kubepods-besteffort-pod<uid>.slice:cri-containerd:<id>
+// is the scope cri-containerd-<id>.scope nested in the parents of the slice.
+func (k *NetworkDriver) sandboxCgroupDir(cgroupsPath string) string {
+	slice, unit, ok := strings.Cut(cgroupsPath, ":")
+	if !ok {
+		return filepath.Join(k.cgroupDir, cgroupsPath)
+	}
+	prefix, name, _ := strings.Cut(unit, ":")
+	dir := k.cgroupDir
+	// every dash of the slice name is a level, kubepods-besteffort.slice is
+	// under kubepods.slice
+	parts := strings.Split(strings.TrimSuffix(slice, ".slice"), "-")
+	for i := range parts {
+		if parts[i] == "" {
+			continue
+		}
+		dir = filepath.Join(dir, strings.Join(parts[:i+1], "-")+".slice")
+	}
+	return filepath.Join(dir, prefix+"-"+name+".scope")
+}
+
+// cgroupInitPid returns the first process of the cgroup dir, the init
+// process of a sandbox is the only one of its cgroup.
+func cgroupInitPid(dir string) (int, error) {
+	f, err := os.Open(filepath.Join(dir, "cgroup.procs"))
+	if err != nil {
+		return 0, fmt.Errorf("sandbox cgroup: %w", err)
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	if !scanner.Scan() {
+		if err := scanner.Err(); err != nil {
+			return 0, fmt.Errorf("sandbox cgroup %s: %w", dir, err)
+		}
+		return 0, fmt.Errorf("sandbox cgroup %s has no processes", dir)
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(scanner.Text()))
+	if err != nil || pid <= 0 {
+		return 0, fmt.Errorf("sandbox cgroup %s: invalid pid %q", dir, scanner.Text())
+	}
+	return pid, nil
+}
@@ -0,0 +1,316 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/containerd/nri/pkg/api"
+	"github.com/vishvananda/netlink"
+	resourceapi "k8s.io/api/resource/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	kndnet "github.com/aojea/kubernetes-network-drivers/pkg/net"
+)
+
+func Test_resolvePodNetworkNamespace(t *testing.T) {
+	podsDir := t.TempDir()
+	podDir := filepath.Join(podsDir, "pod-uid")
+	otherDir := filepath.Join(podsDir, "other-uid")
+	for _, dir := range []string{filepath.Join(podDir, "volumes", "netns"), otherDir} {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, file := range []string{filepath.Join(podDir, "volumes", "netns", "vrf"), filepath.Join(otherDir, "netns")} {
+		if err := os.WriteFile(file, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(filepath.Join(otherDir, "netns"), filepath.Join(podDir, "volumes", "netns", "escape")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("vrf", filepath.Join(podDir, "volumes", "netns", "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		path    string
+		notNs   bool
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "namespace",
+			path: "volumes/netns/vrf",
+			want: filepath.Join(podDir, "volumes", "netns", "vrf"),
+		},
+		{
+			name: "symlink inside the pod",
+			path: "volumes/netns/link",
+			want: filepath.Join(podDir, "volumes", "netns", "vrf"),
+		},
+		{
+			name:    "symlink outside of the pod",
+			path:    "volumes/netns/escape",
+			wantErr: true,
+		},
+		{
+			name:    "parent directory",
+			path:    "../other-uid/netns",
+			wantErr: true,
+		},
+		{
+			name:    "absolute",
+			path:    filepath.Join(otherDir, "netns"),
+			wantErr: true,
+		},
+		{
+			name:    "missing",
+			path:    "volumes/netns/missing",
+			wantErr: true,
+		},
+		{
+			name:    "not a namespace",
+			path:    "volumes/netns/vrf",
+			notNs:   true,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k := NewNetworkDriver(driverName, "node1", fake.NewClientset())
+			k.podsDir = podsDir
+			k.host.isNetworkNamespace = func(path string) error {
+				if tt.notNs {
+					return fmt.Errorf("%s is not a namespace mount", path)
+				}
+				return nil
+			}
+			got, err := k.resolvePodNetworkNamespace("pod-uid", tt.path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("resolvePodNetworkNamespace() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func Test_podSandbox_networkNamespace(t *testing.T) {
+	var steps []string
+	k := NewNetworkDriver(driverName, "node1", fake.NewClientset())
+	k.host.attachNetdev = func(hostIfName string, containerNsPath string, newAttr netlink.LinkAttrs, addresses []*net.IPNet, opts ...kndnet.AttachOption) (*resourceapi.NetworkDeviceData, error) {
+		steps = append(steps, fmt.Sprintf("attach %s %s", hostIfName, containerNsPath))
+		return nil, nil
+	}
+	k.host.detachNetdev = func(containerNsPath string, devName string, outName string, opts ...kndnet.DetachOption) error {
+		steps = append(steps, fmt.Sprintf("detach %s %s", devName, containerNsPath))
+		return nil
+	}
+	k.host.isNetworkNamespace = func(path string) error { return nil }
+
+	podsDir := t.TempDir()
+	target := filepath.Join(podsDir, "pod-uid", "volumes", "vrf")
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	k.checkpointPath = ""
+	k.podsDir = podsDir
+	k.sharedState.PodDeviceConfig["pod-uid"] = []AllocatedDevice{{Name: "eth1"}, {Name: "eth2"}}
+	k.sharedState.PreparedData["pod-uid"] = []PreparedDevice{
+		{DeviceName: "eth1"},
+		{DeviceName: "eth2", Config: DeviceConfig{NetworkNamespace: "volumes/vrf"}},
+	}
+
+	// the target namespace is not there yet
+	if err := k.RunPodSandbox(context.Background(), newTestSandbox("/run/netns/pod")); err == nil {
+		t.Fatalf("expected an error for the missing network namespace")
+	}
+	if len(steps) != 0 {
+		t.Fatalf("expected no device to be moved, got %v", steps)
+	}
+
+	if err := os.WriteFile(target, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := k.RunPodSandbox(context.Background(), newTestSandbox("/run/netns/pod")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// a repeated run keeps the devices where they are
+	if err := k.RunPodSandbox(context.Background(), newTestSandbox("/run/netns/pod")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := k.StopPodSandbox(context.Background(), newTestSandbox("/run/netns/pod")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []string{
+		"attach eth1 /run/netns/pod",
+		"attach eth2 " + target,
+		// the devices are detached in reverse order
+		"detach eth2 " + target,
+		"detach eth1 /run/netns/pod",
+	}
+	if !reflect.DeepEqual(steps, want) {
+		t.Errorf("expected %v, got %v", want, steps)
+	}
+}
+
+func Test_getNetworkNamespaceFallback(t *testing.T) {
+	k := NewNetworkDriver(driverName, "node1", fake.NewClientset())
+	k.procDir, k.cgroupDir = t.TempDir(), t.TempDir()
+	k.host.isNetworkNamespace = func(path string) error { return nil }
+	for _, pid := range []string{"self", "100", "200"} {
+		if err := os.MkdirAll(filepath.Join(k.procDir, pid, "ns"), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// pid 100 has its own namespace, pid 200 is in the host one
+	for _, file := range []string{filepath.Join(k.procDir, "self", "ns", "net"), filepath.Join(k.procDir, "100", "ns", "net")} {
+		if err := os.WriteFile(file, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(filepath.Join(k.procDir, "self", "ns", "net"), filepath.Join(k.procDir, "200", "ns", "net")); err != nil {
+		t.Fatal(err)
+	}
+	scope := filepath.Join(k.cgroupDir, "kubepods.slice", "kubepods-besteffort.slice", "kubepods-besteffort-pod1.slice", "cri-containerd-abc.scope")
+	empty := filepath.Join(k.cgroupDir, "kubepods", "pod2", "def")
+	for dir, procs := range map[string]string{scope: "100\n", empty: ""} {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "cgroup.procs"), []byte(procs), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		pod     *api.PodSandbox
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "pid",
+			pod:  &api.PodSandbox{Pid: 100},
+			want: filepath.Join(k.procDir, "100", "ns", "net"),
+		},
+		{
+			name: "systemd cgroup",
+			pod:  &api.PodSandbox{Linux: &api.LinuxPodSandbox{CgroupsPath: "kubepods-besteffort-pod1.slice:cri-containerd:abc"}},
+			want: filepath.Join(k.procDir, "100", "ns", "net"),
+		},
+		{
+			name:    "empty cgroup",
+			pod:     &api.PodSandbox{Linux: &api.LinuxPodSandbox{CgroupsPath: "/kubepods/pod2/def"}},
+			wantErr: true,
+		},
+		{
+			name:    "missing cgroup",
+			pod:     &api.PodSandbox{Linux: &api.LinuxPodSandbox{CgroupsPath: "/kubepods/pod3/ghi"}},
+			wantErr: true,
+		},
+		{
+			name:    "host network",
+			pod:     &api.PodSandbox{Pid: 200},
+			wantErr: true,
+		},
+		{
+			name:    "exited",
+			pod:     &api.PodSandbox{Pid: 300},
+			wantErr: true,
+		},
+		{
+			name:    "no pid nor cgroup",
+			pod:     &api.PodSandbox{},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := k.getNetworkNamespaceFallback(tt.pod)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if got != tt.want {
+				t.Errorf("expected namespace %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func Test_sandboxCgroupDir(t *testing.T) {
+	k := NewNetworkDriver(driverName, "node1", fake.NewClientset())
+	tests := map[string]string{
+		"/kubepods/besteffort/pod1/abc":                     "/sys/fs/cgroup/kubepods/besteffort/pod1/abc",
+		"kubepods-besteffort-pod1.slice:cri-containerd:abc": "/sys/fs/cgroup/kubepods.slice/kubepods-besteffort.slice/kubepods-besteffort-pod1.slice/cri-containerd-abc.scope",
+		"kubepods-pod2.slice:crio:def":                      "/sys/fs/cgroup/kubepods.slice/kubepods-pod2.slice/crio-def.scope",
+	}
+	for cgroupsPath, want := range tests {
+		if got := k.sandboxCgroupDir(cgroupsPath); got != want {
+			t.Errorf("sandboxCgroupDir(%q) = %q, want %q", cgroupsPath, got, want)
+		}
+	}
+}
+
+func Test_pinNetworkNamespace(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("Test requires root privileges.")
+	}
+	k := NewNetworkDriver(driverName, "node1", fake.NewClientset())
+	k.netnsPinDir = t.TempDir()
+
+	if _, err := k.pinNetworkNamespace("../abc", "/proc/self/ns/net"); err == nil {
+		t.Errorf("expected an error pinning an invalid sandbox id")
+	}
+	pin, err := k.pinNetworkNamespace("abc", "/proc/self/ns/net")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := filepath.Join(k.netnsPinDir, "knd-abc"); pin != want {
+		t.Errorf("expected pin %s, got %s", want, pin)
+	}
+	if err := isNetworkNamespace(pin); err != nil {
+		t.Errorf("expected a namespace mount: %v", err)
+	}
+	nsInfo, err := os.Stat(pin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hostInfo, err := os.Stat("/proc/self/ns/net")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !os.SameFile(nsInfo, hostInfo) {
+		t.Errorf("expected the pinned namespace to be the one of the process")
+	}
+	// pinned once
+	if again, err := k.pinNetworkNamespace("abc", "/proc/1/ns/net"); err != nil || again != pin {
+		t.Errorf("expected the existing pin %s, got %s: %v", pin, again, err)
+	}
+
+	if err := k.unpinNetworkNamespace(pin); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := os.Stat(pin); !os.IsNotExist(err) {
+		t.Errorf("expected the pin to be removed, got %v", err)
+	}
+	// the namespaces reported by the runtime are left alone
+	other := filepath.Join(t.TempDir(), "cni-abc")
+	if err := os.WriteFile(other, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := k.unpinNetworkNamespace(other); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := os.Stat(other); err != nil {
+		t.Errorf("expected %s to be kept: %v", other, err)
+	}
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+
+	kndnet "github.com/aojea/kubernetes-network-drivers/pkg/net"
+)
+
+// podNetworkStatusAnnotation is the pod annotation with the PodNetworkStatus
+// of the pod as JSON.
+const podNetworkStatusAnnotation = "hostdevice.k8s.io/network-status"
+
+// PodNetworkStatus describes everything the driver applied to the devices of a pod.
+type PodNetworkStatus struct {
+	Namespace string    `json:"namespace"`
+	Name      string    `json:"name"`
+	UID       types.UID `json:"uid"`
+	// NetworkNamespace is the path of the pod network namespace.
+	NetworkNamespace string         `json:"networkNamespace,omitempty"`
+	Devices          []DeviceStatus `json:"devices"`
+}
+
+// DeviceStatus is the configuration applied to a device of a pod. The MAC,
+// MTU and IPs are read from the interface while it is attached, the rest is
+// the configuration of the claim.
+type DeviceStatus struct {
+	// Name is the allocated device.
+	Name string `json:"name"`
+	// Interface is the interface in the pod network namespace.
+	Interface string `json:"interface"`
+	// Mode is how the device is delivered: move, vf, macvlan or ipvlan.
+	Mode         string      `json:"mode"`
+	State        DeviceState `json:"state"`
+	HardwareAddr string      `json:"mac,omitempty"`
+	MTU          int         `json:"mtu,omitempty"`
+	IPs          []string    `json:"ips,omitempty"`
+	// SecondaryIPs are the IPv4 secondary addresses, e.g. virtual IPs, not in IPs.
+	SecondaryIPs []string `json:"secondaryIPs,omitempty"`
+	// Carrier is the live carrier of the attached interface.
+	Carrier *bool `json:"carrier,omitempty"`
+	// Routes are the routes of the main table.
+	Routes []kndnet.RouteConfig `json:"routes,omitempty"`
+	Tables []kndnet.RouteTable  `json:"tables,omitempty"`
+	Rules  []kndnet.RuleConfig  `json:"rules,omitempty"`
+	// Sysctls are the interface settings, by their full sysctl name.
+	Sysctls map[string]string `json:"sysctls,omitempty"`
+}
+
+// podNetworkStatus computes the status of the devices of the pod from the
+// prepared and applied data. The caller must hold k.mu.
+func (k *NetworkDriver) podNetworkStatus(podUID types.UID) (PodNetworkStatus, bool) {
+	devices, ok := k.sharedState.PodDeviceConfig[podUID]
+	if !ok {
+		return PodNetworkStatus{}, false
+	}
+	pod := k.sharedState.PodNames[podUID]
+	status := PodNetworkStatus{
+		Namespace: pod.Namespace,
+		Name:      pod.Name,
+		UID:       podUID,
+		Devices:   []DeviceStatus{},
+	}
+	preparedData := k.sharedState.PreparedData[podUID]
+	for _, device := range devices {
+		status.NetworkNamespace = device.NetworkNamespace
+		prepared, _ := findPreparedDevice(preparedData, device.Name)
+		ifName := prepared.podInterface()
+		if ifName == "" {
+			ifName = device.Name
+		}
+		deviceStatus := DeviceStatus{
+			Name:      device.Name,
+			Interface: ifName,
+			Mode:      deviceMode(prepared),
+			State:     prepared.State,
+			Routes:    prepared.Config.Routes,
+		}
+		if network := prepared.Config.Network; network != nil {
+			deviceStatus.Routes = network.Routes
+			deviceStatus.Tables = network.Tables
+			deviceStatus.Rules = network.Rules
+		}
+		if privacy := prepared.Config.IPv6Privacy; privacy != nil {
+			deviceStatus.Sysctls = map[string]string{}
+			for name, value := range privacy.sysctls() {
+				deviceStatus.Sysctls[fmt.Sprintf("net.ipv6.conf.%s.%s", ifName, name)] = value
+			}
+		}
+		if arp := prepared.Config.ARP; arp != nil {
+			if deviceStatus.Sysctls == nil {
+				deviceStatus.Sysctls = map[string]string{}
+			}
+			for name, value := range arp.sysctls() {
+				deviceStatus.Sysctls[fmt.Sprintf("net.ipv4.conf.%s.%s", ifName, name)] = value
+			}
+		}
+		if hopLimit := prepared.Config.HopLimit; hopLimit != 0 {
+			if deviceStatus.Sysctls == nil {
+				deviceStatus.Sysctls = map[string]string{}
+			}
+			for name, value := range hopLimitSysctls(hopLimit) {
+				deviceStatus.Sysctls[fmt.Sprintf("net.ipv6.conf.%s.%s", ifName, name)] = value
+			}
+		}
+		if prepared.State == DeviceStateAttached && device.NetworkNamespace != "" {
+			info, err := k.host.nsLinkInfo(device.NetworkNamespace, ifName)
+			if err != nil {
+				klog.V(4).Infof("failed to read device %s of pod %s: %v", ifName, podUID, err)
+			} else {
+				deviceStatus.HardwareAddr = info.HardwareAddr
+				deviceStatus.MTU = info.MTU
+				for _, address := range info.Addresses {
+					if !slices.Contains(info.SecondaryAddresses, address) {
+						deviceStatus.IPs = append(deviceStatus.IPs, address)
+					}
+				}
+				deviceStatus.SecondaryIPs = info.SecondaryAddresses
+				deviceStatus.Carrier = &info.Carrier
+			}
+		}
+		status.Devices = append(status.Devices, deviceStatus)
+	}
+	return status, true
+}
+
+// updatePodStatusAnnotation records the status of the pod devices in the pod
+// annotations, in the background so the NRI hooks are not delayed by the API
+// server. The caller must hold k.mu.
+func (k *NetworkDriver) updatePodStatusAnnotation(podUID types.UID) {
+	if !k.statusAnnotation {
+		return
+	}
+	status, ok := k.podNetworkStatus(podUID)
+	if !ok || status.Name == "" {
+		return
+	}
+	go func() {
+		if err := k.annotatePodStatus(context.Background(), status); err != nil {
+			klog.V(2).Infof("failed to annotate network status on pod %s/%s: %v", status.Namespace, status.Name, err)
+		}
+	}()
+}
+
+// annotatePodStatus writes the status in the pod annotation.
+func (k *NetworkDriver) annotatePodStatus(ctx context.Context, status PodNetworkStatus) error {
+	value, err := json.Marshal(status)
+	if err != nil {
+		return err
+	}
+	patch, err := json.Marshal(map[string]any{
+		"metadata": map[string]any{
+			"annotations": map[string]string{podNetworkStatusAnnotation: string(value)},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = k.kubeClient.CoreV1().Pods(status.Namespace).Patch(ctx, status.Name, types.MergePatchType, patch, metav1.PatchOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to patch pod %s/%s: %w", status.Namespace, status.Name, err)
+	}
+	return nil
+}
+
+// podStatusHandler serves the status of the pods with devices on the node,
+// GET /status/pods lists all of them and GET /status/pods/{uid} returns one.
+func (k *NetworkDriver) podStatusHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /status/pods", func(w http.ResponseWriter, r *http.Request) {
+		k.mu.Lock()
+		statuses := []PodNetworkStatus{}
+		for podUID := range k.sharedState.PodDeviceConfig {
+			if status, ok := k.podNetworkStatus(podUID); ok {
+				statuses = append(statuses, status)
+			}
+		}
+		k.mu.Unlock()
+		slices.SortFunc(statuses, func(a, b PodNetworkStatus) int {
+			if c := strings.Compare(a.Namespace, b.Namespace); c != 0 {
+				return c
+			}
+			return strings.Compare(a.Name, b.Name)
+		})
+		writeJSON(w, statuses)
+	})
+	mux.HandleFunc("GET /status/pods/{uid}", func(w http.ResponseWriter, r *http.Request) {
+		k.mu.Lock()
+		status, ok := k.podNetworkStatus(types.UID(r.PathValue("uid")))
+		k.mu.Unlock()
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		writeJSON(w, status)
+	})
+	return mux
+}
+
+func writeJSON(w http.ResponseWriter, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(value); err != nil {
+		klog.V(2).Infof("failed to write response: %v", err)
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+
+	kndnet "github.com/aojea/kubernetes-network-drivers/pkg/net"
+)
+
+func newStatusTestDriver(client *fake.Clientset) *NetworkDriver {
+	k := NewNetworkDriver(driverName, "node1", client)
+	k.host.nsLinkInfo = func(containerNsPath string, ifName string) (*kndnet.LinkInfo, error) {
+		return &kndnet.LinkInfo{HardwareAddr: "02:42:ac:11:00:02", MTU: 9000, Carrier: true,
+			Addresses: []string{"192.168.5.10/24", "192.168.5.100/24"}, SecondaryAddresses: []string{"192.168.5.100/24"}}, nil
+	}
+
+	k.checkpointPath = ""
+	k.sharedState.PodNames["pod-uid"] = types.NamespacedName{Namespace: "ns", Name: "pod"}
+	k.sharedState.PodDeviceConfig["pod-uid"] = []AllocatedDevice{
+		{Name: "eth1", NetworkNamespace: "/run/netns/test"},
+		{Name: "eth2", NetworkNamespace: "/run/netns/test"},
+	}
+	k.sharedState.PreparedData["pod-uid"] = []PreparedDevice{
+		{
+			DeviceName: "eth1",
+			State:      DeviceStateAttached,
+			Config: DeviceConfig{
+				Network: &kndnet.NetworkConfig{
+					Addresses:          []string{"192.168.5.10/24"},
+					SecondaryAddresses: []string{"192.168.5.100/24"},
+					Tables:             []kndnet.RouteTable{{ID: 100, Routes: []kndnet.RouteConfig{{Dst: "0.0.0.0/0", Gw: "192.168.5.1"}}}},
+					Rules:              []kndnet.RuleConfig{{Priority: 100, From: "192.168.5.10/32", Table: 100}},
+				},
+				IPv6Privacy: &IPv6PrivacyConfig{UseTempAddr: 2},
+				HopLimit:    128,
+			},
+		},
+		{
+			DeviceName: "eth2",
+			State:      DeviceStateDetached,
+			Config:     DeviceConfig{Child: &ChildConfig{Type: "macvlan"}, Routes: []kndnet.RouteConfig{{Dst: "10.0.0.0/8"}}},
+		},
+	}
+	return k
+}
+
+func Test_podNetworkStatus(t *testing.T) {
+	k := newStatusTestDriver(fake.NewClientset())
+
+	got, ok := k.podNetworkStatus("pod-uid")
+	if !ok {
+		t.Fatalf("expected status of the pod")
+	}
+	want := PodNetworkStatus{
+		Namespace:        "ns",
+		Name:             "pod",
+		UID:              "pod-uid",
+		NetworkNamespace: "/run/netns/test",
+		Devices: []DeviceStatus{
+			{
+				Name:         "eth1",
+				Interface:    "eth1",
+				Mode:         "move",
+				State:        DeviceStateAttached,
+				HardwareAddr: "02:42:ac:11:00:02",
+				MTU:          9000,
+				IPs:          []string{"192.168.5.10/24"},
+				SecondaryIPs: []string{"192.168.5.100/24"},
+				Carrier:      pointer(true),
+				Tables:       []kndnet.RouteTable{{ID: 100, Routes: []kndnet.RouteConfig{{Dst: "0.0.0.0/0", Gw: "192.168.5.1"}}}},
+				Rules:        []kndnet.RuleConfig{{Priority: 100, From: "192.168.5.10/32", Table: 100}},
+				Sysctls:      map[string]string{"net.ipv6.conf.eth1.use_tempaddr": "2", "net.ipv6.conf.eth1.hop_limit": "128"},
+			},
+			{
+				// detached devices only report their configuration
+				Name:      "eth2",
+				Interface: "eth2",
+				Mode:      "macvlan",
+				State:     DeviceStateDetached,
+				Routes:    []kndnet.RouteConfig{{Dst: "10.0.0.0/8"}},
+			},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("podNetworkStatus() = %+v, want %+v", got, want)
+	}
+
+	if _, ok := k.podNetworkStatus("other-uid"); ok {
+		t.Errorf("expected no status for unknown pod")
+	}
+}
+
+func Test_podStatusHandler(t *testing.T) {
+	k := newStatusTestDriver(fake.NewClientset())
+	server := httptest.NewServer(k.podStatusHandler())
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/status/pods")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer resp.Body.Close()
+	var statuses []PodNetworkStatus
+	if err := json.NewDecoder(resp.Body).Decode(&statuses); err != nil {
+		t.Fatalf("unexpected error decoding response: %v", err)
+	}
+	if len(statuses) != 1 || statuses[0].UID != "pod-uid" || len(statuses[0].Devices) != 2 {
+		t.Errorf("unexpected statuses %+v", statuses)
+	}
+
+	for path, code := range map[string]int{
+		"/status/pods/pod-uid":   http.StatusOK,
+		"/status/pods/other-uid": http.StatusNotFound,
+	} {
+		resp, err := http.Get(server.URL + path)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != code {
+			t.Errorf("GET %s: expected status %d, got %d", path, code, resp.StatusCode)
+		}
+	}
+
+	// the status is read-only
+	resp, err = http.Post(server.URL+"/status/pods", "application/json", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("POST: expected status %d, got %d", http.StatusMethodNotAllowed, resp.StatusCode)
+	}
+}
+
+func Test_annotatePodStatus(t *testing.T) {
+	pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "pod", Namespace: "ns", UID: "pod-uid"}}
+	client := fake.NewClientset(pod)
+	k := newStatusTestDriver(client)
+
+	status, _ := k.podNetworkStatus("pod-uid")
+	if err := k.annotatePodStatus(context.Background(), status); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got, err := client.CoreV1().Pods("ns").Get(context.Background(), "pod", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var annotated PodNetworkStatus
+	if err := json.Unmarshal([]byte(got.Annotations[podNetworkStatusAnnotation]), &annotated); err != nil {
+		t.Fatalf("invalid annotation %q: %v", got.Annotations[podNetworkStatusAnnotation], err)
+	}
+	if !reflect.DeepEqual(annotated, status) {
+		t.Errorf("annotation = %+v, want %+v", annotated, status)
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+
+	resourceapi "k8s.io/api/resource/v1"
+
+	kndnet "github.com/aojea/kubernetes-network-drivers/pkg/net"
+)
+
+// AllocationPolicy defines how equivalent free devices are preferred when
+// the scheduler allocates a claim. The DRA allocator walks the devices of a
+// ResourceSlice in order and picks the first ones that match the request, so
+// the policy is implemented by the order in which the devices are published.
+type AllocationPolicy string
+
+const (
+	// AllocationPolicyNone publishes the devices in discovery order.
+	AllocationPolicyNone AllocationPolicy = "none"
+	// AllocationPolicyFill publishes the devices of the same physical function
+	// together, packing allocations onto the fewest physical functions.
+	AllocationPolicyFill AllocationPolicy = "fill"
+	// AllocationPolicySpread interleaves the devices of the different physical
+	// functions, balancing allocations across them.
+	AllocationPolicySpread AllocationPolicy = "spread"
+)
+
+// parseAllocationPolicy validates the allocation policy name.
+func parseAllocationPolicy(policy string) (AllocationPolicy, error) {
+	switch AllocationPolicy(policy) {
+	case AllocationPolicyNone, AllocationPolicyFill, AllocationPolicySpread:
+		return AllocationPolicy(policy), nil
+	}
+	return "", fmt.Errorf("invalid allocation policy %q, must be %s, %s or %s", policy, AllocationPolicyNone, AllocationPolicyFill, AllocationPolicySpread)
+}
+
+// deviceGroup returns the PCI address of the physical function backing the
+// interface, so the SR-IOV virtual functions are grouped with their parent.
+// Virtual interfaces do not belong to any group.
+func deviceGroup(ifName string) string {
+	if pf, err := kndnet.PhysfnPCIAddress(ifName); err == nil {
+		return pf
+	}
+	if address, err := kndnet.PCIAddress(ifName); err == nil {
+		return address
+	}
+	return ""
+}
+
+// orderDevices returns the devices in the order of the allocation policy,
+// grouped by the physical function in groups that each device name maps to.
+// The fill policy lists the devices of each group together and the spread
+// policy interleaves the groups, in the order they were first discovered.
+func orderDevices(devices []resourceapi.Device, groups map[string]string, policy AllocationPolicy) []resourceapi.Device {
+	if policy != AllocationPolicyFill && policy != AllocationPolicySpread {
+		return devices
+	}
+
+	var keys []string
+	byGroup := map[string][]resourceapi.Device{}
+	for _, device := range devices {
+		key := groups[device.Name]
+		if _, ok := byGroup[key]; !ok {
+			keys = append(keys, key)
+		}
+		byGroup[key] = append(byGroup[key], device)
+	}
+
+	ordered := make([]resourceapi.Device, 0, len(devices))
+	if policy == AllocationPolicyFill {
+		for _, key := range keys {
+			ordered = append(ordered, byGroup[key]...)
+		}
+		return ordered
+	}
+
+	for i := 0; len(ordered) < len(devices); i++ {
+		for _, key := range keys {
+			if i < len(byGroup[key]) {
+				ordered = append(ordered, byGroup[key][i])
+			}
+		}
+	}
+	return ordered
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	resourceapi "k8s.io/api/resource/v1"
+)
+
+func Test_orderDevices(t *testing.T) {
+	devices := []resourceapi.Device{{Name: "pf0vf0"}, {Name: "pf1vf0"}, {Name: "pf0vf1"}, {Name: "dummy0"}, {Name: "pf1vf1"}, {Name: "pf0vf2"}}
+	groups := map[string]string{
+		"pf0vf0": "0000:3b:00.0",
+		"pf0vf1": "0000:3b:00.0",
+		"pf0vf2": "0000:3b:00.0",
+		"pf1vf0": "0000:3b:00.1",
+		"pf1vf1": "0000:3b:00.1",
+	}
+	tests := []struct {
+		policy AllocationPolicy
+		want   []string
+	}{
+		{policy: AllocationPolicyNone, want: []string{"pf0vf0", "pf1vf0", "pf0vf1", "dummy0", "pf1vf1", "pf0vf2"}},
+		{policy: AllocationPolicyFill, want: []string{"pf0vf0", "pf0vf1", "pf0vf2", "pf1vf0", "pf1vf1", "dummy0"}},
+		{policy: AllocationPolicySpread, want: []string{"pf0vf0", "pf1vf0", "dummy0", "pf0vf1", "pf1vf1", "pf0vf2"}},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.policy), func(t *testing.T) {
+			var got []string
+			for _, device := range orderDevices(devices, groups, tt.policy) {
+				got = append(got, device.Name)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("orderDevices() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_parseAllocationPolicy(t *testing.T) {
+	for _, policy := range []string{"none", "fill", "spread"} {
+		if _, err := parseAllocationPolicy(policy); err != nil {
+			t.Errorf("unexpected error for policy %s: %v", policy, err)
+		}
+	}
+	if _, err := parseAllocationPolicy("pack"); err == nil {
+		t.Errorf("expected error for invalid policy")
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"net"
+
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog/v2"
+
+	kndnet "github.com/aojea/kubernetes-network-drivers/pkg/net"
+)
+
+// firstPolicyTable is the first routing table allocated to the devices with
+// policy routing and no table, above the ones usually configured by hand.
+const firstPolicyTable = 1000
+
+// PolicyRoutingConfig routes the traffic sourced from the addresses of a
+// secondary interface through it, with a dedicated routing table and a rule
+// from each address, so the replies leave through the interface the
+// requests arrived on.
+type PolicyRoutingConfig struct {
+	// Table is the routing table of the interface, if 0 a free table of the
+	// pod is allocated from 1000.
+	Table int `json:"table,omitempty"`
+	// FwMark also routes the traffic with the firewall mark through the
+	// interface, e.g. marked by the application with SO_MARK.
+	FwMark *kndnet.FwMark `json:"fwmark,omitempty"`
+}
+
+func (c PolicyRoutingConfig) validate() error {
+	if c.FwMark != nil {
+		if err := c.FwMark.Validate(); err != nil {
+			return fmt.Errorf("invalid fwmark: %w", err)
+		}
+	}
+	if c.Table == 0 {
+		return nil
+	}
+	return kndnet.ValidateTableID(c.Table)
+}
+
+// allocatePolicyTables records the routing table of the devices of the pod
+// with policy routing, the requested one or the lowest free one, so several
+// secondary interfaces of the pod do not collide. The tables of the network
+// configurations of the pod are not used. The caller must hold k.mu.
+func (k *NetworkDriver) allocatePolicyTables(podUID types.UID) error {
+	preparedData := k.sharedState.PreparedData[podUID]
+	used := sets.New[int]()
+	for _, device := range preparedData {
+		if device.PolicyTable != 0 {
+			used.Insert(device.PolicyTable)
+		}
+		if device.Config.Network != nil {
+			for _, table := range device.Config.Network.Tables {
+				used.Insert(table.ID)
+			}
+		}
+	}
+	// the requested tables first, so the allocated ones do not take them
+	for i := range preparedData {
+		device := &preparedData[i]
+		if device.Config.PolicyRouting == nil || device.PolicyTable != 0 || device.Config.PolicyRouting.Table == 0 {
+			continue
+		}
+		if used.Has(device.Config.PolicyRouting.Table) {
+			return fmt.Errorf("routing table %d of device %s is already used by another device of the pod", device.Config.PolicyRouting.Table, device.DeviceName)
+		}
+		device.PolicyTable = device.Config.PolicyRouting.Table
+		used.Insert(device.PolicyTable)
+	}
+	table := firstPolicyTable
+	for i := range preparedData {
+		device := &preparedData[i]
+		if device.Config.PolicyRouting == nil || device.PolicyTable != 0 {
+			continue
+		}
+		for used.Has(table) {
+			table++
+		}
+		device.PolicyTable = table
+		used.Insert(table)
+	}
+	return nil
+}
+
+// applyPolicyRouting routes the traffic from the addresses of the interface
+// of the device in the pod through its routing table, the interface must be up.
+func (k *NetworkDriver) applyPolicyRouting(networkNamespace string, ifName string, device PreparedDevice) error {
+	var sources []net.IP
+	for _, address := range device.Addresses {
+		sources = append(sources, address.IP)
+	}
+	if len(sources) == 0 {
+		info, err := k.host.nsLinkInfo(networkNamespace, ifName)
+		if err != nil {
+			return err
+		}
+		for _, address := range info.Addresses {
+			if ip, _, err := net.ParseCIDR(address); err == nil {
+				sources = append(sources, ip)
+			}
+		}
+	}
+	var opts []kndnet.PolicyRoutingOption
+	if mark := device.Config.PolicyRouting.FwMark; mark != nil {
+		klog.Infof("Routing the traffic with fwmark %#x/%#x through device %q with table %d", mark.Mark, mark.Mask, ifName, device.PolicyTable)
+		opts = append(opts, kndnet.WithFwMark(*mark))
+	}
+	klog.Infof("Routing the traffic from %v through device %q with table %d", sources, ifName, device.PolicyTable)
+	return k.host.addPolicyRouting(networkNamespace, ifName, sources, device.PolicyTable, opts...)
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/vishvananda/netlink"
+	resourceapi "k8s.io/api/resource/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	kndnet "github.com/aojea/kubernetes-network-drivers/pkg/net"
+)
+
+func Test_allocatePolicyTables(t *testing.T) {
+	tests := []struct {
+		name    string
+		devices []PreparedDevice
+		want    []int
+		wantErr bool
+	}{
+		{
+			name: "allocated",
+			devices: []PreparedDevice{
+				{DeviceName: "eth1", Config: DeviceConfig{PolicyRouting: &PolicyRoutingConfig{}}},
+				{DeviceName: "eth2"},
+				{DeviceName: "eth3", Config: DeviceConfig{PolicyRouting: &PolicyRoutingConfig{}}},
+			},
+			want: []int{1000, 0, 1001},
+		},
+		{
+			name: "requested tables are kept",
+			devices: []PreparedDevice{
+				{DeviceName: "eth1", Config: DeviceConfig{PolicyRouting: &PolicyRoutingConfig{}}},
+				{DeviceName: "eth2", Config: DeviceConfig{PolicyRouting: &PolicyRoutingConfig{Table: 1000}}},
+			},
+			want: []int{1001, 1000},
+		},
+		{
+			name: "tables of the network configurations are skipped",
+			devices: []PreparedDevice{
+				{DeviceName: "eth1", Config: DeviceConfig{Network: &kndnet.NetworkConfig{Tables: []kndnet.RouteTable{{ID: 1000}}}}},
+				{DeviceName: "eth2", Config: DeviceConfig{PolicyRouting: &PolicyRoutingConfig{}}},
+			},
+			want: []int{0, 1001},
+		},
+		{
+			name: "already allocated",
+			devices: []PreparedDevice{
+				{DeviceName: "eth1", PolicyTable: 1000, Config: DeviceConfig{PolicyRouting: &PolicyRoutingConfig{}}},
+				{DeviceName: "eth2", Config: DeviceConfig{PolicyRouting: &PolicyRoutingConfig{}}},
+			},
+			want: []int{1000, 1001},
+		},
+		{
+			name: "requested table in use",
+			devices: []PreparedDevice{
+				{DeviceName: "eth1", Config: DeviceConfig{Network: &kndnet.NetworkConfig{Tables: []kndnet.RouteTable{{ID: 100}}}}},
+				{DeviceName: "eth2", Config: DeviceConfig{PolicyRouting: &PolicyRoutingConfig{Table: 100}}},
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k := NewNetworkDriver(driverName, "node1", fake.NewClientset())
+			k.sharedState.PreparedData["pod-uid"] = tt.devices
+			err := k.allocatePolicyTables("pod-uid")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("allocatePolicyTables() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			var got []int
+			for _, device := range k.sharedState.PreparedData["pod-uid"] {
+				got = append(got, device.PolicyTable)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expected tables %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func Test_podSandbox_policyRouting(t *testing.T) {
+	var steps []string
+	k := NewNetworkDriver(driverName, "node1", fake.NewClientset())
+	k.host.attachNetdev = func(hostIfName string, containerNsPath string, newAttr netlink.LinkAttrs, addresses []*net.IPNet, opts ...kndnet.AttachOption) (*resourceapi.NetworkDeviceData, error) {
+		return nil, nil
+	}
+	k.host.detachNetdev = func(containerNsPath string, devName string, outName string, opts ...kndnet.DetachOption) error {
+		return nil
+	}
+	k.host.addPolicyRouting = func(containerNsPath string, ifName string, srcIPs []net.IP, tableID int, opts ...kndnet.PolicyRoutingOption) error {
+		steps = append(steps, fmt.Sprintf("add %s %v %d with %d marks", ifName, srcIPs, tableID, len(opts)))
+		return nil
+	}
+	k.host.removePolicyRouting = func(containerNsPath string, tableID int) error {
+		steps = append(steps, fmt.Sprintf("remove %d", tableID))
+		return nil
+	}
+
+	k.checkpointPath = ""
+	addresses, _ := parseIPs([]string{"192.168.5.10/24", "fd00::10/64"})
+	k.sharedState.PodDeviceConfig["pod-uid"] = []AllocatedDevice{{Name: "eth1"}, {Name: "eth2"}}
+	k.sharedState.PreparedData["pod-uid"] = []PreparedDevice{
+		{DeviceName: "eth1", Addresses: addresses, Config: DeviceConfig{PolicyRouting: &PolicyRoutingConfig{}}},
+		{DeviceName: "eth2", Addresses: addresses[:1], Config: DeviceConfig{PolicyRouting: &PolicyRoutingConfig{FwMark: &kndnet.FwMark{Mark: 0x10}}}},
+	}
+
+	if err := k.RunPodSandbox(context.Background(), newTestSandbox("/run/netns/pod")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := k.StopPodSandbox(context.Background(), newTestSandbox("/run/netns/pod")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []string{
+		"add eth1 [192.168.5.10 fd00::10] 1000 with 0 marks",
+		"add eth2 [192.168.5.10] 1001 with 1 marks",
+		// the devices are detached in reverse order
+		"remove 1001",
+		"remove 1000",
+	}
+	if !reflect.DeepEqual(steps, want) {
+		t.Errorf("expected %v, got %v", want, steps)
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/containerd/nri/pkg/api"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	kndnet "github.com/aojea/kubernetes-network-drivers/pkg/net"
+)
+
+// QoSDefaults are the device settings applied by default to the pods of a QoS class.
+type QoSDefaults struct {
+	// EgressRate is the maximum egress rate of the interface in bits per
+	// second, e.g. "100M". It is enforced with a token bucket filter qdisc.
+	EgressRate *resource.Quantity `json:"egressRate,omitempty"`
+	// Ethtool sets the offload features and the ring sizes of the interface
+	// when the device configuration does not set them.
+	Ethtool *kndnet.EthtoolConfig `json:"ethtool,omitempty"`
+}
+
+// loadQoSConfig reads the file mapping pod QoS classes to their device defaults.
+func loadQoSConfig(path string) (map[v1.PodQOSClass]QoSDefaults, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read QoS configuration %s: %w", path, err)
+	}
+	config := map[v1.PodQOSClass]QoSDefaults{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&config); err != nil {
+		return nil, fmt.Errorf("failed to decode QoS configuration %s: %w", path, err)
+	}
+	for class, defaults := range config {
+		switch class {
+		case v1.PodQOSGuaranteed, v1.PodQOSBurstable, v1.PodQOSBestEffort:
+		default:
+			return nil, fmt.Errorf("invalid QoS class %q in %s", class, path)
+		}
+		if defaults.EgressRate != nil && defaults.EgressRate.Sign() <= 0 {
+			return nil, fmt.Errorf("invalid egress rate %s for QoS class %s", defaults.EgressRate.String(), class)
+		}
+		if defaults.Ethtool != nil {
+			if err := defaults.Ethtool.Validate(); err != nil {
+				return nil, fmt.Errorf("invalid ethtool settings for QoS class %s: %w", class, err)
+			}
+		}
+	}
+	return config, nil
+}
+
+// ethtoolConfig returns the ethtool settings of the device in the pod, the ones
+// of the device configuration or else the defaults of the pod QoS class. The
+// members of a bond and the ports of a bridge keep their settings, the
+// interface ones are not allowed on them.
+func (k *NetworkDriver) ethtoolConfig(device PreparedDevice, pod *api.PodSandbox) *kndnet.EthtoolConfig {
+	if device.Config.Ethtool != nil {
+		return device.Config.Ethtool
+	}
+	if device.Config.Bond != nil || device.Config.Mode == AttachModeBridge {
+		return nil
+	}
+	if defaults, ok := k.qosDefaults[podQOSClass(pod)]; ok {
+		return defaults.Ethtool
+	}
+	return nil
+}
+
+// podQOSClass derives the QoS class of a pod from the cgroup parent set by the
+// kubelet, kubepods/besteffort/pod<uid> or kubepods-besteffort-pod<uid>.slice
+// depending on the cgroup driver. Guaranteed pods live directly under kubepods.
+func podQOSClass(pod *api.PodSandbox) v1.PodQOSClass {
+	cgroupParent := strings.ToLower(pod.GetLinux().GetCgroupParent())
+	switch {
+	case strings.Contains(cgroupParent, "besteffort"):
+		return v1.PodQOSBestEffort
+	case strings.Contains(cgroupParent, "burstable"):
+		return v1.PodQOSBurstable
+	case strings.Contains(cgroupParent, "kubepods"):
+		return v1.PodQOSGuaranteed
+	}
+	return ""
+}
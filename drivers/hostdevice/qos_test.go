@@ -0,0 +1,128 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/containerd/nri/pkg/api"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	kndnet "github.com/aojea/kubernetes-network-drivers/pkg/net"
+)
+
+func Test_podQOSClass(t *testing.T) {
+	tests := []struct {
+		cgroupParent string
+		want         v1.PodQOSClass
+	}{
+		{cgroupParent: "/kubepods/besteffort/pod1234", want: v1.PodQOSBestEffort},
+		{cgroupParent: "kubepods-besteffort-pod1234.slice", want: v1.PodQOSBestEffort},
+		{cgroupParent: "/kubepods/burstable/pod1234", want: v1.PodQOSBurstable},
+		{cgroupParent: "kubepods-burstable-pod1234.slice", want: v1.PodQOSBurstable},
+		{cgroupParent: "/kubepods/pod1234", want: v1.PodQOSGuaranteed},
+		{cgroupParent: "kubepods-pod1234.slice", want: v1.PodQOSGuaranteed},
+		{cgroupParent: "", want: ""},
+	}
+	for _, tt := range tests {
+		pod := &api.PodSandbox{Linux: &api.LinuxPodSandbox{CgroupParent: tt.cgroupParent}}
+		if got := podQOSClass(pod); got != tt.want {
+			t.Errorf("podQOSClass(%q) = %q, want %q", tt.cgroupParent, got, tt.want)
+		}
+	}
+}
+
+func Test_loadQoSConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  string
+		want    map[v1.PodQOSClass]int64
+		wantErr bool
+	}{
+		{
+			name:   "rate limits",
+			config: `{"BestEffort":{"egressRate":"100M"},"Burstable":{"egressRate":"1G"},"Guaranteed":{}}`,
+			want:   map[v1.PodQOSClass]int64{v1.PodQOSBestEffort: 100000000, v1.PodQOSBurstable: 1000000000, v1.PodQOSGuaranteed: 0},
+		},
+		{
+			name:    "invalid class",
+			config:  `{"Besteffort":{"egressRate":"100M"}}`,
+			wantErr: true,
+		},
+		{
+			name:    "invalid rate",
+			config:  `{"BestEffort":{"egressRate":"-1"}}`,
+			wantErr: true,
+		},
+		{
+			name:   "offload features",
+			config: `{"BestEffort":{"egressRate":"100M","ethtool":{"features":{"generic-receive-offload":false}}}}`,
+			want:   map[v1.PodQOSClass]int64{v1.PodQOSBestEffort: 100000000},
+		},
+		{
+			name:    "invalid offload features",
+			config:  `{"BestEffort":{"ethtool":{}}}`,
+			wantErr: true,
+		},
+		{
+			name:    "unknown field",
+			config:  `{"BestEffort":{"ingressRate":"1M"}}`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "qos.json")
+			if err := os.WriteFile(path, []byte(tt.config), 0600); err != nil {
+				t.Fatal(err)
+			}
+			got, err := loadQoSConfig(path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("loadQoSConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("loadQoSConfig() = %v, want %v", got, tt.want)
+			}
+			for class, rate := range tt.want {
+				defaults := got[class]
+				var gotRate int64
+				if defaults.EgressRate != nil {
+					gotRate = defaults.EgressRate.Value()
+				}
+				if gotRate != rate {
+					t.Errorf("class %s: expected egress rate %d, got %d", class, rate, gotRate)
+				}
+			}
+		})
+	}
+}
+
+func Test_ethtoolConfig(t *testing.T) {
+	k := NewNetworkDriver(driverName, "node1", fake.NewClientset())
+	qosDefaults := &kndnet.EthtoolConfig{Features: map[string]bool{"generic-receive-offload": false}}
+	k.qosDefaults = map[v1.PodQOSClass]QoSDefaults{v1.PodQOSBestEffort: {Ethtool: qosDefaults}}
+	bestEffort := &api.PodSandbox{Linux: &api.LinuxPodSandbox{CgroupParent: "/kubepods/besteffort/pod1"}}
+	guaranteed := &api.PodSandbox{Linux: &api.LinuxPodSandbox{CgroupParent: "/kubepods/pod1"}}
+	configured := &kndnet.EthtoolConfig{RxRing: 4096}
+
+	tests := []struct {
+		name   string
+		device PreparedDevice
+		pod    *api.PodSandbox
+		want   *kndnet.EthtoolConfig
+	}{
+		{name: "qos default", device: PreparedDevice{DeviceName: "eth1"}, pod: bestEffort, want: qosDefaults},
+		{name: "class without defaults", device: PreparedDevice{DeviceName: "eth1"}, pod: guaranteed},
+		{name: "device configuration", device: PreparedDevice{DeviceName: "eth1", Config: DeviceConfig{Ethtool: configured}}, pod: bestEffort, want: configured},
+		{name: "bond member", device: PreparedDevice{DeviceName: "eth1", Config: DeviceConfig{Bond: &BondConfig{Members: []string{"eth1", "eth2"}}}}, pod: bestEffort},
+		{name: "bridge port", device: PreparedDevice{DeviceName: "eth1", Config: DeviceConfig{Mode: AttachModeBridge}}, pod: bestEffort},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := k.ethtoolConfig(tt.device, tt.pod); got != tt.want {
+				t.Errorf("ethtoolConfig() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
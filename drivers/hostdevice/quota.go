@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	v1 "k8s.io/api/core/v1"
+	resourceapi "k8s.io/api/resource/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// quotaExceededReason is the reason of the events of the claims denied by a namespace quota.
+const quotaExceededReason = "DeviceQuotaExceeded"
+
+// loadNamespaceQuotas reads the file mapping namespaces to the maximum number
+// of devices their pods can hold on the node.
+func loadNamespaceQuotas(path string) (map[string]int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read namespace quotas %s: %w", path, err)
+	}
+	quotas := map[string]int{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&quotas); err != nil {
+		return nil, fmt.Errorf("failed to decode namespace quotas %s: %w", path, err)
+	}
+	for namespace, quota := range quotas {
+		if errs := validation.IsDNS1123Label(namespace); len(errs) > 0 {
+			return nil, fmt.Errorf("invalid namespace %q in %s: %v", namespace, path, errs)
+		}
+		if quota < 0 {
+			return nil, fmt.Errorf("invalid quota %d for namespace %s, must be 0 or greater", quota, namespace)
+		}
+	}
+	return quotas, nil
+}
+
+// namespaceQuota returns the maximum number of devices of the namespace,
+// false if it is not limited.
+func (k *NetworkDriver) namespaceQuota(namespace string) (int, bool) {
+	if quota, ok := k.namespaceQuotas[namespace]; ok {
+		return quota, true
+	}
+	if k.defaultNamespaceQuota > 0 {
+		return k.defaultNamespaceQuota, true
+	}
+	return 0, false
+}
+
+// namespaceDevices returns the number of devices prepared for the claims of
+// the namespace, other than the claim with the given UID. The caller must
+// hold k.mu.
+func (k *NetworkDriver) namespaceDevices(namespace string, claimUID types.UID) int {
+	count := 0
+	for uid, devices := range k.sharedState.PreparedData {
+		if uid == claimUID {
+			continue
+		}
+		for _, device := range devices {
+			if device.Claim.Namespace == namespace {
+				count++
+			}
+		}
+	}
+	return count
+}
+
+// checkNamespaceQuota returns an error if preparing the devices of the claim
+// would exceed the quota of its namespace. The caller must hold k.mu.
+func (k *NetworkDriver) checkNamespaceQuota(claim *resourceapi.ResourceClaim, devices int) error {
+	quota, ok := k.namespaceQuota(claim.Namespace)
+	if !ok {
+		return nil
+	}
+	used := k.namespaceDevices(claim.Namespace, claim.UID)
+	if used+devices > quota {
+		return fmt.Errorf("namespace %s quota of %d devices exceeded: %d in use, claim %s requests %d",
+			claim.Namespace, quota, used, claim.Name, devices)
+	}
+	return nil
+}
+
+// recordQuotaExceeded emits a warning event on the claim denied by the namespace quota.
+func (k *NetworkDriver) recordQuotaExceeded(claim *resourceapi.ResourceClaim, err error) {
+	if k.eventRecorder == nil {
+		return
+	}
+	k.eventRecorder.Eventf(claim, v1.EventTypeWarning, quotaExceededReason, "Node %s: %v", k.nodeName, err)
+}
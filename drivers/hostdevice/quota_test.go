@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	resourceapi "k8s.io/api/resource/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/dynamic-resource-allocation/kubeletplugin"
+)
+
+func Test_namespaceQuota(t *testing.T) {
+	k := NewNetworkDriver(driverName, "node1", fake.NewClientset())
+	k.checkpointPath = ""
+	k.namespaceQuotas = map[string]int{"tenant-a": 1}
+	recorder := record.NewFakeRecorder(10)
+	k.eventRecorder = recorder
+
+	prepare := func(namespace, name string) error {
+		t.Helper()
+		claim := newClaimWithConfig()
+		claim.Namespace = namespace
+		claim.Name = name
+		claim.UID = types.UID(namespace + "-" + name)
+		results, err := k.PrepareResourceClaims(context.Background(), []*resourceapi.ResourceClaim{claim})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return results[claim.UID].Err
+	}
+
+	if err := prepare("tenant-a", "first"); err != nil {
+		t.Fatalf("unexpected error preparing the first claim: %v", err)
+	}
+	// preparing the same claim again does not count twice
+	if err := prepare("tenant-a", "first"); err != nil {
+		t.Fatalf("unexpected error preparing the first claim again: %v", err)
+	}
+	if err := prepare("tenant-a", "second"); err == nil {
+		t.Fatalf("expected the second claim to exceed the quota")
+	}
+	if _, ok := k.sharedState.PreparedData["tenant-a-second"]; ok {
+		t.Errorf("denied claim must not be prepared")
+	}
+	select {
+	case event := <-recorder.Events:
+		if !strings.Contains(event, quotaExceededReason) {
+			t.Errorf("unexpected event %q", event)
+		}
+	default:
+		t.Errorf("expected a %s event", quotaExceededReason)
+	}
+
+	// namespaces without a quota are not limited
+	if err := prepare("tenant-b", "first"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := prepare("tenant-b", "second"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// the default quota applies to the namespaces not listed
+	k.defaultNamespaceQuota = 2
+	if err := prepare("tenant-b", "third"); err == nil {
+		t.Fatalf("expected the default quota to be exceeded")
+	}
+
+	// releasing a claim frees its devices
+	if _, err := k.UnprepareResourceClaims(context.Background(), []kubeletplugin.NamespacedObject{{UID: "tenant-a-first"}}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := prepare("tenant-a", "second"); err != nil {
+		t.Fatalf("unexpected error after releasing the first claim: %v", err)
+	}
+}
+
+func Test_loadNamespaceQuotas(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    map[string]int
+		wantErr bool
+	}{
+		{name: "valid", content: `{"tenant-a": 2, "tenant-b": 0}`, want: map[string]int{"tenant-a": 2, "tenant-b": 0}},
+		{name: "negative quota", content: `{"tenant-a": -1}`, wantErr: true},
+		{name: "invalid namespace", content: `{"Tenant_A": 1}`, wantErr: true},
+		{name: "invalid json", content: `{"tenant-a": "two"}`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "quotas.json")
+			if err := os.WriteFile(path, []byte(tt.content), 0600); err != nil {
+				t.Fatal(err)
+			}
+			got, err := loadNamespaceQuotas(path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("loadNamespaceQuotas() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("loadNamespaceQuotas() = %v, want %v", got, tt.want)
+			}
+			for namespace, quota := range tt.want {
+				if got[namespace] != quota {
+					t.Errorf("quota of %s = %d, want %d", namespace, got[namespace], quota)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,18 @@
+package main
+
+import (
+	resourceapi "k8s.io/api/resource/v1"
+	"k8s.io/klog/v2"
+)
+
+// addRDMAAttribute publishes whether the device backing the host interface
+// ifName has an RDMA device, so the claims of RDMA workloads can select it.
+func (k *NetworkDriver) addRDMAAttribute(device *resourceapi.Device, ifName string) {
+	names, err := k.host.rdmaDevices(ifName)
+	if err != nil {
+		klog.V(2).Infof("failed to get RDMA devices of %s: %v", ifName, err)
+		return
+	}
+	rdma := len(names) > 0
+	device.Attributes["rdma"] = resourceapi.DeviceAttribute{BoolValue: &rdma}
+}
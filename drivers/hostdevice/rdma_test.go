@@ -0,0 +1,40 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	resourceapi "k8s.io/api/resource/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func Test_addRDMAAttribute(t *testing.T) {
+	k := NewNetworkDriver(driverName, "node1", fake.NewClientset())
+	k.host.rdmaDevices = func(ifName string) ([]string, error) {
+		switch ifName {
+		case "eth0":
+			return []string{"mlx5_0"}, nil
+		case "bad0":
+			return nil, errors.New("permission denied")
+		}
+		return nil, nil
+	}
+	rdma, noRDMA := true, false
+
+	tests := []struct {
+		ifName string
+		want   map[resourceapi.QualifiedName]resourceapi.DeviceAttribute
+	}{
+		{ifName: "eth0", want: map[resourceapi.QualifiedName]resourceapi.DeviceAttribute{"rdma": {BoolValue: &rdma}}},
+		{ifName: "dummy0", want: map[resourceapi.QualifiedName]resourceapi.DeviceAttribute{"rdma": {BoolValue: &noRDMA}}},
+		{ifName: "bad0", want: map[resourceapi.QualifiedName]resourceapi.DeviceAttribute{}},
+	}
+	for _, tt := range tests {
+		device := resourceapi.Device{Name: tt.ifName, Attributes: map[resourceapi.QualifiedName]resourceapi.DeviceAttribute{}}
+		k.addRDMAAttribute(&device, tt.ifName)
+		if !reflect.DeepEqual(device.Attributes, tt.want) {
+			t.Errorf("addRDMAAttribute(%s) = %v, want %v", tt.ifName, device.Attributes, tt.want)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/containerd/nri/pkg/api"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog/v2"
+)
+
+// readinessDirName is the directory in the plugin directory with the
+// readiness markers of the pods.
+const readinessDirName = "readiness"
+
+// validateReadinessPath returns an error if the directory of the readiness
+// markers in the containers is not an absolute clean path.
+func validateReadinessPath(path string) error {
+	if !filepath.IsAbs(path) || filepath.Clean(path) != path || path == "/" {
+		return fmt.Errorf("readinessPath %q must be a clean absolute directory other than /", path)
+	}
+	return nil
+}
+
+// podReadinessDir returns the directory on the node with the readiness
+// markers of the devices of the pod, mounted in its containers.
+func (k *NetworkDriver) podReadinessDir(podUID types.UID) string {
+	return filepath.Join(k.readinessDir, string(podUID))
+}
+
+// CreateContainer is called when a container is created by the Container
+// Runtime. The readiness markers of the devices of the pod are mounted in
+// the containers at the readinessPath of the devices.
+func (k *NetworkDriver) CreateContainer(ctx context.Context, pod *api.PodSandbox, ctr *api.Container) (*api.ContainerAdjustment, []*api.ContainerUpdate, error) {
+	podUID := types.UID(pod.Uid)
+	paths := sets.New[string]()
+	k.mu.Lock()
+	for _, device := range k.sharedState.PreparedData[podUID] {
+		if device.Config.ReadinessPath != "" {
+			paths.Insert(device.Config.ReadinessPath)
+		}
+	}
+	k.mu.Unlock()
+	if paths.Len() == 0 {
+		return nil, nil, nil
+	}
+
+	dir := k.podReadinessDir(podUID)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, nil, fmt.Errorf("failed to create the readiness directory of pod %s/%s: %w", pod.Namespace, pod.Name, err)
+	}
+	adjust := &api.ContainerAdjustment{}
+	for _, path := range sets.List(paths) {
+		klog.V(2).Infof("Mounting the readiness markers of pod %s/%s in container %s at %s", pod.Namespace, pod.Name, ctr.Name, path)
+		adjust.AddMount(&api.Mount{
+			Destination: path,
+			Source:      dir,
+			Type:        "bind",
+			Options:     []string{"rbind", "ro", "nosuid", "nodev", "noexec"},
+		})
+	}
+	return adjust, nil, nil
+}
+
+// writeReadinessMarker creates the readiness marker of a device configured
+// with a readinessPath, an empty file named after its interface in the pod,
+// once the interface is fully configured.
+func (k *NetworkDriver) writeReadinessMarker(podUID types.UID, device PreparedDevice) error {
+	if device.Config.ReadinessPath == "" {
+		return nil
+	}
+	dir := k.podReadinessDir(podUID)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create the readiness directory: %w", err)
+	}
+	// the marker is created with a rename so it is never seen half written
+	marker := filepath.Join(dir, device.podInterface())
+	if err := os.WriteFile(marker+".tmp", nil, 0644); err != nil {
+		return fmt.Errorf("failed to write the readiness marker of device %s: %w", device.DeviceName, err)
+	}
+	if err := os.Rename(marker+".tmp", marker); err != nil {
+		return fmt.Errorf("failed to write the readiness marker of device %s: %w", device.DeviceName, err)
+	}
+	klog.V(2).Infof("Device %s is ready in pod %s, marker %s", device.DeviceName, podUID, marker)
+	return nil
+}
+
+// removeReadinessMarker removes the readiness marker of a device before it
+// is returned to the host. Failures are logged.
+func (k *NetworkDriver) removeReadinessMarker(podUID types.UID, device PreparedDevice) {
+	if device.Config.ReadinessPath == "" {
+		return
+	}
+	marker := filepath.Join(k.podReadinessDir(podUID), device.podInterface())
+	if err := os.Remove(marker); err != nil && !errors.Is(err, os.ErrNotExist) {
+		klog.Errorf("failed to remove the readiness marker of device %s: %v", device.DeviceName, err)
+	}
+}
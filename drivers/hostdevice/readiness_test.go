@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/containerd/nri/pkg/api"
+	"github.com/vishvananda/netlink"
+	resourceapi "k8s.io/api/resource/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	kndnet "github.com/aojea/kubernetes-network-drivers/pkg/net"
+)
+
+func Test_podSandbox_readiness(t *testing.T) {
+	k := NewNetworkDriver(driverName, "node1", fake.NewClientset())
+	k.host.attachNetdev = func(hostIfName string, containerNsPath string, newAttr netlink.LinkAttrs, addresses []*net.IPNet, opts ...kndnet.AttachOption) (*resourceapi.NetworkDeviceData, error) {
+		return nil, nil
+	}
+	k.host.detachNetdev = func(containerNsPath string, devName string, outName string, opts ...kndnet.DetachOption) error {
+		return nil
+	}
+
+	k.checkpointPath = ""
+	k.readinessDir = t.TempDir()
+	podDir := filepath.Join(k.readinessDir, "pod-uid")
+	k.sharedState.PodDeviceConfig["pod-uid"] = []AllocatedDevice{{Name: "eth1"}, {Name: "eth2"}}
+	k.sharedState.PreparedData["pod-uid"] = []PreparedDevice{
+		{DeviceName: "eth1", Config: DeviceConfig{InterfaceName: "net1", ReadinessPath: "/run/knd"}},
+		// without readiness marker
+		{DeviceName: "eth2"},
+	}
+	pod := newTestSandbox("/run/netns/pod")
+
+	if err := k.RunPodSandbox(context.Background(), pod); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	entries, err := os.ReadDir(podDir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Name() != "net1" {
+		t.Fatalf("expected the marker of net1, got %v", entries)
+	}
+
+	adjust, _, err := k.CreateContainer(context.Background(), pod, &api.Container{Name: "app"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if adjust == nil || len(adjust.Mounts) != 1 || adjust.Mounts[0].Destination != "/run/knd" || adjust.Mounts[0].Source != podDir {
+		t.Fatalf("expected the readiness directory mounted at /run/knd, got %+v", adjust)
+	}
+
+	if err := k.StopPodSandbox(context.Background(), pod); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(podDir, "net1")); !os.IsNotExist(err) {
+		t.Errorf("expected the marker to be removed on stop, got %v", err)
+	}
+	if err := k.RemovePodSandbox(context.Background(), pod); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := os.Stat(podDir); !os.IsNotExist(err) {
+		t.Errorf("expected the readiness directory to be removed, got %v", err)
+	}
+
+	// containers of pods without readiness markers are not changed
+	adjust, _, err = k.CreateContainer(context.Background(), pod, &api.Container{Name: "app"})
+	if err != nil || adjust != nil {
+		t.Errorf("expected no adjustment, got %+v, %v", adjust, err)
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"slices"
+
+	"github.com/containerd/nri/pkg/api"
+	resourceapi "k8s.io/api/resource/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+)
+
+// rebuildPod is a running pod unknown to the driver, with the network
+// namespace of its sandbox.
+type rebuildPod struct {
+	pod              *api.PodSandbox
+	networkNamespace string
+}
+
+// rebuildState derives the state of the running pods unknown to the driver
+// from their ResourceClaims, for a driver started without a checkpoint: the
+// kubelet does not prepare the claims of the running pods again when only
+// the driver restarts. The configuration is parsed again from the claims and
+// a device is considered attached if its interface is in the pod network
+// namespace, and prepared if it is still on the host so it is attached again.
+// The devices that are in neither place, and the virtual functions, whose
+// interface moved into the pod is not known, are skipped.
+func (k *NetworkDriver) rebuildState(ctx context.Context, pods []*api.PodSandbox) {
+	var candidates []*api.PodSandbox
+	k.mu.Lock()
+	for _, pod := range pods {
+		if _, ok := k.sharedState.PodDeviceConfig[types.UID(pod.Uid)]; !ok {
+			candidates = append(candidates, pod)
+		}
+	}
+	k.mu.Unlock()
+	// resolving the namespace can pin it, it is done without the driver lock
+	unknown := map[types.UID]rebuildPod{}
+	for _, pod := range candidates {
+		if networkNamespace := k.getNetworkNamespace(pod); networkNamespace != "" {
+			unknown[types.UID(pod.Uid)] = rebuildPod{pod: pod, networkNamespace: networkNamespace}
+		}
+	}
+	if len(unknown) == 0 {
+		return
+	}
+
+	claims, err := k.kubeClient.ResourceV1().ResourceClaims(metav1.NamespaceAll).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		klog.Errorf("failed to list the claims to rebuild the state of the running pods: %v", err)
+		return
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	rebuilt := 0
+	for i := range claims.Items {
+		claim := &claims.Items[i]
+		if claim.Status.Allocation == nil {
+			continue
+		}
+		// prepared by the kubelet since the driver started
+		if _, ok := k.sharedState.PreparedData[claim.UID]; ok || len(k.assignedDevices(types.NamespacedName{Namespace: claim.Namespace, Name: claim.Name})) > 0 {
+			continue
+		}
+		for _, ref := range claim.Status.ReservedFor {
+			pod, ok := unknown[ref.UID]
+			if !ok || ref.Resource != "pods" {
+				continue
+			}
+			rebuilt += k.rebuildClaimDevices(pod.pod, pod.networkNamespace, claim)
+		}
+	}
+	if rebuilt == 0 {
+		return
+	}
+	klog.Infof("Rebuilt the state of %d devices of the running pods from their claims", rebuilt)
+	k.updateDeviceStateMetrics()
+	if err := k.saveCheckpoint(); err != nil {
+		klog.Errorf("failed to save checkpoint: %v", err)
+	}
+}
+
+// rebuildClaimDevices adds to the state of the running pod, with its sandbox
+// network namespace at networkNamespace, the devices of the node allocated
+// to it by the claim and returns how many. The caller must hold k.mu.
+func (k *NetworkDriver) rebuildClaimDevices(pod *api.PodSandbox, networkNamespace string, claim *resourceapi.ResourceClaim) int {
+	podUID := types.UID(pod.Uid)
+	rebuilt := 0
+	for _, result := range claim.Status.Allocation.Devices.Results {
+		if result.Driver != k.driverName || result.Pool != k.nodeName {
+			continue
+		}
+		if slices.ContainsFunc(k.sharedState.PodDeviceConfig[podUID], func(d AllocatedDevice) bool { return d.Name == result.Device }) {
+			continue
+		}
+		config, err := parseDeviceConfig(k.driverName, claim, result.Request)
+		if err != nil {
+			klog.Warningf("Not rebuilding device %q of pod %s/%s: %v", result.Device, pod.Namespace, pod.Name, err)
+			continue
+		}
+		if config.SriovVF {
+			klog.Warningf("Not rebuilding device %q of pod %s/%s, its virtual function is unknown", result.Device, pod.Namespace, pod.Name)
+			continue
+		}
+		prepared := PreparedDevice{
+			Claim:      types.NamespacedName{Namespace: claim.Namespace, Name: claim.Name},
+			DeviceName: result.Device,
+			PoolName:   result.Pool,
+			Group:      k.deviceGroupOf(result.Device),
+			Request:    result.Request,
+			Config:     config,
+			State:      DeviceStatePrepared,
+		}
+		// validated on prepare
+		prepared.Addresses, _ = parseIPs(config.IPs)
+		if parent, ok := k.macvlanSlotParent(result.Device); ok {
+			if err := prepareMacvlanSlot(&prepared, parent); err != nil {
+				klog.Warningf("Not rebuilding device %q of pod %s/%s: %v", result.Device, pod.Namespace, pod.Name, err)
+				continue
+			}
+		}
+		device := AllocatedDevice{Name: result.Device, PoolName: result.Pool, Request: result.Request}
+		if _, err := k.host.nsLinkInfo(networkNamespace, prepared.podInterface()); err == nil {
+			prepared.State = DeviceStateAttached
+			device.NetworkNamespace = networkNamespace
+			device.PodInterface = config.InterfaceName
+		} else if config.Child == nil && !k.host.hostLinkExists(prepared.hostInterface()) {
+			klog.Warningf("Not rebuilding device %q of pod %s/%s, it is neither in the pod nor on the host", result.Device, pod.Namespace, pod.Name)
+			continue
+		}
+		klog.Infof("Rebuilt device %q of claim %s of pod %s/%s as %s", result.Device, prepared.Claim, pod.Namespace, pod.Name, prepared.State)
+		k.sharedState.PodDeviceConfig[podUID] = append(k.sharedState.PodDeviceConfig[podUID], device)
+		k.sharedState.PreparedData[podUID] = append(k.sharedState.PreparedData[podUID], prepared)
+		k.sharedState.PodNames[podUID] = types.NamespacedName{Namespace: pod.Namespace, Name: pod.Name}
+		rebuilt++
+	}
+	return rebuilt
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/containerd/nri/pkg/api"
+	"github.com/vishvananda/netlink"
+	resourceapi "k8s.io/api/resource/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	kndnet "github.com/aojea/kubernetes-network-drivers/pkg/net"
+)
+
+func Test_synchronize_rebuildState(t *testing.T) {
+	// net1 is eth1 in the pod, eth2 is still on the host and eth3 is lost
+	inPod := map[string]bool{"net1": true}
+	var attached []string
+	claim := newClaimWithDevices("claim-uid", "eth1", "eth2", "eth3")
+	for i := range claim.Status.Allocation.Devices.Results {
+		claim.Status.Allocation.Devices.Results[i].Pool = "node1"
+	}
+	claim.Status.Allocation.Devices.Results[0].Request = "renamed"
+	// a device of another node
+	claim.Status.Allocation.Devices.Results = append(claim.Status.Allocation.Devices.Results,
+		resourceapi.DeviceRequestAllocationResult{Request: "nic", Driver: driverName, Pool: "node2", Device: "eth1"})
+	claim.Status.Allocation.Devices.Config = []resourceapi.DeviceAllocationConfiguration{
+		opaqueConfig(driverName, []string{"renamed"}, `{"interfaceName":"net1"}`),
+	}
+	claim.Status.Allocation.Devices.Config[0].Source = resourceapi.AllocationConfigSourceClaim
+	claim.Status.ReservedFor = []resourceapi.ResourceClaimConsumerReference{{Resource: "pods", Name: "pod", UID: "pod-uid"}}
+	k := NewNetworkDriver(driverName, "node1", fake.NewClientset(claim))
+	k.host.attachNetdev = func(hostIfName string, containerNsPath string, newAttr netlink.LinkAttrs, addresses []*net.IPNet, opts ...kndnet.AttachOption) (*resourceapi.NetworkDeviceData, error) {
+		attached = append(attached, hostIfName+" "+containerNsPath)
+		inPod[newAttr.Name] = true
+		return nil, nil
+	}
+	k.host.nsLinkInfo = func(containerNsPath string, ifName string) (*kndnet.LinkInfo, error) {
+		if containerNsPath != "/run/netns/pod" || !inPod[ifName] {
+			return nil, fmt.Errorf("link %s not found", ifName)
+		}
+		return &kndnet.LinkInfo{Carrier: true}, nil
+	}
+	k.host.hostLinkExists = func(ifName string) bool { return ifName == "eth2" }
+
+	k.checkpointPath = ""
+	if _, err := k.Synchronize(context.Background(), []*api.PodSandbox{newTestSandbox("/run/netns/pod")}, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var got []string
+	for _, device := range k.sharedState.PreparedData["pod-uid"] {
+		got = append(got, fmt.Sprintf("%s %s", device.DeviceName, device.State))
+	}
+	// eth2 is attached again by the synchronization
+	want := []string{"eth1 attached", "eth2 attached"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected devices %v, got %v", want, got)
+	}
+	if want := []string{"eth2 /run/netns/pod"}; !reflect.DeepEqual(attached, want) {
+		t.Errorf("expected %v attached, got %v", want, attached)
+	}
+	if got := k.sharedState.PodNames["pod-uid"].Name; got != "pod" {
+		t.Errorf("expected the name of the pod recorded, got %q", got)
+	}
+
+	// pods known to the driver are not rebuilt again
+	attached = nil
+	if _, err := k.Synchronize(context.Background(), []*api.PodSandbox{newTestSandbox("/run/netns/pod")}, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(k.sharedState.PreparedData["pod-uid"]) != 2 || len(attached) != 0 {
+		t.Errorf("expected the state to be kept, got %+v and %v attached", k.sharedState.PreparedData["pod-uid"], attached)
+	}
+}
+
+func Test_synchronize_rebuildState_pinnedNamespace(t *testing.T) {
+	claim := newClaimWithDevices("claim-uid", "eth1")
+	claim.Status.Allocation.Devices.Results[0].Pool = "node1"
+	claim.Status.ReservedFor = []resourceapi.ResourceClaimConsumerReference{{Resource: "pods", Name: "pod", UID: "pod-uid"}}
+	k := NewNetworkDriver(driverName, "node1", fake.NewClientset(claim))
+	k.netnsPinDir = t.TempDir()
+	var checked []string
+	k.host.isNetworkNamespace = func(path string) error {
+		// the namespace of the pod is resolved without the driver lock
+		if !k.mu.TryLock() {
+			t.Errorf("namespace %s checked under the driver lock", path)
+			return nil
+		}
+		k.mu.Unlock()
+		checked = append(checked, path)
+		return nil
+	}
+	k.host.nsLinkInfo = func(containerNsPath string, ifName string) (*kndnet.LinkInfo, error) {
+		return &kndnet.LinkInfo{Carrier: true}, nil
+	}
+
+	k.checkpointPath = ""
+	// the runtime does not report the namespaces of the sandbox
+	pod := newTestSandbox("")
+	pod.Id = "sandbox"
+	pod.Linux.Namespaces = nil
+	if _, err := k.Synchronize(context.Background(), []*api.PodSandbox{pod}, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := k.netnsPinDir + "/knd-sandbox"
+	if len(checked) == 0 || checked[0] != want {
+		t.Errorf("expected %s checked, got %v", want, checked)
+	}
+	if devices := k.sharedState.PodDeviceConfig["pod-uid"]; len(devices) != 1 || devices[0].NetworkNamespace != want {
+		t.Errorf("expected the device in the pinned namespace, got %+v", devices)
+	}
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog/v2"
+
+	kndnet "github.com/aojea/kubernetes-network-drivers/pkg/net"
+)
+
+// reconcileOrphanedPods periodically restores the devices of pods that no
+// longer exist. If a pod is deleted while the driver is down neither
+// StopPodSandbox nor RemovePodSandbox are delivered for it, so its state
+// would otherwise be leaked forever.
+func (k *NetworkDriver) reconcileOrphanedPods(ctx context.Context) {
+	ticker := time.NewTicker(k.reconcileInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := k.reconcileOnce(ctx); err != nil {
+				klog.Errorf("failed to reconcile orphaned pods: %v", err)
+			}
+		}
+	}
+}
+
+// reconcileOnce restores the devices and removes the state of the pods known
+// by the driver that are no longer scheduled on this node.
+func (k *NetworkDriver) reconcileOnce(ctx context.Context) error {
+	// Snapshot the known pods before listing, pods added after this point
+	// may not be present in the list yet and must not be considered. The
+	// prepared claims not assigned to a pod yet are not pods.
+	k.mu.Lock()
+	candidates := sets.New[types.UID]()
+	for podUID := range k.sharedState.PodDeviceConfig {
+		candidates.Insert(podUID)
+	}
+	for podUID := range k.sharedState.PreparedData {
+		if _, ok := k.sharedState.PodNames[podUID]; ok {
+			candidates.Insert(podUID)
+		}
+	}
+	k.mu.Unlock()
+	if candidates.Len() == 0 {
+		return nil
+	}
+
+	pods, err := k.podsOnNode(ctx)
+	if err != nil {
+		return err
+	}
+	candidates = candidates.Difference(pods)
+
+	for podUID := range candidates {
+		// a pod being run or stopped now is not orphaned and is checked
+		// again next time
+		unlock, ok := k.podLocks.tryLock(podUID)
+		if !ok {
+			continue
+		}
+		k.cleanupOrphanedPod(podUID)
+		unlock()
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.updateDeviceStateMetrics()
+	return k.saveCheckpoint()
+}
+
+// cleanupOrphanedPod restores the devices of a pod that no longer exists and
+// forgets it. The devices are restored without the driver lock, the caller
+// must hold the pod lock and not k.mu.
+func (k *NetworkDriver) cleanupOrphanedPod(podUID types.UID) {
+	k.mu.Lock()
+	_, hasDevices := k.sharedState.PodDeviceConfig[podUID]
+	_, hasData := k.sharedState.PreparedData[podUID]
+	devices := slices.Clone(k.sharedState.PodDeviceConfig[podUID])
+	preparedData := slices.Clone(k.sharedState.PreparedData[podUID])
+	k.mu.Unlock()
+	if !hasDevices && !hasData {
+		// removed meanwhile by the NRI hooks
+		return
+	}
+
+	k.sourceGroups.leavePod(podUID)
+	for _, device := range devices {
+		klog.Infof("Restoring device %q from orphaned pod %s", device.Name, podUID)
+		ifName := device.Name
+		if preparedDevice, ok := findPreparedDevice(preparedData, device.Name); ok {
+			if preparedDevice.Config.Child != nil {
+				// the parent never left the host
+				continue
+			}
+			ifName = preparedDevice.hostInterface()
+		}
+		release := k.netnsOps.acquire()
+		err := k.restoreDevice(device, ifName)
+		release()
+		if err != nil {
+			klog.Errorf("failed to restore device %s from orphaned pod %s: %v", device.Name, podUID, err)
+		}
+	}
+	for _, device := range devices {
+		if err := k.unpinNetworkNamespace(device.sandboxNamespace()); err != nil {
+			klog.Errorf("orphaned pod %s: %v", podUID, err)
+		}
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	delete(k.sharedState.PodDeviceConfig, podUID)
+	delete(k.sharedState.PreparedData, podUID)
+	delete(k.sharedState.PodNames, podUID)
+}
+
+// restoreDevice returns the host interface ifName of a device of a pod that
+// no longer exists to the host. If the pod network namespace is still around
+// the device is moved back, otherwise the kernel already returned it to the
+// host namespace when the namespace was destroyed and it only needs to be
+// recovered.
+func (k *NetworkDriver) restoreDevice(device AllocatedDevice, ifName string) error {
+	if device.NetworkNamespace != "" {
+		if _, err := os.Stat(device.NetworkNamespace); err == nil {
+			podIfName := ifName
+			if device.PodInterface != "" {
+				podIfName = device.PodInterface
+			}
+			if device.HardwareTimestamping != nil {
+				if err := k.host.nsSetHardwareTimestamping(device.NetworkNamespace, podIfName, *device.HardwareTimestamping); err != nil {
+					klog.Errorf("failed to restore the hardware timestamping of device %s: %v", ifName, err)
+				}
+			}
+			return k.host.detachNetdev(device.NetworkNamespace, podIfName, ifName, device.originalAttrs())
+		}
+	}
+	// restored before the device is set up again
+	if device.HardwareTimestamping != nil {
+		if err := kndnet.SetHardwareTimestamping(ifName, *device.HardwareTimestamping); err != nil {
+			klog.Errorf("failed to restore the hardware timestamping of device %s: %v", ifName, err)
+		}
+	}
+	return k.host.restoreNetdev(ifName, ifName, device.originalAttrs())
+}
+
+// podsOnNode returns the UIDs of the pods scheduled on this node.
+func (k *NetworkDriver) podsOnNode(ctx context.Context) (sets.Set[types.UID], error) {
+	pods, err := k.kubeClient.CoreV1().Pods(metav1.NamespaceAll).List(ctx, metav1.ListOptions{
+		FieldSelector: fields.OneTermEqualSelector("spec.nodeName", k.nodeName).String(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pods on node %s: %w", k.nodeName, err)
+	}
+	uids := sets.New[types.UID]()
+	for _, pod := range pods.Items {
+		if pod.Spec.NodeName != k.nodeName {
+			continue
+		}
+		uids.Insert(pod.UID)
+	}
+	return uids, nil
+}
+
+// cleanupOrphanedChildren removes the child interfaces (vlan, macvlan, ipvlan)
+// left in the host namespace by a previous instance of the driver that crashed
+// before moving them into a pod, or before deleting them on pod stop.
+func (k *NetworkDriver) cleanupOrphanedChildren(ctx context.Context) error {
+	children, err := kndnet.ListChildNetdevs()
+	if err != nil {
+		return err
+	}
+	if len(children) == 0 {
+		return nil
+	}
+	pods, err := k.podsOnNode(ctx)
+	if err != nil {
+		return err
+	}
+	for _, child := range orphanedChildren(children, pods) {
+		klog.Infof("Removing orphaned %s interface %s created for pod %s", child.Type, child.Name, child.Owner)
+		if err := kndnet.DeleteChildNetdev(child.Name); err != nil {
+			klog.Errorf("failed to remove orphaned interface %s: %v", child.Name, err)
+		}
+	}
+	return nil
+}
+
+// orphanedChildren returns the child interfaces whose owner pod is not running.
+func orphanedChildren(children []kndnet.ChildNetdev, pods sets.Set[types.UID]) []kndnet.ChildNetdev {
+	var orphans []kndnet.ChildNetdev
+	for _, child := range children {
+		if pods.Has(types.UID(child.Owner)) {
+			continue
+		}
+		orphans = append(orphans, child)
+	}
+	return orphans
+}
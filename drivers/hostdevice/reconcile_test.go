@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/kubernetes/fake"
+
+	kndnet "github.com/aojea/kubernetes-network-drivers/pkg/net"
+)
+
+func Test_reconcileOnce(t *testing.T) {
+	livePod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "live", Namespace: "default", UID: "live-uid"},
+		Spec:       v1.PodSpec{NodeName: "node1"},
+	}
+	otherNodePod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: "default", UID: "other-uid"},
+		Spec:       v1.PodSpec{NodeName: "node2"},
+	}
+	client := fake.NewClientset(livePod, otherNodePod)
+
+	k := NewNetworkDriver(driverName, "node1", client)
+	k.checkpointPath = filepath.Join(t.TempDir(), checkpointFile)
+	k.sharedState.PodDeviceConfig["live-uid"] = []AllocatedDevice{{Name: "eth1"}}
+	k.sharedState.PreparedData["live-uid"] = []PreparedDevice{{DeviceName: "eth1"}}
+	// the device does not exist on the host so the restore fails,
+	// the state must be removed anyway
+	k.sharedState.PodDeviceConfig["deleted-uid"] = []AllocatedDevice{{Name: "knd-missing0", NetworkNamespace: "/run/netns/does-not-exist"}}
+	k.sharedState.PreparedData["deleted-uid"] = []PreparedDevice{{DeviceName: "knd-missing0"}}
+	k.sharedState.PodDeviceConfig["other-uid"] = []AllocatedDevice{{Name: "knd-missing1"}}
+
+	if err := k.reconcileOnce(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, uid := range []types.UID{"deleted-uid", "other-uid"} {
+		if _, ok := k.sharedState.PodDeviceConfig[uid]; ok {
+			t.Errorf("expected devices of pod %s to be removed", uid)
+		}
+		if _, ok := k.sharedState.PreparedData[uid]; ok {
+			t.Errorf("expected prepared data of pod %s to be removed", uid)
+		}
+	}
+	if _, ok := k.sharedState.PodDeviceConfig["live-uid"]; !ok {
+		t.Errorf("expected devices of running pod to be kept")
+	}
+
+	// the reconciled state must have been persisted
+	restored := NewNetworkDriver(driverName, "node1", client)
+	restored.checkpointPath = k.checkpointPath
+	if err := restored.loadCheckpoint(); err != nil {
+		t.Fatalf("unexpected error loading checkpoint: %v", err)
+	}
+	if len(restored.sharedState.PodDeviceConfig) != 1 || len(restored.sharedState.PreparedData) != 1 {
+		t.Fatalf("unexpected checkpoint content: %+v", restored.sharedState)
+	}
+	if got := restored.sharedState.PreparedData["live-uid"][0].DeviceName; got != "eth1" {
+		t.Errorf("expected prepared device %q, got %q", "eth1", got)
+	}
+}
+
+func Test_orphanedChildren(t *testing.T) {
+	children := []kndnet.ChildNetdev{
+		{Name: "eth1.100", Type: "vlan", Owner: "live-uid"},
+		{Name: "mvlan0", Type: "macvlan", Owner: "deleted-uid"},
+		{Name: "ipvlan0", Type: "ipvlan", Owner: "other-uid"},
+	}
+	got := orphanedChildren(children, sets.New[types.UID]("live-uid", "unrelated-uid"))
+	want := []kndnet.ChildNetdev{children[1], children[2]}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("orphanedChildren() = %v, want %v", got, want)
+	}
+}
+
+func Test_restoreDevice(t *testing.T) {
+	var steps []string
+	k := NewNetworkDriver(driverName, "node1", fake.NewClientset())
+	k.host.nsSetHardwareTimestamping = func(containerNsPath string, ifName string, config kndnet.HardwareTimestamping) error {
+		steps = append(steps, "timestamping "+ifName+" "+config.TxType)
+		return nil
+	}
+	k.host.detachNetdev = func(containerNsPath string, devName string, outName string, opts ...kndnet.DetachOption) error {
+		steps = append(steps, "detach "+devName+" "+outName)
+		return nil
+	}
+	// the pod network namespace is still around
+	networkNamespace := filepath.Join(t.TempDir(), "netns")
+	if err := os.WriteFile(networkNamespace, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	device := AllocatedDevice{
+		Name:                 "eth1",
+		NetworkNamespace:     networkNamespace,
+		PodInterface:         "net1",
+		HardwareTimestamping: &kndnet.HardwareTimestamping{TxType: "off", RxFilter: "none"},
+	}
+	if err := k.restoreDevice(device, "eth1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []string{"timestamping net1 off", "detach net1 eth1"}
+	if !reflect.DeepEqual(steps, want) {
+		t.Errorf("expected %v, got %v", want, steps)
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"cmp"
+	"net/http"
+	"slices"
+	"time"
+
+	resourceapi "k8s.io/api/resource/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+// NodeReport summarizes the network devices of the node handled by the
+// driver, for support and dashboards.
+type NodeReport struct {
+	Node   string    `json:"node"`
+	Driver string    `json:"driver"`
+	Time   time.Time `json:"time"`
+	// Publish is the health of the ResourceSlice publication.
+	Publish PublishStatus `json:"publish"`
+	// Devices are the devices of the last publication with their attributes.
+	Devices []resourceapi.Device `json:"devices"`
+	// Allocations are the devices prepared for the claims, by pod.
+	Allocations []DeviceAllocation `json:"allocations"`
+	// Reserved are the host interfaces withheld from the publication while
+	// they are prepared for a claim.
+	Reserved []string `json:"reserved"`
+	// Bandwidth is the egress rate committed on the devices.
+	Bandwidth []DeviceBandwidth `json:"bandwidth,omitempty"`
+}
+
+// PublishStatus is the outcome of the ResourceSlice publications.
+type PublishStatus struct {
+	// Published is true after the first successful publication.
+	Published     bool       `json:"published"`
+	LastPublished *time.Time `json:"lastPublished,omitempty"`
+	LastError     string     `json:"lastError,omitempty"`
+	LastErrorTime *time.Time `json:"lastErrorTime,omitempty"`
+}
+
+// DeviceAllocation is a device prepared for a claim, assigned to a pod once
+// the pod sandbox runs.
+type DeviceAllocation struct {
+	Device  string      `json:"device"`
+	Claim   string      `json:"claim"`
+	Request string      `json:"request,omitempty"`
+	State   DeviceState `json:"state"`
+	// Pod is the namespace and name of the pod, empty until it runs.
+	Pod    string    `json:"pod,omitempty"`
+	PodUID types.UID `json:"podUID,omitempty"`
+	// Interface is the interface of the device in the pod.
+	Interface string `json:"interface,omitempty"`
+}
+
+// DeviceBandwidth is the egress rate committed on a device, in bits per
+// second, and its link speed when known.
+type DeviceBandwidth struct {
+	Device    string `json:"device"`
+	Committed int64  `json:"committed"`
+	Capacity  int64  `json:"capacity,omitempty"`
+}
+
+// nodeReport composes the report from the state of the driver, without
+// discovering the devices again nor entering the pod network namespaces.
+func (k *NetworkDriver) nodeReport(now time.Time) NodeReport {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	report := NodeReport{
+		Node:        k.nodeName,
+		Driver:      k.driverName,
+		Time:        now,
+		Publish:     k.publishStatus,
+		Devices:     slices.Clone(k.lastDevices),
+		Allocations: []DeviceAllocation{},
+		Reserved:    sets.List(k.reservedDevices()),
+	}
+	report.Publish.Published = k.published.Load()
+	if report.Devices == nil {
+		report.Devices = []resourceapi.Device{}
+	}
+
+	// the devices of a claim are under the claim until they are assigned to
+	// the pod when it runs
+	for uid, preparedData := range k.sharedState.PreparedData {
+		pod, assigned := k.sharedState.PodNames[uid]
+		for _, device := range preparedData {
+			allocation := DeviceAllocation{
+				Device:  device.DeviceName,
+				Claim:   device.Claim.String(),
+				Request: device.Request,
+				State:   device.State,
+			}
+			if assigned {
+				allocation.Pod = pod.String()
+				allocation.PodUID = uid
+				allocation.Interface = device.podInterface()
+			}
+			report.Allocations = append(report.Allocations, allocation)
+		}
+	}
+	slices.SortFunc(report.Allocations, func(a, b DeviceAllocation) int {
+		return cmp.Or(cmp.Compare(a.Pod, b.Pod), cmp.Compare(a.Claim, b.Claim), cmp.Compare(a.Device, b.Device))
+	})
+
+	for name, rate := range k.deviceBandwidth("") {
+		bandwidth := DeviceBandwidth{Device: name, Committed: rate}
+		if speed, err := k.host.linkSpeed(name); err == nil && speed > 0 {
+			bandwidth.Capacity = int64(speed) * 1e6
+		}
+		report.Bandwidth = append(report.Bandwidth, bandwidth)
+	}
+	slices.SortFunc(report.Bandwidth, func(a, b DeviceBandwidth) int { return cmp.Compare(a.Device, b.Device) })
+	return report
+}
+
+// nodeReportHandler serves GET /status/node with the report of the node.
+func (k *NetworkDriver) nodeReportHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /status/node", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, k.nodeReport(time.Now()))
+	})
+	return mux
+}
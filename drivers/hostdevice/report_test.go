@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	resourceapi "k8s.io/api/resource/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func Test_nodeReportHandler(t *testing.T) {
+	k := NewNetworkDriver(driverName, "node1", fake.NewClientset())
+	k.host.linkSpeed = func(ifName string) (int, error) {
+		if ifName == "eth1" {
+			return 10000, nil
+		}
+		return -1, errors.New("unknown")
+	}
+
+	k.checkpointPath = ""
+	k.reserveDevices = true
+	publisher := &fakePublisher{err: errors.New("publisher stopped")}
+	k.publisher = publisher
+	if err := k.publishOnce(context.Background()); err == nil {
+		t.Fatal("expected the publication to fail")
+	}
+	k.lastDevices = []resourceapi.Device{newSimulatedDevice("eth3", 0, false, 0)}
+
+	claim := types.NamespacedName{Namespace: "default", Name: "claim"}
+	rate := resource.MustParse("1G")
+	// eth1 is assigned to the pod, eth2 is prepared for a pod not running yet
+	k.sharedState.PreparedData["pod-uid"] = []PreparedDevice{
+		{Claim: claim, DeviceName: "eth1", Request: "nic", State: DeviceStateAttached, Config: DeviceConfig{EgressRate: &rate, InterfaceName: "net1"}},
+	}
+	k.sharedState.PodDeviceConfig["pod-uid"] = []AllocatedDevice{{Name: "eth1", Request: "nic"}}
+	k.sharedState.PodNames["pod-uid"] = types.NamespacedName{Namespace: "default", Name: "pod"}
+	k.sharedState.PreparedData["other-uid"] = []PreparedDevice{
+		{Claim: types.NamespacedName{Namespace: "default", Name: "other"}, DeviceName: "eth2", Request: "nic", State: DeviceStatePrepared},
+	}
+
+	server := httptest.NewServer(k.nodeReportHandler())
+	defer server.Close()
+	resp, err := http.Get(server.URL + "/status/node")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, resp.StatusCode)
+	}
+	var report NodeReport
+	if err := json.NewDecoder(resp.Body).Decode(&report); err != nil {
+		t.Fatal(err)
+	}
+
+	if report.Node != "node1" || report.Driver != driverName {
+		t.Errorf("unexpected node %q and driver %q", report.Node, report.Driver)
+	}
+	if report.Publish.Published || report.Publish.LastError != "publisher stopped" || report.Publish.LastErrorTime == nil || report.Publish.LastPublished != nil {
+		t.Errorf("expected the failed publication in the publish status, got %+v", report.Publish)
+	}
+	if len(report.Devices) != 1 || report.Devices[0].Name != "eth3" || report.Devices[0].Attributes["numa-node"].IntValue == nil {
+		t.Errorf("expected the published device eth3 with its attributes, got %+v", report.Devices)
+	}
+	wantAllocations := []DeviceAllocation{
+		{Device: "eth2", Claim: "default/other", Request: "nic", State: DeviceStatePrepared},
+		{Device: "eth1", Claim: "default/claim", Request: "nic", State: DeviceStateAttached, Pod: "default/pod", PodUID: "pod-uid", Interface: "net1"},
+	}
+	if !reflect.DeepEqual(report.Allocations, wantAllocations) {
+		t.Errorf("expected allocations %+v, got %+v", wantAllocations, report.Allocations)
+	}
+	if want := []string{"eth1", "eth2"}; !reflect.DeepEqual(report.Reserved, want) {
+		t.Errorf("expected reserved devices %v, got %v", want, report.Reserved)
+	}
+	wantBandwidth := []DeviceBandwidth{{Device: "eth1", Committed: 1e9, Capacity: 1e10}}
+	if !reflect.DeepEqual(report.Bandwidth, wantBandwidth) {
+		t.Errorf("expected bandwidth %+v, got %+v", wantBandwidth, report.Bandwidth)
+	}
+
+	publisher.err = nil
+	if err := k.publishOnce(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if report := k.nodeReport(report.Time); !report.Publish.Published || report.Publish.LastPublished == nil {
+		t.Errorf("expected the successful publication in the publish status, got %+v", report.Publish)
+	}
+}
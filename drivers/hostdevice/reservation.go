@@ -0,0 +1,40 @@
+package main
+
+import (
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+// reservedDevices returns the host interfaces of the devices prepared for a
+// claim and not yet returned by a pod stop. They are withheld from the
+// published devices until released, so claims allocated before the next
+// publication cannot target them. Child interfaces share their parent and
+// never reserve it, a macvlan slot only reserves itself. The reservations are derived from the prepared data and
+// persisted with it in the checkpoint. The caller must hold k.mu.
+func (k *NetworkDriver) reservedDevices() sets.Set[string] {
+	reserved := sets.New[string]()
+	if !k.reserveDevices {
+		return reserved
+	}
+	for _, devices := range k.sharedState.PreparedData {
+		for _, device := range devices {
+			if device.MacvlanParent != "" && device.State != DeviceStateDetached {
+				reserved.Insert(device.DeviceName)
+				continue
+			}
+			if device.Config.Child != nil || device.State == DeviceStateDetached {
+				continue
+			}
+			reserved.Insert(device.hostInterface())
+		}
+	}
+	return reserved
+}
+
+// requestRepublish asks for a publication before the next period, without
+// blocking if one is already pending.
+func (k *NetworkDriver) requestRepublish() {
+	select {
+	case k.republish <- struct{}{}:
+	default:
+	}
+}
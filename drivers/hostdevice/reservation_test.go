@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	resourceapi "k8s.io/api/resource/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/dynamic-resource-allocation/kubeletplugin"
+)
+
+func Test_reservedDevices(t *testing.T) {
+	k := NewNetworkDriver(driverName, "node1", fake.NewClientset())
+	k.checkpointPath = filepath.Join(t.TempDir(), checkpointFile)
+	k.reserveDevices = true
+
+	assertReserved := func(k *NetworkDriver, want ...string) {
+		t.Helper()
+		k.mu.Lock()
+		got := k.reservedDevices()
+		k.mu.Unlock()
+		if !got.Equal(sets.New(want...)) {
+			t.Errorf("expected reserved devices %v, got %v", want, sets.List(got))
+		}
+	}
+	assertRepublish := func() {
+		t.Helper()
+		select {
+		case <-k.republish:
+		default:
+			t.Errorf("expected a publication to be requested")
+		}
+	}
+
+	claim := newClaimWithConfig()
+	claim.Name = "claim"
+	claim.UID = "claim-uid"
+	child := newClaimWithConfig(opaqueConfig(driverName, nil, `{"child":{"type":"macvlan"}}`))
+	child.Name = "child"
+	child.UID = "child-uid"
+	child.Status.Allocation.Devices.Results[0].Device = "eth2"
+	results, err := k.PrepareResourceClaims(context.Background(), []*resourceapi.ResourceClaim{claim, child})
+	if err != nil || results[claim.UID].Err != nil || results[child.UID].Err != nil {
+		t.Fatalf("unexpected error preparing claims: %v %v", err, results)
+	}
+	// the parent of a child interface is shared and not reserved
+	assertReserved(k, "eth1")
+	assertRepublish()
+
+	// the reservations survive a restart
+	restored := NewNetworkDriver(driverName, "node1", fake.NewClientset())
+	restored.checkpointPath = k.checkpointPath
+	restored.reserveDevices = true
+	if err := restored.loadCheckpoint(); err != nil {
+		t.Fatalf("unexpected error loading checkpoint: %v", err)
+	}
+	assertReserved(restored, "eth1")
+
+	// devices returned by a pod stop are released
+	k.mu.Lock()
+	k.setDeviceState(claim.UID, DeviceStateDetached)
+	k.mu.Unlock()
+	assertReserved(k)
+
+	k.mu.Lock()
+	k.setDeviceState(claim.UID, DeviceStateAttached)
+	k.mu.Unlock()
+	if _, err := k.UnprepareResourceClaims(context.Background(), []kubeletplugin.NamespacedObject{{UID: claim.UID}}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	assertReserved(k)
+	assertRepublish()
+
+	// reservations are disabled by default
+	k.reserveDevices = false
+	if _, err := k.PrepareResourceClaims(context.Background(), []*resourceapi.ResourceClaim{claim}); err != nil {
+		t.Fatalf("unexpected error preparing claim: %v", err)
+	}
+	assertReserved(k)
+}
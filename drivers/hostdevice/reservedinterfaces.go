@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+
+	"golang.org/x/sys/unix"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/yaml"
+)
+
+// loadReservedInterfaces returns the interface names of the YAML or JSON list
+// in the file at path.
+func loadReservedInterfaces(path string) (sets.Set[string], error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read reserved interfaces %s: %w", path, err)
+	}
+	var names []string
+	if err := yaml.UnmarshalStrict(data, &names); err != nil {
+		return nil, fmt.Errorf("failed to decode reserved interfaces %s: %w", path, err)
+	}
+	for _, name := range names {
+		if !validInterfaceName(name) {
+			return nil, fmt.Errorf("invalid interface name %q in the reserved interfaces %s", name, path)
+		}
+	}
+	return sets.New(names...), nil
+}
+
+// isReservedInterface returns true if the interface is in the reserved
+// interfaces file.
+func (k *NetworkDriver) isReservedInterface(name string) bool {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return k.reservedInterfaces.Has(name)
+}
+
+// reloadReservedInterfaces reads the reserved interfaces file again and
+// requests a new publication if it changed. The previous list is kept if the
+// file is invalid.
+func (k *NetworkDriver) reloadReservedInterfaces() {
+	reserved, err := loadReservedInterfaces(k.reservedInterfacesFile)
+	if err != nil {
+		klog.Errorf("Keeping the previous reserved interfaces: %v", err)
+		return
+	}
+	k.mu.Lock()
+	changed := !reserved.Equal(k.reservedInterfaces)
+	k.reservedInterfaces = reserved
+	k.mu.Unlock()
+	if !changed {
+		return
+	}
+	klog.Infof("Reserved interfaces changed to %v", sets.List(reserved))
+	k.requestRepublish()
+}
+
+// watchReservedInterfaces reloads the reserved interfaces file on SIGHUP
+// until the context is done.
+func (k *NetworkDriver) watchReservedInterfaces(ctx context.Context) {
+	// registered before returning so an early SIGHUP does not kill the driver
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, unix.SIGHUP)
+	go func() {
+		defer signal.Stop(hangup)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-hangup:
+				klog.Infof("Reloading the reserved interfaces from %s", k.reservedInterfacesFile)
+				k.reloadReservedInterfaces()
+			}
+		}
+	}()
+}
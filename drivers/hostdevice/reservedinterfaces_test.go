@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func Test_loadReservedInterfaces(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    sets.Set[string]
+		wantErr bool
+	}{
+		{name: "yaml", content: "- eth1\n- eth2\n", want: sets.New("eth1", "eth2")},
+		{name: "json", content: `["eth1"]`, want: sets.New("eth1")},
+		{name: "empty", content: "[]", want: sets.New[string]()},
+		{name: "invalid name", content: `["eth/1"]`, wantErr: true},
+		{name: "not a list", content: `{"eth1": true}`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "reserved.yaml")
+			if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			got, err := loadReservedInterfaces(path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("loadReservedInterfaces() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !got.Equal(tt.want) {
+				t.Errorf("loadReservedInterfaces() = %v, want %v", sets.List(got), sets.List(tt.want))
+			}
+		})
+	}
+	if _, err := loadReservedInterfaces(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Errorf("expected an error for a missing file")
+	}
+}
+
+func Test_watchReservedInterfaces(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "reserved.yaml")
+	if err := os.WriteFile(path, []byte("- eth1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	k := NewNetworkDriver(driverName, "node1", fake.NewClientset())
+	k.reservedInterfacesFile = path
+	var err error
+	if k.reservedInterfaces, err = loadReservedInterfaces(path); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	k.watchReservedInterfaces(ctx)
+
+	hangup := func(content string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := unix.Kill(os.Getpid(), unix.SIGHUP); err != nil {
+			t.Fatal(err)
+		}
+	}
+	hangup("- eth2\n")
+	select {
+	case <-k.republish:
+	case <-time.After(wait.ForeverTestTimeout):
+		t.Fatalf("expected a publication after the reserved interfaces changed")
+	}
+	if k.isReservedInterface("eth1") || !k.isReservedInterface("eth2") {
+		t.Errorf("unexpected reserved interfaces %v", sets.List(k.reservedInterfaces))
+	}
+
+	// an invalid file keeps the previous list
+	hangup("- eth/3\n")
+	select {
+	case <-k.republish:
+		t.Errorf("unexpected publication for an invalid file")
+	case <-time.After(100 * time.Millisecond):
+	}
+	if !k.isReservedInterface("eth2") {
+		t.Errorf("expected the previous reserved interfaces, got %v", sets.List(k.reservedInterfaces))
+	}
+}
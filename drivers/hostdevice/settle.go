@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"golang.org/x/sys/unix"
+	"k8s.io/klog/v2"
+)
+
+// hostUptime returns the time since the node booted.
+func hostUptime() (time.Duration, error) {
+	var info unix.Sysinfo_t
+	if err := unix.Sysinfo(&info); err != nil {
+		return 0, err
+	}
+	return time.Duration(info.Uptime) * time.Second, nil
+}
+
+// waitBootSettle delays the first publication until the settle delay has
+// passed since the node booted. The interfaces appear gradually on boot and
+// are renamed by udev, publishing them right away makes the ResourceSlice
+// churn with devices that disappear moments later. A driver restarted on a
+// node that booted long ago does not wait. It returns false if the context
+// is done before.
+func (k *NetworkDriver) waitBootSettle(ctx context.Context) bool {
+	if k.bootSettleDelay <= 0 {
+		return true
+	}
+	uptime, err := k.host.hostUptime()
+	if err != nil {
+		klog.Errorf("failed to get the node uptime, not waiting for the devices to settle: %v", err)
+		return true
+	}
+	remaining := k.bootSettleDelay - uptime
+	if remaining <= 0 {
+		return true
+	}
+	klog.Infof("Node booted %s ago, waiting %s for the devices to settle before publishing them", uptime, remaining)
+	timer := time.NewTimer(remaining)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		klog.Infof("Devices settled, publishing them")
+		return true
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/dynamic-resource-allocation/resourceslice"
+)
+
+// countingPublisher signals every publication.
+type countingPublisher struct {
+	published chan struct{}
+}
+
+func (c *countingPublisher) PublishResources(ctx context.Context, resources resourceslice.DriverResources) error {
+	c.published <- struct{}{}
+	return nil
+}
+
+func Test_waitBootSettle(t *testing.T) {
+	tests := []struct {
+		name      string
+		delay     time.Duration
+		uptime    time.Duration
+		uptimeErr error
+		wantWait  time.Duration
+	}{
+		{name: "disabled", uptime: time.Second},
+		{name: "booted long ago", delay: time.Minute, uptime: time.Hour},
+		{name: "uptime unknown", delay: time.Minute, uptimeErr: errors.New("boom")},
+		{name: "booting", delay: time.Minute, uptime: time.Minute - 200*time.Millisecond, wantWait: 200 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k := NewNetworkDriver(driverName, "node1", fake.NewClientset())
+			k.host.hostUptime = func() (time.Duration, error) { return tt.uptime, tt.uptimeErr }
+
+			k.bootSettleDelay = tt.delay
+			start := time.Now()
+			if !k.waitBootSettle(context.Background()) {
+				t.Fatalf("expected the devices to settle")
+			}
+			elapsed := time.Since(start)
+			if elapsed < tt.wantWait || (tt.wantWait == 0 && elapsed > 100*time.Millisecond) {
+				t.Errorf("expected to wait %s, waited %s", tt.wantWait, elapsed)
+			}
+		})
+	}
+
+	t.Run("cancelled", func(t *testing.T) {
+		k := NewNetworkDriver(driverName, "node1", fake.NewClientset())
+		k.host.hostUptime = func() (time.Duration, error) { return 0, nil }
+
+		k.bootSettleDelay = time.Hour
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if k.waitBootSettle(ctx) {
+			t.Errorf("expected the wait to be cancelled")
+		}
+	})
+}
+
+func Test_publishResources_bootSettle(t *testing.T) {
+	k := NewNetworkDriver(driverName, "node1", fake.NewClientset())
+	k.host.hostUptime = func() (time.Duration, error) { return 0, nil }
+
+	publisher := &countingPublisher{published: make(chan struct{}, 10)}
+	k.publisher = publisher
+	k.bootSettleDelay = 300 * time.Millisecond
+	// publish the unchanged devices on every request
+	k.forcePublishAfter = 0
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go k.publishResources(ctx)
+
+	// the devices changing meanwhile are not published before they settle
+	k.requestRepublish()
+	select {
+	case <-publisher.published:
+		t.Fatalf("devices published before the settle delay")
+	case <-time.After(100 * time.Millisecond):
+	}
+	select {
+	case <-publisher.published:
+	case <-time.After(wait.ForeverTestTimeout):
+		t.Fatalf("devices not published after the settle delay")
+	}
+
+	// later changes are published right away
+	k.requestRepublish()
+	select {
+	case <-publisher.published:
+	case <-time.After(deviceCheckInterval / 2):
+		t.Fatalf("republish request not served after the settle delay")
+	}
+}
@@ -0,0 +1,301 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"slices"
+	"strings"
+
+	resourceapi "k8s.io/api/resource/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/dynamic-resource-allocation/cel"
+)
+
+const (
+	// maxSimulationBody bounds the size of a simulation request.
+	maxSimulationBody = 64 << 10
+	// maxSimulationCount bounds the number of devices of a simulation
+	// request, like the limit of the devices allocated for a claim.
+	maxSimulationCount = resourceapi.AllocationResultsMaxSize
+	// maxSimulationSteps bounds the devices tried by the allocation search,
+	// the endpoint is not authenticated and the search is exponential in
+	// the worst case.
+	maxSimulationSteps = 100000
+)
+
+// errSearchLimit is returned when the allocation search tries more than
+// maxSimulationSteps devices.
+var errSearchLimit = errors.New("allocation search gave up")
+
+// SimulationRequest is a hypothetical claim matched against the devices the
+// node publishes.
+type SimulationRequest struct {
+	// Requests are the device requests of the claim.
+	Requests []SimulatedDeviceRequest `json:"requests"`
+	// Constraints apply to the devices allocated for several requests.
+	Constraints []SimulatedConstraint `json:"constraints,omitempty"`
+}
+
+// SimulatedDeviceRequest selects devices with the CEL selectors of the
+// device requests of a claim.
+type SimulatedDeviceRequest struct {
+	// Name identifies the request in the constraints and the result.
+	Name string `json:"name"`
+	// Count is the number of devices requested, 1 by default.
+	Count int `json:"count,omitempty"`
+	// Selectors must all match the device.
+	Selectors []resourceapi.DeviceSelector `json:"selectors,omitempty"`
+}
+
+// SimulatedConstraint requires the devices of the requests to have the same
+// value of an attribute.
+type SimulatedConstraint struct {
+	// Requests the constraint applies to, all of them if empty.
+	Requests []string `json:"requests,omitempty"`
+	// MatchAttribute is the attribute all the devices must have with the same value.
+	MatchAttribute resourceapi.QualifiedName `json:"matchAttribute"`
+}
+
+// SimulationResult are the devices of the node that satisfy the requests.
+type SimulationResult struct {
+	// Satisfiable is true if the node can allocate the whole claim.
+	Satisfiable bool `json:"satisfiable"`
+	// Matching are the devices matching each request, regardless of the
+	// count and the constraints.
+	Matching map[string][]string `json:"matching"`
+	// Allocation is a possible allocation of the claim when it is satisfiable.
+	Allocation map[string][]string `json:"allocation,omitempty"`
+}
+
+// validate checks the requests and constraints and sets the default count.
+func (r *SimulationRequest) validate() error {
+	if len(r.Requests) == 0 {
+		return fmt.Errorf("no requests")
+	}
+	total := 0
+	names := sets.New[string]()
+	for i := range r.Requests {
+		request := &r.Requests[i]
+		if request.Name == "" {
+			return fmt.Errorf("request %d has no name", i)
+		}
+		if names.Has(request.Name) {
+			return fmt.Errorf("duplicate request %q", request.Name)
+		}
+		names.Insert(request.Name)
+		if request.Count < 0 {
+			return fmt.Errorf("invalid count %d of request %q", request.Count, request.Name)
+		}
+		if request.Count == 0 {
+			request.Count = 1
+		}
+		if total += request.Count; total > maxSimulationCount {
+			return fmt.Errorf("more than %d devices requested", maxSimulationCount)
+		}
+		for j, selector := range request.Selectors {
+			if selector.CEL == nil || selector.CEL.Expression == "" {
+				return fmt.Errorf("selector %d of request %q has no CEL expression", j, request.Name)
+			}
+		}
+	}
+	for _, constraint := range r.Constraints {
+		if constraint.MatchAttribute == "" {
+			return fmt.Errorf("constraint without matchAttribute")
+		}
+		for _, name := range constraint.Requests {
+			if !names.Has(name) {
+				return fmt.Errorf("constraint on %s references unknown request %q", constraint.MatchAttribute, name)
+			}
+		}
+	}
+	return nil
+}
+
+// localName removes the driver domain from a qualified name, the devices
+// are published with the names of the driver without domain.
+func (k *NetworkDriver) localName(name resourceapi.QualifiedName) resourceapi.QualifiedName {
+	return resourceapi.QualifiedName(strings.TrimPrefix(string(name), k.driverName+"/"))
+}
+
+// compileSelectors compiles the CEL selectors of each request, with the
+// compiler and the cost limit of the scheduler.
+func compileSelectors(request SimulationRequest) ([][]cel.CompilationResult, error) {
+	compiler := cel.GetCompiler(cel.Features{})
+	selectors := make([][]cel.CompilationResult, len(request.Requests))
+	for i, r := range request.Requests {
+		for j, selector := range r.Selectors {
+			result := compiler.CompileCELExpression(selector.CEL.Expression, cel.Options{})
+			if result.Error != nil {
+				return nil, fmt.Errorf("selector %d of request %q: %w", j, r.Name, result.Error)
+			}
+			selectors[i] = append(selectors[i], result)
+		}
+	}
+	return selectors, nil
+}
+
+// deviceMatches returns true if all the selectors match the device, the
+// attributes and capacity names without a domain are of the driver.
+func (k *NetworkDriver) deviceMatches(ctx context.Context, device resourceapi.Device, selectors []cel.CompilationResult) (bool, error) {
+	input := cel.Device{Driver: k.driverName, Attributes: device.Attributes, Capacity: device.Capacity}
+	for _, selector := range selectors {
+		matches, _, err := selector.DeviceMatches(ctx, input)
+		if err != nil {
+			return false, fmt.Errorf("selector %q on device %s: %w", selector.Expression, device.Name, err)
+		}
+		if !matches {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// simulateAllocation matches the requests against devices with their
+// compiled selectors and searches an allocation of distinct devices that
+// satisfies the count of every request and the constraints, like the
+// scheduler does. Nothing is allocated. The search gives up with
+// errSearchLimit after maxSimulationSteps devices.
+func (k *NetworkDriver) simulateAllocation(ctx context.Context, devices []resourceapi.Device, request SimulationRequest, selectors [][]cel.CompilationResult) (SimulationResult, error) {
+	result := SimulationResult{Matching: map[string][]string{}}
+	candidates := make([][]int, len(request.Requests))
+	for i, r := range request.Requests {
+		result.Matching[r.Name] = []string{}
+		for j, device := range devices {
+			matches, err := k.deviceMatches(ctx, device, selectors[i])
+			if err != nil {
+				return result, err
+			}
+			if matches {
+				candidates[i] = append(candidates[i], j)
+				result.Matching[r.Name] = append(result.Matching[r.Name], device.Name)
+			}
+		}
+	}
+
+	total := 0
+	for _, r := range request.Requests {
+		total += r.Count
+	}
+	if total > len(devices) {
+		return result, nil
+	}
+	// slots are the devices to allocate, in request order
+	var slots []int
+	for i, r := range request.Requests {
+		for range r.Count {
+			slots = append(slots, i)
+		}
+	}
+	used := make([]bool, len(devices))
+	// matched are the values of the constrained attributes of the allocated devices
+	matched := make([]*resourceapi.DeviceAttribute, len(request.Constraints))
+	allocated := make([]int, len(slots))
+	steps := 0
+
+	var allocate func(slot int) bool
+	allocate = func(slot int) bool {
+		if slot == len(slots) {
+			return true
+		}
+		r := slots[slot]
+		for _, j := range candidates[r] {
+			// devices of the same request are tried in order to skip permutations
+			if used[j] || (slot > 0 && slots[slot-1] == r && j < allocated[slot-1]) {
+				continue
+			}
+			if steps++; steps > maxSimulationSteps {
+				return false
+			}
+			previous := slices.Clone(matched)
+			if !k.matchConstraints(devices[j], request.Requests[r].Name, request.Constraints, matched) {
+				copy(matched, previous)
+				continue
+			}
+			used[j] = true
+			allocated[slot] = j
+			if allocate(slot + 1) {
+				return true
+			}
+			used[j] = false
+			copy(matched, previous)
+		}
+		return false
+	}
+	if !allocate(0) {
+		if steps > maxSimulationSteps {
+			return result, fmt.Errorf("%w after trying %d devices", errSearchLimit, maxSimulationSteps)
+		}
+		return result, nil
+	}
+	result.Satisfiable = true
+	result.Allocation = map[string][]string{}
+	for slot, j := range allocated {
+		name := request.Requests[slots[slot]].Name
+		result.Allocation[name] = append(result.Allocation[name], devices[j].Name)
+	}
+	return result, nil
+}
+
+// matchConstraints checks the device allocated for the request against the
+// values of the constrained attributes, recording them in matched for the
+// first device of each constraint.
+func (k *NetworkDriver) matchConstraints(device resourceapi.Device, request string, constraints []SimulatedConstraint, matched []*resourceapi.DeviceAttribute) bool {
+	for i, constraint := range constraints {
+		if len(constraint.Requests) > 0 && !slices.Contains(constraint.Requests, request) {
+			continue
+		}
+		value, ok := device.Attributes[k.localName(constraint.MatchAttribute)]
+		if !ok {
+			return false
+		}
+		if matched[i] == nil {
+			matched[i] = &value
+			continue
+		}
+		if !reflect.DeepEqual(*matched[i], value) {
+			return false
+		}
+	}
+	return true
+}
+
+// simulateHandler serves POST /simulate/allocation, it matches the claim in
+// the body against the devices the node would publish now.
+func (k *NetworkDriver) simulateHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /simulate/allocation", func(w http.ResponseWriter, r *http.Request) {
+		var request SimulationRequest
+		decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxSimulationBody))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&request); err != nil {
+			http.Error(w, fmt.Sprintf("invalid request: %v", err), http.StatusBadRequest)
+			return
+		}
+		if err := request.validate(); err != nil {
+			http.Error(w, fmt.Sprintf("invalid request: %v", err), http.StatusBadRequest)
+			return
+		}
+		selectors, err := compileSelectors(request)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid request: %v", err), http.StatusBadRequest)
+			return
+		}
+		devices, err := k.getDevices()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		result, err := k.simulateAllocation(r.Context(), devices, request, selectors)
+		if err != nil {
+			// the selectors failed on a device or the search gave up
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+		writeJSON(w, result)
+	})
+	return mux
+}
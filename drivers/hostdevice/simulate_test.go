@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	resourceapi "k8s.io/api/resource/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func pointer[T any](v T) *T {
+	return &v
+}
+
+func newSimulatedDevice(name string, numa int64, sriov bool, vfs int64) resourceapi.Device {
+	device := resourceapi.Device{
+		Name: name,
+		Attributes: map[resourceapi.QualifiedName]resourceapi.DeviceAttribute{
+			"interface-name": {StringValue: pointer(name)},
+			"numa-node":      {IntValue: pointer(numa)},
+			"sriov":          {BoolValue: pointer(sriov)},
+		},
+	}
+	if vfs > 0 {
+		device.Capacity = map[resourceapi.QualifiedName]resourceapi.DeviceCapacity{
+			sriovVFsCapacity: {Value: *resource.NewQuantity(vfs, resource.DecimalSI)},
+		}
+	}
+	return device
+}
+
+func Test_simulateAllocation(t *testing.T) {
+	devices := []resourceapi.Device{
+		newSimulatedDevice("eth0", 0, false, 0),
+		newSimulatedDevice("eth1", 0, true, 8),
+		newSimulatedDevice("eth2", 1, true, 64),
+		newSimulatedDevice("eth3", 1, false, 0),
+	}
+	k := NewNetworkDriver(driverName, "node1", fake.NewClientset())
+
+	selectors := func(expressions ...string) []resourceapi.DeviceSelector {
+		var selectors []resourceapi.DeviceSelector
+		for _, expression := range expressions {
+			selectors = append(selectors, resourceapi.DeviceSelector{CEL: &resourceapi.CELDeviceSelector{Expression: expression}})
+		}
+		return selectors
+	}
+	sriov := selectors(`device.attributes["hostdevice.k8s.io"].sriov`)
+	tests := []struct {
+		name    string
+		request SimulationRequest
+		want    string
+	}{
+		{
+			name:    "attributes",
+			request: SimulationRequest{Requests: []SimulatedDeviceRequest{{Name: "nic", Count: 1, Selectors: sriov}}},
+			want:    "true map[nic:[eth1 eth2]] map[nic:[eth1]]",
+		},
+		{
+			name: "capacity",
+			request: SimulationRequest{Requests: []SimulatedDeviceRequest{{Name: "nic", Count: 1,
+				Selectors: selectors(`"sriov-vfs" in device.capacity["hostdevice.k8s.io"] && device.capacity["hostdevice.k8s.io"]["sriov-vfs"].compareTo(quantity("16")) >= 0`)}}},
+			want: "true map[nic:[eth2]] map[nic:[eth2]]",
+		},
+		{
+			name: "all selectors",
+			request: SimulationRequest{Requests: []SimulatedDeviceRequest{{Name: "nic", Count: 1,
+				Selectors: selectors(`device.attributes["hostdevice.k8s.io"].sriov`, `device.attributes["hostdevice.k8s.io"]["numa-node"] == 1`)}}},
+			want: "true map[nic:[eth2]] map[nic:[eth2]]",
+		},
+		{
+			name:    "count",
+			request: SimulationRequest{Requests: []SimulatedDeviceRequest{{Name: "nic", Count: 3, Selectors: sriov}}},
+			want:    "false map[nic:[eth1 eth2]] map[]",
+		},
+		{
+			name: "constraint",
+			request: SimulationRequest{
+				Requests: []SimulatedDeviceRequest{
+					{Name: "fast", Count: 1, Selectors: sriov},
+					{Name: "mgmt", Count: 1, Selectors: selectors(`!device.attributes["hostdevice.k8s.io"].sriov`)},
+				},
+				Constraints: []SimulatedConstraint{{MatchAttribute: "numa-node"}},
+			},
+			want: "true map[fast:[eth1 eth2] mgmt:[eth0 eth3]] map[fast:[eth1] mgmt:[eth0]]",
+		},
+		{
+			name: "constraint backtracks",
+			request: SimulationRequest{
+				Requests: []SimulatedDeviceRequest{
+					{Name: "fast", Count: 1, Selectors: sriov},
+					{Name: "mgmt", Count: 1, Selectors: selectors(`device.attributes["hostdevice.k8s.io"]["interface-name"] == "eth3"`)},
+				},
+				Constraints: []SimulatedConstraint{{Requests: []string{"fast", "mgmt"}, MatchAttribute: driverName + "/numa-node"}},
+			},
+			want: "true map[fast:[eth1 eth2] mgmt:[eth3]] map[fast:[eth2] mgmt:[eth3]]",
+		},
+		{
+			name: "unknown constraint attribute",
+			request: SimulationRequest{
+				Requests:    []SimulatedDeviceRequest{{Name: "nic", Count: 1}},
+				Constraints: []SimulatedConstraint{{MatchAttribute: "pci-address"}},
+			},
+			want: "false map[nic:[eth0 eth1 eth2 eth3]] map[]",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			compiled, err := compileSelectors(tt.request)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			result, err := k.simulateAllocation(context.Background(), devices, tt.request, compiled)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			got := fmt.Sprint(result.Satisfiable, " ", result.Matching, " ", result.Allocation)
+			if got != tt.want {
+				t.Errorf("expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+
+	// a selector failing on a device fails the simulation
+	request := SimulationRequest{Requests: []SimulatedDeviceRequest{{Name: "nic", Count: 1, Selectors: selectors(`device.attributes["hostdevice.k8s.io"]["missing"] == 1`)}}}
+	compiled, err := compileSelectors(request)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := k.simulateAllocation(context.Background(), devices, request, compiled); err == nil {
+		t.Errorf("expected an error evaluating a missing attribute")
+	}
+}
+
+func Test_simulateAllocation_searchLimit(t *testing.T) {
+	var devices []resourceapi.Device
+	for i := range 39 {
+		devices = append(devices, newSimulatedDevice(fmt.Sprintf("eth%d", i), 0, false, 0))
+	}
+	devices = append(devices, newSimulatedDevice("eth39", 1, false, 0))
+	k := NewNetworkDriver(driverName, "node1", fake.NewClientset())
+
+	// no device of the first request is on the numa node of the second one,
+	// the search would try every combination of 15 of the 40 devices
+	request := SimulationRequest{
+		Requests: []SimulatedDeviceRequest{
+			{Name: "many", Count: 15},
+			{Name: "one", Count: 1, Selectors: []resourceapi.DeviceSelector{{CEL: &resourceapi.CELDeviceSelector{Expression: `device.attributes["hostdevice.k8s.io"]["interface-name"] == "eth39"`}}}},
+		},
+		Constraints: []SimulatedConstraint{{MatchAttribute: "numa-node"}},
+	}
+	compiled, err := compileSelectors(request)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := k.simulateAllocation(context.Background(), devices, request, compiled); !errors.Is(err, errSearchLimit) {
+		t.Errorf("expected the search to give up, got %v", err)
+	}
+}
+
+func Test_simulateHandler_invalid(t *testing.T) {
+	k := NewNetworkDriver(driverName, "node1", fake.NewClientset())
+	server := httptest.NewServer(k.simulateHandler())
+	defer server.Close()
+
+	for _, body := range []string{
+		`{`,
+		`{"requests":[]}`,
+		`{"requests":[{"name":"nic"},{"name":"nic"}]}`,
+		`{"requests":[{"name":"nic","count":-1}]}`,
+		`{"requests":[{"name":"nic"}],"constraints":[{"requests":["other"],"matchAttribute":"numa-node"}]}`,
+		`{"requests":[{"name":"nic","attributes":{}}]}`,
+		`{"requests":[{"name":"nic","count":33}]}`,
+		`{"requests":[{"name":"nic","selectors":[{}]}]}`,
+		`{"requests":[{"name":"nic","selectors":[{"cel":{"expression":"device.attributes["}}]}]}`,
+		`{"requests":[{"name":"nic","selectors":[{"cel":{"expression":"device.driver"}}]}]}`,
+	} {
+		resp, err := http.Post(server.URL+"/simulate/allocation", "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("%s: expected status %d, got %d", body, http.StatusBadRequest, resp.StatusCode)
+		}
+	}
+
+	resp, err := http.Get(server.URL + "/simulate/allocation")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("expected status %d for GET, got %d", http.StatusMethodNotAllowed, resp.StatusCode)
+	}
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/vishvananda/netlink"
+	resourceapi "k8s.io/api/resource/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
+
+	kndnet "github.com/aojea/kubernetes-network-drivers/pkg/net"
+)
+
+const (
+	// sriovVFsCapacity is the capacity of the physical functions in virtual functions.
+	sriovVFsCapacity resourceapi.QualifiedName = "sriov-vfs"
+	// sriovProbeTimeout is how long to wait for the interface of a virtual function.
+	sriovProbeTimeout = 10 * time.Second
+)
+
+// addSriovAttributes publishes whether the device backing ifName is an
+// SR-IOV physical function and its virtual function counts, the counts are
+// not published for devices without SR-IOV.
+func (k *NetworkDriver) addSriovAttributes(device *resourceapi.Device, ifName string) {
+	total, err := k.host.sriovTotalVFs(ifName)
+	if err != nil {
+		klog.V(2).Infof("failed to get SR-IOV capabilities of %s: %v", ifName, err)
+		return
+	}
+	capable := total > 0
+	device.Attributes["sriov-capable"] = resourceapi.DeviceAttribute{BoolValue: &capable}
+	if !capable {
+		return
+	}
+	num, err := k.host.sriovNumVFs(ifName)
+	if err != nil {
+		klog.V(2).Infof("failed to get SR-IOV virtual functions of %s: %v", ifName, err)
+		return
+	}
+	totalVFs, numVFs := int64(total), int64(num)
+	device.Attributes["sriov-totalvfs"] = resourceapi.DeviceAttribute{IntValue: &totalVFs}
+	device.Attributes["sriov-numvfs"] = resourceapi.DeviceAttribute{IntValue: &numVFs}
+	if device.Capacity == nil {
+		device.Capacity = map[resourceapi.QualifiedName]resourceapi.DeviceCapacity{}
+	}
+	device.Capacity[sriovVFsCapacity] = resourceapi.DeviceCapacity{Value: *resource.NewQuantity(int64(total), resource.DecimalSI)}
+}
+
+// enableSriovVFs creates all the virtual functions of the physical functions
+// without any, so they are published and can be allocated. Physical functions
+// that already have virtual functions are left untouched, since changing
+// their number removes the existing ones.
+func (k *NetworkDriver) enableSriovVFs() error {
+	links, err := netlink.LinkList()
+	if err != nil {
+		return fmt.Errorf("failed to list network interfaces: %w", err)
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	for _, link := range links {
+		ifName := link.Attrs().Name
+		total, err := kndnet.SriovTotalVFs(ifName)
+		if err != nil || total == 0 {
+			continue
+		}
+		if num, err := kndnet.SriovNumVFs(ifName); err != nil || num != 0 {
+			continue
+		}
+		klog.Infof("Enabling %d SR-IOV virtual functions on %s", total, ifName)
+		if err := kndnet.SetSriovNumVFs(ifName, total); err != nil {
+			klog.Errorf("failed to enable SR-IOV virtual functions on %s: %v", ifName, err)
+			continue
+		}
+		k.sriovEnabledPFs.Insert(ifName)
+	}
+	return nil
+}
+
+// disableSriovVFs removes the virtual functions created by enableSriovVFs.
+func (k *NetworkDriver) disableSriovVFs() {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	for _, ifName := range sets.List(k.sriovEnabledPFs) {
+		klog.Infof("Disabling SR-IOV virtual functions on %s", ifName)
+		if err := kndnet.SetSriovNumVFs(ifName, 0); err != nil {
+			klog.Errorf("failed to disable SR-IOV virtual functions on %s: %v", ifName, err)
+			continue
+		}
+		k.sriovEnabledPFs.Delete(ifName)
+	}
+}
+
+// allocateSriovVF returns the interface of a free virtual function of the
+// physical function pf, creating it if needed, and reserves it until the
+// claim is stored in the shared state.
+func (k *NetworkDriver) allocateSriovVF(ctx context.Context, pf string) (string, error) {
+	lock, _ := k.sriovLocks.LoadOrStore(pf, &sync.Mutex{})
+	lock.(*sync.Mutex).Lock()
+	defer lock.(*sync.Mutex).Unlock()
+
+	inUse := k.sriovVFsInUse()
+	vfs, err := kndnet.SriovVFs(pf)
+	if err != nil {
+		return "", err
+	}
+	vf, ok := pickFreeVF(vfs, inUse)
+	if !ok {
+		if !k.sriovOnDemand {
+			return "", fmt.Errorf("no free virtual functions on %s", pf)
+		}
+		vf, err = createSriovVF(pf, vfs, inUse)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	if vf.Name == "" {
+		if err := kndnet.BindSriovVF(vf); err != nil {
+			return "", err
+		}
+		// the interface is created asynchronously by the driver
+		err := wait.PollUntilContextTimeout(ctx, 100*time.Millisecond, sriovProbeTimeout, true, func(context.Context) (bool, error) {
+			vfs, err := kndnet.SriovVFs(pf)
+			if err != nil {
+				return false, err
+			}
+			for _, v := range vfs {
+				if v.Index == vf.Index && v.Name != "" {
+					vf = v
+					return true, nil
+				}
+			}
+			return false, nil
+		})
+		if err != nil {
+			return "", fmt.Errorf("virtual function %d of %s has no network interface: %w", vf.Index, pf, err)
+		}
+	}
+
+	k.mu.Lock()
+	k.sriovReserved.Insert(vf.Name)
+	k.mu.Unlock()
+	return vf.Name, nil
+}
+
+// createSriovVF enables the virtual functions of pf and returns a free one.
+// The kernel only allows to change the number of virtual functions from 0,
+// so they can only be created while none of them is in use, and all of them
+// are created at once so the next claims do not need to.
+func createSriovVF(pf string, vfs []kndnet.SriovVF, inUse sets.Set[string]) (kndnet.SriovVF, error) {
+	total, err := kndnet.SriovTotalVFs(pf)
+	if err != nil {
+		return kndnet.SriovVF{}, err
+	}
+	if len(vfs) >= total {
+		return kndnet.SriovVF{}, fmt.Errorf("all %d virtual functions of %s are in use", total, pf)
+	}
+	for _, vf := range vfs {
+		if inUse.Has(vf.Name) {
+			return kndnet.SriovVF{}, fmt.Errorf("no free virtual functions on %s and more cannot be created while %s is in use", pf, vf.Name)
+		}
+	}
+	klog.Infof("Creating %d SR-IOV virtual functions on %s", total, pf)
+	if err := kndnet.SetSriovNumVFs(pf, total); err != nil {
+		return kndnet.SriovVF{}, err
+	}
+	vfs, err = kndnet.SriovVFs(pf)
+	if err != nil {
+		return kndnet.SriovVF{}, err
+	}
+	vf, ok := pickFreeVF(vfs, inUse)
+	if !ok {
+		return kndnet.SriovVF{}, fmt.Errorf("virtual function created on %s not found", pf)
+	}
+	return vf, nil
+}
+
+// pickFreeVF returns the first virtual function not in use, preferring the
+// ones that already have a network interface.
+func pickFreeVF(vfs []kndnet.SriovVF, inUse sets.Set[string]) (kndnet.SriovVF, bool) {
+	var unbound *kndnet.SriovVF
+	for i, vf := range vfs {
+		if vf.Name == "" {
+			if unbound == nil {
+				unbound = &vfs[i]
+			}
+			continue
+		}
+		if !inUse.Has(vf.Name) {
+			return vf, true
+		}
+	}
+	if unbound != nil {
+		return *unbound, true
+	}
+	return kndnet.SriovVF{}, false
+}
+
+// sriovVFsInUse returns the virtual functions prepared or being prepared for a claim.
+func (k *NetworkDriver) sriovVFsInUse() sets.Set[string] {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	inUse := k.sriovReserved.Clone()
+	for _, preparedData := range k.sharedState.PreparedData {
+		for _, device := range preparedData {
+			if device.InterfaceName != "" {
+				inUse.Insert(device.InterfaceName)
+			}
+		}
+	}
+	return inUse
+}
+
+// releaseSriovVFs drops the reservations of the virtual functions of the
+// devices, once they are stored in the shared state or failed to prepare.
+// The caller must hold k.mu.
+func (k *NetworkDriver) releaseSriovVFs(devices []PreparedDevice) {
+	for _, device := range devices {
+		if device.InterfaceName != "" {
+			k.sriovReserved.Delete(device.InterfaceName)
+		}
+	}
+}
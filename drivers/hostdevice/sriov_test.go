@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	resourceapi "k8s.io/api/resource/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/kubernetes/fake"
+
+	kndnet "github.com/aojea/kubernetes-network-drivers/pkg/net"
+)
+
+func Test_pickFreeVF(t *testing.T) {
+	vfs := []kndnet.SriovVF{
+		{Index: 0, PCIAddress: "0000:3b:02.0", Name: "eth1"},
+		{Index: 1, PCIAddress: "0000:3b:02.1", Driver: "vfio-pci"},
+		{Index: 2, PCIAddress: "0000:3b:02.2", Name: "eth3"},
+	}
+	tests := []struct {
+		name      string
+		inUse     sets.Set[string]
+		wantIndex int
+		wantOK    bool
+	}{
+		{name: "first free", inUse: sets.New[string](), wantIndex: 0, wantOK: true},
+		{name: "prefer the bound ones", inUse: sets.New("eth1"), wantIndex: 2, wantOK: true},
+		{name: "unbound as last resort", inUse: sets.New("eth1", "eth3"), wantIndex: 1, wantOK: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vf, ok := pickFreeVF(vfs, tt.inUse)
+			if ok != tt.wantOK || vf.Index != tt.wantIndex {
+				t.Errorf("pickFreeVF() = %+v, %v, want index %d, %v", vf, ok, tt.wantIndex, tt.wantOK)
+			}
+		})
+	}
+	if _, ok := pickFreeVF(vfs[:1], sets.New("eth1")); ok {
+		t.Errorf("expected no free virtual functions")
+	}
+}
+
+func Test_sriovVFsInUse(t *testing.T) {
+	k := NewNetworkDriver(driverName, "node1", fake.NewClientset())
+	k.checkpointPath = ""
+	k.sharedState.PreparedData["claim-uid"] = []PreparedDevice{
+		{DeviceName: "pf0", InterfaceName: "eth1"},
+		{DeviceName: "eth5"},
+	}
+	k.sriovReserved.Insert("eth2")
+	if got, want := k.sriovVFsInUse(), sets.New("eth1", "eth2"); !got.Equal(want) {
+		t.Errorf("sriovVFsInUse() = %v, want %v", sets.List(got), sets.List(want))
+	}
+
+	k.mu.Lock()
+	k.releaseSriovVFs([]PreparedDevice{{DeviceName: "pf0", InterfaceName: "eth2"}})
+	k.mu.Unlock()
+	if got, want := k.sriovVFsInUse(), sets.New("eth1"); !got.Equal(want) {
+		t.Errorf("sriovVFsInUse() = %v, want %v", sets.List(got), sets.List(want))
+	}
+}
+
+func Test_allocateSriovVF_noVFs(t *testing.T) {
+	k := NewNetworkDriver(driverName, "node1", fake.NewClientset())
+	k.checkpointPath = ""
+	for _, onDemand := range []bool{false, true} {
+		k.sriovOnDemand = onDemand
+		if _, err := k.allocateSriovVF(context.Background(), "knd-missing0"); err == nil {
+			t.Errorf("expected error allocating a virtual function of a device without SR-IOV, on demand %v", onDemand)
+		}
+	}
+}
+
+func Test_addSriovAttributes(t *testing.T) {
+	k := NewNetworkDriver(driverName, "node1", fake.NewClientset())
+	k.host.sriovTotalVFs = func(ifName string) (int, error) {
+		switch ifName {
+		case "eth0":
+			return 8, nil
+		case "bad0":
+			return 0, errors.New("invalid sriov_totalvfs")
+		}
+		return 0, nil
+	}
+	k.host.sriovNumVFs = func(ifName string) (int, error) { return 2, nil }
+	capable, notCapable := true, false
+	total, num := int64(8), int64(2)
+
+	tests := []struct {
+		ifName string
+		want   map[resourceapi.QualifiedName]resourceapi.DeviceAttribute
+	}{
+		{
+			ifName: "eth0",
+			want: map[resourceapi.QualifiedName]resourceapi.DeviceAttribute{
+				"sriov-capable":  {BoolValue: &capable},
+				"sriov-totalvfs": {IntValue: &total},
+				"sriov-numvfs":   {IntValue: &num},
+			},
+		},
+		{
+			// virtual functions and virtual interfaces
+			ifName: "eth0v0",
+			want: map[resourceapi.QualifiedName]resourceapi.DeviceAttribute{
+				"sriov-capable": {BoolValue: &notCapable},
+			},
+		},
+		{ifName: "bad0", want: map[resourceapi.QualifiedName]resourceapi.DeviceAttribute{}},
+	}
+	for _, tt := range tests {
+		device := resourceapi.Device{Name: tt.ifName, Attributes: map[resourceapi.QualifiedName]resourceapi.DeviceAttribute{}}
+		k.addSriovAttributes(&device, tt.ifName)
+		if !reflect.DeepEqual(device.Attributes, tt.want) {
+			t.Errorf("addSriovAttributes(%s) = %v, want %v", tt.ifName, device.Attributes, tt.want)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"strings"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+
+	kndnet "github.com/aojea/kubernetes-network-drivers/pkg/net"
+)
+
+// sourceGroupJoins are the source-specific multicast memberships held by the
+// driver for the devices of the pods. They are not checkpointed, the sockets
+// that hold them are closed when the driver exits and the memberships of the
+// running pods are joined again when the runtime synchronizes them.
+type sourceGroupJoins struct {
+	mu    sync.Mutex
+	joins map[string]*kndnet.SourceGroupMemberships
+}
+
+// sourceGroupKey identifies the memberships of a device of a pod.
+func sourceGroupKey(podUID types.UID, deviceName string) string {
+	return string(podUID) + "/" + deviceName
+}
+
+// joinSourceGroups joins the channels of the device on the interface ifName
+// of the pod network namespace, replacing the memberships it already had.
+func (k *NetworkDriver) joinSourceGroups(podUID types.UID, deviceName string, networkNamespace string, ifName string, config kndnet.SSMConfig) error {
+	memberships, err := k.host.joinSourceGroups(networkNamespace, ifName, config)
+	if err != nil {
+		return err
+	}
+	klog.Infof("Joined %d source-specific multicast channels on device %q of pod %s", len(config.Joins), ifName, podUID)
+	k.sourceGroups.add(podUID, deviceName, memberships)
+	return nil
+}
+
+// add records the memberships of the device of the pod, replacing the ones
+// it already had.
+func (j *sourceGroupJoins) add(podUID types.UID, deviceName string, memberships *kndnet.SourceGroupMemberships) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.joins == nil {
+		j.joins = map[string]*kndnet.SourceGroupMemberships{}
+	}
+	key := sourceGroupKey(podUID, deviceName)
+	if previous, ok := j.joins[key]; ok {
+		previous.Close()
+	}
+	j.joins[key] = memberships
+}
+
+// joined returns true if the driver holds the memberships of the device.
+func (j *sourceGroupJoins) joined(podUID types.UID, deviceName string) bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	_, ok := j.joins[sourceGroupKey(podUID, deviceName)]
+	return ok
+}
+
+// leave closes the memberships of the device, it must be done before the
+// device leaves the pod network namespace.
+func (j *sourceGroupJoins) leave(podUID types.UID, deviceName string) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	key := sourceGroupKey(podUID, deviceName)
+	if memberships, ok := j.joins[key]; ok {
+		if err := memberships.Close(); err != nil {
+			klog.Errorf("failed to leave the source-specific multicast channels of device %s: %v", deviceName, err)
+		}
+		delete(j.joins, key)
+	}
+}
+
+// leavePod closes the memberships of all the devices of the pod, the sockets
+// would otherwise keep its network namespace alive.
+func (j *sourceGroupJoins) leavePod(podUID types.UID) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	for key, memberships := range j.joins {
+		if !strings.HasPrefix(key, string(podUID)+"/") {
+			continue
+		}
+		if err := memberships.Close(); err != nil {
+			klog.Errorf("failed to leave the source-specific multicast channels of pod %s: %v", podUID, err)
+		}
+		delete(j.joins, key)
+	}
+}
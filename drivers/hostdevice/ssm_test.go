@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/vishvananda/netlink"
+	resourceapi "k8s.io/api/resource/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	kndnet "github.com/aojea/kubernetes-network-drivers/pkg/net"
+)
+
+func Test_sourceGroupJoins(t *testing.T) {
+	type join struct {
+		networkNamespace string
+		ifName           string
+		config           kndnet.SSMConfig
+	}
+	var joins []join
+	k := NewNetworkDriver(driverName, "node1", fake.NewClientset())
+	k.host.attachNetdev = func(hostIfName string, containerNsPath string, newAttr netlink.LinkAttrs, addresses []*net.IPNet, opts ...kndnet.AttachOption) (*resourceapi.NetworkDeviceData, error) {
+		return nil, nil
+	}
+	k.host.detachNetdev = func(containerNsPath string, devName string, outName string, opts ...kndnet.DetachOption) error {
+		return nil
+	}
+	k.host.joinSourceGroups = func(containerNsPath string, ifName string, config kndnet.SSMConfig) (*kndnet.SourceGroupMemberships, error) {
+		joins = append(joins, join{containerNsPath, ifName, config})
+		return &kndnet.SourceGroupMemberships{}, nil
+	}
+
+	ssm := kndnet.SSMConfig{Joins: []kndnet.SourceGroup{{Source: "192.0.2.10", Group: "232.1.1.1"}}}
+	k.checkpointPath = ""
+	k.sharedState.PodDeviceConfig["pod-uid"] = []AllocatedDevice{{Name: "eth1"}}
+	k.sharedState.PreparedData["pod-uid"] = []PreparedDevice{{DeviceName: "eth1", Config: DeviceConfig{SSM: &ssm}}}
+
+	sandbox := newTestSandbox("/run/netns/pod")
+	if err := k.RunPodSandbox(context.Background(), sandbox); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(joins) != 1 || joins[0].networkNamespace != "/run/netns/pod" || joins[0].ifName != "eth1" || joins[0].config.Joins[0] != ssm.Joins[0] {
+		t.Fatalf("unexpected joins %+v", joins)
+	}
+	if !k.sourceGroups.joined("pod-uid", "eth1") {
+		t.Errorf("expected the memberships of eth1 to be held")
+	}
+
+	if err := k.StopPodSandbox(context.Background(), sandbox); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if k.sourceGroups.joined("pod-uid", "eth1") {
+		t.Errorf("expected the memberships of eth1 to be left when it is detached")
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
+)
+
+// defaultInitialPublishRetries is how many times the first publication is
+// retried by default.
+const defaultInitialPublishRetries = 5
+
+// defaultInitialPublishBackoff is the wait before the first retry of the first
+// publication by default.
+const defaultInitialPublishBackoff = 500 * time.Millisecond
+
+// initialPublish publishes the devices when the driver starts, retrying with
+// an exponential backoff while the API server is not reachable yet instead
+// of waiting for the next period. The driver is not ready until the devices
+// are published, so it does not claim readiness while they cannot be
+// allocated. If the retries run out the periodic publication keeps trying.
+func (k *NetworkDriver) initialPublish(ctx context.Context) {
+	backoff := wait.Backoff{
+		Duration: k.initialPublishBackoff,
+		Factor:   2,
+		Steps:    k.initialPublishRetries + 1,
+		Cap:      k.publishInterval,
+	}
+	attempt := 0
+	err := wait.ExponentialBackoffWithContext(ctx, backoff, func(ctx context.Context) (bool, error) {
+		attempt++
+		if err := k.publishOnce(ctx); err != nil {
+			klog.Infof("Initial publication of the devices failed (attempt %d/%d): %v", attempt, backoff.Steps, err)
+			return false, nil
+		}
+		return true, nil
+	})
+	if err != nil {
+		klog.Errorf("failed to publish the devices on startup after %d attempts, retrying every %v: %v", attempt, k.publishInterval, err)
+		return
+	}
+	klog.Infof("Devices published, the driver is ready")
+}
+
+// isReady returns true once the devices were published.
+func (k *NetworkDriver) isReady() bool {
+	return k.published.Load()
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/dynamic-resource-allocation/resourceslice"
+)
+
+// flakyPublisher fails the first failures publications.
+type flakyPublisher struct {
+	failures int
+	calls    int
+}
+
+func (f *flakyPublisher) PublishResources(ctx context.Context, resources resourceslice.DriverResources) error {
+	f.calls++
+	if f.calls <= f.failures {
+		return errors.New("connection refused")
+	}
+	return nil
+}
+
+func Test_initialPublish(t *testing.T) {
+	tests := []struct {
+		name      string
+		retries   int
+		failures  int
+		wantCalls int
+		wantReady bool
+	}{
+		{name: "first attempt", retries: 3, failures: 0, wantCalls: 1, wantReady: true},
+		{name: "after retries", retries: 3, failures: 2, wantCalls: 3, wantReady: true},
+		{name: "retries exhausted", retries: 2, failures: 5, wantCalls: 3, wantReady: false},
+		{name: "retries disabled", retries: 0, failures: 1, wantCalls: 1, wantReady: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			publisher := &flakyPublisher{failures: tt.failures}
+			k := NewNetworkDriver(driverName, "node1", fake.NewClientset())
+			k.publisher = publisher
+			k.initialPublishRetries = tt.retries
+			k.initialPublishBackoff = time.Millisecond
+			if k.isReady() {
+				t.Fatalf("expected the driver not to be ready before publishing")
+			}
+			k.initialPublish(context.Background())
+			if publisher.calls != tt.wantCalls {
+				t.Errorf("expected %d publications, got %d", tt.wantCalls, publisher.calls)
+			}
+			if k.isReady() != tt.wantReady {
+				t.Errorf("expected ready %v, got %v", tt.wantReady, k.isReady())
+			}
+			// the periodic publication makes it ready once it succeeds
+			if !tt.wantReady {
+				publisher.failures = 0
+				if err := k.publishOnce(context.Background()); err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if !k.isReady() {
+					t.Errorf("expected the driver to be ready after a successful publication")
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	resourceapi "k8s.io/api/resource/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+)
+
+// reportNetworkData records the network data of a device of the pod in the
+// shared state and in the device status of its claim, nil clears it.
+// Failures to update the claim are logged, the data is kept anyway.
+func (k *NetworkDriver) reportNetworkData(ctx context.Context, podUID types.UID, device PreparedDevice, data *resourceapi.NetworkDeviceData) {
+	k.mu.Lock()
+	preparedData := k.sharedState.PreparedData[podUID]
+	for i := range preparedData {
+		if preparedData[i].DeviceName == device.DeviceName {
+			preparedData[i].NetworkData = data
+		}
+	}
+	k.mu.Unlock()
+	if err := k.updateClaimNetworkData(ctx, device, data); err != nil {
+		klog.Errorf("failed to report the network data of device %s: %v", device.DeviceName, err)
+	}
+}
+
+// updateClaimNetworkData records the network data of a prepared device in
+// the device status of its claim.
+func (k *NetworkDriver) updateClaimNetworkData(ctx context.Context, device PreparedDevice, data *resourceapi.NetworkDeviceData) error {
+	return k.updateClaimDeviceStatus(ctx, device, func(status *resourceapi.AllocatedDeviceStatus) {
+		status.NetworkData = data
+	})
+}
+
+// updateClaimDeviceStatus applies update to the device status of a prepared
+// device in its claim, adding the status if the device has none.
+func (k *NetworkDriver) updateClaimDeviceStatus(ctx context.Context, device PreparedDevice, update func(*resourceapi.AllocatedDeviceStatus)) error {
+	claims := k.kubeClient.ResourceV1().ResourceClaims(device.Claim.Namespace)
+	claim, err := claims.Get(ctx, device.Claim.Name, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to get claim %s: %w", device.Claim, err)
+	}
+	claim = claim.DeepCopy()
+	found := false
+	for i := range claim.Status.Devices {
+		status := &claim.Status.Devices[i]
+		if status.Driver == k.driverName && status.Pool == device.PoolName && status.Device == device.DeviceName {
+			update(status)
+			found = true
+			break
+		}
+	}
+	if !found {
+		status := resourceapi.AllocatedDeviceStatus{
+			Driver: k.driverName,
+			Pool:   device.PoolName,
+			Device: device.DeviceName,
+		}
+		update(&status)
+		claim.Status.Devices = append(claim.Status.Devices, status)
+	}
+	if _, err := claims.UpdateStatus(ctx, claim, metav1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("failed to update status of claim %s: %w", device.Claim, err)
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/vishvananda/netlink"
+	resourceapi "k8s.io/api/resource/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+
+	kndnet "github.com/aojea/kubernetes-network-drivers/pkg/net"
+)
+
+func Test_updateClaimNetworkData(t *testing.T) {
+	claim := &resourceapi.ResourceClaim{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "claim"},
+		Status: resourceapi.ResourceClaimStatus{
+			Devices: []resourceapi.AllocatedDeviceStatus{
+				{Driver: "other.k8s.io", Pool: "node1", Device: "gpu0"},
+			},
+		},
+	}
+	client := fake.NewClientset(claim)
+	k := NewNetworkDriver(driverName, "node1", client)
+	device := PreparedDevice{Claim: types.NamespacedName{Namespace: "default", Name: "claim"}, PoolName: "node1", DeviceName: "eth1"}
+
+	for _, ips := range [][]string{{"2001:db8::1234/64"}, {"2001:db8::5678/64"}} {
+		data := &resourceapi.NetworkDeviceData{InterfaceName: "eth1", IPs: ips}
+		if err := k.updateClaimNetworkData(context.Background(), device, data); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	got, err := client.ResourceV1().ResourceClaims("default").Get(context.Background(), "claim", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(got.Status.Devices) != 2 {
+		t.Fatalf("expected the status of 2 devices, got %+v", got.Status.Devices)
+	}
+	status := got.Status.Devices[1]
+	if status.Driver != driverName || status.Device != "eth1" || status.NetworkData == nil ||
+		len(status.NetworkData.IPs) != 1 || status.NetworkData.IPs[0] != "2001:db8::5678/64" {
+		t.Errorf("unexpected device status %+v", status)
+	}
+}
+
+func Test_podSandbox_networkData(t *testing.T) {
+	claim := &resourceapi.ResourceClaim{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "claim"}}
+	client := fake.NewClientset(claim)
+	k := NewNetworkDriver(driverName, "node1", client)
+	k.host.attachNetdev = func(hostIfName string, containerNsPath string, newAttr netlink.LinkAttrs, addresses []*net.IPNet, opts ...kndnet.AttachOption) (*resourceapi.NetworkDeviceData, error) {
+		return &resourceapi.NetworkDeviceData{InterfaceName: newAttr.Name, HardwareAddress: "00:11:22:33:44:55", IPs: []string{"192.168.5.10/24"}}, nil
+	}
+	k.host.detachNetdev = func(containerNsPath string, devName string, outName string, opts ...kndnet.DetachOption) error {
+		return nil
+	}
+	k.checkpointPath = ""
+	k.sharedState.PodDeviceConfig["pod-uid"] = []AllocatedDevice{{Name: "eth1"}}
+	k.sharedState.PreparedData["pod-uid"] = []PreparedDevice{
+		{Claim: types.NamespacedName{Namespace: "default", Name: "claim"}, PoolName: "node1", DeviceName: "eth1"},
+	}
+	networkData := func() *resourceapi.NetworkDeviceData {
+		t.Helper()
+		got, err := client.ResourceV1().ResourceClaims("default").Get(context.Background(), "claim", metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(got.Status.Devices) != 1 {
+			t.Fatalf("expected the status of 1 device, got %+v", got.Status.Devices)
+		}
+		return got.Status.Devices[0].NetworkData
+	}
+
+	if err := k.RunPodSandbox(context.Background(), newTestSandbox("/run/netns/pod")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := &resourceapi.NetworkDeviceData{InterfaceName: "eth1", HardwareAddress: "00:11:22:33:44:55", IPs: []string{"192.168.5.10/24"}}
+	if got := networkData(); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected network data %+v in the claim, got %+v", want, got)
+	}
+	if got := k.sharedState.PreparedData["pod-uid"][0].NetworkData; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected network data %+v in the state, got %+v", want, got)
+	}
+
+	if err := k.StopPodSandbox(context.Background(), newTestSandbox("/run/netns/pod")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := networkData(); got != nil {
+		t.Errorf("expected no network data in the claim, got %+v", got)
+	}
+	if got := k.sharedState.PreparedData["pod-uid"][0].NetworkData; got != nil {
+		t.Errorf("expected no network data in the state, got %+v", got)
+	}
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/containerd/nri/pkg/api"
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+)
+
+// results of the devices reconciled by Synchronize
+const (
+	synchronizeReapplied = "reapplied"
+	synchronizeRestored  = "restored"
+	synchronizeOrphaned  = "orphaned"
+)
+
+var (
+	synchronizeDevicesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "knd_synchronize_devices_total",
+		Help: "Number of devices reconciled when the runtime synchronizes the existing pods per result: reapplied to a running pod, restored from a stopped pod to the host, or orphaned when they could not be restored.",
+	}, []string{"result"})
+
+	synchronizeDuration = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "knd_synchronize_duration_seconds",
+		Help: "Time the last synchronization of the existing pods took to reconcile their devices.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(synchronizeDevicesTotal)
+	prometheus.MustRegister(synchronizeDuration)
+}
+
+// synchronize reconciles the devices in the checkpoint with the pods the
+// runtime reports when the driver connects to it, usually after a restart.
+// The devices of the running pods that are not in their network namespace
+// are attached again and the devices of the pods whose sandbox is gone are
+// returned to the host. Without a checkpoint, the state of the running pods
+// is rebuilt from their claims first.
+func (k *NetworkDriver) synchronize(ctx context.Context, pods []*api.PodSandbox) {
+	start := time.Now()
+	running := map[types.UID]*api.PodSandbox{}
+	for _, pod := range pods {
+		running[types.UID(pod.Uid)] = pod
+	}
+	if !k.checkpointLoaded {
+		k.rebuildState(ctx, pods)
+	}
+	k.mu.Lock()
+	var podUIDs []types.UID
+	for podUID := range k.sharedState.PodDeviceConfig {
+		podUIDs = append(podUIDs, podUID)
+	}
+	k.mu.Unlock()
+	slices.Sort(podUIDs)
+
+	counts := map[string]int{synchronizeReapplied: 0, synchronizeRestored: 0, synchronizeOrphaned: 0}
+	for _, podUID := range podUIDs {
+		if pod, ok := running[podUID]; ok {
+			counts[synchronizeReapplied] += k.synchronizeRunningPod(ctx, pod)
+			continue
+		}
+		restored, orphaned := k.synchronizeStoppedPod(podUID)
+		counts[synchronizeRestored] += restored
+		counts[synchronizeOrphaned] += orphaned
+	}
+
+	for result, count := range counts {
+		synchronizeDevicesTotal.WithLabelValues(result).Add(float64(count))
+	}
+	synchronizeDuration.Set(time.Since(start).Seconds())
+	klog.Infof("Synchronized %d pods in %v: %d devices reapplied, %d restored, %d orphaned", len(pods), time.Since(start),
+		counts[synchronizeReapplied], counts[synchronizeRestored], counts[synchronizeOrphaned])
+}
+
+// synchronizeRunningPod attaches again the devices of a running pod that are
+// not in its network namespace, because the driver stopped before attaching
+// them or the sandbox was recreated meanwhile, joins again the source-specific
+// multicast channels of the ones that are, and returns how many.
+func (k *NetworkDriver) synchronizeRunningPod(ctx context.Context, pod *api.PodSandbox) int {
+	podUID := types.UID(pod.Uid)
+	networkNamespace := k.getNetworkNamespace(pod)
+	if networkNamespace == "" {
+		return 0
+	}
+	unlock := k.podLocks.lock(podUID)
+	defer unlock()
+	k.mu.Lock()
+	preparedData := k.sharedState.PreparedData[podUID]
+	devices := k.sharedState.PodDeviceConfig[podUID]
+	pending := 0
+	returned := false
+	// the memberships held by the previous instance of the driver are gone
+	var rejoin []AllocatedDevice
+	for j, device := range devices {
+		i := preparedDeviceIndex(preparedData, device.Name)
+		if i < 0 {
+			continue
+		}
+		if preparedData[i].State == DeviceStateAttached {
+			ifName := preparedData[i].hostInterface()
+			if device.sandboxNamespace() == networkNamespace {
+				if _, err := k.host.nsLinkInfo(device.NetworkNamespace, preparedData[i].podInterface()); err == nil {
+					if preparedData[i].Config.SSM != nil && !k.sourceGroups.joined(podUID, device.Name) {
+						rejoin = append(rejoin, device)
+					}
+					continue
+				}
+			}
+			// the device is somewhere else than the host, leave it
+			if !k.host.hostLinkExists(ifName) {
+				klog.Warningf("Device %q of pod %s/%s is neither in its network namespace nor on the host", device.Name, pod.Namespace, pod.Name)
+				continue
+			}
+			// the namespace of a previous sandbox returned it to the host,
+			// the run must not take it for the device of another sandbox
+			preparedData[i].State = DeviceStateDetached
+			devices[j].NetworkNamespace = ""
+			devices[j].SandboxNamespace = ""
+			returned = true
+		}
+		klog.Infof("Device %q of running pod %s/%s is not attached, attaching it again", device.Name, pod.Namespace, pod.Name)
+		pending++
+	}
+	if returned {
+		k.updateDeviceStateMetrics()
+		if err := k.saveCheckpoint(); err != nil {
+			klog.Errorf("failed to save checkpoint: %v", err)
+		}
+	}
+	preparedData = slices.Clone(preparedData)
+	k.mu.Unlock()
+	rejoined := 0
+	for _, device := range rejoin {
+		prepared, _ := findPreparedDevice(preparedData, device.Name)
+		if err := k.joinSourceGroups(podUID, device.Name, device.NetworkNamespace, prepared.podInterface(), *prepared.Config.SSM); err != nil {
+			klog.Errorf("failed to join again the source-specific multicast channels of device %s of pod %s/%s: %v", device.Name, pod.Namespace, pod.Name, err)
+			continue
+		}
+		rejoined++
+	}
+	if pending == 0 {
+		return rejoined
+	}
+	// the pod lock is kept so no stop of the pod runs in between
+	if err := k.runPodSandbox(ctx, pod); err != nil {
+		klog.Errorf("failed to attach again the devices of pod %s/%s: %v", pod.Namespace, pod.Name, err)
+		return rejoined
+	}
+	return rejoined + pending
+}
+
+// synchronizeStoppedPod returns to the host the attached devices of a pod
+// whose sandbox is gone and returns how many were restored and how many
+// could not be. The state of the pod is kept, its sandbox can be created
+// again and the orphaned pods are forgotten by the reconciliation.
+func (k *NetworkDriver) synchronizeStoppedPod(podUID types.UID) (restored, orphaned int) {
+	unlock := k.podLocks.lock(podUID)
+	defer unlock()
+	k.mu.Lock()
+	devices := slices.Clone(k.sharedState.PodDeviceConfig[podUID])
+	preparedData := slices.Clone(k.sharedState.PreparedData[podUID])
+	k.mu.Unlock()
+
+	k.sourceGroups.leavePod(podUID)
+	// the devices are restored without the driver lock, the pod lock keeps
+	// the other operations on this pod out
+	var detached []string
+	for _, device := range devices {
+		prepared, ok := findPreparedDevice(preparedData, device.Name)
+		if !ok || prepared.State != DeviceStateAttached {
+			continue
+		}
+		// the parent of a child interface never left the host
+		if prepared.Config.Child == nil {
+			klog.Infof("Restoring device %q from stopped pod %s", device.Name, podUID)
+			release := k.netnsOps.acquire()
+			err := k.restoreDevice(device, prepared.hostInterface())
+			release()
+			if err != nil {
+				klog.Errorf("failed to restore device %s from stopped pod %s: %v", device.Name, podUID, err)
+				orphaned++
+				continue
+			}
+		}
+		detached = append(detached, device.Name)
+	}
+	if len(detached) == 0 {
+		return 0, orphaned
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	preparedData = k.sharedState.PreparedData[podUID]
+	for _, name := range detached {
+		if i := preparedDeviceIndex(preparedData, name); i >= 0 {
+			preparedData[i].State = DeviceStateDetached
+		}
+	}
+	k.updateDeviceStateMetrics()
+	k.updatePodStatusAnnotation(podUID)
+	if err := k.saveCheckpoint(); err != nil {
+		klog.Errorf("failed to save checkpoint: %v", err)
+	}
+	return len(detached), orphaned
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/containerd/nri/pkg/api"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/vishvananda/netlink"
+	resourceapi "k8s.io/api/resource/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+
+	kndnet "github.com/aojea/kubernetes-network-drivers/pkg/net"
+)
+
+func Test_synchronize(t *testing.T) {
+	var mu sync.Mutex
+	attached := map[string]string{"eth1": "/run/netns/a"}
+	k := NewNetworkDriver(driverName, "node1", fake.NewClientset())
+	k.host.attachNetdev = func(hostIfName string, containerNsPath string, newAttr netlink.LinkAttrs, addresses []*net.IPNet, opts ...kndnet.AttachOption) (*resourceapi.NetworkDeviceData, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		attached[hostIfName] = containerNsPath
+		return nil, nil
+	}
+	k.host.nsLinkInfo = func(containerNsPath string, ifName string) (*kndnet.LinkInfo, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if attached[ifName] != containerNsPath {
+			return nil, fmt.Errorf("link %s not found", ifName)
+		}
+		return &kndnet.LinkInfo{Carrier: true}, nil
+	}
+	k.host.hostLinkExists = func(ifName string) bool { return ifName == "eth2" }
+	var restored []string
+	k.host.restoreNetdev = func(devName, outName string, opts ...kndnet.DetachOption) error {
+		if devName == "eth4" {
+			return fmt.Errorf("device %s not found", devName)
+		}
+		restored = append(restored, devName)
+		return nil
+	}
+
+	k.checkpointPath = ""
+	// eth1 is in the running pod, eth2 was returned to the host by a
+	// previous sandbox of it
+	k.sharedState.PodDeviceConfig["running-uid"] = []AllocatedDevice{
+		{Name: "eth1", NetworkNamespace: "/run/netns/a"},
+		{Name: "eth2", NetworkNamespace: "/run/netns/old"},
+	}
+	k.sharedState.PreparedData["running-uid"] = []PreparedDevice{
+		{DeviceName: "eth1", State: DeviceStateAttached},
+		{DeviceName: "eth2", State: DeviceStateAttached},
+	}
+	// the sandbox of the stopped pod is gone, eth4 cannot be recovered
+	k.sharedState.PodDeviceConfig["stopped-uid"] = []AllocatedDevice{
+		{Name: "eth3", NetworkNamespace: "/run/netns/gone"},
+		{Name: "eth4", NetworkNamespace: "/run/netns/gone"},
+	}
+	k.sharedState.PreparedData["stopped-uid"] = []PreparedDevice{
+		{DeviceName: "eth3", State: DeviceStateAttached},
+		{DeviceName: "eth4", State: DeviceStateAttached},
+	}
+
+	before := map[string]float64{}
+	for _, result := range []string{synchronizeReapplied, synchronizeRestored, synchronizeOrphaned} {
+		before[result] = testutil.ToFloat64(synchronizeDevicesTotal.WithLabelValues(result))
+	}
+	running := newTestSandbox("/run/netns/a")
+	running.Uid = "running-uid"
+	if _, err := k.Synchronize(context.Background(), []*api.PodSandbox{running}, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := map[string]float64{synchronizeReapplied: 1, synchronizeRestored: 1, synchronizeOrphaned: 1}
+	for result, count := range want {
+		if got := testutil.ToFloat64(synchronizeDevicesTotal.WithLabelValues(result)) - before[result]; got != count {
+			t.Errorf("expected %g %s devices, got %g", count, result, got)
+		}
+	}
+	if got := testutil.ToFloat64(synchronizeDuration); got <= 0 {
+		t.Errorf("expected the synchronize duration to be recorded, got %g", got)
+	}
+
+	mu.Lock()
+	if attached["eth2"] != "/run/netns/a" {
+		t.Errorf("expected eth2 attached again to the running pod, got %q", attached["eth2"])
+	}
+	mu.Unlock()
+	if len(restored) != 1 || restored[0] != "eth3" {
+		t.Errorf("expected eth3 restored to the host, got %v", restored)
+	}
+	if got := k.sharedState.PodDeviceConfig["running-uid"][1].NetworkNamespace; got != "/run/netns/a" {
+		t.Errorf("expected eth2 recorded in the running sandbox, got %q", got)
+	}
+	for i, want := range []DeviceState{DeviceStateDetached, DeviceStateAttached} {
+		if got := k.sharedState.PreparedData["stopped-uid"][i].State; got != want {
+			t.Errorf("expected device %d of the stopped pod %s, got %s", i, want, got)
+		}
+	}
+}
+
+func Test_synchronizeRunningPod_checkpoint(t *testing.T) {
+	k := NewNetworkDriver(driverName, "node1", fake.NewClientset())
+	k.host.hostLinkExists = func(ifName string) bool { return ifName == "eth2" }
+
+	checkpointPath := filepath.Join(t.TempDir(), "checkpoint.json")
+	k.checkpointPath = checkpointPath
+	// eth2 was returned to the host by a previous sandbox of the pod
+	k.sharedState.PodDeviceConfig["running-uid"] = []AllocatedDevice{{Name: "eth2", NetworkNamespace: "/run/netns/old"}}
+	// the user-defined namespace it goes into is not there, the run fails
+	// before the devices are recorded
+	k.podsDir = t.TempDir()
+	k.sharedState.PreparedData["running-uid"] = []PreparedDevice{{DeviceName: "eth2", Config: DeviceConfig{NetworkNamespace: "netns/vrf"}, State: DeviceStateAttached}}
+	k.sharedState.PodNames["running-uid"] = types.NamespacedName{Namespace: "default", Name: "pod"}
+
+	running := newTestSandbox("/run/netns/a")
+	running.Uid = "running-uid"
+	if got := k.synchronizeRunningPod(context.Background(), running); got != 0 {
+		t.Errorf("expected no device attached again, got %d", got)
+	}
+
+	// the device stays detached after a restart even if the attach failed
+	restarted := NewNetworkDriver(driverName, "node1", fake.NewClientset())
+	restarted.checkpointPath = checkpointPath
+	if err := restarted.loadCheckpoint(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := restarted.sharedState.PreparedData["running-uid"][0].State; got != DeviceStateDetached {
+		t.Errorf("expected the returned device checkpointed detached, got %s", got)
+	}
+}
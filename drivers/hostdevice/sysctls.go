@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+
+	kndnet "github.com/aojea/kubernetes-network-drivers/pkg/net"
+)
+
+// validateSysctls returns an error if a name is not an interface scoped
+// sysctl, the network namespace wide settings are shared by all the
+// interfaces of the pod and are set with the pod security context.
+func validateSysctls(sysctls map[string]string) error {
+	for _, name := range slices.Sorted(maps.Keys(sysctls)) {
+		if _, err := kndnet.ParseInterfaceSysctl(name); err != nil {
+			return err
+		}
+		if sysctls[name] == "" {
+			return fmt.Errorf("sysctl %s has no value", name)
+		}
+	}
+	return nil
+}
+
+// checkSysctls returns an error if the sysctls of the device configuration
+// are not of its interface in the pod, known once the device is prepared.
+func checkSysctls(device PreparedDevice) error {
+	ifName := device.podInterface()
+	for _, name := range slices.Sorted(maps.Keys(device.Config.Sysctls)) {
+		// validated with the configuration
+		sysctl, _ := kndnet.ParseInterfaceSysctl(name)
+		if sysctl.Interface != ifName {
+			return fmt.Errorf("sysctl %s is not of the interface %s of device %s in the pod", name, ifName, device.DeviceName)
+		}
+	}
+	return nil
+}
+
+// sysctlNames returns the names of the sysctls restored when the device is
+// detached.
+func sysctlNames(sysctls map[string]string) []string {
+	return slices.Sorted(maps.Keys(sysctls))
+}
@@ -0,0 +1,45 @@
+package main
+
+import "testing"
+
+func Test_checkSysctls(t *testing.T) {
+	tests := []struct {
+		name    string
+		device  PreparedDevice
+		wantErr bool
+	}{
+		{
+			name:   "host interface",
+			device: PreparedDevice{DeviceName: "eth1", Config: DeviceConfig{Sysctls: map[string]string{"net.ipv4.conf.eth1.rp_filter": "2"}}},
+		},
+		{
+			name:   "renamed interface",
+			device: PreparedDevice{DeviceName: "eth1", Config: DeviceConfig{InterfaceName: "net1", Sysctls: map[string]string{"net.ipv4.conf.net1.arp_ignore": "1", "net.ipv6.neigh.net1.retrans_time_ms": "500"}}},
+		},
+		{
+			name:   "vlan interface",
+			device: PreparedDevice{DeviceName: "eth1", Config: DeviceConfig{VLAN: 100, Sysctls: map[string]string{"net.ipv4.conf.eth1.100.rp_filter": "2"}}},
+		},
+		{
+			name:   "virtual function",
+			device: PreparedDevice{DeviceName: "eth1", InterfaceName: "eth1v0", Config: DeviceConfig{Sysctls: map[string]string{"net.ipv4.conf.eth1v0.rp_filter": "2"}}},
+		},
+		{
+			name:    "host name of a renamed interface",
+			device:  PreparedDevice{DeviceName: "eth1", Config: DeviceConfig{InterfaceName: "net1", Sysctls: map[string]string{"net.ipv4.conf.eth1.rp_filter": "2"}}},
+			wantErr: true,
+		},
+		{
+			name:    "other interface",
+			device:  PreparedDevice{DeviceName: "eth1", Config: DeviceConfig{Sysctls: map[string]string{"net.ipv4.conf.eth0.rp_filter": "2"}}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := checkSysctls(tt.device); (err != nil) != tt.wantErr {
+				t.Errorf("checkSysctls() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
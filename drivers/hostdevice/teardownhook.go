@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	"github.com/containerd/nri/pkg/api"
+	"k8s.io/klog/v2"
+)
+
+// defaultTeardownHookTimeout bounds the teardown hook of each device by default.
+const defaultTeardownHookTimeout = 10 * time.Second
+
+// teardownHook is an executable run after each device of a pod is returned
+// to the host, so external systems like a switch configuration or an IPAM
+// release its resources.
+type teardownHook struct {
+	path    string
+	timeout time.Duration
+}
+
+// newTeardownHook returns the hook running the executable at path.
+func newTeardownHook(path string, timeout time.Duration) (*teardownHook, error) {
+	if !filepath.IsAbs(path) {
+		return nil, fmt.Errorf("invalid teardown hook %q, must be an absolute path", path)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("invalid teardown hook: %w", err)
+	}
+	if !info.Mode().IsRegular() || info.Mode().Perm()&0111 == 0 {
+		return nil, fmt.Errorf("invalid teardown hook %s, must be an executable file", path)
+	}
+	if timeout <= 0 {
+		return nil, fmt.Errorf("invalid teardown hook timeout %s, must be positive", timeout)
+	}
+	return &teardownHook{path: path, timeout: timeout}, nil
+}
+
+// run executes the hook with the detach event of a device as JSON on its
+// standard input and the main fields in its environment. The hook is killed
+// after the timeout.
+func (h *teardownHook) run(ctx context.Context, event DeviceEvent) ([]byte, error) {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode %s event: %w", event.Event, err)
+	}
+	ctx, cancel := context.WithTimeout(ctx, h.timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, h.path)
+	cmd.Stdin = bytes.NewReader(body)
+	cmd.Env = append(os.Environ(),
+		"KND_EVENT="+event.Event,
+		"KND_NODE="+event.Node,
+		"KND_POD_NAMESPACE="+event.Pod.Namespace,
+		"KND_POD_NAME="+event.Pod.Name,
+		"KND_POD_UID="+event.Pod.UID,
+	)
+	if len(event.Devices) > 0 {
+		cmd.Env = append(cmd.Env, "KND_DEVICE="+event.Devices[0].Name)
+	}
+	// the children of a killed hook holding the output do not block it
+	cmd.WaitDelay = time.Second
+	output, err := cmd.CombinedOutput()
+	if ctx.Err() == context.DeadlineExceeded {
+		return output, fmt.Errorf("teardown hook timed out after %s", h.timeout)
+	}
+	return output, err
+}
+
+// runTeardownHook runs the teardown hook, if configured, for a device of the
+// pod returned to the host. A failure is only logged, it does not stop the
+// cleanup of the other devices nor the pod.
+func (k *NetworkDriver) runTeardownHook(ctx context.Context, pod *api.PodSandbox, networkNamespace string, device AllocatedDevice) {
+	if k.teardownHook == nil {
+		return
+	}
+	event := newDeviceEvent(DeviceEventDetach, k.nodeName, pod, networkNamespace, []AllocatedDevice{device})
+	start := time.Now()
+	output, err := k.teardownHook.run(ctx, event)
+	if err != nil {
+		klog.Errorf("teardown hook of device %s of pod %s/%s failed after %s: %v, output: %q",
+			device.Name, pod.Namespace, pod.Name, time.Since(start).Round(time.Millisecond), err, output)
+		return
+	}
+	klog.V(2).Infof("Teardown hook of device %s of pod %s/%s succeeded in %s, output: %q",
+		device.Name, pod.Namespace, pod.Name, time.Since(start).Round(time.Millisecond), output)
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/containerd/nri/pkg/api"
+	"k8s.io/client-go/kubernetes/fake"
+
+	kndnet "github.com/aojea/kubernetes-network-drivers/pkg/net"
+)
+
+// writeHook writes an executable shell script in a temporary directory.
+func writeHook(t *testing.T, script string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "hook")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func Test_newTeardownHook(t *testing.T) {
+	hook := writeHook(t, "exit 0\n")
+	notExecutable := filepath.Join(t.TempDir(), "hook")
+	if err := os.WriteFile(notExecutable, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		path    string
+		timeout time.Duration
+		wantErr bool
+	}{
+		{name: "valid", path: hook, timeout: time.Second},
+		{name: "relative", path: "hook", timeout: time.Second, wantErr: true},
+		{name: "missing", path: filepath.Join(t.TempDir(), "missing"), timeout: time.Second, wantErr: true},
+		{name: "not executable", path: notExecutable, timeout: time.Second, wantErr: true},
+		{name: "directory", path: t.TempDir(), timeout: time.Second, wantErr: true},
+		{name: "no timeout", path: hook, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := newTeardownHook(tt.path, tt.timeout); (err != nil) != tt.wantErr {
+				t.Errorf("expected error %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func Test_StopPodSandbox_teardownHook(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "events")
+	// the hook fails for eth2, and records the events of the other devices
+	path := writeHook(t, `[ "$KND_DEVICE" = eth2 ] && exit 1
+{ cat; echo; } >> `+out+`
+`)
+	k := NewNetworkDriver(driverName, "node1", fake.NewClientset())
+	k.host.detachNetdev = func(containerNsPath string, devName string, outName string, opts ...kndnet.DetachOption) error {
+		if devName == "eth3" {
+			return errors.New("device busy")
+		}
+		return nil
+	}
+
+	k.checkpointPath = ""
+	var err error
+	if k.teardownHook, err = newTeardownHook(path, 5*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	k.sharedState.PodDeviceConfig["pod-uid"] = []AllocatedDevice{
+		{Name: "eth1", Request: "nic"},
+		{Name: "eth2", Request: "nic"},
+		{Name: "eth3", Request: "nic"},
+	}
+	k.sharedState.PreparedData["pod-uid"] = []PreparedDevice{
+		{DeviceName: "eth1", State: DeviceStateAttached},
+		{DeviceName: "eth2", State: DeviceStateAttached},
+		{DeviceName: "eth3", State: DeviceStateAttached},
+	}
+
+	err = k.StopPodSandbox(context.Background(), &api.PodSandbox{Uid: "pod-uid", Name: "pod", Namespace: "default"})
+	if err == nil || !strings.Contains(err.Error(), "device busy") {
+		t.Fatalf("expected the detach failure of eth3, got %v", err)
+	}
+
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var devices []string
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		var event DeviceEvent
+		if err := json.Unmarshal([]byte(line), &event); err != nil {
+			t.Fatalf("invalid event %q: %v", line, err)
+		}
+		if event.Event != DeviceEventDetach || event.Node != "node1" || event.Pod.UID != "pod-uid" || len(event.Devices) != 1 {
+			t.Errorf("unexpected event %+v", event)
+			continue
+		}
+		devices = append(devices, event.Devices[0].Name)
+	}
+	// eth3 is still in the pod, the failure of the hook of eth2 does not
+	// stop the cleanup of eth1
+	if want := []string{"eth1"}; !reflect.DeepEqual(devices, want) {
+		t.Errorf("expected the hook to record devices %v, got %v", want, devices)
+	}
+}
+
+func Test_teardownHook_timeout(t *testing.T) {
+	hook, err := newTeardownHook(writeHook(t, "sleep 10\n"), 100*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	_, err = hook.run(context.Background(), DeviceEvent{Event: DeviceEventDetach})
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("expected a timeout, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("expected the hook to be killed after the timeout, took %s", elapsed)
+	}
+}
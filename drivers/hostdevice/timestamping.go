@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	resourceapi "k8s.io/api/resource/v1"
+	"k8s.io/klog/v2"
+
+	kndnet "github.com/aojea/kubernetes-network-drivers/pkg/net"
+)
+
+// timestampingDisabled is the hardware timestamping configuration restored
+// on the devices whose previous configuration was not recorded.
+var timestampingDisabled = kndnet.HardwareTimestamping{TxType: "off", RxFilter: "none"}
+
+// addTimestampingAttributes publishes the timestamping capabilities of the
+// host interface ifName, so PTP workloads can select the devices with a
+// hardware clock:
+//   - hw-timestamping, true if the packets are timestamped by the hardware clock.
+//   - ptp-clock-index, the index of the PTP hardware clock /dev/ptp<index>.
+//   - timestamping-rx-filters, the comma separated list of supported receive
+//     filters, e.g. none,all,ptpv2-event.
+func (k *NetworkDriver) addTimestampingAttributes(device *resourceapi.Device, ifName string) {
+	info, err := k.host.timestampingInfo(ifName)
+	if err != nil {
+		klog.V(2).Infof("failed to get timestamping capabilities of %s: %v", ifName, err)
+		return
+	}
+	setTimestampingAttributes(device, info)
+}
+
+func setTimestampingAttributes(device *resourceapi.Device, info kndnet.TimestampingInfo) {
+	hardware := info.Hardware()
+	device.Attributes["hw-timestamping"] = resourceapi.DeviceAttribute{BoolValue: &hardware}
+	if info.PHCIndex >= 0 {
+		index := int64(info.PHCIndex)
+		device.Attributes["ptp-clock-index"] = resourceapi.DeviceAttribute{IntValue: &index}
+	}
+	if len(info.RxFilters) > 0 {
+		filters := strings.Join(info.RxFilters, ",")
+		device.Attributes["timestamping-rx-filters"] = resourceapi.DeviceAttribute{StringValue: &filters}
+	}
+}
+
+// checkTimestamping returns an error if the host interface ifName does not
+// support the hardware timestamping configuration.
+func (k *NetworkDriver) checkTimestamping(ifName string, config kndnet.HardwareTimestamping) error {
+	info, err := k.host.timestampingInfo(ifName)
+	if err != nil {
+		return err
+	}
+	if err := info.Supports(config); err != nil {
+		return fmt.Errorf("device %s does not support hardware timestamping: %w", ifName, err)
+	}
+	return nil
+}
+
+// restoreTimestamping sets the hardware timestamping configuration the
+// device had before it was moved with setConfig, or disables it if it was
+// not recorded.
+func restoreTimestamping(device AllocatedDevice, setConfig func(kndnet.HardwareTimestamping) error) error {
+	config := timestampingDisabled
+	if device.HardwareTimestamping != nil {
+		config = *device.HardwareTimestamping
+	}
+	return setConfig(config)
+}
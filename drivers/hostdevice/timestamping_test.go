@@ -0,0 +1,78 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	resourceapi "k8s.io/api/resource/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	kndnet "github.com/aojea/kubernetes-network-drivers/pkg/net"
+)
+
+func Test_setTimestampingAttributes(t *testing.T) {
+	ptp := kndnet.TimestampingInfo{
+		Capabilities: []string{"hardware-transmit", "software-transmit", "hardware-receive", "software-receive", "hardware-raw-clock"},
+		PHCIndex:     1,
+		TxTypes:      []string{"off", "on"},
+		RxFilters:    []string{"none", "ptpv2-event"},
+	}
+	device := resourceapi.Device{Attributes: map[resourceapi.QualifiedName]resourceapi.DeviceAttribute{}}
+	setTimestampingAttributes(&device, ptp)
+	if v := device.Attributes["hw-timestamping"].BoolValue; v == nil || !*v {
+		t.Errorf("hw-timestamping = %v, want true", v)
+	}
+	if v := device.Attributes["ptp-clock-index"].IntValue; v == nil || *v != 1 {
+		t.Errorf("ptp-clock-index = %v, want 1", v)
+	}
+	if v := device.Attributes["timestamping-rx-filters"].StringValue; v == nil || *v != "none,ptpv2-event" {
+		t.Errorf("timestamping-rx-filters = %v, want none,ptpv2-event", v)
+	}
+
+	software := kndnet.TimestampingInfo{Capabilities: []string{"software-transmit", "software-receive"}, PHCIndex: -1}
+	device = resourceapi.Device{Attributes: map[resourceapi.QualifiedName]resourceapi.DeviceAttribute{}}
+	setTimestampingAttributes(&device, software)
+	if v := device.Attributes["hw-timestamping"].BoolValue; v == nil || *v {
+		t.Errorf("hw-timestamping = %v, want false", v)
+	}
+	for _, name := range []resourceapi.QualifiedName{"ptp-clock-index", "timestamping-rx-filters"} {
+		if _, ok := device.Attributes[name]; ok {
+			t.Errorf("unexpected attribute %s on a device without a hardware clock", name)
+		}
+	}
+}
+
+func Test_checkTimestamping(t *testing.T) {
+	k := NewNetworkDriver(driverName, "node1", fake.NewClientset())
+	k.host.timestampingInfo = func(ifName string) (kndnet.TimestampingInfo, error) {
+		if ifName != "eth1" {
+			return kndnet.TimestampingInfo{}, errors.New("operation not supported")
+		}
+		return kndnet.TimestampingInfo{TxTypes: []string{"off", "on"}, RxFilters: []string{"none", "all"}}, nil
+	}
+
+	if err := k.checkTimestamping("eth1", kndnet.HardwareTimestamping{TxType: "on", RxFilter: "all"}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := k.checkTimestamping("eth1", kndnet.HardwareTimestamping{TxType: "on", RxFilter: "ptpv2-event"}); err == nil {
+		t.Errorf("expected error for an unsupported filter")
+	}
+	if err := k.checkTimestamping("eth2", kndnet.HardwareTimestamping{TxType: "on", RxFilter: "all"}); err == nil {
+		t.Errorf("expected error for a device without timestamping")
+	}
+}
+
+func Test_restoreTimestamping(t *testing.T) {
+	var got kndnet.HardwareTimestamping
+	set := func(config kndnet.HardwareTimestamping) error {
+		got = config
+		return nil
+	}
+	if err := restoreTimestamping(AllocatedDevice{Name: "eth1"}, set); err != nil || got != timestampingDisabled {
+		t.Errorf("restoreTimestamping() set %+v, %v, want disabled", got, err)
+	}
+	previous := kndnet.HardwareTimestamping{TxType: "on", RxFilter: "all"}
+	if err := restoreTimestamping(AllocatedDevice{Name: "eth1", HardwareTimestamping: &previous}, set); err != nil || got != previous {
+		t.Errorf("restoreTimestamping() set %+v, %v, want %+v", got, err, previous)
+	}
+}
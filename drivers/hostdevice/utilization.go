@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+)
+
+// deviceUtilizationAnnotation is the pod annotation with the utilization of each
+// of its devices, as a JSON object mapping the device name to the highest
+// of its receive and transmit utilization ratios.
+const deviceUtilizationAnnotation = "hostdevice.k8s.io/device-utilization"
+
+// utilizationAnnotationThreshold is how much the utilization ratio of a device
+// must change since the value in the pod annotation to patch the pod again, so
+// the pods are not patched on every sample.
+const utilizationAnnotationThreshold = 0.05
+
+// deviceSample is a snapshot of the counters of a device.
+type deviceSample struct {
+	rxBytes uint64
+	txBytes uint64
+	time    time.Time
+}
+
+// computeRates returns the receive and transmit rates in bits per second
+// between two samples, it returns false if the counters were reset.
+func computeRates(prev, cur deviceSample) (float64, float64, bool) {
+	elapsed := cur.time.Sub(prev.time).Seconds()
+	if elapsed <= 0 || cur.rxBytes < prev.rxBytes || cur.txBytes < prev.txBytes {
+		return 0, 0, false
+	}
+	rx := float64(cur.rxBytes-prev.rxBytes) * 8 / elapsed
+	tx := float64(cur.txBytes-prev.txBytes) * 8 / elapsed
+	return rx, tx, true
+}
+
+// utilizationChanged returns true if the utilization of the devices of a pod
+// differs from the published one by at least the annotation threshold, or
+// the devices are not the same.
+func utilizationChanged(published, utilization map[string]float64) bool {
+	if len(published) != len(utilization) {
+		return true
+	}
+	for device, ratio := range utilization {
+		prev, ok := published[device]
+		if !ok || math.Abs(ratio-prev) >= utilizationAnnotationThreshold {
+			return true
+		}
+	}
+	return false
+}
+
+// utilizationRatio returns the fraction of the link speed used by a rate in bits per second.
+func utilizationRatio(bps float64, speedMbps int) float64 {
+	if speedMbps <= 0 {
+		return 0
+	}
+	return bps / (float64(speedMbps) * 1000000)
+}
+
+// sampleUtilization periodically samples the counters of the devices attached
+// to pods, inside each pod network namespace, and exposes their throughput and
+// utilization as metrics and optionally as a pod annotation.
+func (k *NetworkDriver) sampleUtilization(ctx context.Context) {
+	samples := map[string]deviceSample{}
+	published := map[types.UID]map[string]float64{}
+	ticker := time.NewTicker(k.utilizationInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			k.sampleUtilizationOnce(ctx, samples, published)
+		}
+	}
+}
+
+// sampleUtilizationOnce takes a new sample of every attached device and
+// updates the metrics using the previous samples. The pod annotations are
+// only patched when the utilization changed since the published value.
+func (k *NetworkDriver) sampleUtilizationOnce(ctx context.Context, samples map[string]deviceSample, published map[types.UID]map[string]float64) {
+	type target struct {
+		podUID types.UID
+		device AllocatedDevice
+		ifName string
+	}
+	var targets []target
+	pods := map[types.UID]types.NamespacedName{}
+	k.mu.Lock()
+	for podUID, devices := range k.sharedState.PodDeviceConfig {
+		for _, device := range devices {
+			prepared, ok := findPreparedDevice(k.sharedState.PreparedData[podUID], device.Name)
+			if !ok || prepared.State != DeviceStateAttached || device.NetworkNamespace == "" {
+				continue
+			}
+			targets = append(targets, target{podUID: podUID, device: device, ifName: prepared.podInterface()})
+		}
+		pods[podUID] = k.sharedState.PodNames[podUID]
+	}
+	k.mu.Unlock()
+
+	// labels are per host device so the cardinality is bounded by the
+	// number of devices on the node, detached devices are removed
+	deviceThroughput.Reset()
+	deviceUtilization.Reset()
+	sampled := map[string]bool{}
+	podUtilization := map[types.UID]map[string]float64{}
+	now := time.Now()
+	for _, t := range targets {
+		stats, err := k.host.linkStatistics(t.device.NetworkNamespace, t.ifName)
+		if err != nil {
+			klog.V(4).Infof("failed to sample device %s of pod %s: %v", t.device.Name, t.podUID, err)
+			continue
+		}
+		key := string(t.podUID) + "/" + t.device.Name
+		cur := deviceSample{rxBytes: stats.RxBytes, txBytes: stats.TxBytes, time: now}
+		prev, ok := samples[key]
+		samples[key] = cur
+		sampled[key] = true
+		if !ok {
+			continue
+		}
+		rx, tx, ok := computeRates(prev, cur)
+		if !ok {
+			continue
+		}
+		deviceThroughput.WithLabelValues(t.device.Name, "rx").Set(rx)
+		deviceThroughput.WithLabelValues(t.device.Name, "tx").Set(tx)
+		if t.device.SpeedMbps <= 0 {
+			continue
+		}
+		rxRatio := utilizationRatio(rx, t.device.SpeedMbps)
+		txRatio := utilizationRatio(tx, t.device.SpeedMbps)
+		deviceUtilization.WithLabelValues(t.device.Name, "rx").Set(rxRatio)
+		deviceUtilization.WithLabelValues(t.device.Name, "tx").Set(txRatio)
+		if podUtilization[t.podUID] == nil {
+			podUtilization[t.podUID] = map[string]float64{}
+		}
+		podUtilization[t.podUID][t.device.Name] = max(rxRatio, txRatio)
+	}
+	for key := range samples {
+		if !sampled[key] {
+			delete(samples, key)
+		}
+	}
+
+	if !k.utilizationAnnotation {
+		return
+	}
+	for podUID := range published {
+		if _, ok := podUtilization[podUID]; !ok {
+			delete(published, podUID)
+		}
+	}
+	for podUID, utilization := range podUtilization {
+		pod := pods[podUID]
+		if pod.Name == "" || !utilizationChanged(published[podUID], utilization) {
+			continue
+		}
+		if err := k.annotatePodUtilization(ctx, pod, utilization); err != nil {
+			klog.V(2).Infof("failed to annotate utilization on pod %s: %v", pod, err)
+			continue
+		}
+		published[podUID] = utilization
+	}
+}
+
+// annotatePodUtilization records the utilization of the pod devices in the pod annotations.
+func (k *NetworkDriver) annotatePodUtilization(ctx context.Context, pod types.NamespacedName, utilization map[string]float64) error {
+	value, err := json.Marshal(utilization)
+	if err != nil {
+		return err
+	}
+	patch, err := json.Marshal(map[string]any{
+		"metadata": map[string]any{
+			"annotations": map[string]string{deviceUtilizationAnnotation: string(value)},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = k.kubeClient.CoreV1().Pods(pod.Namespace).Patch(ctx, pod.Name, types.MergePatchType, patch, metav1.PatchOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to patch pod %s: %w", pod, err)
+	}
+	return nil
+}
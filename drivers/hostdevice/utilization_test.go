@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/vishvananda/netlink"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func Test_computeRates(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name   string
+		prev   deviceSample
+		cur    deviceSample
+		wantRx float64
+		wantTx float64
+		wantOk bool
+	}{
+		{
+			name:   "rates",
+			prev:   deviceSample{rxBytes: 1000, txBytes: 500, time: now},
+			cur:    deviceSample{rxBytes: 2000, txBytes: 1500, time: now.Add(2 * time.Second)},
+			wantRx: 4000,
+			wantTx: 4000,
+			wantOk: true,
+		},
+		{
+			name:   "counters reset",
+			prev:   deviceSample{rxBytes: 1000, txBytes: 500, time: now},
+			cur:    deviceSample{rxBytes: 10, txBytes: 10, time: now.Add(time.Second)},
+			wantOk: false,
+		},
+		{
+			name:   "same time",
+			prev:   deviceSample{rxBytes: 1000, txBytes: 500, time: now},
+			cur:    deviceSample{rxBytes: 2000, txBytes: 1500, time: now},
+			wantOk: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rx, tx, ok := computeRates(tt.prev, tt.cur)
+			if ok != tt.wantOk || rx != tt.wantRx || tx != tt.wantTx {
+				t.Errorf("computeRates() = %v, %v, %v, want %v, %v, %v", rx, tx, ok, tt.wantRx, tt.wantTx, tt.wantOk)
+			}
+		})
+	}
+}
+
+func Test_utilizationRatio(t *testing.T) {
+	if got := utilizationRatio(500000000, 1000); got != 0.5 {
+		t.Errorf("expected utilization 0.5, got %v", got)
+	}
+	if got := utilizationRatio(500000000, -1); got != 0 {
+		t.Errorf("expected utilization 0 for unknown speed, got %v", got)
+	}
+}
+
+func Test_annotatePodUtilization(t *testing.T) {
+	pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "pod", Namespace: "default", UID: "pod-uid"}}
+	client := fake.NewClientset(pod)
+	k := NewNetworkDriver(driverName, "node1", client)
+
+	err := k.annotatePodUtilization(context.Background(), types.NamespacedName{Namespace: "default", Name: "pod"}, map[string]float64{"eth1": 0.25})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got, err := client.CoreV1().Pods("default").Get(context.Background(), "pod", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value := got.Annotations[deviceUtilizationAnnotation]; value != `{"eth1":0.25}` {
+		t.Errorf("unexpected annotation value %q", value)
+	}
+}
+
+func Test_sampleUtilizationOnce(t *testing.T) {
+	var sampled []string
+	k := NewNetworkDriver(driverName, "node1", fake.NewClientset())
+	k.host.linkStatistics = func(containerNsPath string, ifName string) (*netlink.LinkStatistics, error) {
+		sampled = append(sampled, containerNsPath+" "+ifName)
+		return &netlink.LinkStatistics{}, nil
+	}
+	k.sharedState.PodNames["pod-uid"] = types.NamespacedName{Namespace: "ns", Name: "pod"}
+	k.sharedState.PodDeviceConfig["pod-uid"] = []AllocatedDevice{
+		{Name: "eth1", NetworkNamespace: "/run/netns/pod"},
+		{Name: "eth2", NetworkNamespace: "/run/netns/pod"},
+	}
+	k.sharedState.PreparedData["pod-uid"] = []PreparedDevice{
+		{DeviceName: "eth1", State: DeviceStateAttached, Config: DeviceConfig{InterfaceName: "net1"}},
+		// not attached yet
+		{DeviceName: "eth2"},
+	}
+
+	samples := map[string]deviceSample{}
+	k.sampleUtilizationOnce(context.Background(), samples, map[types.UID]map[string]float64{})
+	if len(sampled) != 1 || sampled[0] != "/run/netns/pod net1" {
+		t.Errorf("expected only the attached device to be sampled in the pod, got %v", sampled)
+	}
+	if _, ok := samples["pod-uid/eth1"]; !ok || len(samples) != 1 {
+		t.Errorf("unexpected samples %v", samples)
+	}
+}
+
+func Test_utilizationChanged(t *testing.T) {
+	tests := []struct {
+		name        string
+		published   map[string]float64
+		utilization map[string]float64
+		want        bool
+	}{
+		{name: "not published", utilization: map[string]float64{"eth1": 0.25}, want: true},
+		{name: "unchanged", published: map[string]float64{"eth1": 0.25}, utilization: map[string]float64{"eth1": 0.25}},
+		{name: "below the threshold", published: map[string]float64{"eth1": 0.25}, utilization: map[string]float64{"eth1": 0.27}},
+		{name: "above the threshold", published: map[string]float64{"eth1": 0.25}, utilization: map[string]float64{"eth1": 0.4}, want: true},
+		{name: "decreased", published: map[string]float64{"eth1": 0.25}, utilization: map[string]float64{"eth1": 0.1}, want: true},
+		{name: "new device", published: map[string]float64{"eth1": 0.25}, utilization: map[string]float64{"eth1": 0.25, "eth2": 0}, want: true},
+		{name: "other device", published: map[string]float64{"eth1": 0.25}, utilization: map[string]float64{"eth2": 0.25}, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := utilizationChanged(tt.published, tt.utilization); got != tt.want {
+				t.Errorf("utilizationChanged() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/containerd/nri/pkg/api"
+	"github.com/vishvananda/netlink"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// restoreVerifyInterval is how often the host is checked for a detached device.
+	restoreVerifyInterval = 100 * time.Millisecond
+	// restoreFailedReason is the reason of the events of the devices not returned to the host.
+	restoreFailedReason = "DeviceRestoreFailed"
+	// deviceDownReason is the reason of the events of the devices returned to the host down.
+	deviceDownReason = "DeviceRestoredDown"
+)
+
+// hostLinkExists returns true if the interface is in the host namespace.
+func hostLinkExists(ifName string) bool {
+	_, err := netlink.LinkByName(ifName)
+	return err == nil || errors.Is(err, netlink.ErrDumpInterrupted)
+}
+
+// verifyRestored waits up to the detach verification timeout for the host
+// interface of a detached device to appear in the host namespace with its
+// name. The kernel move occasionally fails without an error, so if the
+// device does not show up it is restored again and waited for once more.
+func (k *NetworkDriver) verifyRestored(ctx context.Context, pod *api.PodSandbox, device AllocatedDevice, preparedDevice PreparedDevice) error {
+	// child interfaces are deleted, not returned
+	if k.detachVerifyTimeout <= 0 || preparedDevice.Config.Child != nil {
+		return nil
+	}
+	ifName := preparedDevice.hostInterface()
+	if err := k.waitHostLink(ctx, ifName, k.detachVerifyTimeout); err == nil {
+		return nil
+	}
+
+	klog.Warningf("Device %q of pod %s/%s did not reappear on the host after %v, restoring it again",
+		ifName, pod.Namespace, pod.Name, k.detachVerifyTimeout)
+	restoreErr := k.restoreDevice(device, ifName)
+	if err := k.waitHostLink(ctx, ifName, k.detachVerifyTimeout); err == nil {
+		return nil
+	}
+	err := fmt.Errorf("device %s not found on the host after detach", ifName)
+	if restoreErr != nil {
+		err = fmt.Errorf("%w: %w", err, restoreErr)
+	}
+	k.recordRestoreFailed(pod, err)
+	return err
+}
+
+// waitHostLink polls the host namespace for the interface ifName until timeout.
+func (k *NetworkDriver) waitHostLink(ctx context.Context, ifName string, timeout time.Duration) error {
+	return wait.PollUntilContextTimeout(ctx, restoreVerifyInterval, timeout, true, func(context.Context) (bool, error) {
+		return k.host.hostLinkExists(ifName), nil
+	})
+}
+
+// recordRestoreFailed emits a warning event on the pod whose device was not returned to the host.
+func (k *NetworkDriver) recordRestoreFailed(pod *api.PodSandbox, err error) {
+	k.recordPodWarning(pod, restoreFailedReason, err)
+}
+
+// recordDeviceDown emits a warning event on the pod whose device was returned to the host down.
+func (k *NetworkDriver) recordDeviceDown(pod *api.PodSandbox, err error) {
+	k.recordPodWarning(pod, deviceDownReason, err)
+}
+
+func (k *NetworkDriver) recordPodWarning(pod *api.PodSandbox, reason string, err error) {
+	k.recordPodEvent(pod, v1.EventTypeWarning, reason, "Node %s: %v", k.nodeName, err)
+}
+
+// recordPodEvent emits an event on the pod.
+func (k *NetworkDriver) recordPodEvent(pod *api.PodSandbox, eventType, reason, messageFmt string, args ...interface{}) {
+	if k.eventRecorder == nil {
+		return
+	}
+	ref := &v1.ObjectReference{
+		APIVersion: "v1",
+		Kind:       "Pod",
+		Namespace:  pod.GetNamespace(),
+		Name:       pod.GetName(),
+		UID:        types.UID(pod.GetUid()),
+	}
+	k.eventRecorder.Eventf(ref, eventType, reason, messageFmt, args...)
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/containerd/nri/pkg/api"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+
+	kndnet "github.com/aojea/kubernetes-network-drivers/pkg/net"
+)
+
+func Test_verifyRestored(t *testing.T) {
+	tests := []struct {
+		name string
+		// restored is true if the device is on the host before the retry
+		restored bool
+		// recovers is true if the retry returns the device to the host
+		recovers     bool
+		config       DeviceConfig
+		wantRestores int
+		wantErr      bool
+	}{
+		{name: "device on the host", restored: true},
+		{name: "device restored on retry", recovers: true, wantRestores: 1},
+		{name: "device lost", wantRestores: 1, wantErr: true},
+		{name: "child interface", config: DeviceConfig{Child: &ChildConfig{Type: "macvlan"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			restores := 0
+			k := NewNetworkDriver(driverName, "node1", fake.NewClientset())
+			k.host.restoreNetdev = func(devName string, outName string, opts ...kndnet.DetachOption) error {
+				restores++
+				return nil
+			}
+			k.host.hostLinkExists = func(ifName string) bool {
+				return tt.restored || (tt.recovers && restores > 0)
+			}
+
+			k.detachVerifyTimeout = 10 * time.Millisecond
+			recorder := record.NewFakeRecorder(10)
+			k.eventRecorder = recorder
+
+			pod := &api.PodSandbox{Namespace: "ns", Name: "pod", Uid: "pod-uid"}
+			device := AllocatedDevice{Name: "eth1", NetworkNamespace: "/run/netns/does-not-exist"}
+			err := k.verifyRestored(context.Background(), pod, device, PreparedDevice{DeviceName: "eth1", Config: tt.config})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("verifyRestored() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if restores != tt.wantRestores {
+				t.Errorf("expected %d restores, got %d", tt.wantRestores, restores)
+			}
+			select {
+			case event := <-recorder.Events:
+				if !tt.wantErr || !strings.Contains(event, restoreFailedReason) {
+					t.Errorf("unexpected event %q", event)
+				}
+			default:
+				if tt.wantErr {
+					t.Errorf("expected a %s event", restoreFailedReason)
+				}
+			}
+		})
+	}
+}
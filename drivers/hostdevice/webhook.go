@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/containerd/nri/pkg/api"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// DeviceEventAttach is sent after the devices are moved into the pod network namespace.
+	DeviceEventAttach = "attach"
+	// DeviceEventDetach is sent after the devices are returned to the host.
+	DeviceEventDetach = "detach"
+
+	defaultWebhookTimeout = 5 * time.Second
+	webhookAttempts       = 3
+	webhookRetryDelay     = 1 * time.Second
+)
+
+// DeviceEvent is the payload posted to the webhook on device events.
+type DeviceEvent struct {
+	// Event is attach or detach.
+	Event string `json:"event"`
+	// Node is the node the pod is running on.
+	Node string `json:"node"`
+	// Pod is the pod the devices belong to.
+	Pod EventPod `json:"pod"`
+	// Devices are the devices of the pod.
+	Devices []EventDevice `json:"devices"`
+}
+
+// EventPod identifies the pod of a device event.
+type EventPod struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	UID       string `json:"uid"`
+	// NetworkNamespace is the path of the pod network namespace.
+	NetworkNamespace string `json:"networkNamespace,omitempty"`
+	// IPs are the pod addresses assigned by the primary network.
+	IPs []string `json:"ips,omitempty"`
+}
+
+// EventDevice describes a device of a device event.
+type EventDevice struct {
+	Name       string            `json:"name"`
+	PoolName   string            `json:"poolName,omitempty"`
+	Request    string            `json:"request,omitempty"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+}
+
+// webhook notifies an external controller of the device events.
+type webhook struct {
+	url   string
+	token string
+	// blocking makes the pod start wait for, and fail on, the attach notification.
+	blocking   bool
+	retryDelay time.Duration
+	client     *http.Client
+}
+
+// newWebhook creates a webhook posting to url, the token is read from tokenFile if set.
+func newWebhook(url, tokenFile string, timeout time.Duration, blocking bool) (*webhook, error) {
+	if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+		return nil, fmt.Errorf("invalid webhook url %q, must be http or https", url)
+	}
+	w := &webhook{
+		url:        url,
+		blocking:   blocking,
+		retryDelay: webhookRetryDelay,
+		client:     &http.Client{Timeout: timeout},
+	}
+	if tokenFile != "" {
+		data, err := os.ReadFile(tokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read webhook token %s: %w", tokenFile, err)
+		}
+		w.token = strings.TrimSpace(string(data))
+	}
+	return w, nil
+}
+
+// newDeviceEvent builds the event of the devices of a pod.
+func newDeviceEvent(event, node string, pod *api.PodSandbox, networkNamespace string, devices []AllocatedDevice) DeviceEvent {
+	e := DeviceEvent{
+		Event: event,
+		Node:  node,
+		Pod: EventPod{
+			Namespace:        pod.GetNamespace(),
+			Name:             pod.GetName(),
+			UID:              pod.GetUid(),
+			NetworkNamespace: networkNamespace,
+			IPs:              pod.GetIps(),
+		},
+	}
+	for _, device := range devices {
+		e.Devices = append(e.Devices, EventDevice{
+			Name:       device.Name,
+			PoolName:   device.PoolName,
+			Request:    device.Request,
+			Attributes: device.Attributes,
+		})
+	}
+	return e
+}
+
+// notify posts the event to the webhook, retrying on failures.
+func (w *webhook) notify(ctx context.Context, event DeviceEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s event: %w", event.Event, err)
+	}
+	for attempt := 1; ; attempt++ {
+		err = w.post(ctx, body)
+		if err == nil {
+			return nil
+		}
+		if attempt == webhookAttempts {
+			return fmt.Errorf("failed to notify %s event for pod %s/%s after %d attempts: %w",
+				event.Event, event.Pod.Namespace, event.Pod.Name, attempt, err)
+		}
+		klog.V(2).Infof("Webhook %s event for pod %s/%s failed, retrying: %v", event.Event, event.Pod.Namespace, event.Pod.Name, err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(w.retryDelay):
+		}
+	}
+}
+
+func (w *webhook) post(ctx context.Context, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if w.token != "" {
+		req.Header.Set("Authorization", "Bearer "+w.token)
+	}
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+// notifyDeviceEvent sends the event to the webhook if configured. Unless the
+// webhook is blocking the notification runs in the background and its errors
+// are only logged.
+func (k *NetworkDriver) notifyDeviceEvent(ctx context.Context, event DeviceEvent) error {
+	if k.webhook == nil || len(event.Devices) == 0 {
+		return nil
+	}
+	if k.webhook.blocking {
+		return k.webhook.notify(ctx, event)
+	}
+	go func() {
+		if err := k.webhook.notify(context.Background(), event); err != nil {
+			klog.Errorf("webhook notification failed: %v", err)
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/containerd/nri/pkg/api"
+)
+
+func Test_webhookNotify(t *testing.T) {
+	var received []DeviceEvent
+	failures := 1
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("Authorization"); got != "Bearer secret" {
+			t.Errorf("unexpected Authorization header %q", got)
+		}
+		if failures > 0 {
+			failures--
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var event DeviceEvent
+		if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+			t.Errorf("failed to decode event: %v", err)
+		}
+		received = append(received, event)
+	}))
+	defer server.Close()
+
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte("secret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	w, err := newWebhook(server.URL, tokenFile, time.Second, true)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	w.retryDelay = 0
+
+	pod := &api.PodSandbox{Namespace: "default", Name: "pod", Uid: "pod-uid", Ips: []string{"10.0.0.2"}}
+	devices := []AllocatedDevice{{Name: "eth1", PoolName: "node1", Request: "nic", Attributes: map[string]string{"mac-address": "aa:bb:cc:dd:ee:ff"}}}
+	event := newDeviceEvent(DeviceEventAttach, "node1", pod, "/var/run/netns/test", devices)
+	if err := w.notify(context.Background(), event); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := DeviceEvent{
+		Event: DeviceEventAttach,
+		Node:  "node1",
+		Pod:   EventPod{Namespace: "default", Name: "pod", UID: "pod-uid", NetworkNamespace: "/var/run/netns/test", IPs: []string{"10.0.0.2"}},
+		Devices: []EventDevice{
+			{Name: "eth1", PoolName: "node1", Request: "nic", Attributes: map[string]string{"mac-address": "aa:bb:cc:dd:ee:ff"}},
+		},
+	}
+	if len(received) != 1 || !reflect.DeepEqual(received[0], want) {
+		t.Errorf("expected event %+v, got %+v", want, received)
+	}
+
+	failures = webhookAttempts
+	if err := w.notify(context.Background(), event); err == nil {
+		t.Errorf("expected error after %d failed attempts", webhookAttempts)
+	}
+}
+
+func Test_newWebhook(t *testing.T) {
+	if _, err := newWebhook("ftp://example.com", "", time.Second, false); err == nil {
+		t.Errorf("expected error for non http url")
+	}
+	if _, err := newWebhook("https://example.com", "/nonexistent/token", time.Second, false); err == nil {
+		t.Errorf("expected error for missing token file")
+	}
+}
@@ -0,0 +1,175 @@
+package net
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+
+	"github.com/vishvananda/netlink"
+)
+
+// WithBondMode sets the mode of the bond created by NsAttachBond, 802.3ad
+// by default.
+func WithBondMode(mode netlink.BondMode) AttachOption {
+	return func(o *attachOptions) {
+		o.bondMode = &mode
+	}
+}
+
+// NsAttachBond moves the host interfaces members into the namespace
+// containerNsPath, like NsAttachNetdev, creates there a bond with the
+// attributes and mode of bondAttr and enslaves them to it. The addresses are
+// set on the bond, which takes the MTU of the first member if bondAttr has
+// none. The bond is brought up unless WithLinkDown is set, the members come
+// up with it. On failure the bond is deleted and the members moved so far
+// are returned to the host.
+func NsAttachBond(containerNsPath string, members []string, bondAttr netlink.LinkAttrs, addresses []*net.IPNet, opts ...AttachOption) (err error) {
+	options := attachOptions{linkUpRetries: DefaultLinkUpRetries, namespaceRetries: DefaultNamespaceRetries}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	if len(members) == 0 {
+		return fmt.Errorf("bond %s has no members", bondAttr.Name)
+	}
+	mode := netlink.BOND_MODE_802_3AD
+	if options.bondMode != nil {
+		mode = *options.bondMode
+	}
+
+	var moved []string
+	defer func() {
+		if err == nil || len(moved) == 0 {
+			return
+		}
+		if cleanupErr := NsDetachBond(containerNsPath, bondAttr.Name, moved); cleanupErr != nil {
+			err = errors.Join(err, fmt.Errorf("failed to return the members of bond %s to the host: %w", bondAttr.Name, cleanupErr))
+		}
+	}()
+	// the members can only be enslaved while down, the bond opens them
+	memberOpts := append(slices.Clone(opts), WithLinkDown())
+	for _, member := range members {
+		if _, err := NsAttachNetdev(member, containerNsPath, netlink.LinkAttrs{Name: member}, nil, memberOpts...); err != nil {
+			return fmt.Errorf("failed to move member %s of bond %s: %w", member, bondAttr.Name, err)
+		}
+		moved = append(moved, member)
+	}
+
+	containerNs, err := getNsFromPath(containerNsPath)
+	if err != nil {
+		return fmt.Errorf("could not get network namespace from path %s for bond %s : %w", containerNsPath, bondAttr.Name, err)
+	}
+	defer closeNs(containerNs)
+
+	nhNs, err := newHandleAt(containerNs)
+	if err != nil {
+		return fmt.Errorf("could not get network namespace handle: %w", err)
+	}
+	defer closeHandle(nhNs)
+
+	memberLinks := make([]netlink.Link, 0, len(members))
+	for _, member := range members {
+		link, err := nhNs.LinkByName(member)
+		if err != nil && !errors.Is(err, netlink.ErrDumpInterrupted) {
+			return fmt.Errorf("link not found for interface %s on namespace %s: %w", member, containerNsPath, err)
+		}
+		memberLinks = append(memberLinks, link)
+	}
+
+	// the members take the MTU of the bond when enslaved
+	if bondAttr.MTU == 0 {
+		bondAttr.MTU = memberLinks[0].Attrs().MTU
+	}
+	bond := netlink.NewLinkBond(bondAttr)
+	bond.Mode = mode
+	if err := nhNs.LinkAdd(bond); err != nil {
+		return fmt.Errorf("failed to create bond %s on namespace %s: %w", bondAttr.Name, containerNsPath, netlinkError(err))
+	}
+	bondLink, err := nhNs.LinkByName(bondAttr.Name)
+	if err != nil && !errors.Is(err, netlink.ErrDumpInterrupted) {
+		return fmt.Errorf("link not found for bond %s on namespace %s: %w", bondAttr.Name, containerNsPath, err)
+	}
+	for _, link := range memberLinks {
+		if err := nhNs.LinkSetMaster(link, bondLink); err != nil {
+			return fmt.Errorf("failed to enslave %s to bond %s on namespace %s: %w", link.Attrs().Name, bondAttr.Name, containerNsPath, netlinkError(err))
+		}
+	}
+
+	for _, ipnet := range addresses {
+		if err := nhNs.AddrAdd(bondLink, &netlink.Addr{IPNet: &net.IPNet{IP: ipnet.IP, Mask: ipnet.Mask}}); err != nil {
+			return fmt.Errorf("fail to set up address %s on namespace %s: %w", ipnet.IP.String(), containerNsPath, netlinkError(err))
+		}
+	}
+
+	if options.linkDown {
+		return nil
+	}
+	err = retryTransient(options.linkUpRetries, linkUpBackoff, func() error {
+		return nhNs.LinkSetUp(bondLink)
+	})
+	if err != nil {
+		return fmt.Errorf("fail to set up bond %s on namespace %s: %w", bondAttr.Name, containerNsPath, netlinkError(err))
+	}
+	if options.dadTimeout > 0 {
+		if err := waitDAD(containerNsPath, nhNs, bondLink, options.dadTimeout); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// NsDetachBond releases the members from the bond bondName in the namespace
+// containerNsPath, so the kernel gives them back their MTU and hardware
+// address, deletes the bond and returns the members to the host like
+// NsDetachNetdev. A member that fails does not stop the others. If the
+// namespace is gone the error wraps ErrNamespaceGone, the kernel already
+// deleted the bond and returned the members to the host namespace.
+func NsDetachBond(containerNsPath string, bondName string, members []string, opts ...DetachOption) error {
+	options := detachOptions{namespaceRetries: DefaultNamespaceRetries}
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	containerNs, err := openNamespace(containerNsPath, options.namespaceRetries)
+	if err != nil {
+		return fmt.Errorf("bond %s: %w", bondName, err)
+	}
+	defer closeNs(containerNs)
+
+	nhNs, err := newNamespaceHandle(containerNs, options.namespaceRetries)
+	if err != nil {
+		return err
+	}
+	defer closeHandle(nhNs)
+
+	var errs []error
+	for _, member := range members {
+		link, err := nhNs.LinkByName(member)
+		// a missing member fails below when it is returned
+		if err != nil || link.Attrs().MasterIndex == 0 {
+			continue
+		}
+		if err := nhNs.LinkSetNoMaster(link); err != nil {
+			errs = append(errs, fmt.Errorf("failed to release %s from bond %s: %w", member, bondName, netlinkError(err)))
+		}
+	}
+
+	bond, err := nhNs.LinkByName(bondName)
+	switch {
+	case err == nil:
+		if bond.Type() != "bond" {
+			errs = append(errs, fmt.Errorf("interface %s on namespace %s is not a bond", bondName, containerNsPath))
+		} else if err := nhNs.LinkDel(bond); err != nil {
+			errs = append(errs, fmt.Errorf("failed to delete bond %s on namespace %s: %w", bondName, containerNsPath, netlinkError(err)))
+		}
+	case !errors.As(err, &netlink.LinkNotFoundError{}):
+		errs = append(errs, fmt.Errorf("failed to get bond %s on namespace %s: %w", bondName, containerNsPath, err))
+	}
+
+	for _, member := range members {
+		if err := NsDetachNetdev(containerNsPath, member, member, opts...); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,70 @@
+package net
+
+import (
+	"net"
+	"testing"
+
+	"github.com/vishvananda/netlink"
+)
+
+func TestNsAttachBond(t *testing.T) {
+	if err := NsAttachBond("/proc/self/ns/net", nil, netlink.LinkAttrs{Name: "bond0"}, nil); err == nil {
+		t.Errorf("expected error for a bond without members")
+	}
+
+	nsPath, testNS := newTestNamespace(t)
+	members := []string{"testdummy-b0", "testdummy-b1"}
+	for _, member := range members {
+		newTestDummy(t, member)
+	}
+	_, addr, _ := net.ParseCIDR("192.168.7.0/24")
+	addr.IP = net.ParseIP("192.168.7.10")
+
+	if err := NsAttachBond(nsPath, members, netlink.LinkAttrs{Name: "bond0"}, []*net.IPNet{addr}, WithBondMode(netlink.BOND_MODE_ACTIVE_BACKUP)); err != nil {
+		t.Fatalf("fail to attach bond to namespace: %v", err)
+	}
+	nhNs, err := netlink.NewHandleAt(testNS)
+	if err != nil {
+		t.Fatalf("fail to open netlink handle: %v", err)
+	}
+	defer nhNs.Close()
+	bond, err := nhNs.LinkByName("bond0")
+	if err != nil {
+		t.Fatalf("bond not found in the namespace: %v", err)
+	}
+	if mode := bond.(*netlink.Bond).Mode; mode != netlink.BOND_MODE_ACTIVE_BACKUP {
+		t.Errorf("expected mode active-backup, got %s", mode)
+	}
+	for _, member := range members {
+		link, err := nhNs.LinkByName(member)
+		if err != nil {
+			t.Fatalf("member %s not found in the namespace: %v", member, err)
+		}
+		if link.Attrs().MasterIndex != bond.Attrs().Index {
+			t.Errorf("expected member %s enslaved to the bond", member)
+		}
+	}
+	info, err := NsLinkInfo(nsPath, "bond0")
+	if err != nil {
+		t.Fatalf("fail to get the bond of the namespace: %v", err)
+	}
+	if len(info.Addresses) != 1 || info.Addresses[0] != addr.String() {
+		t.Errorf("expected the address %s on the bond, got %v", addr, info.Addresses)
+	}
+
+	if err := NsDetachBond(nsPath, "bond0", members); err != nil {
+		t.Fatalf("fail to detach bond from namespace: %v", err)
+	}
+	if _, err := nhNs.LinkByName("bond0"); err == nil {
+		t.Errorf("expected the bond to be deleted")
+	}
+	for _, member := range members {
+		link, err := netlink.LinkByName(member)
+		if err != nil {
+			t.Fatalf("member %s not returned to the host: %v", member, err)
+		}
+		if link.Attrs().MasterIndex != 0 {
+			t.Errorf("expected member %s released from the bond", member)
+		}
+	}
+}
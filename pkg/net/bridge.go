@@ -0,0 +1,160 @@
+package net
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+)
+
+// NsAttachBridge moves the host interface uplink into the namespace
+// containerNsPath, like NsAttachNetdev, and enslaves it to the bridge
+// bridgeName there, created if it does not exist yet, so the pod can connect
+// its own interfaces to the network of the uplink. The addresses are set on
+// the bridge, the ones it already has are kept. The bridge and the uplink are
+// brought up unless WithLinkDown is set. On failure the bridge is deleted if
+// it has no other ports and the uplink is returned to the host.
+func NsAttachBridge(containerNsPath string, uplink string, bridgeName string, addresses []*net.IPNet, opts ...AttachOption) (err error) {
+	options := attachOptions{linkUpRetries: DefaultLinkUpRetries, namespaceRetries: DefaultNamespaceRetries}
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	// the uplink is brought up once it is a port of the bridge
+	uplinkOpts := append(slices.Clone(opts), WithLinkDown())
+	if _, err := NsAttachNetdev(uplink, containerNsPath, netlink.LinkAttrs{Name: uplink}, nil, uplinkOpts...); err != nil {
+		return err
+	}
+	defer func() {
+		if err == nil {
+			return
+		}
+		if cleanupErr := NsDetachBridge(containerNsPath, uplink, bridgeName); cleanupErr != nil {
+			err = errors.Join(err, fmt.Errorf("failed to return %s to the host: %w", uplink, cleanupErr))
+		}
+	}()
+
+	containerNs, err := getNsFromPath(containerNsPath)
+	if err != nil {
+		return fmt.Errorf("could not get network namespace from path %s for bridge %s : %w", containerNsPath, bridgeName, err)
+	}
+	defer closeNs(containerNs)
+
+	nhNs, err := newHandleAt(containerNs)
+	if err != nil {
+		return fmt.Errorf("could not get network namespace handle: %w", err)
+	}
+	defer closeHandle(nhNs)
+
+	uplinkLink, err := nhNs.LinkByName(uplink)
+	if err != nil && !errors.Is(err, netlink.ErrDumpInterrupted) {
+		return fmt.Errorf("link not found for interface %s on namespace %s: %w", uplink, containerNsPath, err)
+	}
+	bridge, err := nhNs.LinkByName(bridgeName)
+	if errors.As(err, &netlink.LinkNotFoundError{}) {
+		if err := nhNs.LinkAdd(&netlink.Bridge{LinkAttrs: netlink.LinkAttrs{Name: bridgeName}}); err != nil {
+			return fmt.Errorf("failed to create bridge %s on namespace %s: %w", bridgeName, containerNsPath, netlinkError(err))
+		}
+		bridge, err = nhNs.LinkByName(bridgeName)
+	}
+	if err != nil && !errors.Is(err, netlink.ErrDumpInterrupted) {
+		return fmt.Errorf("link not found for bridge %s on namespace %s: %w", bridgeName, containerNsPath, err)
+	}
+	if bridge.Type() != "bridge" {
+		return fmt.Errorf("interface %s on namespace %s is not a bridge", bridgeName, containerNsPath)
+	}
+	if err := nhNs.LinkSetMaster(uplinkLink, bridge); err != nil {
+		return fmt.Errorf("failed to add %s to bridge %s on namespace %s: %w", uplink, bridgeName, containerNsPath, netlinkError(err))
+	}
+
+	for _, ipnet := range addresses {
+		err := nhNs.AddrAdd(bridge, &netlink.Addr{IPNet: &net.IPNet{IP: ipnet.IP, Mask: ipnet.Mask}})
+		if err != nil && !errors.Is(err, unix.EEXIST) {
+			return fmt.Errorf("fail to set up address %s on namespace %s: %w", ipnet.IP.String(), containerNsPath, netlinkError(err))
+		}
+	}
+
+	if options.linkDown {
+		return nil
+	}
+	err = retryTransient(options.linkUpRetries, linkUpBackoff, func() error {
+		return nhNs.LinkSetUp(uplinkLink)
+	})
+	if err != nil {
+		return fmt.Errorf("failt to set up interface %s on namespace %s: %w", uplink, containerNsPath, netlinkError(err))
+	}
+	if err := nhNs.LinkSetUp(bridge); err != nil {
+		return fmt.Errorf("fail to set up bridge %s on namespace %s: %w", bridgeName, containerNsPath, netlinkError(err))
+	}
+	if options.dadTimeout > 0 {
+		if err := waitDAD(containerNsPath, nhNs, bridge, options.dadTimeout); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// NsDetachBridge removes the interface uplink from the bridge bridgeName in
+// the namespace containerNsPath and returns it to the host like
+// NsDetachNetdev. The bridge is deleted if it has no other ports, the
+// interfaces the pod connected to it keep it. If the namespace is gone the
+// error wraps ErrNamespaceGone, the kernel already deleted the bridge and
+// returned the uplink to the host namespace.
+func NsDetachBridge(containerNsPath string, uplink string, bridgeName string, opts ...DetachOption) error {
+	options := detachOptions{namespaceRetries: DefaultNamespaceRetries}
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	containerNs, err := openNamespace(containerNsPath, options.namespaceRetries)
+	if err != nil {
+		return fmt.Errorf("bridge %s: %w", bridgeName, err)
+	}
+	defer closeNs(containerNs)
+
+	nhNs, err := newNamespaceHandle(containerNs, options.namespaceRetries)
+	if err != nil {
+		return err
+	}
+	defer closeHandle(nhNs)
+
+	var errs []error
+	// a missing uplink fails below when it is returned
+	if link, err := nhNs.LinkByName(uplink); err == nil && link.Attrs().MasterIndex != 0 {
+		if err := nhNs.LinkSetNoMaster(link); err != nil {
+			errs = append(errs, fmt.Errorf("failed to remove %s from bridge %s: %w", uplink, bridgeName, netlinkError(err)))
+		}
+	}
+
+	bridge, err := nhNs.LinkByName(bridgeName)
+	switch {
+	case err == nil:
+		if bridge.Type() != "bridge" {
+			errs = append(errs, fmt.Errorf("interface %s on namespace %s is not a bridge", bridgeName, containerNsPath))
+			break
+		}
+		links, err := nhNs.LinkList()
+		if err != nil && !errors.Is(err, netlink.ErrDumpInterrupted) {
+			errs = append(errs, fmt.Errorf("could not list interfaces on namespace %s: %w", containerNsPath, err))
+			break
+		}
+		inUse := slices.ContainsFunc(links, func(link netlink.Link) bool {
+			return link.Attrs().MasterIndex == bridge.Attrs().Index
+		})
+		if !inUse {
+			if err := nhNs.LinkDel(bridge); err != nil {
+				errs = append(errs, fmt.Errorf("failed to delete bridge %s on namespace %s: %w", bridgeName, containerNsPath, netlinkError(err)))
+			}
+		}
+	case !errors.As(err, &netlink.LinkNotFoundError{}):
+		errs = append(errs, fmt.Errorf("failed to get bridge %s on namespace %s: %w", bridgeName, containerNsPath, err))
+	}
+
+	if err := NsDetachNetdev(containerNsPath, uplink, uplink, opts...); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
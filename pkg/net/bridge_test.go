@@ -0,0 +1,82 @@
+package net
+
+import (
+	"net"
+	"testing"
+
+	"github.com/vishvananda/netlink"
+)
+
+func TestNsAttachBridge(t *testing.T) {
+	nsPath, testNS := newTestNamespace(t)
+	uplink := "testdummy-br"
+	newTestDummy(t, uplink)
+	_, addr, _ := net.ParseCIDR("192.168.8.0/24")
+	addr.IP = net.ParseIP("192.168.8.10")
+
+	if err := NsAttachBridge(nsPath, uplink, "br0", []*net.IPNet{addr}); err != nil {
+		t.Fatalf("fail to attach bridge to namespace: %v", err)
+	}
+	nhNs, err := netlink.NewHandleAt(testNS)
+	if err != nil {
+		t.Fatalf("fail to open netlink handle: %v", err)
+	}
+	defer nhNs.Close()
+	bridge, err := nhNs.LinkByName("br0")
+	if err != nil {
+		t.Fatalf("bridge not found in the namespace: %v", err)
+	}
+	if bridge.Type() != "bridge" {
+		t.Errorf("expected a bridge, got %s", bridge.Type())
+	}
+	link, err := nhNs.LinkByName(uplink)
+	if err != nil {
+		t.Fatalf("uplink not found in the namespace: %v", err)
+	}
+	if link.Attrs().MasterIndex != bridge.Attrs().Index {
+		t.Errorf("expected uplink enslaved to the bridge")
+	}
+	info, err := NsLinkInfo(nsPath, "br0")
+	if err != nil {
+		t.Fatalf("fail to get the bridge of the namespace: %v", err)
+	}
+	if len(info.Addresses) != 1 || info.Addresses[0] != addr.String() {
+		t.Errorf("expected the address %s on the bridge, got %v", addr, info.Addresses)
+	}
+
+	// a port added by the pod keeps the bridge
+	veth := &netlink.Veth{LinkAttrs: netlink.LinkAttrs{Name: "testveth-br0", MasterIndex: bridge.Attrs().Index}, PeerName: "testveth-br1"}
+	if err := nhNs.LinkAdd(veth); err != nil {
+		t.Fatalf("fail to add veth to the bridge: %v", err)
+	}
+	if err := NsDetachBridge(nsPath, uplink, "br0"); err != nil {
+		t.Fatalf("fail to detach bridge from namespace: %v", err)
+	}
+	if _, err := nhNs.LinkByName("br0"); err != nil {
+		t.Errorf("expected the bridge with ports to be kept: %v", err)
+	}
+	link, err = netlink.LinkByName(uplink)
+	if err != nil {
+		t.Fatalf("uplink not returned to the host: %v", err)
+	}
+	if link.Attrs().MasterIndex != 0 {
+		t.Errorf("expected uplink released from the bridge")
+	}
+
+	// attaching again reuses the existing bridge
+	if err := NsAttachBridge(nsPath, uplink, "br0", []*net.IPNet{addr}); err != nil {
+		t.Fatalf("fail to attach to the existing bridge: %v", err)
+	}
+	if err := nhNs.LinkDel(veth); err != nil {
+		t.Fatalf("fail to delete veth: %v", err)
+	}
+	if err := NsDetachBridge(nsPath, uplink, "br0"); err != nil {
+		t.Fatalf("fail to detach bridge from namespace: %v", err)
+	}
+	if _, err := nhNs.LinkByName("br0"); err == nil {
+		t.Errorf("expected the bridge to be deleted")
+	}
+	if _, err := netlink.LinkByName(uplink); err != nil {
+		t.Errorf("uplink not returned to the host: %v", err)
+	}
+}
@@ -0,0 +1,286 @@
+package net
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+)
+
+// childAliasPrefix marks the virtual interfaces (vlan, macvlan, ipvlan)
+// created by the drivers on top of a host interface. The interface alias
+// is set to the prefix followed by the owner, usually the pod UID, so the
+// interfaces leaked by a crash can be identified and removed later.
+const childAliasPrefix = "knd-child:"
+
+const (
+	// MinVlanID and MaxVlanID are the 802.1Q VLAN ids of the interfaces,
+	// 0 and 4095 are reserved.
+	MinVlanID = 1
+	MaxVlanID = 4094
+)
+
+// ChildNetdev is a virtual interface created by the drivers.
+type ChildNetdev struct {
+	Name  string
+	Type  string
+	Owner string
+}
+
+// ChildAlias returns the interface alias that marks a child interface as
+// created by the drivers on behalf of owner.
+func ChildAlias(owner string) string {
+	return childAliasPrefix + owner
+}
+
+// childOwner returns the owner encoded in a child interface alias.
+func childOwner(alias string) (string, bool) {
+	owner, ok := strings.CutPrefix(alias, childAliasPrefix)
+	if !ok || owner == "" {
+		return "", false
+	}
+	return owner, true
+}
+
+// ListChildNetdevs returns the child interfaces created by the drivers
+// that are present in the host namespace.
+func ListChildNetdevs() ([]ChildNetdev, error) {
+	links, err := netlink.LinkList()
+	// recover same behavior on vishvananda/netlink@1.2.1 and do not fail when the kernel returns NLM_F_DUMP_INTR.
+	if err != nil && !errors.Is(err, netlink.ErrDumpInterrupted) {
+		return nil, fmt.Errorf("failed to list network interfaces: %w", err)
+	}
+
+	var children []ChildNetdev
+	for _, link := range links {
+		switch link.Type() {
+		case "vlan", "macvlan", "ipvlan":
+		default:
+			continue
+		}
+		owner, ok := childOwner(link.Attrs().Alias)
+		if !ok {
+			continue
+		}
+		children = append(children, ChildNetdev{Name: link.Attrs().Name, Type: link.Type(), Owner: owner})
+	}
+	return children, nil
+}
+
+// DeleteChildNetdev deletes a child interface from the host namespace.
+func DeleteChildNetdev(name string) error {
+	link, err := netlink.LinkByName(name)
+	if err != nil && !errors.Is(err, netlink.ErrDumpInterrupted) {
+		return fmt.Errorf("link not found for interface %s: %w", name, err)
+	}
+	if _, ok := childOwner(link.Attrs().Alias); !ok {
+		return fmt.Errorf("interface %s was not created by the driver", name)
+	}
+	if err := netlink.LinkDel(link); err != nil {
+		return fmt.Errorf("failed to delete interface %s: %w", name, netlinkError(err))
+	}
+	return nil
+}
+
+// CanHostChild returns an error if the host interface ifName cannot be the
+// parent of a child interface of type childType, vlan, macvlan or ipvlan. The
+// kernel rejects them on interfaces enslaved to a bond, a bridge or a VRF,
+// on non ethernet interfaces, and ipvlan interfaces cannot be stacked.
+func CanHostChild(ifName string, childType string) error {
+	switch childType {
+	case "vlan", "macvlan", "ipvlan":
+	default:
+		return fmt.Errorf("unsupported child interface type %q", childType)
+	}
+	link, err := netlink.LinkByName(ifName)
+	if err != nil && !errors.Is(err, netlink.ErrDumpInterrupted) {
+		return fmt.Errorf("link not found for interface %s: %w", ifName, err)
+	}
+	return canHostChild(link, childType)
+}
+
+// SupportsMacvlan returns true if the host interface link can be the parent
+// of a macvlan interface.
+func SupportsMacvlan(link netlink.Link) bool {
+	return canHostChild(link, "macvlan") == nil
+}
+
+// SupportsIPVlan returns true if the host interface link can be the parent
+// of an ipvlan interface.
+func SupportsIPVlan(link netlink.Link) bool {
+	return canHostChild(link, "ipvlan") == nil
+}
+
+func canHostChild(link netlink.Link, childType string) error {
+	attrs := link.Attrs()
+	if attrs.MasterIndex != 0 {
+		return fmt.Errorf("interface %s is enslaved to another interface and cannot host a %s", attrs.Name, childType)
+	}
+	if attrs.EncapType == "loopback" {
+		return fmt.Errorf("interface %s is a loopback and cannot host a %s", attrs.Name, childType)
+	}
+	if attrs.EncapType != "" && attrs.EncapType != "ether" {
+		return fmt.Errorf("interface %s is not an ethernet interface and cannot host a %s", attrs.Name, childType)
+	}
+	if childType == "ipvlan" && link.Type() == "ipvlan" {
+		return fmt.Errorf("interface %s is an ipvlan and cannot host another ipvlan", attrs.Name)
+	}
+	return nil
+}
+
+// NsAttachChildNetdev creates a child interface of type childType, macvlan
+// or ipvlan, on top of the host interface parentIfName directly in the
+// namespace containerNsPath with the name ifName. The interface is marked
+// with the owner so it can be identified if it leaks. It is left down.
+func NsAttachChildNetdev(parentIfName string, childType string, containerNsPath string, ifName string, owner string) error {
+	attrs := netlink.NewLinkAttrs()
+	attrs.Name = ifName
+	attrs.Alias = ChildAlias(owner)
+	switch childType {
+	case "macvlan":
+		return NsAttachMacvlan(parentIfName, containerNsPath, attrs, nil)
+	case "ipvlan":
+		return NsAttachIpvlan(parentIfName, containerNsPath, netlink.IPVLAN_MODE_L2, attrs, nil)
+	}
+	return fmt.Errorf("unsupported child interface type %q", childType)
+}
+
+// NsAttachMacvlan creates a macvlan interface in bridge mode on top of the
+// host interface parent directly in the namespace containerNsPath, so the
+// parent stays in the host namespace. The interface is created with the
+// name, address, MTU and alias of attr and the addresses are set on it.
+// Its alias must be a ChildAlias for NsDeleteChildNetdev to delete it. It is
+// left down, and deleted if the addresses cannot be set.
+func NsAttachMacvlan(parent, containerNsPath string, attr netlink.LinkAttrs, addresses []*net.IPNet) error {
+	return nsAttachChild(parent, containerNsPath, &netlink.Macvlan{LinkAttrs: attr, Mode: netlink.MACVLAN_MODE_BRIDGE}, addresses)
+}
+
+// NsAttachIpvlan creates an ipvlan interface in the given mode, l2, l3 or
+// l3s, on top of the host interface parent directly in the namespace
+// containerNsPath, like NsAttachMacvlan. The ipvlan shares the MAC address
+// of the parent.
+func NsAttachIpvlan(parent, containerNsPath string, mode netlink.IPVlanMode, attr netlink.LinkAttrs, addresses []*net.IPNet) error {
+	return nsAttachChild(parent, containerNsPath, &netlink.IPVlan{LinkAttrs: attr, Mode: mode}, addresses)
+}
+
+// NsAttachVlan creates an 802.1Q VLAN interface with the id vlanID on top of
+// the host interface parent directly in the namespace containerNsPath, like
+// NsAttachMacvlan. It is named <parent>.<vlanID> if attr has no name. A VLAN
+// interface with the same id already on the parent is never replaced nor
+// moved, the attach fails instead.
+func NsAttachVlan(parent string, vlanID int, containerNsPath string, attr netlink.LinkAttrs, addresses []*net.IPNet) error {
+	if vlanID < MinVlanID || vlanID > MaxVlanID {
+		return fmt.Errorf("invalid vlan %d, must be between %d and %d", vlanID, MinVlanID, MaxVlanID)
+	}
+	if attr.Name == "" {
+		attr.Name = fmt.Sprintf("%s.%d", parent, vlanID)
+	}
+	if len(attr.Name) >= unix.IFNAMSIZ {
+		return fmt.Errorf("invalid interface name %s for vlan %d on interface %s, must be shorter than %d characters", attr.Name, vlanID, parent, unix.IFNAMSIZ)
+	}
+	parentLink, err := netlink.LinkByName(parent)
+	if err != nil && !errors.Is(err, netlink.ErrDumpInterrupted) {
+		return fmt.Errorf("link not found for interface %s: %w", parent, err)
+	}
+	links, err := netlink.LinkList()
+	if err != nil && !errors.Is(err, netlink.ErrDumpInterrupted) {
+		return fmt.Errorf("failed to list network interfaces: %w", err)
+	}
+	if existing := findVlan(links, parentLink.Attrs().Index, vlanID); existing != "" {
+		return fmt.Errorf("interface %s already has vlan %d on interface %s", parent, vlanID, existing)
+	}
+	return nsAttachChild(parent, containerNsPath, &netlink.Vlan{LinkAttrs: attr, VlanId: vlanID}, addresses)
+}
+
+// findVlan returns the name of the VLAN interface with the id vlanID on top
+// of the interface with index parentIndex, empty if there is none.
+func findVlan(links []netlink.Link, parentIndex int, vlanID int) string {
+	for _, link := range links {
+		vlan, ok := link.(*netlink.Vlan)
+		if ok && vlan.ParentIndex == parentIndex && vlan.VlanId == vlanID {
+			return vlan.Name
+		}
+	}
+	return ""
+}
+
+// nsAttachChild creates the child interface on top of the host interface
+// parent in the namespace containerNsPath and sets the addresses on it.
+func nsAttachChild(parent, containerNsPath string, child netlink.Link, addresses []*net.IPNet) error {
+	childType := child.Type()
+	attr := child.Attrs()
+	if err := CanHostChild(parent, childType); err != nil {
+		return err
+	}
+	parentLink, err := netlink.LinkByName(parent)
+	if err != nil && !errors.Is(err, netlink.ErrDumpInterrupted) {
+		return fmt.Errorf("link not found for interface %s: %w", parent, err)
+	}
+	containerNs, err := getNsFromPath(containerNsPath)
+	if err != nil {
+		return fmt.Errorf("could not get network namespace from path %s for network device %s : %w", containerNsPath, attr.Name, err)
+	}
+	defer closeNs(containerNs)
+
+	attr.ParentIndex = parentLink.Attrs().Index
+	attr.Namespace = netlink.NsFd(int(containerNs))
+	if err := netlink.LinkAdd(child); err != nil {
+		return fmt.Errorf("failed to create %s %s on interface %s: %w", childType, attr.Name, parent, netlinkError(err))
+	}
+	if len(addresses) == 0 {
+		return nil
+	}
+
+	nhNs, err := newHandleAt(containerNs)
+	if err != nil {
+		return fmt.Errorf("could not get network namespace handle: %w", err)
+	}
+	defer closeHandle(nhNs)
+
+	nsLink, err := nhNs.LinkByName(attr.Name)
+	if err != nil && !errors.Is(err, netlink.ErrDumpInterrupted) {
+		return fmt.Errorf("link not found for interface %s on namespace %s: %w", attr.Name, containerNsPath, err)
+	}
+	for _, ipnet := range addresses {
+		if err := nhNs.AddrAdd(nsLink, &netlink.Addr{IPNet: &net.IPNet{IP: ipnet.IP, Mask: ipnet.Mask}}); err != nil {
+			err = fmt.Errorf("fail to set up address %s on namespace %s: %w", ipnet.IP.String(), containerNsPath, netlinkError(err))
+			if delErr := nhNs.LinkDel(nsLink); delErr != nil {
+				return errors.Join(err, fmt.Errorf("failed to delete interface %s on namespace %s: %w", attr.Name, containerNsPath, netlinkError(delErr)))
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// NsDeleteChildNetdev deletes the child interface ifName created by
+// NsAttachChildNetdev from the namespace containerNsPath. If the namespace is
+// gone the error wraps ErrNamespaceGone, the kernel already deleted the child.
+func NsDeleteChildNetdev(containerNsPath string, ifName string) error {
+	containerNs, err := openNamespace(containerNsPath, 0)
+	if err != nil {
+		return fmt.Errorf("network device %s: %w", ifName, err)
+	}
+	defer closeNs(containerNs)
+
+	nhNs, err := newHandleAt(containerNs)
+	if err != nil {
+		return fmt.Errorf("could not get network namespace handle: %w", err)
+	}
+	defer closeHandle(nhNs)
+
+	link, err := nhNs.LinkByName(ifName)
+	if err != nil && !errors.Is(err, netlink.ErrDumpInterrupted) {
+		return fmt.Errorf("link not found for interface %s on namespace %s: %w", ifName, containerNsPath, err)
+	}
+	if _, ok := childOwner(link.Attrs().Alias); !ok {
+		return fmt.Errorf("interface %s was not created by the driver", ifName)
+	}
+	if err := nhNs.LinkDel(link); err != nil {
+		return fmt.Errorf("failed to delete interface %s on namespace %s: %w", ifName, containerNsPath, netlinkError(err))
+	}
+	return nil
+}
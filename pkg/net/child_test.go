@@ -0,0 +1,108 @@
+package net
+
+import (
+	"testing"
+
+	"github.com/vishvananda/netlink"
+)
+
+func Test_childOwner(t *testing.T) {
+	tests := []struct {
+		alias string
+		owner string
+		ok    bool
+	}{
+		{alias: ChildAlias("6f1a2b"), owner: "6f1a2b", ok: true},
+		{alias: "knd-child:", ok: false},
+		{alias: "eth0", ok: false},
+		{alias: "", ok: false},
+	}
+	for _, tt := range tests {
+		owner, ok := childOwner(tt.alias)
+		if owner != tt.owner || ok != tt.ok {
+			t.Errorf("childOwner(%q) = %q, %v, want %q, %v", tt.alias, owner, ok, tt.owner, tt.ok)
+		}
+	}
+}
+
+func TestCanHostChild(t *testing.T) {
+	if err := CanHostChild("lo", "veth"); err == nil {
+		t.Errorf("expected error for unsupported child type")
+	}
+	if err := CanHostChild("knd-missing0", "macvlan"); err == nil {
+		t.Errorf("expected error for missing interface")
+	}
+	if err := CanHostChild("lo", "ipvlan"); err == nil {
+		t.Errorf("expected error for loopback interface")
+	}
+}
+
+func TestNsAttachMacvlan(t *testing.T) {
+	attrs := netlink.LinkAttrs{Name: "net1", Alias: ChildAlias("6f1a2b")}
+	if err := NsAttachMacvlan("knd-missing0", "/proc/self/ns/net", attrs, nil); err == nil {
+		t.Errorf("expected error for missing parent interface")
+	}
+	if err := NsAttachMacvlan("lo", "/proc/self/ns/net", attrs, nil); err == nil {
+		t.Errorf("expected error for loopback parent interface")
+	}
+}
+
+func TestSupportsIPVlan(t *testing.T) {
+	tests := []struct {
+		name string
+		link netlink.Link
+		want bool
+	}{
+		{name: "ethernet", link: &netlink.Device{LinkAttrs: netlink.LinkAttrs{Name: "eth0", EncapType: "ether"}}, want: true},
+		{name: "bond", link: &netlink.Bond{LinkAttrs: netlink.LinkAttrs{Name: "bond0", EncapType: "ether"}}, want: true},
+		{name: "bond member", link: &netlink.Device{LinkAttrs: netlink.LinkAttrs{Name: "eth1", EncapType: "ether", MasterIndex: 5}}},
+		{name: "infiniband", link: &netlink.Device{LinkAttrs: netlink.LinkAttrs{Name: "ib0", EncapType: "infiniband"}}},
+		{name: "loopback", link: &netlink.Device{LinkAttrs: netlink.LinkAttrs{Name: "lo", EncapType: "loopback"}}},
+		{name: "ipvlan", link: &netlink.IPVlan{LinkAttrs: netlink.LinkAttrs{Name: "ipvl0", EncapType: "ether"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := SupportsIPVlan(tt.link); got != tt.want {
+				t.Errorf("SupportsIPVlan(%s) = %v, want %v", tt.link.Attrs().Name, got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_findVlan(t *testing.T) {
+	links := []netlink.Link{
+		&netlink.Device{LinkAttrs: netlink.LinkAttrs{Index: 2, Name: "eth0"}},
+		&netlink.Vlan{LinkAttrs: netlink.LinkAttrs{Index: 3, Name: "eth0.100", ParentIndex: 2}, VlanId: 100},
+		&netlink.Vlan{LinkAttrs: netlink.LinkAttrs{Index: 4, Name: "tenant", ParentIndex: 2}, VlanId: 200},
+		&netlink.Vlan{LinkAttrs: netlink.LinkAttrs{Index: 5, Name: "eth1.300", ParentIndex: 6}, VlanId: 300},
+	}
+	tests := []struct {
+		parentIndex int
+		vlanID      int
+		want        string
+	}{
+		{parentIndex: 2, vlanID: 100, want: "eth0.100"},
+		{parentIndex: 2, vlanID: 200, want: "tenant"},
+		{parentIndex: 2, vlanID: 300},
+		{parentIndex: 6, vlanID: 100},
+	}
+	for _, tt := range tests {
+		if got := findVlan(links, tt.parentIndex, tt.vlanID); got != tt.want {
+			t.Errorf("findVlan(%d, %d) = %q, want %q", tt.parentIndex, tt.vlanID, got, tt.want)
+		}
+	}
+}
+
+func TestNsAttachVlan(t *testing.T) {
+	for _, vlanID := range []int{0, 4095} {
+		if err := NsAttachVlan("knd-missing0", vlanID, "/proc/self/ns/net", netlink.LinkAttrs{}, nil); err == nil {
+			t.Errorf("expected error for vlan %d", vlanID)
+		}
+	}
+	if err := NsAttachVlan("knd-missing0", 100, "/proc/self/ns/net", netlink.LinkAttrs{}, nil); err == nil {
+		t.Errorf("expected error for an interface name too long")
+	}
+	if err := NsAttachVlan("knd-missing0", 100, "/proc/self/ns/net", netlink.LinkAttrs{Name: "net1"}, nil); err == nil {
+		t.Errorf("expected error for missing parent interface")
+	}
+}
@@ -0,0 +1,131 @@
+package net
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+)
+
+// dadPollInterval is the wait between the checks of the tentative addresses.
+const dadPollInterval = 100 * time.Millisecond
+
+// ErrAddressTentative is returned when the IPv6 addresses of an interface
+// are still tentative, the duplicate address detection not completed, after
+// the timeout.
+var ErrAddressTentative = errors.New("ipv6 addresses still tentative")
+
+// ErrDuplicateAddress is returned when the duplicate address detection finds
+// an IPv6 address of the interface in use on the network.
+var ErrDuplicateAddress = errors.New("duplicate ipv6 address")
+
+// WithDADTimeout waits, after bringing up the device, up to timeout for its
+// IPv6 addresses to complete the duplicate address detection, so they can be
+// used as source right away. It returns ErrAddressTentative if they are still
+// tentative after the timeout. The wait is skipped when accept_dad is disabled
+// on the interface. 0, the default, does not wait.
+func WithDADTimeout(timeout time.Duration) AttachOption {
+	return func(o *attachOptions) {
+		o.dadTimeout = timeout
+	}
+}
+
+// NsWaitDAD waits up to timeout for the IPv6 addresses of the interface
+// ifName in the namespace containerNsPath to leave the tentative state, for
+// the interfaces brought up later than the attachment. It behaves as
+// WithDADTimeout.
+func NsWaitDAD(containerNsPath string, ifName string, timeout time.Duration) error {
+	if timeout <= 0 {
+		return nil
+	}
+	containerNs, err := getNsFromPath(containerNsPath)
+	if err != nil {
+		return fmt.Errorf("could not get network namespace from path %s for network device %s : %w", containerNsPath, ifName, err)
+	}
+	defer closeNs(containerNs)
+
+	nhNs, err := newHandleAt(containerNs)
+	if err != nil {
+		return fmt.Errorf("could not get network namespace handle: %w", err)
+	}
+	defer closeHandle(nhNs)
+
+	nsLink, err := nhNs.LinkByName(ifName)
+	if err != nil && !errors.Is(err, netlink.ErrDumpInterrupted) {
+		return fmt.Errorf("link not found for interface %s on namespace %s: %w", ifName, containerNsPath, err)
+	}
+	return waitDAD(containerNsPath, nhNs, nsLink, timeout)
+}
+
+// waitDAD polls the IPv6 addresses of the link, with the handle of its
+// namespace containerNsPath, until none is tentative.
+func waitDAD(containerNsPath string, nhNs *netlink.Handle, link netlink.Link, timeout time.Duration) error {
+	ifName := link.Attrs().Name
+	enabled, err := acceptDAD(containerNsPath, ifName)
+	if err != nil {
+		return err
+	}
+	if !enabled {
+		return nil
+	}
+	deadline := time.Now().Add(timeout)
+	for {
+		addrs, err := nhNs.AddrList(link, netlink.FAMILY_V6)
+		if err != nil && !errors.Is(err, netlink.ErrDumpInterrupted) {
+			return fmt.Errorf("fail to list addresses on interface %s: %w", ifName, err)
+		}
+		tentative, err := tentativeAddresses(addrs)
+		if err != nil {
+			return fmt.Errorf("interface %s on namespace %s: %w", ifName, containerNsPath, err)
+		}
+		if len(tentative) == 0 {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("%w after %s: %s on interface %s on namespace %s", ErrAddressTentative, timeout, strings.Join(tentative, ", "), ifName, containerNsPath)
+		}
+		time.Sleep(dadPollInterval)
+	}
+}
+
+// tentativeAddresses returns the global addresses still running the duplicate
+// address detection, the link-local addresses are not used as source of the
+// routed traffic. It returns ErrDuplicateAddress if the detection failed.
+func tentativeAddresses(addrs []netlink.Addr) ([]string, error) {
+	var tentative []string
+	for _, addr := range addrs {
+		if addr.IPNet == nil || addr.IP.IsLinkLocalUnicast() {
+			continue
+		}
+		if addr.Flags&unix.IFA_F_DADFAILED != 0 {
+			return nil, fmt.Errorf("%w: %s", ErrDuplicateAddress, addr.IPNet)
+		}
+		if addr.Flags&unix.IFA_F_TENTATIVE != 0 {
+			tentative = append(tentative, addr.IPNet.String())
+		}
+	}
+	return tentative, nil
+}
+
+// acceptDAD returns whether the duplicate address detection runs on the
+// interface ifName in the namespace containerNsPath, it does not without
+// IPv6 or with accept_dad set to 0.
+func acceptDAD(containerNsPath string, ifName string) (bool, error) {
+	enabled := false
+	err := inNamespace(containerNsPath, func() error {
+		value, err := os.ReadFile(ipv6ConfSysctl(ifName, "accept_dad"))
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read accept_dad of interface %s: %w", ifName, err)
+		}
+		enabled = strings.TrimSpace(string(value)) != "0"
+		return nil
+	})
+	return enabled, err
+}
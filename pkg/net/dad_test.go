@@ -0,0 +1,53 @@
+package net
+
+import (
+	"errors"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+)
+
+func Test_tentativeAddresses(t *testing.T) {
+	addr := func(cidr string, flags int) netlink.Addr {
+		ip, ipnet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ipnet.IP = ip
+		return netlink.Addr{IPNet: ipnet, Flags: flags}
+	}
+	tests := []struct {
+		name    string
+		addrs   []netlink.Addr
+		want    []string
+		wantErr error
+	}{
+		{name: "no addresses"},
+		{name: "ready", addrs: []netlink.Addr{addr("2001:db8::1/64", unix.IFA_F_PERMANENT)}},
+		{
+			name:  "tentative",
+			addrs: []netlink.Addr{addr("2001:db8::1/64", unix.IFA_F_TENTATIVE), addr("2001:db8::2/64", 0)},
+			want:  []string{"2001:db8::1/64"},
+		},
+		{name: "link-local tentative", addrs: []netlink.Addr{addr("fe80::1/64", unix.IFA_F_TENTATIVE)}},
+		{
+			name:    "duplicate",
+			addrs:   []netlink.Addr{addr("2001:db8::1/64", unix.IFA_F_TENTATIVE|unix.IFA_F_DADFAILED)},
+			wantErr: ErrDuplicateAddress,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tentativeAddresses(tt.addrs)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expected tentative %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
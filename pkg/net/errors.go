@@ -0,0 +1,84 @@
+package net
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// errnoHints explain the errors commonly returned by the kernel on netlink
+// operations in terms of the device configuration.
+var errnoHints = map[unix.Errno]string{
+	unix.EADDRNOTAVAIL: "address not on interface",
+	unix.EADDRINUSE:    "address already in use",
+	unix.EBUSY:         "device is busy, it may be in use or enslaved",
+	unix.EEXIST:        "object already exists",
+	unix.EINVAL:        "invalid argument, the kernel rejected the request attributes",
+	unix.ENETDOWN:      "interface is down",
+	unix.ENETUNREACH:   "network unreachable, the gateway is not reachable through the interface",
+	unix.ENODEV:        "no such device",
+	unix.ENOENT:        "object not found",
+	unix.ENOTSUP:       "operation not supported by the device driver",
+	unix.EPERM:         "operation not permitted, CAP_NET_ADMIN is required",
+	unix.ERANGE:        "value out of range",
+}
+
+// NetlinkError is a netlink failure with the decoded errno returned by the kernel.
+type NetlinkError struct {
+	Errno unix.Errno
+	Err   error
+}
+
+func (e *NetlinkError) Error() string {
+	name := unix.ErrnoName(e.Errno)
+	if name == "" {
+		name = fmt.Sprintf("errno %d", int(e.Errno))
+	}
+	if hint, ok := errnoHints[e.Errno]; ok {
+		return fmt.Sprintf("%v (%s: %s)", e.Err, name, hint)
+	}
+	return fmt.Sprintf("%v (%s)", e.Err, name)
+}
+
+func (e *NetlinkError) Unwrap() error {
+	return e.Err
+}
+
+// netlinkError decorates err with the name and a hint of its errno, errors
+// that do not come from the kernel are returned unmodified.
+func netlinkError(err error) error {
+	var errno unix.Errno
+	if err == nil || !errors.As(err, &errno) {
+		return err
+	}
+	var nlErr *NetlinkError
+	if errors.As(err, &nlErr) {
+		return err
+	}
+	return &NetlinkError{Errno: errno, Err: err}
+}
+
+// isTransient returns true for the errors that can succeed if the operation
+// is retried, like a device that is still busy after being moved.
+func isTransient(err error) bool {
+	return errors.Is(err, unix.EBUSY) ||
+		errors.Is(err, unix.EAGAIN) ||
+		errors.Is(err, unix.EINTR) ||
+		errors.Is(err, unix.ETIMEDOUT)
+}
+
+// retryTransient runs fn retrying up to retries times on transient errors,
+// with an exponential backoff starting at backoff. Permanent errors are
+// returned immediately.
+func retryTransient(retries int, backoff time.Duration, fn func() error) error {
+	for attempt := 0; ; attempt++ {
+		err := fn()
+		if err == nil || !isTransient(err) || attempt >= retries {
+			return err
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
@@ -0,0 +1,127 @@
+package net
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestNetlinkError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{
+			name: "address not available",
+			err:  unix.EADDRNOTAVAIL,
+			want: "cannot assign requested address (EADDRNOTAVAIL: address not on interface)",
+		},
+		{
+			name: "wrapped errno",
+			err:  fmt.Errorf("fail to add route: %w", unix.ENETUNREACH),
+			want: "fail to add route: network is unreachable (ENETUNREACH: network unreachable, the gateway is not reachable through the interface)",
+		},
+		{
+			name: "busy",
+			err:  unix.EBUSY,
+			want: "device or resource busy (EBUSY: device is busy, it may be in use or enslaved)",
+		},
+		{
+			name: "permission",
+			err:  unix.EPERM,
+			want: "operation not permitted (EPERM: operation not permitted, CAP_NET_ADMIN is required)",
+		},
+		{
+			name: "errno without hint",
+			err:  unix.EAGAIN,
+			want: "resource temporarily unavailable (EAGAIN)",
+		},
+		{
+			name: "not an errno",
+			err:  errors.New("link not found"),
+			want: "link not found",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := netlinkError(tt.err)
+			if got := err.Error(); got != tt.want {
+				t.Errorf("netlinkError() = %q, want %q", got, tt.want)
+			}
+			if !errors.Is(err, tt.err) {
+				t.Errorf("netlinkError() does not wrap %v", tt.err)
+			}
+			if got := netlinkError(err); got.Error() != tt.want {
+				t.Errorf("netlinkError() is not idempotent, got %q", got)
+			}
+		})
+	}
+	if netlinkError(nil) != nil {
+		t.Errorf("netlinkError(nil) must be nil")
+	}
+}
+
+func TestRetryTransient(t *testing.T) {
+	tests := []struct {
+		name      string
+		retries   int
+		errs      []error
+		wantCalls int
+		wantErr   error
+	}{
+		{
+			name:      "success",
+			retries:   3,
+			wantCalls: 1,
+		},
+		{
+			name:      "transient errors recover",
+			retries:   3,
+			errs:      []error{unix.EBUSY, unix.EAGAIN},
+			wantCalls: 3,
+		},
+		{
+			name:      "transient errors exhaust the retries",
+			retries:   2,
+			errs:      []error{unix.EBUSY, unix.EBUSY, unix.EBUSY, unix.EBUSY},
+			wantCalls: 3,
+			wantErr:   unix.EBUSY,
+		},
+		{
+			name:      "permanent error is not retried",
+			retries:   3,
+			errs:      []error{unix.EPERM},
+			wantCalls: 1,
+			wantErr:   unix.EPERM,
+		},
+		{
+			name:      "retries disabled",
+			retries:   0,
+			errs:      []error{unix.EBUSY},
+			wantCalls: 1,
+			wantErr:   unix.EBUSY,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			// inject the failures on the first calls
+			err := retryTransient(tt.retries, 0, func() error {
+				calls++
+				if calls <= len(tt.errs) {
+					return tt.errs[calls-1]
+				}
+				return nil
+			})
+			if !errors.Is(err, tt.wantErr) || (err == nil) != (tt.wantErr == nil) {
+				t.Errorf("retryTransient() error = %v, want %v", err, tt.wantErr)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("retryTransient() called %d times, want %d", calls, tt.wantCalls)
+			}
+		})
+	}
+}
@@ -0,0 +1,255 @@
+package net
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"syscall"
+
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netlink/nl"
+	"golang.org/x/sys/unix"
+)
+
+// nlaTypeMask strips the flags of the type of a netlink attribute.
+const nlaTypeMask = ^uint16(unix.NLA_F_NESTED | unix.NLA_F_NET_BYTEORDER)
+
+// EthtoolConfig are the offload features of an interface, as set by
+// ethtool -K, and the sizes of its rings, as set by ethtool -G.
+type EthtoolConfig struct {
+	// Features are enabled or disabled by their ethtool -k name, e.g.
+	// tx-checksum-ip-generic.
+	Features map[string]bool `json:"features,omitempty"`
+	// RxRing is the number of entries of the receive ring, kept if 0.
+	RxRing uint32 `json:"rxRing,omitempty"`
+	// TxRing is the number of entries of the transmit ring, kept if 0.
+	TxRing uint32 `json:"txRing,omitempty"`
+}
+
+// Validate checks the configuration sets something and the feature names are
+// well formed, the kernel rejects the unknown ones.
+func (c EthtoolConfig) Validate() error {
+	if len(c.Features) == 0 && c.RxRing == 0 && c.TxRing == 0 {
+		return fmt.Errorf("no features nor ring sizes")
+	}
+	for name := range c.Features {
+		if name == "" || strings.ContainsFunc(name, func(r rune) bool { return r <= ' ' || r > '~' }) {
+			return fmt.Errorf("invalid feature name %q", name)
+		}
+	}
+	return nil
+}
+
+// GetEthtool returns the current state, on the host interface ifName, of the
+// features and rings of the configuration, to restore them later.
+func GetEthtool(ifName string, config EthtoolConfig) (EthtoolConfig, error) {
+	family, err := ethtoolFamily()
+	if err != nil {
+		return EthtoolConfig{}, err
+	}
+	current := EthtoolConfig{}
+	if len(config.Features) > 0 {
+		req := ethtoolRequest(family, unix.ETHTOOL_MSG_FEATURES_GET)
+		req.AddData(ethtoolHeader(unix.ETHTOOL_A_FEATURES_HEADER, ifName))
+		attrs, err := executeEthtool(req)
+		if err != nil {
+			return EthtoolConfig{}, fmt.Errorf("failed to get the features of %s: %w", ifName, err)
+		}
+		active := map[string]bool{}
+		for _, attr := range attrs {
+			if attr.Attr.Type&nlaTypeMask == unix.ETHTOOL_A_FEATURES_ACTIVE {
+				if active, err = parseBitset(attr.Value); err != nil {
+					return EthtoolConfig{}, fmt.Errorf("failed to parse the features of %s: %w", ifName, err)
+				}
+			}
+		}
+		current.Features = map[string]bool{}
+		for name := range config.Features {
+			current.Features[name] = active[name]
+		}
+	}
+	if config.RxRing != 0 || config.TxRing != 0 {
+		req := ethtoolRequest(family, unix.ETHTOOL_MSG_RINGS_GET)
+		req.AddData(ethtoolHeader(unix.ETHTOOL_A_RINGS_HEADER, ifName))
+		attrs, err := executeEthtool(req)
+		if err != nil {
+			return EthtoolConfig{}, fmt.Errorf("failed to get the rings of %s: %w", ifName, err)
+		}
+		for _, attr := range attrs {
+			switch attr.Attr.Type & nlaTypeMask {
+			case unix.ETHTOOL_A_RINGS_RX:
+				if config.RxRing != 0 {
+					current.RxRing = nl.NativeEndian().Uint32(attr.Value)
+				}
+			case unix.ETHTOOL_A_RINGS_TX:
+				if config.TxRing != 0 {
+					current.TxRing = nl.NativeEndian().Uint32(attr.Value)
+				}
+			}
+		}
+	}
+	return current, nil
+}
+
+// NsSetEthtool applies the configuration to the interface ifName in the
+// namespace containerNsPath. It returns the features the kernel did not
+// change, e.g. because they are fixed on the device, the other failures,
+// like an unknown feature or a ring size above the maximum, are errors.
+func NsSetEthtool(containerNsPath string, ifName string, config EthtoolConfig) ([]string, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	var unchanged []string
+	err := inNamespace(containerNsPath, func() error {
+		var err error
+		unchanged, err = setEthtool(ifName, config)
+		return err
+	})
+	return unchanged, err
+}
+
+func setEthtool(ifName string, config EthtoolConfig) ([]string, error) {
+	family, err := ethtoolFamily()
+	if err != nil {
+		return nil, err
+	}
+	var unchanged []string
+	if len(config.Features) > 0 {
+		req := ethtoolRequest(family, unix.ETHTOOL_MSG_FEATURES_SET)
+		req.AddData(ethtoolHeader(unix.ETHTOOL_A_FEATURES_HEADER, ifName))
+		req.AddData(featuresBitset(unix.ETHTOOL_A_FEATURES_WANTED, config.Features))
+		attrs, err := executeEthtool(req)
+		if err != nil {
+			return nil, fmt.Errorf("failed to set the features of %s: %w", ifName, err)
+		}
+		// the wanted bitset of the reply are the requested features that
+		// differ from the result
+		for _, attr := range attrs {
+			if attr.Attr.Type&nlaTypeMask != unix.ETHTOOL_A_FEATURES_WANTED {
+				continue
+			}
+			bits, err := parseBitset(attr.Value)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse the features of %s: %w", ifName, err)
+			}
+			for name := range bits {
+				unchanged = append(unchanged, name)
+			}
+		}
+		slices.Sort(unchanged)
+	}
+	if config.RxRing != 0 || config.TxRing != 0 {
+		req := ethtoolRequest(family, unix.ETHTOOL_MSG_RINGS_SET)
+		req.AddData(ethtoolHeader(unix.ETHTOOL_A_RINGS_HEADER, ifName))
+		if config.RxRing != 0 {
+			req.AddData(nl.NewRtAttr(unix.ETHTOOL_A_RINGS_RX, nl.Uint32Attr(config.RxRing)))
+		}
+		if config.TxRing != 0 {
+			req.AddData(nl.NewRtAttr(unix.ETHTOOL_A_RINGS_TX, nl.Uint32Attr(config.TxRing)))
+		}
+		if _, err := executeEthtool(req); err != nil {
+			return unchanged, fmt.Errorf("failed to set the rings of %s to rx %d tx %d: %w", ifName, config.RxRing, config.TxRing, err)
+		}
+	}
+	return unchanged, nil
+}
+
+// ethtoolFamily resolves the ethtool generic netlink family, available since
+// Linux 5.6.
+func ethtoolFamily() (*netlink.GenlFamily, error) {
+	family, err := netlink.GenlFamilyGet(unix.ETHTOOL_GENL_NAME)
+	if err != nil {
+		return nil, fmt.Errorf("ethtool netlink is not available: %w", netlinkError(err))
+	}
+	return family, nil
+}
+
+func ethtoolRequest(family *netlink.GenlFamily, cmd uint8) *nl.NetlinkRequest {
+	req := nl.NewNetlinkRequest(int(family.ID), unix.NLM_F_ACK)
+	req.AddData(&nl.Genlmsg{Command: cmd, Version: unix.ETHTOOL_GENL_VERSION})
+	return req
+}
+
+// ethtoolHeader is the request header selecting the interface by name.
+func ethtoolHeader(attrType int, ifName string) *nl.RtAttr {
+	header := nl.NewRtAttr(attrType|unix.NLA_F_NESTED, nil)
+	header.AddRtAttr(unix.ETHTOOL_A_HEADER_DEV_NAME, nl.ZeroTerminated(ifName))
+	return header
+}
+
+// executeEthtool runs the request and returns the attributes of the reply.
+func executeEthtool(req *nl.NetlinkRequest) ([]syscall.NetlinkRouteAttr, error) {
+	msgs, err := req.Execute(unix.NETLINK_GENERIC, 0)
+	if err != nil {
+		return nil, netlinkError(err)
+	}
+	if len(msgs) == 0 {
+		return nil, nil
+	}
+	if len(msgs[0]) < nl.SizeofGenlmsg {
+		return nil, errors.New("short ethtool reply")
+	}
+	return nl.ParseRouteAttr(msgs[0][nl.SizeofGenlmsg:])
+}
+
+// featuresBitset encodes the features as a verbose bitset with a mask, so
+// only the listed features change.
+func featuresBitset(attrType int, features map[string]bool) *nl.RtAttr {
+	bitset := nl.NewRtAttr(attrType|unix.NLA_F_NESTED, nil)
+	bits := bitset.AddRtAttr(unix.ETHTOOL_A_BITSET_BITS|unix.NLA_F_NESTED, nil)
+	names := make([]string, 0, len(features))
+	for name := range features {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		bit := bits.AddRtAttr(unix.ETHTOOL_A_BITSET_BITS_BIT|unix.NLA_F_NESTED, nil)
+		bit.AddRtAttr(unix.ETHTOOL_A_BITSET_BIT_NAME, nl.ZeroTerminated(name))
+		if features[name] {
+			bit.AddRtAttr(unix.ETHTOOL_A_BITSET_BIT_VALUE, nil)
+		}
+	}
+	return bitset
+}
+
+// parseBitset decodes a verbose bitset into the value of its bits by name.
+// Without a mask the bitset lists only the bits that are set.
+func parseBitset(data []byte) (map[string]bool, error) {
+	attrs, err := nl.ParseRouteAttr(data)
+	if err != nil {
+		return nil, err
+	}
+	noMask := slices.ContainsFunc(attrs, func(attr syscall.NetlinkRouteAttr) bool {
+		return attr.Attr.Type&nlaTypeMask == unix.ETHTOOL_A_BITSET_NOMASK
+	})
+	result := map[string]bool{}
+	for _, attr := range attrs {
+		if attr.Attr.Type&nlaTypeMask != unix.ETHTOOL_A_BITSET_BITS {
+			continue
+		}
+		bits, err := nl.ParseRouteAttr(attr.Value)
+		if err != nil {
+			return nil, err
+		}
+		for _, bit := range bits {
+			fields, err := nl.ParseRouteAttr(bit.Value)
+			if err != nil {
+				return nil, err
+			}
+			name, value := "", noMask
+			for _, field := range fields {
+				switch field.Attr.Type & nlaTypeMask {
+				case unix.ETHTOOL_A_BITSET_BIT_NAME:
+					name = strings.TrimRight(string(field.Value), "\x00")
+				case unix.ETHTOOL_A_BITSET_BIT_VALUE:
+					value = true
+				}
+			}
+			if name != "" {
+				result[name] = value
+			}
+		}
+	}
+	return result, nil
+}
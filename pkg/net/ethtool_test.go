@@ -0,0 +1,64 @@
+package net
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/vishvananda/netlink/nl"
+	"golang.org/x/sys/unix"
+)
+
+func TestEthtoolConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  EthtoolConfig
+		wantErr bool
+	}{
+		{name: "features", config: EthtoolConfig{Features: map[string]bool{"tx-checksum-ip-generic": false}}},
+		{name: "rings", config: EthtoolConfig{RxRing: 4096}},
+		{name: "empty", config: EthtoolConfig{}, wantErr: true},
+		{name: "empty feature name", config: EthtoolConfig{Features: map[string]bool{"": true}}, wantErr: true},
+		{name: "feature name with spaces", config: EthtoolConfig{Features: map[string]bool{"tx checksumming": true}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.config.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("expected error %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+// bitsetValue returns the payload of the serialized bitset attribute.
+func bitsetValue(t *testing.T, attr *nl.RtAttr) []byte {
+	t.Helper()
+	attrs, err := nl.ParseRouteAttr(attr.Serialize())
+	if err != nil || len(attrs) != 1 {
+		t.Fatalf("invalid bitset %v: %v", attrs, err)
+	}
+	return attrs[0].Value
+}
+
+func Test_featuresBitset(t *testing.T) {
+	features := map[string]bool{"tx-checksum-ip-generic": false, "rx-gro-hw": true}
+	got, err := parseBitset(bitsetValue(t, featuresBitset(unix.ETHTOOL_A_FEATURES_WANTED, features)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, features) {
+		t.Errorf("expected %v, got %v", features, got)
+	}
+}
+
+func Test_parseBitset_noMask(t *testing.T) {
+	// the active features are listed without a mask, all of them are set
+	bitset := featuresBitset(unix.ETHTOOL_A_FEATURES_ACTIVE, map[string]bool{"rx-checksum": false, "tx-scatter-gather": false})
+	bitset.AddRtAttr(unix.ETHTOOL_A_BITSET_NOMASK, nil)
+	got, err := parseBitset(bitsetValue(t, bitset))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]bool{"rx-checksum": true, "tx-scatter-gather": true}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
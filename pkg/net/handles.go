@@ -0,0 +1,79 @@
+package net
+
+import (
+	"sync/atomic"
+
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netlink/nl"
+	"github.com/vishvananda/netns"
+)
+
+// Every network namespace handle, netlink handle and netlink socket opened
+// by the package goes through these wrappers, so the ones not closed can be
+// counted and a missed Close shows up as a steady growth.
+var (
+	openNamespaces atomic.Int64
+	openSockets    atomic.Int64
+)
+
+// OpenHandles returns the number of network namespace handles and of netlink
+// handles and sockets opened by the package that are not closed yet.
+func OpenHandles() (namespaces int64, sockets int64) {
+	return openNamespaces.Load(), openSockets.Load()
+}
+
+func getNsFromPath(path string) (netns.NsHandle, error) {
+	ns, err := netns.GetFromPath(path)
+	if err == nil {
+		openNamespaces.Add(1)
+	}
+	return ns, err
+}
+
+func getNs() (netns.NsHandle, error) {
+	ns, err := netns.Get()
+	if err == nil {
+		openNamespaces.Add(1)
+	}
+	return ns, err
+}
+
+func closeNs(ns netns.NsHandle) {
+	if err := ns.Close(); err == nil {
+		openNamespaces.Add(-1)
+	}
+}
+
+func newHandleAt(ns netns.NsHandle) (*netlink.Handle, error) {
+	handle, err := netlink.NewHandleAt(ns)
+	if err == nil {
+		openSockets.Add(1)
+	}
+	return handle, err
+}
+
+func newHandle() (*netlink.Handle, error) {
+	handle, err := netlink.NewHandle()
+	if err == nil {
+		openSockets.Add(1)
+	}
+	return handle, err
+}
+
+func closeHandle(handle *netlink.Handle) {
+	handle.Close()
+	openSockets.Add(-1)
+}
+
+func getNetlinkSocketAt(newNs, curNs netns.NsHandle, protocol int) (*nl.NetlinkSocket, error) {
+	s, err := nl.GetNetlinkSocketAt(newNs, curNs, protocol)
+	if err == nil {
+		openSockets.Add(1)
+	}
+	return s, err
+}
+
+func closeSocket(s *nl.NetlinkSocket) {
+	s.Close()
+	openSockets.Add(-1)
+}
@@ -0,0 +1,46 @@
+package net
+
+import (
+	"testing"
+
+	"github.com/vishvananda/netlink"
+)
+
+// assertHandlesBalanced checks the open handles are back to the counts
+// before the test.
+func assertHandlesBalanced(t *testing.T, namespaces, sockets int64) {
+	t.Helper()
+	gotNamespaces, gotSockets := OpenHandles()
+	if gotNamespaces != namespaces {
+		t.Errorf("open namespace handles = %d, want %d", gotNamespaces, namespaces)
+	}
+	if gotSockets != sockets {
+		t.Errorf("open netlink sockets = %d, want %d", gotSockets, sockets)
+	}
+}
+
+func TestOpenHandles_errors(t *testing.T) {
+	namespaces, sockets := OpenHandles()
+	// the handles opened before the failure must be closed too
+	if _, err := NsLinkInfo("/proc/self/ns/net", "knd-missing0"); err == nil {
+		t.Fatal("expected error for a missing interface")
+	}
+	if _, err := NsLinkInfo("/proc/self/ns/missing", "knd-missing0"); err == nil {
+		t.Fatal("expected error for a missing namespace")
+	}
+	assertHandlesBalanced(t, namespaces, sockets)
+}
+
+func TestOpenHandles_attachDetach(t *testing.T) {
+	nsPath, _ := newTestNamespace(t)
+	link := newTestDummy(t, "knd-handles0")
+	namespaces, sockets := OpenHandles()
+
+	if _, err := NsAttachNetdev(link.Attrs().Name, nsPath, netlink.LinkAttrs{}, nil); err != nil {
+		t.Fatalf("fail to attach netdev: %v", err)
+	}
+	if err := NsDetachNetdev(nsPath, link.Attrs().Name, ""); err != nil {
+		t.Fatalf("fail to detach netdev: %v", err)
+	}
+	assertHandlesBalanced(t, namespaces, sockets)
+}
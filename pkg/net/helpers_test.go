@@ -0,0 +1,84 @@
+package net
+
+import (
+	"crypto/rand"
+	"fmt"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netns"
+)
+
+// newTestNamespace creates a named network namespace with the loopback up
+// and returns its path. The namespace is deleted when the test finishes.
+func newTestNamespace(t *testing.T) (string, netns.NsHandle) {
+	t.Helper()
+	if os.Getuid() != 0 {
+		t.Skip("Test requires root privileges.")
+	}
+
+	origns, err := netns.Get()
+	if err != nil {
+		t.Fatalf("unexpected error trying to get namespace: %v", err)
+	}
+	defer origns.Close()
+
+	rndString := make([]byte, 4)
+	_, err = rand.Read(rndString)
+	if err != nil {
+		t.Errorf("fail to generate random name: %v", err)
+	}
+	nsName := fmt.Sprintf("ns%x", rndString)
+	testNS, err := netns.NewNamed(nsName)
+	if err != nil {
+		t.Fatalf("Failed to create network namespace: %v", err)
+	}
+	t.Cleanup(func() {
+		testNS.Close()
+		_ = netns.DeleteNamed(nsName)
+	})
+
+	// Switch back to the original namespace
+	if err := netns.Set(origns); err != nil {
+		t.Fatal(err)
+	}
+
+	nhNs, err := netlink.NewHandleAt(testNS)
+	if err != nil {
+		t.Fatalf("fail to open netlink handle: %v", err)
+	}
+	defer nhNs.Close()
+
+	loLink, err := nhNs.LinkByName("lo")
+	if err != nil {
+		t.Fatalf("Failed to get loopback interface: %v", err)
+	}
+	if err := nhNs.LinkSetUp(loLink); err != nil {
+		t.Fatalf("Failed to set up loopback interface: %v", err)
+	}
+	return path.Join("/run/netns", nsName), testNS
+}
+
+// newTestDummy creates a dummy interface in the host namespace, the
+// interface is deleted when the test finishes.
+func newTestDummy(t *testing.T, name string) netlink.Link {
+	t.Helper()
+	la := netlink.NewLinkAttrs()
+	la.Name = name
+	link := &netlink.Dummy{LinkAttrs: la}
+	if err := netlink.LinkAdd(link); err != nil {
+		t.Fatalf("Failed to add dummy link %s: %v", name, err)
+	}
+	t.Cleanup(func() {
+		link, err := netlink.LinkByName(name)
+		if err == nil {
+			_ = netlink.LinkDel(link)
+		}
+	})
+	if err := netlink.LinkSetUp(link); err != nil {
+		t.Fatalf("Failed to set up link %s: %v", name, err)
+	}
+	return link
+}
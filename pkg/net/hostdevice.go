@@ -1,9 +1,11 @@
 package net
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"net"
+	"time"
 
 	"github.com/vishvananda/netlink"
 	"github.com/vishvananda/netlink/nl"
@@ -13,23 +15,106 @@ import (
 	resourceapi "k8s.io/api/resource/v1"
 )
 
-func NsAttachNetdev(hostIfName string, containerNsPAth string, newAttr netlink.LinkAttrs, addresses []*net.IPNet) (*resourceapi.NetworkDeviceData, error) {
+// AttachOption customizes how NsAttachNetdev configures the device.
+type AttachOption func(*attachOptions)
+
+type attachOptions struct {
+	bondMode         *netlink.BondMode
+	dadTimeout       time.Duration
+	linkDown         bool
+	linkUpRetries    int
+	namespaceRetries int
+	owner            string
+}
+
+const (
+	// DefaultLinkUpRetries is the number of times the bring up of a moved
+	// device is retried on transient errors.
+	DefaultLinkUpRetries = 3
+	// linkUpBackoff is the initial wait between retries, it doubles with each attempt.
+	linkUpBackoff = 100 * time.Millisecond
+)
+
+// WithLinkUpRetries sets the number of times the bring up of the device is
+// retried on transient errors, some drivers reject it right after the move.
+// 0 disables the retries.
+func WithLinkUpRetries(retries int) AttachOption {
+	return func(o *attachOptions) {
+		o.linkUpRetries = retries
+	}
+}
+
+// WithNamespaceRetries sets the number of times opening the namespace of the
+// pod is retried while it is not ready yet, the runtime may still be setting
+// it up during a fast pod start. 0 disables the retries.
+func WithNamespaceRetries(retries int) AttachOption {
+	return func(o *attachOptions) {
+		o.namespaceRetries = retries
+	}
+}
+
+// WithLinkDown leaves the device down after it is moved to the namespace,
+// so it can be brought up later with NsSetLinkUp.
+func WithLinkDown() AttachOption {
+	return func(o *attachOptions) {
+		o.linkDown = true
+	}
+}
+
+// WithOwner tags the device with the owner alias before it is moved and
+// refuses to move a device already tagged by a different owner. Devices
+// with an alias that is not an owner tag are moved without the tag, and
+// devices renamed in the namespace carry their host name as alias instead.
+func WithOwner(owner string) AttachOption {
+	return func(o *attachOptions) {
+		o.owner = owner
+	}
+}
+
+func NsAttachNetdev(hostIfName string, containerNsPAth string, newAttr netlink.LinkAttrs, addresses []*net.IPNet, opts ...AttachOption) (*resourceapi.NetworkDeviceData, error) {
+	options := attachOptions{linkUpRetries: DefaultLinkUpRetries, namespaceRetries: DefaultNamespaceRetries}
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	// the namespace is opened first so the device is not touched if it
+	// never becomes ready
+	containerNs, err := openNamespace(containerNsPAth, options.namespaceRetries)
+	if err != nil {
+		return nil, err
+	}
+	defer closeNs(containerNs)
+
 	hostDev, err := netlink.LinkByName(hostIfName)
 	// recover same behavior on vishvananda/netlink@1.2.1 and do not fail when the kernel returns NLM_F_DUMP_INTR.
 	if err != nil && !errors.Is(err, netlink.ErrDumpInterrupted) {
 		return nil, err
 	}
 
-	// Devices can be renamed only when down
-	if err = netlink.LinkSetDown(hostDev); err != nil {
-		return nil, fmt.Errorf("failed to set %q down: %v", hostDev.Attrs().Name, err)
+	if options.owner != "" {
+		alias := hostDev.Attrs().Alias
+		if err := checkOwner(hostIfName, alias, options.owner); err != nil {
+			return nil, err
+		}
+		if alias == "" {
+			if err := netlink.LinkSetAlias(hostDev, OwnerAlias(options.owner)); err != nil {
+				return nil, fmt.Errorf("failed to tag %q with the owner %q: %w", hostIfName, options.owner, netlinkError(err))
+			}
+		}
 	}
 
-	containerNs, err := netns.GetFromPath(containerNsPAth)
-	if err != nil {
-		return nil, err
+	// a renamed device keeps its host name as alias, in place of the owner
+	// tag, so it is restored with it even if the kernel returns it
+	if newAttr.Name != "" && newAttr.Name != hostIfName {
+		if err := netlink.LinkSetAlias(hostDev, hostIfName); err != nil {
+			return nil, fmt.Errorf("failed to set the alias of %q before renaming it to %q: %w", hostIfName, newAttr.Name, netlinkError(err))
+		}
+	}
+
+	// Devices can be renamed only when down
+	if err = netlink.LinkSetDown(hostDev); err != nil {
+		return nil, fmt.Errorf("failed to set %q down: %w", hostDev.Attrs().Name, netlinkError(err))
 	}
-	defer containerNs.Close()
 
 	attrs := hostDev.Attrs()
 
@@ -37,11 +122,11 @@ func NsAttachNetdev(hostIfName string, containerNsPAth string, newAttr netlink.L
 	flags := unix.NLM_F_REQUEST | unix.NLM_F_ACK
 	req := nl.NewNetlinkRequest(unix.RTM_NEWLINK, flags)
 	// Get a netlink socket in current namespace
-	s, err := nl.GetNetlinkSocketAt(netns.None(), netns.None(), unix.NETLINK_ROUTE)
+	s, err := getNetlinkSocketAt(netns.None(), netns.None(), unix.NETLINK_ROUTE)
 	if err != nil {
 		return nil, fmt.Errorf("could not get network namespace handle: %w", err)
 	}
-	defer s.Close()
+	defer closeSocket(s)
 
 	req.Sockets = map[int]*nl.SocketHandle{
 		unix.NETLINK_ROUTE: {Socket: s},
@@ -96,16 +181,16 @@ func NsAttachNetdev(hostIfName string, containerNsPAth string, newAttr netlink.L
 
 	_, err = req.Execute(unix.NETLINK_ROUTE, 0)
 	if err != nil && !errors.Is(err, netlink.ErrDumpInterrupted) {
-		return nil, err
+		return nil, fmt.Errorf("failed to move %q to namespace %s: %w", attrs.Name, containerNsPAth, netlinkError(err))
 	}
 
 	// to avoid golang problem with goroutines we create the socket in the
 	// namespace and use it directly
-	nhNs, err := netlink.NewHandleAt(containerNs)
+	nhNs, err := newNamespaceHandle(containerNs, options.namespaceRetries)
 	if err != nil {
 		return nil, err
 	}
-	defer nhNs.Close()
+	defer closeHandle(nhNs)
 
 	nsLink, err := nhNs.LinkByName(ifName)
 	if err != nil && !errors.Is(err, netlink.ErrDumpInterrupted) {
@@ -120,32 +205,136 @@ func NsAttachNetdev(hostIfName string, containerNsPAth string, newAttr netlink.L
 	for _, ipnet := range addresses {
 		err = nhNs.AddrAdd(nsLink, &netlink.Addr{IPNet: &net.IPNet{IP: ipnet.IP, Mask: ipnet.Mask}})
 		if err != nil {
-			return nil, fmt.Errorf("fail to set up address %s on namespace %s: %w", ipnet.IP.String(), containerNsPAth, err)
+			return nil, fmt.Errorf("fail to set up address %s on namespace %s: %w", ipnet.IP.String(), containerNsPAth, netlinkError(err))
 		}
-		networkData.IPs = append(networkData.IPs, ipnet.IP.String())
+		// the claim status requires the addresses in CIDR notation
+		networkData.IPs = append(networkData.IPs, ipnet.String())
 	}
 
-	err = nhNs.LinkSetUp(nsLink)
+	if options.linkDown {
+		return networkData, nil
+	}
+
+	err = retryTransient(options.linkUpRetries, linkUpBackoff, func() error {
+		return nhNs.LinkSetUp(nsLink)
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failt to set up interface %s on namespace %s: %w", nsLink.Attrs().Name, containerNsPAth, err)
+		return nil, fmt.Errorf("failt to set up interface %s on namespace %s: %w", nsLink.Attrs().Name, containerNsPAth, netlinkError(err))
+	}
+
+	if options.dadTimeout > 0 {
+		if err := waitDAD(containerNsPAth, nhNs, nsLink, options.dadTimeout); err != nil {
+			return nil, err
+		}
 	}
 
 	return networkData, nil
 }
 
-func NsDetachNetdev(containerNsPAth string, devName string, outName string) error {
-	containerNs, err := netns.GetFromPath(containerNsPAth)
+// NsSetLinkUp brings up the interface ifName in the namespace containerNsPath.
+func NsSetLinkUp(containerNsPath string, ifName string) error {
+	containerNs, err := getNsFromPath(containerNsPath)
 	if err != nil {
-		return fmt.Errorf("could not get network namespace from path %s for network device %s : %w", containerNsPAth, devName, err)
+		return fmt.Errorf("could not get network namespace from path %s for network device %s : %w", containerNsPath, ifName, err)
 	}
-	defer containerNs.Close()
+	defer closeNs(containerNs)
+
+	nhNs, err := newHandleAt(containerNs)
+	if err != nil {
+		return fmt.Errorf("could not get network namespace handle: %w", err)
+	}
+	defer closeHandle(nhNs)
+
+	nsLink, err := nhNs.LinkByName(ifName)
+	if err != nil && !errors.Is(err, netlink.ErrDumpInterrupted) {
+		return fmt.Errorf("link not found for interface %s on namespace %s: %w", ifName, containerNsPath, err)
+	}
+
+	if err = nhNs.LinkSetUp(nsLink); err != nil {
+		return fmt.Errorf("fail to set up interface %s on namespace %s: %w", ifName, containerNsPath, netlinkError(err))
+	}
+	return nil
+}
+
+// NsSetLinkDown sets down the interface ifName in the namespace containerNsPath.
+func NsSetLinkDown(containerNsPath string, ifName string) error {
+	containerNs, err := getNsFromPath(containerNsPath)
+	if err != nil {
+		return fmt.Errorf("could not get network namespace from path %s for network device %s : %w", containerNsPath, ifName, err)
+	}
+	defer closeNs(containerNs)
+
+	nhNs, err := newHandleAt(containerNs)
+	if err != nil {
+		return fmt.Errorf("could not get network namespace handle: %w", err)
+	}
+	defer closeHandle(nhNs)
+
+	nsLink, err := nhNs.LinkByName(ifName)
+	if err != nil && !errors.Is(err, netlink.ErrDumpInterrupted) {
+		return fmt.Errorf("link not found for interface %s on namespace %s: %w", ifName, containerNsPath, err)
+	}
+
+	if err = nhNs.LinkSetDown(nsLink); err != nil {
+		return fmt.Errorf("fail to set down interface %s on namespace %s: %w", ifName, containerNsPath, netlinkError(err))
+	}
+	return nil
+}
+
+// ErrLinkDown is returned when a device was returned to the host namespace
+// but could not be set up again.
+var ErrLinkDown = errors.New("device returned to the host but left down")
+
+// DetachOption customizes how NsDetachNetdev returns the device.
+type DetachOption func(*detachOptions)
+
+type detachOptions struct {
+	namespaceRetries int
+	mtu              int
+	hardwareAddr     net.HardwareAddr
+}
+
+// WithDetachNamespaceRetries sets the number of times opening the namespace
+// of the pod is retried on transient errors, 0 disables the retries.
+func WithDetachNamespaceRetries(retries int) DetachOption {
+	return func(o *detachOptions) {
+		o.namespaceRetries = retries
+	}
+}
+
+// WithOriginalAttrs sets the MTU and the hardware address the device had
+// before it was attached back once it is returned to the host, the caller
+// records them as they are not kept on the device. An MTU of 0 or a nil
+// address are left as they are in the pod.
+func WithOriginalAttrs(mtu int, hardwareAddr net.HardwareAddr) DetachOption {
+	return func(o *detachOptions) {
+		o.mtu = mtu
+		o.hardwareAddr = hardwareAddr
+	}
+}
+
+// NsDetachNetdev returns the interface devName from the namespace
+// containerNsPAth to the host as outName. If the namespace is gone the
+// error wraps ErrNamespaceGone, the kernel already returned the device to
+// the host namespace.
+func NsDetachNetdev(containerNsPAth string, devName string, outName string, opts ...DetachOption) error {
+	options := detachOptions{namespaceRetries: DefaultNamespaceRetries}
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	containerNs, err := openNamespace(containerNsPAth, options.namespaceRetries)
+	if err != nil {
+		return fmt.Errorf("network device %s: %w", devName, err)
+	}
+	defer closeNs(containerNs)
 	// to avoid golang problem with goroutines we create the socket in the
 	// namespace and use it directly
-	nhNs, err := netlink.NewHandleAt(containerNs)
+	nhNs, err := newNamespaceHandle(containerNs, options.namespaceRetries)
 	if err != nil {
-		return fmt.Errorf("could not get network namespace handle: %w", err)
+		return err
 	}
-	defer nhNs.Close()
+	defer closeHandle(nhNs)
 
 	nsLink, err := nhNs.LinkByName(devName)
 	if err != nil {
@@ -156,26 +345,31 @@ func NsDetachNetdev(containerNsPAth string, devName string, outName string) erro
 	// when it is restored to the original namespace
 	err = nhNs.LinkSetDown(nsLink)
 	if err != nil {
+		return fmt.Errorf("failed to set %q down: %w", devName, netlinkError(err))
+	}
+
+	// the device is no longer in use once it is back on the host
+	if err := clearOwner(nsLink, nhNs.LinkSetAlias); err != nil {
 		return err
 	}
 
 	attrs := nsLink.Attrs()
 	// restore the original name if it was renamed
-	if nsLink.Attrs().Alias != "" {
-		attrs.Name = nsLink.Attrs().Alias
+	if _, owned := aliasOwner(attrs.Alias); attrs.Alias != "" && !owned {
+		attrs.Name = attrs.Alias
 	}
 
-	rootNs, err := netns.Get()
+	rootNs, err := getNs()
 	if err != nil {
 		return err
 	}
-	defer rootNs.Close()
+	defer closeNs(rootNs)
 
-	s, err := nl.GetNetlinkSocketAt(containerNs, rootNs, unix.NETLINK_ROUTE)
+	s, err := getNetlinkSocketAt(containerNs, rootNs, unix.NETLINK_ROUTE)
 	if err != nil {
 		return fmt.Errorf("could not get network namespace handle: %w", err)
 	}
-	defer s.Close()
+	defer closeSocket(s)
 	// copy from netlink.LinkModify(dev) using only the parts needed
 	flags := unix.NLM_F_REQUEST | unix.NLM_F_ACK
 	req := nl.NewNetlinkRequest(unix.RTM_NEWLINK, flags)
@@ -199,7 +393,7 @@ func NsDetachNetdev(containerNsPAth string, devName string, outName string) erro
 
 	_, err = req.Execute(unix.NETLINK_ROUTE, 0)
 	if err != nil {
-		return err
+		return fmt.Errorf("failed to move %q to the host namespace as %q: %w", devName, ifName, netlinkError(err))
 	}
 
 	// Set up the interface in case host network workloads depend on it
@@ -208,9 +402,207 @@ func NsDetachNetdev(containerNsPAth string, devName string, outName string) erro
 	if err != nil && !errors.Is(err, netlink.ErrDumpInterrupted) {
 		return err
 	}
+	// the device is still down, as required to change the hardware address
+	if err := restoreLinkAttrs(hostDev, options); err != nil {
+		return err
+	}
+	if err := clearNameAlias(hostDev, netlink.LinkSetAlias); err != nil {
+		return err
+	}
 
 	if err = netlink.LinkSetUp(hostDev); err != nil {
-		return fmt.Errorf("failed to set %q down: %v", hostDev.Attrs().Name, err)
+		return fmt.Errorf("%w: failed to set %q up: %w", ErrLinkDown, hostDev.Attrs().Name, netlinkError(err))
 	}
 	return nil
 }
+
+// RestoreNetdev recovers a network device that was returned to the host
+// namespace by the kernel, typically because the pod network namespace it was
+// moved into has been destroyed. The device is looked up by devName or by its
+// Alias, renamed to outName if needed, the original MTU and hardware address
+// of WithOriginalAttrs restored and set up.
+func RestoreNetdev(devName string, outName string, opts ...DetachOption) error {
+	var options detachOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	hostDev, err := netlink.LinkByName(devName)
+	if err != nil && !errors.Is(err, netlink.ErrDumpInterrupted) {
+		hostDev = nil
+		links, err := netlink.LinkList()
+		if err != nil && !errors.Is(err, netlink.ErrDumpInterrupted) {
+			return err
+		}
+		for _, link := range links {
+			if link.Attrs().Alias != "" && link.Attrs().Alias == outName {
+				hostDev = link
+				break
+			}
+		}
+	}
+	if hostDev == nil {
+		return fmt.Errorf("link not found for interface %s on the host namespace", devName)
+	}
+
+	if err := clearOwner(hostDev, netlink.LinkSetAlias); err != nil {
+		return err
+	}
+
+	rename := outName != "" && hostDev.Attrs().Name != outName
+	// Devices can be renamed and change their hardware address only when down
+	if rename || options.hardwareAddr != nil {
+		if err = netlink.LinkSetDown(hostDev); err != nil {
+			return fmt.Errorf("failed to set %q down: %w", hostDev.Attrs().Name, netlinkError(err))
+		}
+	}
+	if rename {
+		if err = netlink.LinkSetName(hostDev, outName); err != nil {
+			return fmt.Errorf("failed to rename %q to %q: %w", hostDev.Attrs().Name, outName, netlinkError(err))
+		}
+		hostDev.Attrs().Name = outName
+	}
+	if err := restoreLinkAttrs(hostDev, options); err != nil {
+		return err
+	}
+	if err := clearNameAlias(hostDev, netlink.LinkSetAlias); err != nil {
+		return err
+	}
+
+	if err = netlink.LinkSetUp(hostDev); err != nil {
+		return fmt.Errorf("failed to set %q up: %w", hostDev.Attrs().Name, netlinkError(err))
+	}
+	return nil
+}
+
+// restoreLinkAttrs sets the original MTU and hardware address of the options
+// back on a link of the host, if they differ. The link must be down.
+func restoreLinkAttrs(link netlink.Link, options detachOptions) error {
+	attrs := link.Attrs()
+	if options.mtu != 0 && options.mtu != attrs.MTU {
+		if err := netlink.LinkSetMTU(link, options.mtu); err != nil {
+			return fmt.Errorf("failed to restore the mtu %d of %q: %w", options.mtu, attrs.Name, netlinkError(err))
+		}
+	}
+	if options.hardwareAddr != nil && !bytes.Equal(options.hardwareAddr, attrs.HardwareAddr) {
+		if err := netlink.LinkSetHardwareAddr(link, options.hardwareAddr); err != nil {
+			return fmt.Errorf("failed to restore the address %s of %q: %w", options.hardwareAddr, attrs.Name, netlinkError(err))
+		}
+	}
+	return nil
+}
+
+// NsLinkStatistics returns the counters of the interface ifName in the namespace containerNsPath.
+func NsLinkStatistics(containerNsPath string, ifName string) (*netlink.LinkStatistics, error) {
+	containerNs, err := getNsFromPath(containerNsPath)
+	if err != nil {
+		return nil, fmt.Errorf("could not get network namespace from path %s for network device %s : %w", containerNsPath, ifName, err)
+	}
+	defer closeNs(containerNs)
+
+	nhNs, err := newHandleAt(containerNs)
+	if err != nil {
+		return nil, fmt.Errorf("could not get network namespace handle: %w", err)
+	}
+	defer closeHandle(nhNs)
+
+	nsLink, err := nhNs.LinkByName(ifName)
+	if err != nil && !errors.Is(err, netlink.ErrDumpInterrupted) {
+		return nil, fmt.Errorf("link not found for interface %s on namespace %s: %w", ifName, containerNsPath, err)
+	}
+	if nsLink.Attrs().Statistics == nil {
+		return nil, fmt.Errorf("no statistics for interface %s on namespace %s", ifName, containerNsPath)
+	}
+	return nsLink.Attrs().Statistics, nil
+}
+
+// LinkInfo is the live configuration of an interface.
+type LinkInfo struct {
+	HardwareAddr string
+	MTU          int
+	// Carrier is true if the interface has a carrier (IFF_LOWER_UP).
+	Carrier bool
+	// Addresses are the global scope prefixes of the interface.
+	Addresses []string
+	// SecondaryAddresses are the Addresses that are IPv4 secondaries.
+	SecondaryAddresses []string
+}
+
+// NsLinkInfo returns the address, MTU, carrier and global addresses of the
+// interface ifName in the namespace containerNsPath.
+func NsLinkInfo(containerNsPath string, ifName string) (*LinkInfo, error) {
+	containerNs, err := getNsFromPath(containerNsPath)
+	if err != nil {
+		return nil, fmt.Errorf("could not get network namespace from path %s for network device %s : %w", containerNsPath, ifName, err)
+	}
+	defer closeNs(containerNs)
+
+	nhNs, err := newHandleAt(containerNs)
+	if err != nil {
+		return nil, fmt.Errorf("could not get network namespace handle: %w", err)
+	}
+	defer closeHandle(nhNs)
+
+	nsLink, err := nhNs.LinkByName(ifName)
+	if err != nil && !errors.Is(err, netlink.ErrDumpInterrupted) {
+		return nil, fmt.Errorf("link not found for interface %s on namespace %s: %w", ifName, containerNsPath, err)
+	}
+	addrs, err := nhNs.AddrList(nsLink, netlink.FAMILY_ALL)
+	if err != nil && !errors.Is(err, netlink.ErrDumpInterrupted) {
+		return nil, fmt.Errorf("failed to list addresses of interface %s on namespace %s: %w", ifName, containerNsPath, netlinkError(err))
+	}
+	info := &LinkInfo{
+		HardwareAddr: nsLink.Attrs().HardwareAddr.String(),
+		MTU:          nsLink.Attrs().MTU,
+		Carrier:      nsLink.Attrs().RawFlags&unix.IFF_LOWER_UP != 0,
+	}
+	for _, addr := range addrs {
+		if addr.Scope != int(netlink.SCOPE_UNIVERSE) {
+			continue
+		}
+		info.Addresses = append(info.Addresses, addr.IPNet.String())
+		if addr.Flags&unix.IFA_F_SECONDARY != 0 && addr.IP.To4() != nil {
+			info.SecondaryAddresses = append(info.SecondaryAddresses, addr.IPNet.String())
+		}
+	}
+	return info, nil
+}
+
+// NsLinkParents returns, for the interfaces of the namespace, the name of the
+// interface they depend on, either their master (bond, bridge, VRF) or the
+// parent link of child interfaces like vlan or macvlan. Interfaces without a
+// parent in the namespace are not included.
+func NsLinkParents(containerNsPath string) (map[string]string, error) {
+	containerNs, err := getNsFromPath(containerNsPath)
+	if err != nil {
+		return nil, fmt.Errorf("could not get network namespace from path %s: %w", containerNsPath, err)
+	}
+	defer closeNs(containerNs)
+
+	nhNs, err := newHandleAt(containerNs)
+	if err != nil {
+		return nil, fmt.Errorf("could not get network namespace handle: %w", err)
+	}
+	defer closeHandle(nhNs)
+
+	links, err := nhNs.LinkList()
+	if err != nil && !errors.Is(err, netlink.ErrDumpInterrupted) {
+		return nil, fmt.Errorf("could not list interfaces on namespace %s: %w", containerNsPath, err)
+	}
+	names := make(map[int]string, len(links))
+	for _, link := range links {
+		names[link.Attrs().Index] = link.Attrs().Name
+	}
+	parents := map[string]string{}
+	for _, link := range links {
+		attrs := link.Attrs()
+		for _, index := range []int{attrs.MasterIndex, attrs.ParentIndex} {
+			// the parent index of a moved child refers to the host namespace
+			if name, ok := names[index]; ok && index != attrs.Index {
+				parents[attrs.Name] = name
+				break
+			}
+		}
+	}
+	return parents, nil
+}
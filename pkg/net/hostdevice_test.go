@@ -1,8 +1,10 @@
 package net
 
 import (
+	"bytes"
 	"crypto/rand"
 	"fmt"
+	"net"
 	"os"
 	"os/exec"
 	"path"
@@ -127,3 +129,88 @@ func Test_nhNetdev(t *testing.T) {
 	}
 
 }
+
+func TestNsAttachNetdev_rename(t *testing.T) {
+	nsPath, testNS := newTestNamespace(t)
+	ifaceName := "testdummy-rn"
+	newTestDummy(t, ifaceName)
+
+	if _, err := NsAttachNetdev(ifaceName, nsPath, netlink.LinkAttrs{Name: "net1"}, nil, WithOwner("hostdevice.k8s.io")); err != nil {
+		t.Fatalf("fail to attach netdev to namespace: %v", err)
+	}
+
+	nhNs, err := netlink.NewHandleAt(testNS)
+	if err != nil {
+		t.Fatalf("fail to open netlink handle: %v", err)
+	}
+	defer nhNs.Close()
+	nsLink, err := nhNs.LinkByName("net1")
+	if err != nil {
+		t.Fatalf("renamed interface not found: %v", err)
+	}
+	if nsLink.Attrs().Alias != ifaceName {
+		t.Errorf("expected alias %q, got %q", ifaceName, nsLink.Attrs().Alias)
+	}
+
+	// the host name is restored from the alias
+	if err := NsDetachNetdev(nsPath, "net1", ""); err != nil {
+		t.Fatalf("fail to detach netdev from namespace: %v", err)
+	}
+	hostLink, err := netlink.LinkByName(ifaceName)
+	if err != nil {
+		t.Fatalf("interface not restored with its host name: %v", err)
+	}
+	if hostLink.Attrs().Alias != "" {
+		t.Errorf("expected the alias to be removed, got %q", hostLink.Attrs().Alias)
+	}
+}
+
+func TestNsDetachNetdev_restoreAttrs(t *testing.T) {
+	nsPath, testNS := newTestNamespace(t)
+	ifaceName := "testdummy-ra"
+	link := newTestDummy(t, ifaceName)
+	origMTU := link.Attrs().MTU
+	origMAC := link.Attrs().HardwareAddr
+	mac, _ := net.ParseMAC("02:00:00:00:00:01")
+
+	if _, err := NsAttachNetdev(ifaceName, nsPath, netlink.LinkAttrs{MTU: 1400, HardwareAddr: mac}, nil, WithOwner("hostdevice.k8s.io")); err != nil {
+		t.Fatalf("fail to attach netdev to namespace: %v", err)
+	}
+	info, err := NsLinkInfo(nsPath, ifaceName)
+	if err != nil {
+		t.Fatalf("fail to get the link of the namespace: %v", err)
+	}
+	if info.MTU != 1400 || info.HardwareAddr != mac.String() {
+		t.Fatalf("expected mtu 1400 and address %s in the namespace, got %+v", mac, info)
+	}
+	// the owner tag is kept
+	nhNs, err := netlink.NewHandleAt(testNS)
+	if err != nil {
+		t.Fatalf("fail to open netlink handle: %v", err)
+	}
+	defer nhNs.Close()
+	nsLink, err := nhNs.LinkByName(ifaceName)
+	if err != nil {
+		t.Fatalf("fail to get the link of the namespace: %v", err)
+	}
+	if nsLink.Attrs().Alias != OwnerAlias("hostdevice.k8s.io") {
+		t.Errorf("expected the owner alias, got %q", nsLink.Attrs().Alias)
+	}
+
+	if err := NsDetachNetdev(nsPath, ifaceName, "", WithOriginalAttrs(origMTU, origMAC)); err != nil {
+		t.Fatalf("fail to detach netdev from namespace: %v", err)
+	}
+	hostLink, err := netlink.LinkByName(ifaceName)
+	if err != nil {
+		t.Fatalf("interface not restored with its host name: %v", err)
+	}
+	if hostLink.Attrs().MTU != origMTU {
+		t.Errorf("expected the original mtu %d, got %d", origMTU, hostLink.Attrs().MTU)
+	}
+	if !bytes.Equal(hostLink.Attrs().HardwareAddr, origMAC) {
+		t.Errorf("expected the original address %s, got %s", origMAC, hostLink.Attrs().HardwareAddr)
+	}
+	if hostLink.Attrs().Alias != "" {
+		t.Errorf("expected the alias to be removed, got %q", hostLink.Attrs().Alias)
+	}
+}
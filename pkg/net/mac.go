@@ -0,0 +1,89 @@
+package net
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/vishvananda/netlink"
+)
+
+// PermanentHardwareAddr returns the permanent (burned-in) MAC address of the
+// host interface ifName, as reported by the driver to ethtool -P. Virtual
+// interfaces and drivers that do not report it return an error.
+func PermanentHardwareAddr(ifName string) (net.HardwareAddr, error) {
+	link, err := netlink.LinkByName(ifName)
+	if err != nil && !errors.Is(err, netlink.ErrDumpInterrupted) {
+		return nil, fmt.Errorf("link not found for interface %s on the host namespace: %w", ifName, err)
+	}
+	mac := link.Attrs().PermHWAddr
+	if err := validateHardwareAddr(mac); err != nil {
+		return nil, fmt.Errorf("interface %s has no valid permanent address: %w", ifName, err)
+	}
+	return mac, nil
+}
+
+// validateHardwareAddr returns an error if mac can not be assigned to an
+// ethernet interface.
+func validateHardwareAddr(mac net.HardwareAddr) error {
+	if len(mac) != 6 {
+		return fmt.Errorf("invalid address %q", mac.String())
+	}
+	if bytes.Equal(mac, make(net.HardwareAddr, 6)) {
+		return fmt.Errorf("address %s is zero", mac)
+	}
+	if mac[0]&0x01 != 0 {
+		return fmt.Errorf("address %s is multicast", mac)
+	}
+	return nil
+}
+
+// SetHardwareAddr sets the MAC address of the host interface ifName. The
+// interface is set down first, not all drivers can change the address of a
+// running interface.
+func SetHardwareAddr(ifName string, mac net.HardwareAddr) error {
+	handle, err := newHandle()
+	if err != nil {
+		return fmt.Errorf("could not get network namespace handle: %w", err)
+	}
+	defer closeHandle(handle)
+	return setHardwareAddr(handle, ifName, mac)
+}
+
+// NsSetHardwareAddr sets the MAC address of the interface ifName in the
+// namespace containerNsPath. The interface is set down first.
+func NsSetHardwareAddr(containerNsPath string, ifName string, mac net.HardwareAddr) error {
+	containerNs, err := getNsFromPath(containerNsPath)
+	if err != nil {
+		return fmt.Errorf("could not get network namespace from path %s for network device %s : %w", containerNsPath, ifName, err)
+	}
+	defer closeNs(containerNs)
+
+	nhNs, err := newHandleAt(containerNs)
+	if err != nil {
+		return fmt.Errorf("could not get network namespace handle: %w", err)
+	}
+	defer closeHandle(nhNs)
+	return setHardwareAddr(nhNs, ifName, mac)
+}
+
+func setHardwareAddr(nh *netlink.Handle, ifName string, mac net.HardwareAddr) error {
+	if err := validateHardwareAddr(mac); err != nil {
+		return err
+	}
+	link, err := nh.LinkByName(ifName)
+	if err != nil && !errors.Is(err, netlink.ErrDumpInterrupted) {
+		return fmt.Errorf("link not found for interface %s: %w", ifName, err)
+	}
+	if bytes.Equal(link.Attrs().HardwareAddr, mac) {
+		return nil
+	}
+	if err := nh.LinkSetDown(link); err != nil {
+		return fmt.Errorf("failed to set %q down: %w", ifName, netlinkError(err))
+	}
+	if err := nh.LinkSetHardwareAddr(link, mac); err != nil {
+		return fmt.Errorf("failed to set address %s on %q: %w", mac, ifName, netlinkError(err))
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package net
+
+import (
+	"net"
+	"testing"
+
+	"github.com/vishvananda/netlink"
+)
+
+func Test_validateHardwareAddr(t *testing.T) {
+	tests := []struct {
+		mac     string
+		wantErr bool
+	}{
+		{mac: "02:42:ac:11:00:02"},
+		{mac: "00:00:00:00:00:00", wantErr: true},
+		{mac: "01:00:5e:00:00:01", wantErr: true},
+		{mac: "ff:ff:ff:ff:ff:ff", wantErr: true},
+		{mac: "00:00:00:00:fe:80:00:00:00:00:00:00:02:00:5e:10:00:00:00:01", wantErr: true},
+	}
+	for _, tt := range tests {
+		mac, err := net.ParseMAC(tt.mac)
+		if err != nil {
+			t.Fatalf("invalid test address %s: %v", tt.mac, err)
+		}
+		if err := validateHardwareAddr(mac); (err != nil) != tt.wantErr {
+			t.Errorf("validateHardwareAddr(%s) error = %v, wantErr %v", tt.mac, err, tt.wantErr)
+		}
+	}
+	if err := validateHardwareAddr(nil); err == nil {
+		t.Errorf("expected error for empty address")
+	}
+}
+
+func TestPermanentHardwareAddr(t *testing.T) {
+	nsPath, _ := newTestNamespace(t)
+	link := newTestDummy(t, "testperm-0")
+
+	// dummy interfaces have no permanent address
+	if mac, err := PermanentHardwareAddr(link.Attrs().Name); err == nil {
+		t.Fatalf("expected error for dummy interface, got %s", mac)
+	}
+
+	mac, _ := net.ParseMAC("02:42:ac:11:00:02")
+	if err := SetHardwareAddr(link.Attrs().Name, mac); err != nil {
+		t.Fatalf("unexpected error setting address: %v", err)
+	}
+	if _, err := NsAttachNetdev(link.Attrs().Name, nsPath, netlink.LinkAttrs{}, nil); err != nil {
+		t.Fatalf("unexpected error attaching device: %v", err)
+	}
+	restored, _ := net.ParseMAC("02:42:ac:11:00:03")
+	if err := NsSetHardwareAddr(nsPath, link.Attrs().Name, restored); err != nil {
+		t.Fatalf("unexpected error setting address in namespace: %v", err)
+	}
+	if err := NsDetachNetdev(nsPath, link.Attrs().Name, ""); err != nil {
+		t.Fatalf("unexpected error detaching device: %v", err)
+	}
+	hostLink, err := netlink.LinkByName(link.Attrs().Name)
+	if err != nil {
+		t.Fatalf("device not returned to the host: %v", err)
+	}
+	if got := hostLink.Attrs().HardwareAddr.String(); got != restored.String() {
+		t.Errorf("expected address %s, got %s", restored, got)
+	}
+}
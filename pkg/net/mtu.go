@@ -0,0 +1,117 @@
+package net
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netlink/nl"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// MinMTU is the minimum MTU of an IPv4 interface.
+	MinMTU = 68
+	// MaxMTU is the maximum MTU of an interface.
+	MaxMTU = 65535
+)
+
+// reportedMaxMTU returns the maximum MTU the driver of the host interface
+// ifName reports to the kernel, or 0 if it reports none.
+func reportedMaxMTU(ifName string) (int, error) {
+	req := nl.NewNetlinkRequest(unix.RTM_GETLINK, unix.NLM_F_ACK)
+	req.AddData(nl.NewIfInfomsg(unix.AF_UNSPEC))
+	req.AddData(nl.NewRtAttr(unix.IFLA_IFNAME, nl.ZeroTerminated(ifName)))
+	msgs, err := req.Execute(unix.NETLINK_ROUTE, unix.RTM_NEWLINK)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get interface %s: %w", ifName, netlinkError(err))
+	}
+	if len(msgs) == 0 || len(msgs[0]) < unix.SizeofIfInfomsg {
+		return 0, fmt.Errorf("no link information for interface %s", ifName)
+	}
+	attrs, err := nl.ParseRouteAttr(msgs[0][unix.SizeofIfInfomsg:])
+	if err != nil {
+		return 0, fmt.Errorf("invalid link information for interface %s: %w", ifName, err)
+	}
+	for _, attr := range attrs {
+		if attr.Attr.Type == unix.IFLA_MAX_MTU && len(attr.Value) == 4 {
+			return int(nl.NativeEndian().Uint32(attr.Value)), nil
+		}
+	}
+	return 0, nil
+}
+
+// LinkMTU returns the current MTU of the host interface ifName.
+func LinkMTU(ifName string) (int, error) {
+	value, err := readSysfsNetAttr(ifName, "mtu")
+	if err != nil {
+		return 0, fmt.Errorf("failed to read mtu of interface %s: %w", ifName, err)
+	}
+	mtu, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid mtu %q for interface %s: %w", value, ifName, err)
+	}
+	return mtu, nil
+}
+
+// LinkMaxMTU returns the maximum MTU of the host interface ifName. Drivers
+// that do not report it, and kernels older than 4.19, are considered to
+// support only their current MTU.
+func LinkMaxMTU(ifName string) (int, error) {
+	return linkMaxMTU(ifName, reportedMaxMTU)
+}
+
+// linkMaxMTU is LinkMaxMTU reading the maximum reported by the driver with
+// reported.
+func linkMaxMTU(ifName string, reported func(ifName string) (int, error)) (int, error) {
+	maxMTU, err := reported(ifName)
+	if err == nil && maxMTU > 0 {
+		return maxMTU, nil
+	}
+	mtu, mtuErr := LinkMTU(ifName)
+	if mtuErr != nil {
+		return 0, errors.Join(err, mtuErr)
+	}
+	return mtu, nil
+}
+
+// SetLinkMTU sets the MTU of the host interface ifName.
+func SetLinkMTU(ifName string, mtu int) error {
+	handle, err := newHandle()
+	if err != nil {
+		return fmt.Errorf("could not get network namespace handle: %w", err)
+	}
+	defer closeHandle(handle)
+	return setLinkMTU(handle, ifName, mtu)
+}
+
+// NsSetLinkMTU sets the MTU of the interface ifName in the namespace containerNsPath.
+func NsSetLinkMTU(containerNsPath string, ifName string, mtu int) error {
+	containerNs, err := getNsFromPath(containerNsPath)
+	if err != nil {
+		return fmt.Errorf("could not get network namespace from path %s for network device %s : %w", containerNsPath, ifName, err)
+	}
+	defer closeNs(containerNs)
+
+	nhNs, err := newHandleAt(containerNs)
+	if err != nil {
+		return fmt.Errorf("could not get network namespace handle: %w", err)
+	}
+	defer closeHandle(nhNs)
+	return setLinkMTU(nhNs, ifName, mtu)
+}
+
+func setLinkMTU(nh *netlink.Handle, ifName string, mtu int) error {
+	link, err := nh.LinkByName(ifName)
+	if err != nil && !errors.Is(err, netlink.ErrDumpInterrupted) {
+		return fmt.Errorf("link not found for interface %s: %w", ifName, err)
+	}
+	if link.Attrs().MTU == mtu {
+		return nil
+	}
+	if err := nh.LinkSetMTU(link, mtu); err != nil {
+		return fmt.Errorf("failed to set mtu %d on %q: %w", mtu, ifName, netlinkError(err))
+	}
+	return nil
+}
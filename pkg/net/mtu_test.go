@@ -0,0 +1,47 @@
+package net
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestLinkMaxMTU(t *testing.T) {
+	fakeSysfs(t, map[string]map[string]string{
+		"eth0": {"mtu": "1500"},
+		"eth1": {"mtu": "1500"},
+		"eth2": {"mtu": "9000"},
+		"bad0": {"mtu": "jumbo"},
+	})
+	reported := map[string]int{"eth0": 9216, "eth1": 0}
+	driverMaxMTU := func(ifName string) (int, error) {
+		maxMTU, ok := reported[ifName]
+		if !ok {
+			return 0, errors.New("no IFLA_MAX_MTU")
+		}
+		return maxMTU, nil
+	}
+
+	tests := []struct {
+		ifName  string
+		want    int
+		wantErr bool
+	}{
+		// reported by the driver
+		{ifName: "eth0", want: 9216},
+		// no limit reported, the current MTU is supported
+		{ifName: "eth1", want: 1500},
+		// old kernels do not report it
+		{ifName: "eth2", want: 9000},
+		{ifName: "bad0", wantErr: true},
+		{ifName: "missing0", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := linkMaxMTU(tt.ifName, driverMaxMTU)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("LinkMaxMTU(%s) error = %v, wantErr %v", tt.ifName, err, tt.wantErr)
+		}
+		if got != tt.want {
+			t.Errorf("LinkMaxMTU(%s) = %d, want %d", tt.ifName, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package net
+
+import (
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+)
+
+var (
+	// ipv4Multicast is the IPv4 multicast range.
+	ipv4Multicast = &net.IPNet{IP: net.IPv4(224, 0, 0, 0).To4(), Mask: net.CIDRMask(4, 32)}
+	// ipv4LocalMulticast is the local network control block, never forwarded
+	// and always sent through the interface chosen by the application.
+	ipv4LocalMulticast = &net.IPNet{IP: net.IPv4(224, 0, 0, 0).To4(), Mask: net.CIDRMask(24, 32)}
+	// ipv6Multicast is the IPv6 multicast range.
+	ipv6Multicast = &net.IPNet{IP: net.ParseIP("ff00::"), Mask: net.CIDRMask(8, 128)}
+)
+
+// MulticastConfig are the multicast groups received and sent through the
+// interface moved into the pod, for pods with multiple interfaces where the
+// default route does not point to the multicast network.
+type MulticastConfig struct {
+	// Groups are the multicast group prefixes routed through the interface,
+	// e.g. 239.1.1.0/24 or ff3e::/32.
+	Groups []string `json:"groups"`
+}
+
+// parseGroups validates the multicast groups.
+func (c MulticastConfig) parseGroups() ([]*net.IPNet, error) {
+	if len(c.Groups) == 0 {
+		return nil, fmt.Errorf("no multicast groups")
+	}
+	var groups []*net.IPNet
+	for _, g := range c.Groups {
+		group, err := parseMulticastGroup(g)
+		if err != nil {
+			return nil, err
+		}
+		groups = append(groups, group)
+	}
+	return groups, nil
+}
+
+// parseMulticastGroup parses a multicast group prefix, a single group
+// without length is a host prefix.
+func parseMulticastGroup(group string) (*net.IPNet, error) {
+	_, prefix, err := net.ParseCIDR(group)
+	if err != nil {
+		ip := net.ParseIP(group)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid multicast group %q", group)
+		}
+		bits := 8 * net.IPv6len
+		if ip4 := ip.To4(); ip4 != nil {
+			ip, bits = ip4, 8*net.IPv4len
+		}
+		prefix = &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}
+	}
+	multicast := ipv6Multicast
+	if prefix.IP.To4() != nil {
+		multicast = ipv4Multicast
+	}
+	ones, _ := prefix.Mask.Size()
+	multicastOnes, _ := multicast.Mask.Size()
+	if !multicast.Contains(prefix.IP) || ones < multicastOnes {
+		return nil, fmt.Errorf("%s is not a multicast group, must be within %s", group, multicast)
+	}
+	if localOnes, _ := ipv4LocalMulticast.Mask.Size(); ones >= localOnes && ipv4LocalMulticast.Contains(prefix.IP) {
+		return nil, fmt.Errorf("%s is in the local network control block %s, it is not routed", group, ipv4LocalMulticast)
+	}
+	return prefix, nil
+}
+
+// Validate returns an error if any of the groups is not a multicast prefix.
+func (c MulticastConfig) Validate() error {
+	_, err := c.parseGroups()
+	return err
+}
+
+// NsAddMulticastRoutes routes the multicast groups through the interface
+// ifName in the namespace containerNsPath, so the group memberships and the
+// multicast traffic of the applications use it. The interface must be up.
+func NsAddMulticastRoutes(containerNsPath string, ifName string, config MulticastConfig) error {
+	return nsMulticastRoutes(containerNsPath, ifName, config, func(nh *netlink.Handle, route *netlink.Route) error {
+		if err := nh.RouteAdd(route); err != nil && !errors.Is(err, unix.EEXIST) {
+			return fmt.Errorf("fail to add multicast route %s on interface %s: %w", route.Dst, ifName, netlinkError(err))
+		}
+		return nil
+	})
+}
+
+// NsDeleteMulticastRoutes removes the routes of the multicast groups
+// through the interface ifName in the namespace containerNsPath.
+func NsDeleteMulticastRoutes(containerNsPath string, ifName string, config MulticastConfig) error {
+	return nsMulticastRoutes(containerNsPath, ifName, config, func(nh *netlink.Handle, route *netlink.Route) error {
+		if err := nh.RouteDel(route); err != nil && !errors.Is(err, unix.ESRCH) {
+			return fmt.Errorf("fail to delete multicast route %s on interface %s: %w", route.Dst, ifName, netlinkError(err))
+		}
+		return nil
+	})
+}
+
+func nsMulticastRoutes(containerNsPath string, ifName string, config MulticastConfig, fn func(*netlink.Handle, *netlink.Route) error) error {
+	groups, err := config.parseGroups()
+	if err != nil {
+		return err
+	}
+	containerNs, err := getNsFromPath(containerNsPath)
+	if err != nil {
+		return fmt.Errorf("could not get network namespace from path %s for network device %s : %w", containerNsPath, ifName, err)
+	}
+	defer closeNs(containerNs)
+
+	nhNs, err := newHandleAt(containerNs)
+	if err != nil {
+		return fmt.Errorf("could not get network namespace handle: %w", err)
+	}
+	defer closeHandle(nhNs)
+
+	nsLink, err := nhNs.LinkByName(ifName)
+	if err != nil && !errors.Is(err, netlink.ErrDumpInterrupted) {
+		return fmt.Errorf("link not found for interface %s on namespace %s: %w", ifName, containerNsPath, err)
+	}
+
+	var errs []error
+	for _, group := range groups {
+		route := &netlink.Route{
+			LinkIndex: nsLink.Attrs().Index,
+			Dst:       group,
+			Scope:     netlink.SCOPE_LINK,
+		}
+		if err := fn(nhNs, route); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,78 @@
+package net
+
+import (
+	"net"
+	"testing"
+
+	"github.com/vishvananda/netlink"
+)
+
+func TestMulticastConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		groups  []string
+		wantErr bool
+	}{
+		{name: "ipv4 prefix", groups: []string{"239.1.1.0/24"}},
+		{name: "ipv4 group", groups: []string{"233.252.0.1"}},
+		{name: "whole range", groups: []string{"224.0.0.0/4"}},
+		{name: "ipv6", groups: []string{"ff3e::/32", "ff05::1:3"}},
+		{name: "no groups", wantErr: true},
+		{name: "unicast", groups: []string{"10.0.0.0/8"}, wantErr: true},
+		{name: "wider than the multicast range", groups: []string{"224.0.0.0/3"}, wantErr: true},
+		{name: "ipv6 unicast", groups: []string{"fd00::/64"}, wantErr: true},
+		{name: "local network control", groups: []string{"224.0.0.251"}, wantErr: true},
+		{name: "invalid", groups: []string{"239.1.1"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := (MulticastConfig{Groups: tt.groups}).Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNsMulticastRoutes(t *testing.T) {
+	nsPath, testNS := newTestNamespace(t)
+	ifaceName := "testdummy-mc"
+	newTestDummy(t, ifaceName)
+
+	if _, err := NsAttachNetdev(ifaceName, nsPath, netlink.LinkAttrs{}, nil); err != nil {
+		t.Fatalf("fail to attach netdev to namespace: %v", err)
+	}
+
+	config := MulticastConfig{Groups: []string{"239.1.1.0/24"}}
+	if err := NsAddMulticastRoutes(nsPath, ifaceName, config); err != nil {
+		t.Fatalf("fail to add multicast routes: %v", err)
+	}
+	// adding them again is a no-op
+	if err := NsAddMulticastRoutes(nsPath, ifaceName, config); err != nil {
+		t.Fatalf("fail to add multicast routes again: %v", err)
+	}
+
+	nhNs, err := netlink.NewHandleAt(testNS)
+	if err != nil {
+		t.Fatalf("fail to open netlink handle: %v", err)
+	}
+	defer nhNs.Close()
+	_, dst, _ := net.ParseCIDR("239.1.1.0/24")
+	found, err := nhNs.RouteListFiltered(netlink.FAMILY_V4, &netlink.Route{Dst: dst}, netlink.RT_FILTER_DST)
+	if err != nil {
+		t.Fatalf("fail to list routes: %v", err)
+	}
+	if len(found) != 1 || found[0].Scope != netlink.SCOPE_LINK {
+		t.Errorf("unexpected routes %v", found)
+	}
+
+	if err := NsDeleteMulticastRoutes(nsPath, ifaceName, config); err != nil {
+		t.Fatalf("fail to delete multicast routes: %v", err)
+	}
+	found, err = nhNs.RouteListFiltered(netlink.FAMILY_V4, &netlink.Route{Dst: dst}, netlink.RT_FILTER_DST)
+	if err != nil {
+		t.Fatalf("fail to list routes: %v", err)
+	}
+	if len(found) != 0 {
+		t.Errorf("multicast routes not deleted: %v", found)
+	}
+}
@@ -0,0 +1,327 @@
+package net
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+)
+
+// NetworkConfig is the complete routing configuration of an interface:
+// its addresses, the routes of the main and the custom tables and the policy
+// rules selecting those tables. It is applied as a whole in the order
+// addresses, link up, routes and rules, and removed in reverse.
+type NetworkConfig struct {
+	// Addresses are the prefixes configured on the interface, e.g. 192.168.5.10/24.
+	Addresses []string `json:"addresses,omitempty"`
+	// SecondaryAddresses are additional IPv4 prefixes, e.g. virtual IPs,
+	// added as secondaries of the address with the same subnet so they are
+	// not the preferred source of the traffic of the subnet.
+	SecondaryAddresses []string `json:"secondaryAddresses,omitempty"`
+	// Routes are installed in the main table.
+	Routes []RouteConfig `json:"routes,omitempty"`
+	// Tables are the custom routing tables.
+	Tables []RouteTable `json:"tables,omitempty"`
+	// Rules are the routing policy rules.
+	Rules []RuleConfig `json:"rules,omitempty"`
+}
+
+// RouteTable is a custom routing table.
+type RouteTable struct {
+	// ID is the table number, the reserved tables local, main and default
+	// and the unspecified 0 cannot be used.
+	ID int `json:"id"`
+	// Routes are installed in the table.
+	Routes []RouteConfig `json:"routes"`
+}
+
+// RuleConfig is a routing policy rule.
+type RuleConfig struct {
+	// Priority orders the rule evaluation, it must be unique.
+	Priority int `json:"priority"`
+	// From is the optional source prefix the rule matches.
+	From string `json:"from,omitempty"`
+	// To is the optional destination prefix the rule matches.
+	To string `json:"to,omitempty"`
+	// Table is the table looked up by the matching traffic, a custom
+	// table or the main table 254.
+	Table int `json:"table"`
+}
+
+// parsedNetworkConfig is the validated form of a NetworkConfig.
+type parsedNetworkConfig struct {
+	addresses   []*net.IPNet
+	secondaries []*net.IPNet
+	// routes of all the tables, in order
+	routes []*netlink.Route
+	rules  []*netlink.Rule
+}
+
+// parse validates the configuration as a whole, the routes sources must be
+// interface addresses and the rules must reference defined tables.
+func (c NetworkConfig) parse() (*parsedNetworkConfig, error) {
+	config := &parsedNetworkConfig{}
+	for _, address := range c.Addresses {
+		ip, ipnet, err := net.ParseCIDR(address)
+		if err != nil {
+			return nil, fmt.Errorf("invalid address %q: %w", address, err)
+		}
+		ipnet.IP = ip
+		for _, other := range config.addresses {
+			if other.IP.Equal(ip) {
+				return nil, fmt.Errorf("duplicate address %s", address)
+			}
+		}
+		config.addresses = append(config.addresses, ipnet)
+	}
+	for _, address := range c.SecondaryAddresses {
+		ip, ipnet, err := net.ParseCIDR(address)
+		if err != nil {
+			return nil, fmt.Errorf("invalid secondary address %q: %w", address, err)
+		}
+		if ip.To4() == nil {
+			return nil, fmt.Errorf("invalid secondary address %s, IPv6 addresses have no primary", address)
+		}
+		ipnet.IP = ip
+		if config.hasAddress(ip) {
+			return nil, fmt.Errorf("duplicate address %s", address)
+		}
+		// the kernel only makes secondary an address of the subnet of a primary
+		if !slices.ContainsFunc(config.addresses, func(primary *net.IPNet) bool {
+			return primary.IP.To4() != nil && primary.Contains(ip) && slices.Equal(primary.Mask, ipnet.Mask)
+		}) {
+			return nil, fmt.Errorf("secondary address %s has no primary address with the same subnet", address)
+		}
+		config.secondaries = append(config.secondaries, ipnet)
+	}
+
+	addRoutes := func(table int, routes []RouteConfig) error {
+		for _, r := range routes {
+			route, err := r.parse()
+			if err != nil {
+				return err
+			}
+			if route.src != nil && !config.hasAddress(route.src) {
+				return fmt.Errorf("source %s of route %s is not an address of the interface", route.src, r.Dst)
+			}
+			nlRoute := &netlink.Route{
+				Dst:   route.dst,
+				Gw:    route.gw,
+				Src:   route.src,
+				Table: table,
+				Scope: netlink.SCOPE_UNIVERSE,
+			}
+			if route.gw == nil {
+				nlRoute.Scope = netlink.SCOPE_LINK
+			}
+			config.routes = append(config.routes, nlRoute)
+		}
+		return nil
+	}
+	if err := addRoutes(unix.RT_TABLE_MAIN, c.Routes); err != nil {
+		return nil, err
+	}
+
+	tables := map[int]bool{unix.RT_TABLE_MAIN: true}
+	for _, table := range c.Tables {
+		if err := ValidateTableID(table.ID); err != nil {
+			return nil, err
+		}
+		if tables[table.ID] {
+			return nil, fmt.Errorf("duplicate table %d", table.ID)
+		}
+		tables[table.ID] = true
+		if len(table.Routes) == 0 {
+			return nil, fmt.Errorf("table %d has no routes", table.ID)
+		}
+		if err := addRoutes(table.ID, table.Routes); err != nil {
+			return nil, fmt.Errorf("invalid route in table %d: %w", table.ID, err)
+		}
+	}
+
+	priorities := map[int]bool{}
+	for _, r := range c.Rules {
+		if r.Priority <= 0 || r.Priority >= 32766 {
+			// 0, 32766 and 32767 are the kernel rules for the local, main and default tables
+			return nil, fmt.Errorf("invalid rule priority %d, must be between 1 and 32765", r.Priority)
+		}
+		if priorities[r.Priority] {
+			return nil, fmt.Errorf("duplicate rule priority %d", r.Priority)
+		}
+		priorities[r.Priority] = true
+		if !tables[r.Table] {
+			return nil, fmt.Errorf("rule %d references undefined table %d", r.Priority, r.Table)
+		}
+		rule := netlink.NewRule()
+		rule.Priority = r.Priority
+		rule.Table = r.Table
+		family := 0
+		for _, prefix := range []struct {
+			value string
+			dst   **net.IPNet
+		}{{r.From, &rule.Src}, {r.To, &rule.Dst}} {
+			if prefix.value == "" {
+				continue
+			}
+			_, ipnet, err := net.ParseCIDR(prefix.value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid prefix %q in rule %d: %w", prefix.value, r.Priority, err)
+			}
+			f := netlink.FAMILY_V6
+			if ipnet.IP.To4() != nil {
+				f = netlink.FAMILY_V4
+			}
+			if family != 0 && family != f {
+				return nil, fmt.Errorf("rule %d mixes IP families", r.Priority)
+			}
+			family = f
+			*prefix.dst = ipnet
+		}
+		if family == 0 {
+			return nil, fmt.Errorf("rule %d must match a source or a destination", r.Priority)
+		}
+		rule.Family = family
+		config.rules = append(config.rules, rule)
+	}
+	return config, nil
+}
+
+func (c *parsedNetworkConfig) hasAddress(ip net.IP) bool {
+	for _, address := range slices.Concat(c.addresses, c.secondaries) {
+		if address.IP.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate returns an error if the network configuration is not valid.
+func (c NetworkConfig) Validate() error {
+	_, err := c.parse()
+	return err
+}
+
+// NsApplyNetworkConfig configures the interface ifName in the namespace
+// containerNsPath with the addresses, brings it up and installs the routes
+// and the rules. If any step fails the applied ones are rolled back.
+func NsApplyNetworkConfig(containerNsPath string, ifName string, config NetworkConfig) (err error) {
+	parsed, err := config.parse()
+	if err != nil {
+		return err
+	}
+	containerNs, err := getNsFromPath(containerNsPath)
+	if err != nil {
+		return fmt.Errorf("could not get network namespace from path %s for network device %s : %w", containerNsPath, ifName, err)
+	}
+	defer closeNs(containerNs)
+
+	nhNs, err := newHandleAt(containerNs)
+	if err != nil {
+		return fmt.Errorf("could not get network namespace handle: %w", err)
+	}
+	defer closeHandle(nhNs)
+
+	nsLink, err := nhNs.LinkByName(ifName)
+	if err != nil && !errors.Is(err, netlink.ErrDumpInterrupted) {
+		return fmt.Errorf("link not found for interface %s on namespace %s: %w", ifName, containerNsPath, err)
+	}
+
+	var undo []func()
+	defer func() {
+		if err == nil {
+			return
+		}
+		for i := len(undo) - 1; i >= 0; i-- {
+			undo[i]()
+		}
+	}()
+
+	for _, address := range parsed.addresses {
+		addr := &netlink.Addr{IPNet: address}
+		if err := nhNs.AddrAdd(nsLink, addr); err != nil && !errors.Is(err, unix.EEXIST) {
+			return fmt.Errorf("fail to set up address %s on interface %s on namespace %s: %w", address, ifName, containerNsPath, netlinkError(err))
+		}
+		undo = append(undo, func() { _ = nhNs.AddrDel(nsLink, addr) })
+	}
+	for _, address := range parsed.secondaries {
+		addr := &netlink.Addr{IPNet: address, Flags: unix.IFA_F_SECONDARY}
+		if err := nhNs.AddrAdd(nsLink, addr); err != nil && !errors.Is(err, unix.EEXIST) {
+			return fmt.Errorf("fail to set up secondary address %s on interface %s on namespace %s: %w", address, ifName, containerNsPath, netlinkError(err))
+		}
+		undo = append(undo, func() { _ = nhNs.AddrDel(nsLink, addr) })
+	}
+
+	if err := nhNs.LinkSetUp(nsLink); err != nil {
+		return fmt.Errorf("fail to set up interface %s on namespace %s: %w", ifName, containerNsPath, netlinkError(err))
+	}
+
+	for _, route := range parsed.routes {
+		route.LinkIndex = nsLink.Attrs().Index
+		if err := nhNs.RouteAdd(route); err != nil && !errors.Is(err, unix.EEXIST) {
+			return fmt.Errorf("fail to add route %s to table %d on interface %s on namespace %s: %w", route.Dst, route.Table, ifName, containerNsPath, netlinkError(err))
+		}
+		undo = append(undo, func() { _ = nhNs.RouteDel(route) })
+	}
+
+	for _, rule := range parsed.rules {
+		if err := nhNs.RuleAdd(rule); err != nil && !errors.Is(err, unix.EEXIST) {
+			return fmt.Errorf("fail to add rule %d on namespace %s: %w", rule.Priority, containerNsPath, netlinkError(err))
+		}
+		undo = append(undo, func() { _ = nhNs.RuleDel(rule) })
+	}
+	return nil
+}
+
+// NsRemoveNetworkConfig removes the rules, routes and addresses applied by
+// NsApplyNetworkConfig, in reverse order. Missing objects are ignored.
+func NsRemoveNetworkConfig(containerNsPath string, ifName string, config NetworkConfig) error {
+	parsed, err := config.parse()
+	if err != nil {
+		return err
+	}
+	containerNs, err := getNsFromPath(containerNsPath)
+	if err != nil {
+		return fmt.Errorf("could not get network namespace from path %s for network device %s : %w", containerNsPath, ifName, err)
+	}
+	defer closeNs(containerNs)
+
+	nhNs, err := newHandleAt(containerNs)
+	if err != nil {
+		return fmt.Errorf("could not get network namespace handle: %w", err)
+	}
+	defer closeHandle(nhNs)
+
+	nsLink, err := nhNs.LinkByName(ifName)
+	if err != nil && !errors.Is(err, netlink.ErrDumpInterrupted) {
+		return fmt.Errorf("link not found for interface %s on namespace %s: %w", ifName, containerNsPath, err)
+	}
+
+	var errs []error
+	for i := len(parsed.rules) - 1; i >= 0; i-- {
+		if err := nhNs.RuleDel(parsed.rules[i]); err != nil && !errors.Is(err, unix.ENOENT) {
+			errs = append(errs, fmt.Errorf("fail to remove rule %d: %w", parsed.rules[i].Priority, netlinkError(err)))
+		}
+	}
+	for i := len(parsed.routes) - 1; i >= 0; i-- {
+		route := parsed.routes[i]
+		route.LinkIndex = nsLink.Attrs().Index
+		if err := nhNs.RouteDel(route); err != nil && !errors.Is(err, unix.ESRCH) {
+			errs = append(errs, fmt.Errorf("fail to remove route %s from table %d: %w", route.Dst, route.Table, netlinkError(err)))
+		}
+	}
+	// the secondaries are removed with their primary otherwise
+	for i := len(parsed.secondaries) - 1; i >= 0; i-- {
+		if err := nhNs.AddrDel(nsLink, &netlink.Addr{IPNet: parsed.secondaries[i]}); err != nil && !errors.Is(err, unix.EADDRNOTAVAIL) {
+			errs = append(errs, fmt.Errorf("fail to remove secondary address %s: %w", parsed.secondaries[i], netlinkError(err)))
+		}
+	}
+	for i := len(parsed.addresses) - 1; i >= 0; i-- {
+		if err := nhNs.AddrDel(nsLink, &netlink.Addr{IPNet: parsed.addresses[i]}); err != nil && !errors.Is(err, unix.EADDRNOTAVAIL) {
+			errs = append(errs, fmt.Errorf("fail to remove address %s: %w", parsed.addresses[i], netlinkError(err)))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,170 @@
+package net
+
+import (
+	"net"
+	"testing"
+
+	"github.com/vishvananda/netlink"
+)
+
+func TestNetworkConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  NetworkConfig
+		wantErr bool
+	}{
+		{
+			name: "complete",
+			config: NetworkConfig{
+				Addresses: []string{"192.168.5.10/24", "fd00::10/64"},
+				Routes:    []RouteConfig{{Dst: "10.0.0.0/8", Gw: "192.168.5.1"}},
+				Tables:    []RouteTable{{ID: 100, Routes: []RouteConfig{{Dst: "0.0.0.0/0", Gw: "192.168.5.1", Src: "192.168.5.10"}}}},
+				Rules:     []RuleConfig{{Priority: 100, From: "192.168.5.10/32", Table: 100}},
+			},
+		},
+		{name: "empty", config: NetworkConfig{}},
+		{name: "invalid address", config: NetworkConfig{Addresses: []string{"192.168.5.10"}}, wantErr: true},
+		{name: "duplicate address", config: NetworkConfig{Addresses: []string{"192.168.5.10/24", "192.168.5.10/32"}}, wantErr: true},
+		{
+			name: "source not on the interface",
+			config: NetworkConfig{
+				Addresses: []string{"192.168.5.10/24"},
+				Routes:    []RouteConfig{{Dst: "10.0.0.0/8", Src: "192.168.5.11"}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "secondary address",
+			config: NetworkConfig{
+				Addresses:          []string{"192.168.5.10/24"},
+				SecondaryAddresses: []string{"192.168.5.100/24"},
+				Routes:             []RouteConfig{{Dst: "10.0.0.0/8", Gw: "192.168.5.1", Src: "192.168.5.100"}},
+			},
+		},
+		{name: "secondary address without primary", config: NetworkConfig{SecondaryAddresses: []string{"192.168.5.100/24"}}, wantErr: true},
+		{
+			name:    "secondary address outside of the primary subnet",
+			config:  NetworkConfig{Addresses: []string{"192.168.5.10/24"}, SecondaryAddresses: []string{"192.168.6.100/24"}},
+			wantErr: true,
+		},
+		{
+			name:    "secondary address with another prefix length",
+			config:  NetworkConfig{Addresses: []string{"192.168.5.10/24"}, SecondaryAddresses: []string{"192.168.5.100/32"}},
+			wantErr: true,
+		},
+		{
+			name:    "secondary address duplicating the primary",
+			config:  NetworkConfig{Addresses: []string{"192.168.5.10/24"}, SecondaryAddresses: []string{"192.168.5.10/24"}},
+			wantErr: true,
+		},
+		{
+			name:    "secondary IPv6 address",
+			config:  NetworkConfig{Addresses: []string{"fd00::10/64"}, SecondaryAddresses: []string{"fd00::100/64"}},
+			wantErr: true,
+		},
+		{name: "reserved table", config: NetworkConfig{Tables: []RouteTable{{ID: 254, Routes: []RouteConfig{{Dst: "10.0.0.0/8"}}}}}, wantErr: true},
+		{
+			name: "duplicate table",
+			config: NetworkConfig{Tables: []RouteTable{
+				{ID: 100, Routes: []RouteConfig{{Dst: "10.0.0.0/8"}}},
+				{ID: 100, Routes: []RouteConfig{{Dst: "10.0.0.0/8"}}},
+			}},
+			wantErr: true,
+		},
+		{name: "empty table", config: NetworkConfig{Tables: []RouteTable{{ID: 100}}}, wantErr: true},
+		{name: "undefined table", config: NetworkConfig{Rules: []RuleConfig{{Priority: 100, From: "10.0.0.0/8", Table: 100}}}, wantErr: true},
+		{name: "main table rule", config: NetworkConfig{Rules: []RuleConfig{{Priority: 100, To: "10.0.0.0/8", Table: 254}}}},
+		{name: "reserved priority", config: NetworkConfig{Rules: []RuleConfig{{Priority: 32766, To: "10.0.0.0/8", Table: 254}}}, wantErr: true},
+		{
+			name: "duplicate priority",
+			config: NetworkConfig{Rules: []RuleConfig{
+				{Priority: 100, To: "10.0.0.0/8", Table: 254},
+				{Priority: 100, To: "172.16.0.0/12", Table: 254},
+			}},
+			wantErr: true,
+		},
+		{name: "rule without selector", config: NetworkConfig{Rules: []RuleConfig{{Priority: 100, Table: 254}}}, wantErr: true},
+		{name: "rule family mismatch", config: NetworkConfig{Rules: []RuleConfig{{Priority: 100, From: "10.0.0.0/8", To: "fd00::/64", Table: 254}}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.config.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNsApplyNetworkConfig(t *testing.T) {
+	nsPath, testNS := newTestNamespace(t)
+	ifaceName := "testdummy-nc"
+	newTestDummy(t, ifaceName)
+
+	if _, err := NsAttachNetdev(ifaceName, nsPath, netlink.LinkAttrs{}, nil, WithLinkDown()); err != nil {
+		t.Fatalf("fail to attach netdev to namespace: %v", err)
+	}
+
+	config := NetworkConfig{
+		Addresses:          []string{"192.168.5.10/24"},
+		SecondaryAddresses: []string{"192.168.5.100/24"},
+		Routes:             []RouteConfig{{Dst: "10.0.0.0/8", Gw: "192.168.5.1"}},
+		Tables:             []RouteTable{{ID: 100, Routes: []RouteConfig{{Dst: "0.0.0.0/0", Gw: "192.168.5.1", Src: "192.168.5.10"}}}},
+		Rules:              []RuleConfig{{Priority: 100, From: "192.168.5.10/32", Table: 100}},
+	}
+	if err := NsApplyNetworkConfig(nsPath, ifaceName, config); err != nil {
+		t.Fatalf("fail to apply network config: %v", err)
+	}
+
+	nhNs, err := netlink.NewHandleAt(testNS)
+	if err != nil {
+		t.Fatalf("fail to open netlink handle: %v", err)
+	}
+	defer nhNs.Close()
+
+	link, err := nhNs.LinkByName(ifaceName)
+	if err != nil {
+		t.Fatalf("fail to get link: %v", err)
+	}
+	if link.Attrs().Flags&net.FlagUp == 0 {
+		t.Errorf("interface %s is not up", ifaceName)
+	}
+	info, err := NsLinkInfo(nsPath, ifaceName)
+	if err != nil {
+		t.Fatalf("fail to get link info: %v", err)
+	}
+	if len(info.SecondaryAddresses) != 1 || info.SecondaryAddresses[0] != "192.168.5.100/24" {
+		t.Errorf("expected the secondary address 192.168.5.100/24, got %v of %v", info.SecondaryAddresses, info.Addresses)
+	}
+	routes, err := nhNs.RouteListFiltered(netlink.FAMILY_V4, &netlink.Route{Table: 100}, netlink.RT_FILTER_TABLE)
+	if err != nil {
+		t.Fatalf("fail to list routes: %v", err)
+	}
+	if len(routes) != 1 || !routes[0].Gw.Equal(net.ParseIP("192.168.5.1")) {
+		t.Errorf("unexpected routes in table 100 %v", routes)
+	}
+	rules, err := nhNs.RuleListFiltered(netlink.FAMILY_V4, &netlink.Rule{Priority: 100}, netlink.RT_FILTER_PRIORITY)
+	if err != nil {
+		t.Fatalf("fail to list rules: %v", err)
+	}
+	if len(rules) != 1 || rules[0].Table != 100 {
+		t.Errorf("unexpected rules %v", rules)
+	}
+
+	if err := NsRemoveNetworkConfig(nsPath, ifaceName, config); err != nil {
+		t.Fatalf("fail to remove network config: %v", err)
+	}
+	rules, err = nhNs.RuleListFiltered(netlink.FAMILY_V4, &netlink.Rule{Priority: 100}, netlink.RT_FILTER_PRIORITY)
+	if err != nil {
+		t.Fatalf("fail to list rules: %v", err)
+	}
+	if len(rules) != 0 {
+		t.Errorf("rules not removed %v", rules)
+	}
+	addrs, err := nhNs.AddrList(link, netlink.FAMILY_V4)
+	if err != nil {
+		t.Fatalf("fail to list addresses: %v", err)
+	}
+	if len(addrs) != 0 {
+		t.Errorf("addresses not removed %v", addrs)
+	}
+}
@@ -0,0 +1,113 @@
+package net
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"time"
+
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netns"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// DefaultNamespaceRetries is the number of times opening the network
+	// namespace of a pod and a netlink handle in it is retried while the
+	// namespace is not ready yet.
+	DefaultNamespaceRetries = 5
+	// namespaceBackoff is the initial wait between retries, it doubles with each attempt.
+	namespaceBackoff = 50 * time.Millisecond
+)
+
+var (
+	// ErrNamespaceGone is returned when the network namespace path does not
+	// exist, the pod sandbox was removed and retrying will not help.
+	ErrNamespaceGone = errors.New("network namespace gone")
+	// errNamespaceNotReady is returned while the runtime is still setting up
+	// the network namespace, e.g. the path exists but it is not bind mounted yet.
+	errNamespaceNotReady = errors.New("network namespace not ready")
+)
+
+// openNamespace opens the network namespace at path, retrying up to retries
+// times with an exponential backoff while it is not ready yet. A namespace
+// that is gone fails right away with ErrNamespaceGone.
+func openNamespace(path string, retries int) (netns.NsHandle, error) {
+	return openNamespaceWith(getNsFromPath, path, retries)
+}
+
+// openNamespaceWith is openNamespace opening the namespace with getFromPath.
+func openNamespaceWith(getFromPath func(path string) (netns.NsHandle, error), path string, retries int) (netns.NsHandle, error) {
+	var ns netns.NsHandle
+	err := retryNamespace(retries, func() error {
+		var err error
+		ns, err = tryOpenNamespace(getFromPath, path)
+		return err
+	})
+	if err != nil {
+		return netns.None(), fmt.Errorf("could not get network namespace from path %s: %w", path, err)
+	}
+	return ns, nil
+}
+
+func tryOpenNamespace(getFromPath func(path string) (netns.NsHandle, error), path string) (netns.NsHandle, error) {
+	ns, err := getFromPath(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return netns.None(), fmt.Errorf("%w: %w", ErrNamespaceGone, err)
+	}
+	if err != nil {
+		if isTransient(err) {
+			return netns.None(), fmt.Errorf("%w: %w", errNamespaceNotReady, err)
+		}
+		return netns.None(), err
+	}
+	// the runtime creates the file before it bind mounts the namespace on it
+	var stat unix.Statfs_t
+	if err := unix.Fstatfs(int(ns), &stat); err != nil {
+		closeNs(ns)
+		return netns.None(), err
+	}
+	if stat.Type != unix.NSFS_MAGIC {
+		closeNs(ns)
+		return netns.None(), fmt.Errorf("%w: %s is not a namespace yet", errNamespaceNotReady, path)
+	}
+	return ns, nil
+}
+
+// newNamespaceHandle creates a netlink handle in the namespace ns, retrying
+// up to retries times on transient errors.
+func newNamespaceHandle(ns netns.NsHandle, retries int) (*netlink.Handle, error) {
+	return newNamespaceHandleWith(newHandleAt, ns, retries)
+}
+
+// newNamespaceHandleWith is newNamespaceHandle creating the handle with
+// newHandle.
+func newNamespaceHandleWith(newHandle func(ns netns.NsHandle) (*netlink.Handle, error), ns netns.NsHandle, retries int) (*netlink.Handle, error) {
+	var handle *netlink.Handle
+	err := retryNamespace(retries, func() error {
+		var err error
+		handle, err = newHandle(ns)
+		if err != nil && isTransient(err) {
+			return fmt.Errorf("%w: %w", errNamespaceNotReady, err)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not get network namespace handle: %w", err)
+	}
+	return handle, nil
+}
+
+// retryNamespace runs fn retrying up to retries times while the namespace
+// is not ready, with an exponential backoff.
+func retryNamespace(retries int, fn func() error) error {
+	backoff := namespaceBackoff
+	for attempt := 0; ; attempt++ {
+		err := fn()
+		if err == nil || !errors.Is(err, errNamespaceNotReady) || attempt >= retries {
+			return err
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
@@ -0,0 +1,125 @@
+package net
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netns"
+	"golang.org/x/sys/unix"
+)
+
+func TestOpenNamespace(t *testing.T) {
+	// the runtime creates the file of the namespace before bind mounting it
+	pending := filepath.Join(t.TempDir(), "netns")
+	if err := os.WriteFile(pending, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		// failures are the attempts that open the namespace before it is ready
+		failures  int
+		openErr   error
+		path      string
+		retries   int
+		wantCalls int
+		wantErr   error
+	}{
+		{name: "ready", path: "/proc/self/ns/net", retries: 3, wantCalls: 1},
+		{name: "not mounted yet", failures: 2, path: "/proc/self/ns/net", retries: 3, wantCalls: 3},
+		{name: "never mounted", failures: 10, path: "/proc/self/ns/net", retries: 2, wantCalls: 3, wantErr: errNamespaceNotReady},
+		{name: "transient open error", failures: 1, openErr: unix.EINTR, path: "/proc/self/ns/net", retries: 3, wantCalls: 2},
+		{name: "retries disabled", failures: 1, path: "/proc/self/ns/net", wantCalls: 1, wantErr: errNamespaceNotReady},
+		{name: "gone", path: "/proc/self/ns/missing", retries: 3, wantCalls: 1, wantErr: ErrNamespaceGone},
+		{name: "permanent open error", failures: 10, openErr: unix.EACCES, path: "/proc/self/ns/net", retries: 3, wantCalls: 1, wantErr: unix.EACCES},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			getFromPath := func(path string) (netns.NsHandle, error) {
+				calls++
+				if calls > tt.failures {
+					return getNsFromPath(path)
+				}
+				if tt.openErr != nil {
+					return netns.None(), tt.openErr
+				}
+				return getNsFromPath(pending)
+			}
+
+			namespaces, sockets := OpenHandles()
+			ns, err := openNamespaceWith(getFromPath, tt.path, tt.retries)
+			if err == nil {
+				closeNs(ns)
+			}
+			if tt.wantErr == nil && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("expected %d attempts, got %d", tt.wantCalls, calls)
+			}
+			// the files opened before the namespace was ready are closed
+			assertHandlesBalanced(t, namespaces, sockets)
+		})
+	}
+}
+
+func TestNewNamespaceHandle(t *testing.T) {
+	tests := []struct {
+		name      string
+		errs      []error
+		retries   int
+		wantCalls int
+		wantErr   error
+	}{
+		{name: "created", retries: 3, wantCalls: 1},
+		{name: "transient", errs: []error{unix.EAGAIN, unix.EBUSY}, retries: 3, wantCalls: 3},
+		{name: "too many transient", errs: []error{unix.EAGAIN, unix.EAGAIN, unix.EAGAIN}, retries: 1, wantCalls: 2, wantErr: unix.EAGAIN},
+		{name: "permanent", errs: []error{unix.EPERM}, retries: 3, wantCalls: 1, wantErr: unix.EPERM},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			newHandle := func(ns netns.NsHandle) (*netlink.Handle, error) {
+				calls++
+				if calls <= len(tt.errs) {
+					return nil, tt.errs[calls-1]
+				}
+				return newHandleAt(ns)
+			}
+
+			ns, err := openNamespace("/proc/self/ns/net", 0)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			defer closeNs(ns)
+			namespaces, sockets := OpenHandles()
+			handle, err := newNamespaceHandleWith(newHandle, ns, tt.retries)
+			if err == nil {
+				closeHandle(handle)
+			}
+			if tt.wantErr == nil && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("expected %d attempts, got %d", tt.wantCalls, calls)
+			}
+			assertHandlesBalanced(t, namespaces, sockets)
+		})
+	}
+}
+
+func TestNsDetachNetdev_namespaceGone(t *testing.T) {
+	err := NsDetachNetdev("/run/netns/knd-missing", "eth1", "eth1", WithDetachNamespaceRetries(3))
+	if !errors.Is(err, ErrNamespaceGone) {
+		t.Errorf("expected %v, got %v", ErrNamespaceGone, err)
+	}
+}
@@ -0,0 +1,68 @@
+package net
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/vishvananda/netlink"
+)
+
+// ownerAliasPrefix marks the host interfaces moved into a pod by a driver.
+// The interface alias is set to the prefix followed by the owner, usually
+// the driver name, so other drivers or CNI plugins managing the same
+// interfaces can tell they are in use.
+const ownerAliasPrefix = "knd-owner:"
+
+// ErrDeviceOwned is returned when a device is tagged by a different owner.
+var ErrDeviceOwned = errors.New("device owned by a different driver")
+
+// OwnerAlias returns the interface alias that marks a device as in use by owner.
+func OwnerAlias(owner string) string {
+	return ownerAliasPrefix + owner
+}
+
+// aliasOwner returns the owner encoded in an interface alias.
+func aliasOwner(alias string) (string, bool) {
+	owner, ok := strings.CutPrefix(alias, ownerAliasPrefix)
+	if !ok || owner == "" {
+		return "", false
+	}
+	return owner, true
+}
+
+// checkOwner returns ErrDeviceOwned if the alias tags the device with an
+// owner other than owner. Untagged devices and devices with an unrelated
+// alias are not owned by anyone.
+func checkOwner(ifName, alias, owner string) error {
+	current, ok := aliasOwner(alias)
+	if !ok || current == owner {
+		return nil
+	}
+	return fmt.Errorf("interface %s is tagged by %q: %w", ifName, current, ErrDeviceOwned)
+}
+
+// clearOwner removes the ownership marker of the link, if any, using the
+// setAlias function of the handle of the link namespace.
+func clearOwner(link netlink.Link, setAlias func(netlink.Link, string) error) error {
+	if _, ok := aliasOwner(link.Attrs().Alias); !ok {
+		return nil
+	}
+	if err := setAlias(link, ""); err != nil {
+		return fmt.Errorf("failed to remove the owner of %q: %w", link.Attrs().Name, netlinkError(err))
+	}
+	return nil
+}
+
+// clearNameAlias removes the alias of a link back on the host with the name
+// it holds, set when the device was renamed in the pod, using the setAlias
+// function of the handle of the link namespace.
+func clearNameAlias(link netlink.Link, setAlias func(netlink.Link, string) error) error {
+	if link.Attrs().Alias == "" || link.Attrs().Alias != link.Attrs().Name {
+		return nil
+	}
+	if err := setAlias(link, ""); err != nil {
+		return fmt.Errorf("failed to remove the alias of %q: %w", link.Attrs().Name, netlinkError(err))
+	}
+	return nil
+}
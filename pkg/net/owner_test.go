@@ -0,0 +1,62 @@
+package net
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/vishvananda/netlink"
+)
+
+func Test_checkOwner(t *testing.T) {
+	tests := []struct {
+		name    string
+		alias   string
+		wantErr bool
+	}{
+		{name: "untagged", alias: ""},
+		{name: "unrelated alias", alias: "uplink0"},
+		{name: "same owner", alias: OwnerAlias("hostdevice.k8s.io")},
+		{name: "empty owner", alias: "knd-owner:"},
+		{name: "other owner", alias: OwnerAlias("sriov.example.com"), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkOwner("eth1", tt.alias, "hostdevice.k8s.io")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("checkOwner() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr && !errors.Is(err, ErrDeviceOwned) {
+				t.Errorf("expected ErrDeviceOwned, got %v", err)
+			}
+		})
+	}
+}
+
+func Test_clearNameAlias(t *testing.T) {
+	tests := []struct {
+		name    string
+		alias   string
+		cleared bool
+	}{
+		{name: "no alias", alias: ""},
+		{name: "host name", alias: "eth1", cleared: true},
+		{name: "other alias", alias: "uplink0"},
+		{name: "owner", alias: OwnerAlias("hostdevice.k8s.io")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			link := &netlink.Dummy{LinkAttrs: netlink.LinkAttrs{Name: "eth1", Alias: tt.alias}}
+			cleared := false
+			err := clearNameAlias(link, func(l netlink.Link, alias string) error {
+				cleared = alias == ""
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if cleared != tt.cleared {
+				t.Errorf("expected cleared %v, got %v", tt.cleared, cleared)
+			}
+		})
+	}
+}
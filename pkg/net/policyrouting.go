@@ -0,0 +1,257 @@
+package net
+
+import (
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+)
+
+// ValidateTableID returns an error if the routing table cannot be used for
+// the routes of an interface, the reserved tables local, main and default
+// and the unspecified 0 cannot be used.
+func ValidateTableID(tableID int) error {
+	switch tableID {
+	case unix.RT_TABLE_UNSPEC, unix.RT_TABLE_DEFAULT, unix.RT_TABLE_MAIN, unix.RT_TABLE_LOCAL:
+		return fmt.Errorf("table %d is reserved", tableID)
+	}
+	if tableID < 0 {
+		return fmt.Errorf("invalid table %d", tableID)
+	}
+	return nil
+}
+
+// FwMark matches the packets whose firewall mark, set by the application
+// with SO_MARK or by a firewall rule, masked with Mask is Mark.
+type FwMark struct {
+	Mark uint32 `json:"mark"`
+	// Mask selects the bits of the mark compared, all of them if 0.
+	Mask uint32 `json:"mask,omitempty"`
+}
+
+// Validate returns an error if the mark matches the unmarked packets or has
+// bits outside of the mask.
+func (m FwMark) Validate() error {
+	if m.Mark == 0 {
+		return fmt.Errorf("mark 0 matches the unmarked packets")
+	}
+	if m.Mark&^m.mask() != 0 {
+		return fmt.Errorf("mark %#x has bits outside of mask %#x", m.Mark, m.Mask)
+	}
+	return nil
+}
+
+func (m FwMark) mask() uint32 {
+	if m.Mask == 0 {
+		return 0xffffffff
+	}
+	return m.Mask
+}
+
+// PolicyRoutingOption customizes the rules added by NsAddPolicyRouting.
+type PolicyRoutingOption func(*policyRoutingOptions)
+
+type policyRoutingOptions struct {
+	marks []FwMark
+}
+
+// WithFwMark also looks up the table for the packets with the firewall mark,
+// for the families of the source addresses.
+func WithFwMark(mark FwMark) PolicyRoutingOption {
+	return func(o *policyRoutingOptions) {
+		o.marks = append(o.marks, mark)
+	}
+}
+
+// NsAddPolicyRouting makes the traffic with any of the source addresses
+// srcIPs leave through the interface ifName in the namespace containerNsPath,
+// so the replies of the connections received on a secondary interface do not
+// follow the default route of the pod. The routes of the interface in the
+// main table are copied to the table tableID, with a default route through
+// the interface for the families without one, and a rule from each source
+// looks up the table, as well as a rule for each firewall mark of the
+// options. If any step fails the applied ones are rolled back.
+func NsAddPolicyRouting(containerNsPath string, ifName string, srcIPs []net.IP, tableID int, opts ...PolicyRoutingOption) (err error) {
+	var options policyRoutingOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+	if err := ValidateTableID(tableID); err != nil {
+		return err
+	}
+	if len(srcIPs) == 0 {
+		return fmt.Errorf("no source addresses for the policy routing of interface %s", ifName)
+	}
+	for _, mark := range options.marks {
+		if err := mark.Validate(); err != nil {
+			return err
+		}
+	}
+	containerNs, err := getNsFromPath(containerNsPath)
+	if err != nil {
+		return fmt.Errorf("could not get network namespace from path %s for network device %s : %w", containerNsPath, ifName, err)
+	}
+	defer closeNs(containerNs)
+
+	nhNs, err := newHandleAt(containerNs)
+	if err != nil {
+		return fmt.Errorf("could not get network namespace handle: %w", err)
+	}
+	defer closeHandle(nhNs)
+
+	nsLink, err := nhNs.LinkByName(ifName)
+	if err != nil && !errors.Is(err, netlink.ErrDumpInterrupted) {
+		return fmt.Errorf("link not found for interface %s on namespace %s: %w", ifName, containerNsPath, err)
+	}
+	index := nsLink.Attrs().Index
+
+	families := map[int]bool{}
+	for _, ip := range srcIPs {
+		families[ipFamily(ip)] = true
+	}
+	current, err := nhNs.RouteListFiltered(netlink.FAMILY_ALL, &netlink.Route{LinkIndex: index, Table: unix.RT_TABLE_MAIN}, netlink.RT_FILTER_OIF|netlink.RT_FILTER_TABLE)
+	if err != nil && !errors.Is(err, netlink.ErrDumpInterrupted) {
+		return fmt.Errorf("fail to list routes of interface %s on namespace %s: %w", ifName, containerNsPath, netlinkError(err))
+	}
+	var routes []*netlink.Route
+	hasDefault := map[int]bool{}
+	for _, r := range current {
+		if !families[r.Family] {
+			continue
+		}
+		if r.Dst == nil || isDefaultRoute(r.Dst) {
+			hasDefault[r.Family] = true
+		}
+		routes = append(routes, &netlink.Route{
+			LinkIndex: index,
+			Family:    r.Family,
+			Dst:       r.Dst,
+			Gw:        r.Gw,
+			Src:       r.Src,
+			Scope:     r.Scope,
+			Priority:  r.Priority,
+			Table:     tableID,
+		})
+	}
+	for family := range families {
+		if hasDefault[family] {
+			continue
+		}
+		dst := &net.IPNet{IP: net.IPv6zero, Mask: net.CIDRMask(0, 8*net.IPv6len)}
+		if family == netlink.FAMILY_V4 {
+			dst = &net.IPNet{IP: net.IPv4zero.To4(), Mask: net.CIDRMask(0, 8*net.IPv4len)}
+		}
+		routes = append(routes, &netlink.Route{
+			LinkIndex: index,
+			Family:    family,
+			Dst:       dst,
+			Scope:     netlink.SCOPE_LINK,
+			Table:     tableID,
+		})
+	}
+
+	var undo []func()
+	defer func() {
+		if err == nil {
+			return
+		}
+		for i := len(undo) - 1; i >= 0; i-- {
+			undo[i]()
+		}
+	}()
+
+	for _, route := range routes {
+		if err := nhNs.RouteAdd(route); err != nil && !errors.Is(err, unix.EEXIST) {
+			return fmt.Errorf("fail to add route %s to table %d on interface %s on namespace %s: %w", route.Dst, tableID, ifName, containerNsPath, netlinkError(err))
+		}
+		undo = append(undo, func() { _ = nhNs.RouteDel(route) })
+	}
+
+	for _, ip := range srcIPs {
+		rule := netlink.NewRule()
+		rule.Family = ipFamily(ip)
+		rule.Src = hostPrefix(ip)
+		rule.Table = tableID
+		if err := nhNs.RuleAdd(rule); err != nil && !errors.Is(err, unix.EEXIST) {
+			return fmt.Errorf("fail to add rule from %s to table %d on namespace %s: %w", ip, tableID, containerNsPath, netlinkError(err))
+		}
+		undo = append(undo, func() { _ = nhNs.RuleDel(rule) })
+	}
+
+	for _, mark := range options.marks {
+		for family := range families {
+			rule := netlink.NewRule()
+			rule.Family = family
+			rule.Mark = mark.Mark
+			mask := mark.mask()
+			rule.Mask = &mask
+			rule.Table = tableID
+			if err := nhNs.RuleAdd(rule); err != nil && !errors.Is(err, unix.EEXIST) {
+				return fmt.Errorf("fail to add rule fwmark %#x/%#x to table %d on namespace %s: %w", mark.Mark, mask, tableID, containerNsPath, netlinkError(err))
+			}
+			undo = append(undo, func() { _ = nhNs.RuleDel(rule) })
+		}
+	}
+	return nil
+}
+
+// NsRemovePolicyRouting removes the rules looking up the table tableID and
+// its routes from the namespace containerNsPath. Missing objects are ignored.
+func NsRemovePolicyRouting(containerNsPath string, tableID int) error {
+	containerNs, err := getNsFromPath(containerNsPath)
+	if err != nil {
+		return fmt.Errorf("could not get network namespace from path %s: %w", containerNsPath, err)
+	}
+	defer closeNs(containerNs)
+
+	nhNs, err := newHandleAt(containerNs)
+	if err != nil {
+		return fmt.Errorf("could not get network namespace handle: %w", err)
+	}
+	defer closeHandle(nhNs)
+
+	var errs []error
+	rules, err := nhNs.RuleListFiltered(netlink.FAMILY_ALL, &netlink.Rule{Table: tableID}, netlink.RT_FILTER_TABLE)
+	if err != nil && !errors.Is(err, netlink.ErrDumpInterrupted) {
+		return fmt.Errorf("fail to list rules on namespace %s: %w", containerNsPath, netlinkError(err))
+	}
+	for i := range rules {
+		if err := nhNs.RuleDel(&rules[i]); err != nil && !errors.Is(err, unix.ENOENT) {
+			errs = append(errs, fmt.Errorf("fail to remove rule %d: %w", rules[i].Priority, netlinkError(err)))
+		}
+	}
+	routes, err := nhNs.RouteListFiltered(netlink.FAMILY_ALL, &netlink.Route{Table: tableID}, netlink.RT_FILTER_TABLE)
+	if err != nil && !errors.Is(err, netlink.ErrDumpInterrupted) {
+		return errors.Join(append(errs, fmt.Errorf("fail to list routes of table %d on namespace %s: %w", tableID, containerNsPath, netlinkError(err)))...)
+	}
+	for i := range routes {
+		if err := nhNs.RouteDel(&routes[i]); err != nil && !errors.Is(err, unix.ESRCH) {
+			errs = append(errs, fmt.Errorf("fail to remove route %s from table %d: %w", routes[i].Dst, tableID, netlinkError(err)))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// ipFamily returns the netlink family of the address.
+func ipFamily(ip net.IP) int {
+	if ip.To4() != nil {
+		return netlink.FAMILY_V4
+	}
+	return netlink.FAMILY_V6
+}
+
+// hostPrefix returns the prefix matching only the address.
+func hostPrefix(ip net.IP) *net.IPNet {
+	if ip4 := ip.To4(); ip4 != nil {
+		return &net.IPNet{IP: ip4, Mask: net.CIDRMask(8*net.IPv4len, 8*net.IPv4len)}
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(8*net.IPv6len, 8*net.IPv6len)}
+}
+
+// isDefaultRoute returns true if the destination matches every address.
+func isDefaultRoute(dst *net.IPNet) bool {
+	ones, _ := dst.Mask.Size()
+	return ones == 0
+}
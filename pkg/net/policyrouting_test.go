@@ -0,0 +1,94 @@
+package net
+
+import (
+	"net"
+	"testing"
+
+	"github.com/vishvananda/netlink"
+)
+
+func TestValidateTableID(t *testing.T) {
+	for _, id := range []int{0, 253, 254, 255, -1} {
+		if err := ValidateTableID(id); err == nil {
+			t.Errorf("expected table %d to be invalid", id)
+		}
+	}
+	for _, id := range []int{1, 100, 252, 256, 1000} {
+		if err := ValidateTableID(id); err != nil {
+			t.Errorf("unexpected error for table %d: %v", id, err)
+		}
+	}
+}
+
+func TestFwMarkValidate(t *testing.T) {
+	for _, mark := range []FwMark{{Mark: 0x10}, {Mark: 0x10, Mask: 0xff}, {Mark: 0xffffffff}} {
+		if err := mark.Validate(); err != nil {
+			t.Errorf("unexpected error for mark %+v: %v", mark, err)
+		}
+	}
+	for _, mark := range []FwMark{{}, {Mask: 0xff}, {Mark: 0x100, Mask: 0xff}} {
+		if err := mark.Validate(); err == nil {
+			t.Errorf("expected mark %+v to be invalid", mark)
+		}
+	}
+}
+
+func TestNsPolicyRouting(t *testing.T) {
+	nsPath, testNS := newTestNamespace(t)
+	ifaceName := "testdummy-pr"
+	newTestDummy(t, ifaceName)
+
+	_, ipnet, _ := net.ParseCIDR("192.168.5.10/24")
+	ipnet.IP = net.ParseIP("192.168.5.10")
+	if _, err := NsAttachNetdev(ifaceName, nsPath, netlink.LinkAttrs{}, []*net.IPNet{ipnet}); err != nil {
+		t.Fatalf("fail to attach netdev to namespace: %v", err)
+	}
+	if err := NsAddRoutes(nsPath, ifaceName, []RouteConfig{{Dst: "10.0.0.0/8", Gw: "192.168.5.1"}}); err != nil {
+		t.Fatalf("fail to add routes: %v", err)
+	}
+
+	if err := NsAddPolicyRouting(nsPath, ifaceName, []net.IP{net.ParseIP("192.168.5.10")}, 100, WithFwMark(FwMark{Mark: 0x10, Mask: 0xff})); err != nil {
+		t.Fatalf("fail to add policy routing: %v", err)
+	}
+
+	nhNs, err := netlink.NewHandleAt(testNS)
+	if err != nil {
+		t.Fatalf("fail to open netlink handle: %v", err)
+	}
+	defer nhNs.Close()
+	rules, err := nhNs.RuleListFiltered(netlink.FAMILY_V4, &netlink.Rule{Table: 100}, netlink.RT_FILTER_TABLE)
+	if err != nil {
+		t.Fatalf("fail to list rules: %v", err)
+	}
+	// the source rule and the mark rule
+	if len(rules) != 2 {
+		t.Fatalf("unexpected rules %v", rules)
+	}
+	var source, mark bool
+	for _, rule := range rules {
+		source = source || rule.Src != nil && rule.Src.String() == "192.168.5.10/32"
+		mark = mark || rule.Mark == 0x10 && rule.Mask != nil && *rule.Mask == 0xff
+	}
+	if !source || !mark {
+		t.Errorf("unexpected rules %v", rules)
+	}
+	// the connected and the 10.0.0.0/8 routes are copied, with a default route through the interface
+	routes, err := nhNs.RouteListFiltered(netlink.FAMILY_V4, &netlink.Route{Table: 100}, netlink.RT_FILTER_TABLE)
+	if err != nil {
+		t.Fatalf("fail to list routes: %v", err)
+	}
+	if len(routes) != 3 {
+		t.Errorf("expected 3 routes in the table, got %v", routes)
+	}
+
+	if err := NsRemovePolicyRouting(nsPath, 100); err != nil {
+		t.Fatalf("fail to remove policy routing: %v", err)
+	}
+	rules, err = nhNs.RuleListFiltered(netlink.FAMILY_V4, &netlink.Rule{Table: 100}, netlink.RT_FILTER_TABLE)
+	if err != nil {
+		t.Fatalf("fail to list rules: %v", err)
+	}
+	if len(rules) != 0 {
+		t.Errorf("expected the rules to be removed, got %v", rules)
+	}
+}
@@ -0,0 +1,266 @@
+package net
+
+import (
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+)
+
+// RouteConfig describes a route installed through the interface moved into the pod.
+type RouteConfig struct {
+	// Dst is the destination prefix of the route, e.g. 0.0.0.0/0.
+	Dst string `json:"dst"`
+	// Gw is the optional gateway of the route, if empty the destination
+	// is considered directly connected to the interface.
+	Gw string `json:"gw,omitempty"`
+	// Src is the optional source address used for the traffic matching the
+	// route, it has to be configured on the interface.
+	Src string `json:"src,omitempty"`
+}
+
+// parsedRoute is the validated form of a RouteConfig.
+type parsedRoute struct {
+	dst *net.IPNet
+	gw  net.IP
+	src net.IP
+}
+
+// parse validates the route configuration.
+func (r RouteConfig) parse() (*parsedRoute, error) {
+	_, dst, err := net.ParseCIDR(r.Dst)
+	if err != nil {
+		return nil, fmt.Errorf("invalid route destination %q: %w", r.Dst, err)
+	}
+	route := &parsedRoute{dst: dst}
+	isIPv4 := dst.IP.To4() != nil
+	if r.Gw != "" {
+		route.gw = net.ParseIP(r.Gw)
+		if route.gw == nil {
+			return nil, fmt.Errorf("invalid gateway %q for route %s", r.Gw, r.Dst)
+		}
+		if (route.gw.To4() != nil) != isIPv4 {
+			return nil, fmt.Errorf("gateway %s and route %s have different IP families", r.Gw, r.Dst)
+		}
+	}
+	if r.Src != "" {
+		route.src = net.ParseIP(r.Src)
+		if route.src == nil {
+			return nil, fmt.Errorf("invalid source %q for route %s", r.Src, r.Dst)
+		}
+		if (route.src.To4() != nil) != isIPv4 {
+			return nil, fmt.Errorf("source %s and route %s have different IP families", r.Src, r.Dst)
+		}
+	}
+	return route, nil
+}
+
+// Validate returns an error if the route configuration is not valid.
+func (r RouteConfig) Validate() error {
+	_, err := r.parse()
+	return err
+}
+
+// NsAddRoutes installs the routes through the interface ifName in the
+// namespace containerNsPath. The interface must be up. A gateway that is not
+// directly reachable through the interface gets a link-scoped route first.
+func NsAddRoutes(containerNsPath string, ifName string, routes []RouteConfig) error {
+	if len(routes) == 0 {
+		return nil
+	}
+	containerNs, err := getNsFromPath(containerNsPath)
+	if err != nil {
+		return fmt.Errorf("could not get network namespace from path %s for network device %s : %w", containerNsPath, ifName, err)
+	}
+	defer closeNs(containerNs)
+
+	nhNs, err := newHandleAt(containerNs)
+	if err != nil {
+		return fmt.Errorf("could not get network namespace handle: %w", err)
+	}
+	defer closeHandle(nhNs)
+
+	nsLink, err := nhNs.LinkByName(ifName)
+	if err != nil && !errors.Is(err, netlink.ErrDumpInterrupted) {
+		return fmt.Errorf("link not found for interface %s on namespace %s: %w", ifName, containerNsPath, err)
+	}
+
+	for _, r := range routes {
+		route, err := r.parse()
+		if err != nil {
+			return err
+		}
+		if route.src != nil {
+			if err := checkAddressOnLink(nhNs, nsLink, route.src); err != nil {
+				return fmt.Errorf("invalid source for route %s: %w", r.Dst, err)
+			}
+		}
+
+		nlRoute := &netlink.Route{
+			LinkIndex: nsLink.Attrs().Index,
+			Dst:       route.dst,
+			Gw:        route.gw,
+			Src:       route.src,
+			Scope:     netlink.SCOPE_UNIVERSE,
+		}
+		if route.gw == nil {
+			nlRoute.Scope = netlink.SCOPE_LINK
+		} else if err := addGatewayRoute(nhNs, nsLink, route.gw); err != nil {
+			return fmt.Errorf("fail to add route to gateway %s of route %s on interface %s on namespace %s: %w", route.gw, r.Dst, ifName, containerNsPath, err)
+		}
+		if err := nhNs.RouteAdd(nlRoute); err != nil && !errors.Is(err, unix.EEXIST) {
+			return fmt.Errorf("fail to add route %s on interface %s on namespace %s: %w", r.Dst, ifName, containerNsPath, netlinkError(err))
+		}
+	}
+	return nil
+}
+
+// addGatewayRoute adds a link-scoped host route to the gateway gw through the
+// link if it is not directly reachable through it, e.g. because it is outside
+// of the prefixes of the interface addresses, so the kernel accepts the
+// routes using it.
+func addGatewayRoute(nh *netlink.Handle, link netlink.Link, gw net.IP) error {
+	current, err := nh.RouteGet(gw)
+	if err == nil && len(current) > 0 && current[0].LinkIndex == link.Attrs().Index && current[0].Gw == nil {
+		return nil
+	}
+	bits := 8 * net.IPv6len
+	if gw.To4() != nil {
+		bits = 8 * net.IPv4len
+	}
+	gwRoute := &netlink.Route{
+		LinkIndex: link.Attrs().Index,
+		Dst:       &net.IPNet{IP: gw, Mask: net.CIDRMask(bits, bits)},
+		Scope:     netlink.SCOPE_LINK,
+	}
+	if err := nh.RouteAdd(gwRoute); err != nil && !errors.Is(err, unix.EEXIST) {
+		return netlinkError(err)
+	}
+	return nil
+}
+
+// checkAddressOnLink returns an error if ip is not configured on the link.
+func checkAddressOnLink(nh *netlink.Handle, link netlink.Link, ip net.IP) error {
+	addrs, err := nh.AddrList(link, netlink.FAMILY_ALL)
+	if err != nil && !errors.Is(err, netlink.ErrDumpInterrupted) {
+		return fmt.Errorf("fail to list addresses on interface %s: %w", link.Attrs().Name, err)
+	}
+	for _, addr := range addrs {
+		if addr.IP.Equal(ip) {
+			return nil
+		}
+	}
+	return fmt.Errorf("address %s is not configured on interface %s", ip, link.Attrs().Name)
+}
+
+// NsPreserveRoutes pins the current path to each of the destinations dsts in
+// the namespace containerNsPath with a host route, so they keep being reached
+// through the same interface and gateway when a new default route is
+// installed through another interface. Unreachable destinations are skipped.
+func NsPreserveRoutes(containerNsPath string, dsts []net.IP) error {
+	if len(dsts) == 0 {
+		return nil
+	}
+	containerNs, err := getNsFromPath(containerNsPath)
+	if err != nil {
+		return fmt.Errorf("could not get network namespace from path %s: %w", containerNsPath, err)
+	}
+	defer closeNs(containerNs)
+
+	nhNs, err := newHandleAt(containerNs)
+	if err != nil {
+		return fmt.Errorf("could not get network namespace handle: %w", err)
+	}
+	defer closeHandle(nhNs)
+
+	for _, dst := range dsts {
+		current, err := nhNs.RouteGet(dst)
+		if errors.Is(err, unix.ENETUNREACH) || errors.Is(err, unix.EHOSTUNREACH) || (err == nil && len(current) == 0) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("fail to get route to %s on namespace %s: %w", dst, containerNsPath, netlinkError(err))
+		}
+		bits := 8 * net.IPv6len
+		if dst.To4() != nil {
+			bits = 8 * net.IPv4len
+		}
+		route := &netlink.Route{
+			LinkIndex: current[0].LinkIndex,
+			Dst:       &net.IPNet{IP: dst, Mask: net.CIDRMask(bits, bits)},
+			Gw:        current[0].Gw,
+			Scope:     netlink.SCOPE_UNIVERSE,
+		}
+		if route.Gw == nil {
+			route.Scope = netlink.SCOPE_LINK
+		}
+		if err := nhNs.RouteAdd(route); err != nil && !errors.Is(err, unix.EEXIST) {
+			return fmt.Errorf("fail to add route %s on namespace %s: %w", route.Dst, containerNsPath, netlinkError(err))
+		}
+	}
+	return nil
+}
+
+// NsFlushRoutes removes the routes through the interface ifName in the
+// namespace containerNsPath, in all the routing tables, so no new traffic is
+// sent through it. The connected and local routes of its addresses, added by
+// the kernel, are kept so the traffic in flight is still delivered.
+func NsFlushRoutes(containerNsPath string, ifName string) error {
+	containerNs, err := getNsFromPath(containerNsPath)
+	if err != nil {
+		return fmt.Errorf("could not get network namespace from path %s for network device %s : %w", containerNsPath, ifName, err)
+	}
+	defer closeNs(containerNs)
+
+	nhNs, err := newHandleAt(containerNs)
+	if err != nil {
+		return fmt.Errorf("could not get network namespace handle: %w", err)
+	}
+	defer closeHandle(nhNs)
+
+	nsLink, err := nhNs.LinkByName(ifName)
+	if err != nil && !errors.Is(err, netlink.ErrDumpInterrupted) {
+		return fmt.Errorf("link not found for interface %s on namespace %s: %w", ifName, containerNsPath, err)
+	}
+
+	filter := &netlink.Route{LinkIndex: nsLink.Attrs().Index, Table: unix.RT_TABLE_UNSPEC}
+	routes, err := nhNs.RouteListFiltered(netlink.FAMILY_ALL, filter, netlink.RT_FILTER_OIF|netlink.RT_FILTER_TABLE)
+	if err != nil && !errors.Is(err, netlink.ErrDumpInterrupted) {
+		return fmt.Errorf("fail to list routes of interface %s on namespace %s: %w", ifName, containerNsPath, netlinkError(err))
+	}
+	var errs []error
+	for _, route := range routes {
+		if route.Protocol == unix.RTPROT_KERNEL || route.Table == unix.RT_TABLE_LOCAL {
+			continue
+		}
+		if err := nhNs.RouteDel(&route); err != nil && !errors.Is(err, unix.ESRCH) {
+			errs = append(errs, fmt.Errorf("fail to delete route %s on interface %s: %w", route.Dst, ifName, netlinkError(err)))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// DefaultRouteLinks returns the indexes of the interfaces of the host
+// namespace with a default route of the main table, IPv4 or IPv6, including
+// the nexthops of the multipath routes.
+func DefaultRouteLinks() ([]int, error) {
+	routes, err := netlink.RouteListFiltered(netlink.FAMILY_ALL, &netlink.Route{Table: unix.RT_TABLE_MAIN}, netlink.RT_FILTER_TABLE)
+	if err != nil && !errors.Is(err, netlink.ErrDumpInterrupted) {
+		return nil, fmt.Errorf("failed to list the routes of the main table: %w", netlinkError(err))
+	}
+	var indexes []int
+	for _, route := range routes {
+		if route.Dst != nil && !isDefaultRoute(route.Dst) {
+			continue
+		}
+		if route.LinkIndex > 0 {
+			indexes = append(indexes, route.LinkIndex)
+		}
+		for _, nexthop := range route.MultiPath {
+			indexes = append(indexes, nexthop.LinkIndex)
+		}
+	}
+	return indexes, nil
+}
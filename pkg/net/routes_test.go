@@ -0,0 +1,156 @@
+package net
+
+import (
+	"net"
+	"testing"
+
+	"github.com/vishvananda/netlink"
+)
+
+func TestRouteConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		route   RouteConfig
+		wantErr bool
+	}{
+		{name: "default route", route: RouteConfig{Dst: "0.0.0.0/0", Gw: "192.168.5.1"}},
+		{name: "connected route", route: RouteConfig{Dst: "10.0.0.0/8"}},
+		{name: "source", route: RouteConfig{Dst: "10.0.0.0/8", Src: "192.168.5.10"}},
+		{name: "ipv6", route: RouteConfig{Dst: "::/0", Gw: "fd00::1", Src: "fd00::10"}},
+		{name: "invalid destination", route: RouteConfig{Dst: "10.0.0.0"}, wantErr: true},
+		{name: "invalid gateway", route: RouteConfig{Dst: "0.0.0.0/0", Gw: "gateway"}, wantErr: true},
+		{name: "invalid source", route: RouteConfig{Dst: "0.0.0.0/0", Src: "192.168.5"}, wantErr: true},
+		{name: "gateway family mismatch", route: RouteConfig{Dst: "0.0.0.0/0", Gw: "fd00::1"}, wantErr: true},
+		{name: "source family mismatch", route: RouteConfig{Dst: "::/0", Src: "192.168.5.10"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.route.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNsAddRoutes(t *testing.T) {
+	nsPath, testNS := newTestNamespace(t)
+	ifaceName := "testdummy-rt"
+	newTestDummy(t, ifaceName)
+
+	_, ipnet, _ := net.ParseCIDR("192.168.5.10/24")
+	ipnet.IP = net.ParseIP("192.168.5.10")
+	if _, err := NsAttachNetdev(ifaceName, nsPath, netlink.LinkAttrs{}, []*net.IPNet{ipnet}); err != nil {
+		t.Fatalf("fail to attach netdev to namespace: %v", err)
+	}
+
+	// the source must be configured on the interface
+	err := NsAddRoutes(nsPath, ifaceName, []RouteConfig{{Dst: "10.0.0.0/8", Gw: "192.168.5.1", Src: "192.168.5.11"}})
+	if err == nil {
+		t.Fatalf("expected error for source not present on the interface")
+	}
+
+	routes := []RouteConfig{{Dst: "10.0.0.0/8", Gw: "192.168.5.1", Src: "192.168.5.10"}}
+	if err := NsAddRoutes(nsPath, ifaceName, routes); err != nil {
+		t.Fatalf("fail to add routes: %v", err)
+	}
+
+	nhNs, err := netlink.NewHandleAt(testNS)
+	if err != nil {
+		t.Fatalf("fail to open netlink handle: %v", err)
+	}
+	defer nhNs.Close()
+	_, dst, _ := net.ParseCIDR("10.0.0.0/8")
+	found, err := nhNs.RouteListFiltered(netlink.FAMILY_V4, &netlink.Route{Dst: dst}, netlink.RT_FILTER_DST)
+	if err != nil {
+		t.Fatalf("fail to list routes: %v", err)
+	}
+	if len(found) != 1 || !found[0].Src.Equal(net.ParseIP("192.168.5.10")) || !found[0].Gw.Equal(net.ParseIP("192.168.5.1")) {
+		t.Errorf("unexpected routes %v", found)
+	}
+
+	// a gateway outside of the interface prefix is routed through the link
+	if err := NsAddRoutes(nsPath, ifaceName, []RouteConfig{{Dst: "172.16.0.0/16", Gw: "10.10.10.1"}}); err != nil {
+		t.Fatalf("fail to add route with an unreachable gateway: %v", err)
+	}
+	_, dst, _ = net.ParseCIDR("10.10.10.1/32")
+	found, err = nhNs.RouteListFiltered(netlink.FAMILY_V4, &netlink.Route{Dst: dst}, netlink.RT_FILTER_DST)
+	if err != nil {
+		t.Fatalf("fail to list routes: %v", err)
+	}
+	if len(found) != 1 || found[0].Scope != netlink.SCOPE_LINK {
+		t.Errorf("expected a link-scoped route to the gateway, got %v", found)
+	}
+}
+
+func TestNsPreserveRoutes(t *testing.T) {
+	nsPath, testNS := newTestNamespace(t)
+	ifaceName := "testdummy-dns"
+	newTestDummy(t, ifaceName)
+
+	_, ipnet, _ := net.ParseCIDR("192.168.5.10/24")
+	ipnet.IP = net.ParseIP("192.168.5.10")
+	if _, err := NsAttachNetdev(ifaceName, nsPath, netlink.LinkAttrs{}, []*net.IPNet{ipnet}); err != nil {
+		t.Fatalf("fail to attach netdev to namespace: %v", err)
+	}
+	if err := NsAddRoutes(nsPath, ifaceName, []RouteConfig{{Dst: "0.0.0.0/0", Gw: "192.168.5.1"}}); err != nil {
+		t.Fatalf("fail to add default route: %v", err)
+	}
+
+	// 10.96.0.10 is reached through the default route, the IPv6 one is unreachable
+	dns := []net.IP{net.ParseIP("10.96.0.10"), net.ParseIP("fd00:10:96::a")}
+	if err := NsPreserveRoutes(nsPath, dns); err != nil {
+		t.Fatalf("fail to preserve routes: %v", err)
+	}
+
+	nhNs, err := netlink.NewHandleAt(testNS)
+	if err != nil {
+		t.Fatalf("fail to open netlink handle: %v", err)
+	}
+	defer nhNs.Close()
+	_, dst, _ := net.ParseCIDR("10.96.0.10/32")
+	found, err := nhNs.RouteListFiltered(netlink.FAMILY_V4, &netlink.Route{Dst: dst}, netlink.RT_FILTER_DST)
+	if err != nil {
+		t.Fatalf("fail to list routes: %v", err)
+	}
+	if len(found) != 1 || !found[0].Gw.Equal(net.ParseIP("192.168.5.1")) {
+		t.Errorf("unexpected routes %v", found)
+	}
+}
+
+func TestNsFlushRoutes(t *testing.T) {
+	nsPath, testNS := newTestNamespace(t)
+	ifaceName := "testdummy-flush"
+	newTestDummy(t, ifaceName)
+
+	_, ipnet, _ := net.ParseCIDR("192.168.6.10/24")
+	ipnet.IP = net.ParseIP("192.168.6.10")
+	if _, err := NsAttachNetdev(ifaceName, nsPath, netlink.LinkAttrs{}, []*net.IPNet{ipnet}); err != nil {
+		t.Fatalf("fail to attach netdev to namespace: %v", err)
+	}
+	if err := NsAddRoutes(nsPath, ifaceName, []RouteConfig{{Dst: "0.0.0.0/0", Gw: "192.168.6.1"}, {Dst: "10.0.0.0/8", Gw: "192.168.6.1"}}); err != nil {
+		t.Fatalf("fail to add routes: %v", err)
+	}
+
+	if err := NsFlushRoutes(nsPath, ifaceName); err != nil {
+		t.Fatalf("fail to flush routes: %v", err)
+	}
+
+	nhNs, err := netlink.NewHandleAt(testNS)
+	if err != nil {
+		t.Fatalf("fail to open netlink handle: %v", err)
+	}
+	defer nhNs.Close()
+	link, err := nhNs.LinkByName(ifaceName)
+	if err != nil {
+		t.Fatalf("fail to get link: %v", err)
+	}
+	routes, err := nhNs.RouteList(link, netlink.FAMILY_V4)
+	if err != nil {
+		t.Fatalf("fail to list routes: %v", err)
+	}
+	// only the connected route of the address is left
+	_, connected, _ := net.ParseCIDR("192.168.6.0/24")
+	if len(routes) != 1 || routes[0].Dst.String() != connected.String() {
+		t.Errorf("unexpected routes %v", routes)
+	}
+}
@@ -0,0 +1,141 @@
+package net
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// sysfsPCIBusPath is the sysfs directory of the PCI bus, it is a variable so
+// tests can point it to a fake tree.
+var sysfsPCIBusPath = "/sys/bus/pci"
+
+// SriovVF is a virtual function of an SR-IOV physical function.
+type SriovVF struct {
+	// Index is the number of the virtual function in the physical function.
+	Index int
+	// PCIAddress is the address of the virtual function.
+	PCIAddress string
+	// Driver is the driver bound to the virtual function, if any.
+	Driver string
+	// Name is the host interface of the virtual function, empty if it is not
+	// bound to a network driver.
+	Name string
+}
+
+// SriovTotalVFs returns the maximum number of SR-IOV virtual functions the
+// physical function backing the host interface ifName supports, 0 if the
+// device does not support SR-IOV.
+func SriovTotalVFs(ifName string) (int, error) {
+	return readSriovAttr(ifName, "sriov_totalvfs")
+}
+
+// SriovNumVFs returns the number of SR-IOV virtual functions currently
+// enabled on the physical function backing the host interface ifName.
+func SriovNumVFs(ifName string) (int, error) {
+	return readSriovAttr(ifName, "sriov_numvfs")
+}
+
+func readSriovAttr(ifName string, attr string) (int, error) {
+	value, err := readSysfsNetAttr(ifName, filepath.Join("device", attr))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("failed to read %s of interface %s: %w", attr, ifName, err)
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q for interface %s: %w", attr, value, ifName, err)
+	}
+	return n, nil
+}
+
+// SetSriovNumVFs enables numVFs SR-IOV virtual functions on the physical
+// function backing the host interface ifName, up to its total. The kernel
+// only allows to change the number of virtual functions from 0, so the
+// existing ones are removed first.
+func SetSriovNumVFs(ifName string, numVFs int) error {
+	total, err := SriovTotalVFs(ifName)
+	if err != nil {
+		return err
+	}
+	if numVFs < 0 || numVFs > total {
+		return fmt.Errorf("invalid number of virtual functions %d for interface %s, must be between 0 and %d", numVFs, ifName, total)
+	}
+	current, err := SriovNumVFs(ifName)
+	if err != nil {
+		return err
+	}
+	if current == numVFs {
+		return nil
+	}
+	path := filepath.Join(sysfsNetPath, ifName, "device", "sriov_numvfs")
+	if current != 0 && numVFs != 0 {
+		if err := os.WriteFile(path, []byte("0"), 0644); err != nil {
+			return fmt.Errorf("failed to remove the virtual functions of interface %s: %w", ifName, err)
+		}
+	}
+	if err := os.WriteFile(path, []byte(strconv.Itoa(numVFs)), 0644); err != nil {
+		return fmt.Errorf("failed to enable %d virtual functions on interface %s: %w", numVFs, ifName, err)
+	}
+	return nil
+}
+
+// SriovVFs returns the virtual functions of the physical function backing
+// the host interface ifName, sorted by index.
+func SriovVFs(ifName string) ([]SriovVF, error) {
+	devicePath := filepath.Join(sysfsNetPath, ifName, "device")
+	entries, err := filepath.Glob(filepath.Join(devicePath, "virtfn*"))
+	if err != nil {
+		return nil, err
+	}
+	var vfs []SriovVF
+	for _, entry := range entries {
+		index, err := strconv.Atoi(strings.TrimPrefix(filepath.Base(entry), "virtfn"))
+		if err != nil {
+			continue
+		}
+		target, err := os.Readlink(entry)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read virtual function %d of interface %s: %w", index, ifName, err)
+		}
+		vf := SriovVF{Index: index, PCIAddress: filepath.Base(target)}
+		if driver, err := os.Readlink(filepath.Join(entry, "driver")); err == nil {
+			vf.Driver = filepath.Base(driver)
+		}
+		if names, err := os.ReadDir(filepath.Join(entry, "net")); err == nil && len(names) > 0 {
+			vf.Name = names[0].Name()
+		}
+		vfs = append(vfs, vf)
+	}
+	sort.Slice(vfs, func(i, j int) bool { return vfs[i].Index < vfs[j].Index })
+	return vfs, nil
+}
+
+// BindSriovVF binds the virtual function to its default network driver,
+// unbinding it first from a non network driver like vfio-pci, so it gets a
+// host interface that can be moved into a pod. The interface is created
+// asynchronously by the driver probe.
+func BindSriovVF(vf SriovVF) error {
+	if vf.Name != "" {
+		return nil
+	}
+	devicePath := filepath.Join(sysfsPCIBusPath, "devices", vf.PCIAddress)
+	if vf.Driver != "" {
+		if err := os.WriteFile(filepath.Join(devicePath, "driver", "unbind"), []byte(vf.PCIAddress), 0644); err != nil {
+			return fmt.Errorf("failed to unbind virtual function %s from driver %s: %w", vf.PCIAddress, vf.Driver, err)
+		}
+	}
+	// an empty override restores the default driver matching
+	if err := os.WriteFile(filepath.Join(devicePath, "driver_override"), []byte("\n"), 0644); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to clear the driver override of virtual function %s: %w", vf.PCIAddress, err)
+	}
+	if err := os.WriteFile(filepath.Join(sysfsPCIBusPath, "drivers_probe"), []byte(vf.PCIAddress), 0644); err != nil {
+		return fmt.Errorf("failed to probe the driver of virtual function %s: %w", vf.PCIAddress, err)
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+package net
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSriovVFs(t *testing.T) {
+	fakeSysfs(t, map[string]map[string]string{
+		"pf0":  {"device/sriov_totalvfs": "8", "device/sriov_numvfs": "0"},
+		"pf1":  {"device/sriov_totalvfs": "4", "device/sriov_numvfs": "2"},
+		"eth0": {"speed": "1000"},
+	})
+
+	tests := []struct {
+		ifName    string
+		wantTotal int
+		wantNum   int
+	}{
+		{ifName: "pf0", wantTotal: 8, wantNum: 0},
+		{ifName: "pf1", wantTotal: 4, wantNum: 2},
+		{ifName: "eth0", wantTotal: 0, wantNum: 0},
+	}
+	for _, tt := range tests {
+		total, err := SriovTotalVFs(tt.ifName)
+		if err != nil || total != tt.wantTotal {
+			t.Errorf("SriovTotalVFs(%s) = %d, %v, want %d", tt.ifName, total, err, tt.wantTotal)
+		}
+		num, err := SriovNumVFs(tt.ifName)
+		if err != nil || num != tt.wantNum {
+			t.Errorf("SriovNumVFs(%s) = %d, %v, want %d", tt.ifName, num, err, tt.wantNum)
+		}
+	}
+
+	if err := SetSriovNumVFs("pf0", 8); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if num, _ := SriovNumVFs("pf0"); num != 8 {
+		t.Errorf("expected 8 virtual functions on pf0, got %d", num)
+	}
+	if err := SetSriovNumVFs("pf1", 4); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if num, _ := SriovNumVFs("pf1"); num != 4 {
+		t.Errorf("expected 4 virtual functions on pf1, got %d", num)
+	}
+	if err := SetSriovNumVFs("pf1", 5); err == nil {
+		t.Errorf("expected error enabling more virtual functions than the total")
+	}
+	if err := SetSriovNumVFs("eth0", 1); err == nil {
+		t.Errorf("expected error enabling virtual functions without SR-IOV support")
+	}
+}
+
+func TestSriovVFs_invalid(t *testing.T) {
+	fakeSysfs(t, map[string]map[string]string{
+		"pf0": {"device/sriov_totalvfs": "many"},
+	})
+	if _, err := SriovTotalVFs("pf0"); err == nil {
+		t.Errorf("expected error for invalid sriov_totalvfs")
+	}
+	if err := SetSriovNumVFs("pf0", 1); err == nil {
+		t.Errorf("expected error enabling virtual functions with an invalid total")
+	}
+}
+
+func TestSriovVFsAndBind(t *testing.T) {
+	dir := t.TempDir()
+	origNet, origPCI := sysfsNetPath, sysfsPCIBusPath
+	sysfsNetPath = filepath.Join(dir, "class", "net")
+	sysfsPCIBusPath = filepath.Join(dir, "bus", "pci")
+	t.Cleanup(func() { sysfsNetPath, sysfsPCIBusPath = origNet, origPCI })
+
+	// PF pf0 with the VF 0 bound to a network driver as eth1 and the VF 1 bound to vfio-pci
+	devices := filepath.Join(dir, "devices")
+	pf := filepath.Join(devices, "0000:3b:00.0")
+	vf0 := filepath.Join(devices, "0000:3b:02.0")
+	vf1 := filepath.Join(devices, "0000:3b:02.1")
+	pciVF1 := filepath.Join(sysfsPCIBusPath, "devices", "0000:3b:02.1")
+	for _, path := range []string{
+		pf, filepath.Join(vf0, "net", "eth1"), vf1,
+		filepath.Join(devices, "drivers", "ixgbevf"), filepath.Join(devices, "drivers", "vfio-pci"),
+		filepath.Join(sysfsNetPath, "pf0"), filepath.Join(pciVF1, "driver"),
+	} {
+		if err := os.MkdirAll(path, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for target, link := range map[string]string{
+		"../../../devices/0000:3b:00.0": filepath.Join(sysfsNetPath, "pf0", "device"),
+		"../0000:3b:02.0":               filepath.Join(pf, "virtfn0"),
+		"../0000:3b:02.1":               filepath.Join(pf, "virtfn1"),
+		"../drivers/ixgbevf":            filepath.Join(vf0, "driver"),
+		"../drivers/vfio-pci":           filepath.Join(vf1, "driver"),
+	} {
+		if err := os.Symlink(target, link); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	vfs, err := SriovVFs("pf0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []SriovVF{
+		{Index: 0, PCIAddress: "0000:3b:02.0", Driver: "ixgbevf", Name: "eth1"},
+		{Index: 1, PCIAddress: "0000:3b:02.1", Driver: "vfio-pci"},
+	}
+	if !reflect.DeepEqual(vfs, want) {
+		t.Fatalf("SriovVFs() = %+v, want %+v", vfs, want)
+	}
+
+	// bound to a network driver, nothing to do
+	if err := BindSriovVF(vfs[0]); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(sysfsPCIBusPath, "drivers_probe")); !os.IsNotExist(err) {
+		t.Errorf("unexpected probe of a virtual function with a network interface")
+	}
+
+	if err := BindSriovVF(vfs[1]); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for path, want := range map[string]string{
+		filepath.Join(pciVF1, "driver", "unbind"):       "0000:3b:02.1",
+		filepath.Join(pciVF1, "driver_override"):        "\n",
+		filepath.Join(sysfsPCIBusPath, "drivers_probe"): "0000:3b:02.1",
+	} {
+		data, err := os.ReadFile(path)
+		if err != nil || string(data) != want {
+			t.Errorf("expected %q written to %s, got %q, %v", want, path, data, err)
+		}
+	}
+}
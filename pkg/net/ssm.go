@@ -0,0 +1,167 @@
+package net
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+// SSMConfig are the source-specific multicast (S,G) channels joined on the
+// interface moved into the pod, for receivers of feeds that are only
+// forwarded to the network once a membership is reported.
+type SSMConfig struct {
+	// Joins are the channels joined on the interface.
+	Joins []SourceGroup `json:"joins"`
+}
+
+// SourceGroup is a source-specific multicast channel.
+type SourceGroup struct {
+	// Source is the unicast address of the sender.
+	Source string `json:"source"`
+	// Group is the multicast group address, usually within the SSM ranges
+	// 232.0.0.0/8 or ff3x::/32.
+	Group string `json:"group"`
+}
+
+// sourceGroup is a parsed channel.
+type sourceGroup struct {
+	source net.IP
+	group  net.IP
+}
+
+// parseJoins validates the channels.
+func (c SSMConfig) parseJoins() ([]sourceGroup, error) {
+	if len(c.Joins) == 0 {
+		return nil, fmt.Errorf("no source-specific multicast joins")
+	}
+	seen := map[string]bool{}
+	var joins []sourceGroup
+	for _, join := range c.Joins {
+		group := net.ParseIP(join.Group)
+		if group == nil {
+			return nil, fmt.Errorf("invalid multicast group %q", join.Group)
+		}
+		if _, err := parseMulticastGroup(join.Group); err != nil {
+			return nil, err
+		}
+		if ip4 := group.To4(); ip4 != nil {
+			group = ip4
+		}
+		// interface and link-local scoped groups are not forwarded by the routers
+		if group.IsInterfaceLocalMulticast() || group.IsLinkLocalMulticast() {
+			return nil, fmt.Errorf("multicast group %s is not routed", join.Group)
+		}
+		source := net.ParseIP(join.Source)
+		if source == nil {
+			return nil, fmt.Errorf("invalid source %q of multicast group %s", join.Source, join.Group)
+		}
+		if ip4 := source.To4(); ip4 != nil {
+			source = ip4
+		}
+		if len(source) != len(group) {
+			return nil, fmt.Errorf("source %s and multicast group %s are of different families", join.Source, join.Group)
+		}
+		if source.IsUnspecified() || source.IsLoopback() || source.IsMulticast() || source.Equal(net.IPv4bcast) {
+			return nil, fmt.Errorf("source %s of multicast group %s is not a unicast address", join.Source, join.Group)
+		}
+		key := source.String() + "," + group.String()
+		if seen[key] {
+			return nil, fmt.Errorf("duplicate join of source %s and multicast group %s", join.Source, join.Group)
+		}
+		seen[key] = true
+		joins = append(joins, sourceGroup{source: source, group: group})
+	}
+	return joins, nil
+}
+
+// Validate returns an error if any of the channels is not a unicast source
+// and a routed multicast group of the same family.
+func (c SSMConfig) Validate() error {
+	_, err := c.parseJoins()
+	return err
+}
+
+// SourceGroupMemberships are the sockets holding the source-specific
+// memberships of an interface. The kernel keeps a membership while the
+// socket that joined it is open, and reports the leave when it is closed.
+type SourceGroupMemberships struct {
+	mu    sync.Mutex
+	conns []net.PacketConn
+}
+
+// Close leaves the channels.
+func (m *SourceGroupMemberships) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var errs []error
+	for _, conn := range m.conns {
+		if err := conn.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	m.conns = nil
+	return errors.Join(errs...)
+}
+
+// NsJoinSourceGroups joins the source-specific multicast channels on the
+// interface ifName in the namespace containerNsPath. The memberships are
+// held by sockets of the namespace until the returned memberships are
+// closed, which must be done before the interface leaves the namespace.
+// Each channel has its own socket, so the per socket membership and source
+// limits of the kernel do not apply.
+func NsJoinSourceGroups(containerNsPath string, ifName string, config SSMConfig) (*SourceGroupMemberships, error) {
+	joins, err := config.parseJoins()
+	if err != nil {
+		return nil, err
+	}
+	memberships := &SourceGroupMemberships{}
+	err = inNamespace(containerNsPath, func() error {
+		iface, err := net.InterfaceByName(ifName)
+		if err != nil {
+			return fmt.Errorf("link not found for interface %s on namespace %s: %w", ifName, containerNsPath, err)
+		}
+		for _, join := range joins {
+			// the socket belongs to the namespace of the thread that creates it
+			conn, err := joinSourceGroup(iface, join)
+			if err != nil {
+				return fmt.Errorf("fail to join source %s and multicast group %s on interface %s: %w", join.source, join.group, ifName, err)
+			}
+			memberships.conns = append(memberships.conns, conn)
+		}
+		return nil
+	})
+	if err != nil {
+		memberships.Close()
+		return nil, err
+	}
+	return memberships, nil
+}
+
+// joinSourceGroup opens a socket that joins the channel on the interface.
+func joinSourceGroup(iface *net.Interface, join sourceGroup) (net.PacketConn, error) {
+	// bound to an ephemeral port, none of the traffic of the channel is
+	// delivered to the socket
+	network, address := "udp4", "0.0.0.0:0"
+	if join.group.To4() == nil {
+		network, address = "udp6", "[::]:0"
+	}
+	conn, err := net.ListenPacket(network, address)
+	if err != nil {
+		return nil, err
+	}
+	group, source := &net.UDPAddr{IP: join.group}, &net.UDPAddr{IP: join.source}
+	if network == "udp4" {
+		err = ipv4.NewPacketConn(conn).JoinSourceSpecificGroup(iface, group, source)
+	} else {
+		err = ipv6.NewPacketConn(conn).JoinSourceSpecificGroup(iface, group, source)
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
@@ -0,0 +1,82 @@
+package net
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/vishvananda/netlink"
+)
+
+func TestSSMConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		joins   []SourceGroup
+		wantErr bool
+	}{
+		{name: "ipv4", joins: []SourceGroup{{Source: "192.0.2.10", Group: "232.1.1.1"}}},
+		{name: "ipv4 outside the ssm range", joins: []SourceGroup{{Source: "192.0.2.10", Group: "239.1.1.1"}}},
+		{name: "ipv6", joins: []SourceGroup{{Source: "2001:db8::10", Group: "ff3e::8000:1"}}},
+		{name: "same group from several sources", joins: []SourceGroup{{Source: "192.0.2.10", Group: "232.1.1.1"}, {Source: "192.0.2.11", Group: "232.1.1.1"}}},
+		{name: "no joins", wantErr: true},
+		{name: "duplicate", joins: []SourceGroup{{Source: "192.0.2.10", Group: "232.1.1.1"}, {Source: "192.0.2.10", Group: "232.1.1.1"}}, wantErr: true},
+		{name: "group prefix", joins: []SourceGroup{{Source: "192.0.2.10", Group: "232.1.1.0/24"}}, wantErr: true},
+		{name: "unicast group", joins: []SourceGroup{{Source: "192.0.2.10", Group: "10.0.0.1"}}, wantErr: true},
+		{name: "local network control", joins: []SourceGroup{{Source: "192.0.2.10", Group: "224.0.0.251"}}, wantErr: true},
+		{name: "ipv6 link-local group", joins: []SourceGroup{{Source: "2001:db8::10", Group: "ff32::8000:1"}}, wantErr: true},
+		{name: "multicast source", joins: []SourceGroup{{Source: "232.1.1.2", Group: "232.1.1.1"}}, wantErr: true},
+		{name: "unspecified source", joins: []SourceGroup{{Source: "0.0.0.0", Group: "232.1.1.1"}}, wantErr: true},
+		{name: "invalid source", joins: []SourceGroup{{Source: "192.0.2", Group: "232.1.1.1"}}, wantErr: true},
+		{name: "mixed families", joins: []SourceGroup{{Source: "2001:db8::10", Group: "232.1.1.1"}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := (SSMConfig{Joins: tt.joins}).Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNsJoinSourceGroups(t *testing.T) {
+	nsPath, _ := newTestNamespace(t)
+	ifaceName := "testdummy-ssm"
+	newTestDummy(t, ifaceName)
+
+	if _, err := NsAttachNetdev(ifaceName, nsPath, netlink.LinkAttrs{}, nil); err != nil {
+		t.Fatalf("fail to attach netdev to namespace: %v", err)
+	}
+
+	mcfilter := func() string {
+		t.Helper()
+		var data []byte
+		if err := inNamespace(nsPath, func() (err error) {
+			data, err = os.ReadFile("/proc/net/mcfilter")
+			return err
+		}); err != nil {
+			t.Fatalf("fail to read the multicast filters: %v", err)
+		}
+		return string(data)
+	}
+
+	config := SSMConfig{Joins: []SourceGroup{{Source: "192.0.2.10", Group: "232.1.1.1"}}}
+	memberships, err := NsJoinSourceGroups(nsPath, ifaceName, config)
+	if err != nil {
+		t.Fatalf("fail to join the source-specific groups: %v", err)
+	}
+	// the group and the source are listed in hexadecimal
+	if filters := mcfilter(); !strings.Contains(filters, ifaceName) || !strings.Contains(filters, "0xe8010101") {
+		t.Errorf("membership not found in %s", filters)
+	}
+
+	if err := memberships.Close(); err != nil {
+		t.Fatalf("fail to leave the source-specific groups: %v", err)
+	}
+	if filters := mcfilter(); strings.Contains(filters, ifaceName) {
+		t.Errorf("membership not left: %s", filters)
+	}
+
+	if _, err := NsJoinSourceGroups(nsPath, "missing0", config); err == nil {
+		t.Errorf("expected error joining on a missing interface")
+	}
+}
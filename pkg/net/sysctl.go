@@ -0,0 +1,238 @@
+package net
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netns"
+	"golang.org/x/sys/unix"
+)
+
+// procSysNetPath is the sysctl directory of the network stack, the values
+// seen depend on the network namespace of the thread that opens them.
+const procSysNetPath = "/proc/sys/net"
+
+// ipv6ConfSysctl returns the sysctl path of the IPv6 setting key of the interface ifName.
+func ipv6ConfSysctl(ifName string, key string) string {
+	return filepath.Join(procSysNetPath, "ipv6", "conf", ifName, key)
+}
+
+// ipv4ConfSysctl returns the sysctl path of the IPv4 setting key of the interface ifName.
+func ipv4ConfSysctl(ifName string, key string) string {
+	return filepath.Join(procSysNetPath, "ipv4", "conf", ifName, key)
+}
+
+// inNamespace runs fn with the current thread in the namespace containerNsPath.
+func inNamespace(containerNsPath string, fn func() error) error {
+	containerNs, err := getNsFromPath(containerNsPath)
+	if err != nil {
+		return fmt.Errorf("could not get network namespace from path %s: %w", containerNsPath, err)
+	}
+	defer closeNs(containerNs)
+
+	// the thread must not be reused by other goroutines while in the namespace
+	runtime.LockOSThread()
+	origNs, err := getNs()
+	if err != nil {
+		runtime.UnlockOSThread()
+		return err
+	}
+	defer closeNs(origNs)
+	if err := netns.Set(containerNs); err != nil {
+		runtime.UnlockOSThread()
+		return fmt.Errorf("could not enter network namespace %s: %w", containerNsPath, err)
+	}
+	fnErr := fn()
+	if err := netns.Set(origNs); err != nil {
+		// the thread is left locked, the runtime terminates it when the
+		// goroutine exits instead of reusing it in the wrong namespace
+		return errors.Join(fnErr, fmt.Errorf("could not restore the network namespace: %w", err))
+	}
+	runtime.UnlockOSThread()
+	return fnErr
+}
+
+// NsSetIPv6Conf writes the IPv6 settings of the interface ifName, e.g.
+// use_tempaddr, in the namespace containerNsPath.
+func NsSetIPv6Conf(containerNsPath string, ifName string, values map[string]string) error {
+	return nsSetConf(containerNsPath, ifName, values, ipv6ConfSysctl)
+}
+
+// NsResetIPv6Conf restores the IPv6 settings keys of the interface ifName
+// in the namespace containerNsPath to the namespace defaults.
+func NsResetIPv6Conf(containerNsPath string, ifName string, keys []string) error {
+	return nsResetConf(containerNsPath, ifName, keys, ipv6ConfSysctl)
+}
+
+// NsSetIPv4Conf writes the IPv4 settings of the interface ifName, e.g.
+// arp_ignore, in the namespace containerNsPath.
+func NsSetIPv4Conf(containerNsPath string, ifName string, values map[string]string) error {
+	return nsSetConf(containerNsPath, ifName, values, ipv4ConfSysctl)
+}
+
+// NsResetIPv4Conf restores the IPv4 settings keys of the interface ifName
+// in the namespace containerNsPath to the namespace defaults.
+func NsResetIPv4Conf(containerNsPath string, ifName string, keys []string) error {
+	return nsResetConf(containerNsPath, ifName, keys, ipv4ConfSysctl)
+}
+
+func nsSetConf(containerNsPath string, ifName string, values map[string]string, confSysctl func(ifName, key string) string) error {
+	return inNamespace(containerNsPath, func() error {
+		for key, value := range values {
+			if err := os.WriteFile(confSysctl(ifName, key), []byte(value), 0644); err != nil {
+				return fmt.Errorf("failed to set %s to %s on interface %s: %w", key, value, ifName, err)
+			}
+		}
+		return nil
+	})
+}
+
+func nsResetConf(containerNsPath string, ifName string, keys []string, confSysctl func(ifName, key string) string) error {
+	return inNamespace(containerNsPath, func() error {
+		var errs []error
+		for _, key := range keys {
+			value, err := os.ReadFile(confSysctl("default", key))
+			if err != nil {
+				errs = append(errs, fmt.Errorf("failed to read default %s: %w", key, err))
+				continue
+			}
+			if err := os.WriteFile(confSysctl(ifName, key), []byte(strings.TrimSpace(string(value))), 0644); err != nil {
+				errs = append(errs, fmt.Errorf("failed to reset %s on interface %s: %w", key, ifName, err))
+			}
+		}
+		return errors.Join(errs...)
+	})
+}
+
+// InterfaceSysctl is a sysctl of the network stack scoped to a single
+// interface, net.<family>.<table>.<interface>.<key>, e.g.
+// net.ipv4.conf.eth0.rp_filter. The interface may contain dots, the key is
+// the last element of the name.
+type InterfaceSysctl struct {
+	// Family is ipv4 or ipv6.
+	Family string
+	// Table is conf or neigh.
+	Table string
+	// Interface is the name of the interface the sysctl applies to.
+	Interface string
+	// Key is the name of the setting, e.g. rp_filter.
+	Key string
+}
+
+// ParseInterfaceSysctl parses the name of an interface scoped sysctl, the
+// all and default entries are rejected as they apply to the whole network
+// namespace.
+func ParseInterfaceSysctl(name string) (InterfaceSysctl, error) {
+	family, rest, _ := strings.Cut(strings.TrimPrefix(name, "net."), ".")
+	table, rest, _ := strings.Cut(rest, ".")
+	i := strings.LastIndex(rest, ".")
+	if !strings.HasPrefix(name, "net.") || (family != "ipv4" && family != "ipv6") ||
+		(table != "conf" && table != "neigh") || i < 0 {
+		return InterfaceSysctl{}, fmt.Errorf("invalid sysctl %s, must be net.ipv4.conf, net.ipv6.conf, net.ipv4.neigh or net.ipv6.neigh followed by the interface and the key", name)
+	}
+	sysctl := InterfaceSysctl{Family: family, Table: table, Interface: rest[:i], Key: rest[i+1:]}
+	if sysctl.Interface == "all" || sysctl.Interface == "default" {
+		return InterfaceSysctl{}, fmt.Errorf("invalid sysctl %s, %s applies to all the interfaces", name, sysctl.Interface)
+	}
+	if len(sysctl.Interface) == 0 || len(sysctl.Interface) >= unix.IFNAMSIZ ||
+		sysctl.Interface == "." || sysctl.Interface == ".." || strings.ContainsAny(sysctl.Interface, "/: \t\n") {
+		return InterfaceSysctl{}, fmt.Errorf("invalid sysctl %s, invalid interface %q", name, sysctl.Interface)
+	}
+	if sysctl.Key == "" || strings.Trim(sysctl.Key, "abcdefghijklmnopqrstuvwxyz0123456789_") != "" {
+		return InterfaceSysctl{}, fmt.Errorf("invalid sysctl %s, invalid key %q", name, sysctl.Key)
+	}
+	return sysctl, nil
+}
+
+// path returns the sysctl path of the setting on the interface ifName.
+func (s InterfaceSysctl) path(ifName string) string {
+	return filepath.Join(procSysNetPath, s.Family, s.Table, ifName, s.Key)
+}
+
+// NsSetSysctls writes the interface scoped sysctls values, by name, in the
+// namespace containerNsPath. The names are validated with
+// ParseInterfaceSysctl, none is written if one is invalid.
+func NsSetSysctls(containerNsPath string, values map[string]string) error {
+	sysctls := make(map[string]InterfaceSysctl, len(values))
+	for name := range values {
+		sysctl, err := ParseInterfaceSysctl(name)
+		if err != nil {
+			return err
+		}
+		sysctls[name] = sysctl
+	}
+	return inNamespace(containerNsPath, func() error {
+		for _, name := range slices.Sorted(maps.Keys(sysctls)) {
+			sysctl := sysctls[name]
+			if err := os.WriteFile(sysctl.path(sysctl.Interface), []byte(values[name]), 0644); err != nil {
+				return fmt.Errorf("failed to set %s to %s: %w", name, values[name], err)
+			}
+		}
+		return nil
+	})
+}
+
+// NsResetSysctls restores the interface scoped sysctls names in the
+// namespace containerNsPath to the namespace defaults. The sysctls of an
+// interface that is gone are skipped.
+func NsResetSysctls(containerNsPath string, names []string) error {
+	return inNamespace(containerNsPath, func() error {
+		var errs []error
+		for _, name := range names {
+			sysctl, err := ParseInterfaceSysctl(name)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			value, err := os.ReadFile(sysctl.path("default"))
+			if err != nil {
+				errs = append(errs, fmt.Errorf("failed to read default %s: %w", name, err))
+				continue
+			}
+			err = os.WriteFile(sysctl.path(sysctl.Interface), []byte(strings.TrimSpace(string(value))), 0644)
+			if err != nil && !errors.Is(err, os.ErrNotExist) {
+				errs = append(errs, fmt.Errorf("failed to reset %s: %w", name, err))
+			}
+		}
+		return errors.Join(errs...)
+	})
+}
+
+// NsTemporaryAddresses returns the IPv6 temporary addresses, generated by
+// the privacy extensions, of the interface ifName in the namespace containerNsPath.
+func NsTemporaryAddresses(containerNsPath string, ifName string) ([]string, error) {
+	containerNs, err := getNsFromPath(containerNsPath)
+	if err != nil {
+		return nil, fmt.Errorf("could not get network namespace from path %s for network device %s : %w", containerNsPath, ifName, err)
+	}
+	defer closeNs(containerNs)
+
+	nhNs, err := newHandleAt(containerNs)
+	if err != nil {
+		return nil, fmt.Errorf("could not get network namespace handle: %w", err)
+	}
+	defer closeHandle(nhNs)
+
+	nsLink, err := nhNs.LinkByName(ifName)
+	if err != nil && !errors.Is(err, netlink.ErrDumpInterrupted) {
+		return nil, fmt.Errorf("link not found for interface %s on namespace %s: %w", ifName, containerNsPath, err)
+	}
+	addrs, err := nhNs.AddrList(nsLink, netlink.FAMILY_V6)
+	if err != nil && !errors.Is(err, netlink.ErrDumpInterrupted) {
+		return nil, fmt.Errorf("fail to list addresses on interface %s: %w", ifName, err)
+	}
+	var temporary []string
+	for _, addr := range addrs {
+		if addr.Flags&unix.IFA_F_TEMPORARY != 0 {
+			temporary = append(temporary, addr.IPNet.String())
+		}
+	}
+	return temporary, nil
+}
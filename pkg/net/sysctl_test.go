@@ -0,0 +1,115 @@
+package net
+
+import (
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netns"
+)
+
+func TestParseInterfaceSysctl(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    InterfaceSysctl
+		wantErr bool
+	}{
+		{name: "net.ipv4.conf.eth0.rp_filter", want: InterfaceSysctl{Family: "ipv4", Table: "conf", Interface: "eth0", Key: "rp_filter"}},
+		{name: "net.ipv6.conf.net1.accept_ra", want: InterfaceSysctl{Family: "ipv6", Table: "conf", Interface: "net1", Key: "accept_ra"}},
+		{name: "net.ipv4.neigh.eth0.base_reachable_time_ms", want: InterfaceSysctl{Family: "ipv4", Table: "neigh", Interface: "eth0", Key: "base_reachable_time_ms"}},
+		{name: "net.ipv4.conf.eth0.100.arp_ignore", want: InterfaceSysctl{Family: "ipv4", Table: "conf", Interface: "eth0.100", Key: "arp_ignore"}},
+		{name: "net.ipv4.ip_forward", wantErr: true},
+		{name: "net.core.somaxconn", wantErr: true},
+		{name: "kernel.panic", wantErr: true},
+		{name: "net.ipv4.conf.all.rp_filter", wantErr: true},
+		{name: "net.ipv6.conf.default.forwarding", wantErr: true},
+		{name: "net.ipv4.conf.eth0", wantErr: true},
+		{name: "net.ipv4.conf..rp_filter", wantErr: true},
+		{name: "net.ipv4.conf.../rp_filter", wantErr: true},
+		{name: "net.ipv4.conf.averyveryverylongname.rp_filter", wantErr: true},
+		{name: "net.ipv4.conf.eth0.Rp_filter", wantErr: true},
+		{name: "net.ipv4.route.eth0.mtu", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseInterfaceSysctl(tt.name)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseInterfaceSysctl() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseInterfaceSysctl() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNsSetSysctls(t *testing.T) {
+	nsPath, testNS := newTestNamespace(t)
+	nhNs, err := netlink.NewHandleAt(testNS)
+	if err != nil {
+		t.Fatalf("fail to open netlink handle: %v", err)
+	}
+	defer nhNs.Close()
+	veth := &netlink.Veth{LinkAttrs: netlink.LinkAttrs{Name: "testveth-sc0"}, PeerName: "testveth-sc1"}
+	if err := nhNs.LinkAdd(veth); err != nil {
+		t.Fatalf("fail to add veth: %v", err)
+	}
+
+	values := map[string]string{
+		"net.ipv4.conf.testveth-sc0.rp_filter":  "2",
+		"net.ipv4.conf.testveth-sc0.arp_ignore": "1",
+	}
+	if err := NsSetSysctls(nsPath, values); err != nil {
+		t.Fatalf("fail to set sysctls: %v", err)
+	}
+	for name, want := range values {
+		if got := readNsSysctl(t, testNS, name); got != want {
+			t.Errorf("expected %s %s, got %s", name, want, got)
+		}
+	}
+	// the peer is not modified
+	if got := readNsSysctl(t, testNS, "net.ipv4.conf.testveth-sc1.arp_ignore"); got != "0" {
+		t.Errorf("expected arp_ignore 0 on the peer, got %s", got)
+	}
+
+	if err := NsSetSysctls(nsPath, map[string]string{"net.ipv4.ip_forward": "1"}); err == nil {
+		t.Errorf("expected an error setting a global sysctl")
+	}
+
+	if err := NsResetSysctls(nsPath, []string{"net.ipv4.conf.testveth-sc0.rp_filter", "net.ipv4.conf.testveth-sc0.arp_ignore"}); err != nil {
+		t.Fatalf("fail to reset sysctls: %v", err)
+	}
+	for name := range values {
+		sysctl, _ := ParseInterfaceSysctl(name)
+		if got, want := readNsSysctl(t, testNS, name), readNsSysctl(t, testNS, "net.ipv4.conf.default."+sysctl.Key); got != want {
+			t.Errorf("expected %s reset to %s, got %s", name, want, got)
+		}
+	}
+}
+
+// readNsSysctl returns the value of the sysctl name in the namespace ns.
+func readNsSysctl(t *testing.T, ns netns.NsHandle, name string) string {
+	t.Helper()
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	origNs, err := netns.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer origNs.Close()
+	if err := netns.Set(ns); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := netns.Set(origNs); err != nil {
+			t.Fatal(err)
+		}
+	}()
+	value, err := os.ReadFile("/proc/sys/" + strings.ReplaceAll(name, ".", "/"))
+	if err != nil {
+		t.Fatalf("fail to read %s: %v", name, err)
+	}
+	return strings.TrimSpace(string(value))
+}
@@ -0,0 +1,133 @@
+package net
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// sysfsNetPath is the sysfs directory with the host network interfaces,
+// it is a variable so tests can point it to a fake tree.
+var sysfsNetPath = "/sys/class/net"
+
+// readSysfsNetAttr reads the sysfs attribute attr of the host interface ifName.
+func readSysfsNetAttr(ifName string, attr string) (string, error) {
+	data, err := os.ReadFile(filepath.Join(sysfsNetPath, ifName, attr))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// LinkSpeed returns the speed in Mbps of the host interface ifName, virtual
+// interfaces or interfaces without carrier report an unknown speed as -1.
+func LinkSpeed(ifName string) (int, error) {
+	value, err := readSysfsNetAttr(ifName, "speed")
+	if err != nil {
+		return -1, fmt.Errorf("failed to read speed of interface %s: %w", ifName, err)
+	}
+	speed, err := strconv.Atoi(value)
+	if err != nil {
+		return -1, fmt.Errorf("invalid speed %q for interface %s: %w", value, ifName, err)
+	}
+	return speed, nil
+}
+
+// LinkOperState returns the RFC 2863 operational state of the host interface
+// ifName, e.g. up, down, lowerlayerdown or unknown for the interfaces whose
+// driver does not report it.
+func LinkOperState(ifName string) (string, error) {
+	value, err := readSysfsNetAttr(ifName, "operstate")
+	if err != nil {
+		return "", fmt.Errorf("failed to read operational state of interface %s: %w", ifName, err)
+	}
+	return value, nil
+}
+
+// PCIAddress returns the PCI address of the device backing the host
+// interface ifName, virtual interfaces are not backed by a PCI device.
+func PCIAddress(ifName string) (string, error) {
+	target, err := os.Readlink(filepath.Join(sysfsNetPath, ifName, "device"))
+	if err != nil {
+		return "", fmt.Errorf("interface %s is not backed by a device: %w", ifName, err)
+	}
+	return filepath.Base(target), nil
+}
+
+// PhysfnPCIAddress returns the PCI address of the physical function of the
+// SR-IOV virtual function backing the host interface ifName.
+func PhysfnPCIAddress(ifName string) (string, error) {
+	target, err := os.Readlink(filepath.Join(sysfsNetPath, ifName, "device", "physfn"))
+	if err != nil {
+		return "", fmt.Errorf("interface %s is not a virtual function: %w", ifName, err)
+	}
+	return filepath.Base(target), nil
+}
+
+// KernelDriver returns the name of the kernel driver bound to the device
+// backing the host interface ifName, e.g. mlx5_core.
+func KernelDriver(ifName string) (string, error) {
+	target, err := os.Readlink(filepath.Join(sysfsNetPath, ifName, "device", "driver"))
+	if err != nil {
+		return "", fmt.Errorf("interface %s has no device driver: %w", ifName, err)
+	}
+	return filepath.Base(target), nil
+}
+
+// NUMANode returns the NUMA node of the device backing the host interface
+// ifName, -1 if the platform does not report it.
+func NUMANode(ifName string) (int, error) {
+	value, err := readSysfsNetAttr(ifName, filepath.Join("device", "numa_node"))
+	if err != nil {
+		return -1, fmt.Errorf("failed to read the numa node of interface %s: %w", ifName, err)
+	}
+	node, err := strconv.Atoi(value)
+	if err != nil {
+		return -1, fmt.Errorf("invalid numa node %q for interface %s: %w", value, ifName, err)
+	}
+	return node, nil
+}
+
+// PCIVendorID returns the PCI vendor id of the device backing the host
+// interface ifName, as 4 lowercase hexadecimal digits, e.g. 15b3.
+func PCIVendorID(ifName string) (string, error) {
+	return readPCIID(ifName, "vendor")
+}
+
+// PCIDeviceID returns the PCI device id of the device backing the host
+// interface ifName, as 4 lowercase hexadecimal digits, e.g. 101d.
+func PCIDeviceID(ifName string) (string, error) {
+	return readPCIID(ifName, "device")
+}
+
+func readPCIID(ifName string, attr string) (string, error) {
+	value, err := readSysfsNetAttr(ifName, filepath.Join("device", attr))
+	if err != nil {
+		return "", fmt.Errorf("failed to read the pci %s id of interface %s: %w", attr, ifName, err)
+	}
+	id, err := strconv.ParseUint(strings.TrimPrefix(strings.ToLower(value), "0x"), 16, 16)
+	if err != nil {
+		return "", fmt.Errorf("invalid pci %s id %q for interface %s: %w", attr, value, ifName, err)
+	}
+	return fmt.Sprintf("%04x", id), nil
+}
+
+// RDMADevices returns the RDMA devices, e.g. mlx5_0, of the device backing
+// the host interface ifName, none if it does not support RDMA or its RDMA
+// driver is not loaded.
+func RDMADevices(ifName string) ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(sysfsNetPath, ifName, "device", "infiniband"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read the rdma devices of interface %s: %w", ifName, err)
+	}
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	return names, nil
+}
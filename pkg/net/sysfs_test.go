@@ -0,0 +1,235 @@
+package net
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// fakeSysfs creates a fake sysfs tree with the given attributes per interface
+// and points the package to it until the test finishes.
+func fakeSysfs(t *testing.T, attrs map[string]map[string]string) {
+	t.Helper()
+	dir := t.TempDir()
+	for ifName, files := range attrs {
+		for name, value := range files {
+			path := filepath.Join(dir, ifName, name)
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(path, []byte(value+"\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	orig := sysfsNetPath
+	sysfsNetPath = dir
+	t.Cleanup(func() { sysfsNetPath = orig })
+}
+
+func TestLinkSpeed(t *testing.T) {
+	fakeSysfs(t, map[string]map[string]string{
+		"eth0":   {"speed": "25000"},
+		"dummy0": {"speed": "-1"},
+		"bad0":   {"speed": "fast"},
+	})
+	tests := []struct {
+		ifName  string
+		want    int
+		wantErr bool
+	}{
+		{ifName: "eth0", want: 25000},
+		{ifName: "dummy0", want: -1},
+		{ifName: "bad0", want: -1, wantErr: true},
+		{ifName: "missing0", want: -1, wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := LinkSpeed(tt.ifName)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("LinkSpeed(%s) error = %v, wantErr %v", tt.ifName, err, tt.wantErr)
+		}
+		if got != tt.want {
+			t.Errorf("LinkSpeed(%s) = %d, want %d", tt.ifName, got, tt.want)
+		}
+	}
+}
+
+func TestLinkOperState(t *testing.T) {
+	fakeSysfs(t, map[string]map[string]string{
+		"eth0":   {"operstate": "up"},
+		"dummy0": {"operstate": "unknown"},
+	})
+	tests := []struct {
+		ifName  string
+		want    string
+		wantErr bool
+	}{
+		{ifName: "eth0", want: "up"},
+		{ifName: "dummy0", want: "unknown"},
+		{ifName: "missing0", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := LinkOperState(tt.ifName)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("LinkOperState(%s) error = %v, wantErr %v", tt.ifName, err, tt.wantErr)
+		}
+		if got != tt.want {
+			t.Errorf("LinkOperState(%s) = %q, want %q", tt.ifName, got, tt.want)
+		}
+	}
+}
+
+func TestPCIAddress(t *testing.T) {
+	dir := t.TempDir()
+	orig := sysfsNetPath
+	sysfsNetPath = filepath.Join(dir, "class", "net")
+	t.Cleanup(func() { sysfsNetPath = orig })
+
+	// PF eth0 at 0000:3b:00.0 and its VF eth1 at 0000:3b:02.0
+	pf := filepath.Join(dir, "devices", "0000:3b:00.0")
+	vf := filepath.Join(dir, "devices", "0000:3b:02.0")
+	for _, path := range []string{pf, vf, filepath.Join(sysfsNetPath, "eth0"), filepath.Join(sysfsNetPath, "eth1"), filepath.Join(sysfsNetPath, "dummy0")} {
+		if err := os.MkdirAll(path, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink("../../../devices/0000:3b:00.0", filepath.Join(sysfsNetPath, "eth0", "device")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("../../../devices/0000:3b:02.0", filepath.Join(sysfsNetPath, "eth1", "device")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("../0000:3b:00.0", filepath.Join(vf, "physfn")); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, err := PCIAddress("eth0"); err != nil || got != "0000:3b:00.0" {
+		t.Errorf("PCIAddress(eth0) = %q, %v", got, err)
+	}
+	if got, err := PCIAddress("eth1"); err != nil || got != "0000:3b:02.0" {
+		t.Errorf("PCIAddress(eth1) = %q, %v", got, err)
+	}
+	if _, err := PCIAddress("dummy0"); err == nil {
+		t.Errorf("expected error for virtual interface")
+	}
+	if got, err := PhysfnPCIAddress("eth1"); err != nil || got != "0000:3b:00.0" {
+		t.Errorf("PhysfnPCIAddress(eth1) = %q, %v", got, err)
+	}
+	if _, err := PhysfnPCIAddress("eth0"); err == nil {
+		t.Errorf("expected error for physical function")
+	}
+}
+
+func TestKernelDriver(t *testing.T) {
+	dir := t.TempDir()
+	orig := sysfsNetPath
+	sysfsNetPath = filepath.Join(dir, "class", "net")
+	t.Cleanup(func() { sysfsNetPath = orig })
+
+	device := filepath.Join(dir, "devices", "0000:3b:00.0")
+	for _, path := range []string{device, filepath.Join(dir, "bus", "pci", "drivers", "mlx5_core"), filepath.Join(sysfsNetPath, "eth0"), filepath.Join(sysfsNetPath, "dummy0")} {
+		if err := os.MkdirAll(path, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink("../../../devices/0000:3b:00.0", filepath.Join(sysfsNetPath, "eth0", "device")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("../../bus/pci/drivers/mlx5_core", filepath.Join(device, "driver")); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, err := KernelDriver("eth0"); err != nil || got != "mlx5_core" {
+		t.Errorf("KernelDriver(eth0) = %q, %v", got, err)
+	}
+	if _, err := KernelDriver("dummy0"); err == nil {
+		t.Errorf("expected error for virtual interface")
+	}
+}
+
+func TestNUMANode(t *testing.T) {
+	fakeSysfs(t, map[string]map[string]string{
+		"eth0": {"device/numa_node": "1"},
+		"eth1": {"device/numa_node": "-1"},
+		"bad0": {"device/numa_node": "first"},
+	})
+	tests := []struct {
+		ifName  string
+		want    int
+		wantErr bool
+	}{
+		{ifName: "eth0", want: 1},
+		{ifName: "eth1", want: -1},
+		{ifName: "bad0", want: -1, wantErr: true},
+		{ifName: "dummy0", want: -1, wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := NUMANode(tt.ifName)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("NUMANode(%s) error = %v, wantErr %v", tt.ifName, err, tt.wantErr)
+		}
+		if got != tt.want {
+			t.Errorf("NUMANode(%s) = %d, want %d", tt.ifName, got, tt.want)
+		}
+	}
+}
+
+func TestPCIVendorID(t *testing.T) {
+	fakeSysfs(t, map[string]map[string]string{
+		"eth0": {"device/vendor": "0x15b3", "device/device": "0x101D"},
+		"eth1": {"device/vendor": "0x8086", "device/device": "0x1592"},
+		"bad0": {"device/vendor": "mellanox", "device/device": "0x10000"},
+	})
+	tests := []struct {
+		ifName     string
+		wantVendor string
+		wantDevice string
+		wantErr    bool
+	}{
+		{ifName: "eth0", wantVendor: "15b3", wantDevice: "101d"},
+		{ifName: "eth1", wantVendor: "8086", wantDevice: "1592"},
+		{ifName: "bad0", wantErr: true},
+		{ifName: "dummy0", wantErr: true},
+	}
+	for _, tt := range tests {
+		vendor, err := PCIVendorID(tt.ifName)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("PCIVendorID(%s) error = %v, wantErr %v", tt.ifName, err, tt.wantErr)
+		}
+		if vendor != tt.wantVendor {
+			t.Errorf("PCIVendorID(%s) = %s, want %s", tt.ifName, vendor, tt.wantVendor)
+		}
+		device, err := PCIDeviceID(tt.ifName)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("PCIDeviceID(%s) error = %v, wantErr %v", tt.ifName, err, tt.wantErr)
+		}
+		if device != tt.wantDevice {
+			t.Errorf("PCIDeviceID(%s) = %s, want %s", tt.ifName, device, tt.wantDevice)
+		}
+	}
+}
+
+func TestRDMADevices(t *testing.T) {
+	fakeSysfs(t, map[string]map[string]string{
+		"eth0": {"device/infiniband/mlx5_0/node_type": "1: CA"},
+		"eth1": {"device/vendor": "0x8086"},
+	})
+	tests := []struct {
+		ifName string
+		want   []string
+	}{
+		{ifName: "eth0", want: []string{"mlx5_0"}},
+		{ifName: "eth1"},
+		{ifName: "dummy0"},
+	}
+	for _, tt := range tests {
+		got, err := RDMADevices(tt.ifName)
+		if err != nil {
+			t.Errorf("RDMADevices(%s) unexpected error: %v", tt.ifName, err)
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("RDMADevices(%s) = %v, want %v", tt.ifName, got, tt.want)
+		}
+	}
+}
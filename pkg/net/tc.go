@@ -0,0 +1,101 @@
+package net
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// tbfLatencyUsec is the maximum time a packet can sit in the token bucket.
+	tbfLatencyUsec = 25000
+	// tbfMinBurst is large enough to hold a GSO segment
+	tbfMinBurst = 64 * 1024
+)
+
+// tbfQdisc returns a root token bucket filter qdisc limiting the link to rate bits per second.
+func tbfQdisc(linkIndex int, rate uint64) *netlink.Tbf {
+	rateBytes := rate / 8
+	// allow bursts of 10ms of traffic
+	burst := uint32(rateBytes / 100)
+	if burst < tbfMinBurst {
+		burst = tbfMinBurst
+	}
+	limit := uint32(float64(rateBytes)*tbfLatencyUsec/1000000) + burst
+	return &netlink.Tbf{
+		QdiscAttrs: netlink.QdiscAttrs{
+			LinkIndex: linkIndex,
+			Handle:    netlink.MakeHandle(1, 0),
+			Parent:    netlink.HANDLE_ROOT,
+		},
+		Rate:   rateBytes,
+		Limit:  limit,
+		Buffer: netlink.Xmittime(rateBytes, burst),
+	}
+}
+
+// NsSetEgressRateLimit limits the egress traffic of the interface ifName in
+// the namespace containerNsPath to rate bits per second.
+func NsSetEgressRateLimit(containerNsPath string, ifName string, rate uint64) error {
+	if rate == 0 {
+		return fmt.Errorf("invalid rate limit 0 for interface %s", ifName)
+	}
+	containerNs, err := getNsFromPath(containerNsPath)
+	if err != nil {
+		return fmt.Errorf("could not get network namespace from path %s for network device %s : %w", containerNsPath, ifName, err)
+	}
+	defer closeNs(containerNs)
+
+	nhNs, err := newHandleAt(containerNs)
+	if err != nil {
+		return fmt.Errorf("could not get network namespace handle: %w", err)
+	}
+	defer closeHandle(nhNs)
+
+	nsLink, err := nhNs.LinkByName(ifName)
+	if err != nil && !errors.Is(err, netlink.ErrDumpInterrupted) {
+		return fmt.Errorf("link not found for interface %s on namespace %s: %w", ifName, containerNsPath, err)
+	}
+
+	if err := nhNs.QdiscReplace(tbfQdisc(nsLink.Attrs().Index, rate)); err != nil {
+		return fmt.Errorf("fail to set rate limit on interface %s on namespace %s: %w", ifName, containerNsPath, netlinkError(err))
+	}
+	return nil
+}
+
+// NsDeleteEgressRateLimit removes the rate limit set by NsSetEgressRateLimit
+// on the interface ifName in the namespace containerNsPath, if any.
+func NsDeleteEgressRateLimit(containerNsPath string, ifName string) error {
+	containerNs, err := getNsFromPath(containerNsPath)
+	if err != nil {
+		return fmt.Errorf("could not get network namespace from path %s for network device %s : %w", containerNsPath, ifName, err)
+	}
+	defer closeNs(containerNs)
+
+	nhNs, err := newHandleAt(containerNs)
+	if err != nil {
+		return fmt.Errorf("could not get network namespace handle: %w", err)
+	}
+	defer closeHandle(nhNs)
+
+	nsLink, err := nhNs.LinkByName(ifName)
+	if err != nil && !errors.Is(err, netlink.ErrDumpInterrupted) {
+		return fmt.Errorf("link not found for interface %s on namespace %s: %w", ifName, containerNsPath, err)
+	}
+
+	qdiscs, err := nhNs.QdiscList(nsLink)
+	if err != nil {
+		return fmt.Errorf("fail to list qdiscs on interface %s on namespace %s: %w", ifName, containerNsPath, netlinkError(err))
+	}
+	for _, qdisc := range qdiscs {
+		if qdisc.Type() != "tbf" || qdisc.Attrs().Parent != netlink.HANDLE_ROOT {
+			continue
+		}
+		if err := nhNs.QdiscDel(qdisc); err != nil && !errors.Is(err, unix.ENOENT) {
+			return fmt.Errorf("fail to remove rate limit on interface %s on namespace %s: %w", ifName, containerNsPath, netlinkError(err))
+		}
+	}
+	return nil
+}
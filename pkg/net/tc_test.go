@@ -0,0 +1,104 @@
+package net
+
+import (
+	"testing"
+
+	"github.com/vishvananda/netlink"
+)
+
+func Test_tbfQdisc(t *testing.T) {
+	tests := []struct {
+		name      string
+		rate      uint64
+		wantBurst uint32
+	}{
+		// 10ms of traffic is below the size of a GSO segment
+		{name: "10M", rate: 10_000_000, wantBurst: tbfMinBurst},
+		// 10ms of traffic at 10Gbps are 12.5MB
+		{name: "10G", rate: 10_000_000_000, wantBurst: 12_500_000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			qdisc := tbfQdisc(7, tt.rate)
+			if qdisc.LinkIndex != 7 || qdisc.Parent != netlink.HANDLE_ROOT || qdisc.Handle != netlink.MakeHandle(1, 0) {
+				t.Errorf("expected a root qdisc of link 7, got %+v", qdisc.QdiscAttrs)
+			}
+			rateBytes := tt.rate / 8
+			if qdisc.Rate != rateBytes {
+				t.Errorf("expected rate %d bytes per second, got %d", rateBytes, qdisc.Rate)
+			}
+			if want := netlink.Xmittime(rateBytes, tt.wantBurst); qdisc.Buffer != want {
+				t.Errorf("expected buffer %d for a burst of %d bytes, got %d", want, tt.wantBurst, qdisc.Buffer)
+			}
+			// the queue holds the latency worth of traffic on top of the burst
+			if want := uint32(float64(rateBytes)*tbfLatencyUsec/1000000) + tt.wantBurst; qdisc.Limit != want {
+				t.Errorf("expected limit %d, got %d", want, qdisc.Limit)
+			}
+		})
+	}
+}
+
+func TestNsSetEgressRateLimit(t *testing.T) {
+	nsPath, testNS := newTestNamespace(t)
+	nhNs, err := netlink.NewHandleAt(testNS)
+	if err != nil {
+		t.Fatalf("fail to open netlink handle: %v", err)
+	}
+	defer nhNs.Close()
+	veth := &netlink.Veth{LinkAttrs: netlink.LinkAttrs{Name: "testveth-tc0"}, PeerName: "testveth-tc1"}
+	if err := nhNs.LinkAdd(veth); err != nil {
+		t.Fatalf("fail to add veth: %v", err)
+	}
+	link, err := nhNs.LinkByName("testveth-tc0")
+	if err != nil {
+		t.Fatalf("fail to get veth: %v", err)
+	}
+	rootTbf := func() *netlink.Tbf {
+		t.Helper()
+		qdiscs, err := nhNs.QdiscList(link)
+		if err != nil {
+			t.Fatalf("fail to list qdiscs: %v", err)
+		}
+		for _, qdisc := range qdiscs {
+			if tbf, ok := qdisc.(*netlink.Tbf); ok && tbf.Parent == netlink.HANDLE_ROOT {
+				return tbf
+			}
+		}
+		return nil
+	}
+
+	if err := NsSetEgressRateLimit(nsPath, "testveth-tc0", 0); err == nil {
+		t.Errorf("expected an error with a rate of 0")
+	}
+	if err := NsSetEgressRateLimit(nsPath, "testveth-tc0", 100_000_000); err != nil {
+		t.Fatalf("fail to set the rate limit: %v", err)
+	}
+	tbf := rootTbf()
+	if tbf == nil {
+		t.Fatalf("expected a root tbf qdisc")
+	}
+	if tbf.Rate != 100_000_000/8 {
+		t.Errorf("expected rate %d bytes per second, got %d", 100_000_000/8, tbf.Rate)
+	}
+	// setting it again replaces the qdisc
+	if err := NsSetEgressRateLimit(nsPath, "testveth-tc0", 1_000_000_000); err != nil {
+		t.Fatalf("fail to replace the rate limit: %v", err)
+	}
+	if tbf := rootTbf(); tbf == nil || tbf.Rate != 1_000_000_000/8 {
+		t.Errorf("expected the rate limit to be replaced, got %+v", tbf)
+	}
+
+	if err := NsDeleteEgressRateLimit(nsPath, "testveth-tc0"); err != nil {
+		t.Fatalf("fail to delete the rate limit: %v", err)
+	}
+	if tbf := rootTbf(); tbf != nil {
+		t.Errorf("expected the rate limit to be removed, got %+v", tbf)
+	}
+	// deleting it without a rate limit is a no-op
+	if err := NsDeleteEgressRateLimit(nsPath, "testveth-tc0"); err != nil {
+		t.Errorf("unexpected error deleting a missing rate limit: %v", err)
+	}
+	if err := NsSetEgressRateLimit(nsPath, "missing", 100_000_000); err == nil {
+		t.Errorf("expected an error for a missing interface")
+	}
+}
@@ -0,0 +1,220 @@
+package net
+
+import (
+	"fmt"
+	"slices"
+
+	"golang.org/x/sys/unix"
+)
+
+// timestampingTxTypes are the hardware timestamping modes of the transmitted
+// packets, indexed by their HWTSTAMP_TX value.
+var timestampingTxTypes = []string{"off", "on", "onestep-sync", "onestep-p2p"}
+
+// timestampingRxFilters are the received packets timestamped by the hardware,
+// indexed by their HWTSTAMP_FILTER value.
+var timestampingRxFilters = []string{
+	"none",
+	"all",
+	"some",
+	"ptpv1-l4-event",
+	"ptpv1-l4-sync",
+	"ptpv1-l4-delay-req",
+	"ptpv2-l4-event",
+	"ptpv2-l4-sync",
+	"ptpv2-l4-delay-req",
+	"ptpv2-l2-event",
+	"ptpv2-l2-sync",
+	"ptpv2-l2-delay-req",
+	"ptpv2-event",
+	"ptpv2-sync",
+	"ptpv2-delay-req",
+	"ntp-all",
+}
+
+// timestampingCapabilities are the SOF_TIMESTAMPING capabilities reported by
+// the drivers, with the names used by ethtool -T.
+var timestampingCapabilities = []struct {
+	flag uint32
+	name string
+}{
+	{unix.SOF_TIMESTAMPING_TX_HARDWARE, "hardware-transmit"},
+	{unix.SOF_TIMESTAMPING_TX_SOFTWARE, "software-transmit"},
+	{unix.SOF_TIMESTAMPING_RX_HARDWARE, "hardware-receive"},
+	{unix.SOF_TIMESTAMPING_RX_SOFTWARE, "software-receive"},
+	{unix.SOF_TIMESTAMPING_SOFTWARE, "software-system-clock"},
+	{unix.SOF_TIMESTAMPING_SYS_HARDWARE, "hardware-legacy-clock"},
+	{unix.SOF_TIMESTAMPING_RAW_HARDWARE, "hardware-raw-clock"},
+}
+
+// TimestampingInfo are the timestamping capabilities of an interface, as
+// reported by ethtool -T.
+type TimestampingInfo struct {
+	// Capabilities are the supported timestamping sources and clocks.
+	Capabilities []string
+	// PHCIndex is the index of the PTP hardware clock, /dev/ptp<index>, or -1
+	// if the interface has none.
+	PHCIndex int
+	// TxTypes are the supported modes of HardwareTimestamping.TxType.
+	TxTypes []string
+	// RxFilters are the supported values of HardwareTimestamping.RxFilter.
+	RxFilters []string
+}
+
+// Hardware returns true if the interface timestamps the transmitted and
+// received packets with its hardware clock.
+func (i TimestampingInfo) Hardware() bool {
+	return slices.Contains(i.Capabilities, "hardware-transmit") &&
+		slices.Contains(i.Capabilities, "hardware-receive") &&
+		slices.Contains(i.Capabilities, "hardware-raw-clock")
+}
+
+// Supports returns an error if the interface can not apply the configuration.
+func (i TimestampingInfo) Supports(config HardwareTimestamping) error {
+	if !slices.Contains(i.TxTypes, config.TxType) {
+		return fmt.Errorf("transmit type %q not supported, supported types: %v", config.TxType, i.TxTypes)
+	}
+	if !slices.Contains(i.RxFilters, config.RxFilter) {
+		return fmt.Errorf("receive filter %q not supported, supported filters: %v", config.RxFilter, i.RxFilters)
+	}
+	return nil
+}
+
+// parseTimestampingInfo decodes the bitmasks of the ETHTOOL_GET_TS_INFO reply.
+func parseTimestampingInfo(info *unix.EthtoolTsInfo) TimestampingInfo {
+	result := TimestampingInfo{PHCIndex: int(info.Phc_index)}
+	for _, capability := range timestampingCapabilities {
+		if info.So_timestamping&capability.flag != 0 {
+			result.Capabilities = append(result.Capabilities, capability.name)
+		}
+	}
+	for value, name := range timestampingTxTypes {
+		if info.Tx_types&(1<<value) != 0 {
+			result.TxTypes = append(result.TxTypes, name)
+		}
+	}
+	for value, name := range timestampingRxFilters {
+		if info.Rx_filters&(1<<value) != 0 {
+			result.RxFilters = append(result.RxFilters, name)
+		}
+	}
+	return result
+}
+
+// HardwareTimestamping is the hardware timestamping configuration of an
+// interface, as set by hwstamp_ctl.
+type HardwareTimestamping struct {
+	// TxType is the timestamping of the transmitted packets: off, on,
+	// onestep-sync or onestep-p2p.
+	TxType string `json:"txType"`
+	// RxFilter are the received packets timestamped, e.g. none, all or ptpv2-event.
+	RxFilter string `json:"rxFilter"`
+}
+
+// Validate checks the transmit type and receive filter are known.
+func (c HardwareTimestamping) Validate() error {
+	if !slices.Contains(timestampingTxTypes, c.TxType) {
+		return fmt.Errorf("invalid txType %q, must be one of %v", c.TxType, timestampingTxTypes)
+	}
+	if !slices.Contains(timestampingRxFilters, c.RxFilter) {
+		return fmt.Errorf("invalid rxFilter %q, must be one of %v", c.RxFilter, timestampingRxFilters)
+	}
+	return nil
+}
+
+func (c HardwareTimestamping) toConfig() *unix.HwTstampConfig {
+	return &unix.HwTstampConfig{
+		Tx_type:   int32(slices.Index(timestampingTxTypes, c.TxType)),
+		Rx_filter: int32(slices.Index(timestampingRxFilters, c.RxFilter)),
+	}
+}
+
+func fromConfig(config *unix.HwTstampConfig) (HardwareTimestamping, error) {
+	if config.Tx_type < 0 || int(config.Tx_type) >= len(timestampingTxTypes) {
+		return HardwareTimestamping{}, fmt.Errorf("unknown transmit type %d", config.Tx_type)
+	}
+	if config.Rx_filter < 0 || int(config.Rx_filter) >= len(timestampingRxFilters) {
+		return HardwareTimestamping{}, fmt.Errorf("unknown receive filter %d", config.Rx_filter)
+	}
+	return HardwareTimestamping{
+		TxType:   timestampingTxTypes[config.Tx_type],
+		RxFilter: timestampingRxFilters[config.Rx_filter],
+	}, nil
+}
+
+// withIoctlSocket runs fn with a socket of the current namespace to issue
+// interface ioctls.
+func withIoctlSocket(fn func(fd int) error) error {
+	fd, err := unix.Socket(unix.AF_INET, unix.SOCK_DGRAM|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return fmt.Errorf("could not open socket: %w", err)
+	}
+	defer unix.Close(fd)
+	return fn(fd)
+}
+
+// GetTimestampingInfo returns the timestamping capabilities of the host
+// interface ifName.
+func GetTimestampingInfo(ifName string) (TimestampingInfo, error) {
+	var info TimestampingInfo
+	err := withIoctlSocket(func(fd int) error {
+		tsInfo, err := unix.IoctlGetEthtoolTsInfo(fd, ifName)
+		if err != nil {
+			return fmt.Errorf("failed to get timestamping capabilities of %s: %w", ifName, err)
+		}
+		info = parseTimestampingInfo(tsInfo)
+		return nil
+	})
+	return info, err
+}
+
+// GetHardwareTimestamping returns the hardware timestamping configuration of
+// the host interface ifName.
+func GetHardwareTimestamping(ifName string) (HardwareTimestamping, error) {
+	var config HardwareTimestamping
+	err := withIoctlSocket(func(fd int) error {
+		var err error
+		config, err = getHardwareTimestamping(fd, ifName)
+		return err
+	})
+	return config, err
+}
+
+// SetHardwareTimestamping sets the hardware timestamping configuration of the
+// host interface ifName.
+func SetHardwareTimestamping(ifName string, config HardwareTimestamping) error {
+	if err := config.Validate(); err != nil {
+		return err
+	}
+	return withIoctlSocket(func(fd int) error {
+		return setHardwareTimestamping(fd, ifName, config)
+	})
+}
+
+// NsSetHardwareTimestamping sets the hardware timestamping configuration of
+// the interface ifName in the namespace containerNsPath.
+func NsSetHardwareTimestamping(containerNsPath string, ifName string, config HardwareTimestamping) error {
+	if err := config.Validate(); err != nil {
+		return err
+	}
+	return inNamespace(containerNsPath, func() error {
+		return withIoctlSocket(func(fd int) error {
+			return setHardwareTimestamping(fd, ifName, config)
+		})
+	})
+}
+
+func setHardwareTimestamping(fd int, ifName string, config HardwareTimestamping) error {
+	if err := unix.IoctlSetHwTstamp(fd, ifName, config.toConfig()); err != nil {
+		return fmt.Errorf("failed to set hardware timestamping %s/%s on %s: %w", config.TxType, config.RxFilter, ifName, err)
+	}
+	return nil
+}
+
+func getHardwareTimestamping(fd int, ifName string) (HardwareTimestamping, error) {
+	config, err := unix.IoctlGetHwTstamp(fd, ifName)
+	if err != nil {
+		return HardwareTimestamping{}, fmt.Errorf("failed to get hardware timestamping of %s: %w", ifName, err)
+	}
+	return fromConfig(config)
+}
@@ -0,0 +1,120 @@
+package net
+
+import (
+	"reflect"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func Test_parseTimestampingInfo(t *testing.T) {
+	tests := []struct {
+		name         string
+		info         unix.EthtoolTsInfo
+		want         TimestampingInfo
+		wantHardware bool
+	}{
+		{
+			name: "software only",
+			info: unix.EthtoolTsInfo{
+				So_timestamping: unix.SOF_TIMESTAMPING_TX_SOFTWARE | unix.SOF_TIMESTAMPING_RX_SOFTWARE | unix.SOF_TIMESTAMPING_SOFTWARE,
+				Phc_index:       -1,
+			},
+			want: TimestampingInfo{
+				Capabilities: []string{"software-transmit", "software-receive", "software-system-clock"},
+				PHCIndex:     -1,
+			},
+		},
+		{
+			name: "ptp hardware clock",
+			info: unix.EthtoolTsInfo{
+				So_timestamping: unix.SOF_TIMESTAMPING_TX_HARDWARE | unix.SOF_TIMESTAMPING_TX_SOFTWARE |
+					unix.SOF_TIMESTAMPING_RX_HARDWARE | unix.SOF_TIMESTAMPING_RX_SOFTWARE |
+					unix.SOF_TIMESTAMPING_SOFTWARE | unix.SOF_TIMESTAMPING_RAW_HARDWARE,
+				Phc_index:  2,
+				Tx_types:   1<<unix.HWTSTAMP_TX_OFF | 1<<unix.HWTSTAMP_TX_ON,
+				Rx_filters: 1<<unix.HWTSTAMP_FILTER_NONE | 1<<unix.HWTSTAMP_FILTER_PTP_V2_EVENT,
+			},
+			want: TimestampingInfo{
+				Capabilities: []string{"hardware-transmit", "software-transmit", "hardware-receive",
+					"software-receive", "software-system-clock", "hardware-raw-clock"},
+				PHCIndex:  2,
+				TxTypes:   []string{"off", "on"},
+				RxFilters: []string{"none", "ptpv2-event"},
+			},
+			wantHardware: true,
+		},
+		{
+			name: "receive only",
+			info: unix.EthtoolTsInfo{
+				So_timestamping: unix.SOF_TIMESTAMPING_RX_HARDWARE | unix.SOF_TIMESTAMPING_RAW_HARDWARE,
+				Phc_index:       0,
+				Tx_types:        1 << unix.HWTSTAMP_TX_OFF,
+				Rx_filters:      1<<unix.HWTSTAMP_FILTER_NONE | 1<<unix.HWTSTAMP_FILTER_ALL | 1<<15,
+			},
+			want: TimestampingInfo{
+				Capabilities: []string{"hardware-receive", "hardware-raw-clock"},
+				PHCIndex:     0,
+				TxTypes:      []string{"off"},
+				RxFilters:    []string{"none", "all", "ntp-all"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseTimestampingInfo(&tt.info)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseTimestampingInfo() = %+v, want %+v", got, tt.want)
+			}
+			if got.Hardware() != tt.wantHardware {
+				t.Errorf("Hardware() = %v, want %v", got.Hardware(), tt.wantHardware)
+			}
+		})
+	}
+}
+
+func TestTimestampingInfo_Supports(t *testing.T) {
+	info := TimestampingInfo{TxTypes: []string{"off", "on"}, RxFilters: []string{"none", "ptpv2-event"}}
+	tests := []struct {
+		config  HardwareTimestamping
+		wantErr bool
+	}{
+		{config: HardwareTimestamping{TxType: "on", RxFilter: "ptpv2-event"}},
+		{config: HardwareTimestamping{TxType: "off", RxFilter: "none"}},
+		{config: HardwareTimestamping{TxType: "onestep-sync", RxFilter: "ptpv2-event"}, wantErr: true},
+		{config: HardwareTimestamping{TxType: "on", RxFilter: "all"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		if err := info.Supports(tt.config); (err != nil) != tt.wantErr {
+			t.Errorf("Supports(%+v) error = %v, wantErr %v", tt.config, err, tt.wantErr)
+		}
+	}
+}
+
+func TestHardwareTimestamping_config(t *testing.T) {
+	for _, tt := range []struct {
+		config  HardwareTimestamping
+		wantErr bool
+	}{
+		{config: HardwareTimestamping{TxType: "on", RxFilter: "ptpv2-l2-event"}},
+		{config: HardwareTimestamping{TxType: "onestep-p2p", RxFilter: "ntp-all"}},
+		{config: HardwareTimestamping{TxType: "enabled", RxFilter: "all"}, wantErr: true},
+		{config: HardwareTimestamping{TxType: "on"}, wantErr: true},
+	} {
+		err := tt.config.Validate()
+		if (err != nil) != tt.wantErr {
+			t.Fatalf("Validate(%+v) error = %v, wantErr %v", tt.config, err, tt.wantErr)
+		}
+		if err != nil {
+			continue
+		}
+		// the ioctl values round trip
+		got, err := fromConfig(tt.config.toConfig())
+		if err != nil || got != tt.config {
+			t.Errorf("fromConfig(toConfig(%+v)) = %+v, %v", tt.config, got, err)
+		}
+	}
+	if _, err := fromConfig(&unix.HwTstampConfig{Tx_type: 9}); err == nil {
+		t.Errorf("expected error for an unknown transmit type")
+	}
+}